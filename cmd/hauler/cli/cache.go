@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/rancherfederal/hauler/cmd/hauler/cli/store"
+)
+
+func addCache(parent *cobra.Command) {
+	o := &store.CacheOpts{}
+
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and prune the layer cache shared by stores",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	o.AddArgs(cmd)
+
+	cmd.AddCommand(
+		addCacheInfo(o),
+		addCachePrune(o),
+	)
+
+	parent.AddCommand(cmd)
+}
+
+func addCacheInfo(co *store.CacheOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "info",
+		Short: "Report the layers held by the cache and the space they take",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return store.CacheInfoCmd(cmd.Context(), co)
+		},
+	}
+
+	return cmd
+}
+
+func addCachePrune(co *store.CacheOpts) *cobra.Command {
+	o := &store.CachePruneOpts{CacheOpts: co}
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove layers from the cache, least recently used first",
+		Example: `
+# Remove the layers no store has used in the last 30 days
+hauler cache prune --cache ~/.cache/hauler --older-than 720h
+
+# Shrink the cache to at most 20GB, reporting what would go first
+hauler cache prune --cache ~/.cache/hauler --max-size 20GB --dry-run`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return store.CachePruneCmd(cmd.Context(), o)
+		},
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
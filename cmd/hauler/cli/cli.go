@@ -1,13 +1,25 @@
 package cli
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
 
+	"github.com/rancherfederal/hauler/pkg/content"
 	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/staging"
+	"github.com/rancherfederal/hauler/pkg/telemetry"
 )
 
 type rootOpts struct {
-	logLevel string
+	config    string
+	logLevel  string
+	logFormat string
+	proxy     string
+	noProxy   string
+
+	otlpEndpoint string
 }
 
 var ro = &rootOpts{}
@@ -17,9 +29,41 @@ func New() *cobra.Command {
 		Use:   "hauler",
 		Short: "Airgap Swiss Army Knife",
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := loadDefaults(cmd); err != nil {
+				return err
+			}
+
 			l := log.FromContext(cmd.Context())
 			l.SetLevel(ro.logLevel)
+			if err := l.SetFormat(ro.logFormat); err != nil {
+				return err
+			}
 			l.Debugf("running cli command [%s]", cmd.CommandPath())
+
+			if err := content.SetProxy(ro.proxy, ro.noProxy); err != nil {
+				return err
+			}
+			if proxy := os.Getenv(content.HTTPSProxyEnv); proxy != "" {
+				l.Debugf("using proxy [%s], bypassed for [%s]", proxy, os.Getenv(content.NoProxyEnv))
+			}
+
+			ctx, err := telemetry.Setup(cmd.Context(), ro.otlpEndpoint, cmd.CommandPath())
+			if err != nil {
+				return err
+			}
+			cmd.SetContext(ctx)
+			if ro.otlpEndpoint != "" {
+				l.Debugf("exporting traces to [%s]", ro.otlpEndpoint)
+			}
+
+			// staging directories of runs killed before they could remove them are left behind otherwise
+			removed, err := staging.Sweep("", staging.DefaultMaxAge)
+			if err != nil {
+				l.Warnf("failed to remove stale staging directories: %v", err)
+			}
+			for _, path := range removed {
+				l.Debugf("removed stale staging directory [%s]", path)
+			}
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -28,13 +72,50 @@ func New() *cobra.Command {
 	}
 
 	pf := cmd.PersistentFlags()
+	pf.StringVar(&ro.config, "config", "", "(Optional) Configuration file of flag defaults, overridden by HAULER_<FLAG> environment variables and the flags themselves (defaults to "+defaultConfigFile+" if it exists)")
 	pf.StringVarP(&ro.logLevel, "log-level", "l", "info", "")
+	pf.StringVar(&ro.logFormat, "log-format", log.FormatText, "(Optional) Format of the log output: text, or json for an entry per line with its level, timestamp, and the reference, digest, bytes, and duration in seconds of the artifacts processed")
+	pf.StringVar(&ro.proxy, "proxy", "", "(Optional) Proxy for every http and https request, in place of HTTP_PROXY and HTTPS_PROXY")
+	pf.StringVar(&ro.noProxy, "no-proxy", "", "(Optional) Comma separated hosts, domains, and CIDRs requested without the proxy, in place of NO_PROXY")
+	pf.StringVar(&ro.otlpEndpoint, "otlp-endpoint", "", "(Optional) OTLP/HTTP collector to export traces of the command to, i.e. 'http://localhost:4318'. The trace context is propagated to the registries requested, so their traces are correlated with those of hauler")
 
 	// Add subcommands
 	addLogin(cmd)
+	addLogout(cmd)
 	addStore(cmd)
+	addCache(cmd)
 	addVersion(cmd)
 	addCompletion(cmd)
 
 	return cmd
 }
+
+// loadDefaults sets the flags of cmd not given on the command line from the environment and the configuration file
+func loadDefaults(cmd *cobra.Command) error {
+	path, required := ro.config, true
+	if path == "" {
+		path, required = os.Getenv(envName("config")), true
+	}
+	if path == "" {
+		path, required = defaultConfigFile, false
+	}
+
+	c, err := loadConfig(path, required)
+	if err != nil {
+		return err
+	}
+	if err := c.validate(cmd.Root()); err != nil {
+		return fmt.Errorf("config [%s]: %w", path, err)
+	}
+
+	// whether the store was named on the command line is recorded before the defaults mark its flags as set
+	storeGiven, nameGiven := cmd.Flags().Changed("store"), cmd.Flags().Changed("store-name")
+	if err := c.applyDefaults(cmd, cmd.Root()); err != nil {
+		return err
+	}
+	if cmd.Flags().Lookup("store-name") == nil {
+		return nil
+	}
+	rootStoreOpts.Stores = c.stores
+	return rootStoreOpts.SelectStore(storeGiven, nameGiven)
+}
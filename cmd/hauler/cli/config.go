@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rancherfederal/hauler/cmd/hauler/cli/store"
+)
+
+const (
+	// defaultConfigFile is read when neither --config nor HAULER_CONFIG name a configuration file, if it exists
+	defaultConfigFile = "~/.hauler/config.yaml"
+
+	// envPrefix prefixes the environment variables flags are defaulted from, --store is HAULER_STORE
+	envPrefix = "HAULER_"
+
+	// commandsKey is the section of the configuration file holding the defaults of single commands
+	commandsKey = "commands"
+
+	// storesKey is the section of the configuration file defining the named stores --store-name selects from
+	storesKey = "stores"
+)
+
+// config holds the defaults of the flags read from the configuration file
+//
+//	Top level keys are flag names, defaulting the flag of every command that has it, while the commands section holds
+//	the defaults of single commands by their path, overriding the top level ones.  The stores section names stores
+//	for --store-name:
+//
+//	log-level: debug
+//	store: /var/lib/hauler/store
+//	cache: /var/cache/hauler
+//	layer-concurrency: 8
+//	ca-file: /etc/pki/tls/certs/enclave-ca.pem
+//	commands:
+//	  store sync:
+//	    registry: harbor.enclave.example.com
+//	  store copy:
+//	    concurrency: 8
+//	store-name: prod
+//	stores:
+//	  prod:
+//	    path: /srv/hauler/prod
+//	    description: Product release haul
+//	  dev:
+//	    path: ~/hauls/dev
+type config struct {
+	global   map[string]interface{}
+	commands map[string]map[string]interface{}
+	stores   map[string]store.NamedStore
+}
+
+// storeConfig is a store of the stores section of the configuration file
+type storeConfig struct {
+	Path        string `json:"path"`
+	Description string `json:"description,omitempty"`
+}
+
+// loadConfig reads the configuration file at path, a missing file is only an error when required
+func loadConfig(path string, required bool) (*config, error) {
+	c := &config{}
+	expanded, err := homedir.Expand(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(expanded)
+	if os.IsNotExist(err) && !required {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading config [%s]: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, &c.global); err != nil {
+		return nil, fmt.Errorf("parsing config [%s]: %w", path, err)
+	}
+	if err := c.section(commandsKey, &c.commands); err != nil {
+		return nil, fmt.Errorf("parsing the %s of config [%s]: %w", commandsKey, path, err)
+	}
+
+	var stores map[string]storeConfig
+	if err := c.section(storesKey, &stores); err != nil {
+		return nil, fmt.Errorf("parsing the %s of config [%s]: %w", storesKey, path, err)
+	}
+	c.stores = make(map[string]store.NamedStore, len(stores))
+	for name, sc := range stores {
+		if sc.Path == "" {
+			return nil, fmt.Errorf("store [%s] of config [%s] has no path", name, path)
+		}
+		c.stores[name] = store.NamedStore{Path: sc.Path, Description: sc.Description}
+	}
+	return c, nil
+}
+
+// section moves the section key out of the top level keys and decodes it into v
+//
+//	The section is decoded again into its own type rather than asserting each level of the generic map.
+func (c *config) section(key string, v interface{}) error {
+	raw, ok := c.global[key]
+	if !ok {
+		return nil
+	}
+	delete(c.global, key)
+	b, err := yaml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(b, v)
+}
+
+// validate rejects the keys of the configuration file that name no flag, of any command for the top level keys and of
+// the command they're under for the commands section, so a misspelled setting isn't silently ignored
+func (c *config) validate(root *cobra.Command) error {
+	all := make(map[string]bool)
+	byPath := make(map[string]*cobra.Command)
+	var walk func(*cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		byPath[strings.TrimPrefix(cmd.CommandPath(), root.Name()+" ")] = cmd
+		for _, fs := range []*pflag.FlagSet{cmd.LocalNonPersistentFlags(), cmd.PersistentFlags()} {
+			fs.VisitAll(func(f *pflag.Flag) { all[f.Name] = true })
+		}
+		for _, sub := range cmd.Commands() {
+			walk(sub)
+		}
+	}
+	walk(root)
+
+	for _, k := range sortedKeys(c.global) {
+		if !all[k] {
+			return fmt.Errorf("[%s] is not a flag of any command", k)
+		}
+	}
+	for path, settings := range c.commands {
+		cmd, ok := byPath[path]
+		if !ok {
+			return fmt.Errorf("[%s] is not a command", path)
+		}
+		for _, k := range sortedKeys(settings) {
+			if cmd.Flags().Lookup(k) == nil && cmd.InheritedFlags().Lookup(k) == nil {
+				return fmt.Errorf("[%s] is not a flag of [%s]", k, path)
+			}
+		}
+	}
+	return nil
+}
+
+// applyDefaults sets the flags of cmd not given on the command line, from the environment first, then the section of
+// cmd in the configuration file, then its top level keys
+func (c *config) applyDefaults(cmd *cobra.Command, root *cobra.Command) error {
+	section := c.commands[strings.TrimPrefix(cmd.CommandPath(), root.Name()+" ")]
+
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "help" || f.Name == "config" {
+			return
+		}
+
+		env := envName(f.Name)
+		if v, ok := os.LookupEnv(env); ok {
+			if serr := cmd.Flags().Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("setting --%s from [%s]: %w", f.Name, env, serr)
+			}
+			return
+		}
+
+		v, ok := section[f.Name]
+		if !ok {
+			v, ok = c.global[f.Name]
+		}
+		if !ok {
+			return
+		}
+		if serr := setFlag(cmd.Flags(), f.Name, v); serr != nil {
+			err = fmt.Errorf("setting --%s from config: %w", f.Name, serr)
+		}
+	})
+	return err
+}
+
+// setFlag sets the flag name to the value v of the configuration file, each item of a list in turn
+func setFlag(fs *pflag.FlagSet, name string, v interface{}) error {
+	items, ok := v.([]interface{})
+	if !ok {
+		return fs.Set(name, configValue(v))
+	}
+	if _, ok := fs.Lookup(name).Value.(pflag.SliceValue); !ok {
+		return fmt.Errorf("a list is given, but the flag takes a single value")
+	}
+	for _, item := range items {
+		if err := fs.Set(name, configValue(item)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configValue returns the value of the configuration file v as it would be given on the command line
+func configValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		// numbers are decoded as floats, formatted without an exponent so large sizes and counts still parse
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// envName returns the environment variable the flag name is defaulted from
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,29 +1,39 @@
 package cli
 
 import (
+	"bufio"
 	"context"
-	"strings"
-	"os"
-	"io"
 	"fmt"
-	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strings"
 
-	"oras.land/oras-go/pkg/content"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
 
-	"github.com/rancherfederal/hauler/pkg/cosign"
+	"github.com/rancherfederal/hauler/cmd/hauler/cli/store"
+	"github.com/rancherfederal/hauler/pkg/content"
+	"github.com/rancherfederal/hauler/pkg/log"
 )
 
 type Opts struct {
-	Username  string
-	Password  string
+	Username      string
+	Password      string
 	PasswordStdin bool
+	Insecure      bool
+	PlainHTTP     bool
+	TLS           store.RegistryTLSOpts
 }
 
 func (o *Opts) AddArgs(cmd *cobra.Command) {
 	f := cmd.Flags()
-	f.StringVarP(&o.Username, "username", "u", "", "Username")
-	f.StringVarP(&o.Password, "password", "p", "", "Password")
+	f.StringVarP(&o.Username, "username", "u", "", "Username, prompted for when omitted")
+	f.StringVarP(&o.Password, "password", "p", "", "Password, prompted for without echoing it when omitted. Prefer --password-stdin, which keeps it out of the shell history")
 	f.BoolVarP(&o.PasswordStdin, "password-stdin", "", false, "Take the password from stdin")
+	cmd.MarkFlagsMutuallyExclusive("password", "password-stdin")
+	f.BoolVar(&o.Insecure, "insecure", false, "Toggle allowing insecure connections to the registry")
+	f.BoolVar(&o.PlainHTTP, "plain-http", false, "Toggle allowing plain http connections to the registry")
+	o.TLS.AddFlags(cmd)
 }
 
 func addLogin(parent *cobra.Command) {
@@ -32,23 +42,37 @@ func addLogin(parent *cobra.Command) {
 	cmd := &cobra.Command{
 		Use:   "login",
 		Short: "Log in to a registry",
+		Long: `Log in to a registry, storing its credentials for every later command on it
+
+Credentials are checked against the registry, then stored in the file REGISTRY_AUTH_FILE names when set, otherwise in
+the docker config, where cosign and helm find them as well.  A credential store or helper the docker config sets keeps
+the password out of the file.`,
 		Example: `
-# Log in to reg.example.com
-hauler login reg.example.com -u bob -p haulin`,
-		Args:    cobra.ExactArgs(1),
+# Log in to reg.example.com, prompted for the username and password
+hauler login reg.example.com
+
+# Log in to reg.example.com with a password from stdin
+cat password.txt | hauler login reg.example.com -u bob --password-stdin`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, arg []string) error {
 			ctx := cmd.Context()
 
 			if o.PasswordStdin {
-				contents, err := io.ReadAll(os.Stdin)
+				if o.Username == "" {
+					return fmt.Errorf("--username is required with --password-stdin")
+				}
+				contents, err := io.ReadAll(cmd.InOrStdin())
 				if err != nil {
 					return err
 				}
 				o.Password = strings.TrimSuffix(string(contents), "\n")
 				o.Password = strings.TrimSuffix(o.Password, "\r")
 			}
-			
-			if o.Username == "" && o.Password == "" {
+			if err := o.prompt(cmd); err != nil {
+				return err
+			}
+
+			if o.Username == "" || o.Password == "" {
 				return fmt.Errorf("username and password required")
 			}
 
@@ -60,16 +84,53 @@ hauler login reg.example.com -u bob -p haulin`,
 	parent.AddCommand(cmd)
 }
 
+// prompt asks for the username and password missing from o, the password without echoing it
+func (o *Opts) prompt(cmd *cobra.Command) error {
+	if o.Username != "" && o.Password != "" {
+		return nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("username and password required, give them with --username and --password-stdin when not run from a terminal")
+	}
+
+	out := cmd.ErrOrStderr()
+	if o.Username == "" {
+		fmt.Fprint(out, "Username: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		o.Username = strings.TrimSpace(line)
+	}
+	if o.Password == "" {
+		fmt.Fprint(out, "Password: ")
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(out)
+		if err != nil {
+			return err
+		}
+		o.Password = string(password)
+	}
+	return nil
+}
+
 func login(ctx context.Context, o *Opts, registry string) error {
+	l := log.FromContext(ctx)
+
 	ropts := content.RegistryOptions{
-		Username:  o.Username,
-		Password:  o.Password,
-	}
+		Insecure:  o.Insecure,
+		PlainHTTP: o.PlainHTTP,
 
-	err := cosign.RegistryLogin(ctx, nil, registry, ropts)
+		TransportOptions: content.TransportOptions{TLS: o.TLS.Options()},
+	}
+	if err := ropts.TLS.Validate(); err != nil {
+		return err
+	}
+	path, err := content.Login(ctx, registry, o.Username, o.Password, ropts)
 	if err != nil {
 		return err
 	}
-	
+	l.Infof("logged in to [%s], credentials stored in [%s]", registry, path)
 	return nil
-}
\ No newline at end of file
+}
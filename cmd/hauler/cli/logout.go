@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/rancherfederal/hauler/pkg/content"
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+func addLogout(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "logout",
+		Short: "Log out of a registry, removing the credentials hauler login stored for it",
+		Example: `
+# Log out of reg.example.com
+hauler logout reg.example.com`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, arg []string) error {
+			l := log.FromContext(cmd.Context())
+
+			path, err := content.Logout(arg[0])
+			if err != nil {
+				return err
+			}
+			l.Infof("logged out of [%s], credentials removed from [%s]", arg[0], path)
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+}
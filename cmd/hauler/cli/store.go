@@ -28,7 +28,17 @@ func addStore(parent *cobra.Command) {
 		addStoreSave(),
 		addStoreServe(),
 		addStoreInfo(),
+		addStoreList(),
+		addStoreListStores(),
+		addStoreHistory(),
 		addStoreCopy(),
+		addStoreRemove(),
+		addStoreGC(),
+		addStoreVerify(),
+		addStoreRepair(),
+		addStoreDiff(),
+		addStoreSbom(),
+		addStoreScan(),
 
 		// TODO: Remove this in favor of sync?
 		addStoreAdd(),
@@ -43,6 +53,16 @@ func addStoreExtract() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "extract",
 		Short:   "Extract content from the store to disk",
+		Example: `
+# Extract a file or chart under its original filename in the current directory
+hauler store extract hauler/rke2-install.sh:latest
+
+# Extract a file or chart to a path of your choosing
+hauler store extract hauler/rancher-2.7.0.tgz:2.7.0 --output-file charts/rancher.tgz
+
+# Extract the root filesystem of the arm64 image of a multi-platform index
+hauler store extract docker.io/library/alpine:3.18 --rootfs -o alpine-rootfs --platform linux/arm64
+`,
 		Aliases: []string{"x"},
 		Args:    cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -67,13 +87,39 @@ func addStoreSync() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "sync",
 		Short: "Sync content to the embedded content store",
+		Example: `
+# Sync the content listed in one or more content files
+hauler store sync -f images.yaml -f charts.yaml
+
+# Sync content piped in from stdin
+cat manifest.yaml | hauler store sync -f -
+
+# Sync content files parameterized with ${REGISTRY} or {{ .REGISTRY }}
+hauler store sync -f manifest.yaml --set REGISTRY=registry.example.com
+
+# Report what syncing would fetch and the disk space it requires, without syncing
+hauler store sync -f manifest.yaml --dry-run
+
+# Sync only images whose signatures verify against a cosign public key
+hauler store sync -f images.yaml --key cosign.pub
+
+# Sync only content complying with the registries, tags, and signing keys of a policy file
+hauler store sync -f manifest.yaml --policy policy.yaml
+
+# Sync the collections a content file references by path or url, with kind: CollectionRefs, at a templated version
+hauler store sync -f collections.yaml --set GRAFANA_VERSION=10.2.0
+
+# Sync everything a k3s airgap install needs, then extract it on the airgapped host
+hauler store sync --k3s v1.28.5+k3s1 --k3s-arch arm64
+hauler store extract hauler/k3s-airgap-images-arm64.tar.zst:v1.28.5-k3s1 -o /var/lib/rancher/k3s/agent/images`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			s, err := o.Store(ctx)
+			s, unlock, err := o.LockedStore(ctx)
 			if err != nil {
 				return err
 			}
+			defer unlock()
 
 			return store.SyncCmd(ctx, o, s)
 		},
@@ -89,17 +135,23 @@ func addStoreLoad() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "load",
 		Short: "Load a content store from a store archive",
-		Args:  cobra.MinimumNArgs(1),
+		Example: `
+# load an archive
+hauler store load haul.tar.zst
+
+# load an archive only once its haul manifest verifies against the key it was signed with
+hauler store load haul.tar.zst --key cosign.pub
+`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			s, err := o.Store(ctx)
+			s, unlock, err := o.LockedStore(ctx)
 			if err != nil {
 				return err
 			}
-			_ = s
-
-			return store.LoadCmd(ctx, o, args...)
+			defer unlock()
+			return store.LoadCmd(ctx, o, s, args...)
 		},
 	}
 	o.AddFlags(cmd)
@@ -129,6 +181,27 @@ func addStoreServeRegistry() *cobra.Command {
 	cmd := &cobra.Command{
         Use:   "registry",
         Short: "Serve the embedded registry",
+		Example: `
+# Serve the store through a registry backed by a copy of its content
+hauler store serve registry
+
+# Serve the store as a read-only registry straight from its content
+hauler store serve registry --readonly --port 5000
+
+# Serve the store over https with a self-signed certificate, trusting tls/ca.crt on the nodes pulling from it
+hauler store serve registry --tls-self-signed --tls-hosts registry.local,10.0.0.5
+
+# Serve the store over https with a certificate of your own
+hauler store serve registry --tls-cert registry.crt --tls-key registry.key
+
+# Serve the store only to the users of an htpasswd file
+hauler store serve registry --htpasswd-file htpasswd
+
+# Serve the store as a pull-through cache of docker hub, caching whatever is pulled through it into the store
+hauler store serve registry --upstream docker.io
+
+# Serve the store with prometheus metrics at http://localhost:5000/metrics
+hauler store serve registry --readonly --metrics`,
         RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
@@ -151,7 +224,16 @@ func addStoreServeFiles() *cobra.Command {
     o := &store.ServeFilesOpts{RootOpts: rootStoreOpts}
 	cmd := &cobra.Command{
         Use:   "fileserver",
-        Short: "Serve the file server",
+        Short: "Serve the file artifacts and charts of the store over http",
+		Example: `
+# Serve every file in the store under its original filename, with a listing of them at the root
+hauler store serve fileserver --port 8080
+
+# Download a file, resuming it where an earlier download left off
+curl -C - -O http://localhost:8080/install.sh
+
+# Add the charts in the store as a helm repository
+helm repo add hauler http://localhost:8080/charts`,
         RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
@@ -175,7 +257,17 @@ func addStoreSave() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "save",
 		Short: "Save a content store to a store archive",
-		Args:  cobra.ExactArgs(0),
+		Example: `
+# save the store to haul.tar.zst
+hauler store save
+
+# save the store and sign its haul manifest, so loading it can verify the archive
+hauler store save --filename haul.tar.zst --key cosign.key
+
+# upload the archive to object storage, credentials read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY or AWS_PROFILE
+hauler store save --filename s3://transfer/hauls/haul.tar.zst
+`,
+		Args: cobra.ExactArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
@@ -183,9 +275,7 @@ func addStoreSave() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			_ = s
-
-			return store.SaveCmd(ctx, o, o.FileName)
+			return store.SaveCmd(ctx, o, s, o.FileName)
 		},
 	}
 	o.AddArgs(cmd)
@@ -196,13 +286,23 @@ func addStoreSave() *cobra.Command {
 func addStoreInfo() *cobra.Command {
 	o := &store.InfoOpts{RootOpts: rootStoreOpts}
 
-	var allowedValues = []string{"image", "chart", "file", "sigs", "atts", "sbom", "all"}
+	var allowedValues = []string{"image", "chart", "file", "sigs", "atts", "sbom", "referrers", "all"}
 
 	cmd := &cobra.Command{
-		Use:     "info",
-		Short:   "Print out information about the store",
-		Args:    cobra.ExactArgs(0),
-		Aliases: []string{"i", "list", "ls"},
+		Use:   "info [reference]",
+		Short: "Print out information about the store, or the manifests, config, and layers of a single reference",
+		Example: `
+# summarize every reference of the store
+hauler store info
+
+# inspect the manifests, image config, layers, platforms, and annotations of an image
+hauler store info rancher/rancher:v2.8.0
+
+# inspect an image as json, for scripting
+hauler store info rancher/rancher:v2.8.0 --output json | jq '.manifests[].manifest.layers[].digest'
+`,
+		Args:    cobra.RangeArgs(0, 1),
+		Aliases: []string{"i"},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
@@ -210,6 +310,9 @@ func addStoreInfo() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if len(args) == 1 {
+				return store.InspectCmd(ctx, o, s, args[0])
+			}
 			
 			for _, allowed := range allowedValues {
 				if o.TypeFilter == allowed {
@@ -229,8 +332,47 @@ func addStoreCopy() *cobra.Command {
 
 	cmd := &cobra.Command{
 		Use:   "copy",
-		Short: "Copy all store contents to another OCI registry",
-		Args:  cobra.ExactArgs(1),
+		Short: "Copy all store contents to another OCI registry or an OCI layout, on disk or in object storage",
+		Example: `
+# copy the store to a registry
+hauler store copy registry://registry.example.com
+
+# copy the rancher images of the store to an oci layout at ./out
+hauler store copy dir://./out --include 'rancher/*'
+
+# copy each reference of the store to an oci layout of its own beneath ./out
+hauler store copy dir://./out --layout-per-ref
+
+# copy the store to an oci layout in object storage, on any s3 compatible endpoint given by AWS_ENDPOINT_URL
+hauler store copy s3://transfer/layouts/rancher
+
+# copy the store under airgap/, each repository flattened to its last component
+hauler store copy registry://registry.example.com --repo-prefix airgap/ --flatten
+
+# copy the store with the repositories of each source registry under a namespace of their own
+hauler store copy registry://registry.example.com --registry-namespace docker.io=dockerhub,ghcr.io=github
+
+# copy the store relocated by a rules file
+hauler store copy registry://registry.example.com --relocation-rules relocation.yaml
+
+# copy an image to a docker archive, for 'docker load -i' or 'ctr images import' on a host without a registry
+hauler store copy --format docker-archive rancher/rancher:v2.8.0 ./rancher.tar
+
+# copy the store, failing on any reference the registry holds under another digest than the store
+hauler store copy registry://registry.example.com --require-digest-match
+
+# copy the store to two registries at once, reporting each on its own
+hauler store copy registry://harbor.enclave-a.example.com registry://harbor.enclave-b.example.com
+
+# copy the store to the registries of a destinations file, each with credentials of its own
+hauler store copy --destinations destinations.yaml
+
+# import the images of the store into the containerd of a single k3s or rke2 node, without a registry
+hauler store copy containerd://k8s.io
+
+# copy every rancher image of the store for arm64 to a single docker archive
+hauler store copy --format docker-archive --platform linux/arm64 --include 'rancher/*' ./images.tar`,
+		Args: cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
@@ -239,6 +381,21 @@ func addStoreCopy() *cobra.Command {
 				return err
 			}
 
+			if o.Format == store.DockerArchiveFormat {
+				if len(args) == 0 {
+					return fmt.Errorf("--format %s requires the path of the archive", store.DockerArchiveFormat)
+				}
+				return store.CopyDockerArchiveCmd(ctx, o, s, args[len(args)-1], args[:len(args)-1]...)
+			}
+			if o.Format != "" {
+				return fmt.Errorf("format must be %s", store.DockerArchiveFormat)
+			}
+			if len(args) > 1 || o.DestinationsFile != "" {
+				return store.CopyToDestinationsCmd(ctx, o, s, args...)
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("requires a target, or --destinations")
+			}
 			return store.CopyCmd(ctx, o, s, args[0])
 		},
 	}
@@ -247,6 +404,288 @@ func addStoreCopy() *cobra.Command {
 	return cmd
 }
 
+func addStoreRemove() *cobra.Command {
+	o := &store.RemoveOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:   "remove",
+		Short: "Remove references from the store, deleting any content no longer referenced",
+		Example: `
+# remove an image, along with its signatures and attestations
+hauler store remove rancher/rancher:v2.8.0
+
+# remove several references at once
+hauler store remove hauler/my-file.txt:latest hauler/my-chart:1.0.0
+`,
+		Aliases: []string{"rm"},
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			s, unlock, err := o.LockedStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			return store.RemoveCmd(ctx, o, s, args...)
+		},
+	}
+
+	return cmd
+}
+
+func addStoreList() *cobra.Command {
+	o := &store.ListOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List the references in the store with their type, platforms, digest, and size",
+		Aliases: []string{"ls"},
+		Args:    cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			s, err := o.Store(ctx)
+			if err != nil {
+				return err
+			}
+
+			return store.ListCmd(ctx, o, s)
+		},
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
+
+func addStoreListStores() *cobra.Command {
+	o := &store.ListStoresOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:   "list-stores",
+		Short: "List the named stores of the configuration file, marking the one --store-name selects",
+		Example: `
+# Define the stores in ~/.hauler/config.yaml
+#   store-name: prod
+#   stores:
+#     prod:
+#       path: /srv/hauler/prod
+#     dev:
+#       path: ~/hauls/dev
+hauler store list-stores
+
+# Sync into the dev store rather than the default prod one
+hauler store sync --store-name dev -f manifest.yaml`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return store.ListStoresCmd(cmd.Context(), o)
+		},
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
+
+func addStoreHistory() *cobra.Command {
+	o := &store.HistoryOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the audit log of every artifact added, removed, or loaded, and every flush, with who made the change and when",
+		Example: `
+# Show every mutation of the store
+hauler store history
+
+# Show what was loaded into the store over the last week
+hauler store history --action load --since 168h
+
+# Show the history of the rancher images as json
+hauler store history --reference 'rancher/*' -o json`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			s, err := o.Store(ctx)
+			if err != nil {
+				return err
+			}
+
+			return store.HistoryCmd(ctx, o, s)
+		},
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
+
+func addStoreVerify() *cobra.Command {
+	o := &store.VerifyOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check every blob in the store is present and matches its digest",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			s, err := o.Store(ctx)
+			if err != nil {
+				return err
+			}
+
+			return store.VerifyCmd(ctx, o, s)
+		},
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
+
+func addStoreRepair() *cobra.Command {
+	o := &store.RepairOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Drop references to blobs missing from the store, such as those left by an interrupted add",
+		Example: `
+# List the dangling references without dropping them
+hauler store repair --dry-run
+
+# Drop the dangling references, then delete the blobs they left behind
+hauler store repair && hauler store gc`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			s, unlock, err := o.LockedStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			return store.RepairCmd(ctx, o, s)
+		},
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
+
+func addStoreDiff() *cobra.Command {
+	o := &store.DiffOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:   "diff <other-store-or-archive>",
+		Short: "Compare the store with another store or store archive, listing the references added, removed, or changed since",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			s, err := o.Store(ctx)
+			if err != nil {
+				return err
+			}
+
+			return store.DiffCmd(ctx, o, s, args[0])
+		},
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
+
+func addStoreSbom() *cobra.Command {
+	o := &store.SbomOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:   "sbom [reference...]",
+		Short: "Generate sboms of the packages installed in the images of the store",
+		Example: `
+# write an spdx sbom of each image in the store, and one of every image, to ./sboms
+hauler store sbom
+
+# write cyclonedx sboms of specific images
+hauler store sbom --format cyclonedx-json rancher/rancher:v2.8.0 rancher/fleet:v0.9.0
+
+# write the sboms to another directory, naming the aggregate sbom after the haul
+hauler store sbom --dir /tmp/sboms --name my-haul
+
+# write only the sboms of each image
+hauler store sbom --aggregate=false
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			s, err := o.Store(ctx)
+			if err != nil {
+				return err
+			}
+
+			return store.SbomCmd(ctx, o, s, args...)
+		},
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
+
+func addStoreScan() *cobra.Command {
+	o := &store.ScanOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:   "scan [reference...]",
+		Short: "Report the known vulnerabilities of the packages installed in the images of the store",
+		Example: `
+# scan every image in the store with trivy
+hauler store scan
+
+# scan specific images with grype, reporting as json
+hauler store scan --scanner grype --output json rancher/rancher:v2.8.0
+
+# fail, such as in the pipeline building a haul, when any image has a high or critical vulnerability
+hauler store scan --severity high
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			s, err := o.Store(ctx)
+			if err != nil {
+				return err
+			}
+
+			return store.ScanCmd(ctx, o, s, args...)
+		},
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
+
+func addStoreGC() *cobra.Command {
+	o := &store.GCOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Delete blobs no longer referenced by anything in the store",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			s, unlock, err := o.LockedStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			return store.GCCmd(ctx, o, s)
+		},
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
+
 func addStoreAdd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "add",
@@ -260,25 +699,109 @@ func addStoreAdd() *cobra.Command {
 		addStoreAddFile(),
 		addStoreAddImage(),
 		addStoreAddChart(),
+		addStoreAddManifests(),
+		addStoreAddGit(),
+		addStoreAddOCILayout(),
 	)
 
 	return cmd
 }
 
+func addStoreAddGit() *cobra.Command {
+	o := &store.AddGitOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:   "git",
+		Short: "Add the tree of a git repository to the content store",
+		Example: `
+# add the default branch of a repository, stored as hauler/fleet-examples:latest
+hauler store add git https://github.com/rancher/fleet-examples.git
+
+# add a repository at a tag, stored as hauler/fleet-examples:v0.9.0
+hauler store add git https://github.com/rancher/fleet-examples.git --ref v0.9.0
+
+# add a private repository over ssh at a commit, authenticated the way git is configured to
+hauler store add git git@github.com:example/gitops.git --ref 3f2c1a9 --name gitops`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			s, unlock, err := o.LockedStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			return store.AddGitCmd(ctx, o, s, args[0])
+		},
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
+
+func addStoreAddOCILayout() *cobra.Command {
+	o := &store.AddOCILayoutOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:   "oci-layout",
+		Short: "Add the content of an existing OCI image layout directory to the content store",
+		Example: `
+# add every artifact of a layout whose index annotates full references
+hauler store add oci-layout ./layout
+
+# add the artifact of a layout written by skopeo, crane, or oras, tagged v1.2.3, as ghcr.io/example/app:v1.2.3
+skopeo copy docker://ghcr.io/example/app:v1.2.3 oci:./layout:v1.2.3
+hauler store add oci-layout ./layout ghcr.io/example/app:v1.2.3`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			s, unlock, err := o.LockedStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			var reference string
+			if len(args) > 1 {
+				reference = args[1]
+			}
+			return store.AddOCILayoutCmd(ctx, o, s, args[0], reference)
+		},
+	}
+
+	return cmd
+}
+
 func addStoreAddFile() *cobra.Command {
 	o := &store.AddFileOpts{RootOpts: rootStoreOpts}
 
 	cmd := &cobra.Command{
 		Use:   "file",
 		Short: "Add a file to the content store",
+		Example: `
+# add a local file
+hauler store add file file.txt
+
+# add a directory, stored as a single tarball unpacked again by store extract
+hauler store add file ./config-bundle/
+
+# add a remote file, failing unless it matches a checksum
+hauler store add file https://get.k3s.io --name install.sh --checksum sha256:<hex>
+
+# add a remote file, failing unless it matches its entry in a checksums file
+hauler store add file https://github.com/k3s-io/k3s/releases/download/v1.28.5%2Bk3s1/k3s \
+  --checksum-url https://github.com/k3s-io/k3s/releases/download/v1.28.5%2Bk3s1/sha256sum-amd64.txt`,
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			s, err := o.Store(ctx)
+			s, unlock, err := o.LockedStore(ctx)
 			if err != nil {
 				return err
 			}
+			defer unlock()
 
 			return store.AddFileCmd(ctx, o, s, args[0])
 		},
@@ -294,16 +817,66 @@ func addStoreAddImage() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "image",
 		Short: "Add an image to the content store",
-		Args:  cobra.ExactArgs(1),
+		Example: `
+# add an image
+hauler store add image busybox
+
+# add an image along with the sboms and signatures attached to it through the OCI 1.1 referrers api
+hauler store add image ghcr.io/example/app:v1 --referrers
+
+# add an image once its signature verifies against a cosign public key
+hauler store add image ghcr.io/example/app:v1 --key cosign.pub
+
+# add an image once its signature verifies keylessly, as signed by a github actions workflow
+hauler store add image ghcr.io/example/app:v1 \
+  --certificate-identity-regexp "^https://github.com/example/app/" \
+  --certificate-oidc-issuer "https://token.actions.githubusercontent.com"
+
+# add an image only if it complies with a policy file, such as:
+#   allowedRegistries: [docker.io/rancher, ghcr.io/example, "*.example.com"]
+#   deniedTags: [latest]
+#   requiredKeys: [cosign.pub]
+hauler store add image ghcr.io/example/app:v1 --policy policy.yaml
+
+# add every image of a docker save tarball under its embedded tags, without a docker daemon
+hauler store add image --from docker-archive:./images.tar
+
+# add only one of the images of a docker save tarball
+hauler store add image example.com/app:v1 --from docker-archive:./images.tar
+
+# add an image built locally and never pushed, from the docker daemon
+hauler store add image example.com/app:dev --from daemon
+
+# add an image from the containerd of k3s
+CONTAINERD_ADDRESS=/run/k3s/containerd/containerd.sock hauler store add image example.com/app:dev --from containerd:k8s.io
+
+# add an image through the mirrors of the registries.yaml of a k3s node
+hauler store add image busybox --registries-config /etc/rancher/k3s/registries.yaml
+
+# add an image from docker hub, falling back to a mirror of it once rate limited
+hauler store add image busybox --registry-mirror mirror.gcr.io --max-retries 3
+
+# add every tag of a repository
+hauler store add image ghcr.io/example/app --all-tags
+
+# add every release of a repository from 1.24 on
+hauler store add image rancher/hyperkube --tag-constraint '>=1.24'
+`,
+		Args: cobra.RangeArgs(0, 1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			s, err := o.Store(ctx)
+			s, unlock, err := o.LockedStore(ctx)
 			if err != nil {
 				return err
 			}
+			defer unlock()
 
-			return store.AddImageCmd(ctx, o, s, args[0])
+			var ref string
+			if len(args) > 0 {
+				ref = args[0]
+			}
+			return store.AddImageCmd(ctx, o, s, ref)
 		},
 	}
 	o.AddFlags(cmd)
@@ -332,15 +905,25 @@ hauler store add chart longhorn --repo "https://charts.longhorn.io"
 
 # add a specific version of a chart
 hauler store add chart rancher --repo "https://releases.rancher.com/server-charts/latest" --version "2.6.2"
+
+# add the latest version of a chart satisfying a constraint
+hauler store add chart rancher --repo "https://releases.rancher.com/server-charts/latest" --version ">=2.7.0 <2.8.0"
+
+# add a chart from an OCI registry
+hauler store add chart oci://registry-1.docker.io/bitnamicharts/nginx --version "15.14.0"
+
+# add a chart along with every image it refers to once rendered with a values file
+hauler store add chart longhorn --repo "https://charts.longhorn.io" --add-images --values values.yaml
 `,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
-			s, err := o.Store(ctx)
+			s, unlock, err := o.LockedStore(ctx)
 			if err != nil {
 				return err
 			}
+			defer unlock()
 
 			return store.AddChartCmd(ctx, o, s, args[0])
 		},
@@ -349,3 +932,37 @@ hauler store add chart rancher --repo "https://releases.rancher.com/server-chart
 
 	return cmd
 }
+
+func addStoreAddManifests() *cobra.Command {
+	o := &store.AddManifestsOpts{RootOpts: rootStoreOpts}
+
+	cmd := &cobra.Command{
+		Use:   "manifests",
+		Short: "Add the images referenced by kubernetes manifests to the content store",
+		Example: `
+# add the images of every manifest in a directory, building any kustomizations in it
+hauler store add manifests ./deploy/
+
+# add the images of a single manifest
+hauler store add manifests deployment.yaml
+
+# also add the images embedded in custom resources
+hauler store add manifests ./deploy/ --image-path '{.spec.image}' --image-path '{.spec.sidecars[*].image}'
+`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			s, unlock, err := o.LockedStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			return store.AddManifestsCmd(ctx, o, s, args...)
+		},
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
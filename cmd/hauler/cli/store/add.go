@@ -2,51 +2,106 @@ package store
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/rancherfederal/hauler/pkg/artifacts/file/getter"
+	"github.com/rancherfederal/hauler/pkg/artifacts/git"
+	"github.com/rancherfederal/hauler/pkg/artifacts/image"
 	"github.com/spf13/cobra"
 	"helm.sh/helm/v3/pkg/action"
+	helmchart "helm.sh/helm/v3/pkg/chart"
 
 	"github.com/rancherfederal/hauler/pkg/artifacts/file"
 
 	"github.com/rancherfederal/hauler/pkg/store"
 
 	"github.com/rancherfederal/hauler/pkg/apis/hauler.cattle.io/v1alpha1"
+	tchart "github.com/rancherfederal/hauler/pkg/collection/chart"
+	"github.com/rancherfederal/hauler/pkg/collection/manifests"
+	"github.com/rancherfederal/hauler/pkg/consts"
 	"github.com/rancherfederal/hauler/pkg/content/chart"
 	"github.com/rancherfederal/hauler/pkg/cosign"
 	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/policy"
 	"github.com/rancherfederal/hauler/pkg/reference"
+	"github.com/rancherfederal/hauler/pkg/staging"
 )
 
 type AddFileOpts struct {
 	*RootOpts
-	Name string
+	Name        string
+	Checksum    string
+	ChecksumURL string
 }
 
 func (o *AddFileOpts) AddFlags(cmd *cobra.Command) {
 	f := cmd.Flags()
 	f.StringVarP(&o.Name, "name", "n", "", "(Optional) Name to assign to file in store")
+	f.StringVar(&o.Checksum, "checksum", "", "(Optional) sha256 or sha512 digest the file must match, i.e. sha256:<hex>")
+	f.StringVar(&o.ChecksumURL, "checksum-url", "", "(Optional) Checksums file in the format of sha256sum listing the digest the file must match")
 }
 
 func AddFileCmd(ctx context.Context, o *AddFileOpts, s *store.Layout, reference string) error {
 	cfg := v1alpha1.File{
-		Path: reference,
+		Path:        reference,
+		Checksum:    o.Checksum,
+		ChecksumURL: o.ChecksumURL,
 	}
 	if len(o.Name) > 0 {
 		cfg.Name = o.Name
 	}
+	if err := checkFileSpace(ctx, o.RootOpts, s, cfg); err != nil {
+		return err
+	}
 	return storeFile(ctx, s, cfg)
 }
 
+// checkFileSpace checks the store has the space for the file fi, where its getter can size it without fetching it
+func checkFileSpace(ctx context.Context, o *RootOpts, s *store.Layout, fi v1alpha1.File) error {
+	if o.SkipSpaceCheck {
+		return nil
+	}
+	size, err := getter.NewClient(getter.ClientOptions{NameOverride: fi.Name}).Size(ctx, fi.Path)
+	if err != nil {
+		log.FromContext(ctx).Debugf("unable to size 'file' [%s], adding without checking the disk space: %v", fi.Path, err)
+		return nil
+	}
+	if size < 0 {
+		return nil
+	}
+	return o.checkSpace(ctx, s.Root, size)
+}
+
 func storeFile(ctx context.Context, s *store.Layout, fi v1alpha1.File) error {
 	l := log.FromContext(ctx)
+	start := time.Now()
 
 	copts := getter.ClientOptions{
 		NameOverride: fi.Name,
 	}
 
-	f := file.NewFile(fi.Path, file.WithClient(getter.NewClient(copts)))
+	fopts := []file.Option{file.WithClient(getter.NewClient(copts))}
+	if fi.Checksum != "" && fi.ChecksumURL != "" {
+		return fmt.Errorf("'file' [%s] has both a checksum and a checksum url, only one may be given", fi.Path)
+	}
+	if fi.Checksum != "" {
+		d, err := file.ParseChecksum(fi.Checksum)
+		if err != nil {
+			return err
+		}
+		fopts = append(fopts, file.WithChecksum(d))
+	}
+	if fi.ChecksumURL != "" {
+		fopts = append(fopts, file.WithChecksumURL(fi.ChecksumURL))
+	}
+
+	f := file.NewFile(fi.Path, fopts...)
 	ref, err := reference.NewTagged(f.Name(fi.Path), reference.DefaultTag)
 	if err != nil {
 		return err
@@ -58,58 +113,413 @@ func storeFile(ctx context.Context, s *store.Layout, fi v1alpha1.File) error {
 		return err
 	}
 
-	l.Infof("successfully added 'file' [%s]", ref.Name())
+	l.With(artifactFields(ctx, s, ref.Name(), start)).Infof("successfully added 'file' [%s]", ref.Name())
+
+	return nil
+}
+
+type AddGitOpts struct {
+	*RootOpts
+	Ref  string
+	Name string
+}
+
+func (o *AddGitOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringVar(&o.Ref, "ref", "", "(Optional) Branch, tag, or commit to add, defaults to the default branch of the repository")
+	f.StringVarP(&o.Name, "name", "n", "", "(Optional) Name to assign to the repository in store, defaults to the last element of its url")
+}
 
+func AddGitCmd(ctx context.Context, o *AddGitOpts, s *store.Layout, url string) error {
+	cfg := v1alpha1.GitRepository{
+		URL:  url,
+		Ref:  o.Ref,
+		Name: o.Name,
+	}
+	return storeGit(ctx, s, cfg)
+}
+
+// storeGit adds the tree of the git repository described by cfg at its ref to the store
+func storeGit(ctx context.Context, s *store.Layout, cfg v1alpha1.GitRepository) error {
+	l := log.FromContext(ctx)
+	start := time.Now()
+
+	r := git.NewRepository(cfg.URL, cfg.Ref, git.WithName(cfg.Name))
+	defer func() {
+		if err := r.Close(); err != nil {
+			l.Warnf("unable to clean up the clone of [%s]: %v", cfg.URL, err)
+		}
+	}()
+
+	ref, err := reference.NewTagged(r.Name(), r.Tag())
+	if err != nil {
+		return err
+	}
+
+	l.Infof("adding 'git' [%s] to the store as [%s]", cfg.URL, ref.Name())
+	if _, err := s.AddOCI(ctx, r, ref.Name()); err != nil {
+		return err
+	}
+
+	commit, err := r.Commit()
+	if err != nil {
+		return err
+	}
+	l.With(artifactFields(ctx, s, ref.Name(), start)).Infof("successfully added 'git' [%s] at commit [%s]", ref.Name(), commit)
+	return nil
+}
+
+type AddOCILayoutOpts struct {
+	*RootOpts
+}
+
+// AddOCILayoutCmd copies the artifacts of the OCI image layout at path into the store, keeping their digests and
+// annotations, only the one tagged reference when set
+func AddOCILayoutCmd(ctx context.Context, o *AddOCILayoutOpts, s *store.Layout, path string, reference string) error {
+	l := log.FromContext(ctx)
+
+	l.Infof("adding the content of oci layout [%s] to the store", path)
+	start := time.Now()
+	added, err := s.AddLayout(ctx, path, reference)
+	if err != nil {
+		return err
+	}
+	for _, desc := range added {
+		name := desc.Annotations[ocispec.AnnotationRefName]
+		l.With(artifactFields(ctx, s, name, start)).Infof("successfully added [%s] from oci layout [%s]", name, path)
+	}
 	return nil
 }
 
 type AddImageOpts struct {
 	*RootOpts
-	Name     string
-	Key      string
-	Platform string
+	Name         string
+	Key          string
+	Keyless      KeylessOpts
+	Platform     string
+	AllPlatforms bool
+	Referrers    bool
+	Policy       string
+	From         string
+
+	AllTags       bool
+	TagConstraint string
 }
 
 func (o *AddImageOpts) AddFlags(cmd *cobra.Command) {
 	f := cmd.Flags()
 	f.StringVarP(&o.Key, "key", "k", "", "(Optional) Path to the key for digital signature verification")
-	f.StringVarP(&o.Platform, "platform", "p", "", "(Optional) Specific platform to save. i.e. linux/amd64. Defaults to all if flag is omitted.")
+	o.Keyless.AddFlags(cmd)
+	cmd.MarkFlagsMutuallyExclusive("key", "certificate-identity")
+	cmd.MarkFlagsMutuallyExclusive("key", "certificate-identity-regexp")
+	f.StringVarP(&o.Platform, "platform", "p", "", "(Optional) Platforms to save, comma separated. i.e. linux/amd64,linux/arm64. Defaults to all if flag is omitted.")
+	f.BoolVar(&o.AllPlatforms, "all-platforms", false, "(Optional) Save every platform of a multi-arch image along with its full index, so it can be pushed back intact")
+	cmd.MarkFlagsMutuallyExclusive("platform", "all-platforms")
+	f.BoolVar(&o.Referrers, "referrers", false, "(Optional) Also add the OCI 1.1 referrers of the image, such as sboms and signatures attached through the referrers api. Cosign signatures, attestations, and sboms are always added")
+	f.StringVar(&o.Policy, "policy", "", "(Optional) Path to a policy file of the registries, tags, and signing keys images have to comply with to be added")
+	f.StringVar(&o.From, "from", "", "(Optional) Source to add the image from instead of its registry: docker-archive:<path> for a docker save tarball, daemon for the local docker daemon, or containerd[:<namespace>] for a containerd namespace, 'default' unless set")
+	cmd.MarkFlagsMutuallyExclusive("from", "referrers")
+	f.BoolVar(&o.AllTags, "all-tags", false, "(Optional) Add every tag of the repository, listed from its registry, rather than a single image")
+	f.StringVar(&o.TagConstraint, "tag-constraint", "", "(Optional) Only add the tags of the repository satisfying this semver constraint, implies --all-tags. i.e. '>=1.24' or '~1.28.0'")
+	cmd.MarkFlagsMutuallyExclusive("from", "all-tags")
+	cmd.MarkFlagsMutuallyExclusive("from", "tag-constraint")
+	o.AddRemoteFlags(cmd)
 }
 
+// Sources of --from images other than registries
+const (
+	dockerArchiveSource = "docker-archive"
+	daemonSource        = "daemon"
+	containerdSource    = "containerd"
+)
+
 func AddImageCmd(ctx context.Context, o *AddImageOpts, s *store.Layout, reference string) error {
-	l := log.FromContext(ctx)
 	cfg := v1alpha1.Image{
 		Name: reference,
 	}
 
-	// Check if the user provided a key.
-	if o.Key != "" {
-		// verify signature using the provided key.
-		err := cosign.VerifySignature(ctx, s, o.Key, cfg.Name)
+	p, err := loadPolicy(o.Policy)
+	if err != nil {
+		return err
+	}
+	if o.From != "" {
+		return addImageFrom(ctx, o, s, p, reference)
+	}
+	if reference == "" {
+		return fmt.Errorf("an image reference is required unless adding from --from")
+	}
+	if o.AllTags || o.TagConstraint != "" {
+		return addImageTags(ctx, o, s, reference)
+	}
+	// Check the image against the policy, and if the user provided a key or keyless options, verify it.
+	verified, err := admitImage(ctx, s, p, cfg.Name, o.Keyless.Options(o.Key))
+	if err != nil {
+		return err
+	}
+
+	platform := o.Platform
+	if o.AllPlatforms {
+		platform = ""
+	}
+	if err := checkImageSpace(ctx, o.RootOpts, s, cfg.Name, platform); err != nil {
+		return err
+	}
+	if err := storeImage(ctx, s, cfg, platform, verified); err != nil {
+		return err
+	}
+	if o.Referrers {
+		return storeReferrers(ctx, s, cfg.Name)
+	}
+	return nil
+}
+
+// checkImageSpace checks the store has the space for the blobs of the image name it's missing, narrowed down to
+// platform when set
+func checkImageSpace(ctx context.Context, o *RootOpts, s *store.Layout, name string, platform string) error {
+	if o.SkipSpaceCheck {
+		return nil
+	}
+	ps, err := store.ParsePlatforms(platform)
+	if err != nil {
+		return err
+	}
+	blobs, err := image.Blobs(name, ps, s.RemoteOptions()...)
+	if err != nil {
+		// left to the pull to report
+		log.FromContext(ctx).Debugf("unable to size [%s], adding without checking the disk space: %v", name, err)
+		return nil
+	}
+	missing, err := s.Missing(blobs)
+	if err != nil {
+		return err
+	}
+	return o.checkSpace(ctx, s.Root, blobsSize(missing))
+}
+
+// addImageTags adds every tag of the repository satisfying the tag constraint, each as a single image is added
+func addImageTags(ctx context.Context, o *AddImageOpts, s *store.Layout, repository string) error {
+	l := log.FromContext(ctx)
+
+	repo, err := name.NewRepository(repository)
+	if err != nil {
+		return fmt.Errorf("--all-tags and --tag-constraint take a repository without a tag or digest: %w", err)
+	}
+	tags, err := remote.List(repo, append(s.RemoteOptions(), remote.WithContext(ctx))...)
+	if err != nil {
+		return fmt.Errorf("listing the tags of [%s]: %w", repo.Name(), err)
+	}
+	tags, err = reference.FilterTags(tags, o.TagConstraint)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return fmt.Errorf("no tags of [%s] satisfy [%s]", repo.Name(), o.TagConstraint)
+	}
+	l.Infof("adding [%d] tags of [%s]", len(tags), repo.Name())
+
+	one := *o
+	one.AllTags, one.TagConstraint = false, ""
+	for _, tag := range tags {
+		if err := AddImageCmd(ctx, &one, s, repo.Tag(tag).Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addImageFrom adds the images of the source o.From rather than pulling them, only the one named reference when set
+//
+//	Images from other sources can't have their signatures verified, so policies requiring signatures reject them.
+func addImageFrom(ctx context.Context, o *AddImageOpts, s *store.Layout, p *policy.Policy, reference string) error {
+	l := log.FromContext(ctx)
+
+	if o.Keyless.Options(o.Key).Enabled() || p.RequiresSignature() {
+		return fmt.Errorf("signatures can't be verified for images added from [%s]", o.From)
+	}
+
+	source, path, _ := strings.Cut(o.From, ":")
+	if source == daemonSource || source == containerdSource {
+		if reference == "" {
+			return fmt.Errorf("an image reference is required to add from [%s]", source)
+		}
+		// daemons save the image as a docker archive, added the way one given on the command line is
+		dir, cleanup, err := staging.Dir(ctx, "", "daemon")
 		if err != nil {
 			return err
 		}
-		l.Infof("signature verified for image [%s]", cfg.Name)
+		defer cleanup()
+
+		namespace := path
+		path = filepath.Join(dir, "image.tar")
+		l.Infof("saving [%s] from [%s]", reference, o.From)
+		if source == daemonSource {
+			err = image.SaveFromDocker(ctx, reference, path)
+		} else {
+			err = image.SaveFromContainerd(ctx, namespace, reference, path)
+		}
+		if err != nil {
+			return err
+		}
+		source = dockerArchiveSource
+	}
+
+	var imgs []*image.Image
+	switch {
+	case source == dockerArchiveSource && path != "":
+		var err error
+		if imgs, err = image.FromDockerArchive(path, reference); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported image source [%s], expected %s:<path>, %s, or %s[:<namespace>]", o.From, dockerArchiveSource, daemonSource, containerdSource)
+	}
+
+	for _, img := range imgs {
+		if err := p.Check(img.Name); err != nil {
+			return err
+		}
+	}
+	for _, img := range imgs {
+		l.Infof("adding 'image' [%s] from [%s] to the store", img.Name, o.From)
+		start := time.Now()
+		if _, err := s.AddOCI(ctx, img, img.Name); err != nil {
+			return err
+		}
+		l.With(artifactFields(ctx, s, img.Name, start)).Infof("successfully added 'image' [%s]", img.Name)
 	}
+	return nil
+}
 
-	return storeImage(ctx, s, cfg, o.Platform)
+// storeReferrers adds the OCI 1.1 referrers of the image ref, which must already be in the store
+func storeReferrers(ctx context.Context, s *store.Layout, ref string) error {
+	l := log.FromContext(ctx)
+
+	added, err := s.AddReferrers(ctx, ref)
+	if err != nil {
+		return err
+	}
+	l.Infof("added [%d] referrers of 'image' [%s]", len(added), ref)
+	return nil
 }
 
-func storeImage(ctx context.Context, s *store.Layout, i v1alpha1.Image, platform string) error {
+// admitImage checks the image ref against the policy p and verifies its signature with vo before it's admitted into the
+// store, returning the annotations that record the verification on its descriptor once stored
+//
+//	When the policy requires keys and vo isn't one of them, the image is verified with each of the required keys in turn,
+//	and rejected when none of them verifies it.
+func admitImage(ctx context.Context, s *store.Layout, p *policy.Policy, ref string, vo cosign.VerifyOptions) (map[string]string, error) {
+	l := log.FromContext(ctx)
+
+	if err := p.Check(ref); err != nil {
+		return nil, err
+	}
+
+	var verified map[string]string
+	if vo.Enabled() {
+		var err error
+		verified, err = verifyImage(ctx, s, ref, vo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !p.RequiresSignature() || p.Trusts(verified[consts.SignatureAnnotationVerifier]) {
+		return verified, nil
+	}
+
+	for _, key := range p.RequiredKeys {
+		v, err := verifyImage(ctx, s, ref, cosign.VerifyOptions{Key: key})
+		if err == nil {
+			return v, nil
+		}
+		l.Debugf("image [%s] is not signed by required key [%s]: %v", ref, key, err)
+	}
+	return nil, fmt.Errorf("image [%s] is not signed by any of the keys required: %w", ref, policy.ErrViolation)
+}
+
+// verifyImage verifies the signature of the image ref before it's admitted into the store, returning the annotations
+// that record the verification on its descriptor once stored
+func verifyImage(ctx context.Context, s *store.Layout, ref string, o cosign.VerifyOptions) (map[string]string, error) {
+	l := log.FromContext(ctx)
+
+	d, err := cosign.Verify(ctx, s, ref, o)
+	if err != nil {
+		return nil, fmt.Errorf("signature verification failed for image [%s]: %w", ref, err)
+	}
+	l.Infof("signature verified for image [%s]", ref)
+
+	return map[string]string{
+		consts.SignatureAnnotationVerifier:       o.Verifier(),
+		consts.SignatureAnnotationVerifiedDigest: d.String(),
+		consts.SignatureAnnotationVerifiedAt:     time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// storeImage saves the image i to the store, annotating it with verified when its signature was verified
+//
+//	The tag of a verified image may have moved between verifying and saving it.  Unless it was filtered down to some
+//	of its platforms, which changes its digest, an image whose stored digest isn't the verified one is removed again.
+func storeImage(ctx context.Context, s *store.Layout, i v1alpha1.Image, platform string, verified map[string]string) error {
 	l := log.FromContext(ctx)
 	l.Infof("adding 'image' [%s] to the store", i.Name)
+	start := time.Now()
 
 	r, err := name.ParseReference(i.Name)
 	if err != nil {
 		return err
 	}
-	
-	err = cosign.SaveImage(ctx, s, r.Name(), platform)
+
+	// pull through the mirrors in order, storing what a mirror serves under the image's name
+	refs, err := s.TransportOptions().Endpoints(r.Name())
+	if err != nil {
+		return err
+	}
+	for n, ref := range refs {
+		if err = cosign.SaveImage(ctx, s, ref, platform); err == nil {
+			if ref != r.Name() {
+				if _, err := s.Rename(ctx, ref, r.Name()); err != nil {
+					return err
+				}
+				l.Infof("pulled 'image' [%s] through mirror [%s]", r.Name(), ref)
+			}
+			break
+		}
+		if n < len(refs)-1 {
+			l.Warnf("unable to pull 'image' [%s] from [%s], trying [%s]: %v", r.Name(), ref, refs[n+1], err)
+		}
+	}
 	if err != nil {
 		return err
 	}
 
-	l.Infof("successfully added 'image' [%s]", r.Name())
+	if verified != nil {
+		if err := recordVerified(ctx, s, r.Name(), verified, platform == ""); err != nil {
+			return err
+		}
+	}
+
+	l.With(artifactFields(ctx, s, r.Name(), start)).Infof("successfully added 'image' [%s]", r.Name())
+	return nil
+}
+
+// recordVerified annotates the stored image ref with verified, the record of its signature verification
+//
+//	When exact is set, the stored image has to be the one whose signature was verified, and is removed again otherwise.
+func recordVerified(ctx context.Context, s *store.Layout, ref string, verified map[string]string, exact bool) error {
+	l := log.FromContext(ctx)
+
+	desc, err := s.Stat(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if exact && desc.Digest.String() != verified[consts.SignatureAnnotationVerifiedDigest] {
+		if _, err := s.RemoveArtifact(ctx, ref); err != nil {
+			l.Errorf("unable to remove unverified image [%s] from the store: %v", ref, err)
+		}
+		return fmt.Errorf("image [%s] changed to [%s] after its signature was verified for [%s]", ref, desc.Digest, verified[consts.SignatureAnnotationVerifiedDigest])
+	}
+	if _, err := s.Annotate(ctx, ref, verified); err != nil {
+		return fmt.Errorf("recording the signature verification of image [%s]: %w", ref, err)
+	}
 	return nil
 }
 
@@ -117,12 +527,16 @@ type AddChartOpts struct {
 	*RootOpts
 
 	ChartOpts *action.ChartPathOptions
+
+	AddImages bool
+	Values    []string
+	Platform  string
 }
 
 func (o *AddChartOpts) AddFlags(cmd *cobra.Command) {
 	f := cmd.Flags()
 
-	f.StringVar(&o.ChartOpts.RepoURL, "repo", "", "chart repository url where to locate the requested chart")
+	f.StringVar(&o.ChartOpts.RepoURL, "repo", "", "chart repository url where to locate the requested chart, an oci:// url for charts in an OCI registry")
 	f.StringVar(&o.ChartOpts.Version, "version", "", "specify a version constraint for the chart version to use. This constraint can be a specific tag (e.g. 1.1.1) or it may reference a valid range (e.g. ^2.0.0). If this is not specified, the latest version is used")
 	f.BoolVar(&o.ChartOpts.Verify, "verify", false, "verify the package before using it")
 	f.StringVar(&o.ChartOpts.Username, "username", "", "chart repository username where to locate the requested chart")
@@ -131,6 +545,10 @@ func (o *AddChartOpts) AddFlags(cmd *cobra.Command) {
 	f.StringVar(&o.ChartOpts.KeyFile, "key-file", "", "identify HTTPS client using this SSL key file")
 	f.BoolVar(&o.ChartOpts.InsecureSkipTLSverify, "insecure-skip-tls-verify", false, "skip tls certificate checks for the chart download")
 	f.StringVar(&o.ChartOpts.CaFile, "ca-file", "", "verify certificates of HTTPS-enabled servers using this CA bundle")
+	f.BoolVar(&o.ChartOpts.PlainHTTP, "plain-http", false, "use insecure HTTP connections for the chart download")
+	f.BoolVar(&o.AddImages, "add-images", false, "(Optional) Render the chart and add every image it refers to alongside it")
+	f.StringSliceVarP(&o.Values, "values", "f", []string{}, "(Optional) Values files to render the chart with when adding its images, later files taking precedence")
+	f.StringVarP(&o.Platform, "platform", "p", "", "(Optional) Platforms of the chart's images to save with --add-images, comma separated. i.e. linux/amd64,linux/arm64. Defaults to all if flag is omitted.")
 }
 
 func AddChartCmd(ctx context.Context, o *AddChartOpts, s *store.Layout, chartName string) error {
@@ -141,12 +559,47 @@ func AddChartCmd(ctx context.Context, o *AddChartOpts, s *store.Layout, chartNam
 		Version: o.ChartOpts.Version,
 	}
 
-	return storeChart(ctx, s, cfg, o.ChartOpts)
+	if !o.AddImages && (len(o.Values) > 0 || o.Platform != "") {
+		return fmt.Errorf("--values and --platform require --add-images")
+	}
+
+	c, err := storeChart(ctx, s, cfg, o.ChartOpts)
+	if err != nil {
+		return err
+	}
+	if !o.AddImages {
+		return nil
+	}
+	return storeChartImages(ctx, s, c, o.Values, o.Platform)
+}
+
+// storeChartImages renders the chart c with the values files and adds every image it refers to
+func storeChartImages(ctx context.Context, s *store.Layout, c *helmchart.Chart, valuesFiles []string, platform string) error {
+	l := log.FromContext(ctx)
+
+	vals, err := tchart.LoadValues(valuesFiles...)
+	if err != nil {
+		return err
+	}
+	imgs, err := tchart.ImagesInChart(c, vals)
+	if err != nil {
+		return fmt.Errorf("rendering 'chart' [%s] to find its images: %w", c.Name(), err)
+	}
+	l.Infof("found [%d] images in 'chart' [%s]", len(imgs.Spec.Images), c.Name())
+
+	for _, i := range imgs.Spec.Images {
+		if err := storeImage(ctx, s, i, platform, nil); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func storeChart(ctx context.Context, s *store.Layout, cfg v1alpha1.Chart, opts *action.ChartPathOptions) error {
+// storeChart adds the chart described by cfg to the store, returning it loaded
+func storeChart(ctx context.Context, s *store.Layout, cfg v1alpha1.Chart, opts *action.ChartPathOptions) (*helmchart.Chart, error) {
 	l := log.FromContext(ctx)
 	l.Infof("adding 'chart' [%s] to the store", cfg.Name)
+	start := time.Now()
 	
 	// TODO: This shouldn't be necessary
 	opts.RepoURL = cfg.RepoURL
@@ -154,23 +607,70 @@ func storeChart(ctx context.Context, s *store.Layout, cfg v1alpha1.Chart, opts *
 
 	chrt, err := chart.NewChart(cfg.Name, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	c, err := chrt.Load()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ref, err := reference.NewTagged(c.Name(), c.Metadata.Version)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	_, err = s.AddOCI(ctx, chrt, ref.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	l.With(artifactFields(ctx, s, ref.Name(), start)).Infof("successfully added 'chart' [%s]", ref.Name())
+	return c, nil
+}
+
+type AddManifestsOpts struct {
+	*RootOpts
+
+	ImagePaths []string
+	Platform   string
+	Policy     string
+}
+
+func (o *AddManifestsOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringSliceVar(&o.ImagePaths, "image-path", []string{}, "(Optional) JSONPath to find images at in addition to those of pods and workloads, such as images embedded in custom resources. i.e. '{.spec.image}'")
+	f.StringVarP(&o.Platform, "platform", "p", "", "(Optional) Platforms of the images to save, comma separated. i.e. linux/amd64,linux/arm64. Defaults to all if flag is omitted.")
+	f.StringVar(&o.Policy, "policy", "", "(Optional) Path to a policy file of the registries, tags, and signing keys images have to comply with to be added")
+}
+
+// AddManifestsCmd adds every image the kubernetes manifests at paths refer to
+//
+//	Each path is a manifest file or a directory of them, directories holding a kustomization are built with kustomize
+//	first.  Images are found in the containers and init containers of pods and workloads, and at any --image-path.
+func AddManifestsCmd(ctx context.Context, o *AddManifestsOpts, s *store.Layout, paths ...string) error {
+	l := log.FromContext(ctx)
+
+	p, err := loadPolicy(o.Policy)
 	if err != nil {
 		return err
 	}
 
-	l.Infof("successfully added 'chart' [%s]", ref.Name())
+	for _, path := range paths {
+		imgs, err := manifests.Images(path, o.ImagePaths...)
+		if err != nil {
+			return fmt.Errorf("finding images in [%s]: %w", path, err)
+		}
+		l.Infof("found [%d] images in [%s]", len(imgs), path)
+
+		for _, img := range imgs {
+			verified, err := admitImage(ctx, s, p, img, cosign.VerifyOptions{})
+			if err != nil {
+				return err
+			}
+			if err := storeImage(ctx, s, v1alpha1.Image{Name: img}, o.Platform, verified); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+
+	"github.com/rancherfederal/hauler/pkg/layer"
+	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+// CacheOpts names the layer cache the cache commands act on, the directory given to the store commands with --cache
+type CacheOpts struct {
+	CacheDir string
+}
+
+func (o *CacheOpts) AddArgs(cmd *cobra.Command) {
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&o.CacheDir, "cache", "", "Directory of the layer cache, the one given to the store commands with --cache")
+	cmd.MarkPersistentFlagRequired("cache")
+}
+
+// dir returns the directory of the cache
+func (o *CacheOpts) dir() (string, error) {
+	if strings.HasPrefix(o.CacheDir, "registry://") {
+		return "", fmt.Errorf("[%s] is a registry cache, its layers are kept and removed by the registry", o.CacheDir)
+	}
+	return homedir.Expand(o.CacheDir)
+}
+
+// CacheInfoCmd reports how many layers the cache holds, their size, and when they were last used
+func CacheInfoCmd(ctx context.Context, o *CacheOpts) error {
+	dir, err := o.dir()
+	if err != nil {
+		return err
+	}
+	entries, err := layer.Entries(dir)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	fmt.Printf("Cache:  %s\n", dir)
+	fmt.Printf("Layers: %d\n", len(entries))
+	fmt.Printf("Size:   %s\n", byteCountSI(total))
+	if len(entries) > 0 {
+		fmt.Printf("Least recently used: %s\n", entries[0].LastUsed.Format(time.RFC3339))
+		fmt.Printf("Most recently used:  %s\n", entries[len(entries)-1].LastUsed.Format(time.RFC3339))
+	}
+	return nil
+}
+
+type CachePruneOpts struct {
+	*CacheOpts
+
+	All       bool
+	OlderThan time.Duration
+	MaxSize   string
+	DryRun    bool
+}
+
+func (o *CachePruneOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.BoolVar(&o.All, "all", false, "Remove every layer of the cache")
+	f.DurationVar(&o.OlderThan, "older-than", 0, "Remove the layers not used within this duration, i.e. 720h")
+	f.StringVar(&o.MaxSize, "max-size", "", "Remove the least recently used layers until the cache is at most this size, i.e. 20GB")
+	f.BoolVar(&o.DryRun, "dry-run", false, "Report the layers that would be removed and the space reclaimed without removing anything")
+}
+
+// CachePruneCmd removes the layers of the cache selected by the flags, least recently used first
+func CachePruneCmd(ctx context.Context, o *CachePruneOpts) error {
+	l := log.FromContext(ctx)
+
+	if !o.All && o.OlderThan == 0 && o.MaxSize == "" {
+		return fmt.Errorf("nothing to prune, give --all, --older-than, or --max-size")
+	}
+	popts := layer.PruneOptions{All: o.All, OlderThan: o.OlderThan, DryRun: o.DryRun}
+	if o.MaxSize != "" {
+		max, err := store.ParseSize(o.MaxSize)
+		if err != nil {
+			return fmt.Errorf("--max-size: %w", err)
+		}
+		popts.MaxSize = max
+	}
+
+	dir, err := o.dir()
+	if err != nil {
+		return err
+	}
+	pruned, err := layer.Prune(dir, popts)
+
+	var reclaimed int64
+	for _, e := range pruned {
+		reclaimed += e.Size
+		if o.DryRun {
+			l.Infof("would remove [%s], last used %s", e.Digest, e.LastUsed.Format(time.RFC3339))
+		} else {
+			l.Debugf("removed [%s], last used %s", e.Digest, e.LastUsed.Format(time.RFC3339))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if o.DryRun {
+		l.Infof("%d layers, %s reclaimable", len(pruned), byteCountSI(reclaimed))
+		return nil
+	}
+	l.Infof("removed %d layers, reclaimed %s", len(pruned), byteCountSI(reclaimed))
+	return nil
+}
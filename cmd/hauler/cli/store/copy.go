@@ -2,13 +2,29 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/containerd/containerd/platforms"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/spf13/cobra"
-	"oras.land/oras-go/pkg/content"
 
-	"github.com/rancherfederal/hauler/pkg/cosign"
+	"github.com/rancherfederal/hauler/pkg/artifacts/image"
+	"github.com/rancherfederal/hauler/pkg/consts"
+	hcontent "github.com/rancherfederal/hauler/pkg/content"
+	"github.com/rancherfederal/hauler/pkg/content/s3"
+	"github.com/rancherfederal/hauler/pkg/reference"
 	"github.com/rancherfederal/hauler/pkg/store"
 
 	"github.com/rancherfederal/hauler/pkg/log"
@@ -21,53 +37,248 @@ type CopyOpts struct {
 	Password  string
 	Insecure  bool
 	PlainHTTP bool
+	Verbose   bool
+
+	AllowDigests  []string
+	DenyDigests   []string
+	StrictDigests bool
+
+	Include []string
+	Exclude []string
+
+	Concurrency   int
+	Retries       int
+	RetryDelay    time.Duration
+	RetryMaxDelay time.Duration
+
+	ErrorReport string
+
+	RelocationRules   string
+	RepoPrefix        string
+	Flatten           bool
+	Rewrites          []string
+	RegistryNamespace map[string]string
+
+	LayoutPerRef bool
+
+	Format   string
+	Platform string
+
+	ContainerdAddress string
+
+	DestinationsFile string
+
+	RequireDigestMatch bool
 }
 
+// DockerArchiveFormat is the --format copying images to a docker archive, the format of docker save
+const DockerArchiveFormat = "docker-archive"
+
 func (o *CopyOpts) AddFlags(cmd *cobra.Command) {
 	f := cmd.Flags()
 
-	f.StringVarP(&o.Username, "username", "u", "", "Username when copying to an authenticated remote registry")
+	f.StringVarP(&o.Username, "username", "u", "", "Username when copying to an authenticated remote registry. Defaults to the credentials of REGISTRY_AUTH_FILE, the docker config, and its credential helpers")
 	f.StringVarP(&o.Password, "password", "p", "", "Password when copying to an authenticated remote registry")
 	f.BoolVar(&o.Insecure, "insecure", false, "Toggle allowing insecure connections when copying to a remote registry")
 	f.BoolVar(&o.PlainHTTP, "plain-http", false, "Toggle allowing plain http connections when copying to a remote registry")
+	o.AddRemoteFlags(cmd)
+	o.AddProgressFlags(cmd)
+	o.AddReportFlags(cmd)
+	f.BoolVar(&o.Verbose, "verbose", false, "Log bytes transferred and throughput for each reference as it is copied (requires --log-level debug)")
+	f.StringSliceVar(&o.AllowDigests, "allow-digest", []string{}, "(Optional) Only copy references resolving to these digests, i.e. sha256:<hex>")
+	f.StringSliceVar(&o.DenyDigests, "deny-digest", []string{}, "(Optional) Never copy references resolving to these digests, i.e. sha256:<hex>")
+	f.BoolVar(&o.StrictDigests, "strict-digests", false, "Fail the copy when a reference is rejected by --allow-digest or --deny-digest instead of skipping it")
+	f.StringSliceVar(&o.Include, "include", []string{}, "(Optional) Only copy references matching one of these glob patterns, as listed by 'hauler store list'. i.e. 'rancher/*'")
+	f.StringSliceVar(&o.Exclude, "exclude", []string{}, "(Optional) Never copy references matching one of these glob patterns, taking precedence over --include")
+	f.IntVar(&o.Concurrency, "concurrency", 4, "Number of references to copy at once")
+	f.IntVar(&o.Retries, "retries", 3, "Number of times to retry copying a reference after a transient failure, such as a dropped connection or a 5xx from the registry")
+	f.DurationVar(&o.RetryDelay, "retry-delay", time.Second, "Delay before the first retry, doubling for each retry after")
+	f.DurationVar(&o.RetryMaxDelay, "retry-max-delay", 30*time.Second, "Longest delay between retries")
+	f.StringVar(&o.ErrorReport, "error-report", "", "(Optional) Path to write a json report of every reference that failed to copy to")
+	f.StringVar(&o.RelocationRules, "relocation-rules", "", "(Optional) Path to a yaml file of the rules relocating repositories when copying to a registry, the flags below add to it")
+	f.StringVar(&o.RepoPrefix, "repo-prefix", "", "(Optional) Prefix for every repository copied to a registry, i.e. 'airgap/'")
+	f.BoolVar(&o.Flatten, "flatten", false, "Keep the last component of each repository copied to a registry alone, so 'rancher/mirrored/busybox' becomes 'busybox'")
+	f.StringArrayVar(&o.Rewrites, "rewrite", []string{}, "(Optional) Regular expression rewriting repositories copied to a registry, as match=replace. i.e. '^rancher/mirrored-(.*)=mirrored/$1'. Can be repeated")
+	f.BoolVar(&o.LayoutPerRef, "layout-per-ref", false, "Write each reference copied to a dir:// target to an oci layout of its own, at <dir>/<registry>/<repository>/<tag>")
+	f.StringVar(&o.Format, "format", "", "(Optional) Format to copy to instead of the one of the target's protocol, only '"+DockerArchiveFormat+"' for a tarball to 'docker load' or 'ctr images import'")
+	f.StringVar(&o.Platform, "platform", "", "(Optional) Platform of the images of a multi-platform index written to a docker archive or imported into containerd. Defaults to linux on the architecture hauler runs on")
+	f.StringVar(&o.ContainerdAddress, "containerd-address", "", "(Optional) Socket of the containerd a containerd:// target imports into. Defaults to CONTAINERD_ADDRESS, then the containerd of k3s or rke2, then /run/containerd/containerd.sock")
+	f.BoolVar(&o.RequireDigestMatch, "require-digest-match", false, "Fail copying a reference the destination registry resolves to another digest than the store, such as by rewriting its media types, since manifests pinning images by digest would break")
+	f.StringVar(&o.DestinationsFile, "destinations", "", "(Optional) Path to a yaml file of registry:// targets, each with its own credentials, to copy to along with those given as arguments")
+	f.StringToStringVar(&o.RegistryNamespace, "registry-namespace", map[string]string{}, "(Optional) Namespace to place the repositories of a source registry under, as registry=namespace. i.e. 'docker.io=dockerhub,ghcr.io=github'")
+}
+
+// newCopyOpts returns the options of a copy made on behalf of another command, with the defaults of the flags of copy
+// on top of a copy of ro
+func newCopyOpts(ro *RootOpts) *CopyOpts {
+	root := *ro
+	o := &CopyOpts{RootOpts: &root}
+	o.AddFlags(&cobra.Command{})
+	return o
+}
+
+// relocationRules loads the relocation rules file, adding the rules of the flags to it
+func (o *CopyOpts) relocationRules() (reference.RelocationRules, error) {
+	var rules reference.RelocationRules
+	if o.RelocationRules != "" {
+		var err error
+		if rules, err = reference.LoadRelocationRules(o.RelocationRules); err != nil {
+			return reference.RelocationRules{}, err
+		}
+	}
+
+	for _, s := range o.Rewrites {
+		rw, err := reference.ParseRewrite(s)
+		if err != nil {
+			return reference.RelocationRules{}, err
+		}
+		rules.Rewrites = append(rules.Rewrites, rw)
+	}
+	if o.Flatten {
+		rules.Flatten = true
+	}
+	if len(o.RegistryNamespace) > 0 && rules.Namespaces == nil {
+		rules.Namespaces = make(map[string]string, len(o.RegistryNamespace))
+	}
+	for registry, ns := range o.RegistryNamespace {
+		rules.Namespaces[registry] = ns
+	}
+	if o.RepoPrefix != "" {
+		rules.Prefix = o.RepoPrefix
+	}
+	return rules, rules.Validate()
+}
+
+// copyOptions translates the command flags into the store's copy options
+func (o *CopyOpts) copyOptions() ([]store.CopyOption, error) {
+	var opts []store.CopyOption
+	if o.Verbose {
+		opts = append(opts, store.WithVerbose())
+	}
+
+	allow, err := parseDigests(o.AllowDigests)
+	if err != nil {
+		return nil, err
+	}
+	if len(allow) > 0 {
+		opts = append(opts, store.WithAllowDigests(allow...))
+	}
+
+	deny, err := parseDigests(o.DenyDigests)
+	if err != nil {
+		return nil, err
+	}
+	if len(deny) > 0 {
+		opts = append(opts, store.WithDenyDigests(deny...))
+	}
+
+	if o.StrictDigests {
+		opts = append(opts, store.WithStrictDigests())
+	}
+
+	if o.RequireDigestMatch {
+		opts = append(opts, store.WithRequireDigestMatch())
+	}
+
+	if len(o.Include) > 0 || len(o.Exclude) > 0 {
+		filter, err := store.NewRefFilter(o.Include, o.Exclude)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, store.WithRefFilter(filter))
+	}
+
+	if o.Concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1, got [%d]", o.Concurrency)
+	}
+	opts = append(opts, store.WithConcurrency(o.Concurrency))
+
+	if o.Retries < 0 {
+		return nil, fmt.Errorf("retries must not be negative, got [%d]", o.Retries)
+	}
+	opts = append(opts, store.WithRetries(o.Retries), store.WithRetryDelay(o.RetryDelay, o.RetryMaxDelay))
+	return opts, nil
 }
 
-func CopyCmd(ctx context.Context, o *CopyOpts, s *store.Layout, targetRef string) error {
+func parseDigests(values []string) ([]digest.Digest, error) {
+	var dgsts []digest.Digest
+	for _, v := range values {
+		d, err := digest.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing digest [%s]: %w", v, err)
+		}
+		dgsts = append(dgsts, d)
+	}
+	return dgsts, nil
+}
+
+func CopyCmd(ctx context.Context, o *CopyOpts, s *store.Layout, targetRef string) (err error) {
 	l := log.FromContext(ctx)
 
+	end, err := o.beginProgress(ctx, "copy")
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	ctx, finish := o.beginReport(ctx, "copy")
+	defer func() { err = finish(err) }()
+
+	ctx, cancel := s.TransportOptions().WithOperationTimeout(ctx)
+	defer cancel()
+
+	copts, err := o.copyOptions()
+	if err != nil {
+		return err
+	}
+
 	components := strings.SplitN(targetRef, "://", 2)
 	switch components[0] {
 	case "dir":
 		l.Debugf("identified directory target reference")
-		fs := content.NewFile(components[1])
-		defer fs.Close()
+		if err := copyToLayout(ctx, o, s, components[1]); err != nil {
+			return err
+		}
 
-		_, err := s.CopyAll(ctx, fs, nil)
-		if err != nil {
+	case "containerd":
+		l.Debugf("identified containerd target reference")
+		if err := copyToContainerd(ctx, o, s, components[1]); err != nil {
+			return err
+		}
+
+	case "s3":
+		l.Debugf("identified s3 target reference")
+		if err := copyToS3(ctx, o, s, targetRef); err != nil {
 			return err
 		}
 
 	case "registry":
 		l.Debugf("identified registry target reference")
-		ropts := content.RegistryOptions{
+		ropts := hcontent.RegistryOptions{
 			Username:  o.Username,
 			Password:  o.Password,
 			Insecure:  o.Insecure,
 			PlainHTTP: o.PlainHTTP,
+			UserAgent: s.UserAgent(),
+
+			TransportOptions: s.TransportOptions(),
 		}
-		
-		if ropts.Username != "" {
-			err := cosign.RegistryLogin(ctx, s, components[1], ropts)
-			if err != nil {
-				return err
-			}
+
+		r, err := hcontent.NewRegistry(ropts)
+		if err != nil {
+			return err
 		}
 
-		err := cosign.LoadImages(ctx, s, components[1], ropts)
+		rules, err := o.relocationRules()
 		if err != nil {
 			return err
 		}
 
+		_, err = s.CopyAll(ctx, r, registryMapper(ctx, rules, components[1]), copts...)
+		if err != nil {
+			return reportCopyFailures(ctx, err, o.ErrorReport)
+		}
+
 	default:
 		return fmt.Errorf("detecting protocol from [%s]", targetRef)
 	}
@@ -75,3 +286,324 @@ func CopyCmd(ctx context.Context, o *CopyOpts, s *store.Layout, targetRef string
 	l.Infof("copied artifacts to [%s]", components[1])
 	return nil
 }
+
+// CopyDockerArchiveCmd writes images of the store to a docker archive at path, for hosts without any registry to load
+// them with docker load or ctr images import
+//
+//	Without refs, every image selected by the include, exclude, and digest filters is written to the one archive.
+//	The archive is written beside path and renamed into place, so a failed copy never leaves a truncated archive.
+func CopyDockerArchiveCmd(ctx context.Context, o *CopyOpts, s *store.Layout, path string, refs ...string) (err error) {
+	l := log.FromContext(ctx)
+
+	ctx, finish := o.beginReport(ctx, "copy")
+	defer func() { err = finish(err) }()
+
+	platform, err := o.archivePlatform()
+	if err != nil {
+		return err
+	}
+
+	if len(refs) == 0 {
+		var err error
+		if refs, err = o.selectImages(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(abs), filepath.Base(abs)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := s.ExportDockerArchive(ctx, f, refs, platform); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), abs); err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		l.Debugf("wrote [%s] for [%s]", ref, platforms.Format(platform))
+	}
+	l.Infof("wrote [%d] images to the docker archive [%s]", len(refs), abs)
+	return nil
+}
+
+// copyToContainerd imports the images of the store selected by the filters of o into the containerd namespace of the
+// local node, through a docker archive of its platform
+func copyToContainerd(ctx context.Context, o *CopyOpts, s *store.Layout, namespace string) error {
+	l := log.FromContext(ctx)
+
+	platform, err := o.archivePlatform()
+	if err != nil {
+		return err
+	}
+	refs, err := o.selectImages(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "hauler-containerd-*.tar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := s.ExportDockerArchive(ctx, f, refs, platform); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := image.ImportToContainerd(ctx, namespace, o.ContainerdAddress, f.Name()); err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		l.Debugf("imported [%s] for [%s]", ref, platforms.Format(platform))
+	}
+	l.Infof("imported [%d] images into containerd", len(refs))
+	return nil
+}
+
+// archivePlatform returns the platform of the images written to a docker archive
+func (o *CopyOpts) archivePlatform() (ocispec.Platform, error) {
+	return singlePlatform(o.Platform, "a docker archive holds a single platform of each image")
+}
+
+// singlePlatform parses the single platform p, linux on the architecture hauler runs on when empty, reason explaining
+// why a list isn't accepted
+func singlePlatform(p string, reason string) (ocispec.Platform, error) {
+	if p == "" {
+		return platforms.Normalize(ocispec.Platform{OS: "linux", Architecture: runtime.GOARCH}), nil
+	}
+	ps, err := store.ParsePlatforms(p)
+	if err != nil {
+		return ocispec.Platform{}, err
+	}
+	if len(ps) != 1 {
+		return ocispec.Platform{}, fmt.Errorf("%s, got [%s]", reason, p)
+	}
+	return ps[0], nil
+}
+
+// selectImages returns the reference names of the images of the store selected by the filters of o
+func (o *CopyOpts) selectImages(ctx context.Context, s *store.Layout) ([]string, error) {
+	selected, err := o.selectRefs(s)
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, ref := range selected {
+		desc, err := s.Stat(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(desc.Annotations[consts.KindAnnotationName], consts.KindAnnotation) {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no images in the store to copy")
+	}
+	return refs, nil
+}
+
+// copyToLayout writes the references of the store selected by the filters of o to an oci layout at dir, or to one
+// layout per reference beneath it
+func copyToLayout(ctx context.Context, o *CopyOpts, s *store.Layout, dir string) error {
+	l := log.FromContext(ctx)
+
+	refs, err := o.selectRefs(s)
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		return fmt.Errorf("no references in the store to copy")
+	}
+
+	if !o.LayoutPerRef {
+		if _, err := s.ExportLayout(ctx, dir, refs); err != nil {
+			return err
+		}
+		l.Infof("wrote [%d] references to the oci layout [%s]", len(refs), dir)
+		return nil
+	}
+
+	for _, ref := range refs {
+		path, err := layoutPath(dir, ref)
+		if err != nil {
+			return err
+		}
+		if _, err := s.ExportLayout(ctx, path, []string{ref}); err != nil {
+			return fmt.Errorf("writing [%s] to [%s]: %w", ref, path, err)
+		}
+		l.Infof("wrote [%s] to the oci layout [%s]", ref, path)
+	}
+	return nil
+}
+
+// registryMapper returns the mapper of the references copied to registry, relocated by rules
+//
+//	Rules such as flattening can relocate different repositories onto one, which would overwrite each other, so
+//	mapping a second repository onto the same one fails.
+func registryMapper(ctx context.Context, rules reference.RelocationRules, registry string) func(string) (string, error) {
+	l := log.FromContext(ctx)
+
+	var mu sync.Mutex
+	sources := make(map[string]string)
+	return func(ref string) (string, error) {
+		relocated, err := rules.Relocate(ref, registry)
+		if err != nil {
+			return "", err
+		}
+
+		src, err := name.ParseReference(ref)
+		if err != nil {
+			return "", err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		to := relocated.Context().Name()
+		if prev, ok := sources[to]; ok && prev != src.Context().Name() {
+			return "", fmt.Errorf("relocating both [%s] and [%s] to [%s]", prev, src.Context().Name(), to)
+		}
+		sources[to] = src.Context().Name()
+		if !rules.IsZero() {
+			l.Debugf("relocating [%s] to [%s]", ref, relocated.Name())
+		}
+		return relocated.Name(), nil
+	}
+}
+
+// copyToS3 writes the references of the store selected by the filters of o to an oci layout beneath the prefix of an
+// s3:// target, skipping the blobs it already holds so an interrupted copy is resumed
+func copyToS3(ctx context.Context, o *CopyOpts, s *store.Layout, target string) error {
+	l := log.FromContext(ctx)
+
+	c, err := newS3Client(s, target)
+	if err != nil {
+		return err
+	}
+	refs, err := o.selectRefs(s)
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		return fmt.Errorf("no references in the store to copy")
+	}
+
+	if _, err := s.WriteLayout(ctx, c, refs); err != nil {
+		return err
+	}
+	l.Infof("wrote [%d] references to the oci layout [%s]", len(refs), target)
+	return nil
+}
+
+// newS3Client returns a client of the s3:// target, configured by the aws environment and making its requests through
+// the transport of the store
+func newS3Client(s *store.Layout, target string) (*s3.Client, error) {
+	bucket, prefix, err := s3.ParseURL(target)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := s3.OptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	opts.Transport = s.TransportOptions().Transport(http.DefaultTransport.(*http.Transport))
+	return s3.NewClient(bucket, prefix, opts)
+}
+
+// selectRefs returns the reference names of the store selected by the include, exclude, and digest filters of o
+func (o *CopyOpts) selectRefs(s *store.Layout) ([]string, error) {
+	filter, err := store.NewRefFilter(o.Include, o.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	allow, err := parseDigests(o.AllowDigests)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseDigests(o.DenyDigests)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool)
+	if err := s.Walk(func(_ string, desc ocispec.Descriptor) error {
+		ref := desc.Annotations[ocispec.AnnotationRefName]
+		if _, ok := selected[ref]; ok || !filter.Matches(ref) {
+			return nil
+		}
+		// cosign content is selected along with its image, by its name
+		switch desc.Annotations[consts.KindAnnotationName] {
+		case consts.KindAnnotationSigs, consts.KindAnnotationAtts, consts.KindAnnotationSboms, consts.KindAnnotationReferrers:
+			return nil
+		}
+
+		rejected := slices.Contains(deny, desc.Digest) || (len(allow) > 0 && !slices.Contains(allow, desc.Digest))
+		if rejected && o.StrictDigests {
+			return fmt.Errorf("reference [%s] resolves to a rejected digest [%s]", ref, desc.Digest)
+		}
+		selected[ref] = !rejected
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	for ref, ok := range selected {
+		if ok {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// layoutPath returns the directory of the layout of ref beneath dir, named after its registry, repository, and tag, or
+// the algorithm and hex of its digest
+func layoutPath(dir string, ref string) (string, error) {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+	leaf := r.Identifier()
+	if d, ok := r.(name.Digest); ok {
+		leaf = strings.Replace(d.DigestStr(), ":", "-", 1)
+	}
+	return filepath.Join(dir, r.Context().RegistryStr(), filepath.FromSlash(r.Context().RepositoryStr()), leaf), nil
+}
+
+// reportCopyFailures logs every reference a copy failed on before returning err, also writing them as a json report to
+// reportPath when set
+func reportCopyFailures(ctx context.Context, err error, reportPath string) error {
+	l := log.FromContext(ctx)
+
+	var cerr *store.CopyAllError
+	if !errors.As(err, &cerr) {
+		return err
+	}
+	for _, f := range cerr.Failures {
+		l.Errorf("%v", f)
+	}
+
+	if reportPath != "" {
+		r := failureReport{Total: cerr.Total}
+		r.add("", "", cerr)
+		if werr := r.write(reportPath); werr != nil {
+			l.Errorf("%v", werr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	hcontent "github.com/rancherfederal/hauler/pkg/content"
+	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+// Destinations are the registries a single copy fans the store out to
+//
+//	destinations:
+//	  - target: registry://harbor.enclave-a.example.com
+//	    username: robot$hauler
+//	    password: ...
+//	  - target: registry://harbor.enclave-b.example.com:5000
+//	    plainHTTP: true
+type Destinations struct {
+	Destinations []Destination `json:"destinations"`
+}
+
+// Destination is a registry:// target with the options of its own, falling back to those of the command
+type Destination struct {
+	Target    string `json:"target"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+	Insecure  bool   `json:"insecure,omitempty"`
+	PlainHTTP bool   `json:"plainHTTP,omitempty"`
+}
+
+// loadDestinations reads the destinations file at path
+func loadDestinations(path string) ([]Destination, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var d Destinations
+	if err := yaml.UnmarshalStrict(data, &d); err != nil {
+		return nil, fmt.Errorf("parsing destinations [%s]: %w", path, err)
+	}
+	if len(d.Destinations) == 0 {
+		return nil, fmt.Errorf("destinations [%s] lists no destination", path)
+	}
+	return d.Destinations, nil
+}
+
+// destinations returns the targets given as arguments along with those of the destinations file, each with the
+// options of the command unless it has its own
+func (o *CopyOpts) destinations(targets []string) ([]Destination, error) {
+	var dests []Destination
+	for _, t := range targets {
+		dests = append(dests, Destination{Target: t, Username: o.Username, Password: o.Password, Insecure: o.Insecure, PlainHTTP: o.PlainHTTP})
+	}
+	if o.DestinationsFile != "" {
+		fromFile, err := loadDestinations(o.DestinationsFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range fromFile {
+			if d.Username == "" && d.Password == "" {
+				d.Username, d.Password = o.Username, o.Password
+			}
+			d.Insecure = d.Insecure || o.Insecure
+			d.PlainHTTP = d.PlainHTTP || o.PlainHTTP
+			dests = append(dests, d)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, d := range dests {
+		if !strings.HasPrefix(d.Target, "registry://") {
+			return nil, fmt.Errorf("destination [%s] is not a registry://, only registries can be copied to at once", d.Target)
+		}
+		if seen[d.Target] {
+			return nil, fmt.Errorf("destination [%s] is given more than once", d.Target)
+		}
+		seen[d.Target] = true
+	}
+	return dests, nil
+}
+
+// CopyToDestinationsCmd copies the store to several registries at once, reading each reference from the store a single
+// time for all of them
+//
+//	A registry that fails is dropped for the remaining references while the others carry on, each registry's outcome
+//	is logged on its own, and --error-report records the failures by registry.
+func CopyToDestinationsCmd(ctx context.Context, o *CopyOpts, s *store.Layout, targets ...string) (err error) {
+	l := log.FromContext(ctx)
+
+	end, err := o.beginProgress(ctx, "copy")
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	ctx, finish := o.beginReport(ctx, "copy")
+	defer func() { err = finish(err) }()
+
+	dests, err := o.destinations(targets)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.TransportOptions().WithOperationTimeout(ctx)
+	defer cancel()
+
+	copts, err := o.copyOptions()
+	if err != nil {
+		return err
+	}
+	rules, err := o.relocationRules()
+	if err != nil {
+		return err
+	}
+
+	regs := make([]store.Destination, len(dests))
+	for i, d := range dests {
+		registry := strings.TrimPrefix(d.Target, "registry://")
+		r, err := hcontent.NewRegistry(hcontent.RegistryOptions{
+			Username:  d.Username,
+			Password:  d.Password,
+			Insecure:  d.Insecure,
+			PlainHTTP: d.PlainHTTP,
+			UserAgent: s.UserAgent(),
+
+			TransportOptions: s.TransportOptions(),
+		})
+		if err != nil {
+			return fmt.Errorf("destination [%s]: %w", d.Target, err)
+		}
+		regs[i] = store.Destination{Name: registry, Target: r, Mapper: registryMapper(ctx, rules, registry)}
+	}
+
+	descs, err := s.CopyAllTo(ctx, regs, copts...)
+
+	// the failures of destinations are joined, any other error is returned alone
+	failures := make(map[string]error)
+	if err != nil {
+		joined, ok := err.(interface{ Unwrap() []error })
+		if !ok {
+			return err
+		}
+		for _, e := range joined.Unwrap() {
+			var derr *store.DestinationError
+			if !errors.As(e, &derr) {
+				return err
+			}
+			failures[derr.Name] = derr
+		}
+	}
+
+	report := failureReport{Total: len(regs)}
+	for _, t := range regs {
+		if f, ok := failures[t.Name]; ok {
+			l.Errorf("copy to [%s] failed: %v", t.Name, f)
+			report.Failures = append(report.Failures, failure{Kind: "destination", Reference: t.Name, Error: f.Error()})
+			continue
+		}
+		l.Infof("copied [%d] references to [%s]", len(descs), t.Name)
+	}
+
+	if len(report.Failures) == 0 {
+		return nil
+	}
+	if o.ErrorReport != "" {
+		if werr := report.write(o.ErrorReport); werr != nil {
+			l.Errorf("%v", werr)
+		}
+	}
+	return fmt.Errorf("copy failed for [%d] of [%d] destinations", len(report.Failures), len(regs))
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mholt/archiver/v3"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rancherfederal/hauler/pkg/staging"
+	"github.com/rancherfederal/hauler/pkg/store"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+type DiffOpts struct {
+	*RootOpts
+
+	OutputFormat string
+	TempOverride string
+}
+
+func (o *DiffOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.StringVarP(&o.OutputFormat, "output", "o", "table", "Output format (table, json, yaml)")
+	f.StringVarP(&o.TempOverride, "tempdir", "t", "", "overrides the default directory for temporary files, as returned by your OS.")
+}
+
+// DiffCmd compares the store against another store or store archive, reporting what the store added, removed, or
+// changed since the other
+func DiffCmd(ctx context.Context, o *DiffOpts, s *store.Layout, other string) error {
+	base, cleanup, err := openStore(ctx, other, o.TempOverride)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	d, err := s.Diff(ctx, base)
+	if err != nil {
+		return err
+	}
+	return writeDiff(os.Stdout, o.OutputFormat, d)
+}
+
+// openStore opens path as a store, either a store directory or a store archive, which is loaded into a temporary store
+// removed by the returned cleanup
+func openStore(ctx context.Context, path string, tempOverride string) (*store.Layout, func(), error) {
+	l := log.FromContext(ctx)
+	noop := func() {}
+
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		s, err := store.NewLayout(path)
+		return s, noop, err
+	}
+
+	tmpdir, cleanup, err := staging.Dir(ctx, tempOverride, "layout")
+	if err != nil {
+		return nil, noop, err
+	}
+
+	s, err := store.NewLayout(tmpdir)
+	if err != nil {
+		cleanup()
+		return nil, noop, err
+	}
+
+	// encrypted archives are only decrypted when loaded
+	err = loadArchive(ctx, s, path, nil)
+	if errors.Is(err, store.ErrUnversionedArchive) {
+		l.Warnf("[%s] has no version header and can't be verified, reading it as a legacy archive", path)
+		if err = archiver.Unarchive(path, tmpdir); err == nil {
+			s, err = store.NewLayout(tmpdir)
+		}
+	}
+	if err != nil {
+		cleanup()
+		return nil, noop, fmt.Errorf("opening [%s]: %w", path, err)
+	}
+	return s, cleanup, nil
+}
+
+func writeDiff(w io.Writer, format string, d store.Diff) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+
+	case "yaml":
+		data, err := yaml.Marshal(d)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+
+	case "table":
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Change", "Reference", "Type", "Digest", "Size"})
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetRowLine(false)
+
+		for _, a := range d.Added {
+			table.Append([]string{"added", a.Reference, a.ArtifactType, a.Digest.String(), byteCountSI(a.Size)})
+		}
+		for _, a := range d.Removed {
+			table.Append([]string{"removed", a.Reference, a.ArtifactType, a.Digest.String(), byteCountSI(a.Size)})
+		}
+		for _, c := range d.Changed {
+			table.Append([]string{
+				"changed",
+				c.Reference,
+				c.To.ArtifactType,
+				fmt.Sprintf("%s -> %s", c.From.Digest, c.To.Digest),
+				fmt.Sprintf("%s -> %s", byteCountSI(c.From.Size), byteCountSI(c.To.Size)),
+			})
+		}
+		table.SetFooter([]string{"", "", "", "Changes", fmt.Sprintf("+%d -%d ~%d", len(d.Added), len(d.Removed), len(d.Changed))})
+		table.Render()
+		return nil
+	}
+	return fmt.Errorf("unsupported output format [%s], must be one of table, json, or yaml", format)
+}
@@ -5,10 +5,15 @@ import (
 	"strings"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 
+	"github.com/containerd/containerd/platforms"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/spf13/cobra"
 
+	"github.com/rancherfederal/hauler/pkg/consts"
 	"github.com/rancherfederal/hauler/pkg/store"
 
 	"github.com/rancherfederal/hauler/internal/mapper"
@@ -19,17 +24,36 @@ import (
 type ExtractOpts struct {
 	*RootOpts
 	DestinationDir string
+	OutputFile     string
+	Rootfs         bool
+	Platform       string
 }
 
 func (o *ExtractOpts) AddArgs(cmd *cobra.Command) {
 	f := cmd.Flags()
 
 	f.StringVarP(&o.DestinationDir, "output", "o", "", "Directory to save contents to (defaults to current directory)")
+	f.StringVar(&o.OutputFile, "output-file", "", "(Optional) Path to write the file of a file or chart reference to, rather than its original filename in --output")
+	f.BoolVar(&o.Rootfs, "rootfs", false, "(Optional) Extract the root filesystem of an image into --output, which must be empty, rather than its manifest, config, and layers")
+	f.StringVar(&o.Platform, "platform", "", "(Optional) Platform of a multi-platform image whose root filesystem is extracted with --rootfs. Defaults to linux on the architecture hauler runs on")
 }
 
 func ExtractCmd(ctx context.Context, o *ExtractOpts, s *store.Layout, ref string) error {
 	l := log.FromContext(ctx)
 
+	if o.Rootfs && o.OutputFile != "" {
+		return fmt.Errorf("--rootfs and --output-file can't be used together")
+	}
+	if o.Platform != "" && !o.Rootfs {
+		return fmt.Errorf("--platform only applies to --rootfs")
+	}
+	if o.Rootfs {
+		return extractRootfs(ctx, o, s, ref)
+	}
+	if o.OutputFile != "" {
+		return extractFile(ctx, o, s, ref)
+	}
+
 	r, err := reference.Parse(ref)
 	if err != nil {
 		return err
@@ -77,3 +101,115 @@ func ExtractCmd(ctx context.Context, o *ExtractOpts, s *store.Layout, ref string
 
 	return nil
 }
+
+// extractFile writes the single file of the file or chart ref to the path of --output-file, through a temporary file
+// so an interrupted extraction never leaves a partial file behind
+func extractFile(ctx context.Context, o *ExtractOpts, s *store.Layout, ref string) error {
+	l := log.FromContext(ctx)
+
+	desc, err := s.Stat(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("%w (hint: use `hauler store info` to list store contents)", err)
+	}
+	if kind := desc.Annotations[consts.KindAnnotationName]; strings.HasPrefix(kind, consts.KindAnnotation) {
+		return fmt.Errorf("[%s] is an image, extract its root filesystem with --rootfs", ref)
+	}
+
+	rc, err := s.Fetch(ctx, desc)
+	if err != nil {
+		return err
+	}
+	var m ocispec.Manifest
+	err = json.NewDecoder(rc).Decode(&m)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	// a chart may carry its provenance alongside, only the chart itself is the file
+	var files []ocispec.Descriptor
+	for _, layer := range m.Layers {
+		if _, ok := layer.Annotations[ocispec.AnnotationTitle]; !ok {
+			continue
+		}
+		if m.Config.MediaType == consts.ChartConfigMediaType && layer.MediaType != consts.ChartLayerMediaType {
+			continue
+		}
+		files = append(files, layer)
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("[%s] holds [%d] files, --output-file needs exactly one", ref, len(files))
+	}
+	file := files[0]
+
+	abs, err := filepath.Abs(o.OutputFile)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(abs), filepath.Base(abs)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	blob, err := s.OpenBlob(file.Digest)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	_, err = io.Copy(f, blob)
+	blob.Close()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), abs); err != nil {
+		return err
+	}
+
+	l.Infof("extracted [%s] of [%s] to [%s]", file.Annotations[ocispec.AnnotationTitle], ref, o.OutputFile)
+	return nil
+}
+
+// extractRootfs extracts the root filesystem of the image ref into --output, refusing a directory that already holds
+// anything so the rootfs is never mixed into other files
+func extractRootfs(ctx context.Context, o *ExtractOpts, s *store.Layout, ref string) error {
+	l := log.FromContext(ctx)
+
+	dir := o.DestinationDir
+	if dir == "" {
+		return fmt.Errorf("--rootfs needs the directory to extract to with --output")
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("rootfs directory [%s] is not empty", dir)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	platform, err := singlePlatform(o.Platform, "a rootfs is the filesystem of a single platform")
+	if err != nil {
+		return err
+	}
+
+	rc, err := s.Rootfs(ctx, ref, platform)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := mapper.Extract(dir, rc); err != nil {
+		return fmt.Errorf("extracting the rootfs of [%s]: %w", ref, err)
+	}
+
+	l.Infof("extracted the rootfs of [%s] for [%s] to [%s]", ref, platforms.Format(platform), dir)
+	return nil
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/report"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+// artifactFields returns the structured fields logged with the outcome of the artifact ref: its digest and size in the
+// store, and how long it took since start.  The artifact is recorded as added in the run report of ctx.
+func artifactFields(ctx context.Context, s *store.Layout, ref string, start time.Time) log.Fields {
+	e := recordArtifact(ctx, s, ref, start, report.StatusSucceeded)
+	f := log.Fields{
+		log.FieldReference: ref,
+		log.FieldDuration:  e.Duration,
+	}
+	if e.Digest != "" {
+		f[log.FieldDigest] = e.Digest
+		f[log.FieldBytes] = e.Size
+	}
+	return f
+}
+
+// recordArtifact records the artifact ref in the run report of ctx with status, along with its digest and size in the
+// store and how long it took since start
+func recordArtifact(ctx context.Context, s *store.Layout, ref string, start time.Time, status report.Status) report.Entry {
+	e := report.Entry{
+		Reference: ref,
+		Duration:  time.Since(start),
+		Status:    status,
+	}
+	if a, err := s.Describe(ctx, ref); err == nil {
+		e.Kind = a.Kind
+		e.Digest = a.Digest.String()
+		e.Size = a.Size
+	}
+	report.FromContext(ctx).Record(e)
+	return e
+}
+
+// archiveFields returns the structured fields logged with an archive written or read: its name, digest, and size, and
+// how long it took since start
+func archiveFields(name string, size int64, d digest.Digest, start time.Time) log.Fields {
+	f := log.Fields{
+		log.FieldReference: name,
+		log.FieldBytes:     size,
+		log.FieldDuration:  time.Since(start),
+	}
+	if d != "" {
+		f[log.FieldDigest] = d.String()
+	}
+	return f
+}
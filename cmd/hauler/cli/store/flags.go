@@ -3,9 +3,20 @@ package store
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/mitchellh/go-homedir"
+	"github.com/rancherfederal/hauler/pkg/content"
+	"github.com/rancherfederal/hauler/pkg/cosign"
+	"github.com/rancherfederal/hauler/pkg/layer"
+	"github.com/rancherfederal/hauler/pkg/policy"
+	"github.com/rancherfederal/hauler/pkg/progress"
+	"github.com/rancherfederal/hauler/pkg/report"
 	"github.com/rancherfederal/hauler/pkg/store"
 	"github.com/spf13/cobra"
 
@@ -17,14 +28,223 @@ const (
 )
 
 type RootOpts struct {
-	StoreDir string
-	CacheDir string
+	StoreDir     string
+	StoreName    string
+	CacheDir     string
+	CacheMaxSize string
+	UserAgent    string
+	Transport    TransportOpts
+
+	LayerConcurrency int
+	Progress         string
+	Report           string
+	Wait             time.Duration
+	SkipSpaceCheck   bool
+
+	// Stores are the named stores of the configuration file --store-name selects from
+	Stores map[string]NamedStore
+}
+
+// TransportOpts groups the retry, timeout, and rate limit settings for commands that make requests to remote registries
+//
+//	The zero value leaves every request as a single attempt with no timeouts
+type TransportOpts struct {
+	MaxRetries       int
+	RetryBackoff     time.Duration
+	RequestTimeout   time.Duration
+	OperationTimeout time.Duration
+	TLS              RegistryTLSOpts
+	RegistriesConfig string
+	RegistryMirrors  []string
+
+	RateLimit           string
+	ConnectionRateLimit string
+}
+
+func (o *TransportOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.IntVar(&o.MaxRetries, "max-retries", 0, "(Optional) Number of times to retry a failed registry request")
+	f.DurationVar(&o.RetryBackoff, "retry-backoff", 0, "(Optional) Delay before the first retry, doubling for each retry after. Defaults to 1s when retrying")
+	f.DurationVar(&o.RequestTimeout, "request-timeout", 0, "(Optional) How long to wait for a registry to respond to a single request. Defaults to no timeout")
+	f.DurationVar(&o.OperationTimeout, "timeout", 0, "(Optional) Maximum duration of the entire operation. Defaults to no timeout")
+	o.TLS.AddFlags(cmd)
+	f.StringVar(&o.RegistriesConfig, "registries-config", "", "(Optional) Path to a registries.yaml, in the format of k3s and rke2, configuring the mirrors, credentials, and certificates of individual registries")
+	f.StringSliceVar(&o.RegistryMirrors, "registry-mirror", []string{}, "(Optional) Mirror of docker hub to pull its images from when docker hub fails, such as once rate limited. Can be repeated")
+	f.StringVar(&o.RateLimit, "rate-limit", "", "(Optional) Most bandwidth pulls and pushes to and from registries take between them, i.e. '10MB/s'. Unlimited when empty")
+	f.StringVar(&o.ConnectionRateLimit, "connection-rate-limit", "", "(Optional) Most bandwidth a single connection to a registry takes, i.e. '2MB/s'. Unlimited when empty")
+}
+
+// parseRate parses a rate such as 10MB/s, or 10MB per second, into bytes per second, 0 for unlimited when empty
+func parseRate(flag string, s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	bps, err := store.ParseSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid --%s [%s], must be a size per second, i.e. '10MB/s'", flag, s)
+	}
+	return bps, nil
+}
+
+// Options converts the flags into the content.TransportOptions used by registry clients, loading the registries config
+func (o *TransportOpts) Options() (content.TransportOptions, error) {
+	opts := content.TransportOptions{
+		MaxRetries:       o.MaxRetries,
+		RetryBackoff:     o.RetryBackoff,
+		RequestTimeout:   o.RequestTimeout,
+		OperationTimeout: o.OperationTimeout,
+		TLS:              o.TLS.Options(),
+		RegistryMirrors:  o.RegistryMirrors,
+	}
+	var err error
+	if opts.RateLimit, err = parseRate("rate-limit", o.RateLimit); err != nil {
+		return content.TransportOptions{}, err
+	}
+	if opts.ConnectionRateLimit, err = parseRate("connection-rate-limit", o.ConnectionRateLimit); err != nil {
+		return content.TransportOptions{}, err
+	}
+	if o.RegistriesConfig != "" {
+		c, err := content.LoadRegistriesConfig(o.RegistriesConfig)
+		if err != nil {
+			return content.TransportOptions{}, err
+		}
+		opts.Registries = c
+	}
+	return opts, nil
+}
+
+// RegistryTLSOpts groups the flags for the certificates of connections to registries with a private CA or requiring
+// client certificates
+type RegistryTLSOpts struct {
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	CertsDir string
+}
+
+func (o *RegistryTLSOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringVar(&o.CAFile, "ca-file", "", "(Optional) PEM bundle of certificate authorities to trust along with the system's for registry connections")
+	f.StringVar(&o.CertFile, "cert", "", "(Optional) PEM client certificate to present to registries requiring one")
+	f.StringVar(&o.KeyFile, "cert-key", "", "(Optional) PEM key of the client certificate of --cert")
+	f.StringVar(&o.CertsDir, "certs-dir", "", "(Optional) Directory of per-registry certificates laid out as docker's certs.d, i.e. <dir>/registry.example.com:5000/{ca.crt,client.cert,client.key}")
+	cmd.MarkFlagsRequiredTogether("cert", "cert-key")
+}
+
+// Options converts the flags into content.TLSOptions
+func (o *RegistryTLSOpts) Options() content.TLSOptions {
+	return content.TLSOptions{
+		CAFile:   o.CAFile,
+		CertFile: o.CertFile,
+		KeyFile:  o.KeyFile,
+		CertsDir: o.CertsDir,
+	}
+}
+
+// KeylessOpts groups the flags for verifying image signatures keylessly, against the certificate fulcio issued the
+// signer rather than a key
+type KeylessOpts struct {
+	CertIdentity         string
+	CertIdentityRegexp   string
+	CertOIDCIssuer       string
+	CertOIDCIssuerRegexp string
+}
+
+func (o *KeylessOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringVar(&o.CertIdentity, "certificate-identity", "", "(Optional) Verify signatures keylessly, requiring this identity of the signer in its certificate. i.e. 'release@example.com'")
+	f.StringVar(&o.CertIdentityRegexp, "certificate-identity-regexp", "", "(Optional) Verify signatures keylessly, requiring the identity of the signer in its certificate to match this regular expression")
+	f.StringVar(&o.CertOIDCIssuer, "certificate-oidc-issuer", "", "(Optional) OIDC issuer required to have vouched for the signer with keyless verification. i.e. 'https://token.actions.githubusercontent.com'")
+	f.StringVar(&o.CertOIDCIssuerRegexp, "certificate-oidc-issuer-regexp", "", "(Optional) Regular expression the OIDC issuer that vouched for the signer is required to match with keyless verification")
+	cmd.MarkFlagsMutuallyExclusive("certificate-identity", "certificate-identity-regexp")
+	cmd.MarkFlagsMutuallyExclusive("certificate-oidc-issuer", "certificate-oidc-issuer-regexp")
+}
+
+// Options converts the flags into the cosign.VerifyOptions verifying with key, which is left empty for keyless
+// verification
+func (o *KeylessOpts) Options(key string) cosign.VerifyOptions {
+	return cosign.VerifyOptions{
+		Key:                  key,
+		CertIdentity:         o.CertIdentity,
+		CertIdentityRegexp:   o.CertIdentityRegexp,
+		CertOIDCIssuer:       o.CertOIDCIssuer,
+		CertOIDCIssuerRegexp: o.CertOIDCIssuerRegexp,
+	}
+}
+
+// loadPolicy loads the policy file at path, returning a nil policy that admits everything when path is empty
+func loadPolicy(path string) (*policy.Policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, err
+	}
+	return policy.Load(path)
 }
 
 func (o *RootOpts) AddArgs(cmd *cobra.Command) {
 	pf := cmd.PersistentFlags()
 	pf.StringVarP(&o.StoreDir, "store", "s", DefaultStoreName, "Location to create store at")
-	pf.StringVar(&o.CacheDir, "cache", "", "(deprecated flag and currently not used)")
+	pf.StringVar(&o.StoreName, "store-name", "", "(Optional) Name of a store defined in the stores of the configuration file to use in place of --store, see hauler store list-stores")
+	pf.StringVar(&o.CacheDir, "cache", "", "(Optional) Directory, or registry://<registry>/<repository> shared between hosts, of a layer cache shared by stores and runs, layers it holds are read from it rather than pulled again. Disabled when empty")
+	pf.StringVar(&o.CacheMaxSize, "cache-max-size", "", "(Optional) Largest size the --cache may grow to, i.e. 20GB, the least recently used layers are evicted beyond it. Unbounded when empty")
+	pf.DurationVar(&o.Wait, "wait", 0, "(Optional) How long to wait for another hauler process changing the store to finish before failing, i.e. '10m'. Fails at once when 0, waits indefinitely when negative")
+	pf.BoolVar(&o.SkipSpaceCheck, "skip-space-check", false, "(Optional) Skip checking the disk has the space for what's about to be synced, added, or saved before starting")
+}
+
+// AddRemoteFlags adds the --user-agent and transport flags to commands that make requests to remote registries
+func (o *RootOpts) AddRemoteFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringVar(&o.UserAgent, "user-agent", "", "(Optional) User-Agent header to send with remote registry requests. Defaults to hauler/<version>")
+	f.IntVar(&o.LayerConcurrency, "layer-concurrency", 0, "(Optional) Number of layers of a single image to download at once. Defaults to 4")
+	o.Transport.AddFlags(cmd)
+}
+
+// AddProgressFlags adds the --progress flag to commands transferring content
+func (o *RootOpts) AddProgressFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringVar(&o.Progress, "progress", string(progress.ModeAuto), "(Optional) How to report the bytes transferred with their rate and ETA: auto (bars on a terminal, periodic log lines otherwise), bar, log, or none")
+}
+
+// beginProgress reports the progress of the operation title the way --progress asks, until the returned func is called
+func (o *RootOpts) beginProgress(ctx context.Context, title string) (func(), error) {
+	mode, err := progress.ParseMode(o.Progress)
+	if err != nil {
+		return nil, err
+	}
+	return progress.FromContext(ctx).Begin(ctx, title, mode), nil
+}
+
+// AddReportFlags adds the --report flag to commands whose artifacts are recorded in a run report
+func (o *RootOpts) AddReportFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringVar(&o.Report, "report", "", "(Optional) Path to write a json report of every artifact processed to, with its digest, size, duration, and status, written whether the command succeeds or fails")
+}
+
+// beginReport records the artifacts processed by command in the report --report asks for, returning the context to
+// record them through and the func writing the report once the command returns err
+//
+//	The func returns err, or the error writing the report when the command succeeded.
+func (o *RootOpts) beginReport(ctx context.Context, command string) (context.Context, func(err error) error) {
+	if o.Report == "" {
+		return ctx, func(err error) error { return err }
+	}
+
+	r := report.New(command, o.StoreDir)
+	return report.WithContext(ctx, r), func(err error) error {
+		r.Finish(err)
+		if werr := r.WriteFile(o.Report); werr != nil {
+			if err != nil {
+				log.FromContext(ctx).Errorf("%v", werr)
+				return err
+			}
+			return werr
+		}
+		log.FromContext(ctx).Infof("wrote report of [%d] artifacts to [%s]", len(r.Artifacts), o.Report)
+		return err
+	}
 }
 
 func (o *RootOpts) Store(ctx context.Context) (*store.Layout, error) {
@@ -46,9 +266,110 @@ func (o *RootOpts) Store(ctx context.Context) (*store.Layout, error) {
 		return nil, err
 	}
 
-	s, err := store.NewLayout(abs)
+	topts, err := o.Transport.Options()
 	if err != nil {
 		return nil, err
 	}
+	if err := topts.TLS.Validate(); err != nil {
+		return nil, err
+	}
+	opts := []store.Options{
+		store.WithTransportOptions(topts),
+	}
+	if o.UserAgent != "" {
+		opts = append(opts, store.WithUserAgent(o.UserAgent))
+	}
+	if o.LayerConcurrency < 0 {
+		return nil, fmt.Errorf("layer concurrency can't be negative, got [%d]", o.LayerConcurrency)
+	}
+	opts = append(opts, store.WithLayerConcurrency(o.LayerConcurrency), store.WithLockTimeout(o.Wait))
+
+	s, err := store.NewLayout(abs, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.CacheDir != "" {
+		c, err := o.cache(s)
+		if err != nil {
+			return nil, err
+		}
+		l.Debugf("using layer cache at %s", o.CacheDir)
+		store.WithCache(c)(s)
+	} else if o.CacheMaxSize != "" {
+		return nil, fmt.Errorf("--cache-max-size needs a --cache")
+	}
 	return s, nil
 }
+
+// checkSpace fails early when the filesystem of path can't hold the required bytes about to be written to it, rather
+// than halfway through with a half-written store, unless --skip-space-check
+//
+//	Failing to determine the free space only warns, the write is left to fail on its own if it has to.
+func (o *RootOpts) checkSpace(ctx context.Context, path string, required int64) error {
+	l := log.FromContext(ctx)
+	if o.SkipSpaceCheck {
+		return nil
+	}
+
+	l.Debugf("checking [%s] has the space for [%s]", path, byteCountSI(required))
+	err := store.CheckSpace(path, required)
+	if errors.Is(err, store.ErrInsufficientSpace) {
+		return fmt.Errorf("%w, free up space or pass --skip-space-check to try anyway", err)
+	}
+	if err != nil {
+		l.Warnf("unable to check the disk space available: %v", err)
+	}
+	return nil
+}
+
+// LockedStore returns the store of o the same as Store, locked against other hauler processes changing it until the
+// returned func is called
+func (o *RootOpts) LockedStore(ctx context.Context) (*store.Layout, func() error, error) {
+	s, err := o.Store(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	unlock, err := s.Lock(ctx)
+	if errors.Is(err, store.ErrLocked) {
+		return nil, nil, fmt.Errorf("%w, pass --wait to wait for it to finish", err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, unlock, nil
+}
+
+// cache returns the layer cache of --cache, a directory bounded by --cache-max-size or a registry:// repository
+// reached the way s reaches registries
+func (o *RootOpts) cache(s *store.Layout) (layer.Cache, error) {
+	if repo, ok := strings.CutPrefix(o.CacheDir, "registry://"); ok {
+		if o.CacheMaxSize != "" {
+			return nil, fmt.Errorf("--cache-max-size only bounds a directory cache, a registry keeps its own storage")
+		}
+		r, err := gname.NewRepository(repo)
+		if err != nil {
+			return nil, fmt.Errorf("--cache: %w", err)
+		}
+		if s.TransportOptions().PlainHTTP(r.RegistryStr()) {
+			if r, err = gname.NewRepository(repo, gname.Insecure); err != nil {
+				return nil, err
+			}
+		}
+		return layer.NewRegistryCache(r, s.RemoteOptions()...), nil
+	}
+
+	dir, err := homedir.Expand(o.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+	var opts []layer.CacheOption
+	if o.CacheMaxSize != "" {
+		max, err := store.ParseSize(o.CacheMaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("--cache-max-size: %w", err)
+		}
+		opts = append(opts, layer.WithMaxSize(max))
+	}
+	return layer.NewFilesystemCache(dir, opts...), nil
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rancherfederal/hauler/pkg/store"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+type GCOpts struct {
+	*RootOpts
+
+	DryRun bool
+}
+
+func (o *GCOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.BoolVar(&o.DryRun, "dry-run", false, "Report the unreferenced blobs and reclaimable space without deleting anything")
+}
+
+func GCCmd(ctx context.Context, o *GCOpts, s *store.Layout) error {
+	l := log.FromContext(ctx)
+
+	var opts []store.GCOption
+	if o.DryRun {
+		opts = append(opts, store.WithDryRun())
+	}
+
+	res, err := s.GC(ctx, opts...)
+	if err != nil {
+		return err
+	}
+
+	if o.DryRun {
+		for _, d := range res.Blobs {
+			l.Infof("would delete [%s]", d)
+		}
+		l.Infof("%d unreferenced blobs, %s reclaimable", len(res.Blobs), byteCountSI(res.Bytes))
+		return nil
+	}
+	l.Infof("deleted %d unreferenced blobs, reclaimed %s", len(res.Blobs), byteCountSI(res.Bytes))
+	return nil
+}
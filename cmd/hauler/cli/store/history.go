@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+type HistoryOpts struct {
+	*RootOpts
+
+	OutputFormat string
+	Actions      []string
+	References   []string
+	Since        string
+}
+
+func (o *HistoryOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.StringVarP(&o.OutputFormat, "output", "o", "table", "Output format (table, json, yaml)")
+	f.StringSliceVar(&o.Actions, "action", []string{}, "(Optional) Only show mutations of these kinds: add, remove, flush, or load")
+	f.StringSliceVar(&o.References, "reference", []string{}, "(Optional) Only show mutations of references matching one of these glob patterns. i.e. 'rancher/*'")
+	f.StringVar(&o.Since, "since", "", "(Optional) Only show mutations since this long ago, or since this date or RFC3339 time. i.e. '24h', '2024-01-31'")
+}
+
+// HistoryCmd shows the audit log of the store: every artifact added, removed, or loaded, and every flush, with who made
+// the change, from which host, and when
+func HistoryCmd(ctx context.Context, o *HistoryOpts, s *store.Layout) error {
+	since, err := parseSince(o.Since, time.Now())
+	if err != nil {
+		return err
+	}
+	actions := make(map[store.AuditAction]bool)
+	for _, a := range o.Actions {
+		switch action := store.AuditAction(a); action {
+		case store.AuditAdd, store.AuditRemove, store.AuditFlush, store.AuditLoad:
+			actions[action] = true
+		default:
+			return fmt.Errorf("unsupported action [%s], must be one of add, remove, flush, or load", a)
+		}
+	}
+	var filter *store.RefFilter
+	if len(o.References) > 0 {
+		if filter, err = store.NewRefFilter(o.References, nil); err != nil {
+			return err
+		}
+	}
+
+	history, err := s.History()
+	if err != nil {
+		return err
+	}
+
+	entries := []store.AuditEntry{}
+	for _, e := range history {
+		if e.Time.Before(since) {
+			continue
+		}
+		if len(actions) > 0 && !actions[e.Action] {
+			continue
+		}
+		if filter != nil && !filter.Matches(e.Reference) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return writeHistory(os.Stdout, o.OutputFormat, entries)
+}
+
+// parseSince returns the time since, either a duration before now or a date or RFC3339 time, the zero time when empty
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, since); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("parsing --since [%s]: must be a duration, date, or RFC3339 time, i.e. '24h', '2024-01-31'", since)
+}
+
+func writeHistory(w io.Writer, format string, entries []store.AuditEntry) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+
+	case "yaml":
+		data, err := yaml.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+
+	case "table":
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Time", "Action", "Reference", "Digest", "User", "Host"})
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetRowLine(false)
+
+		for _, e := range entries {
+			ref, dgst := e.Reference, e.Digest.String()
+			if ref == "" {
+				ref = "-"
+			}
+			if dgst == "" {
+				dgst = "-"
+			}
+			table.Append([]string{
+				e.Time.Local().Format(time.DateTime),
+				string(e.Action),
+				ref,
+				dgst,
+				e.User,
+				e.Host,
+			})
+		}
+		table.Render()
+		return nil
+	}
+	return fmt.Errorf("unsupported output format [%s], must be one of table, json, or yaml", format)
+}
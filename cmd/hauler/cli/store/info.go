@@ -30,7 +30,7 @@ func (o *InfoOpts) AddFlags(cmd *cobra.Command) {
 	f := cmd.Flags()
 
 	f.StringVarP(&o.OutputFormat, "output", "o", "table", "Output format (table, json)")
-	f.StringVarP(&o.TypeFilter, "type", "t", "all", "Filter on type (image, chart, file, sigs, atts, sbom)")
+	f.StringVarP(&o.TypeFilter, "type", "t", "all", "Filter on type (image, chart, file, sigs, atts, sbom, referrers)")
 
 	// TODO: Regex/globbing
 }
@@ -226,6 +226,8 @@ func newItem(s *store.Layout, desc ocispec.Descriptor, m ocispec.Manifest, plat
 		ctype = "atts"
 	case "dev.cosignproject.cosign/sboms":
 		ctype = "sbom"
+	case consts.KindAnnotationReferrers:
+		ctype = "referrers"
 	}
 	
 	ref, err := reference.Parse(desc.Annotations[ocispec.AnnotationRefName])
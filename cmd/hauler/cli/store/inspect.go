@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+// InspectCmd prints the manifests, image configs, layers, platforms, and annotations of a single reference of the store
+func InspectCmd(ctx context.Context, o *InfoOpts, s *store.Layout, reference string) error {
+	in, err := s.Inspect(ctx, reference)
+	if err != nil {
+		return err
+	}
+
+	switch o.OutputFormat {
+	case "json":
+		data, err := json.MarshalIndent(in, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	default:
+		printInspection(os.Stdout, in)
+	}
+	return nil
+}
+
+func printInspection(w io.Writer, in store.Inspection) {
+	fmt.Fprintf(w, "Reference:     %s\n", in.Reference)
+	fmt.Fprintf(w, "Type:          %s\n", in.ArtifactType)
+	fmt.Fprintf(w, "Kind:          %s\n", in.Descriptor.Annotations[consts.KindAnnotationName])
+	fmt.Fprintf(w, "Digest:        %s\n", in.Descriptor.Digest)
+	fmt.Fprintf(w, "Media Type:    %s\n", in.Descriptor.MediaType)
+	printAnnotations(w, "Annotation:    ", in.Descriptor.Annotations)
+
+	for _, m := range in.Manifests {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Manifest:      %s\n", m.Descriptor.Digest)
+		if m.Descriptor.Platform != nil {
+			fmt.Fprintf(w, "  Platform:    %s\n", formatPlatform(*m.Descriptor.Platform))
+		}
+		fmt.Fprintf(w, "  Media Type:  %s\n", m.Manifest.MediaType)
+		if m.Manifest.ArtifactType != "" {
+			fmt.Fprintf(w, "  Artifact:    %s\n", m.Manifest.ArtifactType)
+		}
+		fmt.Fprintf(w, "  Config:      %s (%s, %s)\n", m.Manifest.Config.Digest, m.Manifest.Config.MediaType, byteCountSI(m.Manifest.Config.Size))
+		fmt.Fprintf(w, "  Size:        %s\n", byteCountSI(m.Size()))
+		if m.Config != nil {
+			printImageConfig(w, *m.Config)
+		}
+		printAnnotations(w, "  Annotation:  ", m.Manifest.Annotations)
+
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Layer", "Media Type", "Size"})
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAutoWrapText(false)
+		for _, l := range m.Manifest.Layers {
+			table.Append([]string{l.Digest.String(), l.MediaType, byteCountSI(l.Size)})
+		}
+		table.Render()
+	}
+
+	if len(in.Attached) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Attached:")
+		for _, d := range in.Attached {
+			fmt.Fprintf(w, "  %s  %s\n", d.Digest, d.Annotations[consts.KindAnnotationName])
+		}
+	}
+}
+
+func printImageConfig(w io.Writer, img ocispec.Image) {
+	if img.OS != "" {
+		fmt.Fprintf(w, "  OS/Arch:     %s\n", formatPlatform(img.Platform))
+	}
+	if img.Created != nil && !img.Created.IsZero() {
+		fmt.Fprintf(w, "  Created:     %s\n", img.Created.UTC().Format("2006-01-02T15:04:05Z"))
+	}
+	if len(img.Config.Entrypoint) > 0 {
+		fmt.Fprintf(w, "  Entrypoint:  %s\n", strings.Join(img.Config.Entrypoint, " "))
+	}
+	if len(img.Config.Cmd) > 0 {
+		fmt.Fprintf(w, "  Cmd:         %s\n", strings.Join(img.Config.Cmd, " "))
+	}
+	if img.Config.User != "" {
+		fmt.Fprintf(w, "  User:        %s\n", img.Config.User)
+	}
+	if img.Config.WorkingDir != "" {
+		fmt.Fprintf(w, "  WorkingDir:  %s\n", img.Config.WorkingDir)
+	}
+	printAnnotations(w, "  Label:       ", img.Config.Labels)
+}
+
+// printAnnotations prints annotations sorted by key, each line prefixed with prefix
+func printAnnotations(w io.Writer, prefix string, annotations map[string]string) {
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s=%s\n", prefix, k, annotations[k])
+	}
+}
+
+func formatPlatform(p ocispec.Platform) string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+type ListOpts struct {
+	*RootOpts
+
+	OutputFormat string
+}
+
+func (o *ListOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.StringVarP(&o.OutputFormat, "output", "o", "table", "Output format (table, json, yaml)")
+}
+
+func ListCmd(ctx context.Context, o *ListOpts, s *store.Layout) error {
+	artifacts, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	return writeArtifacts(os.Stdout, o.OutputFormat, artifacts)
+}
+
+func writeArtifacts(w io.Writer, format string, artifacts []store.Artifact) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(artifacts, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+
+	case "yaml":
+		data, err := yaml.Marshal(artifacts)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+
+	case "table":
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Reference", "Type", "Platform", "Digest", "Size"})
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetRowLine(false)
+
+		totalSize := int64(0)
+		for _, a := range artifacts {
+			platforms := "-"
+			if len(a.Platforms) > 0 {
+				platforms = strings.Join(a.Platforms, ",")
+			}
+			table.Append([]string{
+				a.Reference,
+				a.ArtifactType,
+				platforms,
+				a.Digest.String(),
+				byteCountSI(a.Size),
+			})
+			totalSize += a.Size
+		}
+		table.SetFooter([]string{"", "", "", "Total", byteCountSI(totalSize)})
+		table.Render()
+		return nil
+	}
+	return fmt.Errorf("unsupported output format [%s], must be one of table, json, or yaml", format)
+}
@@ -2,10 +2,20 @@ package store
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
+	"filippo.io/age"
 	"github.com/mholt/archiver/v3"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/rancherfederal/hauler/pkg/content"
+	"github.com/rancherfederal/hauler/pkg/cosign"
+	"github.com/rancherfederal/hauler/pkg/progress"
+	"github.com/rancherfederal/hauler/pkg/staging"
 	"github.com/rancherfederal/hauler/pkg/store"
 	"github.com/spf13/cobra"
 
@@ -14,7 +24,12 @@ import (
 
 type LoadOpts struct {
 	*RootOpts
-	TempOverride string
+	TempOverride       string
+	Verbose            bool
+	Key                string
+	InsecureSkipVerify bool
+	Identities         []string
+	PassphraseFile     string
 }
 
 func (o *LoadOpts) AddFlags(cmd *cobra.Command) {
@@ -25,46 +40,227 @@ func (o *LoadOpts) AddFlags(cmd *cobra.Command) {
 	// value from %TMP%, %TEMP%, %USERPROFILE%, or the Windows directory.
 	// On Plan 9, the default is /tmp.
 	f.StringVarP(&o.TempOverride, "tempdir", "t", "", "overrides the default directory for temporary files, as returned by your OS.")
+	f.BoolVar(&o.Verbose, "verbose", false, "Log bytes transferred and throughput for each reference as it is loaded (requires --log-level debug)")
+	f.StringVarP(&o.Key, "key", "k", "", "(Optional) Path to the cosign public key to verify the signed haul manifest written beside each archive with, refusing archives that don't verify")
+	f.BoolVar(&o.InsecureSkipVerify, "insecure-skip-verify", false, "(Optional) Load archives without verifying their haul manifest signature or digest")
+	cmd.MarkFlagsMutuallyExclusive("key", "insecure-skip-verify")
+	f.StringSliceVar(&o.Identities, "identity", []string{}, "(Optional) Path to an age identity file to decrypt encrypted archives with")
+	f.StringVar(&o.PassphraseFile, "passphrase-file", "", "(Optional) Path to a file holding the passphrase to decrypt encrypted archives with, otherwise read from "+passphraseEnv)
+	o.AddProgressFlags(cmd)
 }
 
-// LoadCmd
-// TODO: Just use mholt/archiver for now, even though we don't need most of it
-func LoadCmd(ctx context.Context, o *LoadOpts, archiveRefs ...string) error {
+// identities returns what encrypted archives can be decrypted with, the identities given and any passphrase
+func (o *LoadOpts) identities() ([]age.Identity, error) {
+	identities, err := store.ParseIdentities(o.Identities...)
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase, err := readPassphrase(o.PassphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		id, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, id)
+	}
+	return identities, nil
+}
+
+// LoadCmd merges one or more store archives into the store
+//
+//	Archives written by 'hauler store save' are validated and verified before anything they reference is added.
+//	Archives saved by older releases carry no version header, and are still loaded the way they always were.
+//
+//	Before loading, each archive is checked against the haul manifest written beside it.  With --key the manifest must
+//	be signed by the key and the archive must match the digest it records, otherwise the archive is refused.  Without
+//	--key, a signed archive is refused since its signature can't be checked, while an archive with an unsigned
+//	manifest is still checked against its digest.  --insecure-skip-verify skips all of this.
+//
+//	Archives encrypted by 'hauler store save --encrypt' are decrypted with --identity or the passphrase, once verified.
+func LoadCmd(ctx context.Context, o *LoadOpts, s *store.Layout, archiveRefs ...string) error {
 	l := log.FromContext(ctx)
 
+	end, err := o.beginProgress(ctx, "load")
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	var opts []store.CopyOption
+	if o.Verbose {
+		opts = append(opts, store.WithVerbose())
+	}
+	identities, err := o.identities()
+	if err != nil {
+		return err
+	}
+
 	for _, archiveRef := range archiveRefs {
 		l.Infof("loading content from [%s] to [%s]", archiveRef, o.StoreDir)
-		err := unarchiveLayoutTo(ctx, archiveRef, o.StoreDir, o.TempOverride)
+		if err := verifyHaul(ctx, o, archiveRef); err != nil {
+			return fmt.Errorf("verifying [%s]: %w", archiveRef, err)
+		}
+		err := loadArchive(ctx, s, archiveRef, identities)
+		if errors.Is(err, store.ErrUnversionedArchive) {
+			l.Warnf("[%s] has no version header and can't be verified, loading it as a legacy archive", archiveRef)
+			var loaded []ocispec.Descriptor
+			loaded, err = unarchiveLayoutTo(ctx, archiveRef, o.StoreDir, o.TempOverride, opts...)
+			if err == nil {
+				err = s.Audit(store.AuditLoad, loaded...)
+			}
+		}
+		if errors.Is(err, store.ErrEncryptedArchive) {
+			return fmt.Errorf("loading [%s]: %w, pass --identity or --passphrase-file to decrypt it", archiveRef, err)
+		}
+		if errors.Is(err, store.ErrIncompleteDelta) {
+			return fmt.Errorf("loading [%s]: %w, load the haul it was built from first", archiveRef, err)
+		}
 		if err != nil {
+			return fmt.Errorf("loading [%s]: %w", archiveRef, err)
+		}
+	}
+
+	return nil
+}
+
+// verifyHaul checks the archive archiveRef against the haul manifest written beside it, and the manifest against its
+// signature
+func verifyHaul(ctx context.Context, o *LoadOpts, archiveRef string) error {
+	l := log.FromContext(ctx)
+
+	if o.InsecureSkipVerify {
+		l.Warnf("skipping verification of [%s]", archiveRef)
+		return nil
+	}
+
+	manifestPath := strings.TrimSuffix(archiveRef, store.SegmentManifestSuffix) + store.HaulManifestSuffix
+	sigPath := manifestPath + store.HaulSignatureSuffix
+	_, err := os.Stat(sigPath)
+	signed := err == nil
+
+	switch {
+	case o.Key != "":
+		if !signed {
+			return fmt.Errorf("no signature [%s] to verify, pass --insecure-skip-verify to load it anyway", sigPath)
+		}
+		if err := cosign.VerifyBlob(ctx, o.Key, manifestPath, sigPath); err != nil {
 			return err
 		}
+		l.Infof("signature verified for haul manifest [%s]", manifestPath)
+	case signed:
+		return fmt.Errorf("[%s] is signed, pass --key to verify it or --insecure-skip-verify to load it anyway", manifestPath)
+	default:
+		if _, err := os.Stat(manifestPath); errors.Is(err, os.ErrNotExist) {
+			l.Warnf("[%s] has no haul manifest and can't be verified", archiveRef)
+			return nil
+		}
+	}
+
+	m, err := readHaulManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	if m.Archive == nil && o.Key == "" {
+		l.Warnf("haul manifest [%s] does not record its archive, [%s] can't be verified", manifestPath, archiveRef)
+		return nil
 	}
 
+	f, err := openArchive(archiveRef)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := m.VerifyArchive(f); err != nil {
+		return err
+	}
+	l.Infof("archive [%s] matches its haul manifest", archiveRef)
 	return nil
 }
 
-// unarchiveLayoutTo accepts an archived oci layout and extracts the contents to an existing oci layout, preserving the index
-func unarchiveLayoutTo(ctx context.Context, archivePath string, dest string, tempOverride string) error {
-	tmpdir, err := os.MkdirTemp(tempOverride, "hauler")
+func loadArchive(ctx context.Context, s *store.Layout, archiveRef string, identities []age.Identity) error {
+	l := log.FromContext(ctx)
+	start := time.Now()
+
+	f, err := openArchive(archiveRef)
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(tmpdir)
+	defer f.Close()
 
-	if err := archiver.Unarchive(archivePath, tmpdir); err != nil {
+	// progress is that of the archive as it's read, the size of a segmented archive isn't known up front
+	var size int64
+	if fi, err := os.Stat(archiveRef); err == nil && !strings.HasSuffix(archiveRef, store.SegmentManifestSuffix) {
+		size = fi.Size()
+	}
+	task := progress.FromContext(ctx).Track(archiveRef, size)
+	defer task.Done()
+
+	cr := &countingReader{r: task.Reader(f)}
+	r, err := store.Decrypt(cr, identities...)
+	if err != nil {
 		return err
 	}
+	loaded, err := s.Load(ctx, r)
+	if err != nil {
+		return err
+	}
+	l.With(archiveFields(archiveRef, cr.n, "", start)).Infof("loaded [%d] references from [%s]", len(loaded), archiveRef)
+	return nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// openArchive opens a single archive, or reassembles a segmented one from its segment manifest
+//
+//	A segmented archive may be referred to by its manifest, or by the name it was saved as
+func openArchive(archiveRef string) (io.ReadCloser, error) {
+	if strings.HasSuffix(archiveRef, store.SegmentManifestSuffix) {
+		return store.OpenSegments(archiveRef)
+	}
+	if _, err := os.Stat(archiveRef); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(archiveRef + store.SegmentManifestSuffix); err == nil {
+			return store.OpenSegments(archiveRef + store.SegmentManifestSuffix)
+		}
+	}
+	return os.Open(archiveRef)
+}
+
+// unarchiveLayoutTo accepts an archived oci layout and extracts the contents to an existing oci layout, preserving the
+// index, returning the references copied
+func unarchiveLayoutTo(ctx context.Context, archivePath string, dest string, tempOverride string, opts ...store.CopyOption) ([]ocispec.Descriptor, error) {
+	tmpdir, cleanup, err := staging.Dir(ctx, tempOverride, "layout")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	if err := archiver.Unarchive(archivePath, tmpdir); err != nil {
+		return nil, err
+	}
 
 	s, err := store.NewLayout(tmpdir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ts, err := content.NewOCI(dest)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = s.CopyAll(ctx, ts, nil)
-	return err
+	return s.CopyAll(ctx, ts, nil, opts...)
 }
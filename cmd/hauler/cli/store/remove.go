@@ -0,0 +1,31 @@
+package store
+
+import (
+	"context"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/store"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+type RemoveOpts struct {
+	*RootOpts
+}
+
+func RemoveCmd(ctx context.Context, o *RemoveOpts, s *store.Layout, refs ...string) error {
+	l := log.FromContext(ctx)
+
+	for _, ref := range refs {
+		removed, err := s.RemoveArtifact(ctx, ref)
+		if err != nil {
+			return err
+		}
+
+		for _, desc := range removed {
+			l.Infof("removed [%s] (%s) from the store", desc.Annotations[ocispec.AnnotationRefName], s.Identify(ctx, desc))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+
+	"github.com/rancherfederal/hauler/pkg/store"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+type RepairOpts struct {
+	*RootOpts
+
+	DryRun bool
+}
+
+func (o *RepairOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.BoolVar(&o.DryRun, "dry-run", false, "Report the dangling references without dropping them")
+}
+
+// RepairCmd drops the references of the store to blobs that never landed, such as those left by a process killed
+// mid-add
+func RepairCmd(ctx context.Context, o *RepairOpts, s *store.Layout) error {
+	l := log.FromContext(ctx)
+
+	var dangling []store.DanglingReference
+	var err error
+	if o.DryRun {
+		dangling, err = s.Dangling(ctx)
+	} else {
+		dangling, err = s.Repair(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, d := range dangling {
+		ref := d.Descriptor.Annotations[ocispec.AnnotationRefName]
+		if o.DryRun {
+			l.Infof("would drop dangling reference [%s]: %v", ref, d.Err)
+			continue
+		}
+		l.Warnf("dropped dangling reference [%s]: %v", ref, d.Err)
+	}
+
+	switch {
+	case len(dangling) == 0:
+		l.Infof("store [%s] has no dangling references", s.Root)
+	case o.DryRun:
+		l.Infof("%d dangling references", len(dangling))
+	default:
+		l.Infof("dropped %d dangling references, run 'hauler store gc' to delete the blobs they left behind", len(dangling))
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rancherfederal/hauler/pkg/report"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+// failureReport is the machine readable summary of the items a command continuing on error failed on
+type failureReport struct {
+	Failures []failure `json:"failures"`
+	Total    int       `json:"total"`
+}
+
+type failure struct {
+	Kind      string `json:"kind,omitempty"`
+	Reference string `json:"reference"`
+	Error     string `json:"error"`
+}
+
+// add records err as the failure of the item kind referenced by ref, expanding the failures of a collection into one
+// per reference
+func (r *failureReport) add(kind string, ref string, err error) {
+	r.Failures = append(r.Failures, failuresOf(kind, ref, err)...)
+}
+
+// failuresOf returns err as the failures of the item kind referenced by ref, one per reference of a collection
+func failuresOf(kind string, ref string, err error) []failure {
+	var failures []failure
+
+	var aerr *store.AddCollectionError
+	if errors.As(err, &aerr) {
+		for _, f := range aerr.Failures {
+			failures = append(failures, failure{Kind: kind, Reference: f.Reference, Error: f.Err.Error()})
+		}
+		return failures
+	}
+
+	var cerr *store.CopyAllError
+	if errors.As(err, &cerr) {
+		for _, f := range cerr.Failures {
+			failures = append(failures, failure{Kind: kind, Reference: f.Reference, Error: f.Err.Error()})
+		}
+		return failures
+	}
+
+	return append(failures, failure{Kind: kind, Reference: ref, Error: err.Error()})
+}
+
+// recordFailure records err as the failure of the item kind referenced by ref in the run report of ctx
+func recordFailure(ctx context.Context, kind string, ref string, err error) {
+	r := report.FromContext(ctx)
+	if r == nil {
+		return
+	}
+	for _, f := range failuresOf(kind, ref, err) {
+		r.Record(report.Entry{Kind: f.Kind, Reference: f.Reference, Status: report.StatusFailed, Error: f.Error})
+	}
+}
+
+// write writes the report as json to path, or to stderr when path is empty
+func (r *failureReport) write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if path == "" {
+		_, err = os.Stderr.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing error report: %w", err)
+	}
+	return nil
+}
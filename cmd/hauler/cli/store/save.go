@@ -2,54 +2,388 @@ package store
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/mholt/archiver/v3"
+	"filippo.io/age"
+	"github.com/opencontainers/go-digest"
 	"github.com/spf13/cobra"
 
+	"github.com/rancherfederal/hauler/pkg/cosign"
+	"github.com/rancherfederal/hauler/pkg/report"
+	"github.com/rancherfederal/hauler/pkg/staging"
+	"github.com/rancherfederal/hauler/pkg/store"
+
 	"github.com/rancherfederal/hauler/pkg/log"
 )
 
 type SaveOpts struct {
 	*RootOpts
-	FileName string
+	FileName       string
+	MaxSegmentSize string
+	DeltaFrom      string
+	Key            string
+	Encrypt        bool
+	Recipients     []string
+	PassphraseFile string
 }
 
+// passphraseEnv is the environment variable an archive's passphrase is read from when no passphrase file is given
+const passphraseEnv = "HAULER_ARCHIVE_PASSPHRASE"
+
 func (o *SaveOpts) AddArgs(cmd *cobra.Command) {
 	f := cmd.Flags()
 
-	f.StringVarP(&o.FileName, "filename", "f", "haul.tar.zst", "Name of archive")
+	f.StringVarP(&o.FileName, "filename", "f", "haul.tar.zst", "Name of archive, compressed according to its extension (.tar.zst, .tar.gz, or .tar), or an s3://bucket/key to upload it to")
+	f.StringVar(&o.MaxSegmentSize, "max-segment-size", "", "(Optional) Split the archive into numbered segments of at most this size, i.e. 4GB or 700MiB, described by <filename>"+store.SegmentManifestSuffix)
+	f.StringVar(&o.DeltaFrom, "delta-from", "", "(Optional) Only include blobs missing from a previous haul, given the <filename>"+store.HaulManifestSuffix+" written beside it")
+	f.StringVarP(&o.Key, "key", "k", "", "(Optional) Path to the cosign private key to sign the haul manifest with, written beside it as <filename>"+store.HaulManifestSuffix+store.HaulSignatureSuffix+" for 'hauler store load --key' to verify")
+	f.BoolVar(&o.Encrypt, "encrypt", false, "(Optional) Encrypt the archive with age, for the --recipient keys or with a passphrase read from --passphrase-file or "+passphraseEnv)
+	f.StringSliceVar(&o.Recipients, "recipient", []string{}, "(Optional) age public key, or path to a file of them, to encrypt the archive for with --encrypt. i.e. 'age1...'")
+	f.StringVar(&o.PassphraseFile, "passphrase-file", "", "(Optional) Path to a file holding the passphrase to encrypt the archive with using --encrypt")
+	cmd.MarkFlagsMutuallyExclusive("recipient", "passphrase-file")
+	o.AddProgressFlags(cmd)
+	o.AddReportFlags(cmd)
+}
+
+// recipients returns who the archive is encrypted for, or nothing when it isn't to be encrypted
+func (o *SaveOpts) recipients() ([]age.Recipient, error) {
+	if !o.Encrypt {
+		if len(o.Recipients) > 0 || o.PassphraseFile != "" {
+			return nil, errors.New("--recipient and --passphrase-file require --encrypt")
+		}
+		return nil, nil
+	}
+	if len(o.Recipients) > 0 {
+		return store.ParseRecipients(o.Recipients...)
+	}
+
+	passphrase, err := readPassphrase(o.PassphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("--encrypt requires --recipient, --passphrase-file, or a passphrase in %s", passphraseEnv)
+	}
+	r, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return []age.Recipient{r}, nil
+}
+
+// readPassphrase reads the passphrase of an archive from path, or from the environment when path is empty
+func readPassphrase(path string) (string, error) {
+	if path == "" {
+		return os.Getenv(passphraseEnv), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
 }
 
-// SaveCmd
-// TODO: Just use mholt/archiver for now, even though we don't need most of it
-func SaveCmd(ctx context.Context, o *SaveOpts, outputFile string) error {
+// SaveCmd writes the store to a single archive, saving the same content always produces an identical archive
+//
+//	A manifest of everything in the store is written beside the archive, so a later save can use it with --delta-from
+//	to package only the content added since.  The manifest records the digest of the archive, so signing it with --key
+//	lets 'hauler store load' verify the archive wasn't tampered with on its way.
+//
+//	With --encrypt, the compressed archive is encrypted with age, either for the recipients' public keys or with a
+//	passphrase.  The manifest isn't encrypted: it records the encrypted archive, so the archive can be verified before
+//	anything is decrypted, but still lists every reference saved.  Encrypted archives differ on every save.
+func SaveCmd(ctx context.Context, o *SaveOpts, s *store.Layout, outputFile string) (err error) {
 	l := log.FromContext(ctx)
+	start := time.Now()
+
+	end, err := o.beginProgress(ctx, "save")
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	ctx, finish := o.beginReport(ctx, "save")
+	defer func() { err = finish(err) }()
+
+	compression, err := store.CompressionFromName(outputFile)
+	if err != nil {
+		return err
+	}
+	recipients, err := o.recipients()
+	if err != nil {
+		return err
+	}
 
-	// TODO: Support more formats?
-	a := archiver.NewTarZstd()
-	a.OverwriteExisting = true
+	sopts := []store.SaveOption{store.WithCompression(compression)}
+	if o.DeltaFrom != "" {
+		base, err := readHaulManifest(o.DeltaFrom)
+		if err != nil {
+			return err
+		}
+		sopts = append(sopts, store.WithDeltaFrom(base))
+		l.Infof("saving only content missing from [%s]", o.DeltaFrom)
+	}
+
+	// the manifest describes the whole store, so deltas can be chained one after another
+	manifest, err := s.Manifest(ctx)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(outputFile, "s3://") {
+		if o.MaxSegmentSize != "" {
+			return errors.New("--max-segment-size can't be used saving to s3://, object storage takes objects of any size")
+		}
+		return saveToS3(ctx, o, s, outputFile, manifest, recipients, sopts...)
+	}
 
 	absOutputfile, err := filepath.Abs(outputFile)
 	if err != nil {
 		return err
 	}
 
-	cwd, err := os.Getwd()
+	size, err := s.SaveSize(ctx, sopts...)
+	if err != nil {
+		return err
+	}
+	if err := o.checkSpace(ctx, filepath.Dir(absOutputfile), size); err != nil {
+		return err
+	}
+
+	if o.MaxSegmentSize != "" {
+		m, err := saveSegments(ctx, o, s, absOutputfile, recipients, sopts...)
+		if err != nil {
+			return err
+		}
+		manifest.Archive = &store.ArchiveFile{Name: m.Archive, Size: m.Size, Digest: m.Digest}
+		if err := recordSaved(ctx, s, absOutputfile+store.SegmentManifestSuffix, manifest.Archive, start); err != nil {
+			return err
+		}
+		return writeHaulManifest(ctx, o, absOutputfile, manifest)
+	}
+
+	// write beside the destination and rename into place, so a failed save never leaves a truncated archive behind
+	f, err := os.CreateTemp(filepath.Dir(absOutputfile), filepath.Base(absOutputfile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	digester := digest.Canonical.Digester()
+	cw := &countingWriter{w: io.MultiWriter(f, digester.Hash())}
+	if err := saveTo(ctx, s, cw, recipients, sopts...); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), absOutputfile); err != nil {
+		return err
+	}
+
+	l.With(archiveFields(absOutputfile, cw.n, digester.Digest(), start)).Infof("saved store [%s] -> [%s]", o.StoreDir, absOutputfile)
+	if len(recipients) > 0 {
+		l.Infof("encrypted [%s] for [%d] recipients", absOutputfile, len(recipients))
+	}
+	manifest.Archive = &store.ArchiveFile{Name: filepath.Base(absOutputfile), Size: cw.n, Digest: digester.Digest()}
+	if err := recordSaved(ctx, s, absOutputfile, manifest.Archive, start); err != nil {
+		return err
+	}
+	return writeHaulManifest(ctx, o, absOutputfile, manifest)
+}
+
+// saveToS3 streams the archive to the object of an s3:// target, with its manifest beside it
+//
+//	The archive is uploaded in parts as it's written, never touching the disk.  Saving the same content produces an
+//	identical archive, so saving again after a failure resumes the upload, only uploading the parts it's missing.
+func saveToS3(ctx context.Context, o *SaveOpts, s *store.Layout, target string, manifest store.HaulManifest, recipients []age.Recipient, opts ...store.SaveOption) error {
+	l := log.FromContext(ctx)
+	start := time.Now()
+
+	i := strings.LastIndex(target, "/")
+	prefix, name := target[:i], target[i+1:]
+	if name == "" || prefix == "s3:/" {
+		return fmt.Errorf("[%s] names no object, i.e. s3://bucket/haul.tar.zst", target)
+	}
+	c, err := newS3Client(s, prefix)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	digester := digest.Canonical.Digester()
+	cw := &countingWriter{w: io.MultiWriter(pw, digester.Hash())}
+	go func() {
+		pw.CloseWithError(saveTo(ctx, s, cw, recipients, opts...))
+	}()
+	if err := c.Write(ctx, name, pr); err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	l.With(archiveFields(target, cw.n, digester.Digest(), start)).Infof("saved store [%s] -> [%s]", o.StoreDir, target)
+	if len(recipients) > 0 {
+		l.Infof("encrypted [%s] for [%d] recipients", target, len(recipients))
+	}
+
+	// the manifest is written and signed locally, then uploaded beside the archive
+	tmp, cleanup, err := staging.Dir(ctx, "", "manifest")
 	if err != nil {
 		return err
 	}
-	defer os.Chdir(cwd)
-	if err := os.Chdir(o.StoreDir); err != nil {
+	defer cleanup()
+
+	manifest.Archive = &store.ArchiveFile{Name: name, Size: cw.n, Digest: digester.Digest()}
+	if err := recordSaved(ctx, s, target, manifest.Archive, start); err != nil {
+		return err
+	}
+	if err := writeHaulManifest(ctx, o, filepath.Join(tmp, name), manifest); err != nil {
 		return err
 	}
+	files := []string{name + store.HaulManifestSuffix}
+	if o.Key != "" {
+		files = append(files, name+store.HaulManifestSuffix+store.HaulSignatureSuffix)
+	}
+	for _, file := range files {
+		f, err := os.Open(filepath.Join(tmp, file))
+		if err != nil {
+			return err
+		}
+		err = c.Write(ctx, file, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		l.Infof("uploaded [%s]", prefix+"/"+file)
+	}
+	return nil
+}
+
+// saveTo saves the store to w, encrypting it for recipients when there are any
+func saveTo(ctx context.Context, s *store.Layout, w io.Writer, recipients []age.Recipient, opts ...store.SaveOption) error {
+	if len(recipients) == 0 {
+		return s.Save(ctx, w, opts...)
+	}
 
-	err = a.Archive([]string{"."}, absOutputfile)
+	ew, err := store.Encrypt(w, recipients...)
 	if err != nil {
 		return err
 	}
+	if err := s.Save(ctx, ew, opts...); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func readHaulManifest(path string) (store.HaulManifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return store.HaulManifest{}, err
+	}
+	defer f.Close()
+
+	return store.ReadHaulManifest(f)
+}
+
+// writeHaulManifest writes m beside the archive, signing it when a key was given
+// recordSaved records every reference of the store in the run report of ctx, along with the archive at path they were
+// saved to
+func recordSaved(ctx context.Context, s *store.Layout, path string, archive *store.ArchiveFile, start time.Time) error {
+	r := report.FromContext(ctx)
+	if r == nil {
+		return nil
+	}
 
-	l.Infof("saved store [%s] -> [%s]", o.StoreDir, absOutputfile)
+	artifacts, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, a := range artifacts {
+		r.Record(report.Entry{
+			Kind:      a.Kind,
+			Reference: a.Reference,
+			Digest:    a.Digest.String(),
+			Size:      a.Size,
+			Status:    report.StatusSucceeded,
+		})
+	}
+	r.SetArchive(report.Entry{
+		Reference: path,
+		Digest:    archive.Digest.String(),
+		Size:      archive.Size,
+		Duration:  time.Since(start),
+		Status:    report.StatusSucceeded,
+	})
 	return nil
 }
+
+func writeHaulManifest(ctx context.Context, o *SaveOpts, absOutputfile string, m store.HaulManifest) error {
+	l := log.FromContext(ctx)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := absOutputfile + store.HaulManifestSuffix
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	l.Infof("wrote haul manifest [%s]", path)
+
+	if o.Key == "" {
+		return nil
+	}
+	if err := cosign.SignBlob(ctx, o.Key, path, path+store.HaulSignatureSuffix); err != nil {
+		return err
+	}
+	l.Infof("signed haul manifest [%s]", path+store.HaulSignatureSuffix)
+	return nil
+}
+
+func saveSegments(ctx context.Context, o *SaveOpts, s *store.Layout, absOutputfile string, recipients []age.Recipient, opts ...store.SaveOption) (store.SegmentManifest, error) {
+	l := log.FromContext(ctx)
+	start := time.Now()
+
+	maxSize, err := store.ParseSize(o.MaxSegmentSize)
+	if err != nil {
+		return store.SegmentManifest{}, err
+	}
+
+	sw, err := store.NewSegmentWriter(filepath.Dir(absOutputfile), filepath.Base(absOutputfile), maxSize)
+	if err != nil {
+		return store.SegmentManifest{}, err
+	}
+	if err := saveTo(ctx, s, sw, recipients, opts...); err != nil {
+		sw.Abort()
+		return store.SegmentManifest{}, err
+	}
+	m, err := sw.Close()
+	if err != nil {
+		return store.SegmentManifest{}, err
+	}
+
+	for _, seg := range m.Segments {
+		l.Infof("wrote segment [%s] (%d bytes, %s)", seg.Name, seg.Size, seg.Digest)
+	}
+	l.With(archiveFields(absOutputfile+store.SegmentManifestSuffix, m.Size, m.Digest, start)).Infof("saved store [%s] -> [%s] in [%d] segments", o.StoreDir, absOutputfile+store.SegmentManifestSuffix, len(m.Segments))
+	return m, nil
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/sbom"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+type SbomOpts struct {
+	*RootOpts
+
+	Format    string
+	Dir       string
+	Name      string
+	Aggregate bool
+}
+
+func (o *SbomOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.StringVarP(&o.Format, "format", "f", string(sbom.FormatSPDX), "Format of the sboms (spdx-json, cyclonedx-json)")
+	f.StringVarP(&o.Dir, "dir", "d", "sboms", "Directory to write the sboms to")
+	f.StringVar(&o.Name, "name", "hauler-store", "Name of the aggregate sbom of every image")
+	f.BoolVar(&o.Aggregate, "aggregate", true, "Also write a single sbom of every image")
+}
+
+func SbomCmd(ctx context.Context, o *SbomOpts, s *store.Layout, refs ...string) error {
+	l := log.FromContext(ctx)
+
+	format, err := sbom.ParseFormat(o.Format)
+	if err != nil {
+		return err
+	}
+
+	if len(refs) == 0 {
+		if refs, err = sbom.Images(ctx, s); err != nil {
+			return err
+		}
+		if len(refs) == 0 {
+			l.Warnf("no images in store [%s]", s.Root)
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(o.Dir, 0755); err != nil {
+		return err
+	}
+
+	var all []sbom.Image
+	for _, ref := range refs {
+		images, err := sbom.Catalog(ctx, s, ref)
+		if err != nil {
+			return fmt.Errorf("cataloging [%s]: %w", ref, err)
+		}
+
+		var packages int
+		for _, img := range images {
+			packages += len(img.Packages)
+		}
+		name := images[0].Reference
+		path := filepath.Join(o.Dir, sbomFileName(name)+format.Extension())
+		if err := writeSbom(path, format, name, images); err != nil {
+			return err
+		}
+		l.Infof("wrote sbom of [%s] with [%d] packages across [%d] platforms to [%s]", name, packages, len(images), path)
+		all = append(all, images...)
+	}
+
+	if o.Aggregate {
+		path := filepath.Join(o.Dir, sbomFileName(o.Name)+format.Extension())
+		if err := writeSbom(path, format, o.Name, all); err != nil {
+			return err
+		}
+		l.Infof("wrote sbom of [%d] images to [%s]", len(refs), path)
+	}
+	return nil
+}
+
+func writeSbom(path string, format sbom.Format, name string, images []sbom.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := sbom.Write(f, format, name, images); err != nil {
+		f.Close()
+		return fmt.Errorf("writing sbom [%s]: %w", path, err)
+	}
+	return f.Close()
+}
+
+// sbomFileName flattens a reference into a name that can be used as a file name
+func sbomFileName(ref string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(ref)
+}
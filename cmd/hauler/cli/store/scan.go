@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/sbom"
+	"github.com/rancherfederal/hauler/pkg/scan"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+type ScanOpts struct {
+	*RootOpts
+
+	Scanner      string
+	ScannerPath  string
+	Severity     string
+	OutputFormat string
+}
+
+func (o *ScanOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.StringVar(&o.Scanner, "scanner", "trivy", "Scanner to scan images with (trivy, grype)")
+	f.StringVar(&o.ScannerPath, "scanner-path", "", "Path to the scanner binary, instead of finding it on the PATH")
+	f.StringVar(&o.Severity, "severity", "", "Fail when a vulnerability of this severity or higher is found (low, medium, high, critical)")
+	f.StringVarP(&o.OutputFormat, "output", "o", "table", "Output format (table, json)")
+}
+
+func ScanCmd(ctx context.Context, o *ScanOpts, s *store.Layout, refs ...string) error {
+	l := log.FromContext(ctx)
+
+	sc, err := scan.New(o.Scanner, o.ScannerPath)
+	if err != nil {
+		return err
+	}
+	threshold := scan.SeverityUnknown
+	if o.Severity != "" {
+		if threshold, err = scan.ParseSeverity(o.Severity); err != nil {
+			return err
+		}
+	}
+	if o.OutputFormat != "table" && o.OutputFormat != "json" {
+		return fmt.Errorf("output format must be one of [table json], got [%s]", o.OutputFormat)
+	}
+
+	if len(refs) == 0 {
+		if refs, err = sbom.Images(ctx, s); err != nil {
+			return err
+		}
+		if len(refs) == 0 {
+			l.Warnf("no images in store [%s]", s.Root)
+			return nil
+		}
+	}
+
+	results := []scan.Result{}
+	var failing int
+	for _, ref := range refs {
+		l.Infof("scanning [%s] with %s", ref, sc.Name())
+		r, err := scan.Scan(ctx, sc, s, ref)
+		if err != nil {
+			return err
+		}
+		results = append(results, r)
+		if o.Severity != "" {
+			failing += len(r.AtLeast(threshold))
+		}
+	}
+
+	switch o.OutputFormat {
+	case "json":
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	default:
+		buildScanTable(results)
+	}
+
+	if failing > 0 {
+		return fmt.Errorf("found [%d] vulnerabilities of severity [%s] or higher", failing, threshold)
+	}
+	return nil
+}
+
+func buildScanTable(results []scan.Result) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Reference", "Vulnerability", "Severity", "Package", "Version", "Fixed Version"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetRowLine(false)
+	table.SetAutoMergeCellsByColumnIndex([]int{0})
+
+	total := 0
+	for _, r := range results {
+		for _, v := range r.Vulnerabilities {
+			table.Append([]string{r.Reference, v.ID, v.Severity.String(), v.Package, v.Version, v.FixedVersion})
+		}
+		total += len(r.Vulnerabilities)
+	}
+	table.SetFooter([]string{"", "", "", "", "Total", fmt.Sprintf("%d", total)})
+
+	table.Render()
+}
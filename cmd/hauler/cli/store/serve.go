@@ -5,27 +5,128 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 
 	"github.com/distribution/distribution/v3/configuration"
 	dcontext "github.com/distribution/distribution/v3/context"
+	_ "github.com/distribution/distribution/v3/registry/auth/htpasswd"
 	_ "github.com/distribution/distribution/v3/registry/storage/driver/base"
 	_ "github.com/distribution/distribution/v3/registry/storage/driver/filesystem"
 	_ "github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
 	"github.com/distribution/distribution/v3/version"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/opencontainers/go-digest"
 	"github.com/spf13/cobra"
 
 	"github.com/rancherfederal/hauler/pkg/store"
 
 	"github.com/rancherfederal/hauler/internal/server"
+	"github.com/rancherfederal/hauler/pkg/cosign"
 	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/staging"
 )
 
+// TLSOpts are the flags serving over https, with a certificate of the user's own or a self-signed one
+type TLSOpts struct {
+	Cert       string
+	Key        string
+	SelfSigned bool
+	Dir        string
+	Hosts      []string
+}
+
+func (o *TLSOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.StringVar(&o.Cert, "tls-cert", "", "(Optional) Path to a TLS certificate to serve over https with")
+	f.StringVar(&o.Key, "tls-key", "", "(Optional) Path to the private key of --tls-cert")
+	f.BoolVar(&o.SelfSigned, "tls-self-signed", false, "(Optional) Serve over https with a self-signed certificate, written to --tls-dir along with the CA to trust it by")
+	f.StringVar(&o.Dir, "tls-dir", "tls", "(Optional) Directory to write the self-signed certificate and CA to, an existing CA in it is reused")
+	f.StringSliceVar(&o.Hosts, "tls-hosts", nil, "(Optional) Hostnames and IPs the self-signed certificate is valid for. Defaults to the hostname and the IPs of the host")
+	cmd.MarkFlagsRequiredTogether("tls-cert", "tls-key")
+	cmd.MarkFlagsMutuallyExclusive("tls-self-signed", "tls-cert")
+}
+
+// config returns the certificate and key to serve with, generating a self-signed one if requested
+func (o *TLSOpts) config(ctx context.Context) (server.TLSConfig, error) {
+	l := log.FromContext(ctx)
+
+	if !o.SelfSigned {
+		cfg := server.TLSConfig{CertFile: o.Cert, KeyFile: o.Key}
+		if cfg.Enabled() {
+			if _, err := cfg.Load(); err != nil {
+				return server.TLSConfig{}, err
+			}
+		}
+		return cfg, nil
+	}
+
+	hosts := o.Hosts
+	if len(hosts) == 0 {
+		var err error
+		if hosts, err = server.DefaultHosts(); err != nil {
+			return server.TLSConfig{}, err
+		}
+	}
+	cfg, err := server.GenerateSelfSigned(o.Dir, hosts)
+	if err != nil {
+		return server.TLSConfig{}, fmt.Errorf("generating self-signed certificate: %w", err)
+	}
+	l.Infof("generated self-signed certificate for %v, trust [%s] on the nodes pulling from this server", hosts, filepath.Join(o.Dir, server.CAFileName))
+	return cfg, nil
+}
+
+// AuthOpts are the flags requiring basic auth of the users of an htpasswd file, or of a single user
+type AuthOpts struct {
+	HtpasswdFile string
+	Username     string
+	Password     string
+}
+
+func (o *AuthOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.StringVar(&o.HtpasswdFile, "htpasswd-file", "", "(Optional) Path to an htpasswd file of bcrypt hashed users allowed to pull, as used by distribution")
+	f.StringVar(&o.Username, "username", "", "(Optional) Username of the only user allowed to pull")
+	f.StringVar(&o.Password, "password", "", "(Optional) Password of --username")
+	cmd.MarkFlagsRequiredTogether("username", "password")
+	cmd.MarkFlagsMutuallyExclusive("htpasswd-file", "username")
+}
+
+// htpasswd returns the path to the htpasswd file of the users allowed to pull, or "" when serving anonymously
+//
+//	A single user is written to an htpasswd file in a temporary directory, removed by the returned cleanup.
+func (o *AuthOpts) htpasswd(ctx context.Context) (string, func(), error) {
+	noop := func() {}
+	if o.Username == "" {
+		return o.HtpasswdFile, noop, nil
+	}
+
+	dir, cleanup, err := staging.Dir(ctx, "", "auth")
+	if err != nil {
+		return "", noop, err
+	}
+
+	path := filepath.Join(dir, "htpasswd")
+	if err := server.WriteHtpasswd(path, o.Username, o.Password); err != nil {
+		cleanup()
+		return "", noop, err
+	}
+	return path, cleanup, nil
+}
+
 type ServeRegistryOpts struct {
 	*RootOpts
+	TLS  TLSOpts
+	Auth AuthOpts
 
-	Port       int
-	RootDir    string
-	ConfigFile string
+	Port        int
+	RootDir     string
+	ConfigFile  string
+	ReadOnly    bool
+	Upstream    string
+	Metrics     bool
+	MetricsPort int
 
 	storedir string
 }
@@ -36,18 +137,62 @@ func (o *ServeRegistryOpts) AddFlags(cmd *cobra.Command) {
 	f.IntVarP(&o.Port, "port", "p", 5000, "Port to listen on.")
 	f.StringVar(&o.RootDir, "directory", "registry", "Directory to use for backend.  Defaults to $PWD/registry")
 	f.StringVarP(&o.ConfigFile, "config", "c", "", "Path to a config file, will override all other configs")
+	f.BoolVar(&o.ReadOnly, "readonly", false, "Serve the store as a read-only registry straight from its content, without copying it to a registry backend first")
+	cmd.MarkFlagsMutuallyExclusive("readonly", "config")
+	cmd.MarkFlagsMutuallyExclusive("readonly", "directory")
+	f.StringVar(&o.Upstream, "upstream", "", "(Optional) Registry to pull content missing from the store through, caching it into the store. Implies --readonly")
+	cmd.MarkFlagsMutuallyExclusive("upstream", "config")
+	cmd.MarkFlagsMutuallyExclusive("upstream", "directory")
+	f.BoolVar(&o.Metrics, "metrics", false, "(Optional) Serve prometheus metrics at /metrics")
+	f.IntVar(&o.MetricsPort, "metrics-port", 5001, "(Optional) Port to serve metrics on when the registry is backed by a copy of the store. The read-only registry serves them on --port")
+	o.TLS.AddFlags(cmd)
+	o.Auth.AddFlags(cmd)
 }
 
 func ServeRegistryCmd(ctx context.Context, o *ServeRegistryOpts, s *store.Layout) error {
 	l := log.FromContext(ctx)
 	ctx = dcontext.WithVersion(ctx, version.Version)
 
+	tlsCfg, err := o.TLS.config(ctx)
+	if err != nil {
+		return err
+	}
+
+	htpasswd, cleanup, err := o.Auth.htpasswd(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if o.ReadOnly || o.Upstream != "" {
+		cfg := server.StoreRegistryConfig{Port: o.Port, TLS: tlsCfg}
+		if o.Metrics {
+			cfg.Metrics = server.NewMetrics()
+		}
+		if htpasswd != "" {
+			if cfg.Htpasswd, err = server.LoadHtpasswd(htpasswd); err != nil {
+				return err
+			}
+		}
+
+		if o.Upstream == "" {
+			l.Infof("starting read-only registry of store [%s] on port [%d]", s.Root, o.Port)
+			return serve(ctx, server.NewStoreRegistry(s, cfg))
+		}
+
+		if cfg.Upstream, err = upstreamCache(ctx, s, o.Upstream); err != nil {
+			return err
+		}
+		l.Infof("starting registry of store [%s] caching from [%s] on port [%d]", s.Root, o.Upstream, o.Port)
+		return serve(ctx, server.NewStoreRegistry(s, cfg))
+	}
+
 	tr := server.NewTempRegistry(ctx, o.RootDir)
 	if err := tr.Start(); err != nil {
 		return err
 	}
 
-	opts := &CopyOpts{}
+	opts := newCopyOpts(o.RootOpts)
 	if err := CopyCmd(ctx, opts, s, "registry://"+tr.Registry()); err != nil {
 		return err
 	}
@@ -62,6 +207,26 @@ func ServeRegistryCmd(ctx context.Context, o *ServeRegistryOpts, s *store.Layout
 		}
 		cfg = ucfg
 	}
+	if tlsCfg.Enabled() {
+		cfg.HTTP.TLS.Certificate = tlsCfg.CertFile
+		cfg.HTTP.TLS.Key = tlsCfg.KeyFile
+	}
+	if htpasswd != "" {
+		// validate up front, distribution would otherwise create a missing file with a random password of its own
+		if _, err := server.LoadHtpasswd(htpasswd); err != nil {
+			return err
+		}
+		cfg.Auth = configuration.Auth{
+			"htpasswd": configuration.Parameters{"realm": "hauler", "path": htpasswd},
+		}
+	}
+	if o.Metrics {
+		// distribution serves its own metrics from its debug server rather than the registry's port
+		cfg.HTTP.Debug.Addr = fmt.Sprintf(":%d", o.MetricsPort)
+		cfg.HTTP.Debug.Prometheus.Enabled = true
+		cfg.HTTP.Debug.Prometheus.Path = server.MetricsPath
+		l.Infof("serving metrics on port [%d]", o.MetricsPort)
+	}
 
 	l.Infof("starting registry on port [%d]", o.Port)
 	r, err := server.NewRegistry(ctx, cfg)
@@ -69,7 +234,16 @@ func ServeRegistryCmd(ctx context.Context, o *ServeRegistryOpts, s *store.Layout
 		return err
 	}
 
-	if err = r.ListenAndServe(); err != nil {
+	// the debug server, metrics included, is left to whoever runs the registry, same as distribution's own serve
+	if addr := cfg.HTTP.Debug.Addr; addr != "" {
+		go func() {
+			if err := http.ListenAndServe(addr, nil); err != nil {
+				l.Errorf("failed to serve the registry's debug server on [%s]: %v", addr, err)
+			}
+		}()
+	}
+
+	if err = serve(ctx, r); err != nil {
 		return err
 	}
 
@@ -78,9 +252,12 @@ func ServeRegistryCmd(ctx context.Context, o *ServeRegistryOpts, s *store.Layout
 
 type ServeFilesOpts struct {
 	*RootOpts
+	TLS  TLSOpts
+	Auth AuthOpts
 
 	Port    int
 	RootDir string
+	Metrics bool
 
 	storedir string
 }
@@ -89,36 +266,115 @@ func (o *ServeFilesOpts) AddFlags(cmd *cobra.Command) {
 	f := cmd.Flags()
 
 	f.IntVarP(&o.Port, "port", "p", 8080, "Port to listen on.")
-	f.StringVar(&o.RootDir, "directory", "fileserver", "Directory to use for backend.  Defaults to $PWD/fileserver")
+	f.StringVar(&o.RootDir, "directory", "", "(deprecated flag and currently not used)")
+	f.BoolVar(&o.Metrics, "metrics", false, "(Optional) Serve prometheus metrics at /metrics")
+	o.TLS.AddFlags(cmd)
+	o.Auth.AddFlags(cmd)
 }
 
 func ServeFilesCmd(ctx context.Context, o *ServeFilesOpts, s *store.Layout) error {
 	l := log.FromContext(ctx)
 	ctx = dcontext.WithVersion(ctx, version.Version)
 
-	opts := &CopyOpts{}
-	if err := CopyCmd(ctx, opts, s, "dir://"+o.RootDir); err != nil {
+	tlsCfg, err := o.TLS.config(ctx)
+	if err != nil {
 		return err
 	}
 
+	htpasswd, cleanup, err := o.Auth.htpasswd(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
 	cfg := server.FileConfig{
-		Root: o.RootDir,
 		Port: o.Port,
+		TLS:  tlsCfg,
+	}
+	if o.Metrics {
+		cfg.Metrics = server.NewMetrics()
+	}
+	if htpasswd != "" {
+		if cfg.Htpasswd, err = server.LoadHtpasswd(htpasswd); err != nil {
+			return err
+		}
 	}
 
-	f, err := server.NewFile(ctx, cfg)
+	files, err := s.Files(ctx)
 	if err != nil {
 		return err
 	}
+	for filename, desc := range files {
+		l.Debugf("serving [%s] as [/%s]", desc.Digest, filename)
+	}
+	charts, err := s.Charts(ctx)
+	if err != nil {
+		return err
+	}
+	for filename, c := range charts {
+		l.Debugf("serving [%s] as [%s%s]", c.Reference, server.ChartsPath, filename)
+	}
+	if len(charts) > 0 {
+		l.Infof("serving the [%d] charts in store [%s] as a helm repository at [%s]", len(charts), s.Root, server.ChartsPath)
+	}
 
-	l.Infof("starting file server on port [%d]", o.Port)
-	if err := f.ListenAndServe(); err != nil {
+	l.Infof("starting file server of the [%d] files in store [%s] on port [%d]", len(files), s.Root, o.Port)
+	if err := serve(ctx, server.NewStoreFiles(s, cfg)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// serve runs srv until it fails or ctx is done, so an interrupted server returns and cleans up after itself
+func serve(ctx context.Context, srv server.Server) error {
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		log.FromContext(ctx).Infof("shutting down: %v", context.Cause(ctx))
+		return nil
+	}
+}
+
+// upstreamCache returns the server.Upstream caching content from the registry upstream into s
+//
+//	Content is cached with ctx rather than the context of the request missing it, so a client giving up on a pull
+//	doesn't leave it half cached.
+func upstreamCache(ctx context.Context, s *store.Layout, upstream string) (server.Upstream, error) {
+	reg, err := name.NewRegistry(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream [%s]: %w", upstream, err)
+	}
+
+	return func(_ context.Context, repo string, ref string) error {
+		l := log.FromContext(ctx)
+
+		sep := ":"
+		if _, err := digest.Parse(ref); err == nil {
+			sep = "@"
+		}
+		r := reg.Repo(repo).Name() + sep + ref
+
+		// the store is only locked while caching, other hauler processes are free to change it the rest of the time
+		unlock, err := s.Lock(ctx)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		l.Infof("caching [%s] from upstream", r)
+		if err := cosign.SaveImage(ctx, s, r, ""); err != nil {
+			l.Warnf("failed to cache [%s]: %v", r, err)
+			return err
+		}
+		return nil
+	}, nil
+}
+
 func loadConfig(filename string) (*configuration.Configuration, error) {
 	f, err := os.Open(filename)
 	if err != nil {
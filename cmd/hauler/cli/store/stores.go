@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// NamedStore is a store defined in the stores section of the configuration file, selected with --store-name
+type NamedStore struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Description string `json:"description,omitempty"`
+	Selected    bool   `json:"selected"`
+}
+
+// SelectStore points the store commands at the named store of --store-name, unless --store was given on the command
+// line, which takes precedence over a name defaulted from the environment or the configuration file
+//
+//	storeGiven and nameGiven report whether --store and --store-name were given on the command line.
+func (o *RootOpts) SelectStore(storeGiven, nameGiven bool) error {
+	if o.StoreName == "" {
+		return nil
+	}
+	if storeGiven {
+		if nameGiven {
+			return fmt.Errorf("--store and --store-name both name a store, give only one of them")
+		}
+		return nil
+	}
+
+	ns, ok := o.Stores[o.StoreName]
+	if !ok {
+		if len(o.Stores) == 0 {
+			return fmt.Errorf("store [%s] is not defined, the configuration file defines no stores", o.StoreName)
+		}
+		return fmt.Errorf("store [%s] is not defined, must be one of [%s]", o.StoreName, strings.Join(o.storeNames(), ", "))
+	}
+	dir, err := homedir.Expand(ns.Path)
+	if err != nil {
+		return err
+	}
+	o.StoreDir = dir
+	return nil
+}
+
+func (o *RootOpts) storeNames() []string {
+	names := make([]string, 0, len(o.Stores))
+	for name := range o.Stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type ListStoresOpts struct {
+	*RootOpts
+
+	OutputFormat string
+}
+
+func (o *ListStoresOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringVarP(&o.OutputFormat, "output", "o", "table", "Output format (table, json, yaml)")
+}
+
+// ListStoresCmd lists the stores defined in the configuration file, marking the one --store-name selects
+func ListStoresCmd(ctx context.Context, o *ListStoresOpts) error {
+	var stores []NamedStore
+	for _, name := range o.storeNames() {
+		ns := o.Stores[name]
+		ns.Name = name
+		ns.Selected = name == o.StoreName
+		stores = append(stores, ns)
+	}
+	return writeStores(os.Stdout, o.OutputFormat, stores)
+}
+
+func writeStores(w io.Writer, format string, stores []NamedStore) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(stores, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+
+	case "yaml":
+		data, err := yaml.Marshal(stores)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+
+	case "table":
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"", "Name", "Path", "Description"})
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetRowLine(false)
+
+		for _, s := range stores {
+			selected := ""
+			if s.Selected {
+				selected = "*"
+			}
+			table.Append([]string{selected, s.Name, s.Path, s.Description})
+		}
+		table.Render()
+		return nil
+	}
+	return fmt.Errorf("unsupported output format [%s], must be one of table, json, or yaml", format)
+}
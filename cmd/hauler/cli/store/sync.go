@@ -2,53 +2,158 @@ package store
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
+	"github.com/olekukonko/tablewriter"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/spf13/cobra"
 	"helm.sh/helm/v3/pkg/action"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	sigsyaml "sigs.k8s.io/yaml"
 
 	"github.com/rancherfederal/hauler/pkg/apis/hauler.cattle.io/v1alpha1"
+	"github.com/rancherfederal/hauler/pkg/artifacts"
+	"github.com/rancherfederal/hauler/pkg/artifacts/file/getter"
+	"github.com/rancherfederal/hauler/pkg/artifacts/git"
+	"github.com/rancherfederal/hauler/pkg/artifacts/image"
 	tchart "github.com/rancherfederal/hauler/pkg/collection/chart"
+	"github.com/rancherfederal/hauler/pkg/collection/custom"
 	"github.com/rancherfederal/hauler/pkg/collection/imagetxt"
 	"github.com/rancherfederal/hauler/pkg/collection/k3s"
+	"github.com/rancherfederal/hauler/pkg/collection/plugin"
+	"github.com/rancherfederal/hauler/pkg/collection/rke2"
 	"github.com/rancherfederal/hauler/pkg/consts"
 	"github.com/rancherfederal/hauler/pkg/content"
 	"github.com/rancherfederal/hauler/pkg/cosign"
 	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/policy"
 	"github.com/rancherfederal/hauler/pkg/reference"
+	"github.com/rancherfederal/hauler/pkg/report"
 	"github.com/rancherfederal/hauler/pkg/store"
+	"github.com/rancherfederal/hauler/pkg/telemetry"
 )
 
 type SyncOpts struct {
 	*RootOpts
 	ContentFiles []string
 	Key          string
+	Keyless      KeylessOpts
 	Products	 []string
+	K3s          string
+	K3sArch      string
 	Platform	 string
+	AllPlatforms bool
+	Referrers    bool
+	Policy       string
 	Registry	 string
 	ProductRegistry string
+	Force        bool
+	DryRun       bool
+	Set          []string
+	Include      []string
+	Exclude      []string
+
+	ContinueOnError bool
+	ErrorReport     string
+
+	// stdin is the content read from stdin, read once for both the preflight and the sync
+	stdin []byte
+}
+
+// syncStats counts what a sync fetched and what it skipped as already up to date in the store
+type syncStats struct {
+	fetched int
+	skipped int
+
+	// planned is what a dry run would have fetched
+	planned []syncPlan
+
+	// failures are the items that failed when continuing on error
+	failures failureReport
+}
+
+// syncPlan is an item a dry run would have fetched
+type syncPlan struct {
+	kind      string
+	reference string
+
+	// blobs are what fetching an image pulls, size is set instead for everything else and is -1 when unknown
+	blobs []ocispec.Descriptor
+	size  int64
 }
 
 func (o *SyncOpts) AddFlags(cmd *cobra.Command) {
 	f := cmd.Flags()
 
-	f.StringSliceVarP(&o.ContentFiles, "files", "f", []string{}, "Path to content files")
+	f.StringSliceVarP(&o.ContentFiles, "files", "f", []string{}, "Path to content files, or - to read content from stdin")
 	f.StringVarP(&o.Key, "key", "k", "", "(Optional) Path to the key for signature verification")
+	o.Keyless.AddFlags(cmd)
+	cmd.MarkFlagsMutuallyExclusive("key", "certificate-identity")
+	cmd.MarkFlagsMutuallyExclusive("key", "certificate-identity-regexp")
 	f.StringSliceVar(&o.Products, "products", []string{}, "Used for RGS Carbide customers to supply a product and version and Hauler will retrieve the images. i.e. '--product rancher=v2.7.6'")
-	f.StringVarP(&o.Platform, "platform", "p", "", "(Optional) Specific platform to save. i.e. linux/amd64. Defaults to all if flag is omitted.")
+	f.StringVarP(&o.Platform, "platform", "p", "", "(Optional) Platforms to save, comma separated. i.e. linux/amd64,linux/arm64. Defaults to all if flag is omitted.")
+	f.BoolVar(&o.AllPlatforms, "all-platforms", false, "(Optional) Save every platform of multi-arch images along with their full index, ignoring any platform set in the content files")
+	cmd.MarkFlagsMutuallyExclusive("platform", "all-platforms")
+	f.BoolVar(&o.Referrers, "referrers", false, "(Optional) Also sync the OCI 1.1 referrers of images, such as sboms and signatures attached through the referrers api. Cosign signatures, attestations, and sboms are always synced")
+	f.StringVar(&o.K3s, "k3s", "", "(Optional) Sync a complete k3s airgap install of this version or channel: the executable, airgap images, install script, checksums, and every image it depends on. i.e. 'v1.28.5+k3s1' or 'stable'")
+	f.StringVar(&o.K3sArch, "k3s-arch", "amd64", "(Optional) Architecture of the k3s install synced with --k3s: amd64, arm64, or arm")
+	f.StringVar(&o.Policy, "policy", "", "(Optional) Path to a policy file of the registries, tags, and signing keys images have to comply with to be synced, including those of collections")
 	f.StringVarP(&o.Registry, "registry", "r", "", "(Optional) Default pull registry for image refs that are not specifying a registry name.")
 	f.StringVarP(&o.ProductRegistry, "product-registry", "c", "", "(Optional) Specific Product Registry to use. Defaults to RGS Carbide Registry (rgcrprod.azurecr.us).")
+	f.BoolVar(&o.Force, "force", false, "(Optional) Fetch every image again, even those already up to date in the store")
+	f.BoolVar(&o.DryRun, "dry-run", false, "(Optional) Report what would be fetched and the disk space it requires, without writing anything to the store")
+	cmd.MarkFlagsMutuallyExclusive("dry-run", "products")
+	f.StringSliceVar(&o.Include, "include", []string{}, "(Optional) Only sync images, charts, and files whose reference matches one of these glob patterns, as listed by 'hauler store list'. i.e. 'rancher/*'")
+	f.StringSliceVar(&o.Exclude, "exclude", []string{}, "(Optional) Never sync images, charts, and files whose reference matches one of these glob patterns, taking precedence over --include")
+	f.BoolVar(&o.ContinueOnError, "continue-on-error", false, "(Optional) Keep syncing the remaining content when an item fails, then exit with an error and a json report of every failure")
+	f.StringVar(&o.ErrorReport, "error-report", "", "(Optional) Path to write the json report of failures to with --continue-on-error, defaults to stderr")
+	f.StringArrayVar(&o.Set, "set", []string{}, "(Optional) Set a variable referenced in content files as ${KEY} or {{ .KEY }}, taking precedence over environment variables of the same name. i.e. '--set REGISTRY=registry.example.com'")
+	o.AddRemoteFlags(cmd)
+	o.AddProgressFlags(cmd)
+	o.AddReportFlags(cmd)
 }
 
-func SyncCmd(ctx context.Context, o *SyncOpts, s *store.Layout) error {
+func SyncCmd(ctx context.Context, o *SyncOpts, s *store.Layout) (err error) {
 	l := log.FromContext(ctx)
 
+	end, err := o.beginProgress(ctx, "sync")
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	ctx, finish := o.beginReport(ctx, "sync")
+	defer func() { err = finish(err) }()
+
+	ctx, cancel := s.TransportOptions().WithOperationTimeout(ctx)
+	defer cancel()
+
+	stats := &syncStats{}
+
+	for _, filename := range o.ContentFiles {
+		if filename == "-" {
+			if o.stdin, err = io.ReadAll(os.Stdin); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if !o.DryRun {
+		if err := preflightSync(ctx, o, s); err != nil {
+			return err
+		}
+	}
+
 	// if passed products, check for a remote manifest to retrieve and use.
 	for _, product := range o.Products {
 		l.Infof("processing content file for product: '%s'", product)
@@ -66,7 +171,7 @@ func SyncCmd(ctx context.Context, o *SyncOpts, s *store.Layout) error {
 		img := v1alpha1.Image{
 			Name: manifestLoc,
 		}
-		err := storeImage(ctx, s, img, o.Platform)
+		err := storeImage(ctx, s, img, o.Platform, nil)
 		if err != nil {
 			return err
 		}
@@ -76,36 +181,253 @@ func SyncCmd(ctx context.Context, o *SyncOpts, s *store.Layout) error {
 		}
 		filename := fmt.Sprintf("%s-manifest.yaml", parts[0])
 
-		fi, err := os.Open(filename)
-		if err != nil {
+		if err := syncContentFile(ctx, filename, o, s, stats); err != nil {
 			return err
 		}
-		err = processContent(ctx, fi, o, s)
-		if err != nil {
+	}
+
+	// if passed a k3s version, sync it as if it were listed in a content file
+	if o.K3s != "" {
+		if err := syncK3s(ctx, o, s, stats); err != nil {
 			return err
 		}
 	}
 
 	// if passed a local manifest, process it
+	stdin := false
 	for _, filename := range o.ContentFiles {
-		l.Debugf("processing content file: '%s'", filename)
-		fi, err := os.Open(filename)
-		if err != nil {
+		if filename == "-" {
+			if stdin {
+				return fmt.Errorf("content can only be read from stdin once")
+			}
+			stdin = true
+		}
+		if err := syncContentFile(ctx, filename, o, s, stats); err != nil {
 			return err
 		}
-		err = processContent(ctx, fi, o, s)
-		if err != nil {
+	}
+
+	if o.DryRun {
+		if err := writePlan(ctx, os.Stdout, s, stats); err != nil {
+			return err
+		}
+	} else {
+		l.Infof("sync complete: fetched [%d], skipped [%d] already up to date", stats.fetched, stats.skipped)
+	}
+
+	if n := len(stats.failures.Failures); n > 0 {
+		stats.failures.Total = stats.fetched + stats.skipped + len(stats.planned) + n
+		if err := stats.failures.write(o.ErrorReport); err != nil {
 			return err
 		}
+		return fmt.Errorf("failed to sync [%d] items", n)
+	}
+	return nil
+}
+
+// preflightSync plans the sync of --k3s and the content files the same as a dry run, failing before anything is
+// fetched when the store can't hold what they require
+//
+//	Items that can't be sized in advance, such as charts and collections, are left out of the estimate, as are the
+//	products synced with --products.  A plan that fails is left for the sync itself to report.
+func preflightSync(ctx context.Context, o *SyncOpts, s *store.Layout) error {
+	l := log.FromContext(ctx)
+	if o.SkipSpaceCheck || (o.K3s == "" && len(o.ContentFiles) == 0) {
+		return nil
+	}
+	l.Infof("estimating the disk space the sync requires")
+
+	// signatures and policies are left for the sync to check, the plan is only after sizes
+	plan := *o
+	plan.DryRun, plan.ContinueOnError = true, false
+	plan.Key, plan.Keyless, plan.Policy = "", KeylessOpts{}, ""
+	stats := &syncStats{}
+
+	pctx := log.Quiet(report.WithContext(ctx, nil))
+	if o.K3s != "" {
+		if err := syncK3s(pctx, &plan, s, stats); err != nil {
+			l.Warnf("unable to estimate the disk space the sync requires, syncing without checking: %v", err)
+			return nil
+		}
+	}
+	for _, filename := range o.ContentFiles {
+		if err := syncContentFile(pctx, filename, &plan, s, stats); err != nil {
+			l.Warnf("unable to estimate the disk space the sync requires, syncing without checking: %v", err)
+			return nil
+		}
+	}
+
+	required, unknown, err := planRequired(s, stats)
+	if err != nil {
+		return err
+	}
+	if unknown > 0 {
+		l.Debugf("[%d] items can't be sized in advance and are left out of the estimate", unknown)
+	}
+	return o.checkSpace(ctx, s.Root, required)
+}
+
+// syncK3s syncs the k3s collection of the --k3s version and --k3s-arch
+func syncK3s(ctx context.Context, o *SyncOpts, s *store.Layout, stats *syncStats) error {
+	cfg := v1alpha1.K3s{
+		TypeMeta: &metav1.TypeMeta{
+			APIVersion: v1alpha1.CollectionGroupVersion.String(),
+			Kind:       v1alpha1.K3sCollectionKind,
+		},
+		Spec: v1alpha1.K3sSpec{Version: o.K3s, Arch: o.K3sArch},
+	}
+	data, err := sigsyaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := processContent(ctx, bytes.NewReader(data), o, s, stats); err != nil {
+		return fmt.Errorf("syncing k3s [%s]: %w", o.K3s, err)
+	}
+	return nil
+}
+
+// loadCollections loads the collections ref refers to, rendered with its values, --set, and the environment
+func loadCollections(ctx context.Context, o *SyncOpts, ref v1alpha1.CollectionRef) ([]v1alpha1.Collection, error) {
+	l := log.FromContext(ctx)
+	l.Debugf("loading collections from [%s]", ref.Path)
+
+	values, err := content.ParseValues(o.Set)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range ref.Values {
+		values[k] = v
+	}
+
+	rc, err := getter.NewClient(getter.ClientOptions{}).ContentFrom(ctx, ref.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := content.Render(raw, values)
+	if err != nil {
+		return nil, err
+	}
+	return custom.Load(rendered, ref.Name)
+}
+
+// syncCollections syncs the images, charts, and files of each collection
+func syncCollections(ctx context.Context, o *SyncOpts, s *store.Layout, stats *syncStats, collections ...v1alpha1.Collection) error {
+	l := log.FromContext(ctx)
+
+	for _, c := range collections {
+		l.Infof("syncing collection [%s]", c.Name)
+		if err := syncCollection(ctx, o, s, stats, c); err != nil {
+			return fmt.Errorf("syncing collection [%s]: %w", c.Name, err)
+		}
 	}
+	return nil
+}
+
+// syncCollection syncs the images, charts, and files of the collection c
+func syncCollection(ctx context.Context, o *SyncOpts, s *store.Layout, stats *syncStats, c v1alpha1.Collection) (err error) {
+	ctx, span := telemetry.Start(ctx, "sync.collection", telemetry.Reference(c.Name))
+	defer func() { telemetry.End(span, err) }()
+
+	docs, err := custom.Documents(c)
+	if err != nil {
+		return err
+	}
+	return processDocuments(ctx, bytes.Join(docs, []byte("---\n")), o, s, stats)
+}
+
+// syncContentFile syncs the content listed in filename to the store, reading the content from stdin when filename is -
+func syncContentFile(ctx context.Context, filename string, o *SyncOpts, s *store.Layout, stats *syncStats) (err error) {
+	ctx, span := telemetry.Start(ctx, "sync.contentFile", telemetry.File(filename))
+	defer func() { telemetry.End(span, err) }()
 
+	l := log.FromContext(ctx)
+
+	if filename == "-" {
+		l.Debugf("processing content from stdin")
+		return processContent(ctx, bytes.NewReader(o.stdin), o, s, stats)
+	}
+
+	l.Debugf("processing content file: '%s'", filename)
+	fi, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+
+	if err := processContent(ctx, fi, o, s, stats); err != nil {
+		return fmt.Errorf("syncing [%s]: %w", filename, err)
+	}
 	return nil
 }
 
-func processContent(ctx context.Context, fi *os.File, o *SyncOpts, s *store.Layout) error {
+// imageCurrent reports whether the store already holds what the registry currently serves for the image name, narrowed
+// down to platform when set
+func imageCurrent(ctx context.Context, s *store.Layout, name string, platform string) (bool, error) {
+	if _, err := s.Stat(ctx, name); errors.Is(err, store.ErrReferenceNotFound) {
+		return false, nil
+	}
+
+	ps, err := store.ParsePlatforms(platform)
+	if err != nil {
+		return false, err
+	}
+	desc, manifests, err := image.Resolve(name, s.RemoteOptions()...)
+	if err != nil {
+		return false, err
+	}
+	return s.Current(ctx, name, desc, manifests, ps...)
+}
+
+func processContent(ctx context.Context, r io.Reader, o *SyncOpts, s *store.Layout, stats *syncStats) error {
+	values, err := content.ParseValues(o.Set)
+	if err != nil {
+		return err
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	rendered, err := content.Render(raw, values)
+	if err != nil {
+		return err
+	}
+	return processDocuments(ctx, rendered, o, s, stats)
+}
+
+// processDocuments syncs each of the rendered yaml documents of a content file
+func processDocuments(ctx context.Context, rendered []byte, o *SyncOpts, s *store.Layout, stats *syncStats) error {
 	l := log.FromContext(ctx)
 
-	reader := yaml.NewYAMLReader(bufio.NewReader(fi))
+	filter, err := store.NewRefFilter(o.Include, o.Exclude)
+	if err != nil {
+		return err
+	}
+	p, err := loadPolicy(o.Policy)
+	if err != nil {
+		return err
+	}
+
+	// fail records err as the failure of an item when continuing on error, otherwise returning it to stop the sync
+	fail := func(kind string, ref string, err error) error {
+		recordFailure(ctx, kind, ref, err)
+		if !o.ContinueOnError {
+			return err
+		}
+		l.Errorf("failed to sync %s [%s], continuing: %v", kind, ref, err)
+		stats.failures.add(kind, ref, err)
+		return nil
+	}
+	var addOpts []store.AddOption
+	if o.ContinueOnError {
+		addOpts = append(addOpts, store.WithContinueOnError())
+	}
+
+	reader := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(rendered)))
 
 	var docs [][]byte
 	for {
@@ -138,10 +460,54 @@ func processContent(ctx context.Context, fi *os.File, o *SyncOpts, s *store.Layo
 			}
 
 			for _, f := range cfg.Spec.Files {
-				err := storeFile(ctx, s, f)
-				if err != nil {
-					return err
+				c := getter.NewClient(getter.ClientOptions{NameOverride: f.Name})
+				if ref := contentRef(c.Name(f.Path), ""); !filter.Matches(ref) {
+					l.Debugf("'file' [%s] is filtered out, skipping", ref)
+					continue
+				}
+
+				if o.DryRun {
+					if err := planFile(ctx, f, stats); err != nil {
+						return err
+					}
+					continue
 				}
+
+				if err := storeFile(ctx, s, f); err != nil {
+					if err := fail("file", f.Path, err); err != nil {
+						return err
+					}
+					continue
+				}
+				stats.fetched++
+			}
+
+		case v1alpha1.GitRepositoriesContentKind:
+			var cfg v1alpha1.GitRepositories
+			if err := yaml.Unmarshal(doc, &cfg); err != nil {
+				return err
+			}
+
+			for _, g := range cfg.Spec.Repositories {
+				r := git.NewRepository(g.URL, g.Ref, git.WithName(g.Name))
+				ref := contentRef(r.Name(), r.Tag())
+				if !filter.Matches(ref) {
+					l.Debugf("'git' [%s] is filtered out, skipping", ref)
+					continue
+				}
+
+				if o.DryRun {
+					stats.planned = append(stats.planned, syncPlan{kind: "git", reference: ref, size: -1})
+					continue
+				}
+
+				if err := storeGit(ctx, s, g); err != nil {
+					if err := fail("git", g.URL, err); err != nil {
+						return err
+					}
+					continue
+				}
+				stats.fetched++
 			}
 
 		case v1alpha1.ImagesContentKind:
@@ -171,32 +537,49 @@ func processContent(ctx context.Context, fi *os.File, o *SyncOpts, s *store.Layo
 					i.Name = newRef.Name()
 				}
 
-				// Check if the user provided a key.  The flag from the CLI takes precedence over the annotation.  The individual image key takes precedence over both.
-				if a[consts.ImageAnnotationKey] != "" || o.Key != "" || i.Key != "" {
-					key := o.Key // cli flag
-					// if no cli flag but there was an annotation, use the annotation.
-					if o.Key == "" && a[consts.ImageAnnotationKey] != "" {
-						key, err = homedir.Expand(a[consts.ImageAnnotationKey])
-						if err != nil {
-							return err
-						}
+				if !filter.Matches(i.Name) {
+					l.Debugf("image [%s] is filtered out, skipping", i.Name)
+					continue
+				}
+
+				// Check if the user provided a key or keyless options.  The flags from the CLI take precedence over the annotation.  The individual image's take precedence over both.
+				vo := o.Keyless.Options(o.Key)
+				// if no cli flags but there was an annotation, use the annotation.
+				if !vo.Enabled() && a[consts.ImageAnnotationKey] != "" {
+					key, err := homedir.Expand(a[consts.ImageAnnotationKey])
+					if err != nil {
+						return err
 					}
-					// the individual image key trumps all
-					if i.Key != "" {
-						key, err = homedir.Expand(i.Key)
+					vo = cosign.VerifyOptions{Key: key}
+				}
+				// the individual image options trump all
+				iv := cosign.VerifyOptions{
+					Key:                  i.Key,
+					CertIdentity:         i.CertificateIdentity,
+					CertIdentityRegexp:   i.CertificateIdentityRegexp,
+					CertOIDCIssuer:       i.CertificateOidcIssuer,
+					CertOIDCIssuerRegexp: i.CertificateOidcIssuerRegexp,
+				}
+				if iv.Enabled() {
+					if iv.Key != "" {
+						iv.Key, err = homedir.Expand(iv.Key)
 						if err != nil {
 							return err
 						}
 					}
-					l.Debugf("key for image [%s]", key)
-					
-					// verify signature using the provided key.
-					err := cosign.VerifySignature(ctx, s, key, i.Name)
-					if err != nil {
-						l.Errorf("signature verification failed for image [%s]. ** hauler will skip adding this image to the store **:\n%v", i.Name, err)
-						continue
+					vo = iv
+				}
+
+				// check the image against the policy and verify its signature before it's admitted into the store, failing closed
+				if vo.Enabled() {
+					l.Debugf("verifying image [%s] with %s", i.Name, vo.Verifier())
+				}
+				verified, err := admitImage(ctx, s, p, i.Name, vo)
+				if err != nil {
+					if err := fail("image", i.Name, err); err != nil {
+						return err
 					}
-					l.Infof("signature verified for image [%s]", i.Name)
+					continue
 				}
 
 				// Check if the user provided a platform.  The flag from the CLI takes precedence over the annotation.  The individual image platform takes precedence over both.
@@ -209,14 +592,66 @@ func processContent(ctx context.Context, fi *os.File, o *SyncOpts, s *store.Layo
 				if i.Platform != "" {
 					platform = i.Platform
 				}
+				// unless every platform was explicitly asked for
+				if o.AllPlatforms {
+					platform = ""
+				}
+
+				if !o.Force {
+					start := time.Now()
+					current, err := imageCurrent(ctx, s, i.Name, platform)
+					if err != nil {
+						l.Warnf("unable to check image [%s] against the store, fetching it: %v", i.Name, err)
+					} else if current {
+						l.Infof("image [%s] is already up to date in the store, skipping", i.Name)
+						if verified != nil && !o.DryRun {
+							if _, err := s.Annotate(ctx, i.Name, verified); err != nil {
+								return err
+							}
+						}
+						// referrers may have been attached since the image was last synced
+						if o.Referrers && !o.DryRun {
+							if err := storeReferrers(ctx, s, i.Name); err != nil {
+								if err := fail("image", i.Name, err); err != nil {
+									return err
+								}
+							}
+						}
+						recordArtifact(ctx, s, i.Name, start, report.StatusSkipped)
+						stats.skipped++
+						continue
+					}
+				}
+
+				if o.DryRun {
+					if err := planImage(ctx, s, i.Name, platform, stats); err != nil {
+						if err := fail("image", i.Name, err); err != nil {
+							return err
+						}
+					}
+					continue
+				}
 								
-				err = storeImage(ctx, s, i, platform)
-				if err != nil {
-					return err
+				if err := storeImage(ctx, s, i, platform, verified); err != nil {
+					if err := fail("image", i.Name, err); err != nil {
+						return err
+					}
+					continue
 				}
+				if o.Referrers {
+					if err := storeReferrers(ctx, s, i.Name); err != nil {
+						if err := fail("image", i.Name, err); err != nil {
+							return err
+						}
+						continue
+					}
+				}
+				stats.fetched++
+			}
+			// sync with local index, which copies nothing across so isn't recorded in the report
+			if !o.DryRun {
+				s.CopyAll(report.WithContext(ctx, nil), s.OCI, nil)
 			}
-			// sync with local index
-			s.CopyAll(ctx, s.OCI, nil)
 
 		case v1alpha1.ChartsContentKind:
 			var cfg v1alpha1.Charts
@@ -225,11 +660,25 @@ func processContent(ctx context.Context, fi *os.File, o *SyncOpts, s *store.Layo
 			}
 
 			for _, ch := range cfg.Spec.Charts {
+				ref := contentRef(ch.Name, ch.Version)
+				if !filter.Matches(ref) {
+					l.Debugf("'chart' [%s] is filtered out, skipping", ref)
+					continue
+				}
+
+				if o.DryRun {
+					stats.planned = append(stats.planned, syncPlan{kind: "chart", reference: ref, size: -1})
+					continue
+				}
+
 				// TODO: Provide a way to configure syncs
-				err := storeChart(ctx, s, ch, &action.ChartPathOptions{})
-				if err != nil {
-					return err
+				if _, err := storeChart(ctx, s, ch, &action.ChartPathOptions{}); err != nil {
+					if err := fail("chart", ref, err); err != nil {
+						return err
+					}
+					continue
 				}
+				stats.fetched++
 			}
 
 		case v1alpha1.K3sCollectionKind:
@@ -237,16 +686,113 @@ func processContent(ctx context.Context, fi *os.File, o *SyncOpts, s *store.Layo
 			if err := yaml.Unmarshal(doc, &cfg); err != nil {
 				return err
 			}
+			if o.DryRun {
+				stats.planned = append(stats.planned, syncPlan{kind: "k3s", reference: cfg.Spec.Version, size: -1})
+				continue
+			}
+
+			k, err := k3s.NewK3s(cfg.Spec.Version, cfg.Spec.Arch, s.RemoteOptions()...)
+			if err != nil {
+				if err := fail("k3s", cfg.Spec.Version, err); err != nil {
+					return err
+				}
+				continue
+			}
 
-			k, err := k3s.NewK3s(cfg.Spec.Version)
+			descs, err := addCollection(ctx, s, p, k, addOpts...)
+			stats.fetched += len(descs)
 			if err != nil {
+				if err := fail("k3s", cfg.Spec.Version, err); err != nil {
+					return err
+				}
+			}
+
+		case v1alpha1.RKE2CollectionKind:
+			var cfg v1alpha1.RKE2
+			if err := yaml.Unmarshal(doc, &cfg); err != nil {
 				return err
 			}
+			if o.DryRun {
+				stats.planned = append(stats.planned, syncPlan{kind: "rke2", reference: cfg.Spec.Version, size: -1})
+				continue
+			}
 
-			if _, err := s.AddOCICollection(ctx, k); err != nil {
+			r, err := rke2.NewRKE2(cfg.Spec.Version, cfg.Spec.Arch, s.RemoteOptions()...)
+			if err != nil {
+				if err := fail("rke2", cfg.Spec.Version, err); err != nil {
+					return err
+				}
+				continue
+			}
+
+			descs, err := addCollection(ctx, s, p, r, addOpts...)
+			stats.fetched += len(descs)
+			if err != nil {
+				if err := fail("rke2", cfg.Spec.Version, err); err != nil {
+					return err
+				}
+			}
+
+		case v1alpha1.CollectionKind:
+			var cfg v1alpha1.Collection
+			if err := yaml.Unmarshal(doc, &cfg); err != nil {
+				return err
+			}
+			if err := syncCollections(ctx, o, s, stats, cfg); err != nil {
 				return err
 			}
 
+		case v1alpha1.CollectionRefsKind:
+			var cfg v1alpha1.CollectionRefs
+			if err := yaml.Unmarshal(doc, &cfg); err != nil {
+				return err
+			}
+
+			for _, ref := range cfg.Spec.Collections {
+				collections, err := loadCollections(ctx, o, ref)
+				if err != nil {
+					if err := fail("collection", ref.Path, err); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := syncCollections(ctx, o, s, stats, collections...); err != nil {
+					return err
+				}
+			}
+
+		case v1alpha1.PluginsCollectionKind:
+			var cfg v1alpha1.Plugins
+			if err := yaml.Unmarshal(doc, &cfg); err != nil {
+				return err
+			}
+
+			for _, cfgPlugin := range cfg.Spec.Plugins {
+				if o.DryRun {
+					stats.planned = append(stats.planned, syncPlan{kind: "plugin", reference: cfgPlugin.Name, size: -1})
+					continue
+				}
+
+				pl, err := plugin.New(cfgPlugin.Name, cfgPlugin.Config, s.RemoteOptions()...)
+				if err != nil {
+					if err := fail("plugin", cfgPlugin.Name, err); err != nil {
+						return err
+					}
+					continue
+				}
+
+				descs, err := addCollection(ctx, s, p, pl, addOpts...)
+				stats.fetched += len(descs)
+				if cerr := pl.Close(); cerr != nil {
+					l.Warnf("unable to clean up after plugin [%s]: %v", cfgPlugin.Name, cerr)
+				}
+				if err != nil {
+					if err := fail("plugin", cfgPlugin.Name, err); err != nil {
+						return err
+					}
+				}
+			}
+
 		case v1alpha1.ChartsCollectionKind:
 			var cfg v1alpha1.ThickCharts
 			if err := yaml.Unmarshal(doc, &cfg); err != nil {
@@ -254,16 +800,34 @@ func processContent(ctx context.Context, fi *os.File, o *SyncOpts, s *store.Layo
 			}
 
 			for _, cfg := range cfg.Spec.Charts {
+				ref := contentRef(cfg.Name, cfg.Version)
+				if !filter.Matches(ref) {
+					l.Debugf("'chart' [%s] is filtered out, skipping", ref)
+					continue
+				}
+
+				if o.DryRun {
+					stats.planned = append(stats.planned, syncPlan{kind: "chart", reference: ref, size: -1})
+					continue
+				}
+
 				tc, err := tchart.NewThickChart(cfg, &action.ChartPathOptions{
 					RepoURL: cfg.RepoURL,
 					Version: cfg.Version,
-				})
+				}, s.RemoteOptions()...)
 				if err != nil {
-					return err
+					if err := fail("chart", ref, err); err != nil {
+						return err
+					}
+					continue
 				}
 
-				if _, err := s.AddOCICollection(ctx, tc); err != nil {
-					return err
+				descs, err := addCollection(ctx, s, p, tc, addOpts...)
+				stats.fetched += len(descs)
+				if err != nil {
+					if err := fail("chart", ref, err); err != nil {
+						return err
+					}
 				}
 			}
 
@@ -274,16 +838,31 @@ func processContent(ctx context.Context, fi *os.File, o *SyncOpts, s *store.Layo
 			}
 
 			for _, cfgIt := range cfg.Spec.ImageTxts {
+				if o.DryRun {
+					stats.planned = append(stats.planned, syncPlan{kind: "imagetxt", reference: cfgIt.Ref, size: -1})
+					continue
+				}
+
 				it, err := imagetxt.New(cfgIt.Ref,
 					imagetxt.WithIncludeSources(cfgIt.Sources.Include...),
 					imagetxt.WithExcludeSources(cfgIt.Sources.Exclude...),
+					imagetxt.WithIncludeSections(cfgIt.Sections.Include...),
+					imagetxt.WithExcludeSections(cfgIt.Sections.Exclude...),
+					imagetxt.WithRemoteOptions(s.RemoteOptions()...),
 				)
 				if err != nil {
-					return fmt.Errorf("convert ImageTxt %s: %v", cfg.Name, err)
+					if err := fail("imagetxt", cfgIt.Ref, fmt.Errorf("convert ImageTxt %s: %v", cfg.Name, err)); err != nil {
+						return err
+					}
+					continue
 				}
 
-				if _, err := s.AddOCICollection(ctx, it); err != nil {
-					return fmt.Errorf("add ImageTxt %s to store: %v", cfg.Name, err)
+				descs, err := addCollection(ctx, s, p, it, addOpts...)
+				stats.fetched += len(descs)
+				if err != nil {
+					if err := fail("imagetxt", cfgIt.Ref, fmt.Errorf("add ImageTxt %s to store: %w", cfg.Name, err)); err != nil {
+						return err
+					}
 				}
 			}
 
@@ -293,3 +872,171 @@ func processContent(ctx context.Context, fi *os.File, o *SyncOpts, s *store.Layo
 	}
 	return nil
 }
+
+// addCollection adds the collection c to the store once every image in it is admitted by the policy p, recording the
+// verification of those the policy requires to be signed
+//
+//	The images of a collection are discovered as it's added, so a single image violating the policy fails the collection
+//	before any of it is added.
+func addCollection(ctx context.Context, s *store.Layout, p *policy.Policy, c artifacts.OCICollection, opts ...store.AddOption) ([]ocispec.Descriptor, error) {
+	verified := make(map[string]map[string]string)
+	if p != nil {
+		cnts, err := c.Contents()
+		if err != nil {
+			return nil, err
+		}
+		for ref, oci := range cnts {
+			if _, ok := oci.(*image.Image); !ok {
+				continue
+			}
+			v, err := admitImage(ctx, s, p, ref, cosign.VerifyOptions{})
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				verified[ref] = v
+			}
+		}
+	}
+
+	descs, err := s.AddOCICollection(ctx, c, opts...)
+	for ref, v := range verified {
+		if _, serr := s.Stat(ctx, ref); errors.Is(serr, store.ErrReferenceNotFound) {
+			// failed to add, when continuing on error
+			continue
+		}
+		if verr := recordVerified(ctx, s, ref, v, true); verr != nil {
+			return descs, verr
+		}
+	}
+	return descs, err
+}
+
+// planFile records the file a dry run would have fetched, sized without fetching it where its getter allows
+func planFile(ctx context.Context, fi v1alpha1.File, stats *syncStats) error {
+	l := log.FromContext(ctx)
+
+	c := getter.NewClient(getter.ClientOptions{NameOverride: fi.Name})
+	size, err := c.Size(ctx, fi.Path)
+	if err != nil {
+		l.Warnf("unable to size 'file' [%s]: %v", fi.Path, err)
+		size = -1
+	}
+	stats.planned = append(stats.planned, syncPlan{kind: "file", reference: contentRef(c.Name(fi.Path), ""), size: size})
+	return nil
+}
+
+// contentRef returns the reference content named name is stored as, tagged with tag or the default tag when empty
+func contentRef(name string, tag string) string {
+	if tag == "" {
+		tag = reference.DefaultTag
+	}
+	ref, err := reference.NewTagged(name, tag)
+	if err != nil {
+		return name
+	}
+	return ref.Name()
+}
+
+// planImage records the blobs a dry run would have pulled for the image name, narrowed down to platform when set
+func planImage(ctx context.Context, s *store.Layout, name string, platform string, stats *syncStats) error {
+	ps, err := store.ParsePlatforms(platform)
+	if err != nil {
+		return err
+	}
+	blobs, err := image.Blobs(name, ps, s.RemoteOptions()...)
+	if err != nil {
+		return err
+	}
+	stats.planned = append(stats.planned, syncPlan{kind: "image", reference: name, blobs: blobs})
+	return nil
+}
+
+// writePlan reports what a dry run would have fetched, along with the disk space it requires
+//
+//	An image requires the space of whichever of its blobs aren't already in the store, counting blobs shared between
+//	images once in the total.  Items that can't be sized in advance, such as charts and collections, are left out of the
+//	totals.
+func writePlan(ctx context.Context, w io.Writer, s *store.Layout, stats *syncStats) error {
+	l := log.FromContext(ctx)
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Type", "Reference", "Size", "Required"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetRowLine(false)
+
+	var total int64
+	for _, p := range stats.planned {
+		if p.blobs == nil {
+			if p.size < 0 {
+				table.Append([]string{p.kind, p.reference, "unknown", "unknown"})
+				continue
+			}
+			total += p.size
+			table.Append([]string{p.kind, p.reference, byteCountSI(p.size), byteCountSI(p.size)})
+			continue
+		}
+
+		missing, err := s.Missing(p.blobs)
+		if err != nil {
+			return err
+		}
+		size := blobsSize(p.blobs)
+		total += size
+		table.Append([]string{p.kind, p.reference, byteCountSI(size), byteCountSI(blobsSize(missing))})
+	}
+
+	required, unknown, err := planRequired(s, stats)
+	if err != nil {
+		return err
+	}
+
+	table.SetFooter([]string{"", "Total", byteCountSI(total), byteCountSI(required)})
+	table.Render()
+
+	if unknown > 0 {
+		l.Warnf("[%d] items can't be sized in advance and are left out of the totals", unknown)
+	}
+	l.Infof("dry run: [%d] items to fetch and [%d] already up to date, requiring [%s] of disk space; nothing was written to the store",
+		len(stats.planned), stats.skipped, byteCountSI(required))
+	return nil
+}
+
+// planRequired returns the disk space what a dry run planned requires, counting blobs shared between images or already
+// in the store once, along with the number of items that can't be sized in advance and are left out
+func planRequired(s *store.Layout, stats *syncStats) (int64, int, error) {
+	var (
+		all      []ocispec.Descriptor
+		required int64
+		unknown  int
+	)
+	for _, p := range stats.planned {
+		switch {
+		case p.blobs != nil:
+			all = append(all, p.blobs...)
+		case p.size < 0:
+			unknown++
+		default:
+			required += p.size
+		}
+	}
+
+	missing, err := s.Missing(all)
+	if err != nil {
+		return 0, 0, err
+	}
+	return required + blobsSize(missing), unknown, nil
+}
+
+// blobsSize returns the combined size of descs, counting each digest once
+func blobsSize(descs []ocispec.Descriptor) int64 {
+	seen := make(map[digest.Digest]bool, len(descs))
+	var size int64
+	for _, d := range descs {
+		if !seen[d.Digest] {
+			seen[d.Digest] = true
+			size += d.Size
+		}
+	}
+	return size
+}
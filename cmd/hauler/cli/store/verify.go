@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rancherfederal/hauler/pkg/store"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+type VerifyOpts struct {
+	*RootOpts
+
+	Concurrency int
+}
+
+func (o *VerifyOpts) AddFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+
+	f.IntVar(&o.Concurrency, "concurrency", 4, "Number of blobs to hash at once")
+}
+
+func VerifyCmd(ctx context.Context, o *VerifyOpts, s *store.Layout) error {
+	l := log.FromContext(ctx)
+
+	if o.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got [%d]", o.Concurrency)
+	}
+
+	corrupt, err := s.Verify(ctx, store.WithVerifyConcurrency(o.Concurrency))
+	if err != nil {
+		return err
+	}
+
+	if len(corrupt) > 0 {
+		for _, d := range corrupt {
+			l.Errorf("blob [%s] is missing or corrupt", d)
+		}
+		return fmt.Errorf("store [%s] failed verification, [%d] blobs are missing or corrupt", s.Root, len(corrupt))
+	}
+
+	l.Infof("verified store [%s], every blob is present and matches its digest", s.Root)
+	return nil
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"embed"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/rancherfederal/hauler/cmd/hauler/cli"
 	"github.com/rancherfederal/hauler/pkg/cosign"
 	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/progress"
+	"github.com/rancherfederal/hauler/pkg/staging"
+	"github.com/rancherfederal/hauler/pkg/telemetry"
 )
 
 //go:embed binaries/*
@@ -17,8 +22,14 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	logger := log.NewLogger(os.Stdout)
-	ctx = logger.WithContext(ctx)
+	// an interrupt cancels the run so it cleans up after itself, a second one kills it as usual
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+
+	// logs are written through the progress display, so they're printed above its bars rather than through them
+	display := progress.NewDisplay(os.Stdout)
+	logger := log.NewLogger(display)
+	ctx = progress.WithContext(logger.WithContext(ctx), display)
 
 	// ensure cosign binary is available
 	if err := cosign.EnsureBinaryExists(ctx, binaries); err != nil {
@@ -26,7 +37,13 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := cli.New().ExecuteContext(ctx); err != nil {
+	err := cli.New().ExecuteContext(ctx)
+	// staging directories and spans still buffered are taken care of before exiting, os.Exit skips the deferred calls
+	staging.RemoveAll()
+	if terr := telemetry.Shutdown(context.WithoutCancel(ctx), err); terr != nil {
+		logger.Warnf("%v", terr)
+	}
+	if err != nil {
 		logger.Errorf("%v", err)
 		cancel()
 		os.Exit(1)
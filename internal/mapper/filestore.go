@@ -4,7 +4,6 @@ import (
 	"context"
 	"io/ioutil"
 	"os"
-	"path/filepath"
 	"strings"
 
 	ccontent "github.com/containerd/containerd/content"
@@ -47,6 +46,15 @@ type store struct {
 }
 
 func (s *pusher) Push(ctx context.Context, desc ocispec.Descriptor) (ccontent.Writer, error) {
+	// tar layers are extracted by us rather than content.File, to preserve the full tree and keep extraction safe
+	if desc.Annotations[content.AnnotationUnpack] == "true" {
+		w, err := newExtractWriter(s.store.ResolvePath(""), desc)
+		if err != nil {
+			return nil, errors.Wrap(err, "pushing file")
+		}
+		return w, nil
+	}
+
 	// TODO: This is suuuuuper ugly... redo this when oras v2 is out
 	if _, ok := content.ResolveName(desc); ok {
 		p, err := s.store.Pusher(ctx, s.ref)
@@ -66,7 +74,10 @@ func (s *pusher) Push(ctx context.Context, desc ocispec.Descriptor) (ccontent.Wr
 		return nil, err
 	}
 
-	fullFileName := filepath.Join(s.store.ResolvePath(""), filename)
+	fullFileName, err := SecureJoin(s.store.ResolvePath(""), filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "pushing file")
+	}
 	// TODO: Don't rewrite everytime, we can check the digest
 	f, err := os.OpenFile(fullFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
@@ -0,0 +1,81 @@
+package mapper
+
+import (
+	"archive/tar"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsafePath is returned when content would be written outside of the destination directory
+var ErrUnsafePath = errors.New("unsafe path")
+
+// SecureJoin joins the untrusted name onto root, returning ErrUnsafePath if the result would land outside of root
+//
+//	Names come from manifests and their annotations, so absolute paths and any traversal out of root are rejected
+//	rather than silently rewritten
+func SecureJoin(root string, name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("%w: empty name", ErrUnsafePath)
+	}
+	if filepath.IsAbs(name) || strings.HasPrefix(filepath.ToSlash(name), "/") || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w: [%s] is absolute", ErrUnsafePath, name)
+	}
+
+	base, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(base, filepath.Clean(name))
+	if !within(base, path) {
+		return "", fmt.Errorf("%w: [%s] escapes [%s]", ErrUnsafePath, name, root)
+	}
+	return path, nil
+}
+
+// CheckTarEntry validates a tar entry destined for root, returning the path it should be written to
+//
+//	The entry's name must stay within root, and hard and symbolic links may only point at other paths within root
+func CheckTarEntry(root string, hdr *tar.Header) (string, error) {
+	path, err := SecureJoin(root, hdr.Name)
+	if err != nil {
+		return "", err
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		if filepath.IsAbs(hdr.Linkname) || strings.HasPrefix(filepath.ToSlash(hdr.Linkname), "/") {
+			return "", fmt.Errorf("%w: symlink [%s] points to absolute path [%s]", ErrUnsafePath, hdr.Name, hdr.Linkname)
+		}
+
+		base, err := filepath.Abs(root)
+		if err != nil {
+			return "", err
+		}
+		// symlinks resolve relative to the directory containing them
+		if !within(base, filepath.Join(filepath.Dir(path), hdr.Linkname)) {
+			return "", fmt.Errorf("%w: symlink [%s] points outside of the destination to [%s]", ErrUnsafePath, hdr.Name, hdr.Linkname)
+		}
+
+	case tar.TypeLink:
+		// hardlinks are relative to the root of the archive
+		if _, err := SecureJoin(root, hdr.Linkname); err != nil {
+			return "", fmt.Errorf("hardlink [%s]: %w", hdr.Name, err)
+		}
+	}
+
+	return path, nil
+}
+
+// within reports whether path is base or is nested beneath it, both must be absolute and clean
+func within(base string, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	return rel != ".." && !strings.HasPrefix(rel, "../")
+}
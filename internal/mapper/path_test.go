@@ -0,0 +1,114 @@
+package mapper_test
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/internal/mapper"
+)
+
+func TestSecureJoin(t *testing.T) {
+	root := t.TempDir()
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain file", path: "chart.tar.gz", want: filepath.Join(root, "chart.tar.gz")},
+		{name: "nested file", path: "charts/chart.tar.gz", want: filepath.Join(root, "charts", "chart.tar.gz")},
+		{name: "traversal that stays inside", path: "a/../b.txt", want: filepath.Join(root, "b.txt")},
+		{name: "parent traversal", path: "../../etc/cron.d/evil", wantErr: true},
+		{name: "bare parent", path: "..", wantErr: true},
+		{name: "nested traversal", path: "a/../../evil", wantErr: true},
+		{name: "absolute path", path: "/etc/passwd", wantErr: true},
+		{name: "empty name", path: "", wantErr: true},
+		{name: "os separated traversal", path: filepath.Join("..", "..", "evil"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mapper.SecureJoin(root, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SecureJoin(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, mapper.ErrUnsafePath) {
+					t.Errorf("SecureJoin(%q) error = %v, want %v", tt.path, err, mapper.ErrUnsafePath)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("SecureJoin(%q) = %s, want %s", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTarEntry(t *testing.T) {
+	root := t.TempDir()
+
+	tests := []struct {
+		name    string
+		hdr     *tar.Header
+		wantErr bool
+	}{
+		{name: "regular file", hdr: &tar.Header{Name: "bin/k3s", Typeflag: tar.TypeReg}},
+		{name: "directory", hdr: &tar.Header{Name: "bin/", Typeflag: tar.TypeDir}},
+		{name: "relative symlink inside", hdr: &tar.Header{Name: "bin/kubectl", Typeflag: tar.TypeSymlink, Linkname: "k3s"}},
+		{name: "symlink to sibling directory", hdr: &tar.Header{Name: "bin/kubectl", Typeflag: tar.TypeSymlink, Linkname: "../lib/k3s"}},
+		{name: "hardlink inside", hdr: &tar.Header{Name: "bin/crictl", Typeflag: tar.TypeLink, Linkname: "bin/k3s"}},
+		{name: "file escaping root", hdr: &tar.Header{Name: "../evil", Typeflag: tar.TypeReg}, wantErr: true},
+		{name: "absolute file", hdr: &tar.Header{Name: "/etc/cron.d/evil", Typeflag: tar.TypeReg}, wantErr: true},
+		{name: "symlink escaping root", hdr: &tar.Header{Name: "bin/evil", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd"}, wantErr: true},
+		{name: "absolute symlink", hdr: &tar.Header{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}, wantErr: true},
+		{name: "hardlink escaping root", hdr: &tar.Header{Name: "evil", Typeflag: tar.TypeLink, Linkname: "../../etc/shadow"}, wantErr: true},
+		{name: "absolute hardlink", hdr: &tar.Header{Name: "evil", Typeflag: tar.TypeLink, Linkname: "/etc/shadow"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mapper.CheckTarEntry(root, tt.hdr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckTarEntry(%s -> %s) error = %v, wantErr %v", tt.hdr.Name, tt.hdr.Linkname, err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, mapper.ErrUnsafePath) {
+				t.Errorf("CheckTarEntry() error = %v, want %v", err, mapper.ErrUnsafePath)
+			}
+		})
+	}
+}
+
+func TestMapperFileStore_RejectsTraversal(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	const mediaType = "application/vnd.hauler.test.layer"
+	s := mapper.NewMapperFileStore(root, map[string]mapper.Fn{
+		mediaType: func(desc ocispec.Descriptor) (string, error) {
+			return desc.Annotations["name"], nil
+		},
+	})
+	defer s.Close()
+
+	p, err := s.Pusher(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"../../etc/cron.d/evil", "/etc/cron.d/evil", "nested/../../evil"} {
+		desc := ocispec.Descriptor{
+			MediaType:   mediaType,
+			Digest:      digest.FromString(name),
+			Annotations: map[string]string{"name": name},
+		}
+		if _, err := p.Push(ctx, desc); !errors.Is(err, mapper.ErrUnsafePath) {
+			t.Errorf("Push(%q) error = %v, want %v", name, err, mapper.ErrUnsafePath)
+		}
+	}
+}
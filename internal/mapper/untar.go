@@ -0,0 +1,285 @@
+package mapper
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"oras.land/oras-go/pkg/content"
+)
+
+// ErrUnsupportedEntry is returned when a tar layer holds an entry that can't be extracted, such as a device or fifo
+var ErrUnsupportedEntry = errors.New("unsupported tar entry")
+
+// Extract unpacks the tar stream r, optionally gzip compressed, into root
+//
+//	Directories, regular files, symlinks, and hardlinks are recreated with their permissions and modification times.
+//	Every entry is checked with CheckTarEntry, and nothing is ever written through a symlink, so a malicious archive
+//	can't place content outside of root.  Directory permissions are applied only once all of their contents have been
+//	written, so read-only directories still extract cleanly.
+func Extract(root string, r io.Reader) error {
+	r, err := maybeGunzip(r)
+	if err != nil {
+		return err
+	}
+
+	base, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return err
+	}
+
+	type dirEntry struct {
+		path string
+		hdr  *tar.Header
+	}
+	var dirs []dirEntry
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "reading tar")
+		}
+
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		path, err := CheckTarEntry(base, hdr)
+		if err != nil {
+			return err
+		}
+		if err := noSymlinks(base, filepath.Dir(path)); err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := mkdir(path); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirEntry{path: path, hdr: hdr})
+			continue
+
+		case tar.TypeReg:
+			err = extractFile(path, hdr, tr)
+
+		case tar.TypeSymlink:
+			err = replace(path, func() error { return os.Symlink(hdr.Linkname, path) })
+
+		case tar.TypeLink:
+			target, _ := SecureJoin(base, hdr.Linkname)
+			if err := noSymlinks(base, target); err != nil {
+				return err
+			}
+			err = replace(path, func() error { return os.Link(target, path) })
+
+		default:
+			return fmt.Errorf("%w: [%s] has type [%c]", ErrUnsupportedEntry, hdr.Name, hdr.Typeflag)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "extracting [%s]", hdr.Name)
+		}
+	}
+
+	// apply directory metadata deepest first, so restrictive permissions on a parent never block its children
+	sort.SliceStable(dirs, func(i, j int) bool { return len(dirs[i].path) > len(dirs[j].path) })
+	for _, d := range dirs {
+		if err := os.Chmod(d.path, d.hdr.FileInfo().Mode().Perm()); err != nil {
+			return errors.Wrapf(err, "extracting [%s]", d.hdr.Name)
+		}
+		chtimes(d.path, d.hdr)
+	}
+	return nil
+}
+
+func extractFile(path string, hdr *tar.Header, r io.Reader) error {
+	if err := mkdir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	// never open an existing symlink, it would write to wherever it points
+	if err := removeNonDir(path); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// set explicitly, the mode passed to OpenFile is subject to the umask
+	if err := os.Chmod(path, hdr.FileInfo().Mode().Perm()); err != nil {
+		return err
+	}
+	chtimes(path, hdr)
+	return nil
+}
+
+// replace creates a link at path with create, removing whatever non-directory is already there
+func replace(path string, create func() error) error {
+	if err := mkdir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if err := removeNonDir(path); err != nil {
+		return err
+	}
+	return create()
+}
+
+// mkdir creates path and its parents writable by the owner, final permissions are applied once extraction finishes
+func mkdir(path string) error {
+	fi, err := os.Lstat(path)
+	if err == nil {
+		if !fi.IsDir() {
+			return fmt.Errorf("[%s] already exists and is not a directory", path)
+		}
+		return nil
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+func removeNonDir(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("[%s] already exists and is a directory", path)
+	}
+	return os.Remove(path)
+}
+
+// noSymlinks returns ErrUnsafePath if any existing component of path below base is a symlink
+//
+//	Links are only checked lexically when they are extracted, so following one created by an earlier entry could still
+//	lead outside of base
+func noSymlinks(base string, path string) error {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+
+	cur := base
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, part)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%w: [%s] is written through symlink [%s]", ErrUnsafePath, path, cur)
+		}
+	}
+	return nil
+}
+
+func chtimes(path string, hdr *tar.Header) {
+	if hdr.ModTime.IsZero() {
+		return
+	}
+	atime := hdr.AccessTime
+	if atime.IsZero() {
+		atime = time.Now()
+	}
+	// best effort, same as the rest of the ecosystem's untar implementations
+	_ = os.Chtimes(path, atime, hdr.ModTime)
+}
+
+func maybeGunzip(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// extractWriter stages a tar layer in a temporary file, extracting it into root once the write is committed and verified
+type extractWriter struct {
+	ccontent.Writer
+
+	root     string
+	desc     ocispec.Descriptor
+	tmp      *os.File
+	digester digest.Digester
+}
+
+func newExtractWriter(root string, desc ocispec.Descriptor) (*extractWriter, error) {
+	tmp, err := os.CreateTemp("", "hauler-extract")
+	if err != nil {
+		return nil, err
+	}
+
+	digester := digest.Canonical.Digester()
+	return &extractWriter{
+		Writer:   content.NewIoContentWriter(io.MultiWriter(tmp, digester.Hash()), content.WithInputHash(desc.Digest), content.WithOutputHash(desc.Digest)),
+		root:     root,
+		desc:     desc,
+		tmp:      tmp,
+		digester: digester,
+	}, nil
+}
+
+func (w *extractWriter) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...ccontent.Opt) error {
+	defer w.cleanup()
+
+	if err := w.Writer.Commit(ctx, size, expected, opts...); err != nil {
+		return err
+	}
+	// the writer only reports the digest it was given, verify what was actually staged before unpacking any of it
+	if got := w.digester.Digest(); got != w.desc.Digest {
+		return fmt.Errorf("extracting [%s]: digest mismatch: got [%s]", w.desc.Digest, got)
+	}
+
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return Extract(w.root, w.tmp)
+}
+
+func (w *extractWriter) Close() error {
+	defer w.cleanup()
+	return w.Writer.Close()
+}
+
+func (w *extractWriter) cleanup() {
+	w.tmp.Close()
+	os.Remove(w.tmp.Name())
+}
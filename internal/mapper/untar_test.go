@@ -0,0 +1,200 @@
+package mapper_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/content"
+
+	"github.com/rancherfederal/hauler/internal/mapper"
+)
+
+type entry struct {
+	hdr  tar.Header
+	body string
+}
+
+func tarball(t *testing.T, compress bool, entries ...entry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var tw *tar.Writer
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(zw)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.body))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func toolchain() []entry {
+	return []entry{
+		{hdr: tar.Header{Name: "toolchain/", Typeflag: tar.TypeDir, Mode: 0755}},
+		// files may come before their directory's own entry, which is read-only once applied
+		{hdr: tar.Header{Name: "toolchain/bin/k3s", Typeflag: tar.TypeReg, Mode: 0755}, body: "#!/bin/sh\n"},
+		{hdr: tar.Header{Name: "toolchain/bin/", Typeflag: tar.TypeDir, Mode: 0555}},
+		{hdr: tar.Header{Name: "toolchain/etc/config.yaml", Typeflag: tar.TypeReg, Mode: 0600}, body: "key: value\n"},
+		{hdr: tar.Header{Name: "toolchain/var/empty/", Typeflag: tar.TypeDir, Mode: 0700}},
+		{hdr: tar.Header{Name: "toolchain/bin/kubectl", Typeflag: tar.TypeSymlink, Linkname: "k3s"}},
+		{hdr: tar.Header{Name: "toolchain/crictl", Typeflag: tar.TypeLink, Linkname: "toolchain/bin/k3s"}},
+	}
+}
+
+func checkToolchain(t *testing.T, root string) {
+	t.Helper()
+
+	modes := map[string]os.FileMode{
+		"toolchain":                 os.ModeDir | 0755,
+		"toolchain/bin":             os.ModeDir | 0555,
+		"toolchain/bin/k3s":         0755,
+		"toolchain/etc":             os.ModeDir | 0755,
+		"toolchain/etc/config.yaml": 0600,
+		"toolchain/var/empty":       os.ModeDir | 0700,
+		"toolchain/bin/kubectl":     os.ModeSymlink,
+		"toolchain/crictl":          0755,
+	}
+	for name, want := range modes {
+		fi, err := os.Lstat(filepath.Join(root, name))
+		if err != nil {
+			t.Errorf("expected [%s] to be extracted: %v", name, err)
+			continue
+		}
+		got := fi.Mode()
+		if got&os.ModeSymlink != 0 {
+			got = os.ModeSymlink
+		}
+		if got != want {
+			t.Errorf("[%s] mode = %s, want %s", name, got, want)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "toolchain/bin/kubectl"))
+	if err != nil || string(data) != "#!/bin/sh\n" {
+		t.Errorf("symlink contents = %q, %v", data, err)
+	}
+	data, err = os.ReadFile(filepath.Join(root, "toolchain/crictl"))
+	if err != nil || string(data) != "#!/bin/sh\n" {
+		t.Errorf("hardlink contents = %q, %v", data, err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		root := t.TempDir()
+		// the read-only directories would otherwise fail TempDir's cleanup
+		t.Cleanup(func() { os.Chmod(filepath.Join(root, "toolchain/bin"), 0755) })
+
+		if err := mapper.Extract(root, bytes.NewReader(tarball(t, compress, toolchain()...))); err != nil {
+			t.Fatalf("Extract(compress=%v) error = %v", compress, err)
+		}
+		checkToolchain(t, root)
+	}
+}
+
+func TestExtract_Rejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+		wantErr error
+	}{
+		{
+			name:    "traversal",
+			entries: []entry{{hdr: tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644}, body: "evil"}},
+			wantErr: mapper.ErrUnsafePath,
+		},
+		{
+			name: "writing through a symlink",
+			entries: []entry{
+				{hdr: tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755}},
+				{hdr: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "."}},
+				{hdr: tar.Header{Name: "link/evil", Typeflag: tar.TypeReg, Mode: 0644}, body: "evil"},
+			},
+			wantErr: mapper.ErrUnsafePath,
+		},
+		{
+			name:    "fifo",
+			entries: []entry{{hdr: tar.Header{Name: "pipe", Typeflag: tar.TypeFifo, Mode: 0644}}},
+			wantErr: mapper.ErrUnsupportedEntry,
+		},
+		{
+			name:    "device",
+			entries: []entry{{hdr: tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0666}}},
+			wantErr: mapper.ErrUnsupportedEntry,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			err := mapper.Extract(root, bytes.NewReader(tarball(t, false, tt.entries...)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Extract() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMapperFileStore_Unpack(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	t.Cleanup(func() { os.Chmod(filepath.Join(root, "toolchain/bin"), 0755) })
+
+	s := mapper.NewMapperFileStore(root, nil)
+	defer s.Close()
+
+	p, err := s.Pusher(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := tarball(t, true, toolchain()...)
+	desc := ocispec.Descriptor{
+		MediaType: "application/vnd.hauler.test.layer",
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+		Annotations: map[string]string{
+			ocispec.AnnotationTitle:  "toolchain",
+			content.AnnotationUnpack: "true",
+		},
+	}
+
+	w, err := p.Push(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(ctx, desc.Size, desc.Digest); err != nil {
+		t.Fatal(err)
+	}
+	checkToolchain(t, root)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Htpasswd maps users to the bcrypt hashes of their passwords, as read from an htpasswd file
+//
+//	Only bcrypt entries are supported, the same as the htpasswd auth of distribution, so a file works for both the
+//	read-only and the distribution backed registries.
+type Htpasswd map[string][]byte
+
+// ParseHtpasswd parses the user:hash entries of an htpasswd file, skipping blank lines and comments
+func ParseHtpasswd(r io.Reader) (Htpasswd, error) {
+	h := make(Htpasswd)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		t := strings.TrimSpace(scanner.Text())
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(t, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("invalid htpasswd entry at line [%d]", line)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("htpasswd entry of [%s] at line [%d] is not a bcrypt hash", user, line)
+		}
+		h[user] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// LoadHtpasswd reads the htpasswd file at path
+func LoadHtpasswd(path string) (Htpasswd, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h, err := ParseHtpasswd(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading [%s]: %w", path, err)
+	}
+	if len(h) == 0 {
+		return nil, fmt.Errorf("[%s] has no users", path)
+	}
+	return h, nil
+}
+
+// WriteHtpasswd writes an htpasswd file at path with the single user username, hashing password with bcrypt
+func WriteHtpasswd(path string, username string, password string) error {
+	if username == "" || strings.Contains(username, ":") {
+		return fmt.Errorf("invalid username [%s]", username)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(fmt.Sprintf("%s:%s\n", username, hash)), 0600)
+}
+
+// Authenticate reports whether password is that of username
+func (h Htpasswd) Authenticate(username string, password string) bool {
+	hash, ok := h[username]
+	if !ok {
+		// compare anyway so unknown users take as long to reject as wrong passwords
+		bcrypt.CompareHashAndPassword(unknownUserHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
+
+// unknownUserHash is the hash of no user's password, only ever compared against to keep rejections constant time
+var unknownUserHash = []byte("$2a$10$LHPY9jzPf/P8w6FNQ4k7GOtYXbBYke1oe.Df6jj7P7nn14HVuh4Ta")
+
+// basicAuth only passes requests with the credentials of a user of h on to next, calling unauthorized on any other
+// after setting the basic auth challenge of realm
+func basicAuth(next http.Handler, realm string, h Htpasswd, unauthorized http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, pass, ok := req.BasicAuth()
+		if ok && h.Authenticate(user, pass) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+		unauthorized(w, req)
+	})
+}
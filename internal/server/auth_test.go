@@ -0,0 +1,71 @@
+package server_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancherfederal/hauler/internal/server"
+)
+
+func TestHtpasswd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	if err := server.WriteHtpasswd(path, "hauler", "haulin"); err != nil {
+		t.Fatalf("WriteHtpasswd() error = %v", err)
+	}
+	h, err := server.LoadHtpasswd(path)
+	if err != nil {
+		t.Fatalf("LoadHtpasswd() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     bool
+	}{
+		{name: "valid", username: "hauler", password: "haulin", want: true},
+		{name: "wrong password", username: "hauler", password: "hauling"},
+		{name: "unknown user", username: "bob", password: "haulin"},
+		{name: "empty", username: "", password: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.Authenticate(tt.username, tt.password); got != tt.want {
+				t.Errorf("Authenticate(%s, %s) = %v, want %v", tt.username, tt.password, got, tt.want)
+			}
+		})
+	}
+
+	if err := server.WriteHtpasswd(path, "ha:uler", "haulin"); err == nil {
+		t.Errorf("WriteHtpasswd() with a colon in the username should fail")
+	}
+}
+
+func TestParseHtpasswd(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		users   int
+		wantErr bool
+	}{
+		{
+			name:  "bcrypt entries with comments",
+			data:  "# users\n\nhauler:$2y$05$6fTn4JEjx.ULLJYxHQCh9.JWNmXaqR4rEKoHfXrglALwiP8nRtMfe\n",
+			users: 1,
+		},
+		{name: "missing separator", data: "hauler\n", wantErr: true},
+		{name: "not bcrypt", data: "hauler:{SHA}0DPiKuNIrrVmD8IUCuw1hQxNqZc=\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := server.ParseHtpasswd(strings.NewReader(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHtpasswd() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(h) != tt.users {
+				t.Errorf("ParseHtpasswd() = %d users, want %d", len(h), tt.users)
+			}
+		})
+	}
+}
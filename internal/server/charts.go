@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+// ChartsPath is the path of the helm repository of the fileserver, added to helm as http://<host>:<port>/charts
+const ChartsPath = "/charts/"
+
+// charts serves the helm repository of the charts in the store, its index.yaml, chart archives, and provenance files
+func (f *storeFiles) charts(w http.ResponseWriter, req *http.Request) {
+	charts, err := f.store.Charts(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := strings.TrimPrefix(req.URL.Path, ChartsPath)
+	switch name {
+	case "":
+		var names []string
+		for name := range charts {
+			names = append(names, name)
+		}
+		listing(w, names)
+		return
+
+	case "index.yaml":
+		data, err := chartIndex(charts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-yaml")
+		if req.Method != http.MethodHead {
+			w.Write(data)
+		}
+		return
+	}
+
+	if c, ok := charts[name]; ok {
+		f.serveBlob(w, req, name, c.Archive)
+		return
+	}
+	if c, ok := charts[strings.TrimSuffix(name, ".prov")]; ok && strings.HasSuffix(name, ".prov") && c.Provenance != nil {
+		f.serveBlob(w, req, name, *c.Provenance)
+		return
+	}
+	http.NotFound(w, req)
+}
+
+// chartIndex returns the index.yaml of charts, keyed by their archive filenames
+//
+//	Chart urls are relative to the index, so the repository works under whatever host and port it's served at.  When
+//	several archives hold the same version of a chart, the first in sorted order is indexed.
+func chartIndex(charts map[string]store.Chart) ([]byte, error) {
+	var names []string
+	for name := range charts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	idx := repo.NewIndexFile()
+	for _, name := range names {
+		c := charts[name]
+		if idx.Has(c.Metadata.Name, c.Metadata.Version) {
+			continue
+		}
+		if err := idx.MustAdd(c.Metadata, name, "", c.Archive.Digest.Encoded()); err != nil {
+			return nil, err
+		}
+	}
+	idx.SortEntries()
+	return yaml.Marshal(idx)
+}
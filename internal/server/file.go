@@ -15,13 +15,21 @@ type FileConfig struct {
 	Root string
 	Host string
 	Port int
+	TLS  TLSConfig
+
+	// Htpasswd are the users allowed to download from the server, when nil it's served anonymously
+	Htpasswd Htpasswd
+
+	// Metrics counts the requests served, and serves them at MetricsPath, when not nil
+	Metrics *Metrics
 }
 
 // NewFile returns a fileserver
 // TODO: Better configs
 func NewFile(ctx context.Context, cfg FileConfig) (Server, error) {
 	r := mux.NewRouter()
-	r.PathPrefix("/").Handler(handlers.LoggingHandler(os.Stdout, http.StripPrefix("/", http.FileServer(http.Dir(cfg.Root)))))
+	handler := fileAuth(http.StripPrefix("/", http.FileServer(http.Dir(cfg.Root))), cfg.Htpasswd)
+	r.PathPrefix("/").Handler(handlers.LoggingHandler(os.Stdout, handler))
 	if cfg.Root == "" {
 		cfg.Root = "."
 	}
@@ -37,5 +45,15 @@ func NewFile(ctx context.Context, cfg FileConfig) (Server, error) {
 		ReadTimeout:  15 * time.Second,
 	}
 
-	return srv, nil
+	return &tlsServer{Server: srv, tls: cfg.TLS}, nil
+}
+
+// fileAuth requires basic auth of the users of h for downloading from next, unless h is nil
+func fileAuth(next http.Handler, h Htpasswd) http.Handler {
+	if h == nil {
+		return next
+	}
+	return basicAuth(next, "hauler", h, func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
 }
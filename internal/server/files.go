@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/handlers"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+// NewStoreFiles returns a fileserver of the file artifacts of s, served straight from its oci layout under their
+// original filenames
+//
+//	Files support range requests and conditional requests against their digest, so interrupted downloads of large
+//	files can be resumed.  The root lists every file served.  cfg.Root is ignored, and with cfg.Metrics set a file named
+//	after MetricsPath is shadowed by the metrics.
+//
+//	The charts of s are served under ChartsPath as a helm repository, with an index.yaml generated from the store.
+func NewStoreFiles(s *store.Layout, cfg FileConfig) Server {
+	if cfg.Port == 0 {
+		cfg.Port = 8080
+	}
+
+	srv := &http.Server{
+		Handler:           handlers.LoggingHandler(os.Stdout, NewStoreFilesHandler(s, cfg)),
+		Addr:              fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		ReadHeaderTimeout: 15 * time.Second,
+	}
+	return &tlsServer{Server: srv, tls: cfg.TLS}
+}
+
+// fileKind classifies a fileserver request as that of a file or of the listing of them, for metrics
+func fileKind(req *http.Request) string {
+	switch req.URL.Path {
+	case "/", ChartsPath:
+		return "listing"
+	case ChartsPath + "index.yaml":
+		return "index"
+	}
+	return "file"
+}
+
+// NewStoreFilesHandler returns the http.Handler of NewStoreFiles, for serving it on a server of the caller's own
+//
+//	The handler covers everything in cfg but the address and TLS, which are up to the server.
+func NewStoreFilesHandler(s *store.Layout, cfg FileConfig) http.Handler {
+	handler := fileAuth(cfg.Metrics.instrument("files", fileKind, &storeFiles{store: s}), cfg.Htpasswd)
+	return traced("files", fileKind, handler)
+}
+
+type storeFiles struct {
+	store *store.Layout
+}
+
+func (f *storeFiles) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if strings.HasPrefix(req.URL.Path, ChartsPath) {
+		f.charts(w, req)
+		return
+	}
+
+	files, err := f.store.Files(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := strings.TrimPrefix(req.URL.Path, "/")
+	if name == "" {
+		f.list(w, files)
+		return
+	}
+
+	desc, ok := files[name]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	f.serveBlob(w, req, name, desc)
+}
+
+// serveBlob writes the blob of desc as the file name
+func (f *storeFiles) serveBlob(w http.ResponseWriter, req *http.Request, name string, desc ocispec.Descriptor) {
+	blob, err := f.store.OpenBlob(desc.Digest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("ETag", fmt.Sprintf("%q", desc.Digest.String()))
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+	http.ServeContent(w, req, name, time.Time{}, blob)
+}
+
+// list writes the links to every file, in the style of the directory listings of http.FileServer
+func (f *storeFiles) list(w http.ResponseWriter, files map[string]ocispec.Descriptor) {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	listing(w, names)
+}
+
+// listing writes the links to each of names
+func listing(w http.ResponseWriter, names []string) {
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintln(w, "<pre>")
+	for _, name := range names {
+		u := url.URL{Path: name}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(u.String()), html.EscapeString(name))
+	}
+	fmt.Fprintln(w, "</pre>")
+}
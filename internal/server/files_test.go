@@ -0,0 +1,168 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rancherfederal/hauler/internal/server"
+	"github.com/rancherfederal/hauler/pkg/artifacts/file"
+	"github.com/rancherfederal/hauler/pkg/content/chart"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+func TestStoreFiles(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(t.TempDir(), "install.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho haulin\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, file.NewFile(script), "hauler/install.sh:latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(server.NewStoreFilesHandler(s, server.FileConfig{}))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header http.Header
+		want   int
+		body   string
+	}{
+		{name: "listing", method: http.MethodGet, path: "/", want: http.StatusOK, body: `<a href="install.sh">install.sh</a>`},
+		{name: "file", method: http.MethodGet, path: "/install.sh", want: http.StatusOK, body: "#!/bin/sh\necho haulin\n"},
+		{name: "range", method: http.MethodGet, path: "/install.sh", header: http.Header{"Range": {"bytes=10-"}}, want: http.StatusPartialContent, body: "echo haulin\n"},
+		{name: "unknown file", method: http.MethodGet, path: "/missing.sh", want: http.StatusNotFound},
+		{name: "upload", method: http.MethodPut, path: "/install.sh", want: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(body), tt.body) {
+				t.Errorf("%s %s body = %q, want it to contain %q", tt.method, tt.path, body, tt.body)
+			}
+		})
+	}
+}
+
+func TestStoreFiles_Charts(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a copy of the test chart with a provenance file beside it
+	data, err := os.ReadFile("../../testdata/rancher-cluster-templates-0.4.4.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "rancher-cluster-templates-0.4.4.tgz")
+	if err := os.WriteFile(archive, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archive+".prov", []byte("signed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := chart.NewChart(archive, &action.ChartPathOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, c, "hauler/rancher-cluster-templates:0.4.4"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(server.NewStoreFilesHandler(s, server.FileConfig{}))
+	defer srv.Close()
+
+	get := func(path string) (int, []byte) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, body
+	}
+
+	code, body := get(server.ChartsPath + "index.yaml")
+	if code != http.StatusOK {
+		t.Fatalf("GET index.yaml = %d, want %d", code, http.StatusOK)
+	}
+	var idx repo.IndexFile
+	if err := yaml.Unmarshal(body, &idx); err != nil {
+		t.Fatal(err)
+	}
+	cv, err := idx.Get("rancher-cluster-templates", "0.4.4")
+	if err != nil {
+		t.Fatalf("index.yaml: %v\n%s", err, body)
+	}
+	if len(cv.URLs) != 1 || cv.URLs[0] != "rancher-cluster-templates-0.4.4.tgz" {
+		t.Fatalf("index.yaml urls = %v, want [rancher-cluster-templates-0.4.4.tgz]", cv.URLs)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want int
+		body string
+	}{
+		{name: "listing", path: server.ChartsPath, want: http.StatusOK, body: `<a href="rancher-cluster-templates-0.4.4.tgz">`},
+		{name: "chart", path: server.ChartsPath + cv.URLs[0], want: http.StatusOK, body: string(data)},
+		{name: "provenance", path: server.ChartsPath + cv.URLs[0] + ".prov", want: http.StatusOK, body: "signed\n"},
+		{name: "unknown chart", path: server.ChartsPath + "missing-1.0.0.tgz", want: http.StatusNotFound},
+		{name: "charts aren't files", path: "/" + cv.URLs[0], want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := get(tt.path)
+			if code != tt.want {
+				t.Errorf("GET %s = %d, want %d", tt.path, code, tt.want)
+			}
+			if !strings.Contains(string(body), tt.body) {
+				t.Errorf("GET %s body = %q, want it to contain %q", tt.path, body, tt.body)
+			}
+		})
+	}
+}
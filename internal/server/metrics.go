@@ -0,0 +1,127 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsPath is where servers with metrics serve them
+const MetricsPath = "/metrics"
+
+// Metrics are the prometheus counters of the requests a server has served
+//
+//	Counters are kept in a registry of their own rather than the default one, which distribution registers its own
+//	metrics with.  A nil *Metrics counts nothing, for servers without metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	bytes    *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	cache    *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "hauler",
+			Subsystem: "serve",
+			Name:      "requests_total",
+			Help:      "Requests served, by server, kind of content requested, and status code.",
+		}, []string{"server", "kind", "code"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "hauler",
+			Subsystem: "serve",
+			Name:      "bytes_total",
+			Help:      "Bytes of response bodies served, by server and kind of content requested.",
+		}, []string{"server", "kind"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "hauler",
+			Subsystem: "serve",
+			Name:      "errors_total",
+			Help:      "Requests failed with a server error, by server and kind of content requested.",
+		}, []string{"server", "kind"}),
+		cache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "hauler",
+			Subsystem: "serve",
+			Name:      "cache_requests_total",
+			Help:      "Manifest requests of a pull-through cache, by whether they hit the store, were cached from upstream, or failed to be.",
+		}, []string{"result"}),
+	}
+	m.registry.MustRegister(m.requests, m.bytes, m.errors, m.cache)
+	return m
+}
+
+// Handler returns the handler serving the metrics in the prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// instrument counts the requests to next as those of server, with kind classifying what each of them requested, and
+// serves the metrics themselves at MetricsPath
+func (m *Metrics) instrument(server string, kind func(*http.Request) string, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+
+	metrics := m.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == MetricsPath {
+			metrics.ServeHTTP(w, req)
+			return
+		}
+
+		rw := &countingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, req)
+
+		k := kind(req)
+		m.requests.WithLabelValues(server, k, strconv.Itoa(rw.status)).Inc()
+		m.bytes.WithLabelValues(server, k).Add(float64(rw.written))
+		if rw.status >= http.StatusInternalServerError {
+			m.errors.WithLabelValues(server, k).Inc()
+		}
+	})
+}
+
+// cacheResult counts a manifest request of a pull-through cache as a hit, miss, or error
+func (m *Metrics) cacheResult(result string) {
+	if m == nil {
+		return
+	}
+	m.cache.WithLabelValues(result).Inc()
+}
+
+// countingWriter records the status and body size of a response
+type countingWriter struct {
+	http.ResponseWriter
+	status      int
+	written     int64
+	wroteHeader bool
+}
+
+func (w *countingWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps the io.ReaderFrom of the underlying writer, which http.ServeContent relies on for sending files
+func (w *countingWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.wroteHeader = true
+	n, err := io.Copy(w.ResponseWriter, r)
+	w.written += n
+	return n, err
+}
@@ -0,0 +1,444 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+// maxManifestSize is the size past which a blob is never served as a manifest
+const maxManifestSize = 4 << 20
+
+type StoreRegistryConfig struct {
+	Host string
+	Port int
+	TLS  TLSConfig
+
+	// Htpasswd are the users allowed to pull from the registry, when nil it's served anonymously
+	Htpasswd Htpasswd
+
+	// Upstream caches content missing from the store, when nil the registry only serves what's already in it
+	Upstream Upstream
+
+	// Metrics counts the requests served, and serves them at MetricsPath, when not nil
+	Metrics *Metrics
+}
+
+// Upstream caches the manifest ref of the repository repo from an upstream registry into the store, along with
+// everything it references
+//
+//	A registry with an upstream acts as a pull-through cache: manifests missing from the store are cached before being
+//	served, so the store ends up holding everything pulled through it and can be saved as a haul afterwards.  Content
+//	already in the store is served as is, without checking upstream for newer content under the same tag.
+type Upstream func(ctx context.Context, repo string, ref string) error
+
+// NewStoreRegistry returns a read-only registry serving the content of s straight from its oci layout
+//
+//	Only the pull side of the Docker Registry v2 API is implemented: manifests, blobs, tag lists, the catalog, and the
+//	OCI 1.1 referrers api.
+//	Repositories and tags are those the store's content would be pushed to by a copy to a registry, and any attempt to
+//	push or delete fails as unsupported.
+func NewStoreRegistry(s *store.Layout, cfg StoreRegistryConfig) Server {
+	if cfg.Port == 0 {
+		cfg.Port = 5000
+	}
+
+	srv := &http.Server{
+		Handler:           handlers.LoggingHandler(os.Stdout, NewStoreRegistryHandler(s, cfg)),
+		Addr:              fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		ReadHeaderTimeout: 15 * time.Second,
+	}
+	return &tlsServer{Server: srv, tls: cfg.TLS}
+}
+
+// NewStoreRegistryHandler returns the http.Handler of NewStoreRegistry, for serving it on a server of the caller's own
+//
+//	The handler covers everything in cfg but the address and TLS, which are up to the server.
+func NewStoreRegistryHandler(s *store.Layout, cfg StoreRegistryConfig) http.Handler {
+	reg := &storeRegistry{store: s, upstream: cfg.Upstream, metrics: cfg.Metrics}
+	handler := cfg.Metrics.instrument("registry", registryKind, reg)
+	if cfg.Htpasswd != nil {
+		handler = basicAuth(handler, "hauler", cfg.Htpasswd, func(w http.ResponseWriter, req *http.Request) {
+			(&registryError{http.StatusUnauthorized, "UNAUTHORIZED", "authentication required"}).write(w)
+		})
+	}
+	return traced("registry", registryKind, handler)
+}
+
+type storeRegistry struct {
+	store    *store.Layout
+	upstream Upstream
+
+	// fillMu serializes caching from upstream, which writes to the store's index
+	fillMu sync.Mutex
+
+	metrics *Metrics
+}
+
+// registryKind classifies a registry request by the kind of content it requests, for metrics
+func registryKind(req *http.Request) string {
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case p == req.URL.Path:
+		return "other"
+	case p == "":
+		return "base"
+	case p == "_catalog":
+		return "catalog"
+	case strings.HasSuffix(p, "/tags/list"):
+		return "tags"
+	case strings.Contains(p, "/referrers/"):
+		return "referrers"
+	case strings.Contains(p, "/manifests/"):
+		return "manifest"
+	case strings.Contains(p, "/blobs/"):
+		return "blob"
+	}
+	return "other"
+}
+
+// registryError is an error as returned by the Docker Registry v2 API
+type registryError struct {
+	status  int
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *registryError) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(struct {
+		Errors []*registryError `json:"errors"`
+	}{[]*registryError{e}})
+}
+
+func (r *storeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		(&registryError{http.StatusMethodNotAllowed, "UNSUPPORTED", "the registry is read-only"}).write(w)
+		return
+	}
+
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case p == req.URL.Path:
+		http.NotFound(w, req)
+	case p == "":
+		w.WriteHeader(http.StatusOK)
+	case p == "_catalog":
+		r.catalog(w, req)
+	case strings.HasSuffix(p, "/tags/list"):
+		r.tags(w, req, strings.TrimSuffix(p, "/tags/list"))
+	case strings.Contains(p, "/referrers/"):
+		i := strings.LastIndex(p, "/referrers/")
+		r.referrers(w, req, p[:i], p[i+len("/referrers/"):])
+	case strings.Contains(p, "/manifests/"):
+		i := strings.LastIndex(p, "/manifests/")
+		r.manifest(w, req, p[:i], p[i+len("/manifests/"):])
+	case strings.Contains(p, "/blobs/"):
+		i := strings.LastIndex(p, "/blobs/")
+		r.blob(w, req, p[:i], p[i+len("/blobs/"):])
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// repository returns the tags of the repository name, writing a NAME_UNKNOWN error if the store has no such repository
+func (r *storeRegistry) repository(w http.ResponseWriter, name string) (map[string]ocispec.Descriptor, bool) {
+	tags, rerr := r.lookup(name)
+	if rerr != nil {
+		rerr.write(w)
+		return nil, false
+	}
+	return tags, true
+}
+
+func (r *storeRegistry) lookup(name string) (map[string]ocispec.Descriptor, *registryError) {
+	repos, err := r.store.Repositories()
+	if err != nil {
+		return nil, &registryError{http.StatusInternalServerError, "UNKNOWN", err.Error()}
+	}
+	tags, ok := repos[name]
+	if !ok {
+		return nil, &registryError{http.StatusNotFound, "NAME_UNKNOWN", fmt.Sprintf("repository [%s] is not in the store", name)}
+	}
+	return tags, nil
+}
+
+// resolve opens the manifest ref of the repository name, ref being either a tag or a digest
+func (r *storeRegistry) resolve(name string, ref string) (ocispec.Descriptor, *os.File, *registryError) {
+	tags, rerr := r.lookup(name)
+	if rerr != nil {
+		return ocispec.Descriptor{}, nil, rerr
+	}
+
+	var desc ocispec.Descriptor
+	if d, err := digest.Parse(ref); err == nil {
+		desc.Digest = d
+		for _, t := range tags {
+			if t.Digest == d {
+				desc = t
+				break
+			}
+		}
+	} else if t, ok := tags[ref]; ok {
+		desc = t
+	} else {
+		return ocispec.Descriptor{}, nil, &registryError{http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest [%s:%s] is not in the store", name, ref)}
+	}
+
+	f, err := r.store.OpenBlob(desc.Digest)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, &registryError{http.StatusNotFound, "MANIFEST_UNKNOWN", err.Error()}
+	}
+	return desc, f, nil
+}
+
+// fill caches the manifest ref of the repository name from upstream
+func (r *storeRegistry) fill(ctx context.Context, name string, ref string) error {
+	r.fillMu.Lock()
+	defer r.fillMu.Unlock()
+
+	// another request may have cached it while this one waited
+	if _, f, rerr := r.resolve(name, ref); rerr == nil {
+		f.Close()
+		return nil
+	}
+	return r.upstream(ctx, name, ref)
+}
+
+func (r *storeRegistry) manifest(w http.ResponseWriter, req *http.Request, name string, ref string) {
+	desc, f, rerr := r.resolve(name, ref)
+	if r.upstream != nil {
+		switch {
+		case rerr == nil:
+			r.metrics.cacheResult("hit")
+		case rerr.status == http.StatusNotFound:
+			if err := r.fill(req.Context(), name, ref); err != nil {
+				r.metrics.cacheResult("error")
+				(&registryError{http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("caching [%s:%s] from upstream: %v", name, ref, err)}).write(w)
+				return
+			}
+			r.metrics.cacheResult("miss")
+			desc, f, rerr = r.resolve(name, ref)
+		}
+	}
+	if rerr != nil {
+		rerr.write(w)
+		return
+	}
+	defer f.Close()
+
+	if fi, err := f.Stat(); err != nil || fi.Size() > maxManifestSize {
+		(&registryError{http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("[%s] is not a manifest", desc.Digest)}).write(w)
+		return
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		(&registryError{http.StatusInternalServerError, "UNKNOWN", err.Error()}).write(w)
+		return
+	}
+
+	// manifests only referenced by an index, such as those of each platform, have no descriptor of their own
+	mediaType := desc.MediaType
+	if mediaType == "" {
+		if mediaType = manifestMediaType(data); mediaType == "" {
+			(&registryError{http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("[%s] is not a manifest", desc.Digest)}).write(w)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+	w.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// manifestMediaType returns the media type of a manifest or index, or "" if data is neither
+func manifestMediaType(data []byte) string {
+	var m struct {
+		MediaType string          `json:"mediaType"`
+		Manifests json.RawMessage `json:"manifests"`
+		Config    json.RawMessage `json:"config"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return ""
+	}
+	switch {
+	case m.MediaType != "":
+		return m.MediaType
+	case m.Manifests != nil:
+		return consts.OCIImageIndexSchema
+	case m.Config != nil:
+		return consts.OCIManifestSchema1
+	}
+	return ""
+}
+
+// referrers serves the OCI 1.1 referrers api, listing the referrers in the store whose subject is ref
+//
+//	Referrers are filtered by the artifactType query parameter when given, as the api allows.
+func (r *storeRegistry) referrers(w http.ResponseWriter, req *http.Request, name string, ref string) {
+	if _, ok := r.repository(w, name); !ok {
+		return
+	}
+
+	d, err := digest.Parse(ref)
+	if err != nil {
+		(&registryError{http.StatusBadRequest, "DIGEST_INVALID", err.Error()}).write(w)
+		return
+	}
+	referrers, err := r.store.Referrers(req.Context(), d)
+	if err != nil {
+		(&registryError{http.StatusInternalServerError, "UNKNOWN", err.Error()}).write(w)
+		return
+	}
+
+	idx := ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: consts.OCIImageIndexSchema,
+		Manifests: []ocispec.Descriptor{},
+	}
+	artifactType := req.URL.Query().Get("artifactType")
+	for _, desc := range referrers {
+		if artifactType == "" || desc.ArtifactType == artifactType {
+			idx.Manifests = append(idx.Manifests, desc)
+		}
+	}
+	if artifactType != "" {
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+
+	w.Header().Set("Content-Type", consts.OCIImageIndexSchema)
+	if req.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(idx)
+	}
+}
+
+func (r *storeRegistry) blob(w http.ResponseWriter, req *http.Request, name string, ref string) {
+	if _, ok := r.repository(w, name); !ok {
+		return
+	}
+
+	d, err := digest.Parse(ref)
+	if err != nil {
+		(&registryError{http.StatusBadRequest, "DIGEST_INVALID", err.Error()}).write(w)
+		return
+	}
+
+	f, err := r.store.OpenBlob(d)
+	if errors.Is(err, store.ErrDigestNotFound) {
+		(&registryError{http.StatusNotFound, "BLOB_UNKNOWN", err.Error()}).write(w)
+		return
+	}
+	if err != nil {
+		(&registryError{http.StatusInternalServerError, "UNKNOWN", err.Error()}).write(w)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", d.String())
+	http.ServeContent(w, req, "", time.Time{}, f)
+}
+
+func (r *storeRegistry) tags(w http.ResponseWriter, req *http.Request, name string) {
+	tags, ok := r.repository(w, name)
+	if !ok {
+		return
+	}
+
+	var list []string
+	for t := range tags {
+		list = append(list, t)
+	}
+
+	page, ok := paginate(w, req, list)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}{name, page})
+}
+
+func (r *storeRegistry) catalog(w http.ResponseWriter, req *http.Request) {
+	repos, err := r.store.Repositories()
+	if err != nil {
+		(&registryError{http.StatusInternalServerError, "UNKNOWN", err.Error()}).write(w)
+		return
+	}
+
+	var list []string
+	for repo := range repos {
+		list = append(list, repo)
+	}
+
+	page, ok := paginate(w, req, list)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Repositories []string `json:"repositories"`
+	}{page})
+}
+
+// paginate sorts items and returns the page of them requested by the n and last query parameters, setting the Link
+// header to the next page when there's more
+func paginate(w http.ResponseWriter, req *http.Request, items []string) ([]string, bool) {
+	sort.Strings(items)
+
+	q := req.URL.Query()
+	if last := q.Get("last"); last != "" {
+		i := sort.SearchStrings(items, last)
+		if i < len(items) && items[i] == last {
+			i++
+		}
+		items = items[i:]
+	}
+
+	if v := q.Get("n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			(&registryError{http.StatusBadRequest, "PAGINATION_NUMBER_INVALID", fmt.Sprintf("invalid page size [%s]", v)}).write(w)
+			return nil, false
+		}
+		if n < len(items) {
+			items = items[:n]
+			if n > 0 {
+				next := url.Values{"n": {v}, "last": {items[n-1]}}
+				w.Header().Set("Link", fmt.Sprintf("<%s?%s>; rel=\"next\"", req.URL.Path, next.Encode()))
+			}
+		}
+	}
+
+	if items == nil {
+		items = []string{}
+	}
+	return items, true
+}
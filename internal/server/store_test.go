@@ -0,0 +1,318 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+
+	"github.com/rancherfederal/hauler/internal/server"
+	"github.com/rancherfederal/hauler/pkg/artifacts/memory"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+type randomArtifact struct {
+	v1.Image
+}
+
+func (a randomArtifact) MediaType() string {
+	mt, err := a.Image.MediaType()
+	if err != nil {
+		return ""
+	}
+	return string(mt)
+}
+
+func (a randomArtifact) RawConfig() ([]byte, error) {
+	return a.RawConfigFile()
+}
+
+func TestStoreRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := s.AddOCI(ctx, randomArtifact{img}, "index.docker.io/library/busybox:stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("hauler"), "application/octet-stream"), "hauler/file.txt:latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(server.NewStoreRegistryHandler(s, server.StoreRegistryConfig{}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	reg, err := name.NewRegistry(host, name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos, err := remote.Catalog(ctx, reg)
+	if err != nil {
+		t.Fatalf("Catalog() error = %v", err)
+	}
+	if want := []string{"hauler/file.txt", "library/busybox"}; !reflect.DeepEqual(repos, want) {
+		t.Errorf("Catalog() = %v, want %v", repos, want)
+	}
+
+	repo, err := name.NewRepository(host+"/library/busybox", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := remote.List(repo)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := []string{"stable"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("List() = %v, want %v", tags, want)
+	}
+
+	pulled, err := remote.Image(repo.Tag("stable"))
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	if err := validate.Image(pulled); err != nil {
+		t.Errorf("pulled image is invalid: %v", err)
+	}
+	if d, err := pulled.Digest(); err != nil || d.String() != desc.Digest.String() {
+		t.Errorf("pulled image digest = %v, %v, want %s", d, err, desc.Digest)
+	}
+	if _, err := remote.Image(repo.Digest(desc.Digest.String())); err != nil {
+		t.Errorf("Image() by digest error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{name: "unknown repository", method: http.MethodGet, path: "/v2/library/missing/manifests/stable", want: http.StatusNotFound},
+		{name: "unknown tag", method: http.MethodGet, path: "/v2/library/busybox/manifests/missing", want: http.StatusNotFound},
+		{name: "unknown blob", method: http.MethodHead, path: "/v2/library/busybox/blobs/sha256:" + strings.Repeat("0", 64), want: http.StatusNotFound},
+		{name: "push", method: http.MethodPut, path: "/v2/library/busybox/manifests/pushed", want: http.StatusMethodNotAllowed},
+		{name: "delete", method: http.MethodDelete, path: "/v2/library/busybox/manifests/stable", want: http.StatusMethodNotAllowed},
+		{name: "invalid page size", method: http.MethodGet, path: "/v2/_catalog?n=-1", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreRegistry_Referrers(t *testing.T) {
+	ctx := context.Background()
+
+	src := httptest.NewServer(registry.New(registry.WithReferrersSupport(true)))
+	defer src.Close()
+	ref, err := name.ParseReference(strings.TrimPrefix(src.URL, "http://") + "/library/busybox:stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	subject, err := partial.Descriptor(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbom, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbom = mutate.ConfigMediaType(mutate.MediaType(sbom, types.OCIManifestSchema1), "application/spdx+json")
+	sbom = mutate.Subject(sbom, *subject).(v1.Image)
+	sbomDigest, err := sbom.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref.Context().Digest(sbomDigest.String()), sbom); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, randomArtifact{img}, ref.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddReferrers(ctx, ref.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(server.NewStoreRegistryHandler(s, server.StoreRegistryConfig{}))
+	defer srv.Close()
+	repo, err := name.NewRepository(strings.TrimPrefix(srv.URL, "http://")+"/library/busybox", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tag must still resolve to the image rather than its referrer
+	if tags, err := remote.List(repo); err != nil || !reflect.DeepEqual(tags, []string{"stable"}) {
+		t.Errorf("List() = %v, %v, want [stable]", tags, err)
+	}
+
+	tests := []struct {
+		name         string
+		artifactType string
+		want         []v1.Hash
+	}{
+		{name: "all", want: []v1.Hash{sbomDigest}},
+		{name: "matching artifact type", artifactType: "application/spdx+json", want: []v1.Hash{sbomDigest}},
+		{name: "other artifact type", artifactType: "application/vnd.cyclonedx+json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []remote.Option
+			if tt.artifactType != "" {
+				opts = append(opts, remote.WithFilter("artifactType", tt.artifactType))
+			}
+			idx, err := remote.Referrers(repo.Digest(subject.Digest.String()), opts...)
+			if err != nil {
+				t.Fatalf("Referrers() error = %v", err)
+			}
+			im, err := idx.IndexManifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []v1.Hash
+			for _, m := range im.Manifests {
+				got = append(got, m.Digest)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Referrers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	pulled, err := remote.Image(repo.Digest(sbomDigest.String()))
+	if err != nil {
+		t.Fatalf("Image() of the referrer error = %v", err)
+	}
+	if err := validate.Image(pulled); err != nil {
+		t.Errorf("pulled referrer is invalid: %v", err)
+	}
+}
+
+func TestCacheRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu    sync.Mutex
+		fills []string
+	)
+	upstream := func(ctx context.Context, repo string, ref string) error {
+		mu.Lock()
+		fills = append(fills, repo+":"+ref)
+		mu.Unlock()
+		if repo != "library/busybox" {
+			return errors.New("not found upstream")
+		}
+		img, err := random.Image(1024, 2)
+		if err != nil {
+			return err
+		}
+		_, err = s.AddOCI(ctx, randomArtifact{img}, "upstream.example/"+repo+":"+ref)
+		return err
+	}
+
+	srv := httptest.NewServer(server.NewStoreRegistryHandler(s, server.StoreRegistryConfig{Upstream: upstream, Metrics: server.NewMetrics()}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	ref, err := name.ParseReference(host+"/library/busybox:stable", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		pulled, err := remote.Image(ref)
+		if err != nil {
+			t.Fatalf("Image() error = %v", err)
+		}
+		if err := validate.Image(pulled); err != nil {
+			t.Errorf("pulled image is invalid: %v", err)
+		}
+	}
+	mu.Lock()
+	if want := []string{"library/busybox:stable"}; !reflect.DeepEqual(fills, want) {
+		t.Errorf("upstream fills = %v, want %v", fills, want)
+	}
+	mu.Unlock()
+	if _, err := s.Stat(ctx, "upstream.example/library/busybox:stable"); err != nil {
+		t.Errorf("cached image is not in the store: %v", err)
+	}
+
+	resp, err := http.Get(srv.URL + "/v2/library/missing/manifests/stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET of a manifest missing upstream = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	resp, err = http.Get(srv.URL + server.MetricsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	metrics, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`hauler_serve_cache_requests_total{result="miss"} 1`,
+		`hauler_serve_cache_requests_total{result="hit"}`,
+		`hauler_serve_cache_requests_total{result="error"} 1`,
+		`hauler_serve_requests_total{code="404",kind="manifest",server="registry"} 1`,
+		`hauler_serve_bytes_total{kind="blob",server="registry"}`,
+	} {
+		if !strings.Contains(string(metrics), want) {
+			t.Errorf("metrics are missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	CAFileName   = "ca.crt"
+	CAKeyName    = "ca.key"
+	CertFileName = "tls.crt"
+	KeyFileName  = "tls.key"
+)
+
+// TLSConfig is the certificate and key a server is served over https with
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+}
+
+// Enabled reports whether the server should be served over https
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// Load reads and validates the certificate and key pair
+func (c TLSConfig) Load() (tls.Certificate, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return tls.Certificate{}, errors.New("both a tls certificate and key are required")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("loading tls certificate [%s]: %w", c.CertFile, err)
+	}
+	return cert, nil
+}
+
+// tlsServer serves an http.Server over https when its TLSConfig is enabled
+type tlsServer struct {
+	*http.Server
+	tls TLSConfig
+}
+
+func (s *tlsServer) ListenAndServe() error {
+	if !s.tls.Enabled() {
+		return s.Server.ListenAndServe()
+	}
+	if _, err := s.tls.Load(); err != nil {
+		return err
+	}
+	return s.Server.ListenAndServeTLS(s.tls.CertFile, s.tls.KeyFile)
+}
+
+// DefaultHosts returns the names a self-signed certificate is valid for when none are given: the hostname, localhost,
+// and the addresses of every network interface of the host
+func DefaultHosts() ([]string, error) {
+	hosts := []string{"localhost"}
+	if h, err := os.Hostname(); err == nil && h != "" {
+		hosts = append(hosts, h)
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("listing interface addresses: %w", err)
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && !n.IP.IsLinkLocalUnicast() {
+			hosts = append(hosts, n.IP.String())
+		}
+	}
+	return hosts, nil
+}
+
+// GenerateSelfSigned issues a certificate for hosts, signed by a CA of its own, writing both to dir
+//
+//	The CA is only created when dir doesn't hold one yet, so it stays the same across restarts and only needs to be
+//	distributed to the nodes pulling from the server once.  The certificate is reissued every time, in case the hosts
+//	have changed.  Hosts may be hostnames or IP addresses.
+func GenerateSelfSigned(dir string, hosts []string) (TLSConfig, error) {
+	if len(hosts) == 0 {
+		return TLSConfig{}, errors.New("a self-signed certificate needs at least one host")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return TLSConfig{}, err
+	}
+
+	ca, caKey, err := loadCA(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		ca, caKey, err = newCA(dir)
+	}
+	if err != nil {
+		return TLSConfig{}, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return TLSConfig{}, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return TLSConfig{}, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"hauler"}, CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return TLSConfig{}, fmt.Errorf("issuing certificate: %w", err)
+	}
+
+	cfg := TLSConfig{
+		CertFile: filepath.Join(dir, CertFileName),
+		KeyFile:  filepath.Join(dir, KeyFileName),
+	}
+	if err := writePEM(cfg.CertFile, "CERTIFICATE", der, 0644); err != nil {
+		return TLSConfig{}, err
+	}
+	if err := writeKey(cfg.KeyFile, key); err != nil {
+		return TLSConfig{}, err
+	}
+	return cfg, nil
+}
+
+func newCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"hauler"}, CommonName: "hauler self-signed CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating CA: %w", err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writeKey(filepath.Join(dir, CAKeyName), key); err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(filepath.Join(dir, CAFileName), "CERTIFICATE", der, 0644); err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+// loadCA reads the CA of a previous GenerateSelfSigned from dir, returning os.ErrNotExist if there's none
+func loadCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(filepath.Join(dir, CAFileName))
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(dir, CAKeyName))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading CA from [%s]: %w", dir, err)
+	}
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok || !ca.IsCA {
+		return nil, nil, fmt.Errorf("[%s] is not a CA generated by hauler", filepath.Join(dir, CAFileName))
+	}
+	return ca, key, nil
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writePEM(path, "EC PRIVATE KEY", der, 0600)
+}
+
+func writePEM(path string, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("writing [%s]: %w", path, err)
+	}
+	return nil
+}
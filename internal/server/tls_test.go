@@ -0,0 +1,73 @@
+package server_test
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancherfederal/hauler/internal/server"
+)
+
+func TestGenerateSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := server.GenerateSelfSigned(dir, []string{"registry.local", "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("GenerateSelfSigned() error = %v", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(dir, server.CAFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the CA is kept across calls so nodes don't have to trust a new one on every restart
+	cfg, err = server.GenerateSelfSigned(dir, []string{"registry.local", "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("GenerateSelfSigned() error = %v", err)
+	}
+	reused, err := os.ReadFile(filepath.Join(dir, server.CAFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ca) != string(reused) {
+		t.Errorf("GenerateSelfSigned() replaced the existing CA")
+	}
+
+	pair, err := cfg.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		t.Fatal("CA is not a PEM certificate")
+	}
+
+	tests := []struct {
+		host    string
+		wantErr bool
+	}{
+		{host: "registry.local"},
+		{host: "10.0.0.5"},
+		{host: "other.local", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			_, err := leaf.Verify(x509.VerifyOptions{DNSName: tt.host, Roots: pool})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify(%s) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := server.GenerateSelfSigned(t.TempDir(), nil); err == nil {
+		t.Errorf("GenerateSelfSigned() with no hosts should fail")
+	}
+	if _, err := (server.TLSConfig{CertFile: cfg.CertFile}).Load(); err == nil {
+		t.Errorf("Load() without a key should fail")
+	}
+}
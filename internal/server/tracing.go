@@ -0,0 +1,15 @@
+package server
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// traced starts a span for every request to next, named after server and the kind of content requested, continuing
+// the trace of the client when its request carries one
+func traced(server string, kind func(*http.Request) string, next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, server, otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+		return server + " " + kind(req)
+	}))
+}
@@ -40,6 +40,9 @@ type ThickChartSpec struct {
 type ThickChart struct {
 	Chart       `json:",inline,omitempty"`
 	ExtraImages []ChartImage `json:"extraImages,omitempty"`
+
+	// ValuesFiles are rendered with the chart to find the images it depends on, later files taking precedence
+	ValuesFiles []string `json:"valuesFiles,omitempty"`
 }
 
 type ChartImage struct {
@@ -0,0 +1,47 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	CollectionKind     = "Collection"
+	CollectionRefsKind = "CollectionRefs"
+)
+
+// Collection is a reusable, named group of images, charts, and files, templated with ${VAR:-default} or {{ .VAR }}
+type Collection struct {
+	*metav1.TypeMeta  `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CollectionSpec `json:"spec,omitempty"`
+}
+
+type CollectionSpec struct {
+	Images []Image `json:"images,omitempty"`
+	Charts []Chart `json:"charts,omitempty"`
+	Files  []File  `json:"files,omitempty"`
+}
+
+// CollectionRefs references collections defined in other files, so they can be versioned and shared on their own
+type CollectionRefs struct {
+	*metav1.TypeMeta  `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CollectionRefsSpec `json:"spec,omitempty"`
+}
+
+type CollectionRefsSpec struct {
+	Collections []CollectionRef `json:"collections,omitempty"`
+}
+
+type CollectionRef struct {
+	// Path is the path or url of the file defining the collection
+	Path string `json:"path"`
+
+	// Name selects the collection of that name when the file defines several, all are synced otherwise
+	Name string `json:"name,omitempty"`
+
+	// Values render the collection's templated fields, taking precedence over --set and the environment
+	Values map[string]string `json:"values,omitempty"`
+}
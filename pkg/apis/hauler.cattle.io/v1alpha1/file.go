@@ -24,4 +24,10 @@ type File struct {
 	// Name is an optional field specifying the name of the file when specified,
 	// 	it will override any dynamic name discovery from Path
 	Name string `json:"name,omitempty"`
+
+	// Checksum is the sha256 or sha512 digest the file must match, such as sha256:<hex>
+	Checksum string `json:"checksum,omitempty"`
+
+	// ChecksumURL is the path to a checksums file in the format of sha256sum, listing the file under its name
+	ChecksumURL string `json:"checksumURL,omitempty"`
 }
@@ -0,0 +1,29 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const GitRepositoriesContentKind = "GitRepositories"
+
+type GitRepositories struct {
+	*metav1.TypeMeta  `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec GitRepositorySpec `json:"spec,omitempty"`
+}
+
+type GitRepositorySpec struct {
+	Repositories []GitRepository `json:"repositories,omitempty"`
+}
+
+type GitRepository struct {
+	// URL is the url of the repository, anything git clone accepts
+	URL string `json:"url"`
+
+	// Ref is the branch, tag, or commit to store, the default branch of the repository when empty
+	Ref string `json:"ref,omitempty"`
+
+	// Name is the name of the repository in the store, the last element of the url when empty
+	Name string `json:"name,omitempty"`
+}
@@ -25,7 +25,14 @@ type Image struct {
 	//Key string `json:"key,omitempty"`
 	Key string `json:"key"`
 
-	// Platform of the image to be pulled.  If not specified, all platforms will be pulled.
+	// CertificateIdentity and CertificateOidcIssuer verify image signatures keylessly, against the certificate fulcio
+	// issued the signer, instead of a key.  Either may be given as a regular expression instead.
+	CertificateIdentity         string `json:"certificateIdentity,omitempty"`
+	CertificateIdentityRegexp   string `json:"certificateIdentityRegexp,omitempty"`
+	CertificateOidcIssuer       string `json:"certificateOidcIssuer,omitempty"`
+	CertificateOidcIssuerRegexp string `json:"certificateOidcIssuerRegexp,omitempty"`
+
+	// Platform of the image to be pulled, or a comma separated list of platforms.  If not specified, all platforms will be pulled.
 	//Platform string `json:"key,omitempty"`
 	Platform string `json:"platform"`
 }
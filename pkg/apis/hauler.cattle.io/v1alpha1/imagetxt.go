@@ -22,6 +22,9 @@ type ImageTxtsSpec struct {
 type ImageTxt struct {
 	Ref     string          `json:"ref,omitempty"`
 	Sources ImageTxtSources `json:"sources,omitempty"`
+
+	// Sections filters the images by the comment header they're listed under, such as '# cert-manager'
+	Sections ImageTxtSources `json:"sections,omitempty"`
 }
 
 type ImageTxtSources struct {
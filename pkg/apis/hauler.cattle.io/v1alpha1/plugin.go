@@ -0,0 +1,28 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const PluginsCollectionKind = "Plugins"
+
+type Plugins struct {
+	*metav1.TypeMeta  `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PluginsSpec `json:"spec,omitempty"`
+}
+
+type PluginsSpec struct {
+	Plugins []Plugin `json:"plugins,omitempty"`
+}
+
+type Plugin struct {
+	// Name of the plugin, run as the executable hauler-collection-<name>
+	Name string `json:"name"`
+
+	// Config is passed to the plugin as is
+	Config json.RawMessage `json:"config,omitempty"`
+}
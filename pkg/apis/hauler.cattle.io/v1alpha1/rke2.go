@@ -0,0 +1,18 @@
+package v1alpha1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+const RKE2CollectionKind = "RKE2"
+
+type RKE2 struct {
+	*metav1.TypeMeta  `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec RKE2Spec `json:"spec,omitempty"`
+}
+
+type RKE2Spec struct {
+	// Version is a release such as v1.28.5+rke2r1, or a channel such as stable resolved to its latest release
+	Version string `json:"version"`
+	Arch    string `json:"arch"`
+}
@@ -0,0 +1,126 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrChecksumNotFound = errors.New("checksum not found")
+)
+
+// ParseChecksum parses the checksum s, an algorithm prefixed digest such as sha256:<hex>, or a bare sha256 or
+// sha512 hex digest told apart by its length
+func ParseChecksum(s string) (digest.Digest, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if !strings.Contains(s, ":") {
+		switch len(s) {
+		case 64:
+			s = digest.SHA256.String() + ":" + s
+		case 128:
+			s = digest.SHA512.String() + ":" + s
+		default:
+			return "", fmt.Errorf("checksum [%s] is neither a sha256 nor a sha512 digest", s)
+		}
+	}
+
+	d, err := digest.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("checksum [%s]: %w", s, err)
+	}
+	if d.Algorithm() != digest.SHA256 && d.Algorithm() != digest.SHA512 {
+		return "", fmt.Errorf("checksum [%s]: only sha256 and sha512 are supported", s)
+	}
+	return d, nil
+}
+
+// FindChecksum returns the checksum of the file name in the checksums file r, in the format of sha256sum and
+// sha512sum output
+//
+//	A checksums file holding a lone digest is taken as the checksum of name whatever it's called.
+func FindChecksum(r io.Reader, name string) (digest.Digest, error) {
+	var lines [][]string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		lines = append(lines, fields)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if len(lines) == 1 && len(lines[0]) == 1 {
+		return ParseChecksum(lines[0][0])
+	}
+	for _, fields := range lines {
+		if len(fields) != 2 {
+			continue
+		}
+		// binary mode entries are marked with a leading '*', paths may be relative to the checksums file
+		if path.Base(strings.TrimPrefix(fields[1], "*")) == name {
+			return ParseChecksum(fields[0])
+		}
+	}
+	return "", fmt.Errorf("%w: no entry for [%s]", ErrChecksumNotFound, name)
+}
+
+// checksum returns the checksum the file must match, fetching it from the checksums url when one was given
+func (f *File) checksum(ctx context.Context) (digest.Digest, error) {
+	if f.expected != "" || f.checksumURL == "" {
+		return f.expected, nil
+	}
+
+	rc, err := f.client.ContentFrom(ctx, f.checksumURL)
+	if err != nil {
+		return "", fmt.Errorf("fetching checksums [%s]: %w", f.checksumURL, err)
+	}
+	defer rc.Close()
+
+	// checksums files list the files under their upstream names, not the ones they're stored as
+	name := f.Path
+	if u, err := url.Parse(f.Path); err == nil && u.Path != "" {
+		name = u.Path
+	}
+	d, err := FindChecksum(rc, path.Base(name))
+	if err != nil {
+		return "", fmt.Errorf("checksums [%s]: %w", f.checksumURL, err)
+	}
+	return d, nil
+}
+
+// verify reads the content of the file once, checking it against both the expected checksum and the sha256 digest
+// it's stored under, so what's stored is what was verified
+func verify(open func() (io.ReadCloser, error), expected digest.Digest, stored digest.Digest) error {
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	sum := sha256.New()
+	verifier := expected.Verifier()
+	if _, err := io.Copy(io.MultiWriter(sum, verifier), rc); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("%w: expected [%s]", ErrChecksumMismatch, expected)
+	}
+	if got := digest.NewDigestFromBytes(digest.SHA256, sum.Sum(nil)); got != stored {
+		return fmt.Errorf("%w: content changed while fetching it, got [%s] then [%s]", ErrChecksumMismatch, stored, got)
+	}
+	return nil
+}
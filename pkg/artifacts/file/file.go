@@ -2,10 +2,12 @@ package file
 
 import (
 	"context"
+	"fmt"
 
 	gv1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	gtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
 
 	"github.com/rancherfederal/hauler/pkg/artifacts"
 	"github.com/rancherfederal/hauler/pkg/artifacts/file/getter"
@@ -13,19 +15,26 @@ import (
 )
 
 // interface guard
-var _ artifacts.OCI = (*File)(nil)
+var (
+	_ artifacts.OCI           = (*File)(nil)
+	_ artifacts.ArtifactTyper = (*File)(nil)
+)
 
 // File implements the OCI interface for File API objects. API spec information is
 // stored into the Path field.
 type File struct {
 	Path string
 
-	computed    bool
-	client      *getter.Client
-	config      artifacts.Config
-	blob        gv1.Layer
-	manifest    *gv1.Manifest
-	annotations map[string]string
+	computed     bool
+	client       *getter.Client
+	config       artifacts.Config
+	blob         gv1.Layer
+	manifest     *gv1.Manifest
+	annotations  map[string]string
+	artifactType string
+
+	expected    digest.Digest
+	checksumURL string
 }
 
 func NewFile(path string, opts ...Option) *File {
@@ -47,6 +56,11 @@ func (f *File) Name(path string) string {
 	return f.client.Name(path)
 }
 
+// ArtifactType returns the OCI 1.1 artifactType set with WithArtifactType, if any
+func (f *File) ArtifactType() string {
+	return f.artifactType
+}
+
 func (f *File) MediaType() string {
 	return consts.OCIManifestSchema1
 }
@@ -90,6 +104,23 @@ func (f *File) compute() error {
 		return err
 	}
 
+	annotations := f.annotations
+	expected, err := f.checksum(ctx)
+	if err != nil {
+		return err
+	}
+	if expected != "" {
+		if err := verify(blob.Compressed, expected, digest.Digest(layer.Digest.String())); err != nil {
+			return fmt.Errorf("verifying [%s]: %w", f.Path, err)
+		}
+
+		annotations = make(map[string]string, len(f.annotations)+1)
+		for k, v := range f.annotations {
+			annotations[k] = v
+		}
+		annotations[consts.FileAnnotationVerifiedDigest] = expected.String()
+	}
+
 	cfg := f.client.Config(f.Path)
 	if cfg == nil {
 		cfg = f.client.Config(f.Path)
@@ -105,7 +136,7 @@ func (f *File) compute() error {
 		MediaType:     gtypes.MediaType(f.MediaType()),
 		Config:        *cfgDesc,
 		Layers:        []gv1.Descriptor{*layer},
-		Annotations:   f.annotations,
+		Annotations:   annotations,
 	}
 
 	f.manifest = m
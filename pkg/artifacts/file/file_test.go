@@ -3,6 +3,10 @@ package file_test
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +15,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/opencontainers/go-digest"
 	"github.com/spf13/afero"
 
 	"github.com/rancherfederal/hauler/pkg/artifacts/file"
@@ -121,6 +126,100 @@ func Test_file_Layers(t *testing.T) {
 	}
 }
 
+func Test_file_Checksum(t *testing.T) {
+	sha256sum := sha256.Sum256(data)
+	sha512sum := sha512.Sum512(data)
+	sha256hex := hex.EncodeToString(sha256sum[:])
+	sha512hex := hex.EncodeToString(sha512sum[:])
+	afero.WriteFile(tfs, "unlisted.yaml", data, 0644)
+	afero.WriteFile(tfs, "SHA256SUMS", []byte("0000000000000000000000000000000000000000000000000000000000000000  other.yaml\n"+sha256hex+" *dist/"+filename+"\n"), 0644)
+
+	tests := []struct {
+		name      string
+		ref       string
+		opts      []file.Option
+		want      string
+		wantErrIs error
+	}{
+		{
+			name: "should verify a sha256 checksum",
+			ref:  filename,
+			opts: []file.Option{file.WithChecksum(digest.NewDigestFromEncoded(digest.SHA256, sha256hex))},
+			want: "sha256:" + sha256hex,
+		},
+		{
+			name: "should verify a sha512 checksum",
+			ref:  filename,
+			opts: []file.Option{file.WithChecksum(digest.NewDigestFromEncoded(digest.SHA512, sha512hex))},
+			want: "sha512:" + sha512hex,
+		},
+		{
+			name: "should verify the entry of a checksums file",
+			ref:  filename,
+			opts: []file.Option{file.WithChecksumURL(ts.URL + "/SHA256SUMS")},
+			want: "sha256:" + sha256hex,
+		},
+		{
+			name:      "should fail on a mismatched checksum",
+			ref:       filename,
+			opts:      []file.Option{file.WithChecksum(digest.FromString("other"))},
+			wantErrIs: file.ErrChecksumMismatch,
+		},
+		{
+			name:      "should fail when the checksums file has no entry for the file",
+			ref:       "unlisted.yaml",
+			opts:      []file.Option{file.WithChecksumURL(ts.URL + "/SHA256SUMS")},
+			wantErrIs: file.ErrChecksumNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := file.NewFile(ts.URL+"/"+tt.ref, append([]file.Option{file.WithClient(mc)}, tt.opts...)...)
+
+			m, err := f.Manifest()
+			if tt.wantErrIs != nil {
+				if !errors.Is(err, tt.wantErrIs) {
+					t.Fatalf("Manifest() error = %v, want %v", err, tt.wantErrIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Annotations[consts.FileAnnotationVerifiedDigest]; got != tt.want {
+				t.Errorf("Manifest() verified digest = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	hex64 := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	tests := []struct {
+		name     string
+		checksum string
+		want     string
+		wantErr  bool
+	}{
+		{name: "prefixed sha256", checksum: "sha256:" + hex64, want: "sha256:" + hex64},
+		{name: "bare sha256", checksum: " " + hex64 + "\n", want: "sha256:" + hex64},
+		{name: "bare sha512", checksum: hex64 + hex64, want: "sha512:" + hex64 + hex64},
+		{name: "unsupported algorithm", checksum: "sha384:" + hex64 + hex64[:32], wantErr: true},
+		{name: "malformed", checksum: "md5sum", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := file.ParseChecksum(tt.checksum)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseChecksum() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ParseChecksum() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
 func setup() func() {
 	tfs = afero.NewMemMapFs()
 	afero.WriteFile(tfs, filename, data, 0644)
@@ -10,7 +10,6 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 
 	"github.com/rancherfederal/hauler/pkg/artifacts"
@@ -25,38 +24,56 @@ func NewDirectory() *directory {
 	return &directory{File: NewFile()}
 }
 
+// Open returns the directory at u as a gzipped tarball, built deterministically so opening the same tree twice gives
+// the same digest
+//
+//	The tarball is staged in a temporary file removed once it's closed.
 func (d directory) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
 	tmpfile, err := os.CreateTemp("", "hauler")
 	if err != nil {
 		return nil, err
 	}
+	cleanup := func() {
+		tmpfile.Close()
+		os.Remove(tmpfile.Name())
+	}
 
-	digester := digest.Canonical.Digester()
-	zw := gzip.NewWriter(io.MultiWriter(tmpfile, digester.Hash()))
-	defer zw.Close()
-
-	tarDigester := digest.Canonical.Digester()
-	if err := tarDir(d.path(u), d.Name(u), io.MultiWriter(zw, tarDigester.Hash()), false); err != nil {
+	zw := gzip.NewWriter(tmpfile)
+	if err := tarDir(d.path(u), d.Name(u), zw, true); err != nil {
+		cleanup()
 		return nil, err
 	}
-
 	if err := zw.Close(); err != nil {
+		cleanup()
 		return nil, err
 	}
-	if err := tmpfile.Sync(); err != nil {
+	if _, err := tmpfile.Seek(0, io.SeekStart); err != nil {
+		cleanup()
 		return nil, err
 	}
 
-	fi, err := os.Open(tmpfile.Name())
+	return &closer{
+		t:      tmpfile,
+		closes: []func() error{tmpfile.Close, func() error { return os.Remove(tmpfile.Name()) }},
+	}, nil
+}
+
+// Size returns the combined size of the regular files under u, an estimate of the compressed archive actually stored
+func (d directory) Size(ctx context.Context, u *url.URL) (int64, error) {
+	var size int64
+	err := filepath.Walk(d.path(u), func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return -1, err
 	}
-
-	// rc := &closer{
-	// 	t: io.TeeReader(tmpfile, fi),
-	// 	closes: []func() error{fi.Close, tmpfile.Close, zw.Close},
-	// }
-	return fi, nil
+	return size, nil
 }
 
 func (d directory) Detect(u *url.URL) bool {
@@ -82,9 +99,12 @@ type directoryConfig struct {
 	config `json:",inline,omitempty"`
 }
 
+// tarDir writes the tree at root to w as a tar stream, with every entry named under prefix
+//
+//	Entries are written in lexical order without owners, and with stripTimes without timestamps either, so the stream
+//	only depends on the names, modes, and contents of the tree.
 func tarDir(root string, prefix string, w io.Writer, stripTimes bool) error {
 	tw := tar.NewWriter(w)
-	defer tw.Close()
 	if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -117,7 +137,7 @@ func tarDir(root string, prefix string, w io.Writer, stripTimes bool) error {
 		header.Gname = ""
 
 		if stripTimes {
-			header.ModTime = time.Time{}
+			header.ModTime = time.Unix(0, 0)
 			header.AccessTime = time.Time{}
 			header.ChangeTime = time.Time{}
 		}
@@ -141,7 +161,7 @@ func tarDir(root string, prefix string, w io.Writer, stripTimes bool) error {
 	}); err != nil {
 		return err
 	}
-	return nil
+	return tw.Close()
 }
 
 type closer struct {
@@ -25,6 +25,14 @@ func (f File) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
 	return os.Open(f.path(u))
 }
 
+func (f File) Size(ctx context.Context, u *url.URL) (int64, error) {
+	fi, err := os.Stat(f.path(u))
+	if err != nil {
+		return -1, err
+	}
+	return fi.Size(), nil
+}
+
 func (f File) Detect(u *url.URL) bool {
 	if len(f.path(u)) == 0 {
 		return false
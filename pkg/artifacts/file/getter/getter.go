@@ -40,6 +40,12 @@ type Getter interface {
 	Config(*url.URL) content2.Config
 }
 
+// Sizer is implemented by getters able to tell how large content is without fetching it
+type Sizer interface {
+	// Size returns the size of the content at the url, or -1 when it can't be known in advance
+	Size(context.Context, *url.URL) (int64, error)
+}
+
 func NewClient(opts ClientOptions) *Client {
 	defaults := map[string]Getter{
 		"file":      NewFile(),
@@ -104,6 +110,22 @@ func (c *Client) ContentFrom(ctx context.Context, source string) (io.ReadCloser,
 	return g.Open(ctx, u)
 }
 
+// Size returns the size of the content at source without fetching it, or -1 when its getter can't tell in advance
+func (c *Client) Size(ctx context.Context, source string) (int64, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return -1, fmt.Errorf("parse source %s: %w", source, err)
+	}
+	g, err := c.getterFrom(u)
+	if err != nil {
+		return -1, err
+	}
+	if s, ok := g.(Sizer); ok {
+		return s.Size(ctx, u)
+	}
+	return -1, nil
+}
+
 func (c *Client) getterFrom(srcUrl *url.URL) (Getter, error) {
 	for _, g := range c.Getters {
 		if g.Detect(srcUrl) {
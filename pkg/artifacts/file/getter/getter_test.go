@@ -1,10 +1,19 @@
 package getter_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/rancherfederal/hauler/pkg/artifacts/file/getter"
 )
@@ -119,11 +128,131 @@ func TestClient_Name(t *testing.T) {
 	}
 }
 
+func TestClient_Size(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	if err := os.WriteFile(filepath.Join(rootDir, "data.txt"), []byte("hauler"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("remote content"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		source  string
+		want    int64
+		wantErr bool
+	}{
+		{
+			name:   "should size a file",
+			source: filepath.Join(rootDir, "data.txt"),
+			want:   6,
+		},
+		{
+			name:   "should size a directory by its files",
+			source: rootDir,
+			want:   6,
+		},
+		{
+			name:   "should size an http file by its content length",
+			source: srv.URL + "/file.txt",
+			want:   14,
+		},
+		{
+			name:    "should fail on a missing http file",
+			source:  srv.URL + "/missing.txt",
+			want:    -1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := getter.NewClient(getter.ClientOptions{})
+			got, err := c.Size(context.Background(), tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Size() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Size() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 var (
 	rootDir     = "gettertests"
 	fileWithExt = filepath.Join(rootDir, "file.yaml")
 )
 
+func TestDirectory_Open(t *testing.T) {
+	ctx := context.Background()
+	root := filepath.Join(t.TempDir(), "config-bundle")
+	for name, data := range map[string]string{"b.txt": "b", "a/c.txt": "c", "a/b/d.txt": "d"} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := getter.NewClient(getter.ClientOptions{})
+	open := func() []byte {
+		t.Helper()
+		rc, err := c.ContentFrom(ctx, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first := open()
+	// touching the tree mustn't change the tarball
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "b.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if second := open(); !bytes.Equal(first, second) {
+		t.Fatal("Open() is not deterministic, got different tarballs for the same tree")
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !h.ModTime.Equal(time.Unix(0, 0)) {
+			t.Errorf("Open() entry [%s] modtime = %s, want it zeroed", h.Name, h.ModTime)
+		}
+		names = append(names, h.Name)
+	}
+	want := []string{"config-bundle", "config-bundle/a", "config-bundle/a/b", "config-bundle/a/b/d.txt", "config-bundle/a/c.txt", "config-bundle/b.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Open() entries = %v, want %v", names, want)
+	}
+}
+
 func setup(t *testing.T) func() {
 	if err := os.MkdirAll(rootDir, os.ModePerm); err != nil {
 		t.Fatal(err)
@@ -2,6 +2,7 @@ package getter
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"mime"
 	"net/http"
@@ -52,6 +53,24 @@ func (h Http) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
 	return resp.Body, nil
 }
 
+// Size returns the content length the server reports for u, or -1 if it doesn't report one
+func (h Http) Size(ctx context.Context, u *url.URL) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return -1, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return -1, fmt.Errorf("HEAD %s: unexpected status %s", u, resp.Status)
+	}
+	return resp.ContentLength, nil
+}
+
 func (h Http) Detect(u *url.URL) bool {
 	switch u.Scheme {
 	case "http", "https":
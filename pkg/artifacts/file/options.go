@@ -1,6 +1,8 @@
 package file
 
 import (
+	"github.com/opencontainers/go-digest"
+
 	"github.com/rancherfederal/hauler/pkg/artifacts"
 	"github.com/rancherfederal/hauler/pkg/artifacts/file/getter"
 )
@@ -24,3 +26,25 @@ func WithAnnotations(m map[string]string) Option {
 		f.annotations = m
 	}
 }
+
+// WithArtifactType sets the OCI 1.1 artifactType written to the artifact's manifest
+func WithArtifactType(artifactType string) Option {
+	return func(f *File) {
+		f.artifactType = artifactType
+	}
+}
+
+// WithChecksum fails the file unless its content matches the sha256 or sha512 checksum d
+func WithChecksum(d digest.Digest) Option {
+	return func(f *File) {
+		f.expected = d
+	}
+}
+
+// WithChecksumURL fails the file unless its content matches its entry in the checksums file at url, fetched with the
+// file's client
+func WithChecksumURL(url string) Option {
+	return func(f *File) {
+		f.checksumURL = url
+	}
+}
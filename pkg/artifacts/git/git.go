@@ -0,0 +1,294 @@
+// Package git stores git repositories as OCI artifacts, the tree of a repository at a ref archived as a tarball
+//
+//	Repositories are fetched with the git executable, so they're authenticated the way git is configured to, with its
+//	credential helpers and ssh keys.  The tarball is unpacked again by store extract, into a directory named after the
+//	repository.
+package git
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	gtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/content"
+
+	"github.com/rancherfederal/hauler/pkg/artifacts"
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/layer"
+	"github.com/rancherfederal/hauler/pkg/reference"
+	"github.com/rancherfederal/hauler/pkg/staging"
+)
+
+var _ artifacts.OCI = (*Repository)(nil)
+
+// Repository implements the OCI interface for a git repository at a ref
+type Repository struct {
+	URL string
+	Ref string
+
+	name string
+
+	computed bool
+	dir      string
+	cleanup  func()
+	commit   string
+	config   artifacts.Config
+	blob     gv1.Layer
+	manifest *gv1.Manifest
+}
+
+type Option func(*Repository)
+
+// WithName names the repository name rather than after its url
+func WithName(name string) Option {
+	return func(r *Repository) {
+		r.name = name
+	}
+}
+
+// NewRepository returns the repository at url, checked out at ref, a branch, tag, or commit, or its HEAD when empty
+//
+//	Close must be called once the repository has been stored to remove its clone.
+func NewRepository(url string, ref string, opts ...Option) *Repository {
+	r := &Repository{
+		URL: url,
+		Ref: ref,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Name is the name of the repository's reference, the last element of its url without the .git suffix unless set
+func (r *Repository) Name() string {
+	if r.name != "" {
+		return r.name
+	}
+	u := strings.TrimSuffix(strings.TrimRight(r.URL, "/"), ".git")
+	// scp-like urls such as git@github.com:org/repo
+	if i := strings.LastIndex(u, ":"); i >= 0 && !strings.Contains(u, "://") {
+		u = u[i+1:]
+	}
+	return path.Base(u)
+}
+
+var invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// Tag is the tag of the repository's reference, its ref with the characters tags can't hold replaced, or the default
+// tag when it has no ref
+func (r *Repository) Tag() string {
+	if r.Ref == "" {
+		return reference.DefaultTag
+	}
+	tag := invalidTagChars.ReplaceAllString(r.Ref, "-")
+	tag = strings.TrimLeft(tag, ".-")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	if tag == "" {
+		return reference.DefaultTag
+	}
+	return tag
+}
+
+// Commit is the commit the ref of the repository resolved to
+func (r *Repository) Commit() (string, error) {
+	if err := r.compute(); err != nil {
+		return "", err
+	}
+	return r.commit, nil
+}
+
+// Close removes the clone of the repository
+func (r *Repository) Close() error {
+	if r.cleanup != nil {
+		r.cleanup()
+		return nil
+	}
+	if r.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(r.dir)
+}
+
+func (r *Repository) MediaType() string {
+	return consts.OCIManifestSchema1
+}
+
+func (r *Repository) RawConfig() ([]byte, error) {
+	if err := r.compute(); err != nil {
+		return nil, err
+	}
+	return r.config.Raw()
+}
+
+func (r *Repository) Layers() ([]gv1.Layer, error) {
+	if err := r.compute(); err != nil {
+		return nil, err
+	}
+	return []gv1.Layer{r.blob}, nil
+}
+
+func (r *Repository) Manifest() (*gv1.Manifest, error) {
+	if err := r.compute(); err != nil {
+		return nil, err
+	}
+	return r.manifest, nil
+}
+
+type repositoryConfig struct {
+	Reference string `json:"reference"`
+	Ref       string `json:"ref,omitempty"`
+	Commit    string `json:"commit"`
+}
+
+func (r *Repository) compute() error {
+	if r.computed {
+		return nil
+	}
+	ctx := context.TODO()
+
+	if r.dir == "" {
+		dir, cleanup, err := staging.Dir(ctx, "", "git")
+		if err != nil {
+			return err
+		}
+		r.dir, r.cleanup = dir, cleanup
+	}
+
+	commit, err := r.fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching [%s] at [%s]: %w", r.URL, r.Ref, err)
+	}
+
+	archive, err := r.archive(ctx, commit)
+	if err != nil {
+		return fmt.Errorf("archiving [%s] at [%s]: %w", r.URL, commit, err)
+	}
+
+	annotations := make(map[string]string)
+	annotations[ocispec.AnnotationTitle] = r.Name()
+	annotations[content.AnnotationUnpack] = "true"
+	blob, err := layer.FromOpener(func() (io.ReadCloser, error) {
+		return os.Open(archive)
+	},
+		layer.WithMediaType(consts.FileLayerMediaType),
+		layer.WithAnnotations(annotations))
+	if err != nil {
+		return err
+	}
+
+	layerDesc, err := partial.Descriptor(blob)
+	if err != nil {
+		return err
+	}
+
+	cfg := artifacts.ToConfig(repositoryConfig{Reference: r.URL, Ref: r.Ref, Commit: commit}, artifacts.WithConfigMediaType(consts.GitConfigMediaType))
+	cfgDesc, err := partial.Descriptor(cfg)
+	if err != nil {
+		return err
+	}
+
+	r.manifest = &gv1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     gtypes.MediaType(r.MediaType()),
+		Config:        *cfgDesc,
+		Layers:        []gv1.Descriptor{*layerDesc},
+		Annotations: map[string]string{
+			ocispec.AnnotationSource:   r.URL,
+			ocispec.AnnotationRevision: commit,
+		},
+	}
+	r.commit = commit
+	r.config = cfg
+	r.blob = blob
+	r.computed = true
+	return nil
+}
+
+// fetch fetches the ref of the repository into its clone, returning the commit it resolved to
+func (r *Repository) fetch(ctx context.Context) (string, error) {
+	repo := filepath.Join(r.dir, "repo")
+	if _, err := r.git(ctx, "", "init", "--quiet", "--bare", repo); err != nil {
+		return "", err
+	}
+	if _, err := r.git(ctx, repo, "remote", "add", "origin", r.URL); err != nil {
+		return "", err
+	}
+
+	ref := r.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err := r.git(ctx, repo, "fetch", "--quiet", "--depth", "1", "origin", ref); err == nil {
+		return r.git(ctx, repo, "rev-parse", "--verify", "FETCH_HEAD^{commit}")
+	}
+
+	// servers may refuse shallow fetches of commits that aren't the tip of a branch or tag
+	if _, err := r.git(ctx, repo, "fetch", "--quiet", "--tags", "origin", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+		return "", err
+	}
+	for _, candidate := range []string{ref, "origin/" + ref} {
+		if commit, err := r.git(ctx, repo, "rev-parse", "--quiet", "--verify", candidate+"^{commit}"); err == nil {
+			return commit, nil
+		}
+	}
+	return "", fmt.Errorf("ref [%s] not found", ref)
+}
+
+// archive writes the tree of commit to a gzipped tarball, every entry under a directory named after the repository
+func (r *Repository) archive(ctx context.Context, commit string) (string, error) {
+	f, err := os.Create(filepath.Join(r.dir, "archive.tar.gz"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	cmd := r.command(ctx, filepath.Join(r.dir, "repo"), "archive", "--format=tar", "--prefix="+r.Name()+"/", commit)
+	var stderr bytes.Buffer
+	cmd.Stdout = zw
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git archive: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// git runs git with args in the repository at dir, returning its trimmed output
+func (r *Repository) git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := r.command(ctx, dir, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (r *Repository) command(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	// never prompt for credentials, there's no one to answer
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	return cmd
+}
@@ -0,0 +1,183 @@
+package git_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/artifacts/git"
+)
+
+// testRepo creates a repository with a v1 tag on its first commit and a second commit on main, returning its path
+// and the commit of each
+func testRepo(t *testing.T) (string, []string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=hauler", "-c", "user.email=hauler@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("init", "--quiet", "--initial-branch", "main")
+	write("install.sh", "#!/bin/sh\n")
+	run("add", ".")
+	run("commit", "--quiet", "-m", "first")
+	run("tag", "v1")
+	first := run("rev-parse", "HEAD")
+
+	write("manifests/app.yaml", "kind: Deployment\n")
+	run("add", ".")
+	run("commit", "--quiet", "-m", "second")
+	second := run("rev-parse", "HEAD")
+
+	return dir, []string{first, second}
+}
+
+func TestRepository(t *testing.T) {
+	dir, commits := testRepo(t)
+
+	tests := []struct {
+		name       string
+		ref        string
+		wantCommit string
+		wantFiles  []string
+		wantErr    bool
+	}{
+		{
+			name:       "should store the default branch",
+			wantCommit: commits[1],
+			wantFiles:  []string{"app/", "app/install.sh", "app/manifests/", "app/manifests/app.yaml"},
+		},
+		{
+			name:       "should store a branch",
+			ref:        "main",
+			wantCommit: commits[1],
+			wantFiles:  []string{"app/", "app/install.sh", "app/manifests/", "app/manifests/app.yaml"},
+		},
+		{
+			name:       "should store a tag",
+			ref:        "v1",
+			wantCommit: commits[0],
+			wantFiles:  []string{"app/", "app/install.sh"},
+		},
+		{
+			name:       "should store a commit",
+			ref:        commits[0],
+			wantCommit: commits[0],
+			wantFiles:  []string{"app/", "app/install.sh"},
+		},
+		{
+			name:    "should fail on a missing ref",
+			ref:     "v2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := git.NewRepository(dir, tt.ref, git.WithName("app"))
+			defer r.Close()
+
+			m, err := r.Manifest()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Manifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := m.Annotations[ocispec.AnnotationRevision]; got != tt.wantCommit {
+				t.Errorf("Manifest() revision = %s, want %s", got, tt.wantCommit)
+			}
+
+			layers, err := r.Layers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := files(t, layers[0].Compressed); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("Layers() files = %v, want %v", got, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestRepository_Reference(t *testing.T) {
+	tests := []struct {
+		url      string
+		ref      string
+		wantName string
+		wantTag  string
+	}{
+		{url: "https://github.com/rancherfederal/hauler.git", wantName: "hauler", wantTag: "latest"},
+		{url: "git@github.com:rancherfederal/hauler.git", ref: "v1.0.0", wantName: "hauler", wantTag: "v1.0.0"},
+		{url: "https://example.com/fleet/", ref: "release/1.x", wantName: "fleet", wantTag: "release-1.x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			r := git.NewRepository(tt.url, tt.ref)
+			if got := r.Name(); got != tt.wantName {
+				t.Errorf("Name() = %s, want %s", got, tt.wantName)
+			}
+			if got := r.Tag(); got != tt.wantTag {
+				t.Errorf("Tag() = %s, want %s", got, tt.wantTag)
+			}
+		})
+	}
+}
+
+// files lists the entries of the gzipped tarball opened by open, skipping the pax global header of git archive
+func files(t *testing.T, open func() (io.ReadCloser, error)) []string {
+	t.Helper()
+	rc, err := open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		names = append(names, h.Name)
+	}
+	sort.Strings(names)
+	return names
+}
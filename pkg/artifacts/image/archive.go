@@ -0,0 +1,112 @@
+package image
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// FromDockerArchive returns the images of the docker save tarball at path, named after their embedded repo tags and
+// converted to OCI images, without needing a docker daemon
+//
+//	When ref is set only the image tagged ref is returned, or the archive's one image when it was saved untagged.
+func FromDockerArchive(path string, ref string) ([]*Image, error) {
+	opener := func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+	m, err := tarball.LoadManifest(opener)
+	if err != nil {
+		return nil, fmt.Errorf("reading docker archive [%s]: %w", path, err)
+	}
+
+	var want gname.Reference
+	if ref != "" {
+		if want, err = gname.ParseReference(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	var images []*Image
+	for _, desc := range m {
+		for _, t := range desc.RepoTags {
+			tag, err := gname.NewTag(t)
+			if err != nil {
+				return nil, fmt.Errorf("docker archive [%s] tag [%s]: %w", path, t, err)
+			}
+			if want != nil && tag.Name() != want.Name() {
+				continue
+			}
+
+			img, err := tarball.Image(opener, &tag)
+			if err != nil {
+				return nil, err
+			}
+			oci, err := ociImage(img)
+			if err != nil {
+				return nil, fmt.Errorf("converting [%s] of docker archive [%s]: %w", t, path, err)
+			}
+			images = append(images, &Image{Name: tag.Name(), Image: oci})
+		}
+	}
+
+	if len(images) == 0 && want != nil && len(m) == 1 && len(m[0].RepoTags) == 0 {
+		img, err := tarball.Image(opener, nil)
+		if err != nil {
+			return nil, err
+		}
+		oci, err := ociImage(img)
+		if err != nil {
+			return nil, fmt.Errorf("converting the image of docker archive [%s]: %w", path, err)
+		}
+		images = append(images, &Image{Name: want.Name(), Image: oci})
+	}
+
+	if len(images) == 0 {
+		if want != nil {
+			return nil, fmt.Errorf("image [%s] not found in docker archive [%s]", ref, path)
+		}
+		return nil, fmt.Errorf("docker archive [%s] has no tagged images, give the reference to store it as", path)
+	}
+	return images, nil
+}
+
+// ociImage returns img with OCI media types, its layers and config otherwise unchanged
+func ociImage(img gv1.Image) (gv1.Image, error) {
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	adds := make([]mutate.Addendum, 0, len(layers))
+	for _, l := range layers {
+		mt, err := l.MediaType()
+		if err != nil {
+			return nil, err
+		}
+		add := mutate.Addendum{Layer: l, MediaType: types.OCILayer}
+		if mt == types.DockerForeignLayer {
+			add.MediaType = types.OCIRestrictedLayer
+		}
+		adds = append(adds, add)
+	}
+
+	base := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	base = mutate.ConfigMediaType(base, types.OCIConfigJSON)
+	oci, err := mutate.Append(base, adds...)
+	if err != nil {
+		return nil, err
+	}
+	// appending rewrites the history and rootfs of the config, restore the original
+	return mutate.ConfigFile(oci, cfg)
+}
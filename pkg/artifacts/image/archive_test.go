@@ -0,0 +1,128 @@
+package image_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/rancherfederal/hauler/pkg/artifacts/image"
+)
+
+func TestFromDockerArchive(t *testing.T) {
+	app, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged := filepath.Join(t.TempDir(), "images.tar")
+	if err := tarball.MultiRefWriteToFile(tagged, map[gname.Reference]gv1.Image{
+		gname.MustParseReference("example.com/app:v1"):     app,
+		gname.MustParseReference("example.com/app:v1.0.0"): app,
+		gname.MustParseReference("busybox:latest"):         app,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// docker save of an image id writes an image without repo tags, as does writing it by digest
+	d, err := app.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byDigest, err := gname.NewDigest("example.com/app@" + d.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	untagged := filepath.Join(t.TempDir(), "untagged.tar")
+	if err := tarball.MultiRefWriteToFile(untagged, map[gname.Reference]gv1.Image{byDigest: app}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		ref     string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "should return every tagged image",
+			path: tagged,
+			want: []string{"example.com/app:v1", "example.com/app:v1.0.0", "index.docker.io/library/busybox:latest"},
+		},
+		{
+			name: "should return only the image tagged ref",
+			path: tagged,
+			ref:  "busybox",
+			want: []string{"index.docker.io/library/busybox:latest"},
+		},
+		{
+			name:    "should fail when no image is tagged ref",
+			path:    tagged,
+			ref:     "example.com/app:v2",
+			wantErr: true,
+		},
+		{
+			name: "should name an untagged image ref",
+			path: untagged,
+			ref:  "example.com/app:dev",
+			want: []string{"example.com/app:dev"},
+		},
+		{
+			name:    "should fail on an untagged image without ref",
+			path:    untagged,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imgs, err := image.FromDockerArchive(tt.path, tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FromDockerArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			var got []string
+			for _, img := range imgs {
+				got = append(got, img.Name)
+
+				if mt := img.MediaType(); mt != string(types.OCIManifestSchema1) {
+					t.Errorf("FromDockerArchive() [%s] media type = %s, want %s", img.Name, mt, types.OCIManifestSchema1)
+				}
+				m, err := img.Manifest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if m.Config.MediaType != types.OCIConfigJSON {
+					t.Errorf("FromDockerArchive() [%s] config media type = %s, want %s", img.Name, m.Config.MediaType, types.OCIConfigJSON)
+				}
+				for _, l := range m.Layers {
+					if l.MediaType != types.OCILayer {
+						t.Errorf("FromDockerArchive() [%s] layer media type = %s, want %s", img.Name, l.MediaType, types.OCILayer)
+					}
+				}
+
+				// the content of the image is unchanged
+				wantCfg, _ := app.ConfigFile()
+				gotCfg, err := img.ConfigFile()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(gotCfg.RootFS.DiffIDs, wantCfg.RootFS.DiffIDs) {
+					t.Errorf("FromDockerArchive() [%s] diff ids = %v, want %v", img.Name, gotCfg.RootFS.DiffIDs, wantCfg.RootFS.DiffIDs)
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromDockerArchive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/docker/docker/client"
+	gname "github.com/google/go-containerregistry/pkg/name"
+)
+
+// DefaultContainerdNamespace is the containerd namespace images are saved from when none is given, the one nerdctl
+// and ctr use
+const DefaultContainerdNamespace = "default"
+
+// SaveFromDocker writes the image ref of the docker daemon to path as a docker save tarball
+//
+//	The daemon is found the way the docker cli finds it, through DOCKER_HOST and its related variables, and the
+//	image is streamed to disk rather than held in memory.
+func SaveFromDocker(ctx context.Context, ref string, path string) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("connecting to the docker daemon: %w", err)
+	}
+	defer cli.Close()
+
+	rc, err := cli.ImageSave(ctx, []string{ref})
+	if err != nil {
+		return fmt.Errorf("saving [%s] from the docker daemon: %w", ref, err)
+	}
+	defer rc.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, rc); err != nil {
+		return fmt.Errorf("saving [%s] from the docker daemon: %w", ref, err)
+	}
+	return f.Close()
+}
+
+// SaveFromContainerd writes the image ref of the containerd namespace to path as a tarball holding a docker save
+// manifest, with the ctr executable
+//
+//	ctr finds containerd through CONTAINERD_ADDRESS, k3s and rke2 run their own containerd whose images are in the
+//	k8s.io namespace.
+func SaveFromContainerd(ctx context.Context, namespace string, ref string, path string) error {
+	if namespace == "" {
+		namespace = DefaultContainerdNamespace
+	}
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "ctr", "--namespace", namespace, "images", "export", path, containerdName(r))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("saving [%s] from containerd namespace [%s]: %v: %s", ref, namespace, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// K8sContainerdNamespace is the containerd namespace kubernetes runs its images from, the one of k3s and rke2
+const K8sContainerdNamespace = "k8s.io"
+
+// containerdSockets are the sockets of the containerd of k3s and rke2, which share a path, and of a standalone
+// containerd, in the order they're looked for
+var containerdSockets = []string{
+	"/run/k3s/containerd/containerd.sock",
+	"/run/containerd/containerd.sock",
+}
+
+// rke2Ctr is where rke2 installs its ctr, which isn't on the PATH of a node
+const rke2Ctr = "/var/lib/rancher/rke2/bin/ctr"
+
+// ImportToContainerd imports the docker save tarball at path into the containerd namespace at address, with the ctr
+// executable
+//
+//	An empty address is CONTAINERD_ADDRESS, then the socket of the containerd of k3s or rke2, then the one of a
+//	standalone containerd, so a single airgapped node runs the images without any registry.  ctr is looked for on the
+//	PATH, then where rke2 installs it, then as 'k3s ctr'.
+func ImportToContainerd(ctx context.Context, namespace string, address string, path string) error {
+	if namespace == "" {
+		namespace = K8sContainerdNamespace
+	}
+	if address == "" {
+		address = containerdAddress()
+	}
+
+	name, args, err := ctrCommand()
+	if err != nil {
+		return err
+	}
+	if address != "" {
+		args = append(args, "--address", address)
+	}
+	args = append(args, "--namespace", namespace, "images", "import", path)
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("importing into containerd namespace [%s]: %v: %s", namespace, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// containerdAddress returns the socket of the containerd of the node, or nothing to leave it to ctr
+func containerdAddress() string {
+	if address := os.Getenv("CONTAINERD_ADDRESS"); address != "" {
+		return address
+	}
+	for _, socket := range containerdSockets {
+		if _, err := os.Stat(socket); err == nil {
+			return socket
+		}
+	}
+	return ""
+}
+
+// ctrCommand returns the executable and leading arguments running ctr
+func ctrCommand() (string, []string, error) {
+	if p, err := exec.LookPath("ctr"); err == nil {
+		return p, nil, nil
+	}
+	if _, err := os.Stat(rke2Ctr); err == nil {
+		return rke2Ctr, nil, nil
+	}
+	if p, err := exec.LookPath("k3s"); err == nil {
+		return p, []string{"ctr"}, nil
+	}
+	return "", nil, fmt.Errorf("finding ctr: not on the PATH, at [%s], or provided by k3s", rke2Ctr)
+}
+
+// containerdName is the name containerd stores the image r under, fully qualified with docker hub named docker.io
+func containerdName(r gname.Reference) string {
+	registry := r.Context().RegistryStr()
+	if registry == gname.DefaultRegistry {
+		registry = "docker.io"
+	}
+	sep := ":"
+	if _, ok := r.(gname.Digest); ok {
+		sep = "@"
+	}
+	return registry + "/" + r.Context().RepositoryStr() + sep + r.Identifier()
+}
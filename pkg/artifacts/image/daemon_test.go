@@ -0,0 +1,138 @@
+package image_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/rancherfederal/hauler/pkg/artifacts/image"
+)
+
+func TestSaveFromContainerd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ctr is a shell script")
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "export.tar")
+	if err := tarball.MultiRefWriteToFile(archive, map[gname.Reference]gv1.Image{
+		gname.MustParseReference("docker.io/library/app:v1"): img,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a ctr recording its arguments and exporting the archive to the path it's given
+	bin := t.TempDir()
+	args := filepath.Join(bin, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + args + "\ncp " + archive + " \"$5\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "ctr"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name      string
+		namespace string
+		ref       string
+		wantArgs  string
+	}{
+		{
+			name:     "should export from the default namespace under the fully qualified name",
+			ref:      "app:v1",
+			wantArgs: "--namespace default images export %s docker.io/library/app:v1",
+		},
+		{
+			name:      "should export from the namespace",
+			namespace: "k8s.io",
+			ref:       "index.docker.io/library/app:v1",
+			wantArgs:  "--namespace k8s.io images export %s docker.io/library/app:v1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image.tar")
+			if err := image.SaveFromContainerd(context.Background(), tt.namespace, tt.ref, path); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.Replace(tt.wantArgs, "%s", path, 1); strings.TrimSpace(string(got)) != want {
+				t.Errorf("SaveFromContainerd() ran ctr %s, want %s", strings.TrimSpace(string(got)), want)
+			}
+
+			imgs, err := image.FromDockerArchive(path, tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(imgs) != 1 || imgs[0].Name != "index.docker.io/library/app:v1" {
+				t.Errorf("FromDockerArchive() of the export = %v, want index.docker.io/library/app:v1", imgs)
+			}
+		})
+	}
+}
+
+func TestImportToContainerd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ctr is a shell script")
+	}
+
+	// a ctr recording its arguments
+	bin := t.TempDir()
+	args := filepath.Join(bin, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + args + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "ctr"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		name      string
+		namespace string
+		address   string
+		env       string
+		wantArgs  string
+	}{
+		{
+			name:     "should import into the kubernetes namespace of the containerd of the environment",
+			env:      "/run/custom/containerd.sock",
+			wantArgs: "--address /run/custom/containerd.sock --namespace k8s.io images import images.tar",
+		},
+		{
+			name:      "should import into the namespace of the containerd at the address",
+			namespace: "default",
+			address:   "/run/k3s/containerd/containerd.sock",
+			env:       "/run/custom/containerd.sock",
+			wantArgs:  "--address /run/k3s/containerd/containerd.sock --namespace default images import images.tar",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONTAINERD_ADDRESS", tt.env)
+			if err := image.ImportToContainerd(context.Background(), tt.namespace, tt.address, "images.tar"); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(string(got)) != tt.wantArgs {
+				t.Errorf("ImportToContainerd() ran ctr %s, want %s", strings.TrimSpace(string(got)), tt.wantArgs)
+			}
+		})
+	}
+}
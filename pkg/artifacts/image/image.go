@@ -1,16 +1,23 @@
 package image
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/google/go-containerregistry/pkg/authn"
+	cplatforms "github.com/containerd/containerd/platforms"
 	gname "github.com/google/go-containerregistry/pkg/name"
 	gv1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 
 	"github.com/rancherfederal/hauler/pkg/artifacts"
+	"github.com/rancherfederal/hauler/pkg/content"
 )
 
-var _ artifacts.OCI = (*Image)(nil)
+var (
+	_ artifacts.OCI     = (*Image)(nil)
+	_ artifacts.Sourced = (*Image)(nil)
+)
 
 func (i *Image) MediaType() string {
 	mt, err := i.Image.MediaType()
@@ -31,6 +38,15 @@ type Image struct {
 	gv1.Image
 }
 
+// Repository returns the repository the image is pulled from
+func (i *Image) Repository() string {
+	r, err := gname.ParseReference(i.Name)
+	if err != nil {
+		return ""
+	}
+	return r.Context().Name()
+}
+
 func NewImage(name string, opts ...remote.Option) (*Image, error) {
 	r, err := gname.ParseReference(name)
 	if err != nil {
@@ -38,7 +54,7 @@ func NewImage(name string, opts ...remote.Option) (*Image, error) {
 	}
 
 	defaultOpts := []remote.Option{
-		remote.WithAuthFromKeychain(authn.DefaultKeychain),
+		remote.WithAuthFromKeychain(content.Keychain),
 	}
 	opts = append(opts, defaultOpts...)
 
@@ -60,7 +76,7 @@ func IsMultiArchImage(name string, opts ...remote.Option) (bool, error) {
     }
 
 	defaultOpts := []remote.Option{
-		remote.WithAuthFromKeychain(authn.DefaultKeychain),
+		remote.WithAuthFromKeychain(content.Keychain),
 	}
 	opts = append(opts, defaultOpts...)
 
@@ -77,4 +93,179 @@ func IsMultiArchImage(name string, opts ...remote.Option) (bool, error) {
 
     // If the descriptor could be converted to an image index, it's a multi-arch image
     return true, nil
-}
\ No newline at end of file
+}
+
+// Resolve returns the descriptor a registry currently serves for name, along with its manifests when it's an index
+//
+//	Only an index's manifest is pulled, anything else is resolved with a HEAD request.
+func Resolve(name string, opts ...remote.Option) (ocispec.Descriptor, []ocispec.Descriptor, error) {
+	ref, err := gname.ParseReference(name)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, fmt.Errorf("parsing reference %q: %v", name, err)
+	}
+
+	defaultOpts := []remote.Option{
+		remote.WithAuthFromKeychain(content.Keychain),
+	}
+	opts = append(opts, defaultOpts...)
+
+	head, err := remote.Head(ref, opts...)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, fmt.Errorf("resolving image %q: %v", name, err)
+	}
+	desc, err := toOCI(*head)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	if !head.MediaType.IsIndex() {
+		return desc, nil, nil
+	}
+
+	idx, err := remote.Index(ref, opts...)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, fmt.Errorf("getting index %q: %v", name, err)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return ocispec.Descriptor{}, nil, fmt.Errorf("reading index %q: %v", name, err)
+	}
+
+	manifests := make([]ocispec.Descriptor, len(im.Manifests))
+	for i, m := range im.Manifests {
+		if manifests[i], err = toOCI(m); err != nil {
+			return ocispec.Descriptor{}, nil, err
+		}
+	}
+	return desc, manifests, nil
+}
+
+// Blobs returns the descriptors of the manifests, configs, and layers pulling name fetches, narrowed down to the
+// manifests of platforms when name is an index
+//
+//	The index itself is left out when narrowed down to a single platform, as only that platform's manifest is stored.
+func Blobs(name string, platforms []ocispec.Platform, opts ...remote.Option) ([]ocispec.Descriptor, error) {
+	ref, err := gname.ParseReference(name)
+	if err != nil {
+		return nil, fmt.Errorf("parsing reference %q: %v", name, err)
+	}
+
+	defaultOpts := []remote.Option{
+		remote.WithAuthFromKeychain(content.Keychain),
+	}
+	opts = append(opts, defaultOpts...)
+
+	desc, err := remote.Get(ref, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("getting image %q: %v", name, err)
+	}
+
+	if !desc.MediaType.IsIndex() {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, fmt.Errorf("getting image %q: %v", name, err)
+		}
+		return imageBlobs(img)
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("getting index %q: %v", name, err)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("reading index %q: %v", name, err)
+	}
+
+	var blobs []ocispec.Descriptor
+	if len(platforms) != 1 {
+		d, err := toOCI(desc.Descriptor)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, d)
+	}
+
+	matchers := make([]cplatforms.Matcher, len(platforms))
+	for i, p := range platforms {
+		matchers[i] = cplatforms.NewMatcher(p)
+	}
+	for _, m := range im.Manifests {
+		if !m.MediaType.IsImage() {
+			continue
+		}
+		if len(matchers) > 0 && !matchesAny(matchers, m.Platform) {
+			continue
+		}
+
+		img, err := idx.Image(m.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("getting image %s of %q: %v", m.Digest, name, err)
+		}
+		ds, err := imageBlobs(img)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, ds...)
+	}
+	return blobs, nil
+}
+
+// imageBlobs returns the descriptors of img's manifest, config, and layers
+func imageBlobs(img gv1.Image) ([]ocispec.Descriptor, error) {
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	d, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+	size, err := img.Size()
+	if err != nil {
+		return nil, err
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := []ocispec.Descriptor{{MediaType: string(mt), Digest: digest.Digest(d.String()), Size: size}}
+	for _, b := range append([]gv1.Descriptor{m.Config}, m.Layers...) {
+		desc, err := toOCI(b)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, desc)
+	}
+	return blobs, nil
+}
+
+func matchesAny(matchers []cplatforms.Matcher, p *gv1.Platform) bool {
+	if p == nil {
+		return false
+	}
+	op := ocispec.Platform{
+		Architecture: p.Architecture,
+		OS:           p.OS,
+		OSVersion:    p.OSVersion,
+		OSFeatures:   p.OSFeatures,
+		Variant:      p.Variant,
+	}
+	for _, m := range matchers {
+		if m.Match(op) {
+			return true
+		}
+	}
+	return false
+}
+
+// toOCI converts a go-containerregistry descriptor to its image-spec equivalent, which shares the same json form
+func toOCI(d gv1.Descriptor) (ocispec.Descriptor, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	var desc ocispec.Descriptor
+	err = json.Unmarshal(data, &desc)
+	return desc, err
+}
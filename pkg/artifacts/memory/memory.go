@@ -10,13 +10,17 @@ import (
 	"github.com/rancherfederal/hauler/pkg/consts"
 )
 
-var _ artifacts.OCI = (*Memory)(nil)
+var (
+	_ artifacts.OCI           = (*Memory)(nil)
+	_ artifacts.ArtifactTyper = (*Memory)(nil)
+)
 
 // Memory implements the OCI interface for a generic set of bytes stored in memory.
 type Memory struct {
-	blob        v1.Layer
-	annotations map[string]string
-	config      artifacts.Config
+	blob         v1.Layer
+	annotations  map[string]string
+	config       artifacts.Config
+	artifactType string
 }
 
 type defaultConfig struct {
@@ -29,7 +33,7 @@ func NewMemory(data []byte, mt string, opts ...Option) *Memory {
 	cfg := defaultConfig{MediaType: consts.MemoryConfigMediaType}
 	m := &Memory{
 		blob:   blob,
-		config: artifacts.ToConfig(cfg),
+		config: artifacts.ToConfig(cfg, artifacts.WithConfigMediaType(consts.MemoryConfigMediaType)),
 	}
 
 	for _, opt := range opts {
@@ -38,6 +42,11 @@ func NewMemory(data []byte, mt string, opts ...Option) *Memory {
 	return m
 }
 
+// ArtifactType returns the OCI 1.1 artifactType set with WithArtifactType, if any
+func (m *Memory) ArtifactType() string {
+	return m.artifactType
+}
+
 func (m *Memory) MediaType() string {
 	return consts.OCIManifestSchema1
 }
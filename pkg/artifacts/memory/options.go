@@ -15,3 +15,10 @@ func WithAnnotations(annotations map[string]string) Option {
 		m.annotations = annotations
 	}
 }
+
+// WithArtifactType sets the OCI 1.1 artifactType written to the artifact's manifest
+func WithArtifactType(artifactType string) Option {
+	return func(m *Memory) {
+		m.artifactType = artifactType
+	}
+}
@@ -15,6 +15,18 @@ type OCI interface {
 	Layers() ([]v1.Layer, error)
 }
 
+// ArtifactTyper is implemented by artifacts that declare an OCI 1.1 artifactType on their manifest
+//  Artifacts that don't implement it, or return an empty type, are identified by their config's media type alone
+type ArtifactTyper interface {
+	ArtifactType() string
+}
+
+// Sourced is implemented by artifacts pulled from a registry, naming the repository their blobs are served from
+//  The store resumes an interrupted layer download from it with a ranged request, rather than starting over
+type Sourced interface {
+	Repository() string
+}
+
 type OCICollection interface {
 	// Contents returns the list of contents in the collection
 	Contents() (map[string]OCI, error)
@@ -1,6 +1,7 @@
 package chart
 
 import (
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/rancherfederal/hauler/pkg/artifacts"
 	"github.com/rancherfederal/hauler/pkg/artifacts/image"
 	"helm.sh/helm/v3/pkg/action"
@@ -19,18 +20,22 @@ type tchart struct {
 
 	computed bool
 	contents map[string]artifacts.OCI
+
+	remoteOpts []remote.Option
 }
 
-func NewThickChart(cfg v1alpha1.ThickChart, opts *action.ChartPathOptions) (artifacts.OCICollection, error) {
+// NewThickChart returns a collection of the chart and its images, remoteOpts are used when fetching the images
+func NewThickChart(cfg v1alpha1.ThickChart, opts *action.ChartPathOptions, remoteOpts ...remote.Option) (artifacts.OCICollection, error) {
 	o, err := chart.NewChart(cfg.Chart.Name, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	return &tchart{
-		chart:    o,
-		config:   cfg,
-		contents: make(map[string]artifacts.OCI),
+		chart:      o,
+		config:     cfg,
+		contents:   make(map[string]artifacts.OCI),
+		remoteOpts: remoteOpts,
 	}, nil
 }
 
@@ -80,13 +85,17 @@ func (c *tchart) dependentImages() error {
 		return err
 	}
 
-	imgs, err := ImagesInChart(ch)
+	vals, err := LoadValues(c.config.ValuesFiles...)
+	if err != nil {
+		return err
+	}
+	imgs, err := ImagesInChart(ch, vals)
 	if err != nil {
 		return err
 	}
 
 	for _, img := range imgs.Spec.Images {
-		i, err := image.NewImage(img.Name)
+		i, err := image.NewImage(img.Name, c.remoteOpts...)
 		if err != nil {
 			return err
 		}
@@ -97,7 +106,7 @@ func (c *tchart) dependentImages() error {
 
 func (c *tchart) extraImages() error {
 	for _, img := range c.config.ExtraImages {
-		i, err := image.NewImage(img.Reference)
+		i, err := image.NewImage(img.Reference, c.remoteOpts...)
 		if err != nil {
 			return err
 		}
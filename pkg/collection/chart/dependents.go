@@ -9,6 +9,8 @@ import (
 	"helm.sh/helm/v3/pkg/action"
 	helmchart "helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/kube/fake"
 	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
@@ -26,16 +28,23 @@ var defaultKnownImagePaths = []string{
 	// Pods
 	"{.spec.initContainers[*].image}",
 	"{.spec.containers[*].image}",
+
+	// CronJobs
+	"{.spec.jobTemplate.spec.template.spec.initContainers[*].image}",
+	"{.spec.jobTemplate.spec.template.spec.containers[*].image}",
 }
 
-// ImagesInChart will render a chart and identify all dependent images from it
-func ImagesInChart(c *helmchart.Chart) (v1alpha1.Images, error) {
-	docs, err := template(c)
+// ImagesInChart will render a chart with vals and identify all dependent images from it
+//
+//	vals may be nil to render the chart with its default values, only images the rendered chart refers to are found.
+func ImagesInChart(c *helmchart.Chart, vals map[string]interface{}) (v1alpha1.Images, error) {
+	docs, err := template(c, vals)
 	if err != nil {
 		return v1alpha1.Images{}, err
 	}
 
 	var images []v1alpha1.Image
+	seen := make(map[string]bool)
 	reader := yaml.NewYAMLReader(bufio.NewReader(strings.NewReader(docs)))
 	for {
 		raw, err := reader.Read()
@@ -46,8 +55,12 @@ func ImagesInChart(c *helmchart.Chart) (v1alpha1.Images, error) {
 			return v1alpha1.Images{}, err
 		}
 
-		found := find(raw, defaultKnownImagePaths...)
+		found := FindImages(raw)
 		for _, f := range found {
+			if seen[f] {
+				continue
+			}
+			seen[f] = true
 			images = append(images, v1alpha1.Image{Name: f})
 		}
 	}
@@ -60,7 +73,13 @@ func ImagesInChart(c *helmchart.Chart) (v1alpha1.Images, error) {
 	return ims, nil
 }
 
-func template(c *helmchart.Chart) (string, error) {
+// LoadValues merges the values files at paths the way helm does, later files taking precedence
+func LoadValues(paths ...string) (map[string]interface{}, error) {
+	opts := &values.Options{ValueFiles: paths}
+	return opts.MergeValues(getter.Providers{})
+}
+
+func template(c *helmchart.Chart, vals map[string]interface{}) (string, error) {
 	s := storage.Init(driver.NewMemory())
 
 	templateCfg := &action.Configuration{
@@ -71,9 +90,9 @@ func template(c *helmchart.Chart) (string, error) {
 		Log:              func(format string, v ...interface{}) {},
 	}
 
-	// TODO: Do we need values if we're claiming this is best effort image detection?
-	//       Justification being: if users are relying on us to get images from their values, they could just add images to the []ImagesInChart spec of the Store api
-	vals := make(map[string]interface{})
+	if vals == nil {
+		vals = make(map[string]interface{})
+	}
 
 	client := action.NewInstall(templateCfg)
 	client.ReleaseName = "dry"
@@ -90,6 +109,13 @@ func template(c *helmchart.Chart) (string, error) {
 	return release.Manifest, nil
 }
 
+// FindImages returns the images the kubernetes manifest data refers to at the jsonpaths, such as
+// '{.spec.containers[*].image}', along with those at the known paths of pods and workloads
+func FindImages(data []byte, paths ...string) []string {
+	all := append([]string{}, defaultKnownImagePaths...)
+	return find(data, append(all, paths...)...)
+}
+
 func find(data []byte, paths ...string) []string {
 	var (
 		pathMatches []string
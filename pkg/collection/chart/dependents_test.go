@@ -0,0 +1,131 @@
+package chart_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	helmchart "helm.sh/helm/v3/pkg/chart"
+
+	"github.com/rancherfederal/hauler/pkg/collection/chart"
+)
+
+const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: init
+          image: {{ .Values.image }}
+      containers:
+        - name: app
+          image: {{ .Values.image }}
+        {{- if .Values.sidecar.enabled }}
+        - name: sidecar
+          image: {{ .Values.sidecar.image }}
+        {{- end }}
+`
+
+const cronJob = `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  schedule: "@daily"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: backup
+              image: {{ .Values.backup.image }}
+`
+
+func testChart() *helmchart.Chart {
+	return &helmchart.Chart{
+		Metadata: &helmchart.Metadata{APIVersion: "v2", Name: "app", Version: "1.0.0"},
+		Values: map[string]interface{}{
+			"image":   "nginx:1.25",
+			"sidecar": map[string]interface{}{"enabled": false, "image": "envoyproxy/envoy:v1.28"},
+			"backup":  map[string]interface{}{"image": "busybox:1.36"},
+		},
+		Templates: []*helmchart.File{
+			{Name: "templates/deployment.yaml", Data: []byte(deployment)},
+			{Name: "templates/cronjob.yaml", Data: []byte(cronJob)},
+		},
+	}
+}
+
+func TestImagesInChart(t *testing.T) {
+	dir := t.TempDir()
+	writeValues := func(name string, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	sidecar := writeValues("sidecar.yaml", "sidecar:\n  enabled: true\n")
+	mirror := writeValues("mirror.yaml", "image: registry.example.com/nginx:1.25\nsidecar:\n  image: registry.example.com/envoy:v1.28\n")
+
+	tests := []struct {
+		name        string
+		valuesFiles []string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name: "should find images rendered with the default values once",
+			want: []string{"busybox:1.36", "nginx:1.25"},
+		},
+		{
+			name:        "should find images only rendered with the values files",
+			valuesFiles: []string{sidecar},
+			want:        []string{"busybox:1.36", "envoyproxy/envoy:v1.28", "nginx:1.25"},
+		},
+		{
+			name:        "should let later values files take precedence",
+			valuesFiles: []string{sidecar, mirror},
+			want:        []string{"busybox:1.36", "registry.example.com/envoy:v1.28", "registry.example.com/nginx:1.25"},
+		},
+		{
+			name:        "should fail for missing values files",
+			valuesFiles: []string{filepath.Join(dir, "missing.yaml")},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vals, err := chart.LoadValues(tt.valuesFiles...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			imgs, err := chart.ImagesInChart(testChart(), vals)
+			if err != nil {
+				t.Fatalf("ImagesInChart() error = %v", err)
+			}
+			got := make(map[string]bool)
+			for _, i := range imgs.Spec.Images {
+				if got[i.Name] {
+					t.Errorf("ImagesInChart() found [%s] more than once", i.Name)
+				}
+				got[i.Name] = true
+			}
+			want := make(map[string]bool)
+			for _, w := range tt.want {
+				want[w] = true
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ImagesInChart() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package custom
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/rancherfederal/hauler/pkg/apis/hauler.cattle.io/v1alpha1"
+	"github.com/rancherfederal/hauler/pkg/content"
+)
+
+// Load returns the collections defined in the rendered file data, only the one called name when name is set
+//
+//	Every document of the file must be a Collection, so a shared collection file can't sync anything else.
+func Load(data []byte, name string) ([]v1alpha1.Collection, error) {
+	var collections []v1alpha1.Collection
+	reader := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		raw, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+
+		obj, err := content.Load(raw)
+		if err != nil {
+			return nil, err
+		}
+		gvk := obj.GroupVersionKind()
+		if gvk.GroupVersion() != v1alpha1.CollectionGroupVersion || gvk.Kind != v1alpha1.CollectionKind {
+			return nil, fmt.Errorf("[%s] is not a %s", gvk.String(), v1alpha1.CollectionKind)
+		}
+
+		var c v1alpha1.Collection
+		if err := yaml.Unmarshal(raw, &c); err != nil {
+			return nil, err
+		}
+		if name == "" || c.Name == name {
+			collections = append(collections, c)
+		}
+	}
+
+	if name != "" && len(collections) == 0 {
+		return nil, fmt.Errorf("no collection [%s] defined", name)
+	}
+	return collections, nil
+}
+
+// Documents returns the images, charts, and files of c as the content documents listing them, synced the same as
+// content documents written by hand
+func Documents(c v1alpha1.Collection) ([][]byte, error) {
+	meta := func(kind string) *metav1.TypeMeta {
+		return &metav1.TypeMeta{APIVersion: v1alpha1.ContentGroupVersion.String(), Kind: kind}
+	}
+	om := metav1.ObjectMeta{Name: c.Name}
+
+	var objs []interface{}
+	if len(c.Spec.Images) > 0 {
+		objs = append(objs, v1alpha1.Images{TypeMeta: meta(v1alpha1.ImagesContentKind), ObjectMeta: om, Spec: v1alpha1.ImageSpec{Images: c.Spec.Images}})
+	}
+	if len(c.Spec.Charts) > 0 {
+		objs = append(objs, v1alpha1.Charts{TypeMeta: meta(v1alpha1.ChartsContentKind), ObjectMeta: om, Spec: v1alpha1.ChartSpec{Charts: c.Spec.Charts}})
+	}
+	if len(c.Spec.Files) > 0 {
+		objs = append(objs, v1alpha1.Files{TypeMeta: meta(v1alpha1.FilesContentKind), ObjectMeta: om, Spec: v1alpha1.FileSpec{Files: c.Spec.Files}})
+	}
+
+	docs := make([][]byte, 0, len(objs))
+	for _, obj := range objs {
+		doc, err := sigsyaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
@@ -0,0 +1,151 @@
+package custom_test
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/rancherfederal/hauler/pkg/apis/hauler.cattle.io/v1alpha1"
+	"github.com/rancherfederal/hauler/pkg/collection/custom"
+	"github.com/rancherfederal/hauler/pkg/content"
+)
+
+const collections = `apiVersion: collection.hauler.cattle.io/v1alpha1
+kind: Collection
+metadata:
+  name: monitoring
+spec:
+  images:
+    - name: grafana/grafana:10.2.0
+  charts:
+    - name: grafana
+      repoURL: https://grafana.github.io/helm-charts
+      version: 7.0.0
+---
+apiVersion: collection.hauler.cattle.io/v1alpha1
+kind: Collection
+metadata:
+  name: logging
+spec:
+  files:
+    - path: https://example.com/fluent-bit.conf
+      name: fluent-bit.conf
+`
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		collection string
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name: "should load every collection",
+			data: collections,
+			want: []string{"monitoring", "logging"},
+		},
+		{
+			name:       "should load only the collection named",
+			data:       collections,
+			collection: "logging",
+			want:       []string{"logging"},
+		},
+		{
+			name:       "should fail when no collection has the name",
+			data:       collections,
+			collection: "tracing",
+			wantErr:    true,
+		},
+		{
+			name: "should refuse files defining anything else",
+			data: collections + `---
+apiVersion: content.hauler.cattle.io/v1alpha1
+kind: Images
+spec:
+  images:
+    - name: busybox
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := custom.Load([]byte(tt.data), tt.collection)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var names []string
+			for _, c := range got {
+				names = append(names, c.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("Load() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocuments(t *testing.T) {
+	cs, err := custom.Load([]byte(collections), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		collection v1alpha1.Collection
+		want       []string
+	}{
+		{
+			name:       "should list images before charts",
+			collection: cs[0],
+			want:       []string{v1alpha1.ImagesContentKind, v1alpha1.ChartsContentKind},
+		},
+		{
+			name:       "should list only what the collection has",
+			collection: cs[1],
+			want:       []string{v1alpha1.FilesContentKind},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := custom.Documents(tt.collection)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var kinds []string
+			for _, doc := range docs {
+				obj, err := content.Load(doc)
+				if err != nil {
+					t.Fatalf("content.Load() error = %v", err)
+				}
+				if gv := obj.GroupVersionKind().GroupVersion(); gv != v1alpha1.ContentGroupVersion {
+					t.Errorf("Documents() group version = %s, want %s", gv, v1alpha1.ContentGroupVersion)
+				}
+				kinds = append(kinds, obj.GroupVersionKind().Kind)
+			}
+			if !reflect.DeepEqual(kinds, tt.want) {
+				t.Errorf("Documents() kinds = %v, want %v", kinds, tt.want)
+			}
+		})
+	}
+
+	// the documents round trip what the collection lists
+	docs, err := custom.Documents(cs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var images v1alpha1.Images
+	if err := yaml.Unmarshal(docs[0], &images); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(images.Spec.Images, cs[0].Spec.Images) {
+		t.Errorf("Documents() images = %v, want %v", images.Spec.Images, cs[0].Spec.Images)
+	}
+}
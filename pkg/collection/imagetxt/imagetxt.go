@@ -12,15 +12,19 @@ import (
 	"github.com/rancherfederal/hauler/pkg/log"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	artifact "github.com/rancherfederal/hauler/pkg/artifacts"
 	"github.com/rancherfederal/hauler/pkg/artifacts/file/getter"
 	"github.com/rancherfederal/hauler/pkg/artifacts/image"
 )
 
 type ImageTxt struct {
-	Ref            string
-	IncludeSources map[string]bool
-	ExcludeSources map[string]bool
+	Ref             string
+	IncludeSources  map[string]bool
+	ExcludeSources  map[string]bool
+	IncludeSections map[string]bool
+	ExcludeSections map[string]bool
+	RemoteOptions   []remote.Option
 
 	lock     *sync.Mutex
 	client   *getter.Client
@@ -66,6 +70,54 @@ func WithExcludeSources(exclude ...string) Option {
 	return withExcludeSources(exclude)
 }
 
+type withIncludeSections []string
+
+func (o withIncludeSections) Apply(it *ImageTxt) error {
+	if it.IncludeSections == nil {
+		it.IncludeSections = make(map[string]bool)
+	}
+	for _, s := range o {
+		it.IncludeSections[s] = true
+	}
+	return nil
+}
+
+// WithIncludeSections only pulls the images listed under the comment headers matching one of include, such as
+// '# cert-manager'
+func WithIncludeSections(include ...string) Option {
+	return withIncludeSections(include)
+}
+
+type withExcludeSections []string
+
+func (o withExcludeSections) Apply(it *ImageTxt) error {
+	if it.ExcludeSections == nil {
+		it.ExcludeSections = make(map[string]bool)
+	}
+	for _, s := range o {
+		it.ExcludeSections[s] = true
+	}
+	return nil
+}
+
+// WithExcludeSections never pulls the images listed under the comment headers matching one of exclude, taking
+// precedence over WithIncludeSections
+func WithExcludeSections(exclude ...string) Option {
+	return withExcludeSections(exclude)
+}
+
+type withRemoteOptions []remote.Option
+
+func (o withRemoteOptions) Apply(it *ImageTxt) error {
+	it.RemoteOptions = append(it.RemoteOptions, o...)
+	return nil
+}
+
+// WithRemoteOptions sets the remote.Option's used when fetching each image in the image.txt
+func WithRemoteOptions(opts ...remote.Option) Option {
+	return withRemoteOptions(opts)
+}
+
 func New(ref string, opts ...Option) (*ImageTxt, error) {
 	it := &ImageTxt{
 		Ref: ref,
@@ -173,8 +225,13 @@ func (it *ImageTxt) compute() error {
 			}
 		}
 
+		if !it.sectionMatches(e.Section) {
+			l.Debugf("skipping image %s (section %q is filtered out)", e.Reference, e.Section)
+			continue
+		}
+
 		if pullAll || matchesSourceFilter {
-			curImage, err := image.NewImage(e.Reference.String())
+			curImage, err := image.NewImage(e.Reference.String(), it.RemoteOptions...)
 			if err != nil {
 				return fmt.Errorf("pull image %s: %v", e.Reference, err)
 			}
@@ -185,25 +242,42 @@ func (it *ImageTxt) compute() error {
 	return nil
 }
 
+// sectionMatches reports whether the images listed under section pass the section filters
+func (it *ImageTxt) sectionMatches(section string) bool {
+	if it.ExcludeSections[section] {
+		return false
+	}
+	return len(it.IncludeSections) == 0 || it.IncludeSections[section]
+}
+
 type imageTxtEntry struct {
 	Reference name.Reference
 	Sources   map[string]bool
+
+	// Section is the comment header the entry is listed under, empty for entries before the first header
+	Section string
 }
 
 func splitImagesTxt(r io.Reader) ([]imageTxtEntry, error) {
 	var entries []imageTxtEntry
+	var section string
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		curEntry := imageTxtEntry{
 			Sources: make(map[string]bool),
+			Section: section,
 		}
 
-		lineContent := scanner.Text()
-		if lineContent == "" || strings.HasPrefix(lineContent, "#") {
-			// skip past empty and commented lines
+		lineContent := strings.TrimSpace(scanner.Text())
+		if lineContent == "" {
+			continue
+		}
+		if strings.HasPrefix(lineContent, "#") {
+			// commented lines start a section, naming the images listed after them
+			section = strings.TrimSpace(strings.TrimPrefix(lineContent, "#"))
 			continue
 		}
-		splitContent := strings.Split(lineContent, " ")
+		splitContent := strings.Fields(lineContent)
 		if len(splitContent) > 2 {
 			return nil, fmt.Errorf(
 				"invalid image.txt format: must contain only an image reference and sources separated by space; invalid line: %q",
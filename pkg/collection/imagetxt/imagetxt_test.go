@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/rancherfederal/hauler/pkg/artifacts"
@@ -69,13 +71,15 @@ func checkError(checkedFailKind failKind) func(*testing.T, error, bool, failKind
 
 func TestImageTxtCollection(t *testing.T) {
 	type testEntry struct {
-		Name           string
-		Ref            string
-		IncludeSources []string
-		ExcludeSources []string
-		ExpectedImages []string
-		ShouldFail     bool
-		FailKind       failKind
+		Name            string
+		Ref             string
+		IncludeSources  []string
+		ExcludeSources  []string
+		IncludeSections []string
+		ExcludeSections []string
+		ExpectedImages  []string
+		ShouldFail      bool
+		FailKind        failKind
 	}
 	tt := []testEntry{
 		{
@@ -151,6 +155,30 @@ func TestImageTxtCollection(t *testing.T) {
 				"quay.io/jetstack/cert-manager-controller:v1.6.1",
 			},
 		},
+		{
+			Name: "http ref sections format include sections",
+			Ref:  fmt.Sprintf("%s/images-sections-http.txt", testServer.URL),
+			IncludeSections: []string{
+				"core", "cert-manager",
+			},
+			ExpectedImages: []string{
+				"busybox",
+				"nginx:1.19",
+				"quay.io/jetstack/cert-manager-controller:v1.6.1",
+			},
+		},
+		{
+			Name: "http ref sections format exclude sections",
+			Ref:  fmt.Sprintf("%s/images-sections-http.txt", testServer.URL),
+			ExcludeSections: []string{
+				"rke",
+			},
+			ExpectedImages: []string{
+				"busybox",
+				"nginx:1.19",
+				"quay.io/jetstack/cert-manager-controller:v1.6.1",
+			},
+		},
 		{
 			Name: "local file ref",
 			Ref:  "./testdata/images-file.txt",
@@ -172,6 +200,8 @@ func TestImageTxtCollection(t *testing.T) {
 			curImageTxt, err := New(curTest.Ref,
 				WithIncludeSources(curTest.IncludeSources...),
 				WithExcludeSources(curTest.ExcludeSources...),
+				WithIncludeSections(curTest.IncludeSections...),
+				WithExcludeSections(curTest.ExcludeSections...),
 			)
 			checkErrorNew(innerT, err, curTest.ShouldFail, curTest.FailKind)
 
@@ -185,6 +215,58 @@ func TestImageTxtCollection(t *testing.T) {
 	}
 }
 
+func TestSplitImagesTxt(t *testing.T) {
+	tests := []struct {
+		name    string
+		txt     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "should list images before any header in no section",
+			txt:  "busybox\nnginx:1.19 core,nginx\n",
+			want: map[string]string{"busybox": "", "nginx:1.19": ""},
+		},
+		{
+			name: "should list images under the header before them",
+			txt:  "busybox\n# rke\nrancher/hyperkube:v1.21.7-rancher1\n\n#cert-manager\nquay.io/jetstack/cert-manager-controller:v1.6.1\n",
+			want: map[string]string{
+				"busybox":                            "",
+				"rancher/hyperkube:v1.21.7-rancher1": "rke",
+				"quay.io/jetstack/cert-manager-controller:v1.6.1": "cert-manager",
+			},
+		},
+		{
+			name: "should tolerate surrounding whitespace",
+			txt:  "  # core  \r\n\tbusybox\tcore \r\n",
+			want: map[string]string{"busybox": "core"},
+		},
+		{
+			name:    "should refuse lines with more than a reference and sources",
+			txt:     "busybox core extra\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := splitImagesTxt(strings.NewReader(tt.txt))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitImagesTxt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := make(map[string]string, len(entries))
+			for _, e := range entries {
+				got[e.Reference.String()] = e.Section
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitImagesTxt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func checkImages(content map[string]artifacts.OCI, refs []string) error {
 	contentCopy := make(map[string]artifacts.OCI, len(content))
 	for k, v := range content {
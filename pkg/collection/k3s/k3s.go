@@ -10,6 +10,8 @@ import (
 	"path"
 	"strings"
 
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
 	"github.com/rancherfederal/hauler/pkg/artifacts"
 	"github.com/rancherfederal/hauler/pkg/artifacts/image"
 
@@ -28,11 +30,18 @@ const (
 	bootstrapUrl = "https://get.k3s.io"
 )
 
+// InstallScriptName is the name the install script is stored and extracted as, for running with
+// INSTALL_K3S_SKIP_DOWNLOAD=true once the executable and airgap images are in place
+const InstallScriptName = "k3s-init.sh"
+
 var (
-	ErrImagesNotFound     = errors.New("k3s dependent images not found")
-	ErrFetchingImages     = errors.New("failed to fetch k3s dependent images")
-	ErrExecutableNotfound = errors.New("k3s executable not found")
-	ErrChannelNotFound    = errors.New("desired k3s channel not found")
+	ErrImagesNotFound       = errors.New("k3s dependent images not found")
+	ErrFetchingImages       = errors.New("failed to fetch k3s dependent images")
+	ErrExecutableNotfound   = errors.New("k3s executable not found")
+	ErrAirgapImagesNotFound = errors.New("k3s airgap images not found")
+	ErrChecksumsNotFound    = errors.New("k3s checksums not found")
+	ErrChannelNotFound      = errors.New("desired k3s channel not found")
+	ErrUnsupportedArch      = errors.New("unsupported k3s architecture")
 )
 
 type k3s struct {
@@ -42,16 +51,86 @@ type k3s struct {
 	computed bool
 	contents map[string]artifacts.OCI
 	channels map[string]string
-	client   *getter.Client
+	client   *http.Client
+
+	// where releases, channels, and the install script are fetched from
+	releasesUrl  string
+	channelsUrl  string
+	installerUrl string
+
+	remoteOpts []remote.Option
 }
 
-func NewK3s(version string) (artifacts.OCICollection, error) {
+// NewK3s returns the k3s collection for version on arch, remoteOpts are used when fetching its dependent images
+//
+//	version may also be a release channel such as 'stable', resolved to the latest version in it.  The executable,
+//	airgap images tarball, and checksums of the release are stored under the well known references returned by
+//	Reference, along with each image k3s depends on and the install script.
+func NewK3s(version string, arch string, remoteOpts ...remote.Option) (artifacts.OCICollection, error) {
+	a, err := normalizeArch(arch)
+	if err != nil {
+		return nil, err
+	}
+
 	return &k3s{
-		version:  version,
-		contents: make(map[string]artifacts.OCI),
+		version:      version,
+		arch:         a,
+		contents:     make(map[string]artifacts.OCI),
+		client:       http.DefaultClient,
+		releasesUrl:  releaseUrl,
+		channelsUrl:  channelUrl,
+		installerUrl: bootstrapUrl,
+		remoteOpts:   remoteOpts,
 	}, nil
 }
 
+// Reference returns the well known reference the release artifact name of version is stored under
+func Reference(name string, version string) string {
+	return fmt.Sprintf("%s/%s:%s", reference.DefaultNamespace, name, dnsCompliant(version))
+}
+
+// ExecutableName returns the name of the k3s executable released for arch
+func ExecutableName(arch string) string {
+	switch arch {
+	case "", "amd64":
+		return "k3s"
+	case "arm":
+		return "k3s-armhf"
+	default:
+		return fmt.Sprintf("k3s-%s", arch)
+	}
+}
+
+// AirgapImagesName returns the name of the tarball of every image k3s depends on released for arch, loaded by k3s
+// from /var/lib/rancher/k3s/agent/images/ on start
+func AirgapImagesName(arch string) string {
+	return fmt.Sprintf("k3s-airgap-images-%s.tar.zst", arch)
+}
+
+// ChecksumsName returns the name the sha256 checksums of the artifacts released for arch are stored under, prefixed
+// to tell it apart from the checksums of other distributions
+func ChecksumsName(arch string) string {
+	return "k3s-" + checksumsAsset(arch)
+}
+
+func checksumsAsset(arch string) string {
+	return fmt.Sprintf("sha256sum-%s.txt", arch)
+}
+
+// normalizeArch returns the architecture k3s names its release artifacts after, defaulting to amd64
+func normalizeArch(arch string) (string, error) {
+	switch arch {
+	case "", "amd64":
+		return "amd64", nil
+	case "arm64":
+		return "arm64", nil
+	case "arm", "armhf":
+		return "arm", nil
+	default:
+		return "", fmt.Errorf("%w: [%s]", ErrUnsupportedArch, arch)
+	}
+}
+
 func (k *k3s) Contents() (map[string]artifacts.OCI, error) {
 	if err := k.compute(); err != nil {
 		return nil, err
@@ -78,6 +157,14 @@ func (k *k3s) compute() error {
 		return err
 	}
 
+	if err := k.airgapImages(); err != nil {
+		return err
+	}
+
+	if err := k.checksums(); err != nil {
+		return err
+	}
+
 	if err := k.bootstrap(); err != nil {
 		return err
 	}
@@ -87,71 +174,103 @@ func (k *k3s) compute() error {
 }
 
 func (k *k3s) executable() error {
-	n := "k3s"
-	if k.arch != "" && k.arch != "amd64" {
-		n = fmt.Sprintf("name-%s", k.arch)
+	n := ExecutableName(k.arch)
+	if !k.released(n) {
+		return ErrExecutableNotfound
 	}
-	fref := k.releaseUrl(n)
 
-	resp, err := http.Head(fref)
-	if resp.StatusCode != http.StatusOK || err != nil {
-		return ErrExecutableNotfound
+	k.contents[Reference(n, k.version)] = k.file(k.releaseUrl(n), n)
+	return nil
+}
+
+// airgapImages adds the airgap images tarball, falling back to the uncompressed tarball of releases predating zstd
+func (k *k3s) airgapImages() error {
+	n := AirgapImagesName(k.arch)
+	for _, asset := range []string{n, strings.TrimSuffix(n, ".zst")} {
+		if k.released(asset) {
+			k.contents[Reference(asset, k.version)] = k.file(k.releaseUrl(asset), asset)
+			return nil
+		}
 	}
+	return ErrAirgapImagesNotFound
+}
 
-	f := file.NewFile(fref)
+func (k *k3s) checksums() error {
+	asset := checksumsAsset(k.arch)
+	if !k.released(asset) {
+		return ErrChecksumsNotFound
+	}
 
-	ref := fmt.Sprintf("%s/k3s:%s", reference.DefaultNamespace, k.dnsCompliantVersion())
-	k.contents[ref] = f
+	n := ChecksumsName(k.arch)
+	k.contents[Reference(n, k.version)] = k.file(k.releaseUrl(asset), n)
 	return nil
 }
 
 func (k *k3s) bootstrap() error {
-	c := getter.NewClient(getter.ClientOptions{NameOverride: "k3s-init.sh"})
-	f := file.NewFile(bootstrapUrl, file.WithClient(c))
-
-	ref := fmt.Sprintf("%s/k3s-init.sh:%s", reference.DefaultNamespace, reference.DefaultTag)
-	k.contents[ref] = f
+	ref := fmt.Sprintf("%s/%s:%s", reference.DefaultNamespace, InstallScriptName, reference.DefaultTag)
+	k.contents[ref] = k.file(k.installerUrl, InstallScriptName)
 	return nil
 }
 
 func (k *k3s) images() error {
-	resp, err := http.Get(k.releaseUrl("k3s-images.txt"))
-	if resp.StatusCode != http.StatusOK {
-		return ErrFetchingImages
-	} else if err != nil {
+	resp, err := k.client.Get(k.releaseUrl("k3s-images.txt"))
+	if err != nil {
 		return ErrImagesNotFound
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ErrFetchingImages
+	}
 
 	scanner := bufio.NewScanner(resp.Body)
 	for scanner.Scan() {
-		reference := scanner.Text()
-		o, err := image.NewImage(reference)
+		reference := strings.TrimSpace(scanner.Text())
+		if reference == "" {
+			continue
+		}
+		o, err := image.NewImage(reference, k.remoteOpts...)
 		if err != nil {
 			return err
 		}
 
 		k.contents[reference] = o
 	}
-	return nil
+	return scanner.Err()
+}
+
+// file returns the file at u, stored and extracted as name
+func (k *k3s) file(u string, name string) *file.File {
+	c := getter.NewClient(getter.ClientOptions{NameOverride: name})
+	return file.NewFile(u, file.WithClient(c))
+}
+
+// released reports whether the release has the artifact name
+func (k *k3s) released(name string) bool {
+	resp, err := k.client.Head(k.releaseUrl(name))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
 }
 
 func (k *k3s) releaseUrl(artifact string) string {
-	u, _ := url.Parse(releaseUrl)
+	u, _ := url.Parse(k.releasesUrl)
 	complete := []string{u.Path}
 	u.Path = path.Join(append(complete, []string{k.version, artifact}...)...)
 	return u.String()
 }
 
-func (k *k3s) dnsCompliantVersion() string {
-	return strings.ReplaceAll(k.version, "+", "-")
+func dnsCompliant(version string) string {
+	return strings.ReplaceAll(version, "+", "-")
 }
 
 func (k *k3s) fetchChannels() error {
-	resp, err := http.Get(channelUrl)
+	resp, err := k.client.Get(k.channelsUrl)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	var c channel
 	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
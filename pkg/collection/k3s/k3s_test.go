@@ -0,0 +1,155 @@
+package k3s
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func newTestServer(t *testing.T, assets ...string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/channels", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"id":"stable","name":"stable","latest":"v1.28.5+k3s1"}]}`))
+	})
+	mux.HandleFunc("/install.sh", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#!/bin/sh\n"))
+	})
+	for _, a := range assets {
+		mux.HandleFunc("/releases/"+a, func(w http.ResponseWriter, r *http.Request) {})
+	}
+
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestK3s_Contents(t *testing.T) {
+	release := []string{
+		"v1.28.5+k3s1/k3s-images.txt",
+		"v1.28.5+k3s1/k3s",
+		"v1.28.5+k3s1/k3s-arm64",
+		"v1.28.5+k3s1/k3s-airgap-images-amd64.tar.zst",
+		"v1.28.5+k3s1/k3s-airgap-images-arm64.tar.zst",
+		"v1.28.5+k3s1/sha256sum-amd64.txt",
+		"v1.28.5+k3s1/sha256sum-arm64.txt",
+		"v1.19.16+k3s1/k3s-images.txt",
+		"v1.19.16+k3s1/k3s",
+		"v1.19.16+k3s1/k3s-airgap-images-amd64.tar",
+		"v1.19.16+k3s1/sha256sum-amd64.txt",
+	}
+
+	tests := []struct {
+		name    string
+		version string
+		arch    string
+		assets  []string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:    "should store the release under well known references",
+			version: "v1.28.5+k3s1",
+			assets:  release,
+			want: []string{
+				"hauler/k3s-airgap-images-amd64.tar.zst:v1.28.5-k3s1",
+				"hauler/k3s-init.sh:latest",
+				"hauler/k3s-sha256sum-amd64.txt:v1.28.5-k3s1",
+				"hauler/k3s:v1.28.5-k3s1",
+			},
+		},
+		{
+			name:    "should store the release of arch",
+			version: "v1.28.5+k3s1",
+			arch:    "arm64",
+			assets:  release,
+			want: []string{
+				"hauler/k3s-airgap-images-arm64.tar.zst:v1.28.5-k3s1",
+				"hauler/k3s-arm64:v1.28.5-k3s1",
+				"hauler/k3s-init.sh:latest",
+				"hauler/k3s-sha256sum-arm64.txt:v1.28.5-k3s1",
+			},
+		},
+		{
+			name:    "should resolve a channel to its latest version",
+			version: "stable",
+			assets:  release,
+			want: []string{
+				"hauler/k3s-airgap-images-amd64.tar.zst:v1.28.5-k3s1",
+				"hauler/k3s-init.sh:latest",
+				"hauler/k3s-sha256sum-amd64.txt:v1.28.5-k3s1",
+				"hauler/k3s:v1.28.5-k3s1",
+			},
+		},
+		{
+			name:    "should fall back to uncompressed airgap images",
+			version: "v1.19.16+k3s1",
+			assets:  release,
+			want: []string{
+				"hauler/k3s-airgap-images-amd64.tar:v1.19.16-k3s1",
+				"hauler/k3s-init.sh:latest",
+				"hauler/k3s-sha256sum-amd64.txt:v1.19.16-k3s1",
+				"hauler/k3s:v1.19.16-k3s1",
+			},
+		},
+		{
+			name:    "should fail without the airgap images",
+			version: "v1.28.5+k3s1",
+			assets:  release[:2],
+			wantErr: ErrAirgapImagesNotFound,
+		},
+		{
+			name:    "should fail without the checksums",
+			version: "v1.28.5+k3s1",
+			assets:  release[:4],
+			wantErr: ErrChecksumsNotFound,
+		},
+		{
+			name:    "should fail for a version that wasn't released",
+			version: "v0.0.0+k3s1",
+			assets:  release,
+			wantErr: ErrFetchingImages,
+		},
+		{
+			name:    "should refuse unsupported architectures",
+			version: "v1.28.5+k3s1",
+			arch:    "s390x",
+			assets:  release,
+			wantErr: ErrUnsupportedArch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.assets...)
+
+			c, err := NewK3s(tt.version, tt.arch)
+			if err != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("NewK3s() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			k := c.(*k3s)
+			k.releasesUrl = s.URL + "/releases"
+			k.channelsUrl = s.URL + "/channels"
+			k.installerUrl = s.URL + "/install.sh"
+
+			contents, err := c.Contents()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Contents() error = %v, want %v", err, tt.wantErr)
+			}
+			var got []string
+			for ref := range contents {
+				got = append(got, ref)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Contents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
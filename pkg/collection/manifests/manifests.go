@@ -0,0 +1,125 @@
+package manifests
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/rancherfederal/hauler/pkg/collection/chart"
+)
+
+// Images returns every image the kubernetes manifests at path refer to, in the order they're first found
+//
+//	path is a manifest file or a directory walked for .yaml, .yml, and .json files.  Directories holding a
+//	kustomization are built with kustomize instead of being walked.  Images are found at the known paths of pods and
+//	workloads, and at the jsonpaths imagePaths, such as '{.spec.image}' for images embedded in custom resources.
+func Images(path string, imagePaths ...string) ([]string, error) {
+	var images []string
+	seen := make(map[string]bool)
+	err := walk(path, func(docs []byte) error {
+		found, err := imagesIn(docs, imagePaths...)
+		if err != nil {
+			return err
+		}
+		for _, i := range found {
+			if !seen[i] {
+				seen[i] = true
+				images = append(images, i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// walk calls fn with the manifests of each file under root, and the built manifests of each kustomization
+func walk(root string, fn func(docs []byte) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if !isKustomization(path) {
+				return nil
+			}
+			docs, err := build(path)
+			if err != nil {
+				return err
+			}
+			if err := fn(docs); err != nil {
+				return err
+			}
+			return filepath.SkipDir
+		}
+
+		// a file given as the root is read whatever its extension
+		if path != root && !isManifest(path) {
+			return nil
+		}
+		docs, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return fn(docs)
+	})
+}
+
+// isManifest reports whether the file at path has the extension of a manifest
+func isManifest(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// isKustomization reports whether dir holds a kustomization file
+func isKustomization(dir string) bool {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// build runs kustomize build on dir
+func build(dir string) ([]byte, error) {
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	m, err := k.Run(filesys.MakeFsOnDisk(), dir)
+	if err != nil {
+		return nil, err
+	}
+	return m.AsYaml()
+}
+
+// imagesIn returns the images each of the yaml documents in docs refers to
+func imagesIn(docs []byte, imagePaths ...string) ([]string, error) {
+	var images []string
+	reader := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(docs)))
+	for {
+		raw, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, chart.FindImages(raw, imagePaths...)...)
+	}
+	return images, nil
+}
@@ -0,0 +1,140 @@
+package manifests_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rancherfederal/hauler/pkg/collection/manifests"
+)
+
+var files = map[string]string{
+	"deploy/app.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: migrate
+          image: registry.example.com/app-migrate:v1
+      containers:
+        - name: app
+          image: registry.example.com/app:v1
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: debug
+spec:
+  containers:
+    - name: debug
+      image: busybox:1.36
+`,
+	"deploy/database.yml": `apiVersion: example.com/v1
+kind: Database
+metadata:
+  name: db
+spec:
+  image: postgres:16
+  backup:
+    image: registry.example.com/app:v1
+`,
+	"deploy/README.md": "image: ignored:v1\n",
+	"deploy/overlay/kustomization.yaml": `resources:
+  - cronjob.yaml
+images:
+  - name: alpine
+    newTag: "3.19"
+`,
+	"deploy/overlay/cronjob.yaml": `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  schedule: "@daily"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: backup
+              image: alpine
+`,
+}
+
+func TestImages(t *testing.T) {
+	root := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		imagePaths []string
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name: "should find the images of workloads in a directory and its kustomizations",
+			path: "deploy",
+			want: []string{
+				"registry.example.com/app-migrate:v1",
+				"registry.example.com/app:v1",
+				"busybox:1.36",
+				"alpine:3.19",
+			},
+		},
+		{
+			name:       "should find the images at the jsonpaths of custom resources",
+			path:       "deploy",
+			imagePaths: []string{"{.spec.image}", "{.spec.backup.image}"},
+			want: []string{
+				"registry.example.com/app-migrate:v1",
+				"registry.example.com/app:v1",
+				"busybox:1.36",
+				"postgres:16",
+				"alpine:3.19",
+			},
+		},
+		{
+			name: "should build a kustomization given directly",
+			path: "deploy/overlay",
+			want: []string{"alpine:3.19"},
+		},
+		{
+			name: "should read a single file",
+			path: "deploy/app.yaml",
+			want: []string{
+				"registry.example.com/app-migrate:v1",
+				"registry.example.com/app:v1",
+				"busybox:1.36",
+			},
+		},
+		{
+			name:    "should fail for missing paths",
+			path:    "missing",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := manifests.Images(filepath.Join(root, tt.path), tt.imagePaths...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Images() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Images() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
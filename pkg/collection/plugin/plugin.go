@@ -0,0 +1,248 @@
+// Package plugin runs external collection plugins, letting third parties ship their own collections as binaries
+//
+//	A plugin named <name> is an executable hauler-collection-<name> found in the PATH.  It's run with a Request
+//	encoded as json on its stdin, and must print a Response encoded as json on its stdout and exit zero.  Anything
+//	it writes to stderr is reported when it fails.  The contract is versioned by APIVersion, plugins must echo the
+//	version of the request in their response.
+//
+//	A plugin lists the images to pull, the files to fetch, and the OCI layouts to ingest, which it may write to
+//	the work directory of the request.  Relative paths in the response are relative to the work directory.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/artifacts"
+	"github.com/rancherfederal/hauler/pkg/artifacts/file"
+	"github.com/rancherfederal/hauler/pkg/artifacts/file/getter"
+	"github.com/rancherfederal/hauler/pkg/artifacts/image"
+	"github.com/rancherfederal/hauler/pkg/reference"
+	"github.com/rancherfederal/hauler/pkg/staging"
+)
+
+// APIVersion is the version of the plugin contract
+const APIVersion = "plugin.hauler.cattle.io/v1"
+
+// BinaryPrefix prefixes the name of a plugin to form the name of its executable
+const BinaryPrefix = "hauler-collection-"
+
+var (
+	ErrPluginNotFound     = errors.New("collection plugin not found")
+	ErrUnsupportedVersion = errors.New("unsupported collection plugin api version")
+)
+
+// Request is what a plugin is run with
+type Request struct {
+	APIVersion string `json:"apiVersion"`
+
+	// Config is the plugin's configuration as given in the content file, passed through as is
+	Config json.RawMessage `json:"config,omitempty"`
+
+	// WorkDir is a directory the plugin may write files and OCI layouts to, removed once they've been ingested
+	WorkDir string `json:"workDir"`
+}
+
+// Response is what a plugin returns, the contents of its collection
+type Response struct {
+	APIVersion string `json:"apiVersion"`
+
+	Images  []Image  `json:"images,omitempty"`
+	Files   []File   `json:"files,omitempty"`
+	Layouts []Layout `json:"layouts,omitempty"`
+}
+
+// Image is an image to pull from its registry
+type Image struct {
+	Ref string `json:"ref"`
+}
+
+// File is a file to fetch from a path or url, stored as hauler/<name>:<tag>
+type File struct {
+	Path string `json:"path"`
+
+	// Name defaults to the name of the file at path
+	Name string `json:"name,omitempty"`
+}
+
+// Layout is an OCI image layout on disk, each image of which is ingested under the reference annotated on it
+type Layout struct {
+	Path string `json:"path"`
+}
+
+var _ artifacts.OCICollection = (*Plugin)(nil)
+
+// Plugin is the collection returned by a plugin
+type Plugin struct {
+	name   string
+	binary string
+	config json.RawMessage
+
+	workDir  string
+	cleanup  func()
+	computed bool
+	contents map[string]artifacts.OCI
+
+	remoteOpts []remote.Option
+}
+
+// New returns the collection of the plugin name configured with config, remoteOpts are used when pulling its images
+//
+//	Close must be called once its contents have been stored to remove what the plugin wrote.
+func New(name string, config json.RawMessage, remoteOpts ...remote.Option) (*Plugin, error) {
+	binary, err := exec.LookPath(BinaryPrefix + name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: [%s]: %v", ErrPluginNotFound, name, err)
+	}
+
+	return &Plugin{
+		name:       name,
+		binary:     binary,
+		config:     config,
+		contents:   make(map[string]artifacts.OCI),
+		remoteOpts: remoteOpts,
+	}, nil
+}
+
+func (p *Plugin) Contents() (map[string]artifacts.OCI, error) {
+	if err := p.compute(); err != nil {
+		return nil, err
+	}
+	return p.contents, nil
+}
+
+// Close removes the work directory of the plugin
+func (p *Plugin) Close() error {
+	if p.cleanup != nil {
+		p.cleanup()
+		return nil
+	}
+	if p.workDir == "" {
+		return nil
+	}
+	return os.RemoveAll(p.workDir)
+}
+
+func (p *Plugin) compute() error {
+	if p.computed {
+		return nil
+	}
+
+	resp, err := p.run(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	for _, i := range resp.Images {
+		img, err := image.NewImage(i.Ref, p.remoteOpts...)
+		if err != nil {
+			return err
+		}
+		p.contents[i.Ref] = img
+	}
+
+	for _, f := range resp.Files {
+		path := p.resolve(f.Path)
+		c := getter.NewClient(getter.ClientOptions{NameOverride: f.Name})
+		ref, err := reference.NewTagged(c.Name(path), reference.DefaultTag)
+		if err != nil {
+			return err
+		}
+		p.contents[ref.Name()] = file.NewFile(path, file.WithClient(c))
+	}
+
+	for _, l := range resp.Layouts {
+		if err := p.layout(p.resolve(l.Path)); err != nil {
+			return fmt.Errorf("plugin [%s] layout [%s]: %w", p.name, l.Path, err)
+		}
+	}
+
+	p.computed = true
+	return nil
+}
+
+// run runs the plugin, returning its response
+func (p *Plugin) run(ctx context.Context) (Response, error) {
+	if p.workDir == "" {
+		dir, cleanup, err := staging.Dir(ctx, "", "plugin-"+p.name)
+		if err != nil {
+			return Response{}, err
+		}
+		p.workDir, p.cleanup = dir, cleanup
+	}
+
+	req, err := json.Marshal(Request{APIVersion: APIVersion, Config: p.config, WorkDir: p.workDir})
+	if err != nil {
+		return Response{}, err
+	}
+
+	cmd := exec.CommandContext(ctx, p.binary)
+	cmd.Dir = p.workDir
+	cmd.Stdin = bytes.NewReader(req)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return Response{}, fmt.Errorf("running plugin [%s]: %v, output: %s", p.name, err, stderr.Bytes())
+	}
+
+	var resp Response
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return Response{}, fmt.Errorf("decoding the response of plugin [%s]: %w", p.name, err)
+	}
+	if resp.APIVersion != APIVersion {
+		return Response{}, fmt.Errorf("%w: plugin [%s] responded with [%s], want [%s]", ErrUnsupportedVersion, p.name, resp.APIVersion, APIVersion)
+	}
+	return resp, nil
+}
+
+// layout adds each image of the OCI layout at path under the reference annotated on it
+func (p *Plugin) layout(path string) error {
+	lp, err := layout.FromPath(path)
+	if err != nil {
+		return err
+	}
+	idx, err := lp.ImageIndex()
+	if err != nil {
+		return err
+	}
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	for _, desc := range m.Manifests {
+		ref := desc.Annotations[ocispec.AnnotationRefName]
+		if ref == "" {
+			return fmt.Errorf("manifest [%s] has no %s annotation", desc.Digest, ocispec.AnnotationRefName)
+		}
+		if !desc.MediaType.IsImage() {
+			return fmt.Errorf("[%s] is a [%s], only images are supported", ref, desc.MediaType)
+		}
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			return err
+		}
+		p.contents[ref] = &image.Image{Name: ref, Image: img}
+	}
+	return nil
+}
+
+// resolve returns path relative to the work directory, unless it's absolute or a url
+func (p *Plugin) resolve(path string) string {
+	if filepath.IsAbs(path) || strings.Contains(path, "://") {
+		return path
+	}
+	return filepath.Join(p.workDir, path)
+}
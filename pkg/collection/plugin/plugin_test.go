@@ -0,0 +1,138 @@
+package plugin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/collection/plugin"
+)
+
+// fakePlugin writes a plugin named name to a directory added to the PATH, which checks the request it was run with
+// and writes a file to its work directory before printing response
+func fakePlugin(t *testing.T, name string, response string) {
+	t.Helper()
+	dir := t.TempDir()
+	script := `#!/bin/sh
+request=$(cat)
+case "$request" in
+	*'"apiVersion":"` + plugin.APIVersion + `"'*'"config":{"product":"example"}'*) ;;
+	*) echo "unexpected request: $request" >&2; exit 3 ;;
+esac
+echo hello > notes.txt
+cat <<'RESPONSE'
+` + response + `
+RESPONSE
+`
+	if err := os.WriteFile(filepath.Join(dir, plugin.BinaryPrefix+name), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// testLayout writes an OCI layout of a random image annotated with each of refs
+func testLayout(t *testing.T, refs ...string) string {
+	t.Helper()
+	path := t.TempDir()
+	lp, err := layout.Write(path, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range refs {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := lp.AppendImage(img, layout.WithAnnotations(map[string]string{ocispec.AnnotationRefName: ref})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestPlugin_Contents(t *testing.T) {
+	annotated := testLayout(t, "registry.example.com/app:v1", "registry.example.com/app-migrate:v1")
+	unannotated := testLayout(t, "")
+
+	tests := []struct {
+		name      string
+		response  string
+		want      []string
+		wantErr   bool
+		wantErrIs error
+	}{
+		{
+			name:     "should ingest the files and layouts the plugin returns",
+			response: `{"apiVersion": "` + plugin.APIVersion + `", "files": [{"path": "notes.txt"}, {"path": "notes.txt", "name": "release-notes.txt"}], "layouts": [{"path": "` + annotated + `"}]}`,
+			want: []string{
+				"hauler/notes.txt:latest",
+				"hauler/release-notes.txt:latest",
+				"registry.example.com/app-migrate:v1",
+				"registry.example.com/app:v1",
+			},
+		},
+		{
+			name:      "should refuse responses of another version",
+			response:  `{"apiVersion": "plugin.hauler.cattle.io/v0"}`,
+			wantErr:   true,
+			wantErrIs: plugin.ErrUnsupportedVersion,
+		},
+		{
+			name:     "should refuse layout images without a reference",
+			response: `{"apiVersion": "` + plugin.APIVersion + `", "layouts": [{"path": "` + unannotated + `"}]}`,
+			wantErr:  true,
+		},
+		{
+			name:     "should refuse malformed responses",
+			response: `images:`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePlugin(t, "example", tt.response)
+
+			p, err := plugin.New("example", json.RawMessage(`{"product":"example"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+
+			contents, err := p.Contents()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Contents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Fatalf("Contents() error = %v, want %v", err, tt.wantErrIs)
+			}
+			if err != nil {
+				return
+			}
+
+			var got []string
+			for ref := range contents {
+				got = append(got, ref)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Contents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := plugin.New("missing", nil); !errors.Is(err, plugin.ErrPluginNotFound) {
+		t.Errorf("New() error = %v, want %v", err, plugin.ErrPluginNotFound)
+	}
+}
@@ -0,0 +1,283 @@
+package rke2
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/rancherfederal/hauler/pkg/artifacts"
+	"github.com/rancherfederal/hauler/pkg/artifacts/file"
+	"github.com/rancherfederal/hauler/pkg/artifacts/file/getter"
+	"github.com/rancherfederal/hauler/pkg/artifacts/image"
+	"github.com/rancherfederal/hauler/pkg/reference"
+)
+
+var _ artifacts.OCICollection = (*rke2)(nil)
+
+const (
+	releaseUrl   = "https://github.com/rancher/rke2/releases/download"
+	channelUrl   = "https://update.rke2.io/v1-release/channels"
+	bootstrapUrl = "https://get.rke2.io"
+)
+
+// InstallScriptName is the name the install script is stored and extracted as, for running with
+// INSTALL_RKE2_ARTIFACT_PATH set to the directory the tarball, images, and checksums were extracted to
+const InstallScriptName = "rke2-install.sh"
+
+var (
+	ErrImagesNotFound     = errors.New("rke2 dependent images not found")
+	ErrFetchingImages     = errors.New("failed to fetch rke2 dependent images")
+	ErrTarballNotFound    = errors.New("rke2 tarball not found")
+	ErrImagesArchNotFound = errors.New("rke2 images archive not found")
+	ErrChecksumsNotFound  = errors.New("rke2 checksums not found")
+	ErrUnsupportedArch    = errors.New("unsupported rke2 architecture")
+)
+
+type rke2 struct {
+	version string
+	arch    string
+
+	computed bool
+	contents map[string]artifacts.OCI
+	channels map[string]string
+	client   *http.Client
+
+	// where releases, channels, and the install script are fetched from
+	releasesUrl  string
+	channelsUrl  string
+	installerUrl string
+
+	remoteOpts []remote.Option
+}
+
+// NewRKE2 returns the rke2 collection for version on arch, remoteOpts are used when fetching its dependent images
+//
+//	version may also be a release channel such as 'stable', resolved to the latest version in it.  The tarball, images
+//	archive, and checksums of the release are stored under the well known references returned by Reference, along
+//	with each image rke2 depends on and the install script.
+func NewRKE2(version string, arch string, remoteOpts ...remote.Option) (artifacts.OCICollection, error) {
+	a, err := normalizeArch(arch)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rke2{
+		version:      version,
+		arch:         a,
+		contents:     make(map[string]artifacts.OCI),
+		client:       http.DefaultClient,
+		releasesUrl:  releaseUrl,
+		channelsUrl:  channelUrl,
+		installerUrl: bootstrapUrl,
+		remoteOpts:   remoteOpts,
+	}, nil
+}
+
+// Reference returns the well known reference the release artifact name of version is stored under
+func Reference(name string, version string) string {
+	return fmt.Sprintf("%s/%s:%s", reference.DefaultNamespace, name, strings.ReplaceAll(version, "+", "-"))
+}
+
+// TarballName returns the name of the tarball of the rke2 executables released for arch
+func TarballName(arch string) string {
+	return fmt.Sprintf("rke2.linux-%s.tar.gz", arch)
+}
+
+// ImagesName returns the name of the archive of every image rke2 depends on released for arch
+func ImagesName(arch string) string {
+	return fmt.Sprintf("rke2-images.linux-%s.tar.zst", arch)
+}
+
+// ChecksumsName returns the name the sha256 checksums of the artifacts released for arch are stored under, prefixed
+// to tell it apart from the checksums of other distributions
+func ChecksumsName(arch string) string {
+	return "rke2-" + checksumsAsset(arch)
+}
+
+func checksumsAsset(arch string) string {
+	return fmt.Sprintf("sha256sum-%s.txt", arch)
+}
+
+func imagesListAsset(arch string) string {
+	return fmt.Sprintf("rke2-images-all.linux-%s.txt", arch)
+}
+
+// normalizeArch returns the architecture rke2 names its release artifacts after, defaulting to amd64
+func normalizeArch(arch string) (string, error) {
+	switch arch {
+	case "", "amd64":
+		return "amd64", nil
+	case "arm64", "s390x":
+		return arch, nil
+	default:
+		return "", fmt.Errorf("%w: [%s]", ErrUnsupportedArch, arch)
+	}
+}
+
+func (r *rke2) Contents() (map[string]artifacts.OCI, error) {
+	if err := r.compute(); err != nil {
+		return nil, err
+	}
+	return r.contents, nil
+}
+
+func (r *rke2) compute() error {
+	if r.computed {
+		return nil
+	}
+
+	if err := r.fetchChannels(); err == nil {
+		if version, ok := r.channels[r.version]; ok {
+			r.version = version
+		}
+	}
+
+	if err := r.images(); err != nil {
+		return err
+	}
+
+	if err := r.tarball(); err != nil {
+		return err
+	}
+
+	if err := r.imagesArchive(); err != nil {
+		return err
+	}
+
+	if err := r.checksums(); err != nil {
+		return err
+	}
+
+	if err := r.bootstrap(); err != nil {
+		return err
+	}
+
+	r.computed = true
+	return nil
+}
+
+func (r *rke2) tarball() error {
+	n := TarballName(r.arch)
+	if !r.released(n) {
+		return ErrTarballNotFound
+	}
+
+	r.contents[Reference(n, r.version)] = r.file(r.releaseUrl(n), n)
+	return nil
+}
+
+// imagesArchive adds the images archive, falling back to the gzipped archive of releases predating zstd
+func (r *rke2) imagesArchive() error {
+	n := ImagesName(r.arch)
+	for _, asset := range []string{n, strings.TrimSuffix(n, ".zst") + ".gz"} {
+		if r.released(asset) {
+			r.contents[Reference(asset, r.version)] = r.file(r.releaseUrl(asset), asset)
+			return nil
+		}
+	}
+	return ErrImagesArchNotFound
+}
+
+// checksums adds the checksums, extracted under their released name as the install script expects
+func (r *rke2) checksums() error {
+	asset := checksumsAsset(r.arch)
+	if !r.released(asset) {
+		return ErrChecksumsNotFound
+	}
+
+	r.contents[Reference(ChecksumsName(r.arch), r.version)] = r.file(r.releaseUrl(asset), asset)
+	return nil
+}
+
+func (r *rke2) bootstrap() error {
+	ref := fmt.Sprintf("%s/%s:%s", reference.DefaultNamespace, InstallScriptName, reference.DefaultTag)
+	r.contents[ref] = r.file(r.installerUrl, InstallScriptName)
+	return nil
+}
+
+func (r *rke2) images() error {
+	resp, err := r.client.Get(r.releaseUrl(imagesListAsset(r.arch)))
+	if err != nil {
+		return ErrImagesNotFound
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ErrFetchingImages
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		reference := strings.TrimSpace(scanner.Text())
+		if reference == "" {
+			continue
+		}
+		o, err := image.NewImage(reference, r.remoteOpts...)
+		if err != nil {
+			return err
+		}
+
+		r.contents[reference] = o
+	}
+	return scanner.Err()
+}
+
+// file returns the file at u, stored and extracted as name
+func (r *rke2) file(u string, name string) *file.File {
+	c := getter.NewClient(getter.ClientOptions{NameOverride: name})
+	return file.NewFile(u, file.WithClient(c))
+}
+
+// released reports whether the release has the artifact name
+func (r *rke2) released(name string) bool {
+	resp, err := r.client.Head(r.releaseUrl(name))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func (r *rke2) releaseUrl(artifact string) string {
+	u, _ := url.Parse(r.releasesUrl)
+	complete := []string{u.Path}
+	u.Path = path.Join(append(complete, []string{r.version, artifact}...)...)
+	return u.String()
+}
+
+func (r *rke2) fetchChannels() error {
+	resp, err := r.client.Get(r.channelsUrl)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var c channel
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		return err
+	}
+
+	channels := make(map[string]string)
+	for _, ch := range c.Data {
+		channels[ch.Name] = ch.Latest
+	}
+
+	r.channels = channels
+	return nil
+}
+
+type channel struct {
+	Data []channelData `json:"data"`
+}
+
+type channelData struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Latest string `json:"latest"`
+}
@@ -0,0 +1,162 @@
+package rke2
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func newTestServer(t *testing.T, assets ...string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/channels", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"id":"stable","name":"stable","latest":"v1.28.5+rke2r1"}]}`))
+	})
+	mux.HandleFunc("/install.sh", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#!/bin/sh\n"))
+	})
+	for _, a := range assets {
+		mux.HandleFunc("/releases/"+a, func(w http.ResponseWriter, r *http.Request) {})
+	}
+
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestRKE2_Contents(t *testing.T) {
+	release := []string{
+		"v1.28.5+rke2r1/rke2-images-all.linux-amd64.txt",
+		"v1.28.5+rke2r1/rke2-images-all.linux-arm64.txt",
+		"v1.28.5+rke2r1/rke2.linux-amd64.tar.gz",
+		"v1.28.5+rke2r1/rke2.linux-arm64.tar.gz",
+		"v1.28.5+rke2r1/rke2-images.linux-amd64.tar.zst",
+		"v1.28.5+rke2r1/rke2-images.linux-arm64.tar.zst",
+		"v1.28.5+rke2r1/sha256sum-amd64.txt",
+		"v1.28.5+rke2r1/sha256sum-arm64.txt",
+		"v1.20.15+rke2r2/rke2-images-all.linux-amd64.txt",
+		"v1.20.15+rke2r2/rke2.linux-amd64.tar.gz",
+		"v1.20.15+rke2r2/rke2-images.linux-amd64.tar.gz",
+		"v1.20.15+rke2r2/sha256sum-amd64.txt",
+	}
+
+	tests := []struct {
+		name    string
+		version string
+		arch    string
+		assets  []string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:    "should store the release under well known references",
+			version: "v1.28.5+rke2r1",
+			assets:  release,
+			want: []string{
+				"hauler/rke2-images.linux-amd64.tar.zst:v1.28.5-rke2r1",
+				"hauler/rke2-install.sh:latest",
+				"hauler/rke2-sha256sum-amd64.txt:v1.28.5-rke2r1",
+				"hauler/rke2.linux-amd64.tar.gz:v1.28.5-rke2r1",
+			},
+		},
+		{
+			name:    "should store the release of arch",
+			version: "v1.28.5+rke2r1",
+			arch:    "arm64",
+			assets:  release,
+			want: []string{
+				"hauler/rke2-images.linux-arm64.tar.zst:v1.28.5-rke2r1",
+				"hauler/rke2-install.sh:latest",
+				"hauler/rke2-sha256sum-arm64.txt:v1.28.5-rke2r1",
+				"hauler/rke2.linux-arm64.tar.gz:v1.28.5-rke2r1",
+			},
+		},
+		{
+			name:    "should resolve a channel to its latest version",
+			version: "stable",
+			assets:  release,
+			want: []string{
+				"hauler/rke2-images.linux-amd64.tar.zst:v1.28.5-rke2r1",
+				"hauler/rke2-install.sh:latest",
+				"hauler/rke2-sha256sum-amd64.txt:v1.28.5-rke2r1",
+				"hauler/rke2.linux-amd64.tar.gz:v1.28.5-rke2r1",
+			},
+		},
+		{
+			name:    "should fall back to gzipped images archives",
+			version: "v1.20.15+rke2r2",
+			assets:  release,
+			want: []string{
+				"hauler/rke2-images.linux-amd64.tar.gz:v1.20.15-rke2r2",
+				"hauler/rke2-install.sh:latest",
+				"hauler/rke2-sha256sum-amd64.txt:v1.20.15-rke2r2",
+				"hauler/rke2.linux-amd64.tar.gz:v1.20.15-rke2r2",
+			},
+		},
+		{
+			name:    "should fail without the tarball",
+			version: "v1.28.5+rke2r1",
+			assets:  release[:2],
+			wantErr: ErrTarballNotFound,
+		},
+		{
+			name:    "should fail without the images archive",
+			version: "v1.28.5+rke2r1",
+			assets:  release[:4],
+			wantErr: ErrImagesArchNotFound,
+		},
+		{
+			name:    "should fail without the checksums",
+			version: "v1.28.5+rke2r1",
+			assets:  release[:6],
+			wantErr: ErrChecksumsNotFound,
+		},
+		{
+			name:    "should fail for a version that wasn't released",
+			version: "v0.0.0+rke2r1",
+			assets:  release,
+			wantErr: ErrFetchingImages,
+		},
+		{
+			name:    "should refuse unsupported architectures",
+			version: "v1.28.5+rke2r1",
+			arch:    "arm",
+			assets:  release,
+			wantErr: ErrUnsupportedArch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.assets...)
+
+			c, err := NewRKE2(tt.version, tt.arch)
+			if err != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("NewRKE2() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			r := c.(*rke2)
+			r.releasesUrl = s.URL + "/releases"
+			r.channelsUrl = s.URL + "/channels"
+			r.installerUrl = s.URL + "/install.sh"
+
+			contents, err := c.Contents()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Contents() error = %v, want %v", err, tt.wantErr)
+			}
+			var got []string
+			for ref := range contents {
+				got = append(got, ref)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Contents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
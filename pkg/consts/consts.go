@@ -30,6 +30,9 @@ const (
 	FileDirectoryConfigMediaType = "application/vnd.content.hauler.file.directory.config.v1+json"
 	FileHttpConfigMediaType      = "application/vnd.content.hauler.file.http.config.v1+json"
 
+	// GitConfigMediaType is the media type of the config of a git repository, recording the commit stored
+	GitConfigMediaType = "application/vnd.content.hauler.git.config.v1+json"
+
 	// MemoryConfigMediaType is the reserved media type for Memory config for a generic set of bytes stored in memory
 	MemoryConfigMediaType = "application/vnd.content.hauler.memory.config.v1+json"
 
@@ -47,11 +50,26 @@ const (
 	HaulerVendorPrefix = "vnd.hauler"
 	OCIImageIndexFile  = "index.json"
 
-	KindAnnotationName = "kind"
-	KindAnnotation     = "dev.cosignproject.cosign/image"
+	KindAnnotationName  = "kind"
+	KindAnnotation      = "dev.cosignproject.cosign/image"
+	KindAnnotationIndex = "dev.cosignproject.cosign/imageIndex"
+	KindAnnotationSigs  = "dev.cosignproject.cosign/sigs"
+	KindAnnotationAtts  = "dev.cosignproject.cosign/atts"
+	KindAnnotationSboms = "dev.cosignproject.cosign/sboms"
+
+	// KindAnnotationReferrers is the kind of OCI 1.1 referrers stored alongside an image, pushed by digest rather than tag
+	KindAnnotationReferrers = "dev.hauler/referrers"
 
 	CarbideRegistry = "rgcrprod.azurecr.us"
 	ImageAnnotationKey = "hauler.dev/key"
 	ImageAnnotationPlatform = "hauler.dev/platform"
 	ImageAnnotationRegistry = "hauler.dev/registry"
+
+	// annotations recording the signature verification of an image on its descriptor in the store
+	SignatureAnnotationVerifier       = "hauler.dev/signature-verifier"
+	SignatureAnnotationVerifiedDigest = "hauler.dev/signature-verified-digest"
+	SignatureAnnotationVerifiedAt     = "hauler.dev/signature-verified-at"
+
+	// FileAnnotationVerifiedDigest records on the manifest of a file the checksum its content was verified against
+	FileAnnotationVerifiedDigest = "hauler.dev/file-verified-digest"
 )
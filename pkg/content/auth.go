@@ -0,0 +1,80 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/containerd/containerd/remotes/docker"
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+)
+
+// refreshingAuthorizer is a docker.Authorizer that drops its cached tokens once the registry starts rejecting them
+//
+//	containerd's authorizer caches a token per scope for its whole life and keeps presenting it after it expires, so
+//	long transfers to registries with short token lifetimes fail partway through with a 401.  Whenever a request that
+//	carried credentials is challenged, a fresh authorizer is swapped in to answer the challenge with new tokens.  Each
+//	rejected credential only triggers a single refresh, so concurrent requests failing together don't keep resetting.
+type refreshingAuthorizer struct {
+	newAuthorizer func() docker.Authorizer
+
+	mu       sync.RWMutex
+	current  docker.Authorizer
+	rejected map[string]bool
+}
+
+func newRefreshingAuthorizer(newAuthorizer func() docker.Authorizer) *refreshingAuthorizer {
+	return &refreshingAuthorizer{
+		newAuthorizer: newAuthorizer,
+		current:       newAuthorizer(),
+		rejected:      make(map[string]bool),
+	}
+}
+
+func (a *refreshingAuthorizer) Authorize(ctx context.Context, req *http.Request) error {
+	a.mu.RLock()
+	current := a.current
+	a.mu.RUnlock()
+	return current.Authorize(ctx, req)
+}
+
+func (a *refreshingAuthorizer) AddResponses(ctx context.Context, responses []*http.Response) error {
+	last := responses[len(responses)-1]
+
+	a.mu.Lock()
+	presented := rejectedCredential(last)
+	if presented != "" && !a.rejected[presented] {
+		a.rejected[presented] = true
+		a.current = a.newAuthorizer()
+	}
+	current := a.current
+	a.mu.Unlock()
+
+	if presented != "" {
+		// the current authorizer may never have seen the earlier responses, only the latest challenge is relevant to it
+		return current.AddResponses(ctx, []*http.Response{last})
+	}
+	return current.AddResponses(ctx, responses)
+}
+
+// rejectedCredential returns the Authorization header of the request resp challenged, if it carried one
+func rejectedCredential(resp *http.Response) string {
+	if resp.StatusCode != http.StatusUnauthorized || resp.Request == nil {
+		return ""
+	}
+	return resp.Request.Header.Get("Authorization")
+}
+
+// IsUnauthorized reports whether err is a registry rejecting a request's credentials, such as an expired token
+func IsUnauthorized(err error) bool {
+	if errors.Is(err, docker.ErrInvalidAuthorization) || errors.Is(err, ErrUnauthorized) {
+		return true
+	}
+
+	var status remoteserrors.ErrUnexpectedStatus
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusUnauthorized
+	}
+	return false
+}
@@ -5,11 +5,17 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/containerd/containerd/remotes"
+	"github.com/google/go-containerregistry/pkg/authn"
+	gname "github.com/google/go-containerregistry/pkg/name"
 	gv1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	gtypes "github.com/google/go-containerregistry/pkg/v1/types"
@@ -19,7 +25,12 @@ import (
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
 
+	"github.com/rancherfederal/hauler/pkg/content"
 	"github.com/rancherfederal/hauler/pkg/layer"
 
 	"github.com/rancherfederal/hauler/pkg/consts"
@@ -34,31 +45,139 @@ type Chart struct {
 	annotations map[string]string
 }
 
-// NewChart is a helper method that returns NewLocalChart or NewRemoteChart depending on v1alpha1.Chart contents
+// NewChart returns the chart name, a local chart archive or directory, or a chart fetched from a repository
+//
+//	Remote charts are fetched from the classic helm repository at opts.RepoURL, or from an OCI registry when name or
+//	opts.RepoURL is an oci:// reference.  opts.Version may be an exact version or a semver constraint such as ">=1.2.0 <2.0.0", the
+//	latest version satisfying it is fetched.  The provenance file of the chart is fetched along with it when the
+//	repository has one, and is stored beside the chart.
 func NewChart(name string, opts *action.ChartPathOptions) (*Chart, error) {
-	cpo := action.ChartPathOptions{
-		RepoURL: opts.RepoURL,
-		Version: opts.Version,
-
-		CaFile:                opts.CaFile,
-		CertFile:              opts.CertFile,
-		KeyFile:               opts.KeyFile,
-		InsecureSkipTLSverify: opts.InsecureSkipTLSverify,
-		Keyring:               opts.Keyring,
-		Password:              opts.Password,
-		PassCredentialsAll:    opts.PassCredentialsAll,
-		Username:              opts.Username,
-		Verify:                opts.Verify,
-	}
-
-	chartPath, err := cpo.LocateChart(name, cli.New())
+	name = strings.TrimSpace(name)
+	if _, err := os.Stat(name); err == nil || filepath.IsAbs(name) || strings.HasPrefix(name, ".") {
+		cpo := action.ChartPathOptions{
+			Keyring: opts.Keyring,
+			Verify:  opts.Verify,
+		}
+		chartPath, err := cpo.LocateChart(name, cli.New())
+		if err != nil {
+			return nil, err
+		}
+		return &Chart{path: chartPath}, nil
+	}
+
+	chartPath, err := download(name, opts, cli.New())
 	if err != nil {
 		return nil, err
 	}
-
 	return &Chart{
 		path: chartPath,
-	}, err
+	}, nil
+}
+
+// download fetches the chart name to the helm repository cache, along with its provenance file when there is one
+func download(name string, opts *action.ChartPathOptions, settings *cli.EnvSettings) (string, error) {
+	// an OCI registry given as the repository is the parent of the chart's repository
+	if registry.IsOCI(opts.RepoURL) && !registry.IsOCI(name) {
+		name = strings.TrimSuffix(opts.RepoURL, "/") + "/" + name
+	}
+
+	var registryOpts []registry.ClientOption
+	registryOpts = append(registryOpts, registry.ClientOptCredentialsFile(settings.RegistryConfig))
+	if opts.PlainHTTP {
+		registryOpts = append(registryOpts, registry.ClientOptPlainHTTP())
+	}
+	if registry.IsOCI(name) && opts.Username == "" {
+		resolver, err := keychainResolver(name, opts.PlainHTTP)
+		if err != nil {
+			return "", err
+		}
+		if resolver != nil {
+			registryOpts = append(registryOpts, registry.ClientOptResolver(resolver))
+		}
+	}
+	rc, err := registry.NewClient(registryOpts...)
+	if err != nil {
+		return "", err
+	}
+
+	dl := downloader.ChartDownloader{
+		Out:     io.Discard,
+		Keyring: opts.Keyring,
+		Verify:  downloader.VerifyLater,
+		Getters: getter.All(settings),
+		Options: []getter.Option{
+			getter.WithPassCredentialsAll(opts.PassCredentialsAll),
+			getter.WithTLSClientConfig(opts.CertFile, opts.KeyFile, opts.CaFile),
+			getter.WithInsecureSkipVerifyTLS(opts.InsecureSkipTLSverify),
+			getter.WithPlainHTTP(opts.PlainHTTP),
+		},
+		RegistryClient:   rc,
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+	}
+	if opts.Verify {
+		dl.Verify = downloader.VerifyAlways
+	}
+	if registry.IsOCI(name) {
+		dl.Options = append(dl.Options, getter.WithRegistryClient(rc))
+	}
+
+	version := strings.TrimSpace(opts.Version)
+	ref := name
+	if opts.RepoURL != "" && !registry.IsOCI(name) {
+		chartURL, err := repo.FindChartInAuthAndTLSAndPassRepoURL(opts.RepoURL, opts.Username, opts.Password, name, version,
+			opts.CertFile, opts.KeyFile, opts.CaFile, opts.InsecureSkipTLSverify, opts.PassCredentialsAll, getter.All(settings))
+		if err != nil {
+			return "", err
+		}
+		ref = chartURL
+
+		// only pass the credentials on to the host of the repository, unless told otherwise
+		u1, err := url.Parse(opts.RepoURL)
+		if err != nil {
+			return "", err
+		}
+		u2, err := url.Parse(chartURL)
+		if err != nil {
+			return "", err
+		}
+		if opts.PassCredentialsAll || (u1.Scheme == u2.Scheme && u1.Host == u2.Host) {
+			dl.Options = append(dl.Options, getter.WithBasicAuth(opts.Username, opts.Password))
+		}
+	} else {
+		dl.Options = append(dl.Options, getter.WithBasicAuth(opts.Username, opts.Password))
+	}
+
+	if err := os.MkdirAll(settings.RepositoryCache, 0755); err != nil {
+		return "", err
+	}
+	chartPath, _, err := dl.DownloadTo(ref, version, settings.RepositoryCache)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(chartPath)
+}
+
+// keychainResolver returns a resolver pulling the oci chart ref with the credentials of content.Keychain, or nil when
+// it has none for the registry of ref
+//
+//	helm looks credentials up in its own registry config and the docker config, but not in REGISTRY_AUTH_FILE or from
+//	the credential helpers of cloud registries.  Listing the tags of ref to resolve a version constraint is still
+//	authenticated by helm alone.
+func keychainResolver(ref string, plainHTTP bool) (remotes.Resolver, error) {
+	host, _, _ := strings.Cut(strings.TrimPrefix(ref, fmt.Sprintf("%s://", registry.OCIScheme)), "/")
+	reg, err := gname.NewRegistry(host)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := content.Keychain.Resolve(reg)
+	if err != nil {
+		return nil, err
+	}
+	if auth == authn.Anonymous {
+		return nil, nil
+	}
+	return content.NewRegistry(content.RegistryOptions{PlainHTTP: plainHTTP})
 }
 
 func (h *Chart) MediaType() string {
@@ -126,10 +245,40 @@ func (h *Chart) Layers() ([]gv1.Layer, error) {
 		return nil, err
 	}
 
-	return []gv1.Layer{
-		chartDataLayer,
-		// TODO: Add provenance
-	}, nil
+	ls := []gv1.Layer{chartDataLayer}
+
+	provLayer, err := h.provenance()
+	if err != nil {
+		return nil, err
+	}
+	if provLayer != nil {
+		ls = append(ls, provLayer)
+	}
+	return ls, nil
+}
+
+// provenance returns the provenance file beside the chart archive as a layer, or nil when it has none
+func (h *Chart) provenance() (gv1.Layer, error) {
+	provPath := h.path + ".prov"
+	info, err := os.Stat(provPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, nil
+	}
+
+	annotations := make(map[string]string)
+	annotations[ocispec.AnnotationTitle] = filepath.Base(provPath)
+
+	return layer.FromOpener(func() (io.ReadCloser, error) {
+		return os.Open(provPath)
+	},
+		layer.WithMediaType(consts.ProvLayerMediaType),
+		layer.WithAnnotations(annotations))
 }
 
 func (h *Chart) RawChartData() ([]byte, error) {
@@ -1,7 +1,11 @@
 package chart_test
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -102,7 +106,6 @@ func TestNewChart(t *testing.T) {
 				t.Error(err)
 			}
 
-			// TODO: This changes when we support provenance files
 			if len(m.Layers) > 1 {
 				t.Errorf("Expected 1 layer for chart, got %d", len(m.Layers))
 			}
@@ -115,3 +118,89 @@ func TestNewChart(t *testing.T) {
 		})
 	}
 }
+
+// testRepo serves a helm repository listing the test chart as version 0.4.4 and a missing 0.5.0, with a provenance
+// file for 0.4.4
+func testRepo(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/index.yaml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `apiVersion: v1
+entries:
+  rancher-cluster-templates:
+    - name: rancher-cluster-templates
+      version: 0.5.0
+      urls: [%[1]s/charts/rancher-cluster-templates-0.5.0.tgz]
+    - name: rancher-cluster-templates
+      version: 0.4.4
+      urls: [%[1]s/charts/rancher-cluster-templates-0.4.4.tgz]
+`, srv.URL)
+	})
+	mux.HandleFunc("/charts/rancher-cluster-templates-0.4.4.tgz", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, chartpath)
+	})
+	mux.HandleFunc("/charts/rancher-cluster-templates-0.4.4.tgz.prov", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "-----BEGIN PGP SIGNED MESSAGE-----\n")
+	})
+	return srv
+}
+
+func TestNewChart_Repository(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HELM_REPOSITORY_CACHE", filepath.Join(home, "cache"))
+	t.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(home, "repositories.yaml"))
+	t.Setenv("HELM_REGISTRY_CONFIG", filepath.Join(home, "registry.json"))
+	srv := testRepo(t)
+
+	tests := []struct {
+		name    string
+		version string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "should fetch the version and its provenance",
+			version: "0.4.4",
+			want:    []string{consts.ChartLayerMediaType, consts.ProvLayerMediaType},
+		},
+		{
+			name:    "should fetch the latest version satisfying a constraint",
+			version: ">=0.4.0 <0.5.0",
+			want:    []string{consts.ChartLayerMediaType, consts.ProvLayerMediaType},
+		},
+		{
+			name:    "should fail when no version satisfies the constraint",
+			version: ">=1.0.0",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := chart.NewChart("rancher-cluster-templates", &action.ChartPathOptions{RepoURL: srv.URL, Version: tt.version})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewChart() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			m, err := got.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var mts []string
+			for _, l := range m.Layers {
+				mts = append(mts, string(l.MediaType))
+			}
+			if !reflect.DeepEqual(mts, tt.want) {
+				t.Errorf("NewChart() layers = %v, want %v", mts, tt.want)
+			}
+			if title := m.Layers[0].Annotations[ocispec.AnnotationTitle]; title != "rancher-cluster-templates-0.4.4.tgz" {
+				t.Errorf("NewChart() chart title = %s, want rancher-cluster-templates-0.4.4.tgz", title)
+			}
+		})
+	}
+}
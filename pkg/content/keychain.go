@@ -0,0 +1,113 @@
+package content
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-containerregistry/pkg/authn"
+	gname "github.com/google/go-containerregistry/pkg/name"
+)
+
+// AuthFileEnv names the registry auth file, in the format of the docker config, that takes precedence over the docker
+// config as it does for podman, skopeo, and buildah
+const AuthFileEnv = "REGISTRY_AUTH_FILE"
+
+// Keychain resolves the credentials of every remote operation made without an explicit username and password
+//
+//	Credentials are looked up in the file REGISTRY_AUTH_FILE names, then in the docker config of DOCKER_CONFIG or
+//	~/.docker, including the credsStore and credHelpers it configures, then podman's auth file when there's no docker
+//	config.  Registries of the public clouds fall back to their credential helper, docker-credential-ecr-login,
+//	-gcloud, or -acr-env, when it's installed, so they're authenticated without any configuration at all.
+var Keychain authn.Keychain = authn.NewMultiKeychain(authFileKeychain{}, authn.DefaultKeychain, cloudKeychain{})
+
+// authFileKeychain resolves credentials from the auth file REGISTRY_AUTH_FILE names
+type authFileKeychain struct{}
+
+func (authFileKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	path := os.Getenv(AuthFileEnv)
+	if path == "" {
+		return authn.Anonymous, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return authn.Anonymous, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cf, err := config.LoadFromReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg, empty types.AuthConfig
+	for _, key := range []string{target.String(), target.RegistryStr()} {
+		if key == gname.DefaultRegistry {
+			key = authn.DefaultAuthKey
+		}
+		if cfg, err = cf.GetAuthConfig(key); err != nil {
+			return nil, err
+		}
+		cfg.ServerAddress = ""
+		if cfg != empty {
+			break
+		}
+	}
+	if cfg == empty {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(authn.AuthConfig{
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		Auth:          cfg.Auth,
+		IdentityToken: cfg.IdentityToken,
+		RegistryToken: cfg.RegistryToken,
+	}), nil
+}
+
+// cloudHelpers are the credential helpers of the registries of the public clouds, by the hosts they serve
+var cloudHelpers = []struct {
+	hosts  *regexp.Regexp
+	helper string
+}{
+	{regexp.MustCompile(`^\d{12}\.dkr\.ecr(-fips)?\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`), "ecr-login"},
+	{regexp.MustCompile(`^([a-z]+\.)?gcr\.io$|^[a-z0-9-]+-docker\.pkg\.dev$`), "gcloud"},
+	{regexp.MustCompile(`^[a-z0-9]+\.azurecr\.(io|cn|us)$`), "acr-env"},
+}
+
+// cloudKeychain resolves the credentials of cloud registries from their credential helper, when it's installed
+type cloudKeychain struct{}
+
+func (cloudKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	host := target.RegistryStr()
+	for _, c := range cloudHelpers {
+		if !c.hosts.MatchString(host) {
+			continue
+		}
+		program := "docker-credential-" + c.helper
+		if _, err := exec.LookPath(program); err != nil {
+			return authn.Anonymous, nil
+		}
+
+		creds, err := client.Get(client.NewShellProgramFunc(program), host)
+		if credentials.IsErrCredentialsNotFound(err) {
+			return authn.Anonymous, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// helpers return identity tokens under this username, as the docker cli does
+		if creds.Username == "<token>" {
+			return authn.FromConfig(authn.AuthConfig{IdentityToken: creds.Secret}), nil
+		}
+		return authn.FromConfig(authn.AuthConfig{Username: creds.Username, Password: creds.Secret}), nil
+	}
+	return authn.Anonymous, nil
+}
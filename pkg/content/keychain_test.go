@@ -0,0 +1,110 @@
+package content_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/rancherfederal/hauler/pkg/content"
+)
+
+func TestKeychain(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake credential helper is a shell script")
+	}
+
+	writeAuths := func(path string, auths map[string]string) {
+		t.Helper()
+		cfg := map[string]map[string]map[string]string{"auths": {}}
+		for host, creds := range auths {
+			cfg["auths"][host] = map[string]string{"auth": base64.StdEncoding.EncodeToString([]byte(creds))}
+		}
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dockerConfig := t.TempDir()
+	writeAuths(filepath.Join(dockerConfig, "config.json"), map[string]string{
+		"docker.example.com": "docker:docker-secret",
+		"both.example.com":   "docker:docker-secret",
+	})
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	writeAuths(authFile, map[string]string{
+		"podman.example.com": "podman:podman-secret",
+		"both.example.com":   "podman:podman-secret",
+	})
+
+	// a credential helper for ecr answering every host with an identity token
+	bin := t.TempDir()
+	helper := "#!/bin/sh\ncat > /dev/null\necho '{\"Username\":\"<token>\",\"Secret\":\"ecr-token\"}'\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker-credential-ecr-login"), []byte(helper), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+	t.Setenv(content.AuthFileEnv, authFile)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name     string
+		registry string
+		want     authn.AuthConfig
+	}{
+		{
+			name:     "should resolve credentials of the auth file",
+			registry: "podman.example.com",
+			want:     authn.AuthConfig{Username: "podman", Password: "podman-secret"},
+		},
+		{
+			name:     "should resolve credentials of the docker config",
+			registry: "docker.example.com",
+			want:     authn.AuthConfig{Username: "docker", Password: "docker-secret"},
+		},
+		{
+			name:     "should prefer the auth file to the docker config",
+			registry: "both.example.com",
+			want:     authn.AuthConfig{Username: "podman", Password: "podman-secret"},
+		},
+		{
+			name:     "should resolve cloud registries from their credential helper",
+			registry: "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+			want:     authn.AuthConfig{IdentityToken: "ecr-token"},
+		},
+		{
+			name:     "should be anonymous without any credentials",
+			registry: "registry.example.com",
+			want:     authn.AuthConfig{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, err := name.NewRegistry(tt.registry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			auth, err := content.Keychain.Resolve(reg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := auth.Authorization()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("Resolve() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/credentials"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/google/go-containerregistry/pkg/authn"
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+var ErrNotLoggedIn = errors.New("not logged in")
+
+// Login checks the username and password against registry, then stores them for every later remote operation on it,
+// returning the file they're recorded in
+//
+//	Credentials are stored where Keychain looks them up first, the file REGISTRY_AUTH_FILE names when set, otherwise
+//	the docker config, so cosign and helm are authenticated by them as well.  A credsStore or credHelper the config
+//	sets for registry keeps the password, leaving only a reference to it in the file.
+func Login(ctx context.Context, registry string, username string, password string, opts RegistryOptions) (string, error) {
+	reg, err := parseRegistry(registry, opts)
+	if err != nil {
+		return "", err
+	}
+	if err := checkLogin(ctx, reg, username, password, opts); err != nil {
+		return "", err
+	}
+
+	cf, err := loadAuthConfig()
+	if err != nil {
+		return "", err
+	}
+	key := authKey(reg)
+	if err := cf.GetCredentialsStore(key).Store(types.AuthConfig{
+		ServerAddress: key,
+		Username:      username,
+		Password:      password,
+	}); err != nil {
+		return "", fmt.Errorf("storing the credentials of [%s]: %w", registry, err)
+	}
+	return cf.Filename, cf.Save()
+}
+
+// Logout removes the credentials Login stored for registry, returning the file they were recorded in
+func Logout(registry string) (string, error) {
+	reg, err := parseRegistry(registry, RegistryOptions{})
+	if err != nil {
+		return "", err
+	}
+	cf, err := loadAuthConfig()
+	if err != nil {
+		return "", err
+	}
+
+	key := authKey(reg)
+	store := cf.GetCredentialsStore(key)
+	auth, err := store.Get(key)
+	if err != nil {
+		return "", err
+	}
+	if auth == (types.AuthConfig{ServerAddress: key}) || auth == (types.AuthConfig{}) {
+		return "", fmt.Errorf("%w to [%s] in [%s]", ErrNotLoggedIn, registry, cf.Filename)
+	}
+	if err := store.Erase(key); err != nil {
+		return "", fmt.Errorf("removing the credentials of [%s]: %w", registry, err)
+	}
+	return cf.Filename, cf.Save()
+}
+
+// checkLogin authenticates to reg with username and password, failing when it rejects them
+func checkLogin(ctx context.Context, reg gname.Registry, username string, password string, opts RegistryOptions) error {
+	auth := authn.FromConfig(authn.AuthConfig{Username: username, Password: password})
+	rt, err := transport.NewWithContext(ctx, reg, auth, newTransport(opts), []string{reg.Scope(transport.PullScope)})
+	if err != nil {
+		return fmt.Errorf("logging in to [%s]: %w", reg.RegistryStr(), err)
+	}
+
+	// registries using basic auth only see the credentials once a request is made with them
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s://%s/v2/", reg.Scheme(), reg.RegistryStr()), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Transport: rt}).Do(req)
+	if err != nil {
+		return fmt.Errorf("logging in to [%s]: %w", reg.RegistryStr(), err)
+	}
+	defer resp.Body.Close()
+	if err := transport.CheckError(resp, http.StatusOK); err != nil {
+		return fmt.Errorf("logging in to [%s]: %w", reg.RegistryStr(), err)
+	}
+	return nil
+}
+
+func parseRegistry(registry string, opts RegistryOptions) (gname.Registry, error) {
+	// registries are commonly given as the url of their web ui or api
+	registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	registry, _, _ = strings.Cut(registry, "/")
+
+	var nameOpts []gname.Option
+	if opts.PlainHTTP || opts.Insecure {
+		nameOpts = append(nameOpts, gname.Insecure)
+	}
+	return gname.NewRegistry(registry, nameOpts...)
+}
+
+// authKey is the key of reg in the auths of a docker config, which for docker hub is the url of its v1 api
+func authKey(reg gname.Registry) string {
+	if reg.RegistryStr() == gname.DefaultRegistry {
+		return authn.DefaultAuthKey
+	}
+	return reg.RegistryStr()
+}
+
+// loadAuthConfig loads the config credentials are stored in, REGISTRY_AUTH_FILE when set or the docker config
+func loadAuthConfig() (*configfile.ConfigFile, error) {
+	path := os.Getenv(AuthFileEnv)
+	if path == "" {
+		// the docker cli caches its config dir, read DOCKER_CONFIG for every load as the keychain does
+		cf, err := config.Load(os.Getenv(config.EnvOverrideConfigDir))
+		if err != nil {
+			return nil, err
+		}
+		// as the docker cli does, keep new credentials in the platform's credential store when there is one
+		if !cf.ContainsAuth() {
+			cf.CredentialsStore = credentials.DetectDefaultStore(cf.CredentialsStore)
+		}
+		return cf, nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return configfile.New(path), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cf, err := config.LoadFromReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("loading [%s]: %w", path, err)
+	}
+	cf.Filename = path
+	return cf, nil
+}
@@ -0,0 +1,115 @@
+package content_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+
+	"github.com/rancherfederal/hauler/pkg/content"
+)
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+
+	// a registry only letting hauler in with its password
+	reg := registry.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "hauler" || pass != "haulin" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := u.Host
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	t.Setenv("PATH", t.TempDir())
+
+	tests := []struct {
+		name     string
+		authFile bool
+		password string
+		wantErr  bool
+	}{
+		{
+			name:     "should store credentials in the docker config",
+			password: "haulin",
+		},
+		{
+			name:     "should store credentials in the auth file",
+			authFile: true,
+			password: "haulin",
+		},
+		{
+			name:     "should fail on credentials the registry rejects",
+			password: "walkin",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := filepath.Join(os.Getenv("DOCKER_CONFIG"), "config.json")
+			if tt.authFile {
+				want = filepath.Join(t.TempDir(), "auth.json")
+				t.Setenv(content.AuthFileEnv, want)
+			}
+
+			path, err := content.Login(ctx, "http://"+host, "hauler", tt.password, content.RegistryOptions{PlainHTTP: true})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if path != want {
+				t.Errorf("Login() stored credentials in %s, want %s", path, want)
+			}
+			if got := resolve(t, host); got != (authn.AuthConfig{Username: "hauler", Password: "haulin"}) {
+				t.Errorf("Keychain.Resolve() after Login() = %+v", got)
+			}
+
+			if _, err := content.Logout(host); err != nil {
+				t.Fatalf("Logout() error = %v", err)
+			}
+			if got := resolve(t, host); got != (authn.AuthConfig{}) {
+				t.Errorf("Keychain.Resolve() after Logout() = %+v, want anonymous", got)
+			}
+			if _, err := content.Logout(host); !errors.Is(err, content.ErrNotLoggedIn) {
+				t.Errorf("Logout() twice error = %v, want %v", err, content.ErrNotLoggedIn)
+			}
+		})
+	}
+}
+
+func resolve(t *testing.T, host string) authn.AuthConfig {
+	t.Helper()
+	reg, err := name.NewRegistry(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := content.Keychain.Resolve(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := auth.Authorization()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *cfg
+}
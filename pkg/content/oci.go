@@ -3,6 +3,7 @@ package content
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -14,6 +15,7 @@ import (
 
 	ccontent "github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/specs-go"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"oras.land/oras-go/pkg/content"
@@ -28,6 +30,9 @@ type OCI struct {
 	root    string
 	index   *ocispec.Index
 	nameMap *sync.Map // map[string]ocispec.Descriptor
+
+	// mu serializes reading and writing the index file, which concurrent pushes to the same store may both do
+	mu sync.Mutex
 }
 
 func NewOCI(root string) (*OCI, error) {
@@ -50,8 +55,29 @@ func (o *OCI) AddIndex(desc ocispec.Descriptor) error {
 	return o.SaveIndex()
 }
 
+// RemoveIndex removes every entry of the index matching the descriptor's digest, reference, and kind, and updates it
+func (o *OCI) RemoveIndex(desc ocispec.Descriptor) error {
+	if err := o.LoadIndex(); err != nil {
+		return err
+	}
+
+	o.nameMap.Range(func(key, value interface{}) bool {
+		d := value.(ocispec.Descriptor)
+		if d.Digest == desc.Digest &&
+			d.Annotations[ocispec.AnnotationRefName] == desc.Annotations[ocispec.AnnotationRefName] &&
+			d.Annotations[consts.KindAnnotationName] == desc.Annotations[consts.KindAnnotationName] {
+			o.nameMap.Delete(key)
+		}
+		return true
+	})
+	return o.SaveIndex()
+}
+
 // LoadIndex will load the index from disk
 func (o *OCI) LoadIndex() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
 	path := o.path(consts.OCIImageIndexFile)
 	idx, err := os.Open(path)
 	if err != nil {
@@ -80,9 +106,26 @@ func (o *OCI) LoadIndex() error {
 	return nil
 }
 
+// ReloadIndex discards the index held in memory and loads it from disk again, picking up the changes other processes
+// made to it, including the entries they removed
+func (o *OCI) ReloadIndex() error {
+	o.nameMap.Range(func(key, _ interface{}) bool {
+		o.nameMap.Delete(key)
+		return true
+	})
+	return o.LoadIndex()
+}
+
 // SaveIndex will update the index on disk
+//
+//	The index is written to a temporary file that replaces it once synced, so a process killed mid-write leaves either
+//	the old index or the new one, never a truncated one.
 func (o *OCI) SaveIndex() error {
-	var descs []ocispec.Descriptor
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// never null, an empty store still needs a valid manifests array
+	descs := []ocispec.Descriptor{}
 	o.nameMap.Range(func(name, desc interface{}) bool {
 		n := desc.(ocispec.Descriptor).Annotations[ocispec.AnnotationRefName]
 		d := desc.(ocispec.Descriptor)
@@ -114,7 +157,7 @@ func (o *OCI) SaveIndex() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(o.path(consts.OCIImageIndexFile), data, 0644)
+	return writeFileAtomic(o.path(consts.OCIImageIndexFile), data, 0644)
 }
 
 // Resolve attempts to resolve the reference into a name and descriptor.
@@ -195,17 +238,15 @@ func (o *OCI) Walk(fn func(reference string, desc ocispec.Descriptor) error) err
 		return err
 	}
 
-	var errst []string
+	var errs []error
 	o.nameMap.Range(func(key, value interface{}) bool {
 		if err := fn(key.(string), value.(ocispec.Descriptor)); err != nil {
-			errst = append(errst, err.Error())
+			errs = append(errs, err)
 		}
 		return true
 	})
-	if errst != nil {
-		return fmt.Errorf(strings.Join(errst, "; "))
-	}
-	return nil
+	// join rather than flatten so callers can still match the underlying errors
+	return errors.Join(errs...)
 }
 
 func (o *OCI) blobReaderAt(desc ocispec.Descriptor) (*os.File, error) {
@@ -253,17 +294,26 @@ type ociPusher struct {
 
 // Push returns a content writer for the given resource identified
 // by the descriptor.
+//
+//	The blob is written to a temporary file beside it, only synced and moved into place once committed and verified
+//	against its digest.  The root manifest is only added to the index once its blob is in place, so the index never
+//	references a blob that never landed.
 func (p *ociPusher) Push(ctx context.Context, d ocispec.Descriptor) (ccontent.Writer, error) {
+	if err := d.Digest.Validate(); err != nil {
+		return nil, err
+	}
+
+	var mark func() error
 	switch d.MediaType {
 	case ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex, consts.DockerManifestSchema2, consts.DockerManifestListSchema2:
 		// if the hash of the content matches that which was provided as the hash for the root, mark it
 		if p.digest != "" && p.digest == d.Digest.String() {
-			if err := p.oci.LoadIndex(); err != nil {
-				return nil, err
-			}
-			p.oci.nameMap.Store(p.ref, d)
-			if err := p.oci.SaveIndex(); err != nil {
-				return nil, err
+			mark = func() error {
+				if err := p.oci.LoadIndex(); err != nil {
+					return err
+				}
+				p.oci.nameMap.Store(p.ref, d)
+				return p.oci.SaveIndex()
 			}
 		}
 	}
@@ -274,15 +324,85 @@ func (p *ociPusher) Push(ctx context.Context, d ocispec.Descriptor) (ccontent.Wr
 	}
 
 	if _, err := os.Stat(blobPath); err == nil {
+		if mark != nil {
+			if err := mark(); err != nil {
+				return nil, err
+			}
+		}
 		// file already exists, discard (but validate digest)
 		return content.NewIoContentWriter(ioutil.Discard, content.WithOutputHash(d.Digest)), nil
 	}
 
-	f, err := os.Create(blobPath)
+	f, err := os.CreateTemp(filepath.Dir(blobPath), filepath.Base(blobPath)+".*.tmp")
 	if err != nil {
 		return nil, err
 	}
 
-	w := content.NewIoContentWriter(f, content.WithInputHash(d.Digest), content.WithOutputHash(d.Digest))
-	return w, nil
+	verifier := d.Digest.Verifier()
+	return &blobWriter{
+		Writer:   content.NewIoContentWriter(io.MultiWriter(f, verifier), content.WithInputHash(d.Digest), content.WithOutputHash(d.Digest)),
+		file:     f,
+		path:     blobPath,
+		digest:   d.Digest.String(),
+		verifier: verifier,
+		onCommit: mark,
+	}, nil
+}
+
+// blobWriter writes a blob to a temporary file, moved to path once the blob is committed
+type blobWriter struct {
+	ccontent.Writer
+
+	file     *os.File
+	path     string
+	digest   string
+	verifier digest.Verifier
+
+	// onCommit is called once the blob is in place
+	onCommit func() error
+
+	committed bool
+}
+
+func (w *blobWriter) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...ccontent.Opt) error {
+	if err := w.Writer.Commit(ctx, size, expected, opts...); err != nil {
+		w.abort()
+		return err
+	}
+	if !w.verifier.Verified() {
+		w.abort()
+		return fmt.Errorf("blob [%s] does not match its digest", w.digest)
+	}
+	if err := w.file.Sync(); err != nil {
+		w.abort()
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		w.abort()
+		return err
+	}
+	if err := os.Rename(w.file.Name(), w.path); err != nil {
+		w.abort()
+		return err
+	}
+	w.committed = true
+
+	if w.onCommit != nil {
+		return w.onCommit()
+	}
+	return nil
+}
+
+func (w *blobWriter) Close() error {
+	err := w.Writer.Close()
+	if !w.committed {
+		w.abort()
+	}
+	return err
+}
+
+// abort discards the temporary file of a blob that's not going to be committed
+func (w *blobWriter) abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
 }
@@ -0,0 +1,99 @@
+package content_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/content"
+)
+
+func TestOCI_Push(t *testing.T) {
+	manifest := []byte(`{"schemaVersion":2}`)
+	desc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(manifest),
+		Size:      int64(len(manifest)),
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantErr   bool
+		wantIndex bool
+	}{
+		{
+			name:      "committed",
+			data:      manifest,
+			wantIndex: true,
+		},
+		{
+			name:    "digest mismatch",
+			data:    []byte(`{"schemaVersion":3}`),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			root := t.TempDir()
+			o, err := content.NewOCI(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := o.Pusher(ctx, "hello/world:v1@"+desc.Digest.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, err := p.Push(ctx, desc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(tt.data); err != nil {
+				t.Fatal(err)
+			}
+
+			// nothing is in place, nor indexed, until the blob is committed
+			blob := filepath.Join(root, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded())
+			if _, err := os.Stat(blob); !os.IsNotExist(err) {
+				t.Errorf("blob in place before it was committed: %v", err)
+			}
+			if _, _, err := o.Resolve(ctx, "hello/world:v1"); err != nil {
+				t.Fatal(err)
+			}
+
+			err = w.Commit(ctx, desc.Size, desc.Digest)
+			w.Close()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Commit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			_, got, err := o.Resolve(ctx, "hello/world:v1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if indexed := got.Digest == desc.Digest; indexed != tt.wantIndex {
+				t.Errorf("indexed = %v, want %v", indexed, tt.wantIndex)
+			}
+			if _, err := os.Stat(blob); (err == nil) != tt.wantIndex {
+				t.Errorf("blob in place = %v, want %v", err == nil, tt.wantIndex)
+			}
+
+			entries, err := os.ReadDir(filepath.Dir(blob))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				if strings.HasSuffix(e.Name(), ".tmp") {
+					t.Errorf("temporary file [%s] left behind", e.Name())
+				}
+			}
+		})
+	}
+}
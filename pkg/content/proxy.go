@@ -0,0 +1,57 @@
+package content
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// The environment variables configuring the proxy of every http client hauler makes, and of the cosign it runs
+const (
+	HTTPProxyEnv  = "HTTP_PROXY"
+	HTTPSProxyEnv = "HTTPS_PROXY"
+	NoProxyEnv    = "NO_PROXY"
+)
+
+// SetProxy overrides the proxy of the environment with proxy for both http and https requests, and the hosts requested
+// directly with noProxy, each when set
+//
+//	Requests to registries, file downloads, chart repositories, and cosign all read the proxy from the environment, go
+//	does so once per process, so SetProxy has to be called before any request is made.  Requests to localhost are
+//	never proxied.
+func SetProxy(proxy string, noProxy string) error {
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return fmt.Errorf("parsing proxy [%s]: %w", proxy, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("proxy [%s] is not an http, https, or socks5 url", proxy)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("proxy [%s] has no host", proxy)
+		}
+		for _, env := range []string{HTTPProxyEnv, HTTPSProxyEnv} {
+			if err := setEnv(env, proxy); err != nil {
+				return err
+			}
+		}
+	}
+	if noProxy != "" {
+		if err := setEnv(NoProxyEnv, noProxy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setEnv sets both the upper and lower case forms of env, either of which may be read first
+func setEnv(env string, value string) error {
+	if err := os.Setenv(env, value); err != nil {
+		return err
+	}
+	return os.Setenv(strings.ToLower(env), value)
+}
@@ -0,0 +1,79 @@
+package content_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rancherfederal/hauler/pkg/content"
+)
+
+func TestSetProxy(t *testing.T) {
+	tests := []struct {
+		name        string
+		proxy       string
+		noProxy     string
+		wantProxy   string
+		wantNoProxy string
+		wantErr     bool
+	}{
+		{
+			name:        "should keep the environment without overrides",
+			wantProxy:   "http://env.example.com:3128",
+			wantNoProxy: ".internal",
+		},
+		{
+			name:        "should override the proxy of both http and https",
+			proxy:       "http://proxy.example.com:3128",
+			wantProxy:   "http://proxy.example.com:3128",
+			wantNoProxy: ".internal",
+		},
+		{
+			name:        "should override the hosts bypassing the proxy",
+			noProxy:     "10.0.0.0/8,.example.com",
+			wantProxy:   "http://env.example.com:3128",
+			wantNoProxy: "10.0.0.0/8,.example.com",
+		},
+		{
+			name:    "should reject a proxy without a scheme",
+			proxy:   "proxy.example.com:3128",
+			wantErr: true,
+		},
+		{
+			name:    "should reject a proxy of another scheme",
+			proxy:   "ftp://proxy.example.com",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{content.HTTPProxyEnv, content.HTTPSProxyEnv} {
+				t.Setenv(env, "http://env.example.com:3128")
+				t.Setenv(strings.ToLower(env), "http://env.example.com:3128")
+			}
+			t.Setenv(content.NoProxyEnv, ".internal")
+			t.Setenv(strings.ToLower(content.NoProxyEnv), ".internal")
+
+			err := content.SetProxy(tt.proxy, tt.noProxy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetProxy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			for _, env := range []string{content.HTTPProxyEnv, content.HTTPSProxyEnv} {
+				for _, e := range []string{env, strings.ToLower(env)} {
+					if got := os.Getenv(e); got != tt.wantProxy {
+						t.Errorf("%s = %s, want %s", e, got, tt.wantProxy)
+					}
+				}
+			}
+			for _, e := range []string{content.NoProxyEnv, strings.ToLower(content.NoProxyEnv)} {
+				if got := os.Getenv(e); got != tt.wantNoProxy {
+					t.Errorf("%s = %s, want %s", e, got, tt.wantNoProxy)
+				}
+			}
+		})
+	}
+}
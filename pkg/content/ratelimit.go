@@ -0,0 +1,115 @@
+package content
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// minRateBurst is the least a limited connection reads or writes at once, so connections limited to a trickle still
+// transfer in chunks of a useful size, only pausing longer between them
+const minRateBurst = 32 << 10
+
+var (
+	limitersMu sync.Mutex
+
+	// limiters are shared by every connection of every transport limited to the same rate, by bytes per second
+	limiters = make(map[int64]*rate.Limiter)
+)
+
+// sharedLimiter returns the limiter of every connection limited to bps bytes per second between them
+func sharedLimiter(bps int64) *rate.Limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l, ok := limiters[bps]
+	if !ok {
+		l = newLimiter(bps)
+		limiters[bps] = l
+	}
+	return l
+}
+
+func newLimiter(bps int64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(bps), int(max(bps, minRateBurst)))
+}
+
+type dialFunc func(ctx context.Context, network string, addr string) (net.Conn, error)
+
+// limitDial returns dial with the connections it dials limited to the rates of o, dial itself when o sets none
+//
+//	Connections are limited rather than request bodies, so pulls and pushes alike are held to the rate, along with
+//	the overhead of tls.
+func (o TransportOptions) limitDial(dial dialFunc) dialFunc {
+	if o.RateLimit <= 0 && o.ConnectionRateLimit <= 0 {
+		return dial
+	}
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	var global *rate.Limiter
+	if o.RateLimit > 0 {
+		global = sharedLimiter(o.RateLimit)
+	}
+
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		c := &limitedConn{Conn: conn}
+		if global != nil {
+			c.limiters = append(c.limiters, global)
+		}
+		if o.ConnectionRateLimit > 0 {
+			c.limiters = append(c.limiters, newLimiter(o.ConnectionRateLimit))
+		}
+		for _, l := range c.limiters {
+			if c.chunk == 0 || l.Burst() < c.chunk {
+				c.chunk = l.Burst()
+			}
+		}
+		return c, nil
+	}
+}
+
+// limitedConn holds the bytes read from and written to a connection to the rate of each of its limiters
+type limitedConn struct {
+	net.Conn
+	limiters []*rate.Limiter
+
+	// chunk is the most read or written at once, the smallest burst of the limiters
+	chunk int
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	if len(p) > c.chunk {
+		p = p[:c.chunk]
+	}
+	n, err := c.Conn.Read(p)
+	c.wait(n)
+	return n, err
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), c.chunk)]
+		c.wait(len(chunk))
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// wait blocks until every limiter allows n more bytes, which never exceeds their burst
+func (c *limitedConn) wait(n int) {
+	for _, l := range c.limiters {
+		l.WaitN(context.Background(), n)
+	}
+}
@@ -0,0 +1,239 @@
+package content
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"sigs.k8s.io/yaml"
+)
+
+// wildcardMirror is the key of the mirror of every registry without one of its own
+const wildcardMirror = "*"
+
+// RegistriesConfig configures how registries are reached, in the format of the registries.yaml of k3s and rke2, so a
+// haul is made the same way whichever environment's mirrors it's made through
+//
+//	mirrors:
+//	  docker.io:
+//	    endpoint:
+//	      - https://mirror.example.com:5000
+//	    rewrite:
+//	      "^rancher/(.*)": "mirrors/rancher/$1"
+//	configs:
+//	  mirror.example.com:5000:
+//	    auth:
+//	      username: hauler
+//	      password: haulin
+//	    tls:
+//	      ca_file: /etc/ssl/private-ca.pem
+type RegistriesConfig struct {
+	Mirrors map[string]Mirror         `json:"mirrors,omitempty"`
+	Configs map[string]RegistryConfig `json:"configs,omitempty"`
+}
+
+// Mirror lists the endpoints content of a registry is pulled from before the registry itself
+type Mirror struct {
+	// Endpoints are tried in order, an http:// endpoint is reached over plain http
+	Endpoints []string `json:"endpoint,omitempty"`
+
+	// Rewrites map regular expressions matching repositories to their replacement on the endpoints, the first
+	// matching in the order of the expressions is applied
+	Rewrites map[string]string `json:"rewrite,omitempty"`
+}
+
+// RegistryConfig holds the credentials and certificates of a registry or mirror endpoint, by host
+type RegistryConfig struct {
+	Auth *RegistryAuth `json:"auth,omitempty"`
+	TLS  *RegistryTLS  `json:"tls,omitempty"`
+}
+
+type RegistryAuth struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+type RegistryTLS struct {
+	CAFile             string `json:"ca_file,omitempty"`
+	CertFile           string `json:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// LoadRegistriesConfig reads and validates the registries config at path
+func LoadRegistriesConfig(path string) (*RegistriesConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c RegistriesConfig
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing registries config [%s]: %w", path, err)
+	}
+
+	for registry, m := range c.Mirrors {
+		for _, ep := range m.Endpoints {
+			if _, _, err := parseEndpoint(ep); err != nil {
+				return nil, fmt.Errorf("registries config [%s] mirror [%s]: %w", path, registry, err)
+			}
+		}
+		for expr := range m.Rewrites {
+			if _, err := regexp.Compile(expr); err != nil {
+				return nil, fmt.Errorf("registries config [%s] mirror [%s] rewrite [%s]: %w", path, registry, expr, err)
+			}
+		}
+	}
+	return &c, nil
+}
+
+// Endpoints returns the references ref is pulled from, in order: through each mirror endpoint of its registry, with
+// the rewrites of the mirror applied, then from its registry itself
+func (c *RegistriesConfig) Endpoints(ref string) ([]string, error) {
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return []string{r.Name()}, nil
+	}
+
+	sep := ":"
+	if _, ok := r.(gname.Digest); ok {
+		sep = "@"
+	}
+	m, _ := c.mirror(r.Context().RegistryStr())
+	repo := m.rewrite(r.Context().RepositoryStr())
+
+	seen := make(map[string]bool)
+	var refs []string
+	for _, ep := range m.Endpoints {
+		host, _, err := parseEndpoint(ep)
+		if err != nil {
+			return nil, err
+		}
+		mirrored, err := gname.ParseReference(host + "/" + repo + sep + r.Identifier())
+		if err != nil {
+			return nil, fmt.Errorf("mirror [%s] of [%s]: %w", ep, ref, err)
+		}
+		if !seen[mirrored.Name()] {
+			seen[mirrored.Name()] = true
+			refs = append(refs, mirrored.Name())
+		}
+	}
+	if !seen[r.Name()] {
+		refs = append(refs, r.Name())
+	}
+	return refs, nil
+}
+
+// PlainHTTP reports whether host is a mirror endpoint reached over plain http
+func (c *RegistriesConfig) PlainHTTP(host string) bool {
+	if c == nil {
+		return false
+	}
+	for _, m := range c.Mirrors {
+		for _, ep := range m.Endpoints {
+			if h, plain, err := parseEndpoint(ep); err == nil && plain && h == host {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Keychain resolves the credentials the config holds for each registry
+func (c *RegistriesConfig) Keychain() authn.Keychain {
+	return registriesKeychain{c}
+}
+
+type registriesKeychain struct {
+	c *RegistriesConfig
+}
+
+func (k registriesKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	cfg, ok := k.c.config(target.RegistryStr())
+	if !ok || cfg.Auth == nil {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(authn.AuthConfig{
+		Username:      cfg.Auth.Username,
+		Password:      cfg.Auth.Password,
+		Auth:          cfg.Auth.Auth,
+		IdentityToken: cfg.Auth.IdentityToken,
+	}), nil
+}
+
+// mirror returns the mirror of registry, or the wildcard mirror when it has none of its own
+func (c *RegistriesConfig) mirror(registry string) (Mirror, bool) {
+	for _, key := range hostKeys(registry) {
+		if m, ok := c.Mirrors[key]; ok {
+			return m, true
+		}
+	}
+	m, ok := c.Mirrors[wildcardMirror]
+	return m, ok
+}
+
+// config returns the config of host
+func (c *RegistriesConfig) config(host string) (RegistryConfig, bool) {
+	if c == nil {
+		return RegistryConfig{}, false
+	}
+	for _, key := range hostKeys(host) {
+		if cfg, ok := c.Configs[key]; ok {
+			return cfg, true
+		}
+	}
+	return RegistryConfig{}, false
+}
+
+// rewrite applies the first rewrite of m matching repo, in the order of their expressions
+func (m Mirror) rewrite(repo string) string {
+	exprs := make([]string, 0, len(m.Rewrites))
+	for expr := range m.Rewrites {
+		exprs = append(exprs, expr)
+	}
+	sort.Strings(exprs)
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil || !re.MatchString(repo) {
+			continue
+		}
+		return re.ReplaceAllString(repo, m.Rewrites[expr])
+	}
+	return repo
+}
+
+// hostKeys are the keys host may be configured under, docker hub being known by several names
+func hostKeys(host string) []string {
+	switch host {
+	case gname.DefaultRegistry, "docker.io", "registry-1.docker.io":
+		return []string{host, "docker.io", gname.DefaultRegistry, "registry-1.docker.io"}
+	}
+	return []string{host}
+}
+
+// parseEndpoint returns the host of the mirror endpoint ep, and whether it's reached over plain http
+func parseEndpoint(ep string) (string, bool, error) {
+	if !strings.Contains(ep, "://") {
+		ep = "https://" + ep
+	}
+	u, err := url.Parse(ep)
+	if err != nil {
+		return "", false, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false, fmt.Errorf("endpoint [%s] is neither http nor https", ep)
+	}
+	if p := strings.TrimSuffix(u.Path, "/"); p != "" && p != "/v2" {
+		return "", false, fmt.Errorf("endpoint [%s] has a path, only the host of a mirror is supported", ep)
+	}
+	return u.Host, u.Scheme == "http", nil
+}
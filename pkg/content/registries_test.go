@@ -0,0 +1,150 @@
+package content_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/rancherfederal/hauler/pkg/content"
+)
+
+const registriesYAML = `
+mirrors:
+  docker.io:
+    endpoint:
+      - https://mirror.example.com:5000
+      - http://cache.example.com
+    rewrite:
+      "^rancher/(.*)": "mirrors/rancher/$1"
+  "*":
+    endpoint:
+      - https://everything.example.com
+configs:
+  mirror.example.com:5000:
+    auth:
+      username: hauler
+      password: haulin
+    tls:
+      ca_file: /etc/ssl/private-ca.pem
+      insecure_skip_verify: true
+`
+
+func TestRegistriesConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registries.yaml")
+	if err := os.WriteFile(path, []byte(registriesYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := content.LoadRegistriesConfig(path)
+	if err != nil {
+		t.Fatalf("LoadRegistriesConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		c    *content.RegistriesConfig
+		ref  string
+		want []string
+	}{
+		{
+			name: "should pull through the mirrors of docker hub, then docker hub",
+			c:    c,
+			ref:  "busybox:1.36",
+			want: []string{
+				"mirror.example.com:5000/library/busybox:1.36",
+				"cache.example.com/library/busybox:1.36",
+				"index.docker.io/library/busybox:1.36",
+			},
+		},
+		{
+			name: "should rewrite matching repositories on the mirrors alone",
+			c:    c,
+			ref:  "rancher/k3s@sha256:2f2a5d5ba8e5e8e6c8c4b4f1e2c0f6e3d1b7a9c5e4f3a2b1c0d9e8f7a6b5c4d3",
+			want: []string{
+				"mirror.example.com:5000/mirrors/rancher/k3s@sha256:2f2a5d5ba8e5e8e6c8c4b4f1e2c0f6e3d1b7a9c5e4f3a2b1c0d9e8f7a6b5c4d3",
+				"cache.example.com/mirrors/rancher/k3s@sha256:2f2a5d5ba8e5e8e6c8c4b4f1e2c0f6e3d1b7a9c5e4f3a2b1c0d9e8f7a6b5c4d3",
+				"index.docker.io/rancher/k3s@sha256:2f2a5d5ba8e5e8e6c8c4b4f1e2c0f6e3d1b7a9c5e4f3a2b1c0d9e8f7a6b5c4d3",
+			},
+		},
+		{
+			name: "should pull other registries through the wildcard mirror",
+			c:    c,
+			ref:  "ghcr.io/hauler/app:v1",
+			want: []string{"everything.example.com/hauler/app:v1", "ghcr.io/hauler/app:v1"},
+		},
+		{
+			name: "should pull from the registry itself without a config",
+			ref:  "ghcr.io/hauler/app:v1",
+			want: []string{"ghcr.io/hauler/app:v1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.c.Endpoints(tt.ref)
+			if err != nil {
+				t.Fatalf("Endpoints() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Endpoints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !c.PlainHTTP("cache.example.com") || c.PlainHTTP("mirror.example.com:5000") {
+		t.Errorf("PlainHTTP() should hold for the http endpoint alone")
+	}
+
+	reg, err := gname.NewRegistry("mirror.example.com:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := c.Keychain().Resolve(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := authenticator.Authorization()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.Username != "hauler" || auth.Password != "haulin" {
+		t.Errorf("Keychain() resolved [%s:%s], want [hauler:haulin]", auth.Username, auth.Password)
+	}
+
+	opts, insecure := content.TransportOptions{Registries: c}.HostTLS("mirror.example.com:5000")
+	if opts.CAFile != "/etc/ssl/private-ca.pem" || !insecure {
+		t.Errorf("HostTLS() = %+v, %v, want the ca file of the config, unverified", opts, insecure)
+	}
+}
+
+func TestLoadRegistriesConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{
+			name: "should reject unknown fields",
+			yaml: "mirrors:\n  docker.io:\n    endpoints:\n      - https://mirror.example.com\n",
+		},
+		{
+			name: "should reject endpoints with a path",
+			yaml: "mirrors:\n  docker.io:\n    endpoint:\n      - https://mirror.example.com/docker\n",
+		},
+		{
+			name: "should reject invalid rewrites",
+			yaml: "mirrors:\n  docker.io:\n    rewrite:\n      \"^(rancher\": \"mirror\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "registries.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := content.LoadRegistriesConfig(path); err == nil {
+				t.Errorf("LoadRegistriesConfig() should fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package content
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	creference "github.com/containerd/containerd/reference"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/google/go-containerregistry/pkg/authn"
+	gname "github.com/google/go-containerregistry/pkg/name"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/target"
+
+	"github.com/rancherfederal/hauler/internal/version"
+)
+
+var _ target.Target = (*Registry)(nil)
+
+var (
+	ErrCatalogUnsupported = errors.New("registry does not support catalog listing")
+	ErrUnauthorized       = errors.New("unauthorized")
+)
+
+// catalogPageSize is the number of repositories requested per page of a catalog listing
+const catalogPageSize = 100
+
+// RegistryOptions provide configuration options to a Registry
+type RegistryOptions struct {
+	// Username and Password are used for every host when set, otherwise credentials are looked up from Keychain
+	Username  string
+	Password  string
+	Insecure  bool
+	PlainHTTP bool
+
+	// UserAgent is sent on every request made to the registry, including token requests and blob transfers.
+	// When empty, DefaultUserAgent is used.
+	UserAgent string
+
+	TransportOptions
+}
+
+// Registry provides content from a spec-compliant registry
+//
+//	This mirrors oras' content.Registry, but gives us control over the transport used for every outbound request
+type Registry struct {
+	remotes.Resolver
+
+	hosts     docker.RegistryHosts
+	userAgent string
+}
+
+// NewRegistry creates a new Registry target
+func NewRegistry(opts RegistryOptions) (*Registry, error) {
+	if opts.UserAgent == "" {
+		opts.UserAgent = DefaultUserAgent()
+	}
+
+	headers := http.Header{}
+	headers.Set("User-Agent", opts.UserAgent)
+
+	hosts := newHosts(opts, headers)
+	return &Registry{
+		Resolver: docker.NewResolver(docker.ResolverOptions{
+			Hosts:   hosts,
+			Headers: headers,
+		}),
+		hosts:     hosts,
+		userAgent: opts.UserAgent,
+	}, nil
+}
+
+// DefaultUserAgent identifies hauler and its version to remote registries
+func DefaultUserAgent() string {
+	return "hauler/" + version.GetVersionInfo().GitVersion
+}
+
+// Exists reports whether the repository of ref already holds the blob described by desc
+//
+//	This is a HEAD on the blob endpoint, retried once with credentials if the registry challenges the request.  Any
+//	response other than 200 or 404 is returned as an error so callers can fall back to simply pushing the blob.
+func (r *Registry) Exists(ctx context.Context, ref string, desc ocispec.Descriptor) (bool, error) {
+	refspec, err := creference.Parse(ref)
+	if err != nil {
+		return false, err
+	}
+
+	hosts, err := r.hosts(refspec.Hostname())
+	if err != nil {
+		return false, err
+	}
+	if len(hosts) == 0 {
+		return false, fmt.Errorf("no hosts configured for [%s]", refspec.Hostname())
+	}
+	host := hosts[0]
+
+	ctx, err = docker.ContextWithRepositoryScope(ctx, refspec, false)
+	if err != nil {
+		return false, err
+	}
+
+	repo := strings.TrimPrefix(refspec.Locator, refspec.Hostname()+"/")
+	u := fmt.Sprintf("%s://%s%s/%s/blobs/%s", host.Scheme, host.Host, host.Path, repo, desc.Digest)
+
+	resp, err := r.send(ctx, host, http.MethodHead, u)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("unexpected status probing [%s]: %s", u, resp.Status)
+}
+
+// Catalog lists the repositories exposed by the registry at host, following the Link header across every page
+//
+//	ErrCatalogUnsupported is returned when the registry doesn't implement the catalog endpoint, and ErrUnauthorized
+//	when the configured credentials are missing or not allowed to list it.
+func (r *Registry) Catalog(ctx context.Context, host string) ([]string, error) {
+	hosts, err := r.hosts(host)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts configured for [%s]", host)
+	}
+	h := hosts[0]
+
+	ctx = docker.WithScope(ctx, "registry:catalog:*")
+
+	next, err := url.Parse(fmt.Sprintf("%s://%s%s/_catalog?n=%d", h.Scheme, h.Host, h.Path, catalogPageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []string
+	for next != nil {
+		resp, err := r.send(ctx, h, http.MethodGet, next.String())
+		if err != nil {
+			return nil, err
+		}
+
+		page, link, err := readCatalog(resp)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("listing [%s]: %w", host, err)
+		}
+		repos = append(repos, page...)
+
+		if link == "" {
+			break
+		}
+		if next, err = next.Parse(link); err != nil {
+			return nil, fmt.Errorf("listing [%s]: invalid Link header: %w", host, err)
+		}
+	}
+	return repos, nil
+}
+
+// readCatalog decodes a page of catalog results, returning the target of its rel="next" Link, if any
+func readCatalog(resp *http.Response) ([]string, string, error) {
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, "", fmt.Errorf("%w: %s", ErrUnauthorized, resp.Status)
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, "", fmt.Errorf("%w: %s", ErrCatalogUnsupported, resp.Status)
+	default:
+		return nil, "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&catalog); err != nil {
+		return nil, "", err
+	}
+
+	for _, link := range strings.Split(resp.Header.Get("Link"), ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.ReplaceAll(strings.TrimSpace(param), `"`, "") == "rel=next" {
+				return catalog.Repositories, strings.Trim(strings.TrimSpace(parts[0]), "<>"), nil
+			}
+		}
+	}
+	return catalog.Repositories, "", nil
+}
+
+// send makes a request against host, retrying once with credentials if the registry challenges it
+//
+//	The caller must close the returned response's body.  A challenge we can't answer returns the 401 response as-is.
+func (r *Registry) send(ctx context.Context, host docker.RegistryHost, method string, u string) (*http.Response, error) {
+	resp, err := r.do(ctx, host, method, u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized || host.Authorizer == nil {
+		return resp, nil
+	}
+
+	if err := host.Authorizer.AddResponses(ctx, []*http.Response{resp}); err != nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return r.do(ctx, host, method, u)
+}
+
+func (r *Registry) do(ctx context.Context, host docker.RegistryHost, method string, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", r.userAgent)
+
+	if host.Authorizer != nil {
+		if err := host.Authorizer.Authorize(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	return host.Client.Do(req)
+}
+
+func newHosts(opts RegistryOptions, headers http.Header) docker.RegistryHosts {
+	client := &http.Client{
+		Transport: newTransport(opts),
+	}
+
+	authOpts := []docker.AuthorizerOpt{
+		docker.WithAuthClient(client),
+		docker.WithAuthHeader(headers),
+		docker.WithAuthCreds(func(host string) (string, string, error) {
+			if opts.Username != "" || opts.Password != "" {
+				return opts.Username, opts.Password, nil
+			}
+			return keychainCreds(opts.TransportOptions.Keychain(), host)
+		}),
+	}
+
+	plainHTTP := docker.MatchLocalhost
+	if opts.PlainHTTP {
+		plainHTTP = docker.MatchAllHosts
+	}
+
+	authorizer := newRefreshingAuthorizer(func() docker.Authorizer {
+		return docker.NewDockerAuthorizer(authOpts...)
+	})
+
+	return docker.ConfigureDefaultRegistries(
+		docker.WithClient(client),
+		docker.WithPlainHTTP(plainHTTP),
+		docker.WithAuthorizer(authorizer),
+	)
+}
+
+func newTransport(opts RegistryOptions) http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Insecure {
+		t.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	}
+	return opts.TransportOptions.Transport(t)
+}
+
+// keychainCreds looks up the credentials for host from kc
+func keychainCreds(kc authn.Keychain, host string) (string, string, error) {
+	// containerd resolves docker hub to its api host, while docker configs key it by the index
+	if host == "registry-1.docker.io" {
+		host = gname.DefaultRegistry
+	}
+
+	reg, err := gname.NewRegistry(host)
+	if err != nil {
+		return "", "", err
+	}
+
+	auth, err := kc.Resolve(reg)
+	if err != nil {
+		return "", "", err
+	}
+
+	cfg, err := auth.Authorization()
+	if err != nil {
+		return "", "", err
+	}
+
+	// containerd treats an empty username as a signal to use the secret as a refresh token
+	if cfg.IdentityToken != "" {
+		return "", cfg.IdentityToken, nil
+	}
+	return cfg.Username, cfg.Password, nil
+}
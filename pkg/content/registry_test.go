@@ -0,0 +1,357 @@
+package content_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/content"
+)
+
+func TestRegistry_UserAgent(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	agents := make(map[string][]string)
+	srv := httptest.NewServer(func() http.Handler {
+		reg := registry.New()
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			switch {
+			case strings.Contains(r.URL.Path, "/manifests/"):
+				agents["manifests"] = append(agents["manifests"], r.UserAgent())
+			case strings.Contains(r.URL.Path, "/blobs/"):
+				agents["blobs"] = append(agents["blobs"], r.UserAgent())
+			}
+			mu.Unlock()
+			reg.ServeHTTP(w, r)
+		})
+	}())
+	defer srv.Close()
+
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/hauler/agent:v1"
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(r, img); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(content.DefaultUserAgent(), "hauler/") {
+		t.Errorf("DefaultUserAgent() = %s, want hauler/<version>", content.DefaultUserAgent())
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{
+			name: "should default to hauler and its version",
+			want: content.DefaultUserAgent(),
+		},
+		{
+			name:      "should send the configured user agent",
+			userAgent: "airgap-mirror/1.0",
+			want:      "airgap-mirror/1.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			agents = make(map[string][]string)
+			mu.Unlock()
+
+			reg, err := content.NewRegistry(content.RegistryOptions{
+				PlainHTTP: true,
+				UserAgent: tt.userAgent,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, desc, err := reg.Resolve(ctx, ref)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			f, err := reg.Fetcher(ctx, ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rc, err := f.Fetch(ctx, desc)
+			if err != nil {
+				t.Fatalf("Fetch() manifest error = %v", err)
+			}
+			var m ocispec.Manifest
+			err = json.NewDecoder(rc).Decode(&m)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rc, err = f.Fetch(ctx, m.Layers[0])
+			if err != nil {
+				t.Fatalf("Fetch() blob error = %v", err)
+			}
+			// blobs are only requested once read
+			_, err = io.Copy(io.Discard, rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("reading blob error = %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, kind := range []string{"manifests", "blobs"} {
+				if len(agents[kind]) == 0 {
+					t.Fatalf("no %s requests were made", kind)
+				}
+				for _, got := range agents[kind] {
+					if got != tt.want {
+						t.Errorf("%s request User-Agent = %s, want %s", kind, got, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRegistry_Exists(t *testing.T) {
+	ctx := context.Background()
+
+	reg := registry.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/unsupported/") && r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := host + "/hauler/exists:v1"
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(r, img); err != nil {
+		t.Fatal(err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld, err := layers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	present := ocispec.Descriptor{Digest: digest.Digest(ld.String())}
+	missing := ocispec.Descriptor{Digest: digest.FromString("missing")}
+
+	rg, err := content.NewRegistry(content.RegistryOptions{PlainHTTP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ref     string
+		desc    ocispec.Descriptor
+		want    bool
+		wantErr bool
+	}{
+		{name: "should find pushed blobs", ref: ref, desc: present, want: true},
+		{name: "should not find unknown blobs", ref: ref, desc: missing, want: false},
+		{name: "should error when the probe is unsupported", ref: host + "/unsupported/exists:v1", desc: present, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rg.Exists(ctx, tt.ref, tt.desc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Exists() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Exists() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry_TransportOptions(t *testing.T) {
+	ctx := context.Background()
+
+	reg := registry.New()
+	var mu sync.Mutex
+	failures := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if strings.Contains(r.URL.Path, "/manifests/") && failures > 0 {
+			failures--
+			mu.Unlock()
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mu.Unlock()
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/hauler/flaky:v1"
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(r, img); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     content.TransportOptions
+		failures int
+		wantErr  bool
+	}{
+		{
+			name:     "should make a single attempt by default",
+			failures: 1,
+			wantErr:  true,
+		},
+		{
+			name:     "should retry transient failures",
+			opts:     content.TransportOptions{MaxRetries: 3, RetryBackoff: time.Millisecond},
+			failures: 2,
+		},
+		{
+			name:     "should give up after the max retries",
+			opts:     content.TransportOptions{MaxRetries: 1, RetryBackoff: time.Millisecond},
+			failures: 5,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			failures = tt.failures
+			mu.Unlock()
+
+			rg, err := content.NewRegistry(content.RegistryOptions{
+				PlainHTTP:        true,
+				TransportOptions: tt.opts,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, err = rg.Resolve(ctx, ref)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegistry_Catalog(t *testing.T) {
+	ctx := context.Background()
+
+	pages := map[string]struct {
+		repos []string
+		link  string
+	}{
+		"":         {repos: []string{"hauler/a", "hauler/b"}, link: `</v2/_catalog?last=hauler%2Fb&n=2>; rel="next"`},
+		"hauler/b": {repos: []string{"hauler/c"}},
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "should follow pagination links",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				page, ok := pages[r.URL.Query().Get("last")]
+				if r.URL.Path != "/v2/_catalog" || !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if page.link != "" {
+					w.Header().Set("Link", page.link)
+				}
+				json.NewEncoder(w).Encode(map[string][]string{"repositories": page.repos})
+			},
+			want: []string{"hauler/a", "hauler/b", "hauler/c"},
+		},
+		{
+			name: "should report registries without a catalog",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantErr: content.ErrCatalogUnsupported,
+		},
+		{
+			name: "should report insufficient credentials",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="hauler"`)
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			wantErr: content.ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			reg, err := content.NewRegistry(content.RegistryOptions{Username: "bob", Password: "wrong"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := reg.Catalog(ctx, strings.TrimPrefix(srv.URL, "http://"))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Catalog() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Catalog() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Catalog() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
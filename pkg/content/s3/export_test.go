@@ -0,0 +1,4 @@
+package s3
+
+// Sign exposes sign to the tests of the package
+var Sign = sign
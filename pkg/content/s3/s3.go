@@ -0,0 +1,412 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPartSize is the size of the parts a large object is uploaded in, and the most an upload holds in memory
+	DefaultPartSize = 64 << 20
+
+	// MinPartSize is the smallest part object storage accepts but for the last
+	MinPartSize = 5 << 20
+
+	// defaultRegion is the region of a target whose environment names none
+	defaultRegion = "us-east-1"
+)
+
+// Options configure the object storage a Client writes to
+type Options struct {
+	// Endpoint is the url of the object storage, defaulting to aws s3 of Region, any other is addressed path style
+	Endpoint string
+
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// PartSize is the size of the parts of a multipart upload, defaulting to DefaultPartSize
+	PartSize int64
+
+	// Transport makes the requests of the client, defaulting to http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+// OptionsFromEnv returns the options of the aws environment variables, reading the credentials of the shared
+// credentials file for AWS_PROFILE when the environment holds none
+func OptionsFromEnv() (Options, error) {
+	o := Options{
+		Endpoint:        firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		Region:          firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if o.AccessKeyID != "" {
+		return o, nil
+	}
+
+	p := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if p == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return o, nil
+		}
+		p = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	creds, err := readCredentials(p, profile)
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return o, fmt.Errorf("reading aws credentials [%s]: %w", p, err)
+	}
+	o.AccessKeyID = creds["aws_access_key_id"]
+	o.SecretAccessKey = creds["aws_secret_access_key"]
+	o.SessionToken = creds["aws_session_token"]
+	return o, nil
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// readCredentials returns the keys of profile in the shared credentials file at p
+func readCredentials(p string, profile string) (map[string]string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	creds := make(map[string]string)
+	var section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			creds[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return creds, scanner.Err()
+}
+
+// ParseURL returns the bucket and key prefix of a target given as s3://bucket/prefix
+func ParseURL(target string) (string, string, error) {
+	rest, ok := strings.CutPrefix(target, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("[%s] is not an s3:// url", target)
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("[%s] names no bucket", target)
+	}
+	return bucket, strings.Trim(prefix, "/"), nil
+}
+
+// Client writes objects beneath a prefix of a bucket, uploading large objects in parts that are resumed after a
+// failure rather than started over
+type Client struct {
+	opts   Options
+	bucket string
+	prefix string
+	hc     *http.Client
+}
+
+// NewClient returns a client writing to prefix of bucket
+func NewClient(bucket string, prefix string, opts Options) (*Client, error) {
+	if opts.AccessKeyID == "" || opts.SecretAccessKey == "" {
+		return nil, fmt.Errorf("no credentials for bucket [%s], set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY or AWS_PROFILE", bucket)
+	}
+	if opts.Region == "" {
+		opts.Region = defaultRegion
+	}
+	if opts.PartSize == 0 {
+		opts.PartSize = DefaultPartSize
+	}
+	if opts.PartSize < MinPartSize {
+		return nil, fmt.Errorf("part size [%d] is less than the minimum of [%d]", opts.PartSize, MinPartSize)
+	}
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+	if opts.Endpoint != "" {
+		if _, err := url.Parse(opts.Endpoint); err != nil {
+			return nil, fmt.Errorf("parsing endpoint [%s]: %w", opts.Endpoint, err)
+		}
+	}
+
+	return &Client{
+		opts:   opts,
+		bucket: bucket,
+		prefix: strings.Trim(prefix, "/"),
+		hc:     &http.Client{Transport: opts.Transport},
+	}, nil
+}
+
+// objectURL returns the url of key, virtual hosted on aws and path style on any other endpoint
+func (c *Client) objectURL(key string, query url.Values) *url.URL {
+	var u *url.URL
+	if c.opts.Endpoint == "" {
+		u = &url.URL{Scheme: "https", Host: c.bucket + ".s3." + c.opts.Region + ".amazonaws.com", Path: "/" + key}
+	} else {
+		u, _ = url.Parse(c.opts.Endpoint)
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.bucket + "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+	return u
+}
+
+// key returns the key of name beneath the prefix of the client
+func (c *Client) key(name string) string {
+	return strings.TrimPrefix(path.Join(c.prefix, name), "/")
+}
+
+// do makes a signed request for key, returning an error for any response but one of ok
+func (c *Client) do(ctx context.Context, method string, key string, query url.Values, body []byte, ok ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if len(body) == 0 {
+		req.Body = http.NoBody
+	}
+	sign(req, body, c.opts, time.Now())
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		return nil, fmt.Errorf("%s [s3://%s/%s]: %s: %s", method, c.bucket, key, e.Code, e.Message)
+	}
+	return nil, fmt.Errorf("%s [s3://%s/%s]: unexpected status %s", method, c.bucket, key, resp.Status)
+}
+
+// Exists reports whether the object name holds size bytes
+func (c *Client) Exists(ctx context.Context, name string, size int64) (bool, error) {
+	resp, err := c.do(ctx, http.MethodHead, c.key(name), nil, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK && resp.ContentLength == size, nil
+}
+
+// Write uploads the content of r to the object name, in parts when it's larger than a part
+//
+//	An upload of parts that fails is left in place, so writing the same object again resumes it, only uploading the
+//	parts that don't already hold the same content.  Object storage keeps incomplete uploads until they're aborted or
+//	expired by a lifecycle rule of the bucket.
+func (c *Client) Write(ctx context.Context, name string, r io.Reader) error {
+	key := c.key(name)
+
+	part := make([]byte, c.opts.PartSize)
+	n, err := io.ReadFull(r, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		resp, err := c.do(ctx, http.MethodPut, key, nil, part[:n], http.StatusOK)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	uploadID, uploaded, err := c.resumeUpload(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	var completed []completedPart
+	for number := 1; n > 0; number++ {
+		sum := md5.Sum(part[:n])
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+		if prev, ok := uploaded[number]; !ok || prev.ETag != etag || prev.Size != int64(n) {
+			query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+			resp, err := c.do(ctx, http.MethodPut, key, query, part[:n], http.StatusOK)
+			if err != nil {
+				return fmt.Errorf("uploading part [%d]: %w", number, err)
+			}
+			resp.Body.Close()
+			if got := resp.Header.Get("ETag"); got != "" {
+				etag = got
+			}
+		}
+		completed = append(completed, completedPart{PartNumber: number, ETag: etag})
+
+		n, err = io.ReadFull(r, part)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+	}
+
+	body, err := xml.Marshal(completeUpload{Parts: completed})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// completing an upload can fail after its 200 has been sent, reported by an error in the body
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if xml.Unmarshal(data, &result) == nil && result.XMLName.Local == "Error" {
+		return fmt.Errorf("completing [s3://%s/%s]: %s: %s", c.bucket, key, result.Code, result.Message)
+	}
+	return nil
+}
+
+type uploadedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+	Size       int64  `xml:"Size"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+// resumeUpload returns the latest incomplete upload of key and the parts it holds, or starts a new one
+func (c *Client) resumeUpload(ctx context.Context, key string) (string, map[int]uploadedPart, error) {
+	resp, err := c.do(ctx, http.MethodGet, "", url.Values{"uploads": {""}, "prefix": {key}}, nil, http.StatusOK)
+	if err != nil {
+		return "", nil, err
+	}
+	var uploads struct {
+		Uploads []struct {
+			Key       string    `xml:"Key"`
+			UploadID  string    `xml:"UploadId"`
+			Initiated time.Time `xml:"Initiated"`
+		} `xml:"Upload"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&uploads)
+	resp.Body.Close()
+	if err != nil {
+		return "", nil, fmt.Errorf("listing uploads of [s3://%s/%s]: %w", c.bucket, key, err)
+	}
+
+	var uploadID string
+	var initiated time.Time
+	for _, u := range uploads.Uploads {
+		if u.Key == key && (uploadID == "" || u.Initiated.After(initiated)) {
+			uploadID, initiated = u.UploadID, u.Initiated
+		}
+	}
+	if uploadID != "" {
+		parts, err := c.listParts(ctx, key, uploadID)
+		return uploadID, parts, err
+	}
+
+	resp, err = c.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, http.StatusOK)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&created); err != nil || created.UploadID == "" {
+		return "", nil, fmt.Errorf("starting upload of [s3://%s/%s]: no upload id: %v", c.bucket, key, err)
+	}
+	return created.UploadID, nil, nil
+}
+
+// listParts returns the parts of the upload of key by their number
+func (c *Client) listParts(ctx context.Context, key string, uploadID string) (map[int]uploadedPart, error) {
+	parts := make(map[int]uploadedPart)
+	marker := ""
+	for {
+		query := url.Values{"uploadId": {uploadID}}
+		if marker != "" {
+			query.Set("part-number-marker", marker)
+		}
+		resp, err := c.do(ctx, http.MethodGet, key, query, nil, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Parts                []uploadedPart `xml:"Part"`
+			IsTruncated          bool           `xml:"IsTruncated"`
+			NextPartNumberMarker string         `xml:"NextPartNumberMarker"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("listing parts of [s3://%s/%s]: %w", c.bucket, key, err)
+		}
+		for _, p := range page.Parts {
+			parts[p.PartNumber] = p
+		}
+		if !page.IsTruncated || page.NextPartNumberMarker == "" {
+			return parts, nil
+		}
+		marker = page.NextPartNumberMarker
+	}
+}
@@ -0,0 +1,89 @@
+package content
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// ErrMissingValue is returned when a content manifest references a variable that has no value
+var ErrMissingValue = errors.New("missing value")
+
+// varPattern matches ${VAR} and ${VAR:-default}
+var varPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// Render resolves the variables of a content manifest from values, falling back to the environment
+//
+//	${VAR} and ${VAR:-default} are substituted first, then the result is executed as a go template with every variable
+//	as its data, i.e. {{ .VAR }}.  values take precedence over environment variables of the same name, and a variable
+//	with neither a value nor a default fails with ErrMissingValue.  Content referencing no variables is returned as is.
+func Render(data []byte, values map[string]string) ([]byte, error) {
+	lookup := func(key string) (string, bool) {
+		if v, ok := values[key]; ok {
+			return v, true
+		}
+		return os.LookupEnv(key)
+	}
+
+	var missing []string
+	data = varPattern.ReplaceAllFunc(data, func(m []byte) []byte {
+		groups := varPattern.FindSubmatch(m)
+		if v, ok := lookup(string(groups[1])); ok {
+			return []byte(v)
+		}
+		// a default is set whenever the :- is present, even when empty
+		if bytes.Contains(m, []byte(":-")) {
+			return groups[2]
+		}
+		missing = append(missing, string(groups[1]))
+		return m
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingValue, strings.Join(missing, ", "))
+	}
+
+	if !bytes.Contains(data, []byte("{{")) {
+		return data, nil
+	}
+
+	tmpl, err := template.New("content").Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing content template: %w", err)
+	}
+
+	vars := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+	for k, v := range values {
+		vars[k] = v
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		if strings.Contains(err.Error(), "map has no entry for key") {
+			return nil, fmt.Errorf("%w: %v", ErrMissingValue, err)
+		}
+		return nil, fmt.Errorf("rendering content template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseValues parses key=value pairs, as passed with --set, into a map of values for Render
+func ParseValues(pairs []string) (map[string]string, error) {
+	values := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid value [%s], must be of the form key=value", p)
+		}
+		values[k] = v
+	}
+	return values, nil
+}
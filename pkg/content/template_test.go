@@ -0,0 +1,94 @@
+package content_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rancherfederal/hauler/pkg/content"
+)
+
+func TestRender(t *testing.T) {
+	t.Setenv("HAULER_TEST_REGISTRY", "env.example.com")
+	t.Setenv("HAULER_TEST_CHANNEL", "stable")
+
+	values := map[string]string{
+		"HAULER_TEST_REGISTRY": "set.example.com",
+		"VERSION":              "v1.2.3",
+	}
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "should leave content without variables as is",
+			in:   "name: rancher/rancher:v2.8.0",
+			want: "name: rancher/rancher:v2.8.0",
+		},
+		{
+			name: "should substitute from the environment",
+			in:   "channel: ${HAULER_TEST_CHANNEL}",
+			want: "channel: stable",
+		},
+		{
+			name: "should prefer values over the environment",
+			in:   "name: ${HAULER_TEST_REGISTRY}/rancher/rancher:${VERSION}",
+			want: "name: set.example.com/rancher/rancher:v1.2.3",
+		},
+		{
+			name: "should fall back to a default",
+			in:   "tag: ${HAULER_TEST_UNSET:-latest}, empty: '${HAULER_TEST_UNSET:-}'",
+			want: "tag: latest, empty: ''",
+		},
+		{
+			name:    "should fail on a missing variable",
+			in:      "name: ${HAULER_TEST_UNSET}",
+			wantErr: content.ErrMissingValue,
+		},
+		{
+			name: "should execute go templates",
+			in:   "name: {{ .HAULER_TEST_REGISTRY }}/rancher/rancher:{{ .VERSION }}, channel: {{ .HAULER_TEST_CHANNEL }}",
+			want: "name: set.example.com/rancher/rancher:v1.2.3, channel: stable",
+		},
+		{
+			name:    "should fail on a missing template key",
+			in:      "name: {{ .HAULER_TEST_UNSET }}",
+			wantErr: content.ErrMissingValue,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := content.Render([]byte(tt.in), values)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Render() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && string(got) != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	got, err := content.ParseValues([]string{"registry=reg.example.com", "query=a=b", "empty="})
+	if err != nil {
+		t.Fatalf("ParseValues() error = %v", err)
+	}
+	want := map[string]string{"registry": "reg.example.com", "query": "a=b", "empty": ""}
+	if len(got) != len(want) {
+		t.Fatalf("ParseValues() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("ParseValues()[%s] = %q, want %q", k, got[k], v)
+		}
+	}
+
+	for _, bad := range []string{"novalue", "=value"} {
+		if _, err := content.ParseValues([]string{bad}); err == nil {
+			t.Errorf("ParseValues(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package content
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Names of the certificates of a registry in its directory of TLSOptions.CertsDir, those of docker's certs.d
+const (
+	CertsDirCAFile   = "ca.crt"
+	CertsDirCertFile = "client.cert"
+	CertsDirKeyFile  = "client.key"
+)
+
+// TLSOptions configure the certificates of connections to remote registries, for registries with a private CA or
+// requiring client certificates
+//
+//	The zero value trusts the system's certificate authorities alone and presents no client certificate.
+type TLSOptions struct {
+	// CAFile is a PEM bundle of certificate authorities trusted along with the system's
+	CAFile string
+
+	// CertFile and KeyFile are the PEM client certificate and key presented to registries requesting one
+	CertFile string
+	KeyFile  string
+
+	// CertsDir holds the certificates of individual registries laid out as docker's certs.d, in a directory named after
+	// the host, and port when not the default, of each: ca.crt, client.cert, and client.key.  They take precedence over
+	// the files above for their registry.
+	CertsDir string
+}
+
+// IsZero reports whether o leaves every setting at its default
+func (o TLSOptions) IsZero() bool {
+	return o == TLSOptions{}
+}
+
+// ForHost returns the options of connections to host, with the files CertsDir holds for it in place of the others
+func (o TLSOptions) ForHost(host string) TLSOptions {
+	if o.CertsDir == "" {
+		return o
+	}
+	dir := filepath.Join(o.CertsDir, host)
+	for name, file := range map[string]*string{
+		CertsDirCAFile:   &o.CAFile,
+		CertsDirCertFile: &o.CertFile,
+		CertsDirKeyFile:  &o.KeyFile,
+	} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			*file = filepath.Join(dir, name)
+		}
+	}
+	return o
+}
+
+// Validate loads the certificates of o, so misconfigurations fail before any request is made
+func (o TLSOptions) Validate() error {
+	if _, err := o.Config(nil); err != nil {
+		return err
+	}
+	if o.CertsDir != "" {
+		if fi, err := os.Stat(o.CertsDir); err != nil {
+			return err
+		} else if !fi.IsDir() {
+			return fmt.Errorf("certs dir [%s] is not a directory", o.CertsDir)
+		}
+	}
+	return nil
+}
+
+// Config returns a clone of base trusting the CAFile and presenting the client certificate of o
+func (o TLSOptions) Config(base *tls.Config) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if base != nil {
+		cfg = base.Clone()
+	}
+
+	if o.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates in ca file [%s]", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, errors.New("both a client certificate and key are required")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate [%s]: %w", o.CertFile, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// hostTransport makes requests with a transport configured with the certificates of the host of each request, over
+// plain http to the mirrors reached that way
+type hostTransport struct {
+	base *http.Transport
+	opts TransportOptions
+
+	mu    sync.Mutex
+	hosts map[string]*http.Transport
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" && t.opts.PlainHTTP(req.URL.Host) {
+		req = req.Clone(req.Context())
+		req.URL.Scheme = "http"
+	}
+	rt, err := t.transport(req.URL.Host)
+	if err != nil {
+		return nil, fmt.Errorf("configuring tls for [%s]: %w", req.URL.Host, err)
+	}
+	return rt.RoundTrip(req)
+}
+
+func (t *hostTransport) transport(host string) (*http.Transport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if rt, ok := t.hosts[host]; ok {
+		return rt, nil
+	}
+
+	opts, insecure := t.opts.HostTLS(host)
+	cfg, err := opts.Config(t.base.TLSClientConfig)
+	if err != nil {
+		return nil, err
+	}
+	if insecure {
+		cfg.InsecureSkipVerify = true
+	}
+	rt := t.base.Clone()
+	rt.TLSClientConfig = cfg
+	if t.hosts == nil {
+		t.hosts = make(map[string]*http.Transport)
+	}
+	t.hosts[host] = rt
+	return rt, nil
+}
@@ -0,0 +1,114 @@
+package content_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+
+	"github.com/rancherfederal/hauler/internal/server"
+	"github.com/rancherfederal/hauler/pkg/content"
+)
+
+func TestTransportOptions_TLS(t *testing.T) {
+	certs := t.TempDir()
+	cfg, err := server.GenerateSelfSigned(certs, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := cfg.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := filepath.Join(certs, server.CAFileName)
+
+	newServer := func(clientAuth tls.ClientAuthType) *httptest.Server {
+		srv := httptest.NewUnstartedServer(registry.New())
+		srv.TLS = &tls.Config{Certificates: []tls.Certificate{pair}, ClientAuth: clientAuth}
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	private := newServer(tls.NoClientCert)
+	mtls := newServer(tls.RequireAnyClientCert)
+
+	// a certs.d holding the CA of the private registry alone
+	certsDir := t.TempDir()
+	u, err := url.Parse(private.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(certsDir, u.Host), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pem, err := os.ReadFile(ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(certsDir, u.Host, content.CertsDirCAFile), pem, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		srv     *httptest.Server
+		opts    content.TLSOptions
+		wantErr bool
+	}{
+		{
+			name:    "should reject a registry signed by a private ca",
+			srv:     private,
+			wantErr: true,
+		},
+		{
+			name: "should trust the ca file",
+			srv:  private,
+			opts: content.TLSOptions{CAFile: ca},
+		},
+		{
+			name: "should trust the ca of the registry in the certs dir",
+			srv:  private,
+			opts: content.TLSOptions{CertsDir: certsDir},
+		},
+		{
+			name:    "should fail without the client certificate a registry requires",
+			srv:     mtls,
+			opts:    content.TLSOptions{CAFile: ca},
+			wantErr: true,
+		},
+		{
+			name: "should present the client certificate",
+			srv:  mtls,
+			opts: content.TLSOptions{CAFile: ca, CertFile: cfg.CertFile, KeyFile: cfg.KeyFile},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			rt := content.TransportOptions{TLS: tt.opts}.Transport(http.DefaultTransport.(*http.Transport))
+
+			resp, err := (&http.Client{Transport: rt}).Get(tt.srv.URL + "/v2/")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("Get() status = %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+		})
+	}
+
+	if err := (content.TLSOptions{CertFile: cfg.CertFile}).Validate(); err == nil {
+		t.Errorf("Validate() without a client key should fail")
+	}
+}
@@ -0,0 +1,145 @@
+package content
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTokenExpiry is the lifetime of a registry token whose response leaves it out, per the token spec
+	defaultTokenExpiry = 60 * time.Second
+
+	// tokenExpiryMargin is how long before its expiry a token stops being reused, so it doesn't expire mid-request
+	tokenExpiryMargin = 10 * time.Second
+)
+
+// tokens are the registry tokens issued to every transport of the process, so a registry rate limiting its token
+// requests, such as docker hub, is asked for a token once per repository rather than once per request
+var tokens = &tokenCache{entries: make(map[string]cachedToken)}
+
+type tokenCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedToken
+}
+
+type cachedToken struct {
+	token   string
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// tokenKey identifies a token request by its realm, service, and scope, all held by its url, and the credentials it's
+// made with, so tokens are never shared between credentials
+func tokenKey(req *http.Request) string {
+	return req.URL.String() + "\x00" + req.Header.Get("Authorization")
+}
+
+func (c *tokenCache) get(key string) (cachedToken, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.entries[key]
+	if !ok {
+		return cachedToken{}, false
+	}
+	if time.Now().After(t.expires) {
+		delete(c.entries, key)
+		return cachedToken{}, false
+	}
+	return t, true
+}
+
+func (c *tokenCache) put(key string, t cachedToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = t
+}
+
+// revoke drops token from the cache, once a registry has rejected it before its expiry
+func (c *tokenCache) revoke(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, t := range c.entries {
+		if t.token == token {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// tokenTransport answers token requests with the unexpired tokens of the cache, and caches the tokens issued to it
+//
+//	A token request is a GET naming the service of the registry, answered with a token and its lifetime.  A token a
+//	registry rejects is dropped, so the client asking for a new one is issued one.
+type tokenTransport struct {
+	base  http.RoundTripper
+	cache *tokenCache
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.URL.Query().Get("service") == "" {
+		resp, err := t.base.RoundTrip(req)
+		if err == nil && resp.StatusCode == http.StatusUnauthorized {
+			if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+				t.cache.revoke(token)
+			}
+		}
+		return resp, err
+	}
+
+	key := tokenKey(req)
+	if cached, ok := t.cache.get(key); ok {
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        cached.header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(cached.body)),
+			ContentLength: int64(len(cached.body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var token struct {
+		Token       string    `json:"token"`
+		AccessToken string    `json:"access_token"`
+		ExpiresIn   int       `json:"expires_in"`
+		IssuedAt    time.Time `json:"issued_at"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || (token.Token == "" && token.AccessToken == "") {
+		return resp, nil
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+
+	lifetime := defaultTokenExpiry
+	if token.ExpiresIn > 0 {
+		lifetime = time.Duration(token.ExpiresIn) * time.Second
+	}
+	issued := time.Now()
+	if !token.IssuedAt.IsZero() && token.IssuedAt.Before(issued) {
+		issued = token.IssuedAt
+	}
+	if expires := issued.Add(lifetime - tokenExpiryMargin); expires.After(time.Now()) {
+		t.cache.put(key, cachedToken{token: token.Token, header: resp.Header.Clone(), body: body, expires: expires})
+	}
+	return resp, nil
+}
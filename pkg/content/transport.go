@@ -0,0 +1,276 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"syscall"
+	"time"
+
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/google/go-containerregistry/pkg/authn"
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	defaultRetryBackoff = time.Second
+
+	// maxRetryAfter is the longest a Retry-After is waited out for, a registry asking for longer fails the request so
+	// the next mirror is tried instead
+	maxRetryAfter = 5 * time.Minute
+)
+
+// TransportOptions configure the resilience of requests made to remote registries
+//
+//	The zero value matches hauler's historical behavior: a single attempt per request with no timeouts
+type TransportOptions struct {
+	// MaxRetries is how many times an idempotent request is retried after a network error or a retryable status
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry, doubling for each retry after.  Defaults to 1s when retrying.
+	RetryBackoff time.Duration
+
+	// RequestTimeout bounds how long to wait for a registry to begin responding to a single request.  It does not bound
+	// reading the response body, so large blobs aren't cut short.
+	RequestTimeout time.Duration
+
+	// OperationTimeout bounds an entire operation, such as a copy or sync, see WithOperationTimeout
+	OperationTimeout time.Duration
+
+	// TLS configures the certificates trusted and presented on connections to registries
+	TLS TLSOptions
+
+	// Registries configures the mirrors, credentials, and certificates of individual registries, taking precedence
+	// over TLS and the keychain for the registries it configures
+	Registries *RegistriesConfig
+
+	// RegistryMirrors are mirrors of docker hub its images are pulled from when pulling from docker hub itself fails,
+	// such as once rate limited.  An http:// mirror is reached over plain http.
+	RegistryMirrors []string
+
+	// RateLimit bounds the bytes per second transferred to and from registries across every connection, unlimited
+	// when 0
+	RateLimit int64
+
+	// ConnectionRateLimit bounds the bytes per second transferred over each single connection, unlimited when 0
+	ConnectionRateLimit int64
+}
+
+// IsZero reports whether o leaves every setting at its default
+func (o TransportOptions) IsZero() bool {
+	mirrors := o.RegistryMirrors
+	o.RegistryMirrors = nil
+	return len(mirrors) == 0 && reflect.ValueOf(o).IsZero()
+}
+
+// Endpoints returns the references ref is pulled from, in order: those of the registries config, then the registry
+// mirrors for images of docker hub
+func (o TransportOptions) Endpoints(ref string) ([]string, error) {
+	refs, err := o.Registries.Endpoints(ref)
+	if err != nil {
+		return nil, err
+	}
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	if r.Context().RegistryStr() != gname.DefaultRegistry {
+		return refs, nil
+	}
+
+	sep := ":"
+	if _, ok := r.(gname.Digest); ok {
+		sep = "@"
+	}
+	for _, mirror := range o.RegistryMirrors {
+		host, _, err := parseEndpoint(mirror)
+		if err != nil {
+			return nil, err
+		}
+		mirrored, err := gname.ParseReference(host + "/" + r.Context().RepositoryStr() + sep + r.Identifier())
+		if err != nil {
+			return nil, fmt.Errorf("registry mirror [%s] of [%s]: %w", mirror, ref, err)
+		}
+		refs = append(refs, mirrored.Name())
+	}
+	return refs, nil
+}
+
+// PlainHTTP reports whether host is a mirror reached over plain http
+func (o TransportOptions) PlainHTTP(host string) bool {
+	if o.Registries.PlainHTTP(host) {
+		return true
+	}
+	for _, mirror := range o.RegistryMirrors {
+		if h, plain, err := parseEndpoint(mirror); err == nil && plain && h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// Transport returns a clone of base configured with the request timeout, retry policy, rate limits, certificates, and
+// registries of o, reusing the registry tokens every transport has been issued.  Every request is traced, propagating
+// the trace context to the registry so its own traces line up with those of hauler.
+func (o TransportOptions) Transport(base *http.Transport) http.RoundTripper {
+	t := base.Clone()
+	if o.RequestTimeout > 0 {
+		t.ResponseHeaderTimeout = o.RequestTimeout
+	}
+	t.DialContext = o.limitDial(t.DialContext)
+	var rt http.RoundTripper = t
+	if !o.TLS.IsZero() || o.Registries != nil || len(o.RegistryMirrors) > 0 {
+		rt = &hostTransport{base: t, opts: o}
+	}
+
+	if o.MaxRetries > 0 {
+		backoff := o.RetryBackoff
+		if backoff <= 0 {
+			backoff = defaultRetryBackoff
+		}
+		rt = &retryTransport{
+			base:       rt,
+			maxRetries: o.MaxRetries,
+			backoff:    backoff,
+		}
+	}
+	return otelhttp.NewTransport(&tokenTransport{base: rt, cache: tokens})
+}
+
+// Keychain returns the keychain resolving credentials for registries, those of the registries config first
+func (o TransportOptions) Keychain() authn.Keychain {
+	if o.Registries == nil {
+		return Keychain
+	}
+	return authn.NewMultiKeychain(o.Registries.Keychain(), Keychain)
+}
+
+// HostTLS returns the certificates of connections to host, and whether the certificate host presents goes unverified
+func (o TransportOptions) HostTLS(host string) (TLSOptions, bool) {
+	opts := o.TLS.ForHost(host)
+	cfg, ok := o.Registries.config(host)
+	if !ok || cfg.TLS == nil {
+		return opts, false
+	}
+	for file, override := range map[*string]string{
+		&opts.CAFile:   cfg.TLS.CAFile,
+		&opts.CertFile: cfg.TLS.CertFile,
+		&opts.KeyFile:  cfg.TLS.KeyFile,
+	} {
+		if override != "" {
+			*file = override
+		}
+	}
+	return opts, cfg.TLS.InsecureSkipVerify
+}
+
+// WithOperationTimeout returns ctx bounded by the operation timeout, if one is set
+func (o TransportOptions) WithOperationTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.OperationTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, o.OperationTimeout)
+}
+
+// retryTransport retries idempotent requests that fail with a network error or a transient status, waiting out the
+// Retry-After of a rate limited request in place of the backoff
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	backoff    time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// only requests without a body can be safely replayed
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead) || (req.Body != nil && req.Body != http.NoBody) {
+		return t.base.RoundTrip(req)
+	}
+
+	backoff := t.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.maxRetries || !retryable(req.Context(), resp, err) {
+			return resp, err
+		}
+		wait := backoff
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				if after > maxRetryAfter {
+					return resp, err
+				}
+				wait = after
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// retryAfter returns how long the Retry-After of resp asks to wait, given in either seconds or as an http date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+
+	return transientStatus(resp.StatusCode)
+}
+
+// IsTransient reports whether err is a failure worth retrying, such as a dropped connection or a registry answering
+// with a 429 or a 5xx status
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var status remoteserrors.ErrUnexpectedStatus
+	if errors.As(err, &status) {
+		return transientStatus(status.StatusCode)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+func transientStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
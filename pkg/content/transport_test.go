@@ -0,0 +1,220 @@
+package content_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rancherfederal/hauler/pkg/content"
+)
+
+func TestTransportOptions_TokenReuse(t *testing.T) {
+	var mu sync.Mutex
+	issued := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		issued[r.URL.Query().Get("scope")]++
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"token": "t", "expires_in": 300})
+	}))
+	defer srv.Close()
+
+	get := func(scope string) {
+		// a transport of its own for each request, as each registry client makes
+		rt := content.TransportOptions{}.Transport(http.DefaultTransport.(*http.Transport))
+		resp, err := (&http.Client{Transport: rt}).Get(srv.URL + "/token?service=registry&scope=" + scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var token struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.Token != "t" {
+			t.Fatalf("token = %q, error = %v, want the issued token", token.Token, err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		get("repository:hauler/a:pull")
+		get("repository:hauler/b:pull")
+	}
+
+	want := map[string]int{"repository:hauler/a:pull": 1, "repository:hauler/b:pull": 1}
+	if !reflect.DeepEqual(issued, want) {
+		t.Errorf("tokens issued = %v, want one per repository %v", issued, want)
+	}
+}
+
+func TestTransportOptions_RetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		wantStatus int
+		wantWait   time.Duration
+	}{
+		{
+			name:       "should wait out the retry after of a rate limited request",
+			retryAfter: "1",
+			wantStatus: http.StatusOK,
+			wantWait:   time.Second,
+		},
+		{
+			name:       "should give up on a retry after longer than is worth waiting",
+			retryAfter: "3600",
+			wantStatus: http.StatusTooManyRequests,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limited := true
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if limited {
+					limited = false
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			opts := content.TransportOptions{MaxRetries: 3, RetryBackoff: time.Millisecond}
+			rt := opts.Transport(http.DefaultTransport.(*http.Transport))
+
+			start := time.Now()
+			resp, err := (&http.Client{Transport: rt}).Get(srv.URL + "/v2/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if waited := time.Since(start); waited < tt.wantWait {
+				t.Errorf("waited %s, want at least %s", waited, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestTransportOptions_RateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     content.TransportOptions
+		method   string
+		size     int
+		wantWait time.Duration
+	}{
+		{
+			name:     "should share the rate limit between every connection",
+			opts:     content.TransportOptions{RateLimit: 64 << 10},
+			method:   http.MethodGet,
+			size:     64 << 10,
+			wantWait: 800 * time.Millisecond,
+		},
+		{
+			name:     "should hold each connection to the connection rate limit",
+			opts:     content.TransportOptions{ConnectionRateLimit: 96 << 10},
+			method:   http.MethodGet,
+			size:     144 << 10,
+			wantWait: 400 * time.Millisecond,
+		},
+		{
+			name:     "should limit pushes as well as pulls",
+			opts:     content.TransportOptions{ConnectionRateLimit: 128 << 10},
+			method:   http.MethodPut,
+			size:     192 << 10,
+			wantWait: 400 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blob := make([]byte, tt.size)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					if n, err := io.Copy(io.Discard, r.Body); err != nil || n != int64(tt.size) {
+						t.Errorf("pushed %d bytes, error = %v, want %d", n, err, tt.size)
+					}
+					w.WriteHeader(http.StatusCreated)
+					return
+				}
+				w.Write(blob)
+			}))
+			defer srv.Close()
+
+			// two transfers at once, each over a transport of its own as each registry client makes
+			start := time.Now()
+			var wg sync.WaitGroup
+			for i := 0; i < 2; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					rt := tt.opts.Transport(http.DefaultTransport.(*http.Transport))
+					var body io.Reader
+					if tt.method == http.MethodPut {
+						body = bytes.NewReader(blob)
+					}
+					req, err := http.NewRequest(tt.method, srv.URL+"/v2/hauler/blobs/uploads/", body)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					resp, err := (&http.Client{Transport: rt}).Do(req)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					defer resp.Body.Close()
+					io.Copy(io.Discard, resp.Body)
+				}()
+			}
+			wg.Wait()
+
+			if waited := time.Since(start); waited < tt.wantWait {
+				t.Errorf("transfers took %s, want at least %s", waited, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestTransportOptions_Endpoints(t *testing.T) {
+	opts := content.TransportOptions{RegistryMirrors: []string{"http://mirror.example.com:5000"}}
+
+	tests := []struct {
+		name string
+		ref  string
+		want []string
+	}{
+		{
+			name: "should fall back to the registry mirrors for docker hub",
+			ref:  "busybox:1.36",
+			want: []string{"index.docker.io/library/busybox:1.36", "mirror.example.com:5000/library/busybox:1.36"},
+		},
+		{
+			name: "should pull other registries from themselves alone",
+			ref:  "ghcr.io/hauler/app:v1",
+			want: []string{"ghcr.io/hauler/app:v1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := opts.Endpoints(tt.ref)
+			if err != nil {
+				t.Fatalf("Endpoints() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Endpoints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !opts.PlainHTTP("mirror.example.com:5000") {
+		t.Errorf("PlainHTTP() should hold for an http mirror")
+	}
+}
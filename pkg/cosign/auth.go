@@ -0,0 +1,73 @@
+package cosign
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/google/go-containerregistry/pkg/authn"
+	gname "github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/rancherfederal/hauler/pkg/staging"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+// authEnv returns the environment of cosign commands on ref, and a func cleaning up after them
+//
+//	cosign only looks credentials up in the docker config, so when the keychain of the store resolves others for the
+//	registry of ref, from REGISTRY_AUTH_FILE, the registries config, or a cloud credential helper, they're written to a
+//	config of their own that DOCKER_CONFIG points cosign to, removed once ctx is done should the cleanup not get to it first.
+func authEnv(ctx context.Context, s *store.Layout, ref string) ([]string, func(), error) {
+	env := os.Environ()
+	noop := func() {}
+
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth, err := resolveAuth(s.TransportOptions().Keychain(), r.Context())
+	if err != nil {
+		return nil, nil, err
+	}
+	docker, err := resolveAuth(authn.DefaultKeychain, r.Context())
+	if err != nil {
+		return nil, nil, err
+	}
+	if *auth == (authn.AuthConfig{}) || *auth == *docker {
+		return env, noop, nil
+	}
+
+	dir, cleanup, err := staging.Dir(ctx, "", "cosign-auth")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := r.Context().RegistryStr()
+	if key == gname.DefaultRegistry {
+		key = authn.DefaultAuthKey
+	}
+	cf := configfile.New(filepath.Join(dir, config.ConfigFileName))
+	cf.AuthConfigs[key] = types.AuthConfig{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		Auth:          auth.Auth,
+		IdentityToken: auth.IdentityToken,
+		RegistryToken: auth.RegistryToken,
+	}
+	if err := cf.Save(); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return append(env, config.EnvOverrideConfigDir+"="+dir), cleanup, nil
+}
+
+func resolveAuth(kc authn.Keychain, target authn.Resource) (*authn.AuthConfig, error) {
+	auth, err := kc.Resolve(target)
+	if err != nil {
+		return nil, err
+	}
+	return auth.Authorization()
+}
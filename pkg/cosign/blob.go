@@ -0,0 +1,42 @@
+package cosign
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// SignBlob signs the file path with the cosign private key keyPath, writing the signature to sigPath
+//
+//	The signature is never uploaded to the transparency log, so files can be signed offline.  An encrypted key is
+//	decrypted with the password in COSIGN_PASSWORD, or one prompted for when it's unset.
+func SignBlob(ctx context.Context, keyPath string, path string, sigPath string) error {
+	cosignBinaryPath, err := getCosignPath()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, cosignBinaryPath, "sign-blob", "--yes", "--tlog-upload=false", "--key", keyPath, "--output-signature", sigPath, path)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error signing [%s]: %v, output: %s", path, err, output)
+	}
+	return nil
+}
+
+// VerifyBlob verifies the signature sigPath of the file path against the cosign public key keyPath
+//
+//	As with SignBlob, the transparency log isn't consulted.
+func VerifyBlob(ctx context.Context, keyPath string, path string, sigPath string) error {
+	cosignBinaryPath, err := getCosignPath()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, cosignBinaryPath, "verify-blob", "--insecure-ignore-tlog", "--key", keyPath, "--signature", sigPath, path)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error verifying signature of [%s]: %v, output: %s", path, err, output)
+	}
+	return nil
+}
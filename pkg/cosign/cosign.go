@@ -13,10 +13,12 @@ import (
 	"strings"
 	"time"
 
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
 	"github.com/rancherfederal/hauler/pkg/artifacts/image"
 	"github.com/rancherfederal/hauler/pkg/log"
 	"github.com/rancherfederal/hauler/pkg/store"
-	"oras.land/oras-go/pkg/content"
+	"github.com/rancherfederal/hauler/pkg/telemetry"
 )
 
 const maxRetries = 3
@@ -24,45 +26,59 @@ const retryDelay = time.Second * 5
 
 // VerifyFileSignature verifies the digital signature of a file using Sigstore/Cosign.
 func VerifySignature(ctx context.Context, s *store.Layout, keyPath string, ref string) error {
+	_, err := Verify(ctx, s, ref, VerifyOptions{Key: keyPath})
+	return err
+}
+
+// SaveImage saves image and any signatures/attestations to the store.
+//
+//	The pull itself is performed by the embedded cosign binary, which always identifies itself with its own User-Agent
+//	and offers no flag or environment variable to override it; only the multi-arch probe made here uses the store's.
+//	platform is a comma separated list of platforms to keep from a multi-arch image, all are kept when it's empty.
+//	cosign can only pull a single platform itself, so for several the whole index is pulled and then filtered down to
+//	the requested platforms with store.FilterPlatforms.
+func SaveImage(ctx context.Context, s *store.Layout, ref string, platform string) (err error) {
+	ctx, span := telemetry.Start(ctx, "cosign.SaveImage", telemetry.Reference(ref))
+	defer func() { telemetry.End(span, err) }()
+
+	l := log.FromContext(ctx)
+
+	platforms, err := store.ParsePlatforms(platform)
+	if err != nil {
+		return err
+	}
+
+	var isMultiArch bool
 	operation := func() error {
 		cosignBinaryPath, err := getCosignPath()
 		if err != nil {
 			return err
 		}
 
-		cmd := exec.Command(cosignBinaryPath, "verify", "--insecure-ignore-tlog", "--key", keyPath, ref)
-		output, err := cmd.CombinedOutput()
+		// check to see if the image is multi-arch
+		isMultiArch, err = image.IsMultiArchImage(ref, s.RemoteOptions()...)
 		if err != nil {
-			return fmt.Errorf("error verifying signature: %v, output: %s", err, output)
+			return err
 		}
+		l.Debugf("multi-arch image: %v", isMultiArch)
 
-		return nil
-	}
-
-	return RetryOperation(ctx, operation)
-}
-
-// SaveImage saves image and any signatures/attestations to the store.
-func SaveImage(ctx context.Context, s *store.Layout, ref string, platform string) error {
-	l := log.FromContext(ctx)
-	operation := func() error {
-		cosignBinaryPath, err := getCosignPath()
+		env, cleanup, err := authEnv(ctx, s, ref)
 		if err != nil {
 			return err
 		}
+		defer cleanup()
 
-		// check to see if the image is multi-arch
-		isMultiArch, err := image.IsMultiArchImage(ref)
+		tls, err := tlsArgs(s, ref)
 		if err != nil {
 			return err
 		}
-		l.Debugf("multi-arch image: %v", isMultiArch)
 
-		cmd := exec.Command(cosignBinaryPath, "save", ref, "--dir", s.Root)
+		cmd := exec.Command(cosignBinaryPath, append([]string{"save", ref, "--dir", s.Root}, tls...)...)
+		cmd.Env = env
 		// Conditionally add platform.
-		if platform != "" && isMultiArch {
+		if len(platforms) == 1 && isMultiArch {
 			l.Debugf("platform for image [%s]", platform)
-			cmd.Args = append(cmd.Args, "--platform", platform)
+			cmd.Args = append(cmd.Args, "--platform", strings.Trim(platform, ", "))
 		}
 
 		stdout, err := cmd.StdoutPipe()
@@ -107,86 +123,23 @@ func SaveImage(ctx context.Context, s *store.Layout, ref string, platform string
 		return nil
 	}
 
-	return RetryOperation(ctx, operation)
-}
-
-// LoadImage loads store to a remote registry.
-func LoadImages(ctx context.Context, s *store.Layout, registry string, ropts content.RegistryOptions) error {
-	l := log.FromContext(ctx)
-
-	cosignBinaryPath, err := getCosignPath()
-	if err != nil {
-		return err
-	}
-
-	cmd := exec.Command(cosignBinaryPath, "load", "--registry", registry, "--dir", s.Root)
-
-	// Conditionally add extra registry flags.
-	if ropts.Insecure {
-		cmd.Args = append(cmd.Args, "--allow-insecure-registry=true")
-	}
-	if ropts.PlainHTTP {
-		cmd.Args = append(cmd.Args, "--allow-http-registry=true")
-	}
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return err
-	}
-	// start the command after having set up the pipe
-	if err := cmd.Start(); err != nil {
-		return err
-	}
-
-	// read command's stdout line by line
-	output := bufio.NewScanner(stdout)
-	for output.Scan() {
-		l.Infof(output.Text()) // write each line to your log, or anything you need
-	}
-	if err := output.Err(); err != nil {
-		cmd.Wait()
-		return err
-	}
-
-	// read command's stderr line by line
-	errors := bufio.NewScanner(stderr)
-	for errors.Scan() {
-		l.Errorf(errors.Text()) // write each line to your log, or anything you need
-	}
-	if err := errors.Err(); err != nil {
-		cmd.Wait()
-		return err
-	}
-
-	// Wait for the command to finish
-	err = cmd.Wait()
-	if err != nil {
+	if err := RetryOperation(ctx, operation); err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// RegistryLogin - performs cosign login
-func RegistryLogin(ctx context.Context, s *store.Layout, registry string, ropts content.RegistryOptions) error {
-	log := log.FromContext(ctx)
-	cosignBinaryPath, err := getCosignPath()
-	if err != nil {
-		return err
+	if len(platforms) > 1 && isMultiArch {
+		l.Debugf("filtering image [%s] to platforms [%s]", ref, platform)
+		if _, err := s.FilterPlatforms(ctx, ref, platforms...); err != nil {
+			return err
+		}
 	}
 
-	cmd := exec.Command(cosignBinaryPath, "login", registry, "-u", ropts.Username, "-p", ropts.Password)
-	output, err := cmd.CombinedOutput()
+	// cosign writes the index itself, so the image is recorded in the audit log once it's in place
+	desc, err := s.Stat(ctx, ref)
 	if err != nil {
-		return fmt.Errorf("error logging into registry: %v, output: %s", err, output)
+		desc = ocispec.Descriptor{Annotations: map[string]string{ocispec.AnnotationRefName: ref}}
 	}
-	log.Infof(strings.Trim(string(output), "\n"))
-
-	return nil
+	return s.Audit(store.AuditAdd, desc)
 }
 
 func RetryOperation(ctx context.Context, operation func() error) error {
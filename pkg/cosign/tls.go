@@ -0,0 +1,34 @@
+package cosign
+
+import (
+	gname "github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+// tlsArgs returns the flags of cosign commands on ref trusting and presenting the certificates the store is
+// configured with for the registry of ref, and reaching it insecurely or over plain http when configured to
+func tlsArgs(s *store.Layout, ref string) ([]string, error) {
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	topts := s.TransportOptions()
+	host := r.Context().RegistryStr()
+	o, insecure := topts.HostTLS(host)
+
+	var args []string
+	if insecure {
+		args = append(args, "--allow-insecure-registry")
+	}
+	if topts.PlainHTTP(host) {
+		args = append(args, "--allow-http-registry")
+	}
+	if o.CAFile != "" {
+		args = append(args, "--registry-cacert", o.CAFile)
+	}
+	if o.CertFile != "" && o.KeyFile != "" {
+		args = append(args, "--registry-client-cert", o.CertFile, "--registry-client-key", o.KeyFile)
+	}
+	return args, nil
+}
@@ -0,0 +1,171 @@
+package cosign
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+// VerifyOptions are how the signature of an image is verified, either against a public key or keylessly against the
+// certificate fulcio issued its signer
+//
+//	Keyless verification requires the identity of the signer and the oidc issuer that vouched for it, each either
+//	exactly or as a regular expression, and checks the signature was recorded in the rekor transparency log.  Key based
+//	verification skips the transparency log, so images signed offline can be verified.
+type VerifyOptions struct {
+	Key string
+
+	CertIdentity         string
+	CertIdentityRegexp   string
+	CertOIDCIssuer       string
+	CertOIDCIssuerRegexp string
+}
+
+// Enabled reports whether any verification was asked for
+func (o VerifyOptions) Enabled() bool {
+	return o.Key != "" || o.Keyless()
+}
+
+// Keyless reports whether any of the keyless options are set
+func (o VerifyOptions) Keyless() bool {
+	return o.CertIdentity != "" || o.CertIdentityRegexp != "" || o.CertOIDCIssuer != "" || o.CertOIDCIssuerRegexp != ""
+}
+
+// Validate checks the options are either key based or complete keyless ones
+func (o VerifyOptions) Validate() error {
+	if !o.Keyless() {
+		return nil
+	}
+	if o.Key != "" {
+		return errors.New("verifying with a key and keylessly are mutually exclusive")
+	}
+	if o.CertIdentity == "" && o.CertIdentityRegexp == "" {
+		return errors.New("keyless verification requires a certificate identity or identity regexp")
+	}
+	if o.CertOIDCIssuer == "" && o.CertOIDCIssuerRegexp == "" {
+		return errors.New("keyless verification requires a certificate oidc issuer or issuer regexp")
+	}
+	return nil
+}
+
+// Verifier describes what signatures were verified against, for recording alongside the verified content
+//
+//	A key is described by the digest of its contents, so the record doesn't depend on where the key happened to be
+//	kept.  Keys that can't be read as a file, such as kms uris, are described by their uri.
+func (o VerifyOptions) Verifier() string {
+	if !o.Keyless() {
+		data, err := os.ReadFile(o.Key)
+		if err != nil {
+			return "key " + o.Key
+		}
+		return fmt.Sprintf("key sha256:%x", sha256.Sum256(data))
+	}
+
+	identity := o.CertIdentity
+	if identity == "" {
+		identity = o.CertIdentityRegexp
+	}
+	issuer := o.CertOIDCIssuer
+	if issuer == "" {
+		issuer = o.CertOIDCIssuerRegexp
+	}
+	return fmt.Sprintf("keyless %s %s", identity, issuer)
+}
+
+func (o VerifyOptions) args() []string {
+	if !o.Keyless() {
+		return []string{"--insecure-ignore-tlog", "--key", o.Key}
+	}
+
+	var args []string
+	if o.CertIdentity != "" {
+		args = append(args, "--certificate-identity", o.CertIdentity)
+	}
+	if o.CertIdentityRegexp != "" {
+		args = append(args, "--certificate-identity-regexp", o.CertIdentityRegexp)
+	}
+	if o.CertOIDCIssuer != "" {
+		args = append(args, "--certificate-oidc-issuer", o.CertOIDCIssuer)
+	}
+	if o.CertOIDCIssuerRegexp != "" {
+		args = append(args, "--certificate-oidc-issuer-regexp", o.CertOIDCIssuerRegexp)
+	}
+	return args
+}
+
+// verifiedPayload is the part of the simple signing payload cosign prints for every verified signature that holds the
+// digest it signed
+type verifiedPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// Verify verifies the signature of ref, returning the digest of the manifest the signature was verified for
+//
+//	Verification fails closed: an image without a signature, or whose signature doesn't verify, is an error.  Any tag
+//	of ref may move after verification, so the returned digest is what was actually verified.
+func Verify(ctx context.Context, s *store.Layout, ref string, o VerifyOptions) (digest.Digest, error) {
+	if err := o.Validate(); err != nil {
+		return "", err
+	}
+
+	var verified digest.Digest
+	operation := func() error {
+		cosignBinaryPath, err := getCosignPath()
+		if err != nil {
+			return err
+		}
+
+		env, cleanup, err := authEnv(ctx, s, ref)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		tls, err := tlsArgs(s, ref)
+		if err != nil {
+			return err
+		}
+
+		args := append([]string{"verify", "--output", "json"}, o.args()...)
+		args = append(args, tls...)
+		cmd := exec.Command(cosignBinaryPath, append(args, ref)...)
+		cmd.Env = env
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("error verifying signature: %v, output: %s", err, stderr.Bytes())
+		}
+
+		var payloads []verifiedPayload
+		if err := json.Unmarshal(stdout.Bytes(), &payloads); err != nil {
+			return fmt.Errorf("error reading verified signatures: %v", err)
+		}
+		if len(payloads) == 0 {
+			return fmt.Errorf("no signatures verified for [%s]", ref)
+		}
+		verified, err = digest.Parse(payloads[0].Critical.Image.DockerManifestDigest)
+		if err != nil {
+			return fmt.Errorf("error reading verified digest: %v", err)
+		}
+		return nil
+	}
+
+	if err := RetryOperation(ctx, operation); err != nil {
+		return "", err
+	}
+	return verified, nil
+}
@@ -1,19 +1,46 @@
 package layer
 
 import (
+	"encoding/hex"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 )
 
 type fs struct {
 	root string
+
+	// locks holds a *sync.Mutex per digest, serializing writes of the same blob into the cache
+	locks sync.Map
+
+	// maxSize bounds the size of the cache, 0 leaves it unbounded
+	maxSize int64
+	evictMu sync.Mutex
+}
+
+// CacheOption configures a filesystem cache
+type CacheOption func(*fs)
+
+// WithMaxSize bounds the cache to n bytes, the least recently used layers are evicted once a new one takes it past n
+func WithMaxSize(n int64) CacheOption {
+	return func(f *fs) {
+		if n > 0 {
+			f.maxSize = n
+		}
+	}
 }
 
-func NewFilesystemCache(root string) Cache {
-	return &fs{root: root}
+func NewFilesystemCache(root string, opts ...CacheOption) Cache {
+	f := &fs{root: root}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
 func (f *fs) Put(l v1.Layer) (v1.Layer, error) {
@@ -27,7 +54,7 @@ func (f *fs) Put(l v1.Layer) (v1.Layer, error) {
 	}
 	return &cachedLayer{
 		Layer:  l,
-		root:   f.root,
+		fs:     f,
 		digest: digest,
 		diffID: diffID,
 	}, nil
@@ -39,6 +66,11 @@ func (f *fs) Get(h v1.Hash) (v1.Layer, error) {
 	if os.IsNotExist(err) {
 		return nil, ErrLayerNotFound
 	}
+	if err == nil {
+		// the modification time records when a layer was last used, it's what eviction goes by
+		now := time.Now()
+		os.Chtimes(layerpath(f.root, h), now, now)
+	}
 	return l, err
 }
 
@@ -48,71 +80,154 @@ func (f *fs) open(h v1.Hash) Opener {
 	}
 }
 
-type cachedLayer struct {
-	v1.Layer
-
-	root           string
-	digest, diffID v1.Hash
+func (f *fs) lock(h v1.Hash) func() {
+	mu, _ := f.locks.LoadOrStore(h.String(), &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
 }
 
-func (l *cachedLayer) create(h v1.Hash) (io.WriteCloser, error) {
-	lp := layerpath(l.root, h)
+// tee returns rc, writing everything read through it into the cache as h
+//
+//	Content is written to a temporary file and only renamed into place once rc has been read in full and matches h, so
+//	concurrent readers never see a partial blob and an abandoned or corrupt read never poisons the cache.
+func (f *fs) tee(rc io.ReadCloser, h v1.Hash) (io.ReadCloser, error) {
+	lp := layerpath(f.root, h)
+	if _, err := os.Stat(lp); err == nil {
+		return rc, nil
+	}
+
 	if err := os.MkdirAll(filepath.Dir(lp), os.ModePerm); err != nil {
+		rc.Close()
 		return nil, err
 	}
-	return os.Create(lp)
+	return newCacheWriter(rc, filepath.Dir(lp), h, f.commit)
 }
 
-func (l *cachedLayer) Compressed() (io.ReadCloser, error) {
-	f, err := l.create(l.digest)
+// newCacheWriter returns rc, copying everything read through it into a temporary file in dir handed to commit once rc
+// has been read in full and matches h
+func newCacheWriter(rc io.ReadCloser, dir string, h v1.Hash, commit func(tmp string, h v1.Hash) error) (io.ReadCloser, error) {
+	tmp, err := os.CreateTemp(dir, h.Hex+".*.tmp")
 	if err != nil {
-		return nil, nil
+		rc.Close()
+		return nil, err
 	}
-	rc, err := l.Layer.Compressed()
+	hasher, err := v1.Hasher(h.Algorithm)
 	if err != nil {
+		rc.Close()
+		tmp.Close()
+		os.Remove(tmp.Name())
 		return nil, err
 	}
-	return &readcloser{
-		t:      io.TeeReader(rc, f),
-		closes: []func() error{rc.Close, f.Close},
+
+	return &cacheWriter{
+		ReadCloser: rc,
+		commit:     commit,
+		h:          h,
+		tmp:        tmp,
+		hasher:     hasher,
 	}, nil
 }
 
-func (l *cachedLayer) Uncompressed() (io.ReadCloser, error) {
-	f, err := l.create(l.diffID)
+// commit moves a fully written temporary file into place as h, unless another writer got there first, then evicts
+// what no longer fits
+func (f *fs) commit(tmp string, h v1.Hash) error {
+	unlock := f.lock(h)
+	lp := layerpath(f.root, h)
+	var err error
+	if _, serr := os.Stat(lp); serr == nil {
+		err = os.Remove(tmp)
+	} else {
+		err = os.Rename(tmp, lp)
+	}
+	unlock()
+	if err != nil {
+		return err
+	}
+	return f.evict()
+}
+
+// evict removes the least recently used layers until the cache fits its max size
+func (f *fs) evict() error {
+	if f.maxSize == 0 {
+		return nil
+	}
+	f.evictMu.Lock()
+	defer f.evictMu.Unlock()
+
+	_, err := Prune(f.root, PruneOptions{MaxSize: f.maxSize})
+	return err
+}
+
+type cachedLayer struct {
+	v1.Layer
+
+	fs             *fs
+	digest, diffID v1.Hash
+}
+
+func (l *cachedLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Compressed()
 	if err != nil {
 		return nil, err
 	}
+	return l.fs.tee(rc, l.digest)
+}
+
+func (l *cachedLayer) Uncompressed() (io.ReadCloser, error) {
 	rc, err := l.Layer.Uncompressed()
 	if err != nil {
 		return nil, err
 	}
-	return &readcloser{
-		t:      io.TeeReader(rc, f),
-		closes: []func() error{rc.Close, f.Close},
-	}, nil
+	return l.fs.tee(rc, l.diffID)
 }
 
-func layerpath(root string, h v1.Hash) string {
-	return filepath.Join(root, h.Algorithm, h.Hex)
-}
+// cacheWriter copies everything read from the underlying reader into a temporary cache file, committing it on Close
+type cacheWriter struct {
+	io.ReadCloser
 
-type readcloser struct {
-	t      io.Reader
-	closes []func() error
-}
+	// commit takes the temporary file once it's been read in full and matches h
+	commit func(tmp string, h v1.Hash) error
+	h      v1.Hash
+	tmp    *os.File
+	hasher hash.Hash
 
-func (rc *readcloser) Read(b []byte) (int, error) {
-	return rc.t.Read(b)
+	eof    bool
+	failed bool
 }
 
-func (rc *readcloser) Close() error {
-	var err error
-	for _, c := range rc.closes {
-		lastErr := c()
-		if err == nil {
-			err = lastErr
+func (w *cacheWriter) Read(b []byte) (int, error) {
+	n, err := w.ReadCloser.Read(b)
+	if n > 0 && !w.failed {
+		// a failure to cache never fails the read, the blob just isn't cached
+		if _, werr := w.tmp.Write(b[:n]); werr != nil {
+			w.failed = true
 		}
+		w.hasher.Write(b[:n])
+	}
+	if err == io.EOF {
+		w.eof = true
+	}
+	return n, err
+}
+
+func (w *cacheWriter) Close() error {
+	err := w.ReadCloser.Close()
+	if cerr := w.tmp.Close(); cerr != nil {
+		w.failed = true
+	}
+
+	got := v1.Hash{Algorithm: w.h.Algorithm, Hex: hex.EncodeToString(w.hasher.Sum(nil))}
+	if !w.eof || w.failed || got != w.h {
+		os.Remove(w.tmp.Name())
+		return err
+	}
+
+	if cerr := w.commit(w.tmp.Name(), w.h); cerr != nil && err == nil {
+		err = cerr
 	}
 	return err
 }
+
+func layerpath(root string, h v1.Hash) string {
+	return filepath.Join(root, h.Algorithm, h.Hex)
+}
@@ -0,0 +1,110 @@
+package layer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Entry is a layer held by a filesystem cache
+type Entry struct {
+	Digest   v1.Hash
+	Size     int64
+	LastUsed time.Time
+}
+
+// Entries returns the layers of the filesystem cache at root, least recently used first
+//
+//	A layer's modification time is when it was last written or read from the cache.  Temporary files of layers still
+//	being written are left out.
+func Entries(root string) ([]Entry, error) {
+	algs, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, alg := range algs {
+		if !alg.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(root, alg.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			h, err := v1.NewHash(alg.Name() + ":" + file.Name())
+			if err != nil || !file.Type().IsRegular() {
+				continue
+			}
+			fi, err := file.Info()
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, Entry{Digest: h, Size: fi.Size(), LastUsed: fi.ModTime()})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].LastUsed.Equal(entries[j].LastUsed) {
+			return entries[i].LastUsed.Before(entries[j].LastUsed)
+		}
+		return entries[i].Digest.String() < entries[j].Digest.String()
+	})
+	return entries, nil
+}
+
+// PruneOptions selects the layers Prune removes from a filesystem cache
+type PruneOptions struct {
+	// All removes every layer
+	All bool
+
+	// OlderThan removes the layers not used within it, 0 keeps layers whatever their age
+	OlderThan time.Duration
+
+	// MaxSize removes the least recently used layers until the cache holds at most MaxSize bytes, 0 leaves it unbounded
+	MaxSize int64
+
+	// DryRun only returns the layers that would be removed
+	DryRun bool
+}
+
+// Prune removes the layers of the filesystem cache at root selected by o, returning them
+func Prune(root string, o PruneOptions) ([]Entry, error) {
+	entries, err := Entries(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	cutoff := time.Now().Add(-o.OlderThan)
+	var pruned []Entry
+	for _, e := range entries {
+		expired := o.OlderThan > 0 && e.LastUsed.Before(cutoff)
+		if !o.All && !expired && (o.MaxSize == 0 || total <= o.MaxSize) {
+			continue
+		}
+
+		if !o.DryRun {
+			if err := os.Remove(layerpath(root, e.Digest)); err != nil && !os.IsNotExist(err) {
+				return pruned, err
+			}
+		}
+		total -= e.Size
+		pruned = append(pruned, e)
+	}
+	return pruned, nil
+}
@@ -0,0 +1,136 @@
+package layer_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/rancherfederal/hauler/pkg/layer"
+)
+
+// fill caches a layer of size bytes of b in c, last used age ago
+func fill(t *testing.T, root string, c layer.Cache, b byte, size int, age time.Duration) v1.Hash {
+	t.Helper()
+	l, err := c.Put(static.NewLayer(bytes.Repeat([]byte{b}, size), types.OCILayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := l.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, rc); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := l.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := time.Now().Add(-age)
+	if err := os.Chtimes(filepath.Join(root, h.Algorithm, h.Hex), used, used); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name string
+		opts layer.PruneOptions
+		want []int
+	}{
+		{
+			name: "should remove the layers not used recently",
+			opts: layer.PruneOptions{OlderThan: 36 * time.Hour},
+			want: []int{0, 1},
+		},
+		{
+			name: "should remove the least recently used layers until the cache fits",
+			opts: layer.PruneOptions{MaxSize: 150},
+			want: []int{0, 1},
+		},
+		{
+			name: "should remove every layer",
+			opts: layer.PruneOptions{All: true},
+			want: []int{0, 1, 2},
+		},
+		{
+			name: "should remove nothing on a dry run",
+			opts: layer.PruneOptions{All: true, DryRun: true},
+			want: []int{0, 1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			c := layer.NewFilesystemCache(root)
+			hs := []v1.Hash{
+				fill(t, root, c, 'a', 100, 72*time.Hour),
+				fill(t, root, c, 'b', 100, 48*time.Hour),
+				fill(t, root, c, 'c', 100, time.Hour),
+			}
+
+			pruned, err := layer.Prune(root, tt.opts)
+			if err != nil {
+				t.Fatalf("Prune() error = %v", err)
+			}
+			if len(pruned) != len(tt.want) {
+				t.Fatalf("Prune() removed [%d] layers, want [%d]", len(pruned), len(tt.want))
+			}
+			for i, w := range tt.want {
+				if pruned[i].Digest != hs[w] {
+					t.Errorf("Prune()[%d] = %s, want %s", i, pruned[i].Digest, hs[w])
+				}
+			}
+
+			entries, err := layer.Entries(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := len(hs) - len(tt.want)
+			if tt.opts.DryRun {
+				want = len(hs)
+			}
+			if len(entries) != want {
+				t.Errorf("Entries() = [%d] layers after pruning, want [%d]", len(entries), want)
+			}
+		})
+	}
+}
+
+func TestFilesystemCache_MaxSize(t *testing.T) {
+	root := t.TempDir()
+	c := layer.NewFilesystemCache(root, layer.WithMaxSize(250))
+
+	oldest := fill(t, root, c, 'a', 100, 3*time.Hour)
+	used := fill(t, root, c, 'b', 100, 2*time.Hour)
+
+	// reading a layer back marks it used, so the other is evicted first
+	if _, err := c.Get(used); err != nil {
+		t.Fatal(err)
+	}
+	newest := fill(t, root, c, 'c', 100, 0)
+
+	entries, err := layer.Entries(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[v1.Hash]bool)
+	for _, e := range entries {
+		got[e.Digest] = true
+	}
+	if got[oldest] || !got[used] || !got[newest] {
+		t.Errorf("cache holds %v, want [%s] evicted and [%s, %s] kept", entries, oldest, used, newest)
+	}
+}
@@ -0,0 +1,86 @@
+package layer
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+type registry struct {
+	repo gname.Repository
+	opts []remote.Option
+
+	// unreachable is set once the registry couldn't be reached, so every other layer doesn't wait on it in turn
+	unreachable atomic.Bool
+}
+
+// NewRegistryCache returns a Cache holding layers as the blobs of the repository repo, reached with opts, so hosts
+// pointed at the same repository share the layers any of them pulled
+//
+//	repo can be any registry, such as a store served by 'hauler store serve registry'.  A layer missing from repo is
+//	pulled from its source, and pushed to repo once read in full and matching its digest.  A registry that can't be
+//	reached or refuses a push never fails a pull, the layer just isn't cached.
+func NewRegistryCache(repo gname.Repository, opts ...remote.Option) Cache {
+	return &registry{repo: repo, opts: opts}
+}
+
+func (r *registry) Get(h v1.Hash) (v1.Layer, error) {
+	if r.unreachable.Load() {
+		return nil, ErrLayerNotFound
+	}
+
+	// an unreachable cache is a miss rather than a failure, the layer is pulled from its source instead
+	l, err := remote.Layer(r.repo.Digest(h.String()), r.opts...)
+	if err != nil {
+		r.unreachable.Store(true)
+		return nil, ErrLayerNotFound
+	}
+	if ok, err := partial.Exists(l); err != nil || !ok {
+		return nil, ErrLayerNotFound
+	}
+	return l, nil
+}
+
+func (r *registry) Put(l v1.Layer) (v1.Layer, error) {
+	if r.unreachable.Load() {
+		return l, nil
+	}
+	return &pushedLayer{Layer: l, r: r}, nil
+}
+
+// push uploads the fully read layer held by the temporary file tmp to the repository, then removes tmp
+func (r *registry) push(tmp string, h v1.Hash) error {
+	defer os.Remove(tmp)
+
+	// caching is best effort, a layer that can't be pushed is only missed by the next pull
+	l, err := FromOpener(func() (io.ReadCloser, error) { return os.Open(tmp) })
+	if err != nil {
+		return nil
+	}
+	remote.WriteLayer(r.repo, l, r.opts...)
+	return nil
+}
+
+// pushedLayer is a layer missing from a registry cache, pushed to it once read
+type pushedLayer struct {
+	v1.Layer
+
+	r *registry
+}
+
+func (l *pushedLayer) Compressed() (io.ReadCloser, error) {
+	h, err := l.Layer.Digest()
+	if err != nil {
+		return nil, err
+	}
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	return newCacheWriter(rc, "", h, l.r.push)
+}
@@ -0,0 +1,98 @@
+package layer_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/rancherfederal/hauler/pkg/layer"
+)
+
+func TestRegistryCache(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	unreachable := httptest.NewServer(nil)
+	unreachable.Close()
+
+	tests := []struct {
+		name       string
+		host       string
+		wantCached bool
+	}{
+		{
+			name:       "should push a layer once read and serve it after",
+			host:       srv.URL,
+			wantCached: true,
+		},
+		{
+			name: "should pull from the source when the cache can't be reached",
+			host: unreachable.URL,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := name.NewRepository(strings.TrimPrefix(tt.host, "http://") + "/hauler/cache")
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := layer.NewRegistryCache(repo)
+
+			data := []byte("shared layer " + tt.name)
+			src := static.NewLayer(data, types.OCILayer)
+			h, err := src.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.Get(h); !errors.Is(err, layer.ErrLayerNotFound) {
+				t.Fatalf("Get() error = %v, want %v", err, layer.ErrLayerNotFound)
+			}
+
+			l, err := c.Put(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rc, err := l.Compressed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := rc.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("Compressed() = %q, want %q", got, data)
+			}
+
+			cached, err := c.Get(h)
+			if !tt.wantCached {
+				if !errors.Is(err, layer.ErrLayerNotFound) {
+					t.Errorf("Get() error = %v, want %v", err, layer.ErrLayerNotFound)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			rc, err = cached.Compressed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("cached Compressed() = %q (%v), want %q", got, err, data)
+			}
+		})
+	}
+}
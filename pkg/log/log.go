@@ -2,16 +2,18 @@ package log
 
 import (
 	"context"
+	"fmt"
 	"io"
-	"os"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 )
 
 // Logger provides an interface for all used logger features regardless of logging backend
 type Logger interface {
 	SetLevel(string)
+	SetFormat(string) error
 	With(Fields) *logger
 	WithContext(context.Context) context.Context
 
@@ -26,19 +28,54 @@ type logger struct {
 }
 
 // Fields defines fields to attach to log msgs
-type Fields map[string]string
+type Fields map[string]interface{}
+
+// Names of the fields attached to the outcome of an artifact, so every command records them the same way
+const (
+	FieldReference = "reference"
+	FieldDigest    = "digest"
+	FieldBytes     = "bytes"
+	FieldDuration  = "duration"
+)
+
+// Formats of the log output
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// jsonFormat switches every Logger between the text and json formats, like the level it's global
+var jsonFormat atomic.Bool
 
 // NewLogger returns a new Logger
 func NewLogger(out io.Writer) Logger {
     customTimeFormat := "2006-01-02 15:04:05"
-    zerolog.TimeFieldFormat = customTimeFormat
-    output := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: customTimeFormat}
-    l := log.Output(output)
+    // timestamps are recorded in full and only shortened for display, so json entries carry the date and timezone
+    zerolog.TimeFieldFormat = time.RFC3339
+    zerolog.DurationFieldUnit = time.Second
+    output := &formatWriter{
+        console: zerolog.ConsoleWriter{Out: out, TimeFormat: customTimeFormat},
+        out:     out,
+    }
+    // a logger of its own, the global one of zerolog already stamps entries with the time
     return &logger{
-        zl: l.With().Timestamp().Logger(),
+        zl: zerolog.New(output).With().Timestamp().Logger(),
     }
 }
 
+// formatWriter writes the json entries of zerolog as they are in FormatJSON, and rendered for people otherwise
+type formatWriter struct {
+	console zerolog.ConsoleWriter
+	out     io.Writer
+}
+
+func (w *formatWriter) Write(p []byte) (int, error) {
+	if jsonFormat.Load() {
+		return w.out.Write(p)
+	}
+	return w.console.Write(p)
+}
+
 // FromContext returns a Logger from a context if it exists
 func FromContext(ctx context.Context) Logger {
 	zl := zerolog.Ctx(ctx)
@@ -47,6 +84,15 @@ func FromContext(ctx context.Context) Logger {
 	}
 }
 
+// Quiet returns a copy of ctx whose Logger only logs warnings and errors, for work whose progress is logged again
+// later, unless debug logging is enabled
+func Quiet(ctx context.Context) context.Context {
+	if zerolog.GlobalLevel() <= zerolog.DebugLevel {
+		return ctx
+	}
+	return zerolog.Ctx(ctx).Level(zerolog.WarnLevel).WithContext(ctx)
+}
+
 // SetLevel sets the global log level
 func (l *logger) SetLevel(level string) {
 	lvl, err := zerolog.ParseLevel(level)
@@ -57,6 +103,19 @@ func (l *logger) SetLevel(level string) {
 	zerolog.SetGlobalLevel(lvl)
 }
 
+// SetFormat sets the global log format, FormatText or FormatJSON
+func (l *logger) SetFormat(format string) error {
+	switch format {
+	case FormatText, "":
+		jsonFormat.Store(false)
+	case FormatJSON:
+		jsonFormat.Store(true)
+	default:
+		return fmt.Errorf("unsupported log format [%s], must be one of text or json", format)
+	}
+	return nil
+}
+
 // WithContext stores the Logger in the given context and returns it
 func (l *logger) WithContext(ctx context.Context) context.Context {
 	return l.zl.WithContext(ctx)
@@ -64,10 +123,7 @@ func (l *logger) WithContext(ctx context.Context) context.Context {
 
 // With attaches Fields to a Logger
 func (l *logger) With(fields Fields) *logger {
-	zl := l.zl.With()
-	for k, v := range fields {
-		zl = zl.Str(k, v)
-	}
+	zl := l.zl.With().Fields(map[string]interface{}(fields))
 
 	return &logger{
 		zl: zl.Logger(),
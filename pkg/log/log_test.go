@@ -0,0 +1,85 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+func TestLogger_SetFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		wantErr bool
+		check   func(t *testing.T, out string)
+	}{
+		{
+			name:   "json",
+			format: log.FormatJSON,
+			check: func(t *testing.T, out string) {
+				var entry map[string]interface{}
+				if err := json.Unmarshal([]byte(out), &entry); err != nil {
+					t.Fatalf("entry %q is not json: %v", out, err)
+				}
+				want := map[string]interface{}{
+					"level":            "info",
+					"message":          "copied [hauler/f.txt:latest]",
+					log.FieldReference: "hauler/f.txt:latest",
+					log.FieldDigest:    "sha256:bb29f9a849d6a3b7013e729ad705b2145d84c5d189e884fbd83a7d7884a0e565",
+					log.FieldBytes:     float64(499),
+					log.FieldDuration:  1.5,
+				}
+				for k, v := range want {
+					if entry[k] != v {
+						t.Errorf("entry[%s] = %v, want %v", k, entry[k], v)
+					}
+				}
+				if _, err := time.Parse(time.RFC3339, entry["time"].(string)); err != nil {
+					t.Errorf("entry time [%v] is not RFC3339: %v", entry["time"], err)
+				}
+			},
+		},
+		{
+			name:   "text",
+			format: log.FormatText,
+			check: func(t *testing.T, out string) {
+				if strings.HasPrefix(out, "{") || !strings.Contains(out, "copied [hauler/f.txt:latest]") || !strings.Contains(out, "499") {
+					t.Errorf("text entry = %q, want the message and its fields rendered", out)
+				}
+			},
+		},
+		{
+			name:    "unsupported",
+			format:  "xml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := log.NewLogger(&buf)
+			l.SetLevel("info")
+
+			err := l.SetFormat(tt.format)
+			defer l.SetFormat(log.FormatText)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			l.With(log.Fields{
+				log.FieldReference: "hauler/f.txt:latest",
+				log.FieldDigest:    "sha256:bb29f9a849d6a3b7013e729ad705b2145d84c5d189e884fbd83a7d7884a0e565",
+				log.FieldBytes:     int64(499),
+				log.FieldDuration:  1500 * time.Millisecond,
+			}).Infof("copied [%s]", "hauler/f.txt:latest")
+			tt.check(t, strings.TrimSpace(buf.String()))
+		})
+	}
+}
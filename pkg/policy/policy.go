@@ -0,0 +1,148 @@
+// Package policy enforces the organizational rules content has to follow to be admitted into a store
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/mitchellh/go-homedir"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rancherfederal/hauler/pkg/cosign"
+)
+
+// ErrViolation is wrapped by every error reporting content that violates a policy
+var ErrViolation = errors.New("policy violation")
+
+// Policy is the rules images have to follow to be added to a store
+//
+//	Each rule is optional, and an empty policy admits everything.  A nil *Policy is an empty policy, so callers don't
+//	have to check whether one was configured.
+type Policy struct {
+	// AllowedRegistries are the only registries images may come from, optionally narrowed down to a repository path
+	// prefix, i.e. 'docker.io/rancher' or '*.example.com'.  docker.io and index.docker.io are the same registry.
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+
+	// DeniedTags are glob patterns of tags images may not be added by, i.e. 'latest' or '*-rc*'.  An image referenced
+	// without a tag is referenced by latest.
+	DeniedTags []string `json:"deniedTags,omitempty"`
+
+	// RequiredKeys are paths to cosign public keys, one of which every image has to be signed by.  Relative paths are
+	// relative to the policy file.
+	RequiredKeys []string `json:"requiredKeys,omitempty"`
+}
+
+// Load reads and validates the policy file at path
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("reading policy [%s]: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy [%s]: %w", path, err)
+	}
+
+	for i, k := range p.RequiredKeys {
+		if k, err = homedir.Expand(k); err != nil {
+			return nil, err
+		}
+		if !filepath.IsAbs(k) {
+			k = filepath.Join(filepath.Dir(path), k)
+		}
+		p.RequiredKeys[i] = k
+	}
+	return &p, nil
+}
+
+// Validate checks every pattern of the policy is well formed
+func (p *Policy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, r := range p.AllowedRegistries {
+		host, _, _ := strings.Cut(r, "/")
+		if _, err := path.Match(host, ""); err != nil || host == "" {
+			return fmt.Errorf("allowed registry [%s] is not a valid pattern", r)
+		}
+	}
+	for _, t := range p.DeniedTags {
+		if _, err := path.Match(t, ""); err != nil {
+			return fmt.Errorf("denied tag [%s] is not a valid pattern", t)
+		}
+	}
+	return nil
+}
+
+// Check reports whether the image ref may be added under the policy, returning an error wrapping ErrViolation if not
+//
+//	Signatures aren't checked, as that requires fetching them; see RequiredKeys and Trusts.
+func (p *Policy) Check(ref string) error {
+	if p == nil {
+		return nil
+	}
+
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		return err
+	}
+
+	if len(p.AllowedRegistries) > 0 && !p.allowedRegistry(r.Context()) {
+		return fmt.Errorf("registry [%s] of image [%s] is not allowed: %w", r.Context().RegistryStr(), ref, ErrViolation)
+	}
+
+	if t, ok := r.(gname.Tag); ok {
+		for _, pattern := range p.DeniedTags {
+			if ok, _ := path.Match(pattern, t.TagStr()); ok {
+				return fmt.Errorf("tag [%s] of image [%s] is denied: %w", t.TagStr(), ref, ErrViolation)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Policy) allowedRegistry(repo gname.Repository) bool {
+	registry := repo.RegistryStr()
+	for _, allowed := range p.AllowedRegistries {
+		host, prefix, _ := strings.Cut(allowed, "/")
+		// normalizes docker.io, the same as the registry of references
+		if reg, err := gname.NewRegistry(host); err == nil && !strings.ContainsAny(host, "*?[") {
+			host = reg.RegistryStr()
+		}
+		if ok, _ := path.Match(host, registry); !ok {
+			continue
+		}
+		if prefix == "" || repo.RepositoryStr() == prefix || strings.HasPrefix(repo.RepositoryStr(), prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresSignature reports whether images have to be signed by one of the policy's keys
+func (p *Policy) RequiresSignature() bool {
+	return p != nil && len(p.RequiredKeys) > 0
+}
+
+// Trusts reports whether the key described by verifier, as described by cosign.VerifyOptions.Verifier, is one of the
+// keys the policy requires
+func (p *Policy) Trusts(verifier string) bool {
+	if p == nil {
+		return false
+	}
+	for _, k := range p.RequiredKeys {
+		if verifier == (cosign.VerifyOptions{Key: k}).Verifier() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package policy_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancherfederal/hauler/pkg/cosign"
+	"github.com/rancherfederal/hauler/pkg/policy"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	p := &policy.Policy{
+		AllowedRegistries: []string{"docker.io/rancher", "docker.io/library", "*.example.com", "ghcr.io"},
+		DeniedTags:        []string{"latest", "*-rc*"},
+	}
+
+	tests := []struct {
+		ref     string
+		wantErr bool
+	}{
+		{ref: "rancher/rancher:v2.8.0"},
+		{ref: "index.docker.io/rancher/fleet:v0.9.0"},
+		{ref: "alpine:3.18"},
+		{ref: "registry.example.com/team/app:1.0"},
+		{ref: "ghcr.io/any/thing:1.0"},
+		{ref: "ghcr.io/any/thing@sha256:48d9183eb12a05c99bcc0bf44a003607b8e941e1d4f41f9ad12bdcc4b5672f86"},
+		{ref: "bitnami/nginx:1.25", wantErr: true},
+		{ref: "docker.io/rancherlabs/k3s:v1.28", wantErr: true},
+		{ref: "quay.io/coreos/etcd:v3.5", wantErr: true},
+		{ref: "example.com/app:1.0", wantErr: true},
+		{ref: "rancher/rancher", wantErr: true},
+		{ref: "rancher/rancher:latest", wantErr: true},
+		{ref: "rancher/rancher:v2.9.0-rc1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			err := p.Check(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, policy.ErrViolation) {
+				t.Errorf("Check() error = %v, want a policy violation", err)
+			}
+		})
+	}
+
+	var empty *policy.Policy
+	if err := empty.Check("anything:latest"); err != nil {
+		t.Errorf("nil policy Check() = %v, want nil", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "cosign.pub")
+	if err := os.WriteFile(key, []byte("public key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "valid", data: "allowedRegistries: [docker.io]\ndeniedTags: [latest]\nrequiredKeys: [cosign.pub]\n"},
+		{name: "unknown field", data: "allowedRegistry: [docker.io]\n", wantErr: true},
+		{name: "bad pattern", data: "deniedTags: ['[']\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".yaml")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			p, err := policy.Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !p.RequiresSignature() || p.RequiredKeys[0] != key {
+				t.Errorf("Load() keys = %v, want [%s]", p.RequiredKeys, key)
+			}
+			if !p.Trusts(cosign.VerifyOptions{Key: key}.Verifier()) {
+				t.Errorf("Trusts() = false for a required key")
+			}
+			if p.Trusts(cosign.VerifyOptions{Key: filepath.Join(dir, "valid.yaml")}.Verifier()) {
+				t.Errorf("Trusts() = true for a key the policy doesn't require")
+			}
+		})
+	}
+}
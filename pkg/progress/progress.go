@@ -0,0 +1,429 @@
+package progress
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+// Mode selects how a Display reports the progress of an operation
+type Mode string
+
+const (
+	// ModeAuto draws bars when the display writes to a terminal, and logs periodic lines otherwise
+	ModeAuto Mode = "auto"
+
+	// ModeBar draws a bar for every artifact being transferred, along with one for the whole operation
+	ModeBar Mode = "bar"
+
+	// ModeLog logs the progress of the operation and its artifacts periodically
+	ModeLog Mode = "log"
+
+	// ModeNone reports nothing
+	ModeNone Mode = "none"
+)
+
+const (
+	defaultRedrawInterval = 200 * time.Millisecond
+	defaultLogInterval    = 10 * time.Second
+
+	// maxBars bounds the artifacts drawn at once, the rest are summed up on a single line
+	maxBars  = 8
+	barWidth = 24
+	maxName  = 48
+)
+
+// ParseMode returns the Mode named s
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeAuto, ModeBar, ModeLog, ModeNone:
+		return m, nil
+	}
+	return "", fmt.Errorf("unsupported progress [%s], must be one of auto, bar, log, or none", s)
+}
+
+// Display reports the bytes transferred by an operation, per artifact and in total, with their rate and ETA
+//
+//	A Display sits in front of the output the logger writes to, so log lines written while bars are drawn are printed
+//	above the bars rather than torn through them.  Artifacts are only tracked between Begin and the func it returns,
+//	so operations that don't ask for progress report nothing.  A nil Display, and the nil Tasks it hands out, do nothing.
+type Display struct {
+	out         io.Writer
+	fd          int
+	tty         bool
+	logInterval time.Duration
+
+	mu       sync.Mutex
+	mode     Mode
+	title    string
+	start    time.Time
+	tasks    []*Task
+	total    int64
+	unsized  int
+	count    int
+	finished int
+	drawn    int
+	stop     chan struct{}
+	stopped  chan struct{}
+
+	// transferred is the bytes of every artifact, updated as they're written without taking mu
+	transferred int64
+}
+
+// Option configures a Display
+type Option func(*Display)
+
+// WithLogInterval sets how often progress is logged in ModeLog
+func WithLogInterval(interval time.Duration) Option {
+	return func(d *Display) {
+		if interval > 0 {
+			d.logInterval = interval
+		}
+	}
+}
+
+// NewDisplay returns a Display writing to out, drawing bars in ModeAuto when out is a terminal
+func NewDisplay(out io.Writer, opts ...Option) *Display {
+	d := &Display{out: out, fd: -1, logInterval: defaultLogInterval}
+	if f, ok := out.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		d.fd, d.tty = int(f.Fd()), true
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+type displayKey struct{}
+
+// WithContext returns a copy of ctx holding d
+func WithContext(ctx context.Context, d *Display) context.Context {
+	return context.WithValue(ctx, displayKey{}, d)
+}
+
+// FromContext returns the Display of ctx, nil if it holds none
+func FromContext(ctx context.Context) *Display {
+	d, _ := ctx.Value(displayKey{}).(*Display)
+	return d
+}
+
+// Write writes p to the output of the display, above the bars when they're drawn
+func (d *Display) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.mode != ModeBar || d.drawn == 0 {
+		return d.out.Write(p)
+	}
+
+	var b bytes.Buffer
+	d.erase(&b)
+	b.Write(p)
+	d.render(&b)
+	if _, err := d.out.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Begin starts reporting the progress of the operation title in mode, until the returned func is called
+//
+//	The returned func stops reporting, and logs how much was transferred in total and how long it took.  Only one
+//	operation is reported at a time, Begin does nothing while another is.
+func (d *Display) Begin(ctx context.Context, title string, mode Mode) func() {
+	if d == nil || mode == ModeNone {
+		return func() {}
+	}
+	if mode == ModeAuto || mode == "" {
+		mode = ModeLog
+		if d.tty {
+			mode = ModeBar
+		}
+	}
+
+	d.mu.Lock()
+	if d.mode != "" {
+		d.mu.Unlock()
+		return func() {}
+	}
+	d.mode, d.title, d.start = mode, title, time.Now()
+	d.tasks, d.total, d.unsized, d.count, d.finished, d.drawn = nil, 0, 0, 0, 0, 0
+	atomic.StoreInt64(&d.transferred, 0)
+	d.stop, d.stopped = make(chan struct{}), make(chan struct{})
+	d.mu.Unlock()
+
+	go d.run(ctx)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { d.end(ctx) })
+	}
+}
+
+// Track starts tracking the transfer of the artifact name of size bytes, 0 when the size isn't known
+//
+//	The returned Task is nil when no operation is being reported.
+func (d *Display) Track(name string, size int64) *Task {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.mode == "" {
+		return nil
+	}
+
+	t := &Task{d: d, name: name, size: size, start: time.Now()}
+	d.tasks = append(d.tasks, t)
+	d.count++
+	if size > 0 {
+		d.total += size
+	} else {
+		d.unsized++
+	}
+	return t
+}
+
+func (d *Display) run(ctx context.Context) {
+	defer close(d.stopped)
+
+	interval := defaultRedrawInterval
+	if d.mode == ModeLog {
+		interval = d.logInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if d.mode == ModeBar {
+				d.mu.Lock()
+				var b bytes.Buffer
+				d.erase(&b)
+				d.render(&b)
+				d.out.Write(b.Bytes())
+				d.mu.Unlock()
+				continue
+			}
+			// the lines are logged without holding mu, the logger writes through the display
+			d.mu.Lock()
+			lines := d.lines()
+			d.mu.Unlock()
+			l := log.FromContext(ctx)
+			for _, line := range lines {
+				l.Infof("%s", line)
+			}
+		case <-d.stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *Display) end(ctx context.Context) {
+	close(d.stop)
+	<-d.stopped
+
+	d.mu.Lock()
+	if d.mode == ModeBar {
+		var b bytes.Buffer
+		d.erase(&b)
+		d.out.Write(b.Bytes())
+	}
+	title, count, elapsed := d.title, d.count, time.Since(d.start)
+	n := atomic.LoadInt64(&d.transferred)
+	d.mode, d.tasks = "", nil
+	d.mu.Unlock()
+
+	if count > 0 {
+		log.FromContext(ctx).Infof("[%s] transferred [%s] for [%d] artifacts in [%s] (%s)", title, formatBytes(n), count, elapsed.Round(time.Second), rate(n, elapsed))
+	}
+}
+
+// erase writes to b what moves the cursor back over the bars last drawn and clears them
+func (d *Display) erase(b *bytes.Buffer) {
+	if d.drawn > 0 {
+		fmt.Fprintf(b, "\x1b[%dA\x1b[J", d.drawn)
+		d.drawn = 0
+	}
+}
+
+// render writes the bars to b, each cut to the width of the terminal so none wraps onto a line it can't erase
+func (d *Display) render(b *bytes.Buffer) {
+	width := 0
+	if d.tty {
+		if w, _, err := term.GetSize(d.fd); err == nil {
+			width = w - 1
+		}
+	}
+	for _, line := range d.lines() {
+		if r := []rune(line); width > 0 && len(r) > width {
+			line = string(r[:width])
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+		d.drawn++
+	}
+}
+
+// lines returns a line for each artifact being transferred, up to maxBars, followed by one for the whole operation
+func (d *Display) lines() []string {
+	var lines []string
+	for i, t := range d.tasks {
+		if i == maxBars {
+			lines = append(lines, fmt.Sprintf("... and [%d] more", len(d.tasks)-maxBars))
+			break
+		}
+		lines = append(lines, d.line(t.name, atomic.LoadInt64(&t.done), t.size, time.Since(t.start)))
+	}
+
+	// the operation has no size to measure against while an artifact of unknown size is being transferred
+	total := d.total
+	if d.unsized > 0 {
+		total = 0
+	}
+	name := fmt.Sprintf("%s [%d/%d]", d.title, d.finished, d.count)
+	lines = append(lines, d.line(name, atomic.LoadInt64(&d.transferred), total, time.Since(d.start)))
+	return lines
+}
+
+// line describes the transfer of done of size bytes over elapsed, as a bar or a log line depending on the mode
+func (d *Display) line(name string, done, size int64, elapsed time.Duration) string {
+	if size <= 0 {
+		if d.mode == ModeBar {
+			return fmt.Sprintf("%-*s %s  %s", maxName, shorten(name), formatBytes(done), rate(done, elapsed))
+		}
+		return fmt.Sprintf("[%s] [%s] (%s)", name, formatBytes(done), rate(done, elapsed))
+	}
+
+	// bytes sent again by a retry may take an artifact past its size
+	if done > size {
+		done = size
+	}
+	pct := int(done * 100 / size)
+	if d.mode == ModeBar {
+		filled := int(done * barWidth / size)
+		bar := strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled)
+		return fmt.Sprintf("%-*s [%s] %3d%% %s / %s  %s  ETA %s", maxName, shorten(name), bar, pct, formatBytes(done), formatBytes(size), rate(done, elapsed), eta(done, size, elapsed))
+	}
+	return fmt.Sprintf("[%s] [%s] of [%s] (%d%%), %s, ETA [%s]", name, formatBytes(done), formatBytes(size), pct, rate(done, elapsed), eta(done, size, elapsed))
+}
+
+// Task tracks the transfer of a single artifact
+type Task struct {
+	d     *Display
+	name  string
+	size  int64
+	start time.Time
+	done  int64
+	ended bool
+}
+
+// Add records n more bytes of the artifact as transferred
+func (t *Task) Add(n int64) {
+	if t == nil {
+		return
+	}
+	atomic.AddInt64(&t.done, n)
+	atomic.AddInt64(&t.d.transferred, n)
+}
+
+// Write records the bytes of p as transferred, so the Task can be written to alongside the artifact's destination
+func (t *Task) Write(p []byte) (int, error) {
+	t.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// Reader returns r, recording the bytes read from it as transferred
+func (t *Task) Reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return io.TeeReader(r, t)
+}
+
+// Done stops tracking the artifact
+//
+//	Bytes of its size that weren't transferred, such as blobs the destination already held, are taken off the total of
+//	the operation, so its ETA is that of what's left to transfer.  An artifact of unknown size adds what it transferred
+//	to the total instead.
+func (t *Task) Done() {
+	if t == nil {
+		return
+	}
+	d := t.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t.ended {
+		return
+	}
+	t.ended = true
+
+	for i, other := range d.tasks {
+		if other == t {
+			d.tasks = append(d.tasks[:i], d.tasks[i+1:]...)
+			break
+		}
+	}
+	d.finished++
+	done := atomic.LoadInt64(&t.done)
+	switch {
+	case t.size <= 0:
+		d.unsized--
+		d.total += done
+	case done < t.size:
+		d.total -= t.size - done
+	}
+}
+
+// shorten cuts name down to maxName, keeping its end since that's where references differ
+func shorten(name string) string {
+	r := []rune(name)
+	if len(r) <= maxName {
+		return name
+	}
+	return "..." + string(r[len(r)-maxName+3:])
+}
+
+func rate(n int64, elapsed time.Duration) string {
+	if elapsed <= 0 {
+		return "0 B/s"
+	}
+	return formatBytes(int64(float64(n)/elapsed.Seconds())) + "/s"
+}
+
+// eta returns how long the rest of size takes at the rate done was transferred over elapsed
+func eta(done, size int64, elapsed time.Duration) string {
+	if done <= 0 || elapsed <= 0 {
+		return "--"
+	}
+	if done >= size {
+		return "0s"
+	}
+	left := time.Duration(float64(size-done) / float64(done) * float64(elapsed))
+	return left.Round(time.Second).String()
+}
+
+func formatBytes(b int64) string {
+	const unit = 1000
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,165 @@
+package progress_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/progress"
+)
+
+// syncBuffer is a bytes.Buffer safe to read while the display writes to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor polls out until it holds every one of want
+func waitFor(t *testing.T, out *syncBuffer, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		missing := ""
+		for _, w := range want {
+			if !strings.Contains(out.String(), w) {
+				missing = w
+				break
+			}
+		}
+		if missing == "" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("output never held [%s], got:\n%s", missing, out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    progress.Mode
+		wantErr bool
+	}{
+		{name: "auto", in: "auto", want: progress.ModeAuto},
+		{name: "bar", in: "bar", want: progress.ModeBar},
+		{name: "log", in: "log", want: progress.ModeLog},
+		{name: "none", in: "none", want: progress.ModeNone},
+		{name: "unknown", in: "fancy", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := progress.ParseMode(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplay_TrackWithoutBegin(t *testing.T) {
+	out := &syncBuffer{}
+	d := progress.NewDisplay(out)
+
+	for _, d := range []*progress.Display{d, nil} {
+		task := d.Track("docker.io/library/alpine:3.18", 100)
+		if task != nil {
+			t.Fatalf("Track() outside of an operation = %v, want nil", task)
+		}
+		// a nil task is safe to use, so callers needn't check whether progress is reported
+		task.Add(10)
+		if n, err := task.Write([]byte("data")); n != 4 || err != nil {
+			t.Errorf("Write() = %d, %v, want 4, nil", n, err)
+		}
+		var r bytes.Buffer
+		if _, err := r.ReadFrom(task.Reader(strings.NewReader("data"))); err != nil || r.String() != "data" {
+			t.Errorf("Reader() read %q, %v, want %q", r.String(), err, "data")
+		}
+		task.Done()
+	}
+
+	if _, err := d.Write([]byte("a log line\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "a log line\n" {
+		t.Errorf("Write() with no operation wrote %q, want it unchanged", got)
+	}
+}
+
+func TestDisplay_Bars(t *testing.T) {
+	out := &syncBuffer{}
+	d := progress.NewDisplay(out)
+	end := d.Begin(context.Background(), "sync", progress.ModeBar)
+
+	task := d.Track("docker.io/library/alpine:3.18", 1000)
+	task.Add(500)
+	waitFor(t, out, "docker.io/library/alpine:3.18", " 50% 500 B / 1.0 kB", "ETA", "sync [0/1]")
+
+	// a log line written while the bars are drawn erases them first, and they're drawn again below it
+	before := len(out.String())
+	if _, err := d.Write([]byte("a log line\n")); err != nil {
+		t.Fatal(err)
+	}
+	written := out.String()[before:]
+	if !strings.HasPrefix(written, "\x1b[") || !strings.Contains(written, "a log line\n") || !strings.Contains(written, "sync [0/1]") {
+		t.Errorf("Write() while drawing wrote %q, want the bars erased, the line, then the bars", written)
+	}
+
+	task.Add(500)
+	task.Done()
+	waitFor(t, out, "sync [1/1]")
+	end()
+
+	if _, err := d.Write([]byte("after\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), "after\n") {
+		t.Errorf("Write() after the operation ended wrote %q, want it unchanged", out.String())
+	}
+}
+
+func TestDisplay_LogLines(t *testing.T) {
+	out := &syncBuffer{}
+	d := progress.NewDisplay(out, progress.WithLogInterval(10*time.Millisecond))
+	ctx := log.NewLogger(d).WithContext(context.Background())
+
+	end := d.Begin(ctx, "load", progress.ModeLog)
+
+	// bytes an artifact didn't need to transfer are taken off the total
+	skipped := d.Track("rancher/rancher:v2.8.0", 1000)
+	skipped.Add(400)
+	skipped.Done()
+
+	task := d.Track("haul.tar.zst", 0)
+	task.Add(2000)
+	waitFor(t, out, "[haul.tar.zst] [2.0 kB]", "[load [1/2]] [2.4 kB] (")
+
+	task.Done()
+	waitFor(t, out, "[load [2/2]] [2.4 kB] of [2.4 kB] (100%)")
+	end()
+	waitFor(t, out, "[load] transferred [2.4 kB] for [2] artifacts")
+	if strings.Contains(out.String(), "\x1b[J") {
+		t.Errorf("log mode drew bars:\n%s", out.String())
+	}
+}
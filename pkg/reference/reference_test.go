@@ -55,3 +55,128 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestRelocationRules_Relocate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules reference.RelocationRules
+		ref   string
+		want  string
+	}{
+		{
+			name: "should only swap the registry without rules",
+			ref:  "ghcr.io/rancher/mirrored/busybox:1.36",
+			want: "registry.example.com/rancher/mirrored/busybox:1.36",
+		},
+		{
+			name:  "should prefix the repository",
+			rules: reference.RelocationRules{Prefix: "airgap/"},
+			ref:   "rancher/rancher:v2.8.0",
+			want:  "registry.example.com/airgap/rancher/rancher:v2.8.0",
+		},
+		{
+			name:  "should flatten nested repositories",
+			rules: reference.RelocationRules{Flatten: true},
+			ref:   "ghcr.io/rancher/mirrored/busybox@sha256:42043edfae481178f07aa077fa872fcc242e276d302f4ac2026d9d2eb65b955f",
+			want:  "registry.example.com/busybox@sha256:42043edfae481178f07aa077fa872fcc242e276d302f4ac2026d9d2eb65b955f",
+		},
+		{
+			name: "should rewrite the repository",
+			rules: reference.RelocationRules{Rewrites: []reference.Rewrite{
+				{Match: "^rancher/mirrored-(.*)", Replace: "mirrored/$1"},
+			}},
+			ref:  "rancher/mirrored-pause:3.6",
+			want: "registry.example.com/mirrored/pause:3.6",
+		},
+		{
+			name:  "should namespace the repositories of a source registry",
+			rules: reference.RelocationRules{Namespaces: map[string]string{"docker.io": "dockerhub", "ghcr.io": "github"}},
+			ref:   "busybox:1.36",
+			want:  "registry.example.com/dockerhub/library/busybox:1.36",
+		},
+		{
+			name: "should apply every rule in order",
+			rules: reference.RelocationRules{
+				Rewrites:   []reference.Rewrite{{Match: "^hauler/", Replace: "tools/"}},
+				Namespaces: map[string]string{"ghcr.io": "github"},
+				Prefix:     "airgap/",
+			},
+			ref:  "ghcr.io/hauler/app:v1",
+			want: "registry.example.com/airgap/github/tools/app:v1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rules.Relocate(tt.ref, "registry.example.com")
+			if err != nil {
+				t.Fatalf("Relocate() error = %v", err)
+			}
+			if got.Name() != tt.want {
+				t.Errorf("Relocate() = %v, want %v", got.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRewrite(t *testing.T) {
+	rw, err := reference.ParseRewrite("^rancher/(.*)=mirrored/$1")
+	if err != nil {
+		t.Fatalf("ParseRewrite() error = %v", err)
+	}
+	if rw.Match != "^rancher/(.*)" || rw.Replace != "mirrored/$1" {
+		t.Errorf("ParseRewrite() = %+v", rw)
+	}
+	if _, err := reference.ParseRewrite("^rancher/(.*)"); err == nil {
+		t.Errorf("ParseRewrite() without a replacement should fail")
+	}
+	if err := (reference.RelocationRules{Rewrites: []reference.Rewrite{{Match: "^(rancher"}}}).Validate(); err == nil {
+		t.Errorf("Validate() of an invalid expression should fail")
+	}
+}
+
+func TestFilterTags(t *testing.T) {
+	tags := []string{"latest", "v1.23.9", "v1.24.0", "1.24.3", "v1.25.0-rc.1", "v1.25.1", "stable"}
+
+	tests := []struct {
+		name       string
+		constraint string
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name: "should keep every tag without a constraint",
+			want: []string{"1.24.3", "latest", "stable", "v1.23.9", "v1.24.0", "v1.25.0-rc.1", "v1.25.1"},
+		},
+		{
+			name:       "should keep the versions satisfying the constraint, highest first",
+			constraint: ">=1.24",
+			want:       []string{"v1.25.1", "1.24.3", "v1.24.0"},
+		},
+		{
+			name:       "should keep the patches of a minor version",
+			constraint: "~1.24.0",
+			want:       []string{"1.24.3", "v1.24.0"},
+		},
+		{
+			name:       "should keep prereleases only for constraints naming one",
+			constraint: ">=1.25.0-0",
+			want:       []string{"v1.25.1", "v1.25.0-rc.1"},
+		},
+		{
+			name:       "should reject an invalid constraint",
+			constraint: ">>1.24",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reference.FilterTags(tags, tt.constraint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FilterTags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
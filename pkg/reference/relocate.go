@@ -0,0 +1,145 @@
+package reference
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"sigs.k8s.io/yaml"
+)
+
+// RelocationRules map the repositories of references to those they're relocated to, applied in the order of their
+// fields
+//
+//	rewrites:
+//	  - match: "^rancher/mirrored-(.*)"
+//	    replace: "mirrored/$1"
+//	flatten: false
+//	namespaces:
+//	  docker.io: dockerhub
+//	  ghcr.io: github
+//	prefix: airgap/
+type RelocationRules struct {
+	// Rewrites replace the matches of their regular expression in the repository, each in turn
+	Rewrites []Rewrite `json:"rewrites,omitempty"`
+
+	// Flatten keeps the last component of the repository alone, so rancher/mirrored/busybox becomes busybox
+	Flatten bool `json:"flatten,omitempty"`
+
+	// Namespaces map source registries to the namespace their repositories are placed under, so repositories of the
+	// same name from different registries don't collide
+	Namespaces map[string]string `json:"namespaces,omitempty"`
+
+	// Prefix is prepended to every repository
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Rewrite replaces the matches of the regular expression Match with Replace, which may refer to its submatches as $1
+type Rewrite struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+}
+
+// LoadRelocationRules reads and validates the relocation rules at path
+func LoadRelocationRules(p string) (RelocationRules, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return RelocationRules{}, err
+	}
+	var rules RelocationRules
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return RelocationRules{}, fmt.Errorf("parsing relocation rules [%s]: %w", p, err)
+	}
+	if err := rules.Validate(); err != nil {
+		return RelocationRules{}, fmt.Errorf("relocation rules [%s]: %w", p, err)
+	}
+	return rules, nil
+}
+
+// ParseRewrite parses a rewrite given as match=replace
+func ParseRewrite(s string) (Rewrite, error) {
+	match, replace, ok := strings.Cut(s, "=")
+	if !ok || match == "" {
+		return Rewrite{}, fmt.Errorf("rewrite [%s] is not of the form match=replace", s)
+	}
+	return Rewrite{Match: match, Replace: replace}, nil
+}
+
+// Validate checks the expressions of every rewrite compile
+func (r RelocationRules) Validate() error {
+	for _, rw := range r.Rewrites {
+		if _, err := regexp.Compile(rw.Match); err != nil {
+			return fmt.Errorf("rewrite [%s]: %w", rw.Match, err)
+		}
+	}
+	return nil
+}
+
+// IsZero reports whether r leaves every repository as it is
+func (r RelocationRules) IsZero() bool {
+	return len(r.Rewrites) == 0 && !r.Flatten && len(r.Namespaces) == 0 && r.Prefix == ""
+}
+
+// Relocate returns reference on registry, its repository mapped by the rules
+func (r RelocationRules) Relocate(reference string, registry string) (gname.Reference, error) {
+	ref, err := gname.ParseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := r.repository(ref.Context())
+	if err != nil {
+		return nil, fmt.Errorf("relocating [%s]: %w", reference, err)
+	}
+
+	relocated, err := gname.ParseReference(repo, gname.WithDefaultRegistry(registry))
+	if err != nil {
+		return nil, fmt.Errorf("relocating [%s] to [%s]: %w", reference, repo, err)
+	}
+
+	if _, err := gname.NewDigest(ref.Name()); err == nil {
+		return relocated.Context().Digest(ref.Identifier()), nil
+	}
+	return relocated.Context().Tag(ref.Identifier()), nil
+}
+
+// repository returns the repository of src mapped by the rules
+func (r RelocationRules) repository(src gname.Repository) (string, error) {
+	repo := src.RepositoryStr()
+
+	for _, rw := range r.Rewrites {
+		re, err := regexp.Compile(rw.Match)
+		if err != nil {
+			return "", fmt.Errorf("rewrite [%s]: %w", rw.Match, err)
+		}
+		repo = re.ReplaceAllString(repo, rw.Replace)
+	}
+
+	if r.Flatten {
+		repo = path.Base(repo)
+	}
+
+	if ns, ok := r.namespace(src.RegistryStr()); ok {
+		repo = path.Join(ns, repo)
+	}
+
+	repo = r.Prefix + repo
+	return strings.Trim(repo, "/"), nil
+}
+
+// namespace returns the namespace of registry, docker hub being known by several names
+func (r RelocationRules) namespace(registry string) (string, bool) {
+	keys := []string{registry}
+	if registry == gname.DefaultRegistry {
+		keys = append(keys, "docker.io", "registry-1.docker.io")
+	}
+	for _, key := range keys {
+		if ns, ok := r.Namespaces[key]; ok {
+			return ns, true
+		}
+	}
+	return "", false
+}
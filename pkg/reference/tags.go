@@ -0,0 +1,51 @@
+package reference
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// FilterTags returns the tags satisfying the semver constraint, such as ">=1.24" or "~1.28.0", highest version first
+//
+//	Tags are parsed leniently, so v1.24.0 and 1.24 are both versions, and tags that aren't versions, such as latest,
+//	never satisfy a constraint.  Prereleases only satisfy constraints naming a prerelease themselves.  An empty
+//	constraint returns every tag in sorted order.
+func FilterTags(tags []string, constraint string) ([]string, error) {
+	if constraint == "" {
+		sorted := append([]string(nil), tags...)
+		sort.Strings(sorted)
+		return sorted, nil
+	}
+
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing tag constraint [%s]: %w", constraint, err)
+	}
+
+	type version struct {
+		tag string
+		v   *semver.Version
+	}
+	var matched []version
+	for _, tag := range tags {
+		v, err := semver.NewVersion(tag)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		matched = append(matched, version{tag: tag, v: v})
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if cmp := matched[i].v.Compare(matched[j].v); cmp != 0 {
+			return cmp > 0
+		}
+		return matched[i].tag < matched[j].tag
+	})
+
+	filtered := make([]string, len(matched))
+	for i, m := range matched {
+		filtered[i] = m.tag
+	}
+	return filtered, nil
+}
@@ -0,0 +1,160 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Status is the outcome of an artifact, or of the whole command
+type Status string
+
+const (
+	StatusSucceeded Status = "succeeded"
+	StatusSkipped   Status = "skipped"
+	StatusFailed    Status = "failed"
+)
+
+// Entry is the outcome of a single artifact processed by a command
+type Entry struct {
+	// Kind is the kind annotation of the artifact, or the kind of item that failed when it never made it to the store
+	Kind      string `json:"kind,omitempty"`
+	Reference string `json:"reference"`
+
+	// Target is the reference the artifact was copied as, when it differs from the reference in the store
+	Target string `json:"target,omitempty"`
+
+	// Destination names the destination the artifact was copied to, for copies to several destinations at once
+	Destination string `json:"destination,omitempty"`
+
+	Digest   string        `json:"digest,omitempty"`
+	Size     int64         `json:"size"`
+	Duration time.Duration `json:"-"`
+	Status   Status        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// MarshalJSON renders the duration of the entry in seconds, the same as the duration of structured log entries
+func (e Entry) MarshalJSON() ([]byte, error) {
+	type entry Entry
+	return json.Marshal(struct {
+		entry
+		Duration float64 `json:"duration"`
+	}{entry(e), e.Duration.Seconds()})
+}
+
+// Summary counts the artifacts of a report by status, along with the bytes of those that succeeded
+type Summary struct {
+	Succeeded int   `json:"succeeded"`
+	Skipped   int   `json:"skipped"`
+	Failed    int   `json:"failed"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// Report is the machine readable record of every artifact a command processed, the evidence of exactly what crossed
+// the boundary
+//
+//	Artifacts are recorded as they're processed, from any goroutine, and the report is completed with the outcome of
+//	the command by Finish.  A nil Report records nothing, so callers needn't check whether a report was asked for.
+type Report struct {
+	Command  string    `json:"command"`
+	Store    string    `json:"store,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Status   Status    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+
+	Summary   Summary `json:"summary"`
+	Artifacts []Entry `json:"artifacts"`
+
+	// Archive is the archive the artifacts were written to, for commands saving the store
+	Archive *Entry `json:"archive,omitempty"`
+
+	mu sync.Mutex
+}
+
+// New returns an empty report of command, started now
+func New(command string, store string) *Report {
+	return &Report{
+		Command:   command,
+		Store:     store,
+		Started:   time.Now().UTC(),
+		Artifacts: []Entry{},
+	}
+}
+
+type reportKey struct{}
+
+// WithContext returns a copy of ctx holding r, which the store records the artifacts it copies in
+func WithContext(ctx context.Context, r *Report) context.Context {
+	return context.WithValue(ctx, reportKey{}, r)
+}
+
+// FromContext returns the Report of ctx, nil if it holds none
+func FromContext(ctx context.Context) *Report {
+	r, _ := ctx.Value(reportKey{}).(*Report)
+	return r
+}
+
+// Record adds the outcome of an artifact to the report
+func (r *Report) Record(e Entry) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch e.Status {
+	case StatusSucceeded:
+		r.Summary.Succeeded++
+		r.Summary.Bytes += e.Size
+	case StatusSkipped:
+		r.Summary.Skipped++
+	case StatusFailed:
+		r.Summary.Failed++
+	}
+	r.Artifacts = append(r.Artifacts, e)
+}
+
+// SetArchive records the archive the artifacts of the report were written to
+func (r *Report) SetArchive(e Entry) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Archive = &e
+}
+
+// Finish completes the report with the outcome of the command, err being the error it failed with if any
+func (r *Report) Finish(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Finished = time.Now().UTC()
+	r.Status = StatusSucceeded
+	if err != nil {
+		r.Status = StatusFailed
+		r.Error = err.Error()
+	}
+}
+
+// WriteFile writes the report as json to path
+func (r *Report) WriteFile(path string) error {
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
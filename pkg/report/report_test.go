@@ -0,0 +1,100 @@
+package report_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rancherfederal/hauler/pkg/report"
+)
+
+func TestReport_WriteFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []report.Entry
+		err         error
+		wantStatus  report.Status
+		wantSummary report.Summary
+	}{
+		{
+			name: "succeeded",
+			entries: []report.Entry{
+				{Reference: "hauler/f.txt:latest", Digest: "sha256:bb29f9a849d6a3b7013e729ad705b2145d84c5d189e884fbd83a7d7884a0e565", Size: 499, Duration: 1500 * time.Millisecond, Status: report.StatusSucceeded},
+				{Reference: "rancher/rancher:v2.8.0", Size: 1000, Status: report.StatusSkipped},
+			},
+			wantStatus:  report.StatusSucceeded,
+			wantSummary: report.Summary{Succeeded: 1, Skipped: 1, Bytes: 499},
+		},
+		{
+			name: "failed",
+			entries: []report.Entry{
+				{Reference: "hauler/f.txt:latest", Size: 499, Status: report.StatusSucceeded},
+				{Kind: "image", Reference: "rancher/rancher:v2.8.0", Status: report.StatusFailed, Error: "unauthorized"},
+			},
+			err:         errors.New("failed to sync [1] items"),
+			wantStatus:  report.StatusFailed,
+			wantSummary: report.Summary{Succeeded: 1, Failed: 1, Bytes: 499},
+		},
+		{
+			name:        "empty",
+			wantStatus:  report.StatusSucceeded,
+			wantSummary: report.Summary{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := report.New("sync", "store")
+			for _, e := range tt.entries {
+				r.Record(e)
+			}
+			r.Finish(tt.err)
+
+			path := filepath.Join(t.TempDir(), "report.json")
+			if err := r.WriteFile(path); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got struct {
+				Command   string                   `json:"command"`
+				Status    report.Status            `json:"status"`
+				Error     string                   `json:"error"`
+				Summary   report.Summary           `json:"summary"`
+				Artifacts []map[string]interface{} `json:"artifacts"`
+			}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("report %s is not json: %v", data, err)
+			}
+			if got.Command != "sync" || got.Status != tt.wantStatus || got.Summary != tt.wantSummary {
+				t.Errorf("report = %s, want status [%s] and summary %+v", data, tt.wantStatus, tt.wantSummary)
+			}
+			if tt.err != nil && got.Error != tt.err.Error() {
+				t.Errorf("report error = %q, want %q", got.Error, tt.err.Error())
+			}
+			// an empty report still lists its artifacts, so consumers needn't tell a missing list from an empty one
+			if got.Artifacts == nil || len(got.Artifacts) != len(tt.entries) {
+				t.Fatalf("report artifacts = %v, want %d entries", got.Artifacts, len(tt.entries))
+			}
+			for i, e := range tt.entries {
+				a := got.Artifacts[i]
+				if a["reference"] != e.Reference || a["status"] != string(e.Status) || a["duration"] != e.Duration.Seconds() {
+					t.Errorf("artifact %d = %v, want %+v with its duration in seconds", i, a, e)
+				}
+			}
+		})
+	}
+}
+
+func TestReport_Nil(t *testing.T) {
+	var r *report.Report
+	// a nil report records nothing, so callers needn't check whether a report was asked for
+	r.Record(report.Entry{Reference: "hauler/f.txt:latest", Status: report.StatusSucceeded})
+	r.SetArchive(report.Entry{Reference: "haul.tar.zst"})
+	r.Finish(nil)
+}
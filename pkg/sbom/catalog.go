@@ -0,0 +1,408 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+const (
+	apkInstalled = "lib/apk/db/installed"
+	dpkgStatus   = "var/lib/dpkg/status"
+	dpkgStatusD  = "var/lib/dpkg/status.d"
+	osRelease    = "etc/os-release"
+	usrOSRelease = "usr/lib/os-release"
+
+	// maxTrackedFile is the size past which a package database is too large to be read into memory
+	maxTrackedFile = 64 << 20
+)
+
+// Images returns the reference of every image in the store, sorted
+//
+//	Charts, files, and other artifacts the store holds alongside images are left out, as are signatures, attestations,
+//	sboms, and referrers.
+func Images(ctx context.Context, s *store.Layout) ([]string, error) {
+	var candidates []ocispec.Descriptor
+	if err := s.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		kind := desc.Annotations[consts.KindAnnotationName]
+		if kind == consts.KindAnnotation || kind == consts.KindAnnotationIndex {
+			candidates = append(candidates, desc)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var refs []string
+	for _, desc := range candidates {
+		ref := desc.Annotations[ocispec.AnnotationRefName]
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		platforms, err := manifests(ctx, s, desc)
+		if err != nil {
+			return nil, fmt.Errorf("reading [%s]: %w", ref, err)
+		}
+		if len(platforms) > 0 {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// Catalog returns the inventory of every platform of the image reference in the store
+//
+//	Packages are read from the apk and dpkg databases left in the image's filesystem once its layers are applied in
+//	order, including the per-package status files of distroless images.  Images built without a package manager, such
+//	as those from scratch, have no packages.
+func Catalog(ctx context.Context, s *store.Layout, reference string) ([]Image, error) {
+	desc, err := s.Stat(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	ref := desc.Annotations[ocispec.AnnotationRefName]
+
+	platforms, err := manifests(ctx, s, desc)
+	if err != nil {
+		return nil, err
+	}
+	if len(platforms) == 0 {
+		return nil, fmt.Errorf("[%s] is not an image", reference)
+	}
+
+	var images []Image
+	for _, p := range platforms {
+		img, err := catalogManifest(ctx, s, p)
+		if err != nil {
+			return nil, fmt.Errorf("cataloging [%s@%s]: %w", ref, p.desc.Digest, err)
+		}
+		img.Reference = ref
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// platformManifest is an image manifest of a single platform, along with its config's platform
+type platformManifest struct {
+	desc     ocispec.Descriptor
+	manifest ocispec.Manifest
+	platform string
+}
+
+// manifests returns the image manifests of desc, each platform's for an index, and nothing if desc isn't an image
+func manifests(ctx context.Context, s *store.Layout, desc ocispec.Descriptor) ([]platformManifest, error) {
+	switch desc.MediaType {
+	case consts.OCIImageIndexSchema, consts.DockerManifestListSchema2:
+		var idx ocispec.Index
+		if err := fetchJSON(ctx, s, desc, &idx); err != nil {
+			return nil, err
+		}
+		var ms []platformManifest
+		for _, m := range idx.Manifests {
+			// attestation manifests buildkit adds to indexes have an unknown platform
+			if m.Platform != nil && m.Platform.OS == "unknown" {
+				continue
+			}
+			pms, err := manifests(ctx, s, m)
+			if err != nil {
+				return nil, err
+			}
+			ms = append(ms, pms...)
+		}
+		return ms, nil
+
+	case consts.OCIManifestSchema1, consts.DockerManifestSchema2:
+		var m ocispec.Manifest
+		if err := fetchJSON(ctx, s, desc, &m); err != nil {
+			return nil, err
+		}
+		if m.Config.MediaType != consts.DockerConfigJSON && m.Config.MediaType != ocispec.MediaTypeImageConfig {
+			return nil, nil
+		}
+		var cfg ocispec.Image
+		if err := fetchJSON(ctx, s, m.Config, &cfg); err != nil {
+			return nil, err
+		}
+		platform := cfg.OS + "/" + cfg.Architecture
+		if cfg.Variant != "" {
+			platform += "/" + cfg.Variant
+		}
+		return []platformManifest{{desc: desc, manifest: m, platform: platform}}, nil
+	}
+	return nil, nil
+}
+
+func fetchJSON(ctx context.Context, s *store.Layout, desc ocispec.Descriptor, v interface{}) error {
+	rc, err := s.OCI.Fetch(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return json.NewDecoder(rc).Decode(v)
+}
+
+// catalogManifest applies the layers of p in order, keeping only the files packages are read from
+func catalogManifest(ctx context.Context, s *store.Layout, p platformManifest) (Image, error) {
+	files := make(map[string][]byte)
+	for _, layer := range p.manifest.Layers {
+		if err := ctx.Err(); err != nil {
+			return Image{}, err
+		}
+		if err := applyLayer(s, layer, files); err != nil {
+			return Image{}, fmt.Errorf("layer [%s]: %w", layer.Digest, err)
+		}
+	}
+
+	img := Image{
+		Digest:   p.desc.Digest,
+		Platform: p.platform,
+	}
+	release, ok := files[osRelease]
+	if !ok {
+		release = files[usrOSRelease]
+	}
+	img.Distro = parseOSRelease(release)
+
+	if data, ok := files[apkInstalled]; ok {
+		img.Packages = append(img.Packages, parseAPK(data)...)
+	}
+	if data, ok := files[dpkgStatus]; ok {
+		img.Packages = append(img.Packages, parseDpkg(data, true)...)
+	}
+	var statusD []string
+	for name := range files {
+		if path.Dir(name) == dpkgStatusD {
+			statusD = append(statusD, name)
+		}
+	}
+	sort.Strings(statusD)
+	for _, name := range statusD {
+		img.Packages = append(img.Packages, parseDpkg(files[name], false)...)
+	}
+
+	for i := range img.Packages {
+		img.Packages[i].Distro = img.Distro.ID
+		img.Packages[i].DistroVersion = img.Distro.VersionID
+	}
+	sort.Slice(img.Packages, func(i, j int) bool {
+		a, b := img.Packages[i], img.Packages[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+	return img, nil
+}
+
+// tracked reports whether name is a file packages are read from
+func tracked(name string) bool {
+	switch name {
+	case apkInstalled, dpkgStatus, osRelease, usrOSRelease:
+		return true
+	}
+	return path.Dir(name) == dpkgStatusD
+}
+
+// applyLayer updates files with the tracked files the layer adds, changes, and removes
+func applyLayer(s *store.Layout, layer ocispec.Descriptor, files map[string][]byte) error {
+	f, err := s.OpenBlob(layer.Digest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := decompress(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		dir, base := path.Dir(name), path.Base(name)
+		switch {
+		case base == ".wh..wh..opq":
+			remove(files, dir, true)
+		case strings.HasPrefix(base, ".wh."):
+			remove(files, path.Join(dir, strings.TrimPrefix(base, ".wh.")), false)
+		case tracked(name):
+			// a file replaced by anything else, such as a symlink, no longer holds what was read from it
+			delete(files, name)
+			if hdr.Typeflag != tar.TypeReg || hdr.Size > maxTrackedFile {
+				continue
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			files[name] = data
+		}
+	}
+}
+
+// remove deletes name and everything under it from files, or only what's under it when contents is set
+func remove(files map[string][]byte, name string, contents bool) {
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	for f := range files {
+		if strings.HasPrefix(f, prefix) || (!contents && f == name) {
+			delete(files, f)
+		}
+	}
+}
+
+var (
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// decompress detects the compression of a layer from its leading bytes, as its media type isn't always accurate
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	}
+	return io.NopCloser(br), nil
+}
+
+// stanzas splits a package database into its blank line separated stanzas of "Key: value" fields, joining the
+// continuation lines of multi-line fields
+func stanzas(data []byte, sep string) []map[string]string {
+	var all []map[string]string
+	cur := make(map[string]string)
+	var last string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64<<10), maxTrackedFile)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(cur) > 0 {
+				all = append(all, cur)
+				cur = make(map[string]string)
+			}
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && last != "" {
+			cur[last] += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		k, v, ok := strings.Cut(line, sep)
+		if !ok {
+			continue
+		}
+		last = k
+		cur[k] = strings.TrimSpace(v)
+	}
+	if len(cur) > 0 {
+		all = append(all, cur)
+	}
+	return all
+}
+
+// parseAPK reads the packages of an apk installed database
+func parseAPK(data []byte) []Package {
+	var pkgs []Package
+	for _, st := range stanzas(data, ":") {
+		if st["P"] == "" {
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			Type:    TypeAPK,
+			Name:    st["P"],
+			Version: st["V"],
+			Arch:    st["A"],
+			License: st["L"],
+			Source:  st["o"],
+		})
+	}
+	return pkgs
+}
+
+// parseDpkg reads the packages of a dpkg status file, only keeping those fully installed when checkStatus is set, as
+// the per-package files of distroless images have no status
+func parseDpkg(data []byte, checkStatus bool) []Package {
+	var pkgs []Package
+	for _, st := range stanzas(data, ":") {
+		if st["Package"] == "" {
+			continue
+		}
+		if checkStatus && !strings.HasSuffix(st["Status"], " installed") {
+			continue
+		}
+		source, _, _ := strings.Cut(st["Source"], " ")
+		pkgs = append(pkgs, Package{
+			Type:    TypeDeb,
+			Name:    st["Package"],
+			Version: st["Version"],
+			Arch:    st["Architecture"],
+			Source:  source,
+		})
+	}
+	return pkgs
+}
+
+// parseOSRelease reads the distribution of an os-release file
+func parseOSRelease(data []byte) Distro {
+	var d Distro
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		k, v, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if !ok {
+			continue
+		}
+		v = strings.Trim(v, `"'`)
+		switch k {
+		case "ID":
+			d.ID = v
+		case "VERSION_ID":
+			d.VersionID = v
+		case "PRETTY_NAME":
+			d.PrettyName = v
+		}
+	}
+	return d
+}
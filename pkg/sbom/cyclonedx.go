@@ -0,0 +1,119 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rancherfederal/hauler/internal/version"
+)
+
+type cdxDocument struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp  string        `json:"timestamp"`
+	Tools      cdxTools      `json:"tools"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	BOMRef      string         `json:"bom-ref,omitempty"`
+	Type        string         `json:"type"`
+	Name        string         `json:"name"`
+	Version     string         `json:"version,omitempty"`
+	Description string         `json:"description,omitempty"`
+	PURL        string         `json:"purl,omitempty"`
+	Licenses    []cdxLicense   `json:"licenses,omitempty"`
+	Properties  []cdxProperty  `json:"properties,omitempty"`
+	Components  []cdxComponent `json:"components,omitempty"`
+}
+
+type cdxLicense struct {
+	Expression string          `json:"expression,omitempty"`
+	License    *cdxLicenseName `json:"license,omitempty"`
+}
+
+type cdxLicenseName struct {
+	Name string `json:"name"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func writeCycloneDX(w io.Writer, name string, images []Image) error {
+	doc := cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + uuid.NewString(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools: cdxTools{Components: []cdxComponent{{
+				Type:    "application",
+				Name:    "hauler",
+				Version: version.GetVersionInfo().GitVersion,
+			}}},
+			Properties: []cdxProperty{{Name: "hauler:name", Value: name}},
+		},
+		Components: []cdxComponent{},
+	}
+
+	for i, img := range images {
+		c := cdxComponent{
+			BOMRef:  fmt.Sprintf("image-%d", i),
+			Type:    "container",
+			Name:    img.Reference,
+			Version: img.Digest.String(),
+			PURL:    img.PURL(),
+		}
+		if img.Platform != "" {
+			c.Properties = append(c.Properties, cdxProperty{Name: "hauler:platform", Value: img.Platform})
+		}
+		if img.Distro.ID != "" {
+			c.Components = append(c.Components, cdxComponent{
+				BOMRef:      fmt.Sprintf("image-%d-os", i),
+				Type:        "operating-system",
+				Name:        img.Distro.ID,
+				Version:     img.Distro.VersionID,
+				Description: img.Distro.PrettyName,
+			})
+		}
+
+		for j, p := range img.Packages {
+			pc := cdxComponent{
+				BOMRef:  fmt.Sprintf("image-%d-package-%d", i, j),
+				Type:    "library",
+				Name:    p.Name,
+				Version: p.Version,
+				PURL:    p.PURL(),
+			}
+			if spdxLicense.MatchString(p.License) {
+				pc.Licenses = []cdxLicense{{Expression: p.License}}
+			} else if p.License != "" {
+				pc.Licenses = []cdxLicense{{License: &cdxLicenseName{Name: p.License}}}
+			}
+			c.Components = append(c.Components, pc)
+		}
+		doc.Components = append(doc.Components, c)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,141 @@
+// Package sbom inventories the packages installed in the images of a store and writes them as spdx or cyclonedx
+// documents
+package sbom
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Format is the document format an sbom is written in
+type Format string
+
+const (
+	FormatSPDX      Format = "spdx-json"
+	FormatCycloneDX Format = "cyclonedx-json"
+)
+
+// Formats are the supported formats
+var Formats = []Format{FormatSPDX, FormatCycloneDX}
+
+// ParseFormat parses the name of a format, also accepting its name without the encoding
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "spdx", string(FormatSPDX):
+		return FormatSPDX, nil
+	case "cyclonedx", string(FormatCycloneDX):
+		return FormatCycloneDX, nil
+	}
+	return "", fmt.Errorf("unknown sbom format [%s], expected one of %v", s, Formats)
+}
+
+// Extension is the file extension documents of the format are written with
+func (f Format) Extension() string {
+	if f == FormatCycloneDX {
+		return ".cdx.json"
+	}
+	return ".spdx.json"
+}
+
+// PackageType is the packaging system a package was installed with
+type PackageType string
+
+const (
+	TypeAPK PackageType = "apk"
+	TypeDeb PackageType = "deb"
+)
+
+// Package is a package installed in an image
+type Package struct {
+	Type    PackageType
+	Name    string
+	Version string
+	Arch    string
+	License string
+
+	// Source is the name of the source package the package was built from, when it differs
+	Source string
+
+	Distro        string
+	DistroVersion string
+}
+
+// PURL returns the package url of the package
+func (p Package) PURL() string {
+	namespace := p.Distro
+	if namespace == "" {
+		// packages are namespaced by their distribution, so the best guess is made for images missing an os-release
+		namespace = map[PackageType]string{TypeAPK: "alpine", TypeDeb: "debian"}[p.Type]
+	}
+
+	var qualifiers []string
+	if p.Arch != "" {
+		qualifiers = append(qualifiers, "arch="+url.QueryEscape(p.Arch))
+	}
+	if p.DistroVersion != "" {
+		qualifiers = append(qualifiers, "distro="+url.QueryEscape(namespace+"-"+p.DistroVersion))
+	}
+	if p.Source != "" && p.Source != p.Name {
+		qualifiers = append(qualifiers, "upstream="+url.QueryEscape(p.Source))
+	}
+
+	purl := fmt.Sprintf("pkg:%s/%s/%s", p.Type, url.PathEscape(namespace), url.PathEscape(p.Name))
+	if p.Version != "" {
+		purl += "@" + url.PathEscape(p.Version)
+	}
+	if len(qualifiers) > 0 {
+		purl += "?" + strings.Join(qualifiers, "&")
+	}
+	return purl
+}
+
+// Distro is the distribution an image was built from, as described by its os-release
+type Distro struct {
+	ID         string
+	VersionID  string
+	PrettyName string
+}
+
+// Image is the inventory of a single platform of an image
+type Image struct {
+	Reference string
+	Digest    digest.Digest
+	Platform  string
+	Distro    Distro
+	Packages  []Package
+}
+
+// PURL returns the package url of the image
+func (i Image) PURL() string {
+	name, repo := i.Reference, ""
+	if at := strings.Index(name, "@"); at >= 0 {
+		name = name[:at]
+	}
+	if slash := strings.LastIndex(name, "/"); slash >= 0 {
+		repo, name = name[:slash], name[slash+1:]
+	}
+	if colon := strings.LastIndex(name, ":"); colon >= 0 {
+		name = name[:colon]
+	}
+
+	qualifiers := []string{"repository_url=" + url.QueryEscape(repo+"/"+name)}
+	if os, arch, ok := strings.Cut(i.Platform, "/"); ok {
+		qualifiers = append(qualifiers, "arch="+url.QueryEscape(arch), "os="+url.QueryEscape(os))
+	}
+	return fmt.Sprintf("pkg:oci/%s@%s?%s", url.PathEscape(name), url.PathEscape(i.Digest.String()), strings.Join(qualifiers, "&"))
+}
+
+// Write writes the inventories of images as a single document of the format, named name
+func Write(w io.Writer, format Format, name string, images []Image) error {
+	switch format {
+	case FormatSPDX:
+		return writeSPDX(w, name, images)
+	case FormatCycloneDX:
+		return writeCycloneDX(w, name, images)
+	}
+	return fmt.Errorf("unknown sbom format [%s]", format)
+}
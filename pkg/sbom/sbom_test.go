@@ -0,0 +1,292 @@
+package sbom_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/rancherfederal/hauler/pkg/sbom"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+type testImage struct {
+	v1.Image
+}
+
+func (i testImage) MediaType() string {
+	mt, err := i.Image.MediaType()
+	if err != nil {
+		return ""
+	}
+	return string(mt)
+}
+
+func (i testImage) RawConfig() ([]byte, error) {
+	return i.RawConfigFile()
+}
+
+// layeredImage builds a linux/amd64 image with a layer of each of the filemaps, applied in order
+func layeredImage(t *testing.T, layers ...map[string][]byte) v1.Image {
+	t.Helper()
+	img, err := mutate.ConfigFile(empty.Image, &v1.ConfigFile{OS: "linux", Architecture: "amd64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, files := range layers {
+		l, err := crane.Layer(files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img, err = mutate.AppendLayers(img, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return img
+}
+
+const alpineRelease = `NAME="Alpine Linux"
+ID=alpine
+VERSION_ID=3.18.4
+PRETTY_NAME="Alpine Linux v3.18"
+`
+
+const apkInstalled = `C:Q1abc=
+P:musl
+V:1.2.4-r1
+A:x86_64
+L:MIT
+o:musl
+
+C:Q1def=
+P:busybox
+V:1.36.1-r2
+A:x86_64
+L:GPL-2.0-only
+o:busybox
+`
+
+const debianStatus = `Package: libc6
+Status: install ok installed
+Architecture: amd64
+Source: glibc
+Version: 2.36-9
+Description: GNU C Library: Shared libraries
+ Contains the standard libraries that are used by nearly all programs on
+ the system.
+
+Package: vim
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 2:9.0.1378-2
+`
+
+func TestCatalog(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alpine := layeredImage(t,
+		map[string][]byte{
+			"etc/os-release":       []byte(alpineRelease),
+			"lib/apk/db/installed": []byte("P:musl\nV:1.2.3-r0\nA:x86_64\nL:MIT\n"),
+		},
+		// a later layer replacing the database is what's installed
+		map[string][]byte{
+			"lib/apk/db/installed": []byte(apkInstalled),
+		},
+	)
+	debian := layeredImage(t,
+		map[string][]byte{
+			"usr/lib/os-release":           []byte("ID=debian\nVERSION_ID=\"12\"\n"),
+			"var/lib/dpkg/status":          []byte(debianStatus),
+			"var/lib/dpkg/status.d/tzdata": []byte("Package: tzdata\nVersion: 2024a-0+deb12u1\nArchitecture: all\n"),
+			"var/lib/dpkg/status.d/base":   []byte("Package: base-files\nVersion: 12.4+deb12u5\nArchitecture: amd64\n"),
+		},
+		map[string][]byte{
+			"var/lib/dpkg/status.d/.wh.base": nil,
+		},
+	)
+	scratch, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs := map[string]v1.Image{
+		"docker.io/library/alpine:3.18":    alpine,
+		"docker.io/library/debian:12":      debian,
+		"docker.io/library/scratch:latest": scratch,
+	}
+	for ref, img := range refs {
+		if _, err := s.AddOCI(ctx, testImage{img}, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	images, err := sbom.Images(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRefs := []string{"docker.io/library/alpine:3.18", "docker.io/library/debian:12", "docker.io/library/scratch:latest"}
+	if !reflect.DeepEqual(images, wantRefs) {
+		t.Errorf("Images() = %v, want %v", images, wantRefs)
+	}
+
+	tests := []struct {
+		name       string
+		ref        string
+		wantDistro string
+		wantPURLs  []string
+	}{
+		{
+			name:       "apk",
+			ref:        "docker.io/library/alpine:3.18",
+			wantDistro: "alpine",
+			wantPURLs: []string{
+				"pkg:apk/alpine/busybox@1.36.1-r2?arch=x86_64&distro=alpine-3.18.4",
+				"pkg:apk/alpine/musl@1.2.4-r1?arch=x86_64&distro=alpine-3.18.4",
+			},
+		},
+		{
+			name:       "dpkg",
+			ref:        "docker.io/library/debian:12",
+			wantDistro: "debian",
+			wantPURLs: []string{
+				"pkg:deb/debian/libc6@2.36-9?arch=amd64&distro=debian-12&upstream=glibc",
+				"pkg:deb/debian/tzdata@2024a-0+deb12u1?arch=all&distro=debian-12",
+			},
+		},
+		{
+			name: "no packages",
+			ref:  "docker.io/library/scratch:latest",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sbom.Catalog(ctx, s, tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("Catalog() returned %d images, want 1", len(got))
+			}
+			img := got[0]
+			if img.Reference != tt.ref || img.Distro.ID != tt.wantDistro {
+				t.Errorf("Catalog() = %s %q, want %s %q", img.Reference, img.Distro.ID, tt.ref, tt.wantDistro)
+			}
+			var purls []string
+			for _, p := range img.Packages {
+				purls = append(purls, p.PURL())
+			}
+			if !reflect.DeepEqual(purls, tt.wantPURLs) {
+				t.Errorf("Catalog() packages = %v, want %v", purls, tt.wantPURLs)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	images := []sbom.Image{{
+		Reference: "docker.io/library/alpine:3.18",
+		Digest:    "sha256:48d9183eb12a05c99bcc0bf44a003607b8e941e1d4f41f9ad12bdcc4b5672f86",
+		Platform:  "linux/amd64",
+		Distro:    sbom.Distro{ID: "alpine", VersionID: "3.18.4"},
+		Packages: []sbom.Package{
+			{Type: sbom.TypeAPK, Name: "musl", Version: "1.2.4-r1", License: "MIT", Distro: "alpine"},
+			{Type: sbom.TypeAPK, Name: "ca-certificates", Version: "20230506-r0", License: "MPL-2.0 AND MIT", Distro: "alpine"},
+			{Type: sbom.TypeAPK, Name: "zlib", Version: "1.2.13-r1", License: "Zlib (custom)", Distro: "alpine"},
+		},
+	}}
+
+	tests := []struct {
+		format sbom.Format
+		check  func(t *testing.T, doc map[string]interface{})
+	}{
+		{
+			format: sbom.FormatSPDX,
+			check: func(t *testing.T, doc map[string]interface{}) {
+				if doc["spdxVersion"] != "SPDX-2.3" {
+					t.Errorf("spdxVersion = %v", doc["spdxVersion"])
+				}
+				pkgs := doc["packages"].([]interface{})
+				if len(pkgs) != 4 {
+					t.Fatalf("got %d packages, want 4", len(pkgs))
+				}
+				if p := pkgs[0].(map[string]interface{}); p["primaryPackagePurpose"] != "CONTAINER" {
+					t.Errorf("image package purpose = %v, want CONTAINER", p["primaryPackagePurpose"])
+				}
+				wantLicenses := []string{"MIT", "MPL-2.0 AND MIT", "NOASSERTION"}
+				for i, want := range wantLicenses {
+					if got := pkgs[i+1].(map[string]interface{})["licenseDeclared"]; got != want {
+						t.Errorf("licenseDeclared of %d = %v, want %s", i, got, want)
+					}
+				}
+				if n := len(doc["relationships"].([]interface{})); n != 4 {
+					t.Errorf("got %d relationships, want 4", n)
+				}
+			},
+		},
+		{
+			format: sbom.FormatCycloneDX,
+			check: func(t *testing.T, doc map[string]interface{}) {
+				if doc["bomFormat"] != "CycloneDX" || doc["specVersion"] != "1.5" {
+					t.Errorf("bomFormat = %v, specVersion = %v", doc["bomFormat"], doc["specVersion"])
+				}
+				comps := doc["components"].([]interface{})
+				if len(comps) != 1 {
+					t.Fatalf("got %d components, want 1", len(comps))
+				}
+				c := comps[0].(map[string]interface{})
+				if c["type"] != "container" {
+					t.Errorf("component type = %v, want container", c["type"])
+				}
+				// the operating system and each package
+				if n := len(c["components"].([]interface{})); n != 4 {
+					t.Errorf("got %d nested components, want 4", n)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := sbom.Write(&buf, tt.format, "alpine", images); err != nil {
+				t.Fatal(err)
+			}
+			var doc map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, doc)
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    sbom.Format
+		wantErr bool
+	}{
+		{in: "spdx", want: sbom.FormatSPDX},
+		{in: "spdx-json", want: sbom.FormatSPDX},
+		{in: "CycloneDX", want: sbom.FormatCycloneDX},
+		{in: "cyclonedx-json", want: sbom.FormatCycloneDX},
+		{in: "syft-json", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := sbom.ParseFormat(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
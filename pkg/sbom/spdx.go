@@ -0,0 +1,144 @@
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rancherfederal/hauler/internal/version"
+)
+
+const noAssertion = "NOASSERTION"
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID                string            `json:"SPDXID"`
+	Name                  string            `json:"name"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	Supplier              string            `json:"supplier,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	LicenseConcluded      string            `json:"licenseConcluded"`
+	LicenseDeclared       string            `json:"licenseDeclared"`
+	LicenseComments       string            `json:"licenseComments,omitempty"`
+	CopyrightText         string            `json:"copyrightText"`
+	SourceInfo            string            `json:"sourceInfo,omitempty"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdxLicense matches the license expressions that can be declared as is, made of license ids joined by operators
+var spdxLicense = regexp.MustCompile(`^[A-Za-z0-9.+-]+( (AND|OR|WITH) [A-Za-z0-9.+-]+)*$`)
+
+func writeSPDX(w io.Writer, name string, images []Image) error {
+	// the namespace only has to be unique to the document's contents, which are identified by their digests
+	h := sha256.New()
+	fmt.Fprintln(h, name)
+	for _, img := range images {
+		fmt.Fprintln(h, img.Reference, img.Digest)
+	}
+
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: fmt.Sprintf("https://hauler.dev/spdx/%s-%x", strings.ReplaceAll(name, "/", "_"), h.Sum(nil)[:8]),
+		CreationInfo: spdxCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: hauler-" + version.GetVersionInfo().GitVersion},
+		},
+		Packages:      []spdxPackage{},
+		Relationships: []spdxRelationship{},
+	}
+
+	for i, img := range images {
+		imageID := fmt.Sprintf("SPDXRef-Image-%d", i)
+		doc.Packages = append(doc.Packages, spdxPackage{
+			SPDXID:                imageID,
+			Name:                  img.Reference,
+			VersionInfo:           img.Digest.String(),
+			DownloadLocation:      noAssertion,
+			LicenseConcluded:      noAssertion,
+			LicenseDeclared:       noAssertion,
+			CopyrightText:         noAssertion,
+			PrimaryPackagePurpose: "CONTAINER",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  img.PURL(),
+			}},
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      doc.SPDXID,
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: imageID,
+		})
+
+		for j, p := range img.Packages {
+			pkg := spdxPackage{
+				SPDXID:           fmt.Sprintf("SPDXRef-Package-%d-%d", i, j),
+				Name:             p.Name,
+				VersionInfo:      p.Version,
+				DownloadLocation: noAssertion,
+				LicenseConcluded: noAssertion,
+				LicenseDeclared:  noAssertion,
+				CopyrightText:    noAssertion,
+				ExternalRefs: []spdxExternalRef{{
+					ReferenceCategory: "PACKAGE-MANAGER",
+					ReferenceType:     "purl",
+					ReferenceLocator:  p.PURL(),
+				}},
+			}
+			if spdxLicense.MatchString(p.License) {
+				pkg.LicenseDeclared = p.License
+			} else if p.License != "" {
+				pkg.LicenseComments = "declared as " + p.License
+			}
+			if p.Source != "" && p.Source != p.Name {
+				pkg.SourceInfo = "built from source package " + p.Source
+			}
+			doc.Packages = append(doc.Packages, pkg)
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      imageID,
+				RelationshipType:   "CONTAINS",
+				RelatedSPDXElement: pkg.SPDXID,
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,172 @@
+// Package scan reports the known vulnerabilities of the packages installed in the images of a store
+package scan
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rancherfederal/hauler/pkg/sbom"
+	"github.com/rancherfederal/hauler/pkg/staging"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+// Severity is how severe a vulnerability is, ordered from least to most severe
+type Severity int
+
+const (
+	SeverityUnknown Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// ParseSeverity parses the name of a severity, ignoring case
+func ParseSeverity(s string) (Severity, error) {
+	for i, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return Severity(i), nil
+		}
+	}
+	return SeverityUnknown, fmt.Errorf("unknown severity [%s], expected one of %v", s, severityNames)
+}
+
+// parseSeverity reads the severity a scanner reported, treating any it doesn't recognize, such as negligible, as unknown
+func parseSeverity(s string) Severity {
+	sev, err := ParseSeverity(s)
+	if err != nil {
+		return SeverityUnknown
+	}
+	return sev
+}
+
+func (s Severity) String() string {
+	if s < SeverityUnknown || s > SeverityCritical {
+		return severityNames[SeverityUnknown]
+	}
+	return severityNames[s]
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Vulnerability is a known vulnerability of an installed package
+type Vulnerability struct {
+	ID           string   `json:"id"`
+	Package      string   `json:"package"`
+	Version      string   `json:"version"`
+	FixedVersion string   `json:"fixedVersion,omitempty"`
+	Severity     Severity `json:"severity"`
+	Title        string   `json:"title,omitempty"`
+}
+
+// Scanner finds the vulnerabilities of the packages in an sbom
+//
+//	Scanners are handed a cyclonedx sbom rather than the image itself, so only what's in the store is ever scanned and
+//	nothing is pulled from a registry.  Scanners typically need a vulnerability database, which is left to the scanner
+//	to download or be given offline.
+type Scanner interface {
+	// Name is the name of the scanner
+	Name() string
+
+	// Scan returns the vulnerabilities of the packages in the cyclonedx sbom at path
+	Scan(ctx context.Context, path string) ([]Vulnerability, error)
+}
+
+// Scanners are the names of the supported scanners
+var Scanners = []string{"trivy", "grype"}
+
+// New returns the scanner called name, run from binary, or from the PATH when binary is empty
+func New(name string, binary string) (Scanner, error) {
+	if binary == "" {
+		binary = name
+	}
+	switch name {
+	case "trivy":
+		return &Trivy{Binary: binary}, nil
+	case "grype":
+		return &Grype{Binary: binary}, nil
+	}
+	return nil, fmt.Errorf("unknown scanner [%s], expected one of %v", name, Scanners)
+}
+
+// Result is the vulnerabilities found in every platform of an image
+type Result struct {
+	Reference       string          `json:"reference"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// AtLeast returns the vulnerabilities of severity min or higher
+func (r Result) AtLeast(min Severity) []Vulnerability {
+	var vulns []Vulnerability
+	for _, v := range r.Vulnerabilities {
+		if v.Severity >= min {
+			vulns = append(vulns, v)
+		}
+	}
+	return vulns
+}
+
+// Scan scans every platform of the image reference in the store with sc
+//
+//	The vulnerabilities found are deduplicated across platforms and sorted from most to least severe.
+func Scan(ctx context.Context, sc Scanner, s *store.Layout, reference string) (Result, error) {
+	images, err := sbom.Catalog(ctx, s, reference)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Reference: images[0].Reference, Vulnerabilities: []Vulnerability{}}
+
+	dir, cleanup, err := staging.Dir(ctx, "", "scan")
+	if err != nil {
+		return Result{}, err
+	}
+	defer cleanup()
+
+	path := filepath.Join(dir, "sbom"+sbom.FormatCycloneDX.Extension())
+	f, err := os.Create(path)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := sbom.Write(f, sbom.FormatCycloneDX, result.Reference, images); err != nil {
+		f.Close()
+		return Result{}, err
+	}
+	if err := f.Close(); err != nil {
+		return Result{}, err
+	}
+
+	vulns, err := sc.Scan(ctx, path)
+	if err != nil {
+		return Result{}, fmt.Errorf("scanning [%s] with %s: %w", result.Reference, sc.Name(), err)
+	}
+
+	type key struct{ id, pkg, version string }
+	seen := make(map[key]bool)
+	for _, v := range vulns {
+		k := key{v.ID, v.Package, v.Version}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		result.Vulnerabilities = append(result.Vulnerabilities, v)
+	}
+	sort.Slice(result.Vulnerabilities, func(i, j int) bool {
+		a, b := result.Vulnerabilities[i], result.Vulnerabilities[j]
+		if a.Severity != b.Severity {
+			return a.Severity > b.Severity
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Package < b.Package
+	})
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package scan_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/rancherfederal/hauler/pkg/scan"
+	"github.com/rancherfederal/hauler/pkg/store"
+)
+
+type testImage struct {
+	v1.Image
+}
+
+func (i testImage) MediaType() string {
+	mt, err := i.Image.MediaType()
+	if err != nil {
+		return ""
+	}
+	return string(mt)
+}
+
+func (i testImage) RawConfig() ([]byte, error) {
+	return i.RawConfigFile()
+}
+
+// fakeScanner writes a script that checks it was handed an sbom and prints report
+func fakeScanner(t *testing.T, name string, report string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	script := `#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in
+		*.cdx.json) grep -q CycloneDX "${arg#sbom:}" || exit 3 ;;
+	esac
+done
+cat <<'EOF'
+` + report + `
+EOF
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const trivyReport = `{"Results": [
+	{"Vulnerabilities": [
+		{"VulnerabilityID": "CVE-2023-0002", "PkgName": "openssl", "InstalledVersion": "3.1.0-r0", "FixedVersion": "3.1.1-r0", "Severity": "MEDIUM"},
+		{"VulnerabilityID": "CVE-2023-0001", "PkgName": "musl", "InstalledVersion": "1.2.4-r0", "Severity": "CRITICAL", "Title": "overflow"}
+	]},
+	{"Vulnerabilities": [
+		{"VulnerabilityID": "CVE-2023-0002", "PkgName": "openssl", "InstalledVersion": "3.1.0-r0", "FixedVersion": "3.1.1-r0", "Severity": "MEDIUM"}
+	]}
+]}`
+
+const grypeReport = `{"matches": [
+	{"vulnerability": {"id": "CVE-2023-0002", "severity": "Medium", "fix": {"versions": ["3.1.1-r0"]}}, "artifact": {"name": "openssl", "version": "3.1.0-r0"}},
+	{"vulnerability": {"id": "CVE-2023-0001", "severity": "Critical", "description": "overflow"}, "artifact": {"name": "musl", "version": "1.2.4-r0"}},
+	{"vulnerability": {"id": "CVE-2023-0003", "severity": "Negligible"}, "artifact": {"name": "zlib", "version": "1.2.13-r0"}}
+]}`
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := "docker.io/library/alpine:3.18"
+	if _, err := s.AddOCI(ctx, testImage{img}, ref); err != nil {
+		t.Fatal(err)
+	}
+
+	critical := scan.Vulnerability{ID: "CVE-2023-0001", Package: "musl", Version: "1.2.4-r0", Severity: scan.SeverityCritical, Title: "overflow"}
+	medium := scan.Vulnerability{ID: "CVE-2023-0002", Package: "openssl", Version: "3.1.0-r0", FixedVersion: "3.1.1-r0", Severity: scan.SeverityMedium}
+	unknown := scan.Vulnerability{ID: "CVE-2023-0003", Package: "zlib", Version: "1.2.13-r0", Severity: scan.SeverityUnknown}
+
+	tests := []struct {
+		name   string
+		report string
+		want   []scan.Vulnerability
+	}{
+		{name: "trivy", report: trivyReport, want: []scan.Vulnerability{critical, medium}},
+		{name: "grype", report: grypeReport, want: []scan.Vulnerability{critical, medium, unknown}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := scan.New(tt.name, fakeScanner(t, tt.name, tt.report))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := scan.Scan(ctx, sc, s, ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Reference != ref {
+				t.Errorf("Scan() reference = %s, want %s", got.Reference, ref)
+			}
+			if !reflect.DeepEqual(got.Vulnerabilities, tt.want) {
+				t.Errorf("Scan() = %+v, want %+v", got.Vulnerabilities, tt.want)
+			}
+			if n := len(got.AtLeast(scan.SeverityHigh)); n != 1 {
+				t.Errorf("AtLeast(HIGH) returned %d vulnerabilities, want 1", n)
+			}
+		})
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    scan.Severity
+		wantErr bool
+	}{
+		{in: "critical", want: scan.SeverityCritical},
+		{in: "HIGH", want: scan.SeverityHigh},
+		{in: "Low", want: scan.SeverityLow},
+		{in: "unknown", want: scan.SeverityUnknown},
+		{in: "severe", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := scan.ParseSeverity(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSeverity(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
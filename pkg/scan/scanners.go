@@ -0,0 +1,121 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Trivy scans sboms with trivy's sbom subcommand
+type Trivy struct {
+	Binary string
+}
+
+func (t *Trivy) Name() string { return "trivy" }
+
+type trivyReport struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			FixedVersion     string `json:"FixedVersion"`
+			Severity         string `json:"Severity"`
+			Title            string `json:"Title"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+func (t *Trivy) Scan(ctx context.Context, path string) ([]Vulnerability, error) {
+	out, err := run(ctx, t.Binary, "sbom", "--quiet", "--format", "json", path)
+	if err != nil {
+		return nil, err
+	}
+
+	var report trivyReport
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, fmt.Errorf("reading trivy report: %w", err)
+	}
+	var vulns []Vulnerability
+	for _, r := range report.Results {
+		for _, v := range r.Vulnerabilities {
+			vulns = append(vulns, Vulnerability{
+				ID:           v.VulnerabilityID,
+				Package:      v.PkgName,
+				Version:      v.InstalledVersion,
+				FixedVersion: v.FixedVersion,
+				Severity:     parseSeverity(v.Severity),
+				Title:        v.Title,
+			})
+		}
+	}
+	return vulns, nil
+}
+
+// Grype scans sboms with grype
+type Grype struct {
+	Binary string
+}
+
+func (g *Grype) Name() string { return "grype" }
+
+type grypeReport struct {
+	Matches []struct {
+		Vulnerability struct {
+			ID          string `json:"id"`
+			Severity    string `json:"severity"`
+			Description string `json:"description"`
+			Fix         struct {
+				Versions []string `json:"versions"`
+			} `json:"fix"`
+		} `json:"vulnerability"`
+		Artifact struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"artifact"`
+	} `json:"matches"`
+}
+
+func (g *Grype) Scan(ctx context.Context, path string) ([]Vulnerability, error) {
+	out, err := run(ctx, g.Binary, "sbom:"+path, "--quiet", "--output", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	var report grypeReport
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, fmt.Errorf("reading grype report: %w", err)
+	}
+	var vulns []Vulnerability
+	for _, m := range report.Matches {
+		vulns = append(vulns, Vulnerability{
+			ID:           m.Vulnerability.ID,
+			Package:      m.Artifact.Name,
+			Version:      m.Artifact.Version,
+			FixedVersion: strings.Join(m.Vulnerability.Fix.Versions, ", "),
+			Severity:     parseSeverity(m.Vulnerability.Severity),
+			Title:        m.Vulnerability.Description,
+		})
+	}
+	return vulns, nil
+}
+
+// run runs binary with args, returning what it wrote to stdout
+func run(ctx context.Context, binary string, args ...string) ([]byte, error) {
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("scanner [%s] not found: %w", binary, err)
+	}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v, output: %s", err, stderr.Bytes())
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,132 @@
+package staging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// Prefix names every staging directory, telling those an interrupted run left behind apart from the rest of the
+// temporary directory
+const Prefix = "hauler-staging-"
+
+// lockFile is held in a staging directory for as long as it's in use, so a sweep never removes it from under a
+// long running process
+const lockFile = ".hauler-staging.lock"
+
+// DefaultMaxAge is how old a staging directory must be before a sweep takes it for one left behind
+const DefaultMaxAge = 24 * time.Hour
+
+var (
+	mu sync.Mutex
+
+	// dirs are the staging directories of the process still in place, by path
+	dirs = make(map[string]*dir)
+)
+
+type dir struct {
+	path string
+	lock *flock.Flock
+	stop func() bool
+	once sync.Once
+}
+
+// remove releases the lock of the directory and removes it, once however many times it's called
+func (d *dir) remove() {
+	d.once.Do(func() {
+		d.stop()
+		d.lock.Unlock()
+		os.RemoveAll(d.path)
+
+		mu.Lock()
+		delete(dirs, d.path)
+		mu.Unlock()
+	})
+}
+
+// Dir creates a staging directory named after name in parent, the temporary directory of the os when empty
+//
+//	The directory is removed by the returned cleanup, or as soon as ctx is done should that come first, so a run
+//	that's interrupted doesn't leave it behind.  RemoveAll removes those of the process the exit gets to before either.
+func Dir(ctx context.Context, parent string, name string) (string, func(), error) {
+	path, err := os.MkdirTemp(parent, Prefix+name+"-*")
+	if err != nil {
+		return "", nil, err
+	}
+
+	lock := flock.New(filepath.Join(path, lockFile))
+	if _, err := lock.TryLock(); err != nil {
+		os.RemoveAll(path)
+		return "", nil, fmt.Errorf("locking staging directory [%s]: %w", path, err)
+	}
+
+	d := &dir{path: path, lock: lock}
+	mu.Lock()
+	dirs[path] = d
+	mu.Unlock()
+	d.stop = context.AfterFunc(ctx, d.remove)
+
+	return path, d.remove, nil
+}
+
+// RemoveAll removes every staging directory of the process still in place, for a process exiting before their
+// cleanups ran
+func RemoveAll() {
+	mu.Lock()
+	pending := make([]*dir, 0, len(dirs))
+	for _, d := range dirs {
+		pending = append(pending, d)
+	}
+	mu.Unlock()
+
+	for _, d := range pending {
+		d.remove()
+	}
+}
+
+// Sweep removes the staging directories in parent, the temporary directory of the os when empty, left behind by runs
+// killed before they could remove them, returning the paths removed
+//
+//	A directory is only taken for one left behind once it's older than maxAge and no process holds its lock.
+func Sweep(parent string, maxAge time.Duration) ([]string, error) {
+	if parent == "" {
+		parent = os.TempDir()
+	}
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	var errs []error
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), Prefix) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil || time.Since(fi.ModTime()) < maxAge {
+			continue
+		}
+
+		path := filepath.Join(parent, e.Name())
+		lock := flock.New(filepath.Join(path, lockFile))
+		if ok, err := lock.TryLock(); err != nil || !ok {
+			continue
+		}
+		// released first, windows doesn't remove files still open
+		lock.Unlock()
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, path)
+	}
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,115 @@
+package staging_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancherfederal/hauler/pkg/staging"
+)
+
+func TestDir(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove func(cancel context.CancelFunc, cleanup func())
+	}{
+		{
+			name:   "cleanup",
+			remove: func(_ context.CancelFunc, cleanup func()) { cleanup() },
+		},
+		{
+			name:   "cancelled",
+			remove: func(cancel context.CancelFunc, _ func()) { cancel() },
+		},
+		{
+			name:   "exiting",
+			remove: func(_ context.CancelFunc, _ func()) { staging.RemoveAll() },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			path, cleanup, err := staging.Dir(ctx, parent, "layout")
+			if err != nil {
+				t.Fatalf("Dir() error = %v", err)
+			}
+			if !strings.HasPrefix(filepath.Base(path), staging.Prefix+"layout-") {
+				t.Errorf("Dir() = %s, want it prefixed with %s", path, staging.Prefix+"layout-")
+			}
+			if err := os.WriteFile(filepath.Join(path, "blob"), []byte("hauler"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.remove(cancel, cleanup)
+			// the directory is removed from a goroutine of its own once ctx is done
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("staging directory [%s] still in place", path)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			cleanup()
+		})
+	}
+}
+
+func TestSweep(t *testing.T) {
+	parent := t.TempDir()
+	old := time.Now().Add(-2 * staging.DefaultMaxAge)
+
+	stale := filepath.Join(parent, staging.Prefix+"layout-stale")
+	recent := filepath.Join(parent, staging.Prefix+"layout-recent")
+	unrelated := filepath.Join(parent, "hauler-unrelated")
+	for _, dir := range []string{stale, recent, unrelated} {
+		if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a long running process still holds its lock however old the directory
+	inUse, cleanup, err := staging.Dir(context.Background(), parent, "layout")
+	if err != nil {
+		t.Fatalf("Dir() error = %v", err)
+	}
+	defer cleanup()
+
+	for _, dir := range []string{stale, unrelated, inUse} {
+		if err := os.Chtimes(dir, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := staging.Sweep(parent, staging.DefaultMaxAge)
+	if err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0] != stale {
+		t.Errorf("Sweep() = %v, want [%s]", removed, stale)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: stale, want: false},
+		{path: recent, want: true},
+		{path: unrelated, want: true},
+		{path: inUse, want: true},
+	}
+	for _, tt := range tests {
+		_, err := os.Stat(tt.path)
+		if got := err == nil; got != tt.want {
+			t.Errorf("[%s] in place = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
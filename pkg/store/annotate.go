@@ -0,0 +1,33 @@
+package store
+
+import (
+	"context"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Annotate merges annotations into the index descriptor of reference, returning the updated descriptor
+//
+//	reference is resolved the same as with Stat, so an image is annotated rather than its signatures.  Existing
+//	annotations of the same key are overwritten, and the content itself is left untouched.
+func (l *Layout) Annotate(ctx context.Context, reference string, annotations map[string]string) (ocispec.Descriptor, error) {
+	desc, err := l.Stat(ctx, reference)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	annotated := desc
+	annotated.Annotations = make(map[string]string, len(desc.Annotations)+len(annotations))
+	for k, v := range desc.Annotations {
+		annotated.Annotations[k] = v
+	}
+	for k, v := range annotations {
+		annotated.Annotations[k] = v
+	}
+
+	// the index is keyed by digest, reference, and kind, none of which change, so this replaces the entry
+	if err := l.OCI.AddIndex(annotated); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return annotated, nil
+}
@@ -0,0 +1,491 @@
+package store
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/progress"
+)
+
+var (
+	// ErrInvalidArchive is returned when an archive is corrupt, truncated, or of an unsupported version
+	ErrInvalidArchive = errors.New("invalid archive")
+
+	// ErrUnversionedArchive is returned when an archive has no ArchiveHeader, such as those saved by older releases
+	ErrUnversionedArchive = errors.New("archive has no version header")
+
+	// ErrIncompleteDelta is returned when loading a delta archive into a store missing the content it was built on
+	ErrIncompleteDelta = errors.New("store is missing content the delta archive was built on")
+)
+
+const (
+	// ArchiveHeaderFile is the first entry of every archive written by Save, identifying the archive's format
+	ArchiveHeaderFile = "hauler-archive.json"
+
+	// ArchiveVersion is the version of the archive format written by Save
+	ArchiveVersion = 1
+
+	// HaulManifestSuffix is appended to an archive's name to name the HaulManifest describing it, e.g.
+	// haul.tar.zst.manifest.json
+	HaulManifestSuffix = ".manifest.json"
+
+	// HaulManifestVersion is the version of the HaulManifest format
+	HaulManifestVersion = 1
+
+	// HaulSignatureSuffix is appended to a HaulManifest's name to name its signature, e.g.
+	// haul.tar.zst.manifest.json.sig
+	HaulSignatureSuffix = ".sig"
+)
+
+// ArchiveHeader describes the content of an archive written by Save
+type ArchiveHeader struct {
+	Version    int `json:"version"`
+	References int `json:"references"`
+	Blobs      int `json:"blobs"`
+
+	// Delta is set when the archive omits the blobs of a previous haul, and can only be loaded into a store holding them
+	Delta bool `json:"delta,omitempty"`
+}
+
+// HaulManifest records every reference and blob of a saved store, so a later save can package only what's new since
+//
+//	Archive is set once the archive the manifest describes is written, binding the manifest to the archive's content so
+//	a signature over the manifest covers the archive too.
+type HaulManifest struct {
+	Version    int                  `json:"version"`
+	References []ocispec.Descriptor `json:"references"`
+	Blobs      []digest.Digest      `json:"blobs"`
+	Archive    *ArchiveFile         `json:"archive,omitempty"`
+}
+
+// ArchiveFile is the name, size, and digest of an archive as written by Save, reassembled if it was segmented
+type ArchiveFile struct {
+	Name   string        `json:"name"`
+	Size   int64         `json:"size"`
+	Digest digest.Digest `json:"digest"`
+}
+
+// VerifyArchive reads the entire archive from r, checking it is the archive m was written beside
+//
+//	A manifest without an Archive, such as one written by an older release, can't be verified against and errors.
+func (m HaulManifest) VerifyArchive(r io.Reader) error {
+	if m.Archive == nil {
+		return errors.New("haul manifest does not record its archive")
+	}
+
+	verifier := m.Archive.Digest.Verifier()
+	n, err := io.Copy(verifier, r)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	if n != m.Archive.Size {
+		return fmt.Errorf("%w: [%s] is [%d] bytes, expected [%d]", ErrInvalidArchive, m.Archive.Name, n, m.Archive.Size)
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("%w: [%s] does not match its digest [%s]", ErrInvalidArchive, m.Archive.Name, m.Archive.Digest)
+	}
+	return nil
+}
+
+// Manifest returns the HaulManifest of everything in the store, which is exactly what Save writes to an archive
+func (l *Layout) Manifest(ctx context.Context) (HaulManifest, error) {
+	var manifests []ocispec.Descriptor
+	if err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		manifests = append(manifests, desc)
+		return nil
+	}); err != nil {
+		return HaulManifest{}, err
+	}
+	sortIndex(manifests)
+
+	blobs, err := l.collectBlobs(ctx, manifests)
+	if err != nil {
+		return HaulManifest{}, err
+	}
+
+	m := HaulManifest{
+		Version:    HaulManifestVersion,
+		References: manifests,
+		Blobs:      make([]digest.Digest, len(blobs)),
+	}
+	for i, b := range blobs {
+		m.Blobs[i] = b.Digest
+	}
+	return m, nil
+}
+
+// Compression is the compression applied to an archive written by Save
+type Compression string
+
+const (
+	CompressionZstd Compression = "zstd"
+	CompressionGzip Compression = "gzip"
+	CompressionNone Compression = "none"
+)
+
+// CompressionFromName infers an archive's compression from its file name, e.g. zstd for haul.tar.zst or haul.tar.zst.age
+func CompressionFromName(name string) (Compression, error) {
+	name = strings.TrimSuffix(name, EncryptedSuffix)
+	switch {
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return CompressionZstd, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return CompressionGzip, nil
+	case strings.HasSuffix(name, ".tar"):
+		return CompressionNone, nil
+	}
+	return "", fmt.Errorf("unsupported archive extension [%s], expected one of .tar.zst, .tar.gz, or .tar", name)
+}
+
+// ReadHaulManifest reads and validates a HaulManifest, such as one written beside an archive by hauler store save
+func ReadHaulManifest(r io.Reader) (HaulManifest, error) {
+	var m HaulManifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return HaulManifest{}, fmt.Errorf("reading haul manifest: %w", err)
+	}
+	if m.Version < 1 || m.Version > HaulManifestVersion {
+		return HaulManifest{}, fmt.Errorf("unsupported haul manifest version [%d], this release supports up to [%d]", m.Version, HaulManifestVersion)
+	}
+	for _, d := range m.Blobs {
+		if err := d.Validate(); err != nil {
+			return HaulManifest{}, fmt.Errorf("haul manifest blob [%s]: %w", d, err)
+		}
+	}
+	if m.Archive != nil {
+		if err := m.Archive.Digest.Validate(); err != nil {
+			return HaulManifest{}, fmt.Errorf("haul manifest archive [%s]: %w", m.Archive.Name, err)
+		}
+	}
+	return m, nil
+}
+
+// Save writes the entire store to w as a single compressed archive
+//
+//	The archive starts with an ArchiveHeader, followed by an oci layout holding every reference in the store.  Entries
+//	are written in a fixed order with fixed metadata and the compressors are configured deterministically, so saving
+//	the same content always produces an identical archive.  Every blob is checked before anything is written.  With
+//	WithDeltaFrom, blobs recorded in a previous haul's manifest are left out, while the index still lists every
+//	reference, so loading the delta into the store the previous haul was loaded into reproduces this store.
+func (l *Layout) Save(ctx context.Context, w io.Writer, opts ...SaveOption) error {
+	logger := log.FromContext(ctx)
+	o := makeSaveOpts(opts...)
+
+	manifests, blobs, err := l.saveContent(ctx, o)
+	if err != nil {
+		return err
+	}
+
+	header, err := json.Marshal(ArchiveHeader{
+		Version:    ArchiveVersion,
+		References: len(manifests),
+		Blobs:      len(blobs),
+		Delta:      o.deltaFrom != nil,
+	})
+	if err != nil {
+		return err
+	}
+
+	cw, err := compress(w, o.compression)
+	if err != nil {
+		return err
+	}
+
+	// progress is that of the content going into the archive, before it's compressed
+	var size int64
+	for _, b := range blobs {
+		size += b.Size
+	}
+	task := progress.FromContext(ctx).Track("archive", size)
+	defer task.Done()
+
+	tw := tar.NewWriter(io.MultiWriter(cw, task))
+	if err := writeTarFile(tw, ArchiveHeaderFile, header); err != nil {
+		return err
+	}
+	if err := l.writeLayout(tw, manifests, blobs); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+
+	logger.Debugf("saved [%d] references and [%d] blobs", len(manifests), len(blobs))
+	return nil
+}
+
+// SaveSize returns the size of the content Save writes with opts before it's compressed, which is what the archive
+// takes at most in practice as blobs are compressed already
+func (l *Layout) SaveSize(ctx context.Context, opts ...SaveOption) (int64, error) {
+	_, blobs, err := l.saveContent(ctx, makeSaveOpts(opts...))
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, b := range blobs {
+		size += b.Size
+	}
+	return size, nil
+}
+
+// saveContent returns the index entries and blobs Save writes with o
+func (l *Layout) saveContent(ctx context.Context, o *saveOpts) ([]ocispec.Descriptor, []ocispec.Descriptor, error) {
+	logger := log.FromContext(ctx)
+
+	var manifests []ocispec.Descriptor
+	if err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		manifests = append(manifests, desc)
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+	sortIndex(manifests)
+
+	blobs, err := l.collectBlobs(ctx, manifests)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if o.deltaFrom != nil {
+		skip := make(map[digest.Digest]bool, len(o.deltaFrom.Blobs))
+		for _, d := range o.deltaFrom.Blobs {
+			skip[d] = true
+		}
+		var missing []ocispec.Descriptor
+		for _, b := range blobs {
+			if !skip[b.Digest] {
+				missing = append(missing, b)
+			}
+		}
+		logger.Debugf("delta leaves out [%d] of [%d] blobs", len(blobs)-len(missing), len(blobs))
+		blobs = missing
+	}
+	return manifests, blobs, nil
+}
+
+// Load merges an archive written by Save into the store, returning the index entries it added
+//
+//	The archive may be compressed with any of the supported compressions.  Its version must be supported, every blob's
+//	content must match its digest, and the archive must hold every blob its header promises and its index references.
+//	Blobs are only moved into the store once verified, and blobs the store already holds are skipped.  References
+//	are only added to the index once the entire archive has been read and verified, so a corrupt or truncated archive
+//	never leaves dangling references behind.  A delta archive fails with ErrIncompleteDelta unless the store already
+//	holds every blob the delta left out.
+func (l *Layout) Load(ctx context.Context, r io.Reader) ([]ocispec.Descriptor, error) {
+	logger := log.FromContext(ctx)
+
+	dr, err := decompress(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	defer dr.Close()
+
+	tr := tar.NewReader(dr)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	if hdr.Name != ArchiveHeaderFile {
+		return nil, ErrUnversionedArchive
+	}
+	var header ArchiveHeader
+	if err := json.NewDecoder(tr).Decode(&header); err != nil {
+		return nil, fmt.Errorf("%w: reading header: %w", ErrInvalidArchive, err)
+	}
+	if header.Version < 1 || header.Version > ArchiveVersion {
+		return nil, fmt.Errorf("%w: unsupported version [%d], this release supports up to [%d]", ErrInvalidArchive, header.Version, ArchiveVersion)
+	}
+
+	var index *ocispec.Index
+	blobs := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+
+		name := path.Clean(hdr.Name)
+		switch {
+		case hdr.Typeflag == tar.TypeDir && (name == "blobs" || path.Dir(name) == "blobs"):
+			continue
+
+		case name == ocispec.ImageLayoutFile:
+			var layout ocispec.ImageLayout
+			if err := json.NewDecoder(tr).Decode(&layout); err != nil {
+				return nil, fmt.Errorf("%w: reading [%s]: %w", ErrInvalidArchive, name, err)
+			}
+			if layout.Version != ocispec.ImageLayoutVersion {
+				return nil, fmt.Errorf("%w: unsupported oci layout version [%s]", ErrInvalidArchive, layout.Version)
+			}
+
+		case name == consts.OCIImageIndexFile:
+			index = &ocispec.Index{}
+			if err := json.NewDecoder(tr).Decode(index); err != nil {
+				return nil, fmt.Errorf("%w: reading [%s]: %w", ErrInvalidArchive, name, err)
+			}
+
+		case hdr.Typeflag == tar.TypeReg && path.Dir(path.Dir(name)) == "blobs":
+			d := digest.NewDigestFromEncoded(digest.Algorithm(path.Base(path.Dir(name))), path.Base(name))
+			if err := d.Validate(); err != nil {
+				return nil, fmt.Errorf("%w: blob [%s]: %w", ErrInvalidArchive, name, err)
+			}
+			if err := l.loadBlob(d, tr); err != nil {
+				return nil, err
+			}
+			blobs++
+
+		default:
+			return nil, fmt.Errorf("%w: unexpected entry [%s]", ErrInvalidArchive, hdr.Name)
+		}
+	}
+
+	if blobs != header.Blobs {
+		return nil, fmt.Errorf("%w: holds [%d] blobs, expected [%d]", ErrInvalidArchive, blobs, header.Blobs)
+	}
+	if index == nil {
+		return nil, fmt.Errorf("%w: missing [%s]", ErrInvalidArchive, consts.OCIImageIndexFile)
+	}
+	if len(index.Manifests) != header.References {
+		return nil, fmt.Errorf("%w: holds [%d] references, expected [%d]", ErrInvalidArchive, len(index.Manifests), header.References)
+	}
+
+	// the archive's blobs are all in the store now, make sure they complete everything its index references
+	if _, err := l.collectBlobs(ctx, index.Manifests); err != nil {
+		if header.Delta {
+			return nil, fmt.Errorf("%w: %w", ErrIncompleteDelta, err)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+
+	for _, desc := range index.Manifests {
+		if err := l.addIndex(AuditLoad, desc); err != nil {
+			return nil, err
+		}
+		logger.Debugf("loaded [%s]", desc.Annotations[ocispec.AnnotationRefName])
+	}
+	return index.Manifests, nil
+}
+
+// loadBlob verifies the blob read from r against d and moves it into the store, unless the store already holds it
+func (l *Layout) loadBlob(d digest.Digest, r io.Reader) error {
+	if err := l.copyBlob(d, r); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	return nil
+}
+
+// copyBlob verifies the blob read from r against d and moves it into the store, unless the store already holds it
+func (l *Layout) copyBlob(d digest.Digest, r io.Reader) error {
+	dir := filepath.Join(l.Root, "blobs", d.Algorithm().String())
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	dst := filepath.Join(dir, d.Encoded())
+	if _, err := os.Stat(dst); err == nil {
+		// stored blobs were verified when they were written, this one still has to be read to reach the next entry
+		verifier := d.Verifier()
+		if _, err := io.Copy(verifier, r); err != nil {
+			return fmt.Errorf("blob [%s]: %w", d, err)
+		}
+		if !verifier.Verified() {
+			return fmt.Errorf("blob [%s] does not match its digest", d)
+		}
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(dir, d.Encoded()+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	verifier := d.Verifier()
+	if _, err := io.Copy(io.MultiWriter(tmp, verifier), r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("blob [%s]: %w", d, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("blob [%s] does not match its digest", d)
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+var (
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// decompress detects the compression of r from its leading bytes, returning a reader of the uncompressed stream
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	}
+	return io.NopCloser(br), nil
+}
+
+func compress(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionZstd:
+		// a single encoder goroutine keeps the output identical between runs and machines
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	case CompressionGzip:
+		// the header is left empty, so it carries no name or modification time
+		return gzip.NewWriter(w), nil
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("unsupported compression [%s]", c)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+)
+
+// AuditLogFile is the append-only log of every mutation of a store, kept in its root beside the oci layout so it
+// outlives Flush
+const AuditLogFile = "audit.log"
+
+// AuditAction is the kind of mutation recorded in the audit log
+type AuditAction string
+
+const (
+	AuditAdd    AuditAction = "add"
+	AuditRemove AuditAction = "remove"
+	AuditFlush  AuditAction = "flush"
+	AuditLoad   AuditAction = "load"
+)
+
+// AuditEntry is a single mutation of the store: who made it, from where, when, and to which reference
+type AuditEntry struct {
+	Time      time.Time     `json:"time"`
+	Action    AuditAction   `json:"action"`
+	User      string        `json:"user"`
+	Host      string        `json:"host,omitempty"`
+	Reference string        `json:"reference,omitempty"`
+	Kind      string        `json:"kind,omitempty"`
+	Digest    digest.Digest `json:"digest,omitempty"`
+}
+
+var (
+	auditIdentityOnce sync.Once
+	auditUser         string
+	auditHost         string
+)
+
+// auditIdentity returns the user and host mutations of the store are recorded against
+func auditIdentity() (string, string) {
+	auditIdentityOnce.Do(func() {
+		if u, err := user.Current(); err == nil {
+			auditUser = u.Username
+		}
+		if auditUser == "" {
+			auditUser = os.Getenv("USER")
+		}
+		if auditUser == "" {
+			auditUser = "unknown"
+		}
+		auditHost, _ = os.Hostname()
+	})
+	return auditUser, auditHost
+}
+
+// Audit appends an entry for every one of descs to the audit log of the store, or a single entry without a reference
+// when descs is empty
+//
+//	The entries are appended with a single write, so concurrent mutations never interleave their lines.  Failing to
+//	record a mutation fails the mutation, an unaudited change must never pass silently.
+func (l *Layout) Audit(action AuditAction, descs ...ocispec.Descriptor) error {
+	who, host := auditIdentity()
+	now := time.Now().UTC()
+
+	entries := make([]AuditEntry, 0, len(descs))
+	for _, desc := range descs {
+		entries = append(entries, AuditEntry{
+			Time:      now,
+			Action:    action,
+			User:      who,
+			Host:      host,
+			Reference: desc.Annotations[ocispec.AnnotationRefName],
+			Kind:      desc.Annotations[consts.KindAnnotationName],
+			Digest:    desc.Digest,
+		})
+	}
+	if len(descs) == 0 {
+		entries = append(entries, AuditEntry{Time: now, Action: action, User: who, Host: host})
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Join(l.Root, AuditLogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("recording [%s] in the audit log: %w", action, err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("recording [%s] in the audit log: %w", action, err)
+	}
+	return f.Close()
+}
+
+// addIndex adds desc to the index of the store, recording it in the audit log as action
+func (l *Layout) addIndex(action AuditAction, desc ocispec.Descriptor) error {
+	if err := l.OCI.AddIndex(desc); err != nil {
+		return err
+	}
+	return l.Audit(action, desc)
+}
+
+// History returns every entry of the audit log of the store, oldest first, and none for a store never mutated
+func (l *Layout) History() ([]AuditEntry, error) {
+	f, err := os.Open(filepath.Join(l.Root, AuditLogFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("reading line [%d] of the audit log: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+)
+
+// Chart is a helm chart in the store
+type Chart struct {
+	// Reference is the reference the chart is stored as
+	Reference string
+
+	// Metadata is the Chart.yaml of the chart, as recorded in its config
+	Metadata *chart.Metadata
+
+	// Archive is the descriptor of the chart archive
+	Archive ocispec.Descriptor
+
+	// Provenance is the descriptor of the provenance file of the chart, nil when it was stored without one
+	Provenance *ocispec.Descriptor
+}
+
+// Charts maps the archive filename of every chart in the store to the chart
+//
+//	Filenames are the ones the charts were fetched as, <name>-<version>.tgz when unknown.  When several references
+//	hold a chart of the same filename, the chart of the first reference in sorted order wins.
+func (l *Layout) Charts(ctx context.Context) (map[string]Chart, error) {
+	var refs []string
+	manifests := make(map[string]ocispec.Descriptor)
+	err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		if desc.MediaType != consts.OCIManifestSchema1 {
+			return nil
+		}
+		refs = append(refs, reference)
+		manifests[reference] = desc
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(refs)
+
+	charts := make(map[string]Chart)
+	for _, ref := range refs {
+		c, ok, err := l.chart(ctx, manifests[ref])
+		if err != nil {
+			return nil, fmt.Errorf("reading chart [%s]: %w", ref, err)
+		}
+		if !ok {
+			continue
+		}
+		c.Reference = ref
+
+		name := path.Base(c.Archive.Annotations[ocispec.AnnotationTitle])
+		if name == "." || name == "/" || name == ".." {
+			name = fmt.Sprintf("%s-%s.tgz", c.Metadata.Name, c.Metadata.Version)
+		}
+		if _, ok := charts[name]; !ok {
+			charts[name] = c
+		}
+	}
+	return charts, nil
+}
+
+// chart returns the chart of the manifest desc, or false if it isn't a chart
+func (l *Layout) chart(ctx context.Context, desc ocispec.Descriptor) (Chart, bool, error) {
+	rc, err := l.OCI.Fetch(ctx, desc)
+	if err != nil {
+		return Chart{}, false, err
+	}
+	defer rc.Close()
+
+	var m ocispec.Manifest
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return Chart{}, false, err
+	}
+	if m.Config.MediaType != consts.ChartConfigMediaType {
+		return Chart{}, false, nil
+	}
+
+	var c Chart
+	for i, layer := range m.Layers {
+		switch layer.MediaType {
+		case consts.ChartLayerMediaType:
+			c.Archive = layer
+		case consts.ProvLayerMediaType:
+			c.Provenance = &m.Layers[i]
+		}
+	}
+	if c.Archive.Digest == "" {
+		return Chart{}, false, nil
+	}
+
+	crc, err := l.OCI.Fetch(ctx, m.Config)
+	if err != nil {
+		return Chart{}, false, err
+	}
+	defer crc.Close()
+
+	c.Metadata = &chart.Metadata{}
+	if err := json.NewDecoder(crc).Decode(c.Metadata); err != nil {
+		return Chart{}, false, err
+	}
+	return c, true, nil
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"sort"
+)
+
+// Diff is what changed between two stores, keyed by each artifact's reference and kind
+type Diff struct {
+	Added   []Artifact `json:"added"`
+	Removed []Artifact `json:"removed"`
+	Changed []Change   `json:"changed"`
+}
+
+// Change is an artifact whose reference resolves to different content in each store
+type Change struct {
+	Reference string   `json:"reference"`
+	Kind      string   `json:"kind,omitempty"`
+	From      Artifact `json:"from"`
+	To        Artifact `json:"to"`
+}
+
+// IsEmpty reports whether the two stores hold the same references at the same digests
+func (d Diff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff compares the store against base, reporting the artifacts added to, removed from, or changed in the store
+// since base
+func (l *Layout) Diff(ctx context.Context, base *Layout) (Diff, error) {
+	from, err := base.List(ctx)
+	if err != nil {
+		return Diff{}, err
+	}
+	to, err := l.List(ctx)
+	if err != nil {
+		return Diff{}, err
+	}
+	return DiffArtifacts(from, to), nil
+}
+
+// DiffArtifacts compares two listings of artifacts, as returned by List, reporting what changed from from to to
+func DiffArtifacts(from []Artifact, to []Artifact) Diff {
+	type key struct{ reference, kind string }
+
+	before := make(map[key]Artifact, len(from))
+	for _, a := range from {
+		before[key{a.Reference, a.Kind}] = a
+	}
+
+	d := Diff{
+		Added:   []Artifact{},
+		Removed: []Artifact{},
+		Changed: []Change{},
+	}
+	seen := make(map[key]bool, len(to))
+	for _, a := range to {
+		k := key{a.Reference, a.Kind}
+		seen[k] = true
+
+		b, ok := before[k]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, a)
+		case b.Digest != a.Digest:
+			d.Changed = append(d.Changed, Change{Reference: a.Reference, Kind: a.Kind, From: b, To: a})
+		}
+	}
+	for _, b := range from {
+		if !seen[key{b.Reference, b.Kind}] {
+			d.Removed = append(d.Removed, b)
+		}
+	}
+
+	sortArtifacts(d.Added)
+	sortArtifacts(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool {
+		if d.Changed[i].Reference != d.Changed[j].Reference {
+			return d.Changed[i].Reference < d.Changed[j].Reference
+		}
+		return d.Changed[i].Kind < d.Changed[j].Kind
+	})
+	return d
+}
+
+func sortArtifacts(as []Artifact) {
+	sort.Slice(as, func(i, j int) bool {
+		if as[i].Reference != as[j].Reference {
+			return as[i].Reference < as[j].Reference
+		}
+		return as[i].Kind < as[j].Kind
+	})
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/platforms"
+	gname "github.com/google/go-containerregistry/pkg/name"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/report"
+)
+
+// ExportDockerArchive writes the images of refs to w in the format of docker save, for docker load and ctr images
+// import on hosts without any registry
+//
+//	A docker archive holds a single platform of each image, so multi-platform images are narrowed to the manifest of
+//	platform.  Each image is tagged with its reference name, but for references by digest which docker loads untagged,
+//	and images of docker hub are named docker.io as docker and containerd name them.
+func (l *Layout) ExportDockerArchive(ctx context.Context, w io.Writer, refs []string, platform ocispec.Platform) error {
+	if len(refs) == 0 {
+		return fmt.Errorf("at least one reference is required")
+	}
+
+	root, err := layout.Path(l.Root).ImageIndex()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	images := make(map[gname.Reference]gv1.Image)
+	var order []gname.Reference
+	names := make(map[gname.Reference]string)
+	for _, ref := range refs {
+		img, refName, err := l.runtimeImage(ctx, root, ref, platform)
+		if err != nil {
+			return err
+		}
+		r, err := dockerName(refName)
+		if err != nil {
+			return err
+		}
+		images[r] = img
+		names[r] = refName
+		order = append(order, r)
+	}
+	if err := tarball.MultiRefWrite(images, w); err != nil {
+		return err
+	}
+
+	// the images are written together, so each is recorded with the duration of the whole archive
+	if rep := report.FromContext(ctx); rep != nil {
+		for _, r := range order {
+			img := images[r]
+			e := report.Entry{
+				Kind:      consts.KindAnnotation,
+				Reference: names[r],
+				Duration:  time.Since(start),
+				Status:    report.StatusSucceeded,
+			}
+			if d, err := img.Digest(); err == nil {
+				e.Digest = d.String()
+			}
+			if m, err := img.Manifest(); err == nil {
+				e.Size = m.Config.Size
+				for _, lyr := range m.Layers {
+					e.Size += lyr.Size
+				}
+			}
+			if n, err := img.Size(); err == nil {
+				e.Size += n
+			}
+			rep.Record(e)
+		}
+	}
+	return nil
+}
+
+// runtimeImage returns the image of ref for platform along with its reference name, erroring if ref isn't an image
+func (l *Layout) runtimeImage(ctx context.Context, root gv1.ImageIndex, ref string, platform ocispec.Platform) (gv1.Image, string, error) {
+	desc, err := l.Stat(ctx, ref)
+	if err != nil {
+		return nil, "", err
+	}
+	refName := desc.Annotations[ocispec.AnnotationRefName]
+	if !strings.HasPrefix(desc.Annotations[consts.KindAnnotationName], consts.KindAnnotation) {
+		return nil, "", fmt.Errorf("[%s] is not an image", refName)
+	}
+
+	img, err := dockerImage(root, desc, platform)
+	if err != nil {
+		return nil, "", fmt.Errorf("[%s]: %w", refName, err)
+	}
+	return img, refName, nil
+}
+
+// dockerName returns the name of ref tagged in a docker archive, docker hub being named docker.io as both docker and
+// containerd name it, containerd importing index.docker.io as a registry of its own
+func dockerName(ref string) (gname.Reference, error) {
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	if r.Context().RegistryStr() != gname.DefaultRegistry {
+		return r, nil
+	}
+	sep := ":"
+	if _, ok := r.(gname.Digest); ok {
+		sep = "@"
+	}
+	return gname.ParseReference("docker.io/" + r.Context().RepositoryStr() + sep + r.Identifier())
+}
+
+// dockerImage returns the image of desc, the manifest of platform when desc is an index
+func dockerImage(root gv1.ImageIndex, desc ocispec.Descriptor, platform ocispec.Platform) (gv1.Image, error) {
+	h, err := gv1.NewHash(desc.Digest.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var img gv1.Image
+	switch types.MediaType(desc.MediaType) {
+	case types.OCIImageIndex, types.DockerManifestList:
+		idx, err := root.ImageIndex(h)
+		if err != nil {
+			return nil, err
+		}
+		manifest, err := idx.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		m := platforms.Only(platform)
+		for _, d := range manifest.Manifests {
+			if d.Platform == nil || !d.MediaType.IsImage() {
+				continue
+			}
+			if m.Match(ocispec.Platform{OS: d.Platform.OS, Architecture: d.Platform.Architecture, Variant: d.Platform.Variant}) {
+				img, err = idx.Image(d.Digest)
+				if err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+		if img == nil {
+			return nil, fmt.Errorf("%w: holds no image of [%s]", ErrNoMatchingPlatform, platforms.Format(platform))
+		}
+
+	case types.OCIManifestSchema1, types.DockerManifestSchema2:
+		img, err = root.Image(h)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported media type [%s]", desc.MediaType)
+	}
+
+	// artifacts such as charts and wasm modules are stored in image manifests, but aren't images a runtime can load
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	if m.Config.MediaType != types.OCIConfigJSON && m.Config.MediaType != types.DockerConfigJSON {
+		return nil, fmt.Errorf("config of media type [%s] is not an image config", m.Config.MediaType)
+	}
+	return img, nil
+}
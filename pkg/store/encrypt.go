@@ -0,0 +1,102 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// EncryptedSuffix is the extension of archives encrypted with age, after that of their compression
+const EncryptedSuffix = ".age"
+
+// ErrEncryptedArchive is returned when decrypting an encrypted archive without any identity to decrypt it with
+var ErrEncryptedArchive = errors.New("archive is encrypted")
+
+// ageHeader is how every age encrypted file starts
+var ageHeader = []byte("age-encryption.org/v1\n")
+
+// ParseRecipients parses the age recipients of an encrypted archive, each value either a public key such as 'age1...'
+// or the path to a file of them, one per line
+func ParseRecipients(values ...string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, v := range values {
+		if strings.HasPrefix(v, "age1") {
+			r, err := age.ParseX25519Recipient(v)
+			if err != nil {
+				return nil, err
+			}
+			recipients = append(recipients, r)
+			continue
+		}
+
+		f, err := os.Open(v)
+		if err != nil {
+			return nil, fmt.Errorf("reading recipients [%s]: %w", v, err)
+		}
+		rs, err := age.ParseRecipients(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading recipients [%s]: %w", v, err)
+		}
+		recipients = append(recipients, rs...)
+	}
+	return recipients, nil
+}
+
+// ParseIdentities parses the age identity files at paths, such as those written by age-keygen
+func ParseIdentities(paths ...string) ([]age.Identity, error) {
+	var identities []age.Identity
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading identities [%s]: %w", p, err)
+		}
+		ids, err := age.ParseIdentities(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading identities [%s]: %w", p, err)
+		}
+		identities = append(identities, ids...)
+	}
+	return identities, nil
+}
+
+// Encrypt returns a writer encrypting everything written to it to w, decryptable by any of recipients
+//
+//	Close must be called to write the final chunk of the encrypted archive.  Recipients are either public keys or a
+//	single passphrase recipient, as age doesn't allow mixing the two.
+func Encrypt(w io.Writer, recipients ...age.Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("encrypting requires at least one recipient or a passphrase")
+	}
+	return age.Encrypt(w, recipients...)
+}
+
+// Decrypt returns a reader of r decrypted with identities when r is an encrypted archive, and of r unchanged otherwise
+//
+//	Archives that aren't encrypted are read the same as before, so callers needn't know in advance which they have.
+func Decrypt(r io.Reader, identities ...age.Identity) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(len(ageHeader))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(header, ageHeader) {
+		return br, nil
+	}
+
+	if len(identities) == 0 {
+		return nil, ErrEncryptedArchive
+	}
+	dr, err := age.Decrypt(br, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting archive: %w", err)
+	}
+	return dr, nil
+}
@@ -0,0 +1,341 @@
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/report"
+)
+
+// ExportRefs writes an oci-archive to w holding only refs and the content transitively reachable from them
+//
+//	Each ref is matched against the reference names in the store, and every index entry sharing that name is included
+//	so signatures and attestations travel with their image.  Every ref is resolved and all of its content checked
+//	before anything is written, so a missing reference or blob never leaves a partial archive behind.
+func (l *Layout) ExportRefs(ctx context.Context, w io.Writer, refs []string) error {
+	if len(refs) == 0 {
+		return fmt.Errorf("at least one reference is required")
+	}
+
+	manifests, err := l.matchRefs(refs)
+	if err != nil {
+		return err
+	}
+
+	blobs, err := l.collectBlobs(ctx, manifests)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	if err := l.writeLayout(tw, manifests, blobs); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// LayoutWriter receives the files of an oci layout written by WriteLayout, names being relative to the root of the layout
+type LayoutWriter interface {
+	// Exists reports whether the file name already holds size bytes, blobs being content addressed it's then skipped
+	Exists(ctx context.Context, name string, size int64) (bool, error)
+
+	// Write writes the file name with the content of r
+	Write(ctx context.Context, name string, r io.Reader) error
+}
+
+// WriteLayout writes an oci layout to w holding only refs and the content transitively reachable from them, returning
+// its index entries
+//
+//	refs are matched the same way as ExportRefs, so signatures and attestations travel with their image, and are all
+//	resolved and checked before anything is written.  Blobs w already holds are skipped, so an interrupted write is
+//	resumed, and the index goes last so an interrupted write is never mistaken for a complete layout.
+func (l *Layout) WriteLayout(ctx context.Context, w LayoutWriter, refs []string) ([]ocispec.Descriptor, error) {
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("at least one reference is required")
+	}
+	start := time.Now()
+
+	manifests, err := l.matchRefs(refs)
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := l.collectBlobs(ctx, manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	if err != nil {
+		return nil, err
+	}
+	index, err := json.Marshal(ocispec.Index{
+		Versioned: specs.Versioned{
+			SchemaVersion: 2,
+		},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: manifests,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range blobs {
+		name := path.Join("blobs", b.Digest.Algorithm().String(), b.Digest.Encoded())
+		if exists, err := w.Exists(ctx, name, b.Size); err != nil {
+			return nil, err
+		} else if exists {
+			continue
+		}
+
+		f, err := l.OpenBlob(b.Digest)
+		if err != nil {
+			return nil, err
+		}
+		err = w.Write(ctx, name, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("writing blob [%s]: %w", b.Digest, err)
+		}
+	}
+
+	if err := w.Write(ctx, ocispec.ImageLayoutFile, bytes.NewReader(layout)); err != nil {
+		return nil, err
+	}
+	if err := w.Write(ctx, consts.OCIImageIndexFile, bytes.NewReader(index)); err != nil {
+		return nil, err
+	}
+
+	// the references are written together, so each is recorded with the duration of the whole layout
+	if r := report.FromContext(ctx); r != nil {
+		for _, m := range manifests {
+			r.Record(copyEntry("", "", m, l.graphSize(ctx, m), start, nil))
+		}
+	}
+	return manifests, nil
+}
+
+// ExportLayout writes a fresh oci layout to dir with WriteLayout, dir must not exist or be empty so no layout is ever
+// mixed into another
+func (l *Layout) ExportLayout(ctx context.Context, dir string, refs []string) ([]ocispec.Descriptor, error) {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("layout directory [%s] is not empty", dir)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return l.WriteLayout(ctx, dirLayout(dir), refs)
+}
+
+// dirLayout writes an oci layout to the directory it names
+type dirLayout string
+
+func (d dirLayout) Exists(_ context.Context, name string, size int64) (bool, error) {
+	fi, err := os.Stat(filepath.Join(string(d), filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return fi.Size() == size, nil
+}
+
+func (d dirLayout) Write(_ context.Context, name string, r io.Reader) error {
+	p := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeLayout writes an oci layout to tw with manifests as its index, holding blobs as collected by collectBlobs
+//
+//	Entries are written in a fixed order with fixed metadata, so the same content always produces the same bytes
+func (l *Layout) writeLayout(tw *tar.Writer, manifests []ocispec.Descriptor, blobs []ocispec.Descriptor) error {
+	layout, err := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+	index, err := json.Marshal(ocispec.Index{
+		Versioned: specs.Versioned{
+			SchemaVersion: 2,
+		},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: manifests,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writeTarFile(tw, ocispec.ImageLayoutFile, layout); err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, consts.OCIImageIndexFile, index); err != nil {
+		return err
+	}
+
+	if err := writeTarDir(tw, "blobs"); err != nil {
+		return err
+	}
+	dirs := make(map[string]bool)
+	for _, b := range blobs {
+		dir := path.Join("blobs", b.Digest.Algorithm().String())
+		if !dirs[dir] {
+			dirs[dir] = true
+			if err := writeTarDir(tw, dir); err != nil {
+				return err
+			}
+		}
+
+		if err := l.writeTarBlob(tw, path.Join(dir, b.Digest.Encoded()), b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectBlobs returns every unique blob reachable from manifests sorted by digest, erroring if any are missing
+func (l *Layout) collectBlobs(ctx context.Context, manifests []ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	seen := make(map[digest.Digest]bool)
+	var blobs []ocispec.Descriptor
+	for _, m := range manifests {
+		if err := l.walkGraph(ctx, m, func(d ocispec.Descriptor) error {
+			if seen[d.Digest] {
+				return nil
+			}
+			seen[d.Digest] = true
+
+			if err := l.checkBlob(d); err != nil {
+				return fmt.Errorf("exporting [%s]: blob [%s]: %w", m.Annotations[ocispec.AnnotationRefName], d.Digest, err)
+			}
+			blobs = append(blobs, d)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Digest < blobs[j].Digest })
+	return blobs, nil
+}
+
+// matchRefs returns the index entries of the store matching any of refs, erroring if any of refs match nothing
+//
+//	References are matched the same way as Stat, so tags, digests, and omitted defaults are all accepted
+func (l *Layout) matchRefs(refs []string) ([]ocispec.Descriptor, error) {
+	matchers := make([]*refMatcher, len(refs))
+	for i, ref := range refs {
+		m, err := newRefMatcher(ref)
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = m
+	}
+
+	matched := make(map[string]bool)
+	var descs []ocispec.Descriptor
+	if err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		found := false
+		for i, m := range matchers {
+			if m.matches(desc) {
+				matched[refs[i]] = true
+				found = true
+			}
+		}
+		if found {
+			descs = append(descs, desc)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, ref := range refs {
+		if !matched[ref] {
+			missing = append(missing, ref)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: [%s]", ErrReferenceNotFound, strings.Join(missing, ", "))
+	}
+
+	sortIndex(descs)
+	return descs, nil
+}
+
+// sortIndex orders index entries by reference name and kind, the index itself is unordered so archives stay reproducible
+func sortIndex(descs []ocispec.Descriptor) {
+	sort.Slice(descs, func(i, j int) bool {
+		ni, nj := descs[i].Annotations[ocispec.AnnotationRefName], descs[j].Annotations[ocispec.AnnotationRefName]
+		if ni != nj {
+			return ni < nj
+		}
+		ki, kj := descs[i].Annotations[consts.KindAnnotationName], descs[j].Annotations[consts.KindAnnotationName]
+		if ki != kj {
+			return ki < kj
+		}
+		return descs[i].Digest < descs[j].Digest
+	})
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func writeTarDir(tw *tar.Writer, name string) error {
+	return tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+	})
+}
+
+func (l *Layout) writeTarBlob(tw *tar.Writer, name string, desc ocispec.Descriptor) error {
+	f, err := os.Open(filepath.Join(l.Root, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     desc.Size,
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,16 @@
+package store
+
+import (
+	"oras.land/oras-go/pkg/target"
+)
+
+// Exported for testing only
+
+var (
+	ByteCount  = byteCount
+	Throughput = throughput
+)
+
+func NewProgressTarget(to target.Target) *progressTarget {
+	return newProgressTarget(to, nil)
+}
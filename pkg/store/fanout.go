@@ -0,0 +1,482 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/oras"
+	"oras.land/oras-go/pkg/target"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/progress"
+	"github.com/rancherfederal/hauler/pkg/report"
+	"github.com/rancherfederal/hauler/pkg/telemetry"
+)
+
+// Destination is one of the targets CopyAllTo copies the store's content to
+type Destination struct {
+	// Name identifies the destination in logs and errors, such as the registry's hostname
+	Name string
+
+	Target target.Target
+
+	// Mapper is given each reference name and returns the reference to copy it to, as with CopyAll's toMapper
+	Mapper func(string) (string, error)
+}
+
+// DestinationError reports the failure of a single Destination during CopyAllTo
+type DestinationError struct {
+	Name      string
+	Reference string
+	Err       error
+}
+
+func (e *DestinationError) Error() string {
+	return fmt.Sprintf("copying [%s] to [%s]: %v", e.Reference, e.Name, e.Err)
+}
+
+func (e *DestinationError) Unwrap() error {
+	return e.Err
+}
+
+// CopyAllTo performs CopyAll against several destinations at once, reading each reference's content from the store a
+// single time and fanning the writes out to every destination
+//
+//	A destination that fails is reported as a *DestinationError and dropped for the remaining references, while the
+//	other destinations carry on.  The returned error joins the errors of every failed destination, alongside the
+//	descriptors that were copied to at least one destination.  WithStrictDestinations aborts on the first failure.
+func (l *Layout) CopyAllTo(ctx context.Context, dests []Destination, opts ...CopyOption) (_ []ocispec.Descriptor, err error) {
+	ctx, span := telemetry.Start(ctx, "store.CopyAllTo")
+	defer func() { telemetry.End(span, err) }()
+
+	logger := log.FromContext(ctx)
+	o := makeCopyOpts(opts...)
+
+	images, err := l.imageDigests()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		descs   []ocispec.Descriptor
+		errs    []error
+		aborted bool
+	)
+	failed := make([]bool, len(dests))
+
+	// fail records the failure of dests[i], returning an error only when it should abort the copy
+	fail := func(i int, reference string, err error) error {
+		derr := &DestinationError{Name: dests[i].Name, Reference: reference, Err: err}
+		report.FromContext(ctx).Record(report.Entry{
+			Reference:   reference,
+			Destination: dests[i].Name,
+			Status:      report.StatusFailed,
+			Error:       err.Error(),
+		})
+		if o.strictDestinations {
+			return derr
+		}
+		logger.Errorf("%v, skipping remaining content for [%s]", derr, dests[i].Name)
+		failed[i] = true
+		errs = append(errs, derr)
+		return nil
+	}
+
+	err = l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		// Walk visits every reference regardless of errors, so stop doing work once we've given up
+		if aborted {
+			return nil
+		}
+
+		if !o.selector.Matches(desc.Annotations) || !o.refFilter.Matches(desc.Annotations[ocispec.AnnotationRefName]) {
+			return nil
+		}
+
+		if err := o.checkDigest(desc.Digest); err != nil {
+			if o.strictDigests {
+				aborted = true
+				return fmt.Errorf("copying [%s]: %w", reference, err)
+			}
+			logger.Warnf("skipping [%s]: %v", reference, err)
+			e := copyEntry(reference, "", desc, 0, time.Now(), err)
+			e.Status = report.StatusSkipped
+			report.FromContext(ctx).Record(e)
+			return nil
+		}
+
+		var members []*fanoutMember
+		for i, d := range dests {
+			if failed[i] {
+				continue
+			}
+
+			toRef, err := mapRef(d.Mapper, desc, images)
+			if err != nil {
+				if err := fail(i, reference, err); err != nil {
+					aborted = true
+					return err
+				}
+				continue
+			}
+			members = append(members, &fanoutMember{index: i, name: d.Name, target: d.Target, ref: toRef})
+		}
+		if len(members) == 0 {
+			return nil
+		}
+
+		root, err := l.copyFanout(ctx, reference, members, o)
+		if err != nil {
+			aborted = true
+			return err
+		}
+
+		copied := false
+		for _, m := range members {
+			if m.err == nil {
+				copied = true
+				continue
+			}
+			if err := fail(m.index, reference, m.err); err != nil {
+				aborted = true
+				return err
+			}
+		}
+		if copied {
+			descs = append(descs, root)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return descs, errors.Join(errs...)
+}
+
+// copyFanout copies ref to every member, recording each member's failure on the member itself
+//
+//	An error is only returned when the copy failed for reasons other than the members, such as reading the store
+func (l *Layout) copyFanout(ctx context.Context, ref string, members []*fanoutMember, o *copyOpts) (_ ocispec.Descriptor, err error) {
+	ctx, span := telemetry.Start(ctx, "store.Copy", telemetry.Reference(ref))
+	defer func() { telemetry.End(span, err) }()
+
+	_, root, err := l.OCI.Resolve(ctx, ref)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if root.Digest == "" {
+		return ocispec.Descriptor{}, fmt.Errorf("%w: [%s]", ErrReferenceNotFound, ref)
+	}
+
+	for _, m := range members {
+		if m.ref == "" {
+			m.ref = ref
+		}
+		if o.skipExisting {
+			m.target = l.skipExisting(ctx, m.target, m.ref, root, o.probeConcurrency)
+		}
+	}
+
+	ft := newFanoutTarget(root.Digest, members)
+
+	start := time.Now()
+	size := l.graphSize(ctx, root)
+	span.SetAttributes(telemetry.Digest(root.Digest), telemetry.Bytes(size))
+	task := progress.FromContext(ctx).Track(ref, size)
+	defer task.Done()
+
+	var to target.Target = ft
+	var done func(error)
+	if o.verbose || task != nil {
+		pt := newProgressTarget(to, task)
+		if o.verbose {
+			done = pt.report(ctx, ref, o.progressInterval)
+		}
+		to = pt
+	}
+
+	_, err = oras.Copy(ctx, l.OCI, ref, to, "",
+		oras.WithAdditionalCachedMediaTypes(consts.DockerManifestSchema2, consts.DockerManifestListSchema2))
+	if done != nil {
+		done(err)
+	}
+
+	// every member failing also fails the copy, but that's already recorded against the members
+	if err != nil && ft.live() > 0 {
+		return ocispec.Descriptor{}, err
+	}
+
+	if o.requireDigestMatch {
+		for _, m := range members {
+			if ft.failed(m) {
+				continue
+			}
+			if err := checkDigestMatch(ctx, m.target, m.ref, root.Digest); err != nil {
+				ft.fail(m, err)
+			}
+		}
+	}
+	if ft.live() > 0 {
+		logCopied(ctx, ref, "", root, size, start)
+	}
+	for _, m := range members {
+		// failed members are recorded with the rest of their destination's failures
+		if ft.failed(m) {
+			continue
+		}
+		e := copyEntry(ref, m.ref, root, size, start, nil)
+		e.Destination = m.name
+		report.FromContext(ctx).Record(e)
+	}
+	return root, nil
+}
+
+// fanoutMember is a single destination of a fanoutTarget
+type fanoutMember struct {
+	index  int
+	name   string
+	target target.Target
+	ref    string
+
+	pusher remotes.Pusher
+	err    error
+}
+
+// fanoutTarget is a push-only target.Target that writes everything pushed to it to each of its members, under the
+// member's own reference
+//
+//	A member that errors is dropped and its error recorded, the push carries on for the remaining members until none
+//	are left.  Pushes that every remaining member already holds return errdefs.ErrAlreadyExists so oras.Copy skips them.
+type fanoutTarget struct {
+	root    digest.Digest
+	members []*fanoutMember
+
+	mu sync.Mutex
+}
+
+func newFanoutTarget(root digest.Digest, members []*fanoutMember) *fanoutTarget {
+	return &fanoutTarget{root: root, members: members}
+}
+
+func (t *fanoutTarget) Resolve(_ context.Context, ref string) (string, ocispec.Descriptor, error) {
+	return "", ocispec.Descriptor{}, fmt.Errorf("resolving [%s]: fan-out targets are push only: %w", ref, errdefs.ErrNotImplemented)
+}
+
+func (t *fanoutTarget) Fetcher(_ context.Context, ref string) (remotes.Fetcher, error) {
+	return nil, fmt.Errorf("fetching [%s]: fan-out targets are push only: %w", ref, errdefs.ErrNotImplemented)
+}
+
+// Pusher ignores ref in favor of each member's own reference
+func (t *fanoutTarget) Pusher(ctx context.Context, _ string) (remotes.Pusher, error) {
+	for _, m := range t.members {
+		p, err := m.target.Pusher(ctx, fmt.Sprintf("%s@%s", m.ref, t.root))
+		if err != nil {
+			t.fail(m, err)
+			continue
+		}
+		m.pusher = p
+	}
+
+	if t.live() == 0 {
+		return nil, t.err()
+	}
+	return &fanoutPusher{t: t}, nil
+}
+
+func (t *fanoutTarget) fail(m *fanoutMember, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if m.err == nil {
+		m.err = err
+	}
+}
+
+func (t *fanoutTarget) failed(m *fanoutMember) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return m.err != nil
+}
+
+// live returns the number of members that haven't failed
+func (t *fanoutTarget) live() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := 0
+	for _, m := range t.members {
+		if m.err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// err joins the errors of every failed member
+func (t *fanoutTarget) err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []error
+	for _, m := range t.members {
+		if m.err != nil {
+			errs = append(errs, m.err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type fanoutPusher struct {
+	t *fanoutTarget
+}
+
+func (p *fanoutPusher) Push(ctx context.Context, desc ocispec.Descriptor) (ccontent.Writer, error) {
+	var writers []fanoutMemberWriter
+	for _, m := range p.t.members {
+		if p.t.failed(m) {
+			continue
+		}
+
+		w, err := m.pusher.Push(ctx, desc)
+		switch {
+		case err == nil:
+			writers = append(writers, fanoutMemberWriter{m: m, w: w})
+		case errdefs.IsAlreadyExists(err):
+		default:
+			p.t.fail(m, err)
+		}
+	}
+
+	if len(writers) == 0 {
+		if p.t.live() == 0 {
+			return nil, p.t.err()
+		}
+		return nil, fmt.Errorf("content [%s] on all destinations: %w", desc.Digest, errdefs.ErrAlreadyExists)
+	}
+
+	now := time.Now()
+	return &fanoutWriter{
+		t:        p.t,
+		writers:  writers,
+		digester: digest.Canonical.Digester(),
+		status: ccontent.Status{
+			Ref:       desc.Digest.String(),
+			Total:     desc.Size,
+			StartedAt: now,
+			UpdatedAt: now,
+		},
+	}, nil
+}
+
+type fanoutMemberWriter struct {
+	m *fanoutMember
+	w ccontent.Writer
+}
+
+// fanoutWriter is a content.Writer that tees everything written to it to each live member's writer
+type fanoutWriter struct {
+	t       *fanoutTarget
+	writers []fanoutMemberWriter
+
+	digester digest.Digester
+	status   ccontent.Status
+}
+
+// each runs fn against the writer of every live member concurrently, failing the members it errors for
+//
+//	An error is only returned once no members remain
+func (w *fanoutWriter) each(fn func(ccontent.Writer) error) error {
+	var wg sync.WaitGroup
+	for _, mw := range w.writers {
+		if w.t.failed(mw.m) {
+			continue
+		}
+
+		mw := mw
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(mw.w); err != nil {
+				w.t.fail(mw.m, err)
+				mw.w.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, mw := range w.writers {
+		if !w.t.failed(mw.m) {
+			return nil
+		}
+	}
+	return w.t.err()
+}
+
+func (w *fanoutWriter) Write(p []byte) (int, error) {
+	if err := w.each(func(cw ccontent.Writer) error {
+		n, err := cw.Write(p)
+		if err != nil {
+			return err
+		}
+		if n != len(p) {
+			return io.ErrShortWrite
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	w.digester.Hash().Write(p)
+	w.status.Offset += int64(len(p))
+	w.status.UpdatedAt = time.Now()
+	return len(p), nil
+}
+
+func (w *fanoutWriter) Close() error {
+	for _, mw := range w.writers {
+		if !w.t.failed(mw.m) {
+			mw.w.Close()
+		}
+	}
+	return nil
+}
+
+func (w *fanoutWriter) Digest() digest.Digest {
+	return w.digester.Digest()
+}
+
+func (w *fanoutWriter) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...ccontent.Opt) error {
+	return w.each(func(cw ccontent.Writer) error {
+		if err := cw.Commit(ctx, size, expected, opts...); err != nil && !errdefs.IsAlreadyExists(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (w *fanoutWriter) Status() (ccontent.Status, error) {
+	return w.status, nil
+}
+
+func (w *fanoutWriter) Truncate(size int64) error {
+	if size != 0 {
+		return fmt.Errorf("truncating to [%d]: fan-out writers can only be reset: %w", size, errdefs.ErrNotImplemented)
+	}
+	if err := w.each(func(cw ccontent.Writer) error {
+		return cw.Truncate(0)
+	}); err != nil {
+		return err
+	}
+
+	w.digester = digest.Canonical.Digester()
+	w.status.Offset = 0
+	return nil
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/content"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+)
+
+// Files maps the original filename of every file artifact in the store to the descriptor of its content
+//
+//	Directories added as files are stored as tarballs to be unpacked and are left out.  When several references hold a
+//	file of the same name, the file of the first reference in sorted order wins.
+func (l *Layout) Files(ctx context.Context) (map[string]ocispec.Descriptor, error) {
+	var refs []string
+	manifests := make(map[string]ocispec.Descriptor)
+	err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		if desc.MediaType != consts.OCIManifestSchema1 {
+			return nil
+		}
+		refs = append(refs, reference)
+		manifests[reference] = desc
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(refs)
+
+	files := make(map[string]ocispec.Descriptor)
+	for _, ref := range refs {
+		children, err := l.children(ctx, manifests[ref])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range children {
+			if c.MediaType != consts.FileLayerMediaType || c.Annotations[content.AnnotationUnpack] == "true" {
+				continue
+			}
+			name := path.Base(c.Annotations[ocispec.AnnotationTitle])
+			if name == "." || name == "/" || name == ".." {
+				continue
+			}
+			if _, ok := files[name]; !ok {
+				files[name] = c
+			}
+		}
+	}
+	return files, nil
+}
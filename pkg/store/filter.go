@@ -0,0 +1,80 @@
+package store
+
+import (
+	"fmt"
+	"path"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+)
+
+// RefFilter selects references by glob patterns, as matched by path.Match
+//
+//	A pattern matches a reference if it matches its full name or the name without its registry, each with or without
+//	its tag or digest, so rancher/* matches index.docker.io/rancher/rancher:v2.8.0.  References matching an exclude
+//	pattern are never selected, and when there are include patterns only references matching one of them are.
+type RefFilter struct {
+	include []string
+	exclude []string
+}
+
+// NewRefFilter returns a filter of the include and exclude patterns, failing on any malformed pattern
+func NewRefFilter(include []string, exclude []string) (*RefFilter, error) {
+	for _, p := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern [%s]: %w", p, err)
+		}
+	}
+	return &RefFilter{include: include, exclude: exclude}, nil
+}
+
+// Matches reports whether ref is selected by the filter, a nil or empty filter selects everything
+func (f *RefFilter) Matches(ref string) bool {
+	if f == nil {
+		return true
+	}
+
+	names := refNames(ref)
+	for _, p := range f.exclude {
+		if matchAny(p, names) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if matchAny(p, names) {
+			return true
+		}
+	}
+	return false
+}
+
+// refNames returns the forms of ref patterns are matched against
+func refNames(ref string) []string {
+	names := []string{ref}
+
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		return names
+	}
+	repo := r.Context().RepositoryStr()
+	names = append(names, r.Name(), r.Context().Name(), repo)
+
+	switch v := r.(type) {
+	case gname.Tag:
+		names = append(names, repo+":"+v.TagStr())
+	case gname.Digest:
+		names = append(names, repo+"@"+v.DigestStr())
+	}
+	return names
+}
+
+func matchAny(pattern string, names []string) bool {
+	for _, n := range names {
+		if ok, _ := path.Match(pattern, n); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+// GCResult lists the blobs a garbage collection deleted, or would delete on a dry run, and the bytes they occupy
+type GCResult struct {
+	Blobs []digest.Digest
+	Bytes int64
+}
+
+// GC deletes every blob that isn't reachable from the store's index
+//
+//	Every index entry is marked along with everything it references, including the manifests nested in an index, and any
+//	blob left unmarked is deleted.  A manifest that can't be read fails the collection before anything is deleted, since
+//	the blobs it references can't be told apart from garbage.  Files under blobs/ that aren't named after a digest are
+//	left alone.
+func (l *Layout) GC(ctx context.Context, opts ...GCOption) (GCResult, error) {
+	logger := log.FromContext(ctx)
+	o := makeGCOpts(opts...)
+
+	var roots []ocispec.Descriptor
+	if err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		roots = append(roots, desc)
+		return nil
+	}); err != nil {
+		return GCResult{}, err
+	}
+
+	keep, err := l.mark(ctx, roots, true)
+	if err != nil {
+		return GCResult{}, fmt.Errorf("marking reachable content: %w", err)
+	}
+
+	unreferenced, err := l.unreferencedBlobs(keep)
+	if err != nil {
+		return GCResult{}, err
+	}
+
+	var res GCResult
+	for _, b := range unreferenced {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		if !o.dryRun {
+			if err := l.removeBlob(b.Digest); err != nil {
+				return res, err
+			}
+			logger.Debugf("deleted unreferenced blob [%s]", b.Digest)
+		}
+		res.Blobs = append(res.Blobs, b.Digest)
+		res.Bytes += b.Size
+	}
+	return res, nil
+}
+
+// unreferencedBlobs returns the blobs on disk that aren't in keep, sorted by digest
+func (l *Layout) unreferencedBlobs(keep map[digest.Digest]bool) ([]ocispec.Descriptor, error) {
+	algs, err := os.ReadDir(filepath.Join(l.Root, "blobs"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs []ocispec.Descriptor
+	for _, alg := range algs {
+		if !alg.IsDir() {
+			continue
+		}
+
+		entries, err := os.ReadDir(filepath.Join(l.Root, "blobs", alg.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			d := digest.NewDigestFromEncoded(digest.Algorithm(alg.Name()), e.Name())
+			if e.IsDir() || d.Validate() != nil || keep[d] {
+				continue
+			}
+
+			fi, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			blobs = append(blobs, ocispec.Descriptor{Digest: d, Size: fi.Size()})
+		}
+	}
+
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Digest < blobs[j].Digest })
+	return blobs, nil
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+)
+
+// children returns the descriptors directly referenced by desc, or nil if desc is neither a manifest nor an index
+func (l *Layout) children(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	switch desc.MediaType {
+	case consts.OCIManifestSchema1, consts.DockerManifestSchema2:
+		rc, err := l.OCI.Fetch(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		var m ocispec.Manifest
+		if err := json.NewDecoder(rc).Decode(&m); err != nil {
+			return nil, err
+		}
+		return append([]ocispec.Descriptor{m.Config}, m.Layers...), nil
+
+	case consts.OCIImageIndexSchema, consts.DockerManifestListSchema2:
+		rc, err := l.OCI.Fetch(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		var idx ocispec.Index
+		if err := json.NewDecoder(rc).Decode(&idx); err != nil {
+			return nil, err
+		}
+		return idx.Manifests, nil
+	}
+
+	return nil, nil
+}
+
+// walkGraph calls fn for desc and every descriptor transitively reachable from it, parents before their children
+func (l *Layout) walkGraph(ctx context.Context, desc ocispec.Descriptor, fn func(ocispec.Descriptor) error) error {
+	if err := fn(desc); err != nil {
+		return err
+	}
+
+	children, err := l.children(ctx, desc)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		if err := l.walkGraph(ctx, child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// graphSize returns the size of desc and every unique descriptor reachable from it, 0 if the graph can't be walked
+func (l *Layout) graphSize(ctx context.Context, desc ocispec.Descriptor) int64 {
+	seen := make(map[digest.Digest]bool)
+	var size int64
+	if err := l.walkGraph(ctx, desc, func(d ocispec.Descriptor) error {
+		if !seen[d.Digest] {
+			seen[d.Digest] = true
+			size += d.Size
+		}
+		return nil
+	}); err != nil {
+		return 0
+	}
+	return size
+}
+
+// isManifest reports whether the media type describes a manifest or an index
+func isManifest(mediaType string) bool {
+	switch mediaType {
+	case consts.OCIManifestSchema1, consts.DockerManifestSchema2, consts.OCIImageIndexSchema, consts.DockerManifestListSchema2:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+	"oras.land/oras-go/pkg/target"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+const (
+	defaultProbeConcurrency = 8
+)
+
+// BlobChecker is implemented by targets that can cheaply report whether they already hold a blob, such as a
+// content.Registry.  Copy uses it to avoid re-sending blobs the target already has.
+type BlobChecker interface {
+	Exists(ctx context.Context, ref string, desc ocispec.Descriptor) (bool, error)
+}
+
+// skipExisting wraps to so blobs reachable from desc that it already holds under ref are skipped, returning to as-is
+// when it doesn't implement BlobChecker or can't be probed
+func (l *Layout) skipExisting(ctx context.Context, to target.Target, ref string, desc ocispec.Descriptor, concurrency int) target.Target {
+	logger := log.FromContext(ctx)
+
+	bc, ok := to.(BlobChecker)
+	if !ok {
+		return to
+	}
+
+	existing, err := l.existingBlobs(ctx, bc, ref, desc, concurrency)
+	if err != nil {
+		logger.Debugf("unable to probe [%s] for existing blobs, copying everything: %v", ref, err)
+		return to
+	}
+	if len(existing) == 0 {
+		return to
+	}
+
+	logger.Debugf("skipping [%d] blobs already present on [%s]", len(existing), ref)
+	return newSkipTarget(to, existing)
+}
+
+// existingBlobs probes bc for every blob reachable from desc, returning the digests it already holds under ref
+//
+//	Manifests and indexes are never probed, they're small and must be pushed regardless to update the reference
+func (l *Layout) existingBlobs(ctx context.Context, bc BlobChecker, ref string, desc ocispec.Descriptor, concurrency int) (map[digest.Digest]bool, error) {
+	seen := make(map[digest.Digest]bool)
+	var blobs []ocispec.Descriptor
+	if err := l.walkGraph(ctx, desc, func(d ocispec.Descriptor) error {
+		if !isManifest(d.MediaType) && !seen[d.Digest] {
+			seen[d.Digest] = true
+			blobs = append(blobs, d)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	existing := make(map[digest.Digest]bool)
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for _, b := range blobs {
+		b := b
+		g.Go(func() error {
+			ok, err := bc.Exists(gctx, ref, b)
+			if err != nil {
+				return fmt.Errorf("probing [%s]: %w", b.Digest, err)
+			}
+			if ok {
+				mu.Lock()
+				existing[b.Digest] = true
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// skipTarget wraps a target.Target, refusing to push any of the known existing blobs
+//
+//	oras.Copy treats errdefs.ErrAlreadyExists from a pusher as "nothing to do", so the blob is neither fetched nor sent
+type skipTarget struct {
+	target.Target
+
+	existing map[digest.Digest]bool
+}
+
+func newSkipTarget(to target.Target, existing map[digest.Digest]bool) *skipTarget {
+	return &skipTarget{Target: to, existing: existing}
+}
+
+func (t *skipTarget) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	p, err := t.Target.Pusher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &skipPusher{Pusher: p, existing: t.existing}, nil
+}
+
+type skipPusher struct {
+	remotes.Pusher
+
+	existing map[digest.Digest]bool
+}
+
+func (p *skipPusher) Push(ctx context.Context, desc ocispec.Descriptor) (ccontent.Writer, error) {
+	if p.existing[desc.Digest] {
+		return nil, fmt.Errorf("content [%s] on target: %w", desc.Digest, errdefs.ErrAlreadyExists)
+	}
+	return p.Pusher.Push(ctx, desc)
+}
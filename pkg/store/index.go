@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/reference"
+)
+
+// CreateIndex groups manifests already in the store into an OCI image index tagged as tag
+//
+//	Each member is paired with the platform at the same position in platforms, so the two must be the same length.
+//	Every member must be a manifest whose blob is present in the store; nothing is written if any of them aren't.
+func (l *Layout) CreateIndex(ctx context.Context, tag string, members []ocispec.Descriptor, platforms []ocispec.Platform) (ocispec.Descriptor, error) {
+	if len(members) == 0 {
+		return ocispec.Descriptor{}, fmt.Errorf("an index requires at least one member")
+	}
+	if len(members) != len(platforms) {
+		return ocispec.Descriptor{}, fmt.Errorf("got [%d] members but [%d] platforms", len(members), len(platforms))
+	}
+
+	ref, err := reference.Parse(tag)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	manifests := make([]ocispec.Descriptor, len(members))
+	for i, m := range members {
+		switch m.MediaType {
+		case consts.OCIManifestSchema1, consts.DockerManifestSchema2:
+		default:
+			return ocispec.Descriptor{}, fmt.Errorf("member [%s] is not an image manifest: [%s]", m.Digest, m.MediaType)
+		}
+
+		if err := l.checkBlob(m); err != nil {
+			return ocispec.Descriptor{}, fmt.Errorf("member [%s]: %w", m.Digest, err)
+		}
+
+		p := platforms[i]
+		manifests[i] = ocispec.Descriptor{
+			MediaType: m.MediaType,
+			Digest:    m.Digest,
+			Size:      m.Size,
+			Platform:  &p,
+		}
+	}
+
+	idx := ocispec.Index{
+		Versioned: specs.Versioned{
+			SchemaVersion: 2,
+		},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: manifests,
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := l.writeBlobData(data); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	desc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+		Annotations: map[string]string{
+			consts.KindAnnotationName: consts.KindAnnotationIndex,
+			ocispec.AnnotationRefName: ref.Name(),
+		},
+	}
+	return desc, l.addIndex(AuditAdd, desc)
+}
+
+// checkBlob returns an error if the blob described by desc isn't in the store with the expected size
+func (l *Layout) checkBlob(desc ocispec.Descriptor) error {
+	if err := desc.Digest.Validate(); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(filepath.Join(l.Root, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded()))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("not found in the store")
+		}
+		return err
+	}
+	if fi.Size() != desc.Size {
+		return fmt.Errorf("size [%d] does not match the stored [%d]", desc.Size, fi.Size())
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+)
+
+// Inspection details a single reference of the store, down to the config and layers of each of its manifests
+type Inspection struct {
+	Reference string `json:"reference"`
+
+	// Descriptor is the index entry of the reference, along with its annotations
+	Descriptor ocispec.Descriptor `json:"descriptor"`
+
+	// ArtifactType identifies the content, as returned by Identify
+	ArtifactType string `json:"artifactType"`
+
+	// Index is the index of a multi-platform reference, nil for a single manifest
+	Index *ocispec.Index `json:"index,omitempty"`
+
+	// Manifests are the manifest of the reference, or every manifest of its index in order
+	Manifests []InspectedManifest `json:"manifests"`
+
+	// Attached are the signatures, attestations, sboms, and referrers stored under the same reference
+	Attached []ocispec.Descriptor `json:"attached,omitempty"`
+}
+
+// InspectedManifest is a single manifest of an Inspection
+type InspectedManifest struct {
+	// Descriptor is the descriptor of the manifest, carrying its platform when it's a member of an index
+	Descriptor ocispec.Descriptor `json:"descriptor"`
+
+	Manifest ocispec.Manifest `json:"manifest"`
+
+	// Config is the config of an image, nil for other artifacts whose config hauler can't interpret
+	Config *ocispec.Image `json:"config,omitempty"`
+}
+
+// Size returns the total size of the config and layers of the manifest
+func (m InspectedManifest) Size() int64 {
+	size := m.Manifest.Config.Size
+	for _, l := range m.Manifest.Layers {
+		size += l.Size
+	}
+	return size
+}
+
+// Inspect resolves reference as Stat does and returns the manifests, image configs, and layers making it up
+func (l *Layout) Inspect(ctx context.Context, reference string) (Inspection, error) {
+	desc, err := l.Stat(ctx, reference)
+	if err != nil {
+		return Inspection{}, err
+	}
+
+	in := Inspection{
+		Reference:    desc.Annotations[ocispec.AnnotationRefName],
+		Descriptor:   desc,
+		ArtifactType: l.Identify(ctx, desc),
+	}
+
+	manifests := []ocispec.Descriptor{desc}
+	if desc.MediaType == consts.OCIImageIndexSchema || desc.MediaType == consts.DockerManifestListSchema2 {
+		var idx ocispec.Index
+		if err := l.fetchJSON(ctx, desc, &idx); err != nil {
+			return Inspection{}, err
+		}
+		in.Index = &idx
+		manifests = idx.Manifests
+	}
+
+	for _, md := range manifests {
+		if !isManifest(md.MediaType) {
+			continue
+		}
+		m := InspectedManifest{Descriptor: md}
+		if err := l.fetchJSON(ctx, md, &m.Manifest); err != nil {
+			return Inspection{}, err
+		}
+		if m.Manifest.Config.MediaType == consts.DockerConfigJSON || m.Manifest.Config.MediaType == ocispec.MediaTypeImageConfig {
+			var img ocispec.Image
+			if err := l.fetchJSON(ctx, m.Manifest.Config, &img); err != nil {
+				return Inspection{}, err
+			}
+			m.Config = &img
+		}
+		in.Manifests = append(in.Manifests, m)
+	}
+
+	if err := l.OCI.Walk(func(_ string, d ocispec.Descriptor) error {
+		if d.Annotations[ocispec.AnnotationRefName] == in.Reference &&
+			d.Annotations[consts.KindAnnotationName] != desc.Annotations[consts.KindAnnotationName] {
+			in.Attached = append(in.Attached, d)
+		}
+		return nil
+	}); err != nil {
+		return Inspection{}, err
+	}
+	sortIndex(in.Attached)
+	return in, nil
+}
+
+// fetchJSON decodes the json blob of desc into v
+func (l *Layout) fetchJSON(ctx context.Context, desc ocispec.Descriptor, v interface{}) error {
+	rc, err := l.OCI.Fetch(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
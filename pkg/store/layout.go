@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+var ErrNotInLayout = errors.New("not found in oci layout")
+
+// AddLayout copies the artifacts of the OCI image layout at root into the store blob for blob, preserving their
+// digests and annotations, and returns the index entries it added
+//
+//	Without ref, every manifest of the layout is stored under the reference annotated on it, parsed the way image
+//	references are.  With ref, only the manifest annotated ref or the tag of ref is copied, or the one manifest of the
+//	layout whatever its annotation, and it's stored as ref.  Layouts written by skopeo, oras, and crane annotate
+//	manifests with their tag alone, so they're usually copied with a ref.
+func (l *Layout) AddLayout(ctx context.Context, root string, ref string) ([]ocispec.Descriptor, error) {
+	logger := log.FromContext(ctx)
+
+	var layout ocispec.ImageLayout
+	if err := readJSON(filepath.Join(root, ocispec.ImageLayoutFile), &layout); err != nil {
+		return nil, fmt.Errorf("[%s] is not an oci layout: %w", root, err)
+	}
+	if layout.Version != ocispec.ImageLayoutVersion {
+		return nil, fmt.Errorf("oci layout [%s] has unsupported version [%s]", root, layout.Version)
+	}
+	var index ocispec.Index
+	if err := readJSON(filepath.Join(root, consts.OCIImageIndexFile), &index); err != nil {
+		return nil, fmt.Errorf("reading the index of oci layout [%s]: %w", root, err)
+	}
+
+	selected, err := selectLayoutManifests(index.Manifests, ref)
+	if err != nil {
+		return nil, fmt.Errorf("oci layout [%s]: %w", root, err)
+	}
+
+	copied := make(map[digest.Digest]bool)
+	var added []ocispec.Descriptor
+	for name, desc := range selected {
+		if err := walkLayout(root, desc, func(d ocispec.Descriptor) error {
+			if copied[d.Digest] {
+				return nil
+			}
+			f, err := os.Open(filepath.Join(root, "blobs", d.Digest.Algorithm().String(), d.Digest.Encoded()))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if err := l.copyBlob(d.Digest, f); err != nil {
+				return err
+			}
+			copied[d.Digest] = true
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("copying [%s] from oci layout [%s]: %w", name, root, err)
+		}
+
+		annotations := make(map[string]string, len(desc.Annotations)+2)
+		for k, v := range desc.Annotations {
+			annotations[k] = v
+		}
+		annotations[ocispec.AnnotationRefName] = name
+		if _, ok := annotations[consts.KindAnnotationName]; !ok {
+			annotations[consts.KindAnnotationName] = consts.KindAnnotation
+			if desc.MediaType == consts.OCIImageIndexSchema || desc.MediaType == consts.DockerManifestListSchema2 {
+				annotations[consts.KindAnnotationName] = consts.KindAnnotationIndex
+			}
+		}
+		desc.Annotations = annotations
+
+		if err := l.addIndex(AuditAdd, desc); err != nil {
+			return nil, err
+		}
+		logger.Debugf("copied [%s] from oci layout [%s]", name, root)
+		added = append(added, desc)
+	}
+	return added, nil
+}
+
+// selectLayoutManifests returns the manifests of a layout's index to copy, keyed by the reference to store them as
+func selectLayoutManifests(manifests []ocispec.Descriptor, ref string) (map[string]ocispec.Descriptor, error) {
+	selected := make(map[string]ocispec.Descriptor)
+
+	if ref == "" {
+		for _, desc := range manifests {
+			annotated := desc.Annotations[ocispec.AnnotationRefName]
+			if annotated == "" {
+				return nil, fmt.Errorf("manifest [%s] has no %s annotation, give the reference to store it as", desc.Digest, ocispec.AnnotationRefName)
+			}
+			r, err := gname.ParseReference(annotated)
+			if err != nil {
+				return nil, fmt.Errorf("manifest [%s]: %w", desc.Digest, err)
+			}
+			selected[r.Name()] = desc
+		}
+		return selected, nil
+	}
+
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifests) == 1 {
+		selected[r.Name()] = manifests[0]
+		return selected, nil
+	}
+	for _, desc := range manifests {
+		annotated := desc.Annotations[ocispec.AnnotationRefName]
+		if annotated == ref || annotated == r.Identifier() || annotated == r.Name() {
+			selected[r.Name()] = desc
+			return selected, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: [%s]", ErrNotInLayout, ref)
+}
+
+// walkLayout calls fn for desc and every descriptor transitively reachable from it in the layout at root
+func walkLayout(root string, desc ocispec.Descriptor, fn func(ocispec.Descriptor) error) error {
+	if err := fn(desc); err != nil {
+		return err
+	}
+
+	blob := filepath.Join(root, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded())
+	var children []ocispec.Descriptor
+	switch desc.MediaType {
+	case consts.OCIManifestSchema1, consts.DockerManifestSchema2:
+		var m ocispec.Manifest
+		if err := readJSON(blob, &m); err != nil {
+			return err
+		}
+		children = append([]ocispec.Descriptor{m.Config}, m.Layers...)
+
+	case consts.OCIImageIndexSchema, consts.DockerManifestListSchema2:
+		var idx ocispec.Index
+		if err := readJSON(blob, &idx); err != nil {
+			return err
+		}
+		children = idx.Manifests
+	}
+
+	for _, child := range children {
+		if err := walkLayout(root, child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readJSON(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(v)
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+)
+
+// Artifact summarizes a single reference in the store
+type Artifact struct {
+	Reference string `json:"reference"`
+
+	// Kind is the kind annotation the reference was stored with, e.g. an image, its signatures, or its attestations
+	Kind string `json:"kind,omitempty"`
+
+	// ArtifactType identifies the content, as returned by Identify
+	ArtifactType string `json:"artifactType"`
+
+	MediaType string        `json:"mediaType"`
+	Digest    digest.Digest `json:"digest"`
+
+	// Platforms lists every os/architecture the reference provides, empty for content without a platform
+	Platforms []string `json:"platforms,omitempty"`
+
+	// Size is the total size of every unique blob making up the reference, including its manifests
+	Size int64 `json:"size"`
+}
+
+// List returns a summary of every reference in the store, sorted by reference name and kind
+func (l *Layout) List(ctx context.Context) ([]Artifact, error) {
+	var descs []ocispec.Descriptor
+	if err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		descs = append(descs, desc)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sortIndex(descs)
+
+	artifacts := make([]Artifact, 0, len(descs))
+	for _, desc := range descs {
+		a, err := l.describe(ctx, desc)
+		if err != nil {
+			return nil, fmt.Errorf("listing [%s]: %w", desc.Annotations[ocispec.AnnotationRefName], err)
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, nil
+}
+
+// Describe returns the summary of reference, matched the same way as Stat
+func (l *Layout) Describe(ctx context.Context, reference string) (Artifact, error) {
+	desc, err := l.Stat(ctx, reference)
+	if err != nil {
+		return Artifact{}, err
+	}
+	return l.describe(ctx, desc)
+}
+
+func (l *Layout) describe(ctx context.Context, desc ocispec.Descriptor) (Artifact, error) {
+	a := Artifact{
+		Reference:    desc.Annotations[ocispec.AnnotationRefName],
+		Kind:         desc.Annotations[consts.KindAnnotationName],
+		ArtifactType: l.Identify(ctx, desc),
+		MediaType:    desc.MediaType,
+		Digest:       desc.Digest,
+	}
+
+	seen := make(map[digest.Digest]bool)
+	platforms := make(map[string]bool)
+	if err := l.walkGraph(ctx, desc, func(d ocispec.Descriptor) error {
+		if d.Platform != nil {
+			platforms[platformString(*d.Platform)] = true
+		}
+		if seen[d.Digest] {
+			return nil
+		}
+		seen[d.Digest] = true
+		a.Size += d.Size
+		return nil
+	}); err != nil {
+		return Artifact{}, err
+	}
+
+	if len(platforms) == 0 && (desc.MediaType == consts.OCIManifestSchema1 || desc.MediaType == consts.DockerManifestSchema2) {
+		p, err := l.configPlatform(ctx, desc)
+		if err != nil {
+			return Artifact{}, err
+		}
+		if p != "" {
+			platforms[p] = true
+		}
+	}
+
+	for p := range platforms {
+		a.Platforms = append(a.Platforms, p)
+	}
+	sort.Strings(a.Platforms)
+	return a, nil
+}
+
+// configPlatform returns the platform recorded in an image manifest's config, or nothing if it isn't an image
+func (l *Layout) configPlatform(ctx context.Context, desc ocispec.Descriptor) (string, error) {
+	rc, err := l.OCI.Fetch(ctx, desc)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	var m ocispec.Manifest
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return "", err
+	}
+	if m.Config.MediaType != consts.DockerConfigJSON && m.Config.MediaType != ocispec.MediaTypeImageConfig {
+		return "", nil
+	}
+
+	crc, err := l.OCI.Fetch(ctx, m.Config)
+	if err != nil {
+		return "", err
+	}
+	defer crc.Close()
+
+	var img ocispec.Image
+	if err := json.NewDecoder(crc).Decode(&img); err != nil {
+		return "", err
+	}
+	if img.OS == "" || img.Architecture == "" {
+		return "", nil
+	}
+	return platformString(img.Platform), nil
+}
+
+func platformString(p ocispec.Platform) string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
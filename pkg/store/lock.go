@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+// LockFile is the advisory lock hauler processes take in the root of a store before mutating it
+const LockFile = "hauler.lock"
+
+// lockRetryDelay is how often a lock held by another process is tried again while waiting for it
+const lockRetryDelay = 250 * time.Millisecond
+
+// ErrLocked is returned by Lock when another hauler process holds the store for longer than the lock timeout
+var ErrLocked = errors.New("store is locked by another hauler process")
+
+// storeLock is the lock of a store held by this process, shared by every Layout of the store
+type storeLock struct {
+	lock *flock.Flock
+	held int
+}
+
+var (
+	storeLocksMu sync.Mutex
+	storeLocks   = make(map[string]*storeLock)
+)
+
+// Lock takes the exclusive lock of the store, held until the returned func is called, so parallel hauler processes
+// sharing a store take turns mutating it rather than clobbering each other's index
+//
+//	The lock is advisory, taken on the LockFile in the root of the store, and released by the operating system when
+//	the process exits however it exits.  A lock held by another process is waited for up to the timeout given by
+//	WithLockTimeout, failing with ErrLocked once it's up.  Within a process the lock is reentrant, every Layout of the
+//	store shares it.  Once taken, the index is reloaded, picking up whatever the previous holder changed.
+func (l *Layout) Lock(ctx context.Context) (func() error, error) {
+	path, err := filepath.Abs(filepath.Join(l.Root, LockFile))
+	if err != nil {
+		return nil, err
+	}
+
+	storeLocksMu.Lock()
+	defer storeLocksMu.Unlock()
+
+	sl, ok := storeLocks[path]
+	if !ok {
+		sl = &storeLock{lock: flock.New(path)}
+		if err := l.acquire(ctx, sl.lock); err != nil {
+			return nil, err
+		}
+		storeLocks[path] = sl
+
+		if err := l.OCI.ReloadIndex(); err != nil {
+			sl.lock.Unlock()
+			delete(storeLocks, path)
+			return nil, err
+		}
+	}
+	sl.held++
+
+	var once sync.Once
+	return func() error {
+		var err error
+		once.Do(func() {
+			storeLocksMu.Lock()
+			defer storeLocksMu.Unlock()
+			if sl.held--; sl.held == 0 {
+				delete(storeLocks, path)
+				err = sl.lock.Unlock()
+			}
+		})
+		return err
+	}, nil
+}
+
+// acquire takes lock, waiting for the process holding it up to the lock timeout of the store
+func (l *Layout) acquire(ctx context.Context, lock *flock.Flock) error {
+	ok, err := lock.TryLock()
+	if err != nil {
+		return fmt.Errorf("locking store [%s]: %w", l.Root, err)
+	}
+	if ok {
+		return nil
+	}
+	if l.lockTimeout == 0 {
+		return fmt.Errorf("%w: [%s]", ErrLocked, lock.Path())
+	}
+
+	log.FromContext(ctx).Infof("store [%s] is locked by another hauler process, waiting for it", l.Root)
+	if l.lockTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.lockTimeout)
+		defer cancel()
+	}
+	ok, err = lock.TryLockContext(ctx, lockRetryDelay)
+	if ok {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) && l.lockTimeout > 0 {
+		return fmt.Errorf("%w: [%s], still held after waiting [%s]", ErrLocked, lock.Path(), l.lockTimeout)
+	}
+	return fmt.Errorf("locking store [%s]: %w", l.Root, err)
+}
@@ -0,0 +1,315 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	defaultProgressInterval  = 5 * time.Second
+	defaultVerifyConcurrency = 4
+	defaultAuthRetries       = 2
+	defaultCopyConcurrency   = 4
+	defaultCopyRetries       = 3
+	defaultRetryDelay        = time.Second
+	defaultMaxRetryDelay     = 30 * time.Second
+	defaultLayerConcurrency  = 4
+)
+
+// CopyOption configures the behavior of Copy and CopyAll
+type CopyOption func(*copyOpts)
+
+type copyOpts struct {
+	verbose          bool
+	progressInterval time.Duration
+
+	allowDigests  map[digest.Digest]bool
+	denyDigests   map[digest.Digest]bool
+	strictDigests bool
+
+	skipExisting     bool
+	probeConcurrency int
+
+	strictDestinations bool
+
+	requireDigestMatch bool
+
+	authRetries int
+
+	retries       int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+
+	concurrency int
+
+	selector  Selector
+	refFilter *RefFilter
+}
+
+func makeCopyOpts(opts ...CopyOption) *copyOpts {
+	o := &copyOpts{
+		progressInterval: defaultProgressInterval,
+		skipExisting:     true,
+		probeConcurrency: defaultProbeConcurrency,
+		authRetries:      defaultAuthRetries,
+		retries:          defaultCopyRetries,
+		retryDelay:       defaultRetryDelay,
+		maxRetryDelay:    defaultMaxRetryDelay,
+		concurrency:      defaultCopyConcurrency,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithVerbose enables byte-level transfer logging, periodically reporting the bytes transferred and throughput of
+// each reference being copied, followed by a summary once the reference completes.  All output is logged at debug level.
+func WithVerbose() CopyOption {
+	return func(o *copyOpts) {
+		o.verbose = true
+	}
+}
+
+// WithProgressInterval sets how often transfer progress is reported when WithVerbose is enabled
+func WithProgressInterval(interval time.Duration) CopyOption {
+	return func(o *copyOpts) {
+		if interval > 0 {
+			o.progressInterval = interval
+		}
+	}
+}
+
+// WithAllowDigests restricts Copy and CopyAll to references resolving to one of the given digests, all others are skipped
+func WithAllowDigests(dgsts ...digest.Digest) CopyOption {
+	return func(o *copyOpts) {
+		if o.allowDigests == nil {
+			o.allowDigests = make(map[digest.Digest]bool)
+		}
+		for _, d := range dgsts {
+			o.allowDigests[d] = true
+		}
+	}
+}
+
+// WithDenyDigests prevents Copy and CopyAll from copying any reference resolving to one of the given digests
+func WithDenyDigests(dgsts ...digest.Digest) CopyOption {
+	return func(o *copyOpts) {
+		if o.denyDigests == nil {
+			o.denyDigests = make(map[digest.Digest]bool)
+		}
+		for _, d := range dgsts {
+			o.denyDigests[d] = true
+		}
+	}
+}
+
+// WithStrictDigests causes CopyAll to fail when a reference is rejected by the digest allow or deny lists, rather than
+// logging and skipping it
+func WithStrictDigests() CopyOption {
+	return func(o *copyOpts) {
+		o.strictDigests = true
+	}
+}
+
+// WithoutSkipExisting disables probing targets that implement BlobChecker for existing blobs, always sending every blob
+func WithoutSkipExisting() CopyOption {
+	return func(o *copyOpts) {
+		o.skipExisting = false
+	}
+}
+
+// WithProbeConcurrency limits how many blob existence probes are in flight at once for each reference
+func WithProbeConcurrency(n int) CopyOption {
+	return func(o *copyOpts) {
+		if n > 0 {
+			o.probeConcurrency = n
+		}
+	}
+}
+
+// WithStrictDestinations causes CopyAllTo to abort as soon as any destination fails, rather than carrying on with the
+// remaining destinations
+func WithStrictDestinations() CopyOption {
+	return func(o *copyOpts) {
+		o.strictDestinations = true
+	}
+}
+
+// WithRequireDigestMatch fails the copy of a reference the destination resolves to another digest than the store, such
+// as a registry rewriting the media types of what's pushed, since manifests pinning images by digest would break
+func WithRequireDigestMatch() CopyOption {
+	return func(o *copyOpts) {
+		o.requireDigestMatch = true
+	}
+}
+
+// WithAuthRetries sets how many times Copy resumes a copy the target rejected the credentials of, 0 disables resuming
+func WithAuthRetries(n int) CopyOption {
+	return func(o *copyOpts) {
+		if n >= 0 {
+			o.authRetries = n
+		}
+	}
+}
+
+// WithRetries sets how many times Copy retries a copy that failed with a transient error, such as a dropped connection
+// or a 5xx from the target, 0 disables retrying
+func WithRetries(n int) CopyOption {
+	return func(o *copyOpts) {
+		if n >= 0 {
+			o.retries = n
+		}
+	}
+}
+
+// WithRetryDelay sets the delay before Copy's first retry, doubling for each retry after up to maxDelay
+func WithRetryDelay(initial time.Duration, maxDelay time.Duration) CopyOption {
+	return func(o *copyOpts) {
+		if initial > 0 {
+			o.retryDelay = initial
+		}
+		if maxDelay > 0 {
+			o.maxRetryDelay = maxDelay
+		}
+	}
+}
+
+// WithConcurrency sets how many references CopyAll copies at once
+func WithConcurrency(n int) CopyOption {
+	return func(o *copyOpts) {
+		if n > 0 {
+			o.concurrency = n
+		}
+	}
+}
+
+// WithSelector restricts CopyAll and CopyAllTo to references whose index descriptor annotations satisfy sel
+func WithSelector(sel Selector) CopyOption {
+	return func(o *copyOpts) {
+		o.selector = sel
+	}
+}
+
+// WithRefFilter restricts CopyAll and CopyAllTo to references selected by f
+func WithRefFilter(f *RefFilter) CopyOption {
+	return func(o *copyOpts) {
+		o.refFilter = f
+	}
+}
+
+// checkDigest returns ErrDigestNotAllowed if d is rejected by the configured allow or deny lists
+func (o *copyOpts) checkDigest(d digest.Digest) error {
+	if o.denyDigests[d] {
+		return fmt.Errorf("%w: [%s] is denied", ErrDigestNotAllowed, d)
+	}
+	if len(o.allowDigests) > 0 && !o.allowDigests[d] {
+		return fmt.Errorf("%w: [%s] is not in the allow list", ErrDigestNotAllowed, d)
+	}
+	return nil
+}
+
+// VerifyOption configures the behavior of Verify
+type VerifyOption func(*verifyOpts)
+
+type verifyOpts struct {
+	concurrency int
+}
+
+func makeVerifyOpts(opts ...VerifyOption) *verifyOpts {
+	o := &verifyOpts{
+		concurrency: defaultVerifyConcurrency,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithVerifyConcurrency sets how many blobs Verify hashes at once
+func WithVerifyConcurrency(n int) VerifyOption {
+	return func(o *verifyOpts) {
+		if n > 0 {
+			o.concurrency = n
+		}
+	}
+}
+
+// GCOption configures the behavior of GC
+type GCOption func(*gcOpts)
+
+type gcOpts struct {
+	dryRun bool
+}
+
+func makeGCOpts(opts ...GCOption) *gcOpts {
+	o := &gcOpts{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithDryRun reports the blobs GC would delete without deleting them
+func WithDryRun() GCOption {
+	return func(o *gcOpts) {
+		o.dryRun = true
+	}
+}
+
+// SaveOption configures the behavior of Save
+type SaveOption func(*saveOpts)
+
+type saveOpts struct {
+	compression Compression
+	deltaFrom   *HaulManifest
+}
+
+func makeSaveOpts(opts ...SaveOption) *saveOpts {
+	o := &saveOpts{
+		compression: CompressionZstd,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithCompression sets the compression Save applies to the archive, defaulting to zstd
+func WithCompression(c Compression) SaveOption {
+	return func(o *saveOpts) {
+		o.compression = c
+	}
+}
+
+// WithDeltaFrom makes Save leave out every blob recorded in base, the manifest of a previous haul
+func WithDeltaFrom(base HaulManifest) SaveOption {
+	return func(o *saveOpts) {
+		o.deltaFrom = &base
+	}
+}
+
+// AddOption configures the behavior of AddOCICollection
+type AddOption func(*addOpts)
+
+type addOpts struct {
+	continueOnError bool
+}
+
+func makeAddOpts(opts ...AddOption) *addOpts {
+	o := &addOpts{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithContinueOnError keeps adding the rest of a collection when one of its references fails, returning every failure
+// together in an AddCollectionError once done
+func WithContinueOnError() AddOption {
+	return func(o *addOpts) {
+		o.continueOnError = true
+	}
+}
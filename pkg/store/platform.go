@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+// ErrNoMatchingPlatform is returned when an index holds none of the requested platforms
+var ErrNoMatchingPlatform = errors.New("no matching platform")
+
+// ParsePlatforms parses a comma separated list of platforms, such as linux/amd64,linux/arm64/v8
+func ParsePlatforms(s string) ([]ocispec.Platform, error) {
+	var ps []ocispec.Platform
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		p, err := platforms.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing platform [%s]: %w", v, err)
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+// FilterPlatforms narrows every index stored as reference down to the manifests of the given platforms, returning the
+// rewritten index entries
+//
+//	Each index is rewritten in place of the original under the same reference name, keeping every other field of the
+//	original as is, and the blobs only the dropped manifests referenced are deleted.  Since the rewritten index has a
+//	new digest, signatures made over the original index no longer apply to it.  Indexes already holding nothing but
+//	the requested platforms are left untouched, and an index holding none of them fails with ErrNoMatchingPlatform.
+func (l *Layout) FilterPlatforms(ctx context.Context, reference string, ps ...ocispec.Platform) ([]ocispec.Descriptor, error) {
+	logger := log.FromContext(ctx)
+
+	if len(ps) == 0 {
+		return nil, fmt.Errorf("no platforms to filter [%s] on", reference)
+	}
+	matchers := make([]platforms.Matcher, len(ps))
+	for i, p := range ps {
+		matchers[i] = platforms.NewMatcher(p)
+	}
+
+	matched, err := l.matchRefs([]string{reference})
+	if err != nil {
+		return nil, err
+	}
+
+	var replaced, filtered []ocispec.Descriptor
+	for _, desc := range matched {
+		if desc.MediaType != consts.OCIImageIndexSchema && desc.MediaType != consts.DockerManifestListSchema2 {
+			continue
+		}
+
+		data, kept, dropped, err := l.filterIndex(ctx, desc, matchers)
+		if err != nil {
+			return nil, fmt.Errorf("filtering [%s]: %w", desc.Annotations[ocispec.AnnotationRefName], err)
+		}
+		if kept == 0 {
+			return nil, fmt.Errorf("%w: [%s] holds none of %s", ErrNoMatchingPlatform, desc.Annotations[ocispec.AnnotationRefName], formatPlatforms(ps))
+		}
+		if dropped == 0 {
+			continue
+		}
+
+		if err := l.writeBlobData(data); err != nil {
+			return nil, err
+		}
+		f := desc
+		f.Digest = digest.FromBytes(data)
+		f.Size = int64(len(data))
+		replaced = append(replaced, desc)
+		filtered = append(filtered, f)
+	}
+	if len(replaced) == 0 {
+		return nil, nil
+	}
+
+	// swap the indexes first, so the blobs still needed are whatever the store now references
+	for i := range replaced {
+		if err := l.OCI.RemoveIndex(replaced[i]); err != nil {
+			return nil, err
+		}
+		if err := l.OCI.AddIndex(filtered[i]); err != nil {
+			return nil, err
+		}
+		logger.Debugf("filtered [%s] down to %s", filtered[i].Annotations[ocispec.AnnotationRefName], formatPlatforms(ps))
+	}
+
+	var remaining []ocispec.Descriptor
+	if err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		remaining = append(remaining, desc)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	keep, err := l.mark(ctx, remaining, true)
+	if err != nil {
+		return nil, fmt.Errorf("resolving remaining content: %w", err)
+	}
+	candidates, _ := l.mark(ctx, replaced, false)
+	for d := range candidates {
+		if keep[d] {
+			continue
+		}
+		if err := l.removeBlob(d); err != nil {
+			return nil, err
+		}
+	}
+	return filtered, nil
+}
+
+// filterIndex returns the content of the index desc with only the manifests matching one of matchers, along with how
+// many manifests were kept and dropped
+//
+//	The index is edited as raw json, so fields ocispec doesn't model, such as a docker manifest list's platform
+//	features, survive the rewrite
+func (l *Layout) filterIndex(ctx context.Context, desc ocispec.Descriptor, matchers []platforms.Matcher) ([]byte, int, int, error) {
+	rc, err := l.OCI.Fetch(ctx, desc)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, 0, 0, err
+	}
+	var manifests []json.RawMessage
+	if err := json.Unmarshal(raw["manifests"], &manifests); err != nil {
+		return nil, 0, 0, err
+	}
+
+	var kept []json.RawMessage
+	for _, m := range manifests {
+		var d ocispec.Descriptor
+		if err := json.Unmarshal(m, &d); err != nil {
+			return nil, 0, 0, err
+		}
+		if d.Platform != nil && matchesAny(matchers, *d.Platform) {
+			kept = append(kept, m)
+		}
+	}
+	if len(kept) == len(manifests) || len(kept) == 0 {
+		return data, len(kept), len(manifests) - len(kept), nil
+	}
+
+	if raw["manifests"], err = json.Marshal(kept); err != nil {
+		return nil, 0, 0, err
+	}
+	out, err := json.Marshal(raw)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return out, len(kept), len(manifests) - len(kept), nil
+}
+
+func matchesAny(matchers []platforms.Matcher, p ocispec.Platform) bool {
+	for _, m := range matchers {
+		if m.Match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatPlatforms(ps []ocispec.Platform) string {
+	s := make([]string, len(ps))
+	for i, p := range ps {
+		s[i] = platforms.Format(p)
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/target"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/progress"
+)
+
+// progressTarget wraps a target.Target and counts every byte written through the pushers it hands out
+//
+//	Counting happens inline as oras.Copy streams content into the underlying writers, so nothing is buffered.  The
+//	bytes are also recorded on task, which may be nil.
+type progressTarget struct {
+	target.Target
+
+	transferred int64
+	task        *progress.Task
+}
+
+func newProgressTarget(to target.Target, task *progress.Task) *progressTarget {
+	return &progressTarget{Target: to, task: task}
+}
+
+func (t *progressTarget) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	p, err := t.Target.Pusher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &progressPusher{Pusher: p, transferred: &t.transferred, task: t.task}, nil
+}
+
+// Transferred returns the number of bytes written to the target so far
+func (t *progressTarget) Transferred() int64 {
+	return atomic.LoadInt64(&t.transferred)
+}
+
+// report logs the transfer progress of ref every interval until the returned func is called with the result of the
+// copy, at which point a final summary is logged
+func (t *progressTarget) report(ctx context.Context, ref string, interval time.Duration) func(error) {
+	l := log.FromContext(ctx)
+	start := time.Now()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				n := t.Transferred()
+				l.Debugf("copying [%s]: transferred [%s] (%s)", ref, byteCount(n), throughput(n, time.Since(start)))
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func(err error) {
+		close(done)
+		n := t.Transferred()
+		elapsed := time.Since(start)
+		if err != nil {
+			l.Debugf("failed copying [%s]: transferred [%s] in [%s] before error: %v", ref, byteCount(n), elapsed.Round(time.Millisecond), err)
+			return
+		}
+		l.Debugf("copied [%s]: transferred [%s] in [%s] (%s)", ref, byteCount(n), elapsed.Round(time.Millisecond), throughput(n, elapsed))
+	}
+}
+
+type progressPusher struct {
+	remotes.Pusher
+
+	transferred *int64
+	task        *progress.Task
+}
+
+func (p *progressPusher) Push(ctx context.Context, desc ocispec.Descriptor) (ccontent.Writer, error) {
+	w, err := p.Pusher.Push(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	return &countingWriter{Writer: w, transferred: p.transferred, task: p.task}, nil
+}
+
+// countingWriter is a content.Writer that tallies the bytes written through it
+type countingWriter struct {
+	ccontent.Writer
+
+	transferred *int64
+	task        *progress.Task
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	atomic.AddInt64(w.transferred, int64(n))
+	w.task.Add(int64(n))
+	return n, err
+}
+
+func throughput(n int64, elapsed time.Duration) string {
+	if elapsed <= 0 {
+		return "0.00 MB/s"
+	}
+	return fmt.Sprintf("%.2f MB/s", float64(n)/1e6/elapsed.Seconds())
+}
+
+func byteCount(b int64) string {
+	const unit = 1000
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "kMGTPE"[exp])
+}
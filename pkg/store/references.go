@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+)
+
+var (
+	// ErrStopWalk can be returned by a WalkReferences callback to stop walking without WalkReferences returning an error
+	ErrStopWalk = errors.New("stop walk")
+)
+
+// WalkReferences calls fn with the reference name and descriptor of every entry in the store's index, in index order
+//
+//	Unlike Walk, the index is streamed from disk one entry at a time rather than loaded in full, keeping memory bounded
+//	for very large stores.  ctx is checked between entries, and walking stops at the first error returned by fn.
+func (l *Layout) WalkReferences(ctx context.Context, fn func(ref string, desc ocispec.Descriptor) error) error {
+	f, err := os.Open(filepath.Join(l.Root, consts.OCIImageIndexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key, _ := tok.(string); key != "manifests" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+		for dec.More() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var desc ocispec.Descriptor
+			if err := dec.Decode(&desc); err != nil {
+				return err
+			}
+			if err := fn(desc.Annotations[ocispec.AnnotationRefName], desc); err != nil {
+				if errors.Is(err, ErrStopWalk) {
+					return nil
+				}
+				return err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// References returns up to limit descriptors of the store's index starting from offset, in index order
+//
+//	A limit of 0 or less returns every entry after offset.  Pages are only stable while the index isn't modified.
+func (l *Layout) References(ctx context.Context, offset int, limit int) ([]ocispec.Descriptor, error) {
+	var descs []ocispec.Descriptor
+	i := 0
+	err := l.WalkReferences(ctx, func(_ string, desc ocispec.Descriptor) error {
+		defer func() { i++ }()
+		if i < offset {
+			return nil
+		}
+		if limit > 0 && len(descs) >= limit {
+			return ErrStopWalk
+		}
+		descs = append(descs, desc)
+		return nil
+	})
+	return descs, err
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("malformed %s: expected [%s], got [%v]", consts.OCIImageIndexFile, want, tok)
+	}
+	return nil
+}
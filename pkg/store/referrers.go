@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+// AddReferrers adds the OCI 1.1 referrers of the image reference to the store, returning their index descriptors
+//
+//	Referrers are what tools attaching signatures, sboms, and attestations through the referrers api push in place of
+//	cosign's tag convention.  reference must already be in the store.  The referrers of the image, of each platform of
+//	it kept in the store, and of the referrers themselves are discovered from the registry the image came from, using
+//	its referrers api or falling back to the referrers tag schema.  Each is stored byte for byte under the reference
+//	name of its image with the KindAnnotationReferrers kind, so their digests and signatures still hold.
+func (l *Layout) AddReferrers(ctx context.Context, reference string) ([]ocispec.Descriptor, error) {
+	logger := log.FromContext(ctx)
+
+	desc, err := l.Stat(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	refName := desc.Annotations[ocispec.AnnotationRefName]
+	repo, err := gname.ParseReference(refName)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects := []digest.Digest{desc.Digest}
+	if desc.MediaType == consts.OCIImageIndexSchema || desc.MediaType == consts.DockerManifestListSchema2 {
+		manifests, err := l.children(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range manifests {
+			subjects = append(subjects, m.Digest)
+		}
+	}
+
+	opts := l.RemoteOptions()
+	opts = append(opts, remote.WithContext(ctx))
+
+	var added []ocispec.Descriptor
+	seen := make(map[digest.Digest]bool)
+	for len(subjects) > 0 {
+		subject := subjects[0]
+		subjects = subjects[1:]
+
+		idx, err := remote.Referrers(repo.Context().Digest(subject.String()), opts...)
+		if err != nil {
+			return added, fmt.Errorf("discovering referrers of [%s@%s]: %w", repo.Context().Name(), subject, err)
+		}
+		im, err := idx.IndexManifest()
+		if err != nil {
+			return added, err
+		}
+
+		for _, r := range im.Manifests {
+			d := digest.Digest(r.Digest.String())
+			if seen[d] {
+				continue
+			}
+			seen[d] = true
+
+			rdesc, err := l.addReferrer(ctx, repo.Context().Digest(d.String()), refName, opts...)
+			if err != nil {
+				return added, fmt.Errorf("adding referrer [%s] of [%s]: %w", d, refName, err)
+			}
+			logger.Debugf("added referrer [%s] of [%s@%s]", d, refName, subject)
+			added = append(added, rdesc)
+			subjects = append(subjects, d)
+		}
+	}
+	return added, nil
+}
+
+// addReferrer writes the referrer ref and its blobs to the store, indexing it under refName
+func (l *Layout) addReferrer(ctx context.Context, ref gname.Digest, refName string, opts ...remote.Option) (ocispec.Descriptor, error) {
+	rd, err := remote.Get(ref, opts...)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if d := digest.FromBytes(rd.Manifest); d.String() != ref.DigestStr() {
+		return ocispec.Descriptor{}, fmt.Errorf("manifest digest [%s] does not match [%s]", d, ref.DigestStr())
+	}
+
+	if rd.MediaType.IsIndex() {
+		return ocispec.Descriptor{}, fmt.Errorf("referrers of media type [%s] are not supported", rd.MediaType)
+	}
+	var m struct {
+		ArtifactType string `json:"artifactType,omitempty"`
+		Config       struct {
+			MediaType string `json:"mediaType"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(rd.Manifest, &m); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	img, err := rd.Image()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	cdata, err := img.RawConfigFile()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := l.writeBlobData(cdata); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	var g errgroup.Group
+	g.SetLimit(l.layerConcurrency)
+	for _, lyr := range layers {
+		lyr := lyr
+		g.Go(func() error {
+			return l.writeLayer(ctx, lyr, ref.Context().Name(), nil)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	// the manifest is written last, so a referrer is never indexed with blobs missing
+	if err := l.writeBlobData(rd.Manifest); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	artifactType := m.ArtifactType
+	if artifactType == "" {
+		artifactType = m.Config.MediaType
+	}
+	desc := ocispec.Descriptor{
+		MediaType:    string(rd.MediaType),
+		Digest:       digest.FromBytes(rd.Manifest),
+		Size:         int64(len(rd.Manifest)),
+		ArtifactType: artifactType,
+		Annotations: map[string]string{
+			consts.KindAnnotationName: consts.KindAnnotationReferrers,
+			ocispec.AnnotationRefName: refName,
+		},
+	}
+	return desc, l.addIndex(AuditAdd, desc)
+}
+
+// Referrers returns the index descriptors of the referrers in the store whose subject is d, sorted by digest
+//
+//	Referrers are those added by AddReferrers, each descriptor carrying the artifact type of its referrer as served by
+//	the referrers api.
+func (l *Layout) Referrers(ctx context.Context, d digest.Digest) ([]ocispec.Descriptor, error) {
+	var candidates []ocispec.Descriptor
+	if err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		if desc.Annotations[consts.KindAnnotationName] == consts.KindAnnotationReferrers {
+			candidates = append(candidates, desc)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[digest.Digest]bool)
+	var referrers []ocispec.Descriptor
+	for _, desc := range candidates {
+		if seen[desc.Digest] {
+			continue
+		}
+		seen[desc.Digest] = true
+
+		rc, err := l.OCI.Fetch(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		var m struct {
+			Subject *ocispec.Descriptor `json:"subject,omitempty"`
+		}
+		err = json.NewDecoder(rc).Decode(&m)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		if m.Subject == nil || m.Subject.Digest != d {
+			continue
+		}
+
+		referrers = append(referrers, ocispec.Descriptor{
+			MediaType:    desc.MediaType,
+			Digest:       desc.Digest,
+			Size:         desc.Size,
+			ArtifactType: desc.ArtifactType,
+		})
+	}
+	sort.Slice(referrers, func(i, j int) bool { return referrers[i].Digest < referrers[j].Digest })
+	return referrers, nil
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Repositories maps every repository in the store to its tags, and each tag to the index descriptor it resolves to
+//
+//	Repositories are named without their registry and cosign content is tagged after the image it belongs to, the same
+//	as when copied to a registry by CopyAll, so the store can be served as a registry as is.  References that aren't
+//	tags, such as bare digests, are left out.
+func (l *Layout) Repositories() (map[string]map[string]ocispec.Descriptor, error) {
+	images, err := l.imageDigests()
+	if err != nil {
+		return nil, err
+	}
+	identity := func(ref string) (string, error) { return ref, nil }
+
+	repos := make(map[string]map[string]ocispec.Descriptor)
+	err = l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		ref, err := mapRef(identity, desc, images)
+		if err != nil {
+			// cosign content whose image is gone has no tag to be served under
+			return nil
+		}
+
+		r, err := gname.ParseReference(ref)
+		if err != nil {
+			return nil
+		}
+		tag, ok := r.(gname.Tag)
+		if !ok {
+			return nil
+		}
+
+		repo := r.Context().RepositoryStr()
+		if repos[repo] == nil {
+			repos[repo] = make(map[string]ocispec.Descriptor)
+		}
+		repos[repo][tag.TagStr()] = desc
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// OpenBlob opens the blob d in the store, returning ErrDigestNotFound if the store doesn't hold it
+func (l *Layout) OpenBlob(d digest.Digest) (*os.File, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(l.Root, "blobs", d.Algorithm().String(), d.Encoded()))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: [%s]", ErrDigestNotFound, d)
+	}
+	return f, err
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+// RemoveArtifact removes every index entry matching reference, then deletes the blobs no longer referenced by anything
+// left in the store, returning the removed index entries
+//
+//	reference is matched the same way as Stat, so signatures, attestations, and sboms stored under the same name are
+//	removed along with their image.  Blobs still reachable from other references, such as layers shared between images,
+//	are kept.  Everything left in the store is resolved before the index is touched, so a store with unreadable
+//	manifests errors rather than losing content those manifests still need.
+func (l *Layout) RemoveArtifact(ctx context.Context, reference string) ([]ocispec.Descriptor, error) {
+	logger := log.FromContext(ctx)
+
+	removed, err := l.matchRefs([]string{reference})
+	if err != nil {
+		return nil, err
+	}
+
+	isRemoved := make(map[string]bool)
+	for _, desc := range removed {
+		isRemoved[indexKey(desc)] = true
+	}
+
+	var remaining []ocispec.Descriptor
+	if err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		if !isRemoved[indexKey(desc)] {
+			remaining = append(remaining, desc)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	keep, err := l.mark(ctx, remaining, true)
+	if err != nil {
+		return nil, fmt.Errorf("resolving remaining content: %w", err)
+	}
+	// removed manifests that can't be read simply leave their children behind
+	candidates, _ := l.mark(ctx, removed, false)
+
+	for _, desc := range removed {
+		if err := l.OCI.RemoveIndex(desc); err != nil {
+			return nil, err
+		}
+		logger.Debugf("removed [%s] from the index", desc.Annotations[ocispec.AnnotationRefName])
+	}
+	if err := l.Audit(AuditRemove, removed...); err != nil {
+		return nil, err
+	}
+
+	for d := range candidates {
+		if keep[d] {
+			continue
+		}
+		if err := l.removeBlob(d); err != nil {
+			return nil, err
+		}
+		logger.Debugf("deleted blob [%s]", d)
+	}
+	return removed, nil
+}
+
+// mark returns the digests of roots and every descriptor transitively reachable from them
+//
+//	When strict, a manifest that can't be read is an error, otherwise its children are silently left undiscovered
+func (l *Layout) mark(ctx context.Context, roots []ocispec.Descriptor, strict bool) (map[digest.Digest]bool, error) {
+	seen := make(map[digest.Digest]bool)
+	queue := append([]ocispec.Descriptor{}, roots...)
+	for len(queue) > 0 {
+		desc := queue[0]
+		queue = queue[1:]
+		if seen[desc.Digest] {
+			continue
+		}
+		seen[desc.Digest] = true
+
+		children, err := l.children(ctx, desc)
+		if err != nil {
+			if strict {
+				return nil, fmt.Errorf("reading [%s]: %w", desc.Digest, err)
+			}
+			continue
+		}
+		queue = append(queue, children...)
+	}
+	return seen, nil
+}
+
+func (l *Layout) removeBlob(d digest.Digest) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(l.Root, "blobs", d.Algorithm().String(), d.Encoded()))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// indexKey identifies an index entry the same way the index itself does
+func indexKey(desc ocispec.Descriptor) string {
+	return fmt.Sprintf("%s-%s-%s", desc.Digest.String(), desc.Annotations[ocispec.AnnotationRefName], desc.Annotations[consts.KindAnnotationName])
+}
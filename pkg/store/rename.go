@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+// Rename moves every index entry matching from to the repository of to, returning the renamed index entries
+//
+//	from is matched the same way as Stat, so signatures, attestations, and sboms stored under the same name are renamed
+//	along with it, and entries matched by the digest of from keep their own tags in the repository of to.  The content
+//	itself is left untouched.
+func (l *Layout) Rename(ctx context.Context, from string, to string) ([]ocispec.Descriptor, error) {
+	logger := log.FromContext(ctx)
+
+	fromRef, err := gname.ParseReference(from)
+	if err != nil {
+		return nil, err
+	}
+	toRef, err := gname.ParseReference(to)
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := l.matchRefs([]string{from})
+	if err != nil {
+		return nil, err
+	}
+
+	var renamed []ocispec.Descriptor
+	for _, desc := range matched {
+		name := desc.Annotations[ocispec.AnnotationRefName]
+		r, err := gname.ParseReference(name)
+		if err != nil {
+			return nil, err
+		}
+
+		newName := toRef.Name()
+		if r.Name() != fromRef.Name() {
+			sep := ":"
+			if _, ok := r.(gname.Digest); ok {
+				sep = "@"
+			}
+			newName = toRef.Context().Name() + sep + r.Identifier()
+		}
+		if newName == name {
+			continue
+		}
+
+		moved := desc
+		moved.Annotations = make(map[string]string, len(desc.Annotations))
+		for k, v := range desc.Annotations {
+			moved.Annotations[k] = v
+		}
+		moved.Annotations[ocispec.AnnotationRefName] = newName
+
+		if err := l.OCI.AddIndex(moved); err != nil {
+			return nil, err
+		}
+		if err := l.OCI.RemoveIndex(desc); err != nil {
+			return nil, err
+		}
+		logger.Debugf("renamed [%s] to [%s]", name, newName)
+		renamed = append(renamed, moved)
+	}
+	return renamed, nil
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+// DanglingReference is an index entry of the store missing a blob it references, and why
+type DanglingReference struct {
+	Descriptor ocispec.Descriptor
+	Err        error
+}
+
+// Dangling returns every index entry of the store that references a blob missing from the store, or one whose size
+// doesn't match, such as those left behind by a process killed mid-add before its blobs were written
+func (l *Layout) Dangling(ctx context.Context) ([]DanglingReference, error) {
+	var roots []ocispec.Descriptor
+	if err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		roots = append(roots, desc)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sortIndex(roots)
+
+	// blobs shared by several references are only checked once
+	checked := make(map[digest.Digest]error)
+	var dangling []DanglingReference
+	for _, root := range roots {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		err := l.walkGraph(ctx, root, func(d ocispec.Descriptor) error {
+			err, ok := checked[d.Digest]
+			if !ok {
+				err = l.checkBlob(d)
+				checked[d.Digest] = err
+			}
+			if err != nil {
+				return fmt.Errorf("blob [%s]: %w", d.Digest, err)
+			}
+			return nil
+		})
+		if err != nil {
+			dangling = append(dangling, DanglingReference{Descriptor: root, Err: err})
+		}
+	}
+	return dangling, nil
+}
+
+// Repair drops every dangling reference of the store from its index, returning those dropped
+//
+//	The blobs the dropped references did have are left in place for GC, which deletes those no other reference needs.
+//	Every reference dropped is recorded in the audit log as removed.
+func (l *Layout) Repair(ctx context.Context) ([]DanglingReference, error) {
+	logger := log.FromContext(ctx)
+
+	dangling, err := l.Dangling(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	descs := make([]ocispec.Descriptor, 0, len(dangling))
+	for _, d := range dangling {
+		if err := l.OCI.RemoveIndex(d.Descriptor); err != nil {
+			return nil, err
+		}
+		logger.Debugf("dropped dangling reference [%s] from the index", d.Descriptor.Annotations[ocispec.AnnotationRefName])
+		descs = append(descs, d.Descriptor)
+	}
+	if len(descs) > 0 {
+		if err := l.Audit(AuditRemove, descs...); err != nil {
+			return nil, err
+		}
+	}
+	return dangling, nil
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/rancherfederal/hauler/pkg/content"
+	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/progress"
+)
+
+// partialSuffix names the file a blob is downloaded to before it's complete, next to where the blob goes
+//
+//	It's named after the blob so a later download of the same blob, from any reference, picks up where it left off.
+//	Files under blobs/ that aren't named after a digest are left alone by GC, so a partial download survives it.
+const partialSuffix = ".partial"
+
+// blobLocks serializes the downloads of a blob by its path, so a layer repeated within an image or shared by images
+// added at once is downloaded a single time and found in place by the others
+var blobLocks sync.Map
+
+// errRangeNotSatisfied is returned by fetchRange when the registry serves the whole blob rather than the range asked for
+var errRangeNotSatisfied = errors.New("range not satisfied")
+
+// writeLayer writes layer to the blobs of the store unless it's already there
+//
+//	The layer is downloaded to a partial file that's only moved into place once it matches its digest, so an
+//	interrupted download never leaves a truncated blob that would be taken for a complete one.  A partial file is kept
+//	when the download fails, and when repo names the repository the layer is served from the download resumes from
+//	it with a ranged request, both on a later run and straight away after a transient failure, up to the retries of
+//	the store's transport.  Registries that ignore the range have the layer downloaded from the start.  The bytes
+//	downloaded are recorded on task, blobs already in the store and bytes kept from an earlier run aren't.
+func (l *Layout) writeLayer(ctx context.Context, layer v1.Layer, repo string, task *progress.Task) error {
+	h, err := layer.Digest()
+	if err != nil {
+		return err
+	}
+	d, err := digest.Parse(h.String())
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(l.Root, "blobs", h.Algorithm)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil && !os.IsExist(err) {
+		return err
+	}
+	blobPath := filepath.Join(dir, h.Hex)
+	mu, _ := blobLocks.LoadOrStore(blobPath, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	if _, err := os.Stat(blobPath); err == nil {
+		return nil
+	}
+
+	partialPath := blobPath + partialSuffix
+	f, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// the bytes already downloaded are hashed again rather than trusted, the file is left positioned at their end
+	digester := d.Algorithm().Digester()
+	offset, err := io.Copy(digester.Hash(), f)
+	if err != nil {
+		return err
+	}
+	if offset > 0 && repo == "" {
+		if offset, err = restart(f); err != nil {
+			return err
+		}
+		digester = d.Algorithm().Digester()
+	}
+
+	// an earlier run may have been interrupted between finishing the download and moving it into place
+	size, err := layer.Size()
+	if err != nil {
+		size = -1
+	}
+
+	for attempt := 0; offset != size; attempt++ {
+		var rc io.ReadCloser
+		if offset > 0 {
+			rc, err = l.fetchRange(ctx, repo, d, offset)
+			if errors.Is(err, errRangeNotSatisfied) {
+				log.FromContext(ctx).Debugf("registry ignored the range of [%s], downloading it from the start", d)
+				if offset, err = restart(f); err != nil {
+					return err
+				}
+				digester = d.Algorithm().Digester()
+			}
+		}
+		if offset == 0 {
+			rc, err = layer.Compressed()
+		}
+
+		if err == nil {
+			var n int64
+			n, err = io.Copy(io.MultiWriter(f, digester.Hash(), task), rc)
+			rc.Close()
+			offset += n
+		}
+		if err == nil {
+			break
+		}
+		if repo == "" || attempt >= l.transport.MaxRetries || !content.IsTransient(err) || ctx.Err() != nil {
+			if offset > 0 && repo != "" {
+				return fmt.Errorf("downloading blob [%s], [%d] bytes kept to resume from: %w", d, offset, err)
+			}
+			return fmt.Errorf("downloading blob [%s]: %w", d, err)
+		}
+		log.FromContext(ctx).Infof("downloading blob [%s] failed after [%d] bytes, resuming: %v", d, offset, err)
+	}
+
+	if got := digester.Digest(); got != d {
+		f.Close()
+		os.Remove(partialPath)
+		return fmt.Errorf("%w: downloaded blob [%s] has digest [%s]", ErrDigestMismatch, d, got)
+	}
+	// synced before it's moved into place, so a crash never leaves a blob the index is about to reference unwritten
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partialPath, blobPath)
+}
+
+// restart empties the partial file f so a download starts over
+func restart(f *os.File) (int64, error) {
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	return f.Seek(0, io.SeekStart)
+}
+
+// fetchRange returns the content of the blob d of the repository repo from offset on, with the credentials and
+// transport of the store
+func (l *Layout) fetchRange(ctx context.Context, repo string, d digest.Digest, offset int64) (io.ReadCloser, error) {
+	r, err := gname.NewRepository(repo)
+	if err != nil {
+		return nil, err
+	}
+	if l.transport.PlainHTTP(r.RegistryStr()) {
+		if r, err = gname.NewRepository(repo, gname.Insecure); err != nil {
+			return nil, err
+		}
+	}
+
+	auth, err := l.transport.Keychain().Resolve(r)
+	if err != nil {
+		return nil, err
+	}
+	base, ok := remote.DefaultTransport.(*http.Transport)
+	if !ok {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	rt := transport.NewUserAgent(l.transport.Transport(base), l.UserAgent())
+	rt, err = transport.NewWithContext(ctx, r.Registry, auth, rt, []string{r.Scope(transport.PullScope)})
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("%s://%s/v2/%s/blobs/%s", r.Scheme(), r.RegistryStr(), r.RepositoryStr(), d)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+
+	resp, err := (&http.Client{Transport: rt}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), "bytes "+strconv.FormatInt(offset, 10)+"-") {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%w: asked for [%d-], got [%s]", errRangeNotSatisfied, offset, resp.Header.Get("Content-Range"))
+		}
+		return resp.Body, nil
+	case http.StatusOK, http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return nil, errRangeNotSatisfied
+	default:
+		defer resp.Body.Close()
+		return nil, transport.CheckError(resp, http.StatusPartialContent)
+	}
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"path"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+// Rootfs returns the root filesystem of the image ref as a tar stream, its layers applied in order
+//
+//	Multi-platform images are narrowed to the manifest of platform, and whiteouts are applied rather than kept, so the
+//	stream is the filesystem a container of the image starts with.  Device nodes and fifos are dropped since they can't
+//	be created without privileges, and a rootfs is extracted to be read rather than run.  Absolute symlinks are made
+//	relative, they point within the rootfs rather than at the host it's extracted on.
+func (l *Layout) Rootfs(ctx context.Context, ref string, platform ocispec.Platform) (io.ReadCloser, error) {
+	root, err := layout.Path(l.Root).ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := l.runtimeImage(ctx, root, ref, platform)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		fs := mutate.Extract(img)
+		defer fs.Close()
+		pw.CloseWithError(filterRootfs(ctx, pw, fs))
+	}()
+	return pr, nil
+}
+
+// filterRootfs copies the tar stream r to w without its device nodes and fifos, its absolute symlinks made relative
+func filterRootfs(ctx context.Context, w io.Writer, r io.Reader) error {
+	logger := log.FromContext(ctx)
+
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			logger.Debugf("skipping special file [%s]", hdr.Name)
+			continue
+
+		case tar.TypeSymlink:
+			if path.IsAbs(hdr.Linkname) {
+				dir := filepath.FromSlash(path.Dir(path.Join("/", hdr.Name)))
+				target, err := filepath.Rel(dir, filepath.FromSlash(path.Clean(hdr.Linkname)))
+				if err != nil {
+					return err
+				}
+				hdr.Linkname = filepath.ToSlash(target)
+			}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,309 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// SegmentManifestSuffix is appended to an archive's name to name the manifest of its segments, e.g. haul.tar.zst.segments.json
+const SegmentManifestSuffix = ".segments.json"
+
+// ErrInvalidSegment is returned when a segment is missing, truncated, or doesn't match its checksum
+var ErrInvalidSegment = errors.New("invalid segment")
+
+// SegmentManifest describes an archive split across numbered segment files
+type SegmentManifest struct {
+	Version int `json:"version"`
+
+	// Archive is the name of the archive the segments reassemble into
+	Archive  string        `json:"archive"`
+	Size     int64         `json:"size"`
+	Digest   digest.Digest `json:"digest"`
+	Segments []Segment     `json:"segments"`
+}
+
+// Segment is a single numbered piece of an archive, named relative to its manifest
+type Segment struct {
+	Name   string        `json:"name"`
+	Size   int64         `json:"size"`
+	Digest digest.Digest `json:"digest"`
+}
+
+// SegmentWriter splits everything written to it across files of at most a fixed size, named after the archive they
+// make up with a numbered suffix, e.g. haul.tar.zst.000, haul.tar.zst.001
+//
+//	Segments are written under temporary names and only renamed into place, along with the manifest describing them,
+//	once Close succeeds.  Abort removes everything written so far.
+type SegmentWriter struct {
+	dir     string
+	archive string
+	size    int64
+
+	manifest SegmentManifest
+	digester digest.Digester
+
+	current  *os.File
+	hasher   hash.Hash
+	written  int64
+	tmpFiles []string
+}
+
+// NewSegmentWriter returns a SegmentWriter writing segments of at most size bytes of archive into dir
+func NewSegmentWriter(dir string, archive string, size int64) (*SegmentWriter, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("segment size must be positive, got [%d]", size)
+	}
+	return &SegmentWriter{
+		dir:      dir,
+		archive:  archive,
+		size:     size,
+		manifest: SegmentManifest{Version: 1, Archive: archive},
+		digester: digest.Canonical.Digester(),
+	}, nil
+}
+
+func (w *SegmentWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if w.current == nil || w.written == w.size {
+			if err := w.next(); err != nil {
+				return n, err
+			}
+		}
+
+		chunk := p
+		if remaining := w.size - w.written; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		m, err := w.current.Write(chunk)
+		w.hasher.Write(chunk[:m])
+		w.digester.Hash().Write(chunk[:m])
+		w.written += int64(m)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// next finishes the current segment, if any, and starts the next
+func (w *SegmentWriter) next() error {
+	if err := w.finish(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s.%03d", w.archive, len(w.manifest.Segments))
+	f, err := os.CreateTemp(w.dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	w.tmpFiles = append(w.tmpFiles, f.Name())
+	w.manifest.Segments = append(w.manifest.Segments, Segment{Name: name})
+	w.current = f
+	w.hasher = digest.Canonical.Hash()
+	w.written = 0
+	return nil
+}
+
+// finish closes the current segment and records its size and checksum
+func (w *SegmentWriter) finish() error {
+	if w.current == nil {
+		return nil
+	}
+	if err := w.current.Close(); err != nil {
+		return err
+	}
+
+	seg := &w.manifest.Segments[len(w.manifest.Segments)-1]
+	seg.Size = w.written
+	seg.Digest = digest.NewDigest(digest.Canonical, w.hasher)
+	w.manifest.Size += w.written
+	w.current = nil
+	return nil
+}
+
+// Close finishes the last segment, moves every segment into place, and writes the manifest, returning it
+func (w *SegmentWriter) Close() (SegmentManifest, error) {
+	if w.current == nil {
+		// an empty archive still needs a segment to reassemble from
+		if err := w.next(); err != nil {
+			w.Abort()
+			return SegmentManifest{}, err
+		}
+	}
+	if err := w.finish(); err != nil {
+		w.Abort()
+		return SegmentManifest{}, err
+	}
+	w.manifest.Digest = w.digester.Digest()
+
+	for i, tmp := range w.tmpFiles {
+		if err := os.Rename(tmp, filepath.Join(w.dir, w.manifest.Segments[i].Name)); err != nil {
+			w.Abort()
+			return SegmentManifest{}, err
+		}
+	}
+
+	data, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return SegmentManifest{}, err
+	}
+	if err := os.WriteFile(filepath.Join(w.dir, w.archive+SegmentManifestSuffix), data, 0644); err != nil {
+		return SegmentManifest{}, err
+	}
+	return w.manifest, nil
+}
+
+// Abort removes every segment written so far
+func (w *SegmentWriter) Abort() {
+	if w.current != nil {
+		w.current.Close()
+		w.current = nil
+	}
+	for i, tmp := range w.tmpFiles {
+		os.Remove(tmp)
+		if i < len(w.manifest.Segments) {
+			os.Remove(filepath.Join(w.dir, w.manifest.Segments[i].Name))
+		}
+	}
+}
+
+// OpenSegments returns a reader of the archive described by the segment manifest at path
+//
+//	Every segment must be present with its recorded size before anything is read, and each segment's checksum is
+//	verified as the reader reaches its end, so a damaged disc fails with ErrInvalidSegment naming the bad segment.
+func OpenSegments(path string) (io.ReadCloser, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m SegmentManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%w: reading [%s]: %v", ErrInvalidSegment, path, err)
+	}
+	if m.Version != 1 {
+		return nil, fmt.Errorf("%w: unsupported segment manifest version [%d]", ErrInvalidSegment, m.Version)
+	}
+	if len(m.Segments) == 0 {
+		return nil, fmt.Errorf("%w: [%s] lists no segments", ErrInvalidSegment, path)
+	}
+
+	dir := filepath.Dir(path)
+	var total int64
+	for _, seg := range m.Segments {
+		if seg.Name != filepath.Base(seg.Name) || seg.Name == ".." {
+			return nil, fmt.Errorf("%w: segment name [%s] must be a plain file name", ErrInvalidSegment, seg.Name)
+		}
+		if err := seg.Digest.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: [%s]: %v", ErrInvalidSegment, seg.Name, err)
+		}
+
+		fi, err := os.Stat(filepath.Join(dir, seg.Name))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSegment, err)
+		}
+		if fi.Size() != seg.Size {
+			return nil, fmt.Errorf("%w: [%s] is [%d] bytes, expected [%d]", ErrInvalidSegment, seg.Name, fi.Size(), seg.Size)
+		}
+		total += seg.Size
+	}
+	if total != m.Size {
+		return nil, fmt.Errorf("%w: segments total [%d] bytes, expected [%d]", ErrInvalidSegment, total, m.Size)
+	}
+
+	return &segmentReader{dir: dir, manifest: m}, nil
+}
+
+// segmentReader reads each segment in turn, verifying its checksum once it has been read in full
+type segmentReader struct {
+	dir      string
+	manifest SegmentManifest
+
+	i        int
+	current  *os.File
+	verifier digest.Verifier
+}
+
+func (r *segmentReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if r.i == len(r.manifest.Segments) {
+				return 0, io.EOF
+			}
+			f, err := os.Open(filepath.Join(r.dir, r.manifest.Segments[r.i].Name))
+			if err != nil {
+				return 0, fmt.Errorf("%w: %v", ErrInvalidSegment, err)
+			}
+			r.current = f
+			r.verifier = r.manifest.Segments[r.i].Digest.Verifier()
+		}
+
+		n, err := r.current.Read(p)
+		r.verifier.Write(p[:n])
+		if err == io.EOF {
+			seg := r.manifest.Segments[r.i]
+			r.current.Close()
+			r.current = nil
+			r.i++
+			if !r.verifier.Verified() {
+				return n, fmt.Errorf("%w: [%s] does not match its checksum", ErrInvalidSegment, seg.Name)
+			}
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *segmentReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+// ParseSize parses a human readable size such as 4GB, 4.7GB, or 700MiB into bytes
+//
+//	Decimal units (KB, MB, GB, TB) are powers of 1000 and binary units (KiB, MiB, GiB, TiB) powers of 1024, a bare
+//	number is a count of bytes
+func ParseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+		{"B", 1},
+	}
+
+	v := strings.TrimSpace(s)
+	scale := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(strings.ToUpper(v), strings.ToUpper(u.suffix)) {
+			v = strings.TrimSpace(v[:len(v)-len(u.suffix)])
+			scale = u.scale
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size [%s]", s)
+	}
+	return int64(math.Round(n * scale)), nil
+}
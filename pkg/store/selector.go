@@ -0,0 +1,69 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Selector matches index descriptors by their annotations, every requirement must be satisfied for a match
+type Selector []Requirement
+
+// Requirement is a single annotation a Selector requires, either to be present or to have an exact value
+type Requirement struct {
+	Key   string
+	Value string
+
+	// Exists only requires Key to be present, regardless of its value
+	Exists bool
+}
+
+// ParseSelector parses a comma separated list of requirements, each either key=value for an exact match or a bare key
+// to only require its presence, e.g. "env=staging,team"
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("invalid selector requirement [%s]: missing key", part)
+		}
+
+		if !hasValue {
+			sel = append(sel, Requirement{Key: key, Exists: true})
+			continue
+		}
+		sel = append(sel, Requirement{Key: key, Value: strings.TrimSpace(value)})
+	}
+	return sel, nil
+}
+
+// Matches reports whether annotations satisfy every requirement of the selector, an empty selector matches everything
+func (s Selector) Matches(annotations map[string]string) bool {
+	for _, r := range s {
+		v, ok := annotations[r.Key]
+		if !ok {
+			return false
+		}
+		if !r.Exists && v != r.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// WalkSelected is Walk, but only calls fn for references whose index descriptor annotations satisfy sel
+func (l *Layout) WalkSelected(sel Selector, fn func(reference string, desc ocispec.Descriptor) error) error {
+	return l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		if !sel.Matches(desc.Annotations) {
+			return nil
+		}
+		return fn(reference, desc)
+	})
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrInsufficientSpace is returned when a filesystem can't hold what's about to be written to it
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// minSpaceHeadroom is the least space kept free beyond an estimate, for what can't be estimated in advance
+const minSpaceHeadroom = 64 << 20
+
+// CheckSpace returns ErrInsufficientSpace when the filesystem of path, or of the nearest of its parents that exists,
+// can't hold required bytes
+//
+//	The estimate is padded with 5% of headroom, at least 64MiB, for what can't be estimated in advance such as the
+//	index, temporary files, and the overhead of the filesystem.  Platforms whose free space can't be determined pass.
+func CheckSpace(path string, required int64) error {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("checking free space of [%s]: no parent exists", path)
+		}
+		dir = parent
+	}
+
+	available, err := freeSpace(dir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checking free space of [%s]: %w", dir, err)
+	}
+
+	headroom := max(required/20, minSpaceHeadroom)
+	if uint64(required+headroom) > available {
+		return fmt.Errorf("%w on [%s]: [%s] required along with [%s] of headroom, [%s] available",
+			ErrInsufficientSpace, dir, FormatSize(required), FormatSize(headroom), FormatSize(int64(available)))
+	}
+	return nil
+}
+
+// FormatSize formats a count of bytes in decimal units, such as 4.7 GB, the way ParseSize reads them back
+func FormatSize(b int64) string {
+	const unit = 1000
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
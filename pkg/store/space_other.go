@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || openbsd || netbsd || dragonfly || windows)
+
+package store
+
+import "errors"
+
+// freeSpace can't determine the free space of filesystems on this platform
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package store
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the bytes available to the user on the volume of dir, which accounts for quotas
+func freeSpace(dir string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &available, &total, &free); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
@@ -0,0 +1,255 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/platforms"
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/hauler/pkg/consts"
+	hreference "github.com/rancherfederal/hauler/pkg/reference"
+)
+
+var (
+	ErrDigestNotFound    = errors.New("digest not found")
+	ErrReferenceNotFound = errors.New("reference not found")
+)
+
+// Stat returns the index descriptor of reference
+//
+//	reference may be a tag or digest reference, or a bare digest, and is matched using the same defaults as when
+//	content is added to the store: an omitted registry, namespace, or tag fall back to docker hub, hauler, and latest.
+//	When several entries match, such as an image and its signatures, the image is preferred, followed by the first
+//	reference name in sorted order.  ErrReferenceNotFound is returned when nothing matches.
+func (l *Layout) Stat(ctx context.Context, reference string) (ocispec.Descriptor, error) {
+	m, err := newRefMatcher(reference)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	var matches []ocispec.Descriptor
+	if err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		if m.matches(desc) {
+			matches = append(matches, desc)
+		}
+		return nil
+	}); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if len(matches) == 0 {
+		return ocispec.Descriptor{}, fmt.Errorf("%w: [%s]", ErrReferenceNotFound, reference)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		ii := strings.HasPrefix(matches[i].Annotations[consts.KindAnnotationName], consts.KindAnnotation)
+		ij := strings.HasPrefix(matches[j].Annotations[consts.KindAnnotationName], consts.KindAnnotation)
+		if ii != ij {
+			return ii
+		}
+		return matches[i].Annotations[ocispec.AnnotationRefName] < matches[j].Annotations[ocispec.AnnotationRefName]
+	})
+	return matches[0], nil
+}
+
+// StatByDigest looks up content in the store by its digest, returning its descriptor and every reference tagging it
+//
+//	When dgst is a manifest tagged in index.json, the descriptor is the index entry of the first tag in sorted order.
+//	Content that exists in the store without being tagged, such as a layer or config, returns a descriptor with only the
+//	digest and size set and no tags.  ErrDigestNotFound is returned if the store holds no content with that digest.
+func (l *Layout) StatByDigest(ctx context.Context, dgst digest.Digest) (ocispec.Descriptor, []string, error) {
+	if err := dgst.Validate(); err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+
+	var (
+		found bool
+		desc  ocispec.Descriptor
+	)
+	tagged := make(map[string]ocispec.Descriptor)
+	if err := l.OCI.Walk(func(_ string, d ocispec.Descriptor) error {
+		if d.Digest != dgst {
+			return nil
+		}
+		found = true
+		desc = d
+
+		if tag := d.Annotations[ocispec.AnnotationRefName]; tag != "" {
+			tagged[tag] = d
+		}
+		return nil
+	}); err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+
+	if found {
+		var tags []string
+		for tag := range tagged {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+
+		// the index is unordered, so settle on the entry of the first tag to keep the result stable
+		if len(tags) > 0 {
+			desc = tagged[tags[0]]
+		}
+		return desc, tags, nil
+	}
+
+	fi, err := os.Stat(filepath.Join(l.Root, "blobs", dgst.Algorithm().String(), dgst.Encoded()))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ocispec.Descriptor{}, nil, fmt.Errorf("%w: [%s]", ErrDigestNotFound, dgst)
+		}
+		return ocispec.Descriptor{}, nil, err
+	}
+	return ocispec.Descriptor{Digest: dgst, Size: fi.Size()}, nil, nil
+}
+
+// Missing returns the descriptors among descs whose blobs aren't in the store yet, each digest only once
+func (l *Layout) Missing(descs []ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	seen := make(map[digest.Digest]bool, len(descs))
+	var missing []ocispec.Descriptor
+	for _, desc := range descs {
+		if seen[desc.Digest] {
+			continue
+		}
+		seen[desc.Digest] = true
+
+		_, err := os.Stat(filepath.Join(l.Root, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded()))
+		if os.IsNotExist(err) {
+			missing = append(missing, desc)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// Current reports whether the content stored as reference is up to date with remote, the descriptor a registry
+// currently serves for it, so fetching it again can be skipped
+//
+//	manifests are remote's manifests when it's an index, and ps the platforms the content is narrowed down to when
+//	added to the store.  Content narrowed down to some platforms is current when it holds exactly the manifests remote
+//	serves for those platforms, whether stored as a filtered index or, for a single platform, as the manifest itself.
+func (l *Layout) Current(ctx context.Context, reference string, remote ocispec.Descriptor, manifests []ocispec.Descriptor, ps ...ocispec.Platform) (bool, error) {
+	stored, err := l.Stat(ctx, reference)
+	if errors.Is(err, ErrReferenceNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if stored.Digest == remote.Digest {
+		return true, nil
+	}
+	if len(ps) == 0 || len(manifests) == 0 {
+		return false, nil
+	}
+
+	matchers := make([]platforms.Matcher, len(ps))
+	for i, p := range ps {
+		matchers[i] = platforms.NewMatcher(p)
+	}
+	want := make(map[digest.Digest]bool)
+	for _, m := range manifests {
+		if m.Platform != nil && matchesAny(matchers, *m.Platform) {
+			want[m.Digest] = true
+		}
+	}
+
+	switch stored.MediaType {
+	case consts.OCIManifestSchema1, consts.DockerManifestSchema2:
+		return len(want) == 1 && want[stored.Digest], nil
+
+	case consts.OCIImageIndexSchema, consts.DockerManifestListSchema2:
+		children, err := l.children(ctx, stored)
+		if err != nil {
+			return false, err
+		}
+		if len(children) != len(want) {
+			return false, nil
+		}
+		for _, c := range children {
+			if !want[c.Digest] {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// refMatcher matches index entries against a user supplied reference
+type refMatcher struct {
+	raw string
+
+	// dgst is set for digest references and bare digests
+	dgst digest.Digest
+
+	// refs are the parsed forms of raw, empty for bare digests
+	refs []gname.Reference
+}
+
+func newRefMatcher(ref string) (*refMatcher, error) {
+	m := &refMatcher{raw: ref}
+	if d, err := digest.Parse(ref); err == nil {
+		m.dgst = d
+		return m, nil
+	}
+
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	m.refs = append(m.refs, r)
+
+	// content added to the store by hauler is namespaced by reference.Parse rather than left to docker hub's defaults
+	if hr, err := hreference.Parse(ref); err == nil {
+		if r, err := gname.ParseReference(hr.String()); err == nil {
+			m.refs = append(m.refs, r)
+		}
+	}
+
+	if d, ok := m.refs[0].(gname.Digest); ok {
+		m.dgst = digest.Digest(d.DigestStr())
+	}
+	return m, nil
+}
+
+// matches reports whether desc's reference name, and for digest references its digest, match the reference
+func (m *refMatcher) matches(desc ocispec.Descriptor) bool {
+	name := desc.Annotations[ocispec.AnnotationRefName]
+	if name == m.raw {
+		return true
+	}
+	if m.dgst != "" && desc.Digest != m.dgst {
+		return false
+	}
+	if len(m.refs) == 0 {
+		return true
+	}
+
+	r, err := gname.ParseReference(name)
+	if err != nil {
+		return false
+	}
+	for _, ref := range m.refs {
+		if m.dgst != "" && ref.Context().Name() == r.Context().Name() {
+			return true
+		}
+		if ref.Name() == r.Name() {
+			return true
+		}
+	}
+	return false
+}
@@ -3,11 +3,18 @@ package store
 import (
 	"context"
 	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	gname "github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/static"
 	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
@@ -19,12 +26,26 @@ import (
 	"github.com/rancherfederal/hauler/pkg/consts"
 	"github.com/rancherfederal/hauler/pkg/content"
 	"github.com/rancherfederal/hauler/pkg/layer"
+	"github.com/rancherfederal/hauler/pkg/log"
+	"github.com/rancherfederal/hauler/pkg/progress"
+	"github.com/rancherfederal/hauler/pkg/report"
+	"github.com/rancherfederal/hauler/pkg/telemetry"
+)
+
+var (
+	ErrDigestNotAllowed = errors.New("digest not allowed")
+	ErrDigestMismatch   = errors.New("digest mismatch")
 )
 
 type Layout struct {
 	*content.OCI
-	Root  string
-	cache layer.Cache
+	Root      string
+	cache     layer.Cache
+	userAgent string
+	transport content.TransportOptions
+
+	layerConcurrency int
+	lockTimeout      time.Duration
 }
 
 type Options func(*Layout)
@@ -35,6 +56,37 @@ func WithCache(c layer.Cache) Options {
 	}
 }
 
+// WithUserAgent sets the User-Agent sent on outbound registry requests made on behalf of the store
+func WithUserAgent(ua string) Options {
+	return func(l *Layout) {
+		l.userAgent = ua
+	}
+}
+
+// WithTransportOptions sets the retry and timeout policy for outbound registry requests made on behalf of the store
+func WithTransportOptions(opts content.TransportOptions) Options {
+	return func(l *Layout) {
+		l.transport = opts
+	}
+}
+
+// WithLayerConcurrency sets how many layers of a single artifact are downloaded at once when adding it
+func WithLayerConcurrency(n int) Options {
+	return func(l *Layout) {
+		if n > 0 {
+			l.layerConcurrency = n
+		}
+	}
+}
+
+// WithLockTimeout sets how long Lock waits for another process holding the store, 0 fails at once and a negative
+// timeout waits for as long as it takes
+func WithLockTimeout(d time.Duration) Options {
+	return func(l *Layout) {
+		l.lockTimeout = d
+	}
+}
+
 func NewLayout(rootdir string, opts ...Options) (*Layout, error) {
 	ociStore, err := content.NewOCI(rootdir)
 	if err != nil {
@@ -48,6 +100,8 @@ func NewLayout(rootdir string, opts ...Options) (*Layout, error) {
 	l := &Layout{
 		Root: rootdir,
 		OCI:  ociStore,
+
+		layerConcurrency: defaultLayerConcurrency,
 	}
 
 	for _, opt := range opts {
@@ -59,11 +113,20 @@ func NewLayout(rootdir string, opts ...Options) (*Layout, error) {
 
 // AddOCI adds an artifacts.OCI to the store
 //
-//	The method to achieve this is to save artifact.OCI to a temporary directory in an OCI layout compatible form.  Once
-//	saved, the entirety of the layout is copied to the store (which is just a registry).  This allows us to not only use
-//	strict types to define generic content, but provides a processing pipeline suitable for extensibility.  In the
-//	future we'll allow users to define their own content that must adhere either by artifact.OCI or simply an OCI layout.
-func (l *Layout) AddOCI(ctx context.Context, oci artifacts.OCI, ref string) (ocispec.Descriptor, error) {
+//	Every blob is streamed straight into the blobs of the store, with no layout staged beside it, so adding an artifact
+//	reads and writes its content once and needs no more free space than the artifact itself.  With a cache, layers are
+//	read from it when held and written into it as they're streamed otherwise.  The manifest is written once its config
+//	and layers are in place and the index entry last, so an interrupted add never leaves a manifest with missing blobs.
+func (l *Layout) AddOCI(ctx context.Context, oci artifacts.OCI, ref string) (_ ocispec.Descriptor, err error) {
+	ctx, span := telemetry.Start(ctx, "store.AddOCI", telemetry.Reference(ref))
+	defer func() { telemetry.End(span, err) }()
+
+	// taken before the cache wraps oci, which hides it
+	var repo string
+	if src, ok := oci.(artifacts.Sourced); ok {
+		repo = src.Repository()
+	}
+
 	if l.cache != nil {
 		cached := layer.OCICache(oci, l.cache)
 		oci = cached
@@ -75,11 +138,16 @@ func (l *Layout) AddOCI(ctx context.Context, oci artifacts.OCI, ref string) (oci
 		return ocispec.Descriptor{}, err
 	}
 
-	mdata, err := json.Marshal(m)
-	if err != nil {
-		return ocispec.Descriptor{}, err
+	var artifactType string
+	if at, ok := oci.(artifacts.ArtifactTyper); ok {
+		artifactType = at.ArtifactType()
 	}
-	if err := l.writeBlobData(mdata); err != nil {
+
+	mdata, err := json.Marshal(struct {
+		*v1.Manifest
+		ArtifactType string `json:"artifactType,omitempty"`
+	}{m, artifactType})
+	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
 
@@ -88,35 +156,49 @@ func (l *Layout) AddOCI(ctx context.Context, oci artifacts.OCI, ref string) (oci
 	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
-
-	static.NewLayer(cdata, "")
-
 	if err := l.writeBlobData(cdata); err != nil {
 		return ocispec.Descriptor{}, err
 	}
 
-	// write blob layers concurrently
+	// write blob layers concurrently, a large image is downloaded several layers at a time
 	layers, err := oci.Layers()
 	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
 
+	var size int64
+	for _, lyr := range layers {
+		if n, err := lyr.Size(); err == nil {
+			size += n
+		}
+	}
+	span.SetAttributes(telemetry.Bytes(size))
+	task := progress.FromContext(ctx).Track(ref, size)
+	defer task.Done()
+
 	var g errgroup.Group
+	g.SetLimit(l.layerConcurrency)
 	for _, lyr := range layers {
 		lyr := lyr
 		g.Go(func() error {
-			return l.writeLayer(lyr)
+			return l.writeLayer(ctx, lyr, repo, task)
 		})
 	}
 	if err := g.Wait(); err != nil {
 		return ocispec.Descriptor{}, err
 	}
 
+	// the manifest is written last, so it's never in the store without its blobs
+	if err := l.writeBlobData(mdata); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
 	// Build index
 	idx := ocispec.Descriptor{
-		MediaType: string(m.MediaType),
-		Digest:    digest.FromBytes(mdata),
-		Size:      int64(len(mdata)),
+		MediaType:    string(m.MediaType),
+		Digest:       digest.FromBytes(mdata),
+		Size:         int64(len(mdata)),
+		ArtifactType: artifactType,
 		Annotations: map[string]string{
 			consts.KindAnnotationName: consts.KindAnnotation,
 			ocispec.AnnotationRefName: ref,
@@ -124,32 +206,98 @@ func (l *Layout) AddOCI(ctx context.Context, oci artifacts.OCI, ref string) (oci
 		URLs:     nil,
 		Platform: nil,
 	}
+	span.SetAttributes(telemetry.Digest(idx.Digest))
 
-	return idx, l.OCI.AddIndex(idx)
+	return idx, l.addIndex(AuditAdd, idx)
 }
 
-// AddOCICollection .
-func (l *Layout) AddOCICollection(ctx context.Context, collection artifacts.OCICollection) ([]ocispec.Descriptor, error) {
+// AddOCICollection adds every artifact of the collection to the store
+//
+//	The first reference failing to add stops the rest, unless WithContinueOnError is given, in which case every failure
+//	is returned together in an AddCollectionError along with what was added.
+func (l *Layout) AddOCICollection(ctx context.Context, collection artifacts.OCICollection, opts ...AddOption) (_ []ocispec.Descriptor, err error) {
+	ctx, span := telemetry.Start(ctx, "store.AddOCICollection")
+	defer func() { telemetry.End(span, err) }()
+
+	o := makeAddOpts(opts...)
+
 	cnts, err := collection.Contents()
 	if err != nil {
 		return nil, err
 	}
 
 	var descs []ocispec.Descriptor
+	var failures []*AddError
 	for ref, oci := range cnts {
+		start := time.Now()
 		desc, err := l.AddOCI(ctx, oci, ref)
 		if err != nil {
-			return nil, err
+			if !o.continueOnError {
+				return nil, err
+			}
+			failures = append(failures, &AddError{Reference: ref, Err: err})
+			continue
 		}
 		descs = append(descs, desc)
+
+		if r := report.FromContext(ctx); r != nil {
+			r.Record(report.Entry{
+				Kind:      desc.Annotations[consts.KindAnnotationName],
+				Reference: ref,
+				Digest:    desc.Digest.String(),
+				Size:      l.graphSize(ctx, desc),
+				Duration:  time.Since(start),
+				Status:    report.StatusSucceeded,
+			})
+		}
+	}
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool { return failures[i].Reference < failures[j].Reference })
+		return descs, &AddCollectionError{Failures: failures, Total: len(cnts)}
 	}
 	return descs, nil
 }
 
+// AddError is a single reference of a collection that failed to add to the store
+type AddError struct {
+	Reference string
+	Err       error
+}
+
+func (e *AddError) Error() string {
+	return fmt.Sprintf("adding [%s]: %v", e.Reference, e.Err)
+}
+
+func (e *AddError) Unwrap() error {
+	return e.Err
+}
+
+// AddCollectionError reports every reference AddOCICollection failed to add when continuing on error
+type AddCollectionError struct {
+	Failures []*AddError
+	Total    int
+}
+
+func (e *AddCollectionError) Error() string {
+	if len(e.Failures) == 1 {
+		return e.Failures[0].Error()
+	}
+	return fmt.Sprintf("failed to add [%d] of [%d] references", len(e.Failures), e.Total)
+}
+
+func (e *AddCollectionError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f
+	}
+	return errs
+}
+
 // Flush is a fancy name for delete-all-the-things, in this case it's as trivial as deleting oci-layout content
 //
 //	This can be a highly destructive operation if the store's directory happens to be inline with other non-store contents
 //	To reduce the blast radius and likelihood of deleting things we don't own, Flush explicitly deletes oci-layout content only
+//	The audit log is kept, recording the flush along with everything before it
 func (l *Layout) Flush(ctx context.Context) error {
 	blobs := filepath.Join(l.Root, "blobs")
 	if err := os.RemoveAll(blobs); err != nil {
@@ -166,46 +314,329 @@ func (l *Layout) Flush(ctx context.Context) error {
 		return err
 	}
 
-	return nil
+	return l.Audit(AuditFlush)
 }
 
 // Copy will copy a given reference to a given target.Target
 //
-//	This is essentially a wrapper around oras.Copy, but locked to this content store
-func (l *Layout) Copy(ctx context.Context, ref string, to target.Target, toRef string) (ocispec.Descriptor, error) {
-	return oras.Copy(ctx, l.OCI, ref, to, toRef,
-		oras.WithAdditionalCachedMediaTypes(consts.DockerManifestSchema2, consts.DockerManifestListSchema2))
+//	This is essentially a wrapper around oras.Copy, but locked to this content store.  A reference rejected by the
+//	digest allow or deny lists always returns ErrDigestNotAllowed, regardless of WithStrictDigests.  When the target
+//	implements BlobChecker, blobs it already holds are skipped and only the missing blobs and manifests are sent.  A copy
+//	failing because the target rejected its credentials, such as a token expiring mid-transfer, is resumed with fresh
+//	credentials up to WithAuthRetries times.  A copy failing with a transient error, such as a dropped connection or a 5xx
+//	from the target, is retried up to WithRetries times with an exponential backoff bounded by WithRetryDelay.
+func (l *Layout) Copy(ctx context.Context, ref string, to target.Target, toRef string, opts ...CopyOption) (_ ocispec.Descriptor, err error) {
+	ctx, span := telemetry.Start(ctx, "store.Copy", telemetry.Reference(ref))
+	defer func() { telemetry.End(span, err) }()
+
+	o := makeCopyOpts(opts...)
+	start := time.Now()
+
+	_, root, err := l.OCI.Resolve(ctx, ref)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if root.Digest == "" {
+		return ocispec.Descriptor{}, fmt.Errorf("%w: [%s]", ErrReferenceNotFound, ref)
+	}
+
+	if err := o.checkDigest(root.Digest); err != nil {
+		err = fmt.Errorf("copying [%s]: %w", ref, err)
+		report.FromContext(ctx).Record(copyEntry(ref, toRef, root, 0, start, err))
+		return ocispec.Descriptor{}, err
+	}
+
+	probeRef := toRef
+	if probeRef == "" {
+		probeRef = ref
+	}
+
+	size := l.graphSize(ctx, root)
+	span.SetAttributes(telemetry.Digest(root.Digest), telemetry.Bytes(size))
+	task := progress.FromContext(ctx).Track(ref, size)
+	defer task.Done()
+
+	var pt *progressTarget
+	var done func(error)
+	if o.verbose || task != nil {
+		pt = newProgressTarget(to, task)
+	}
+	if o.verbose {
+		done = pt.report(ctx, ref, o.progressInterval)
+	}
+
+	var desc ocispec.Descriptor
+	authAttempts, retries := 0, 0
+	delay := o.retryDelay
+	for {
+		dest := to
+		// re-probing on every attempt is what lets a retry resume, rather than re-send what already made it across
+		if o.skipExisting {
+			dest = l.skipExisting(ctx, dest, probeRef, root, o.probeConcurrency)
+		}
+		if pt != nil {
+			pt.Target = dest
+			dest = pt
+		}
+
+		desc, err = oras.Copy(ctx, l.OCI, ref, dest, toRef,
+			oras.WithAdditionalCachedMediaTypes(consts.DockerManifestSchema2, consts.DockerManifestListSchema2))
+		if err == nil {
+			break
+		}
+
+		if content.IsUnauthorized(err) && authAttempts < o.authRetries {
+			authAttempts++
+			log.FromContext(ctx).Infof("authorization rejected copying [%s], refreshing credentials and resuming: %v", ref, err)
+			continue
+		}
+
+		if !content.IsTransient(err) || retries >= o.retries {
+			break
+		}
+		retries++
+		log.FromContext(ctx).Warnf("copying [%s] failed, retrying in %s (%d of %d): %v", ref, delay, retries, o.retries, err)
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(delay):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		delay = min(delay*2, o.maxRetryDelay)
+	}
+
+	if err == nil && o.requireDigestMatch {
+		err = checkDigestMatch(ctx, to, probeRef, root.Digest)
+	}
+
+	if done != nil {
+		done(err)
+	}
+	if err == nil {
+		logCopied(ctx, ref, toRef, root, size, start)
+	}
+	report.FromContext(ctx).Record(copyEntry(ref, toRef, root, size, start, err))
+	return desc, err
+}
+
+// copyEntry returns the report entry of copying root, referenced by ref, as toRef, err being the error it failed with
+func copyEntry(ref string, toRef string, root ocispec.Descriptor, size int64, start time.Time, err error) report.Entry {
+	if name := root.Annotations[ocispec.AnnotationRefName]; name != "" {
+		ref = name
+	}
+	e := report.Entry{
+		Kind:      root.Annotations[consts.KindAnnotationName],
+		Reference: ref,
+		Digest:    root.Digest.String(),
+		Size:      size,
+		Duration:  time.Since(start),
+		Status:    report.StatusSucceeded,
+	}
+	if toRef != ref {
+		e.Target = toRef
+	}
+	if err != nil {
+		e.Status = report.StatusFailed
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// logCopied logs that ref was copied, with the structured fields of its outcome
+func logCopied(ctx context.Context, ref string, toRef string, root ocispec.Descriptor, size int64, start time.Time) {
+	if name := root.Annotations[ocispec.AnnotationRefName]; name != "" {
+		ref = name
+	}
+	l := log.FromContext(ctx).With(log.Fields{
+		log.FieldReference: ref,
+		log.FieldDigest:    root.Digest.String(),
+		log.FieldBytes:     size,
+		log.FieldDuration:  time.Since(start),
+	})
+	if toRef != "" && toRef != ref {
+		l.Infof("copied [%s] as [%s]", ref, toRef)
+		return
+	}
+	l.Infof("copied [%s]", ref)
+}
+
+// checkDigestMatch resolves ref on to, failing with ErrDigestMismatch unless it resolves to want
+func checkDigestMatch(ctx context.Context, to target.Target, ref string, want digest.Digest) error {
+	_, desc, err := to.Resolve(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("resolving [%s] to check its digest: %w", ref, err)
+	}
+	if desc.Digest != want {
+		return fmt.Errorf("%w: [%s] resolves to [%s] on the destination, the store holds [%s]", ErrDigestMismatch, ref, desc.Digest, want)
+	}
+	return nil
 }
 
 // CopyAll performs bulk copy operations on the stores oci layout to a provided target.Target
-func (l *Layout) CopyAll(ctx context.Context, to target.Target, toMapper func(string) (string, error)) ([]ocispec.Descriptor, error) {
-	var descs []ocispec.Descriptor
-	err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
-		toRef := ""
-		if toMapper != nil {
-			tr, err := toMapper(reference)
-			if err != nil {
-				return err
+//
+//	When provided, toMapper is given each descriptor's reference name and returns the reference to copy it to.  Cosign
+//	signatures, attestations, and sboms share the reference name of the image they belong to, so their mapped reference
+//	is re-tagged using cosign's sha256-<digest>.<suffix> convention rather than overwriting the image's tag.  OCI 1.1
+//	referrers are pushed by digest, leaving the destination to index them by their subject.  Up to
+//	WithConcurrency references are copied at once.  A reference still failing once Copy's retries are exhausted
+//	doesn't stop the others, every failure is returned together in a CopyAllError along with what was copied.
+func (l *Layout) CopyAll(ctx context.Context, to target.Target, toMapper func(string) (string, error), opts ...CopyOption) (_ []ocispec.Descriptor, err error) {
+	ctx, span := telemetry.Start(ctx, "store.CopyAll")
+	defer func() { telemetry.End(span, err) }()
+
+	logger := log.FromContext(ctx)
+	o := makeCopyOpts(opts...)
+
+	images, err := l.imageDigests()
+	if err != nil {
+		return nil, err
+	}
+
+	type job struct {
+		reference string
+		name      string
+		toRef     string
+	}
+
+	var jobs []job
+	err = l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		if !o.selector.Matches(desc.Annotations) || !o.refFilter.Matches(desc.Annotations[ocispec.AnnotationRefName]) {
+			return nil
+		}
+
+		if err := o.checkDigest(desc.Digest); err != nil {
+			if o.strictDigests {
+				return fmt.Errorf("copying [%s]: %w", reference, err)
 			}
-			toRef = tr
+			logger.Warnf("skipping [%s]: %v", reference, err)
+			e := copyEntry(reference, "", desc, 0, time.Now(), err)
+			e.Status = report.StatusSkipped
+			report.FromContext(ctx).Record(e)
+			return nil
 		}
 
-		desc, err := l.Copy(ctx, reference, to, toRef)
+		toRef, err := mapRef(toMapper, desc, images)
 		if err != nil {
 			return err
 		}
 
-		descs = append(descs, desc)
+		name := desc.Annotations[ocispec.AnnotationRefName]
+		if name == "" {
+			name = reference
+		}
+		jobs = append(jobs, job{reference: reference, name: name, toRef: toRef})
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+
+	copied := make([]ocispec.Descriptor, len(jobs))
+	failures := make([]*CopyError, len(jobs))
+	var g errgroup.Group
+	g.SetLimit(o.concurrency)
+	for i, j := range jobs {
+		i, j := i, j
+		g.Go(func() error {
+			desc, err := l.Copy(ctx, j.reference, to, j.toRef, opts...)
+			if err != nil {
+				failures[i] = &CopyError{Reference: j.name, Err: err}
+				return nil
+			}
+			copied[i] = desc
+			return nil
+		})
+	}
+	g.Wait()
+
+	var descs []ocispec.Descriptor
+	var errs []*CopyError
+	for i := range jobs {
+		if failures[i] != nil {
+			errs = append(errs, failures[i])
+			continue
+		}
+		descs = append(descs, copied[i])
+	}
+	if len(errs) > 0 {
+		return descs, &CopyAllError{Failures: errs, Total: len(jobs)}
+	}
 	return descs, nil
 }
 
+// CopyError is a single reference CopyAll failed to copy, once its retries were exhausted
+//
+//	Reference is the reference the content was added to the store as, rather than the key the store indexes it by.
+type CopyError struct {
+	Reference string
+	Err       error
+}
+
+func (e *CopyError) Error() string {
+	return fmt.Sprintf("copying [%s]: %v", e.Reference, e.Err)
+}
+
+func (e *CopyError) Unwrap() error {
+	return e.Err
+}
+
+// CopyAllError reports every reference CopyAll failed to copy
+type CopyAllError struct {
+	Failures []*CopyError
+	Total    int
+}
+
+func (e *CopyAllError) Error() string {
+	if len(e.Failures) == 1 {
+		return e.Failures[0].Error()
+	}
+	return fmt.Sprintf("failed to copy [%d] of [%d] references", len(e.Failures), e.Total)
+}
+
+func (e *CopyAllError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f
+	}
+	return errs
+}
+
+// UserAgent returns the User-Agent used for outbound registry requests, defaulting to content.DefaultUserAgent
+func (l *Layout) UserAgent() string {
+	if l.userAgent == "" {
+		return content.DefaultUserAgent()
+	}
+	return l.userAgent
+}
+
+// TransportOptions returns the retry and timeout policy for outbound registry requests
+func (l *Layout) TransportOptions() content.TransportOptions {
+	return l.transport
+}
+
+// RemoteOptions returns the remote.Option's that should be used for any registry requests made on behalf of the store
+func (l *Layout) RemoteOptions() []remote.Option {
+	base, ok := remote.DefaultTransport.(*http.Transport)
+	if !ok {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	return []remote.Option{
+		remote.WithUserAgent(l.UserAgent()),
+		remote.WithAuthFromKeychain(l.transport.Keychain()),
+		remote.WithTransport(l.transport.Transport(base)),
+	}
+}
+
 // Identify is a helper function that will identify a human-readable content type given a descriptor
+//
+//	An OCI 1.1 artifactType takes precedence over the config's media type, as it does for registries
 func (l *Layout) Identify(ctx context.Context, desc ocispec.Descriptor) string {
+	if desc.ArtifactType != "" {
+		return desc.ArtifactType
+	}
+
 	rc, err := l.OCI.Fetch(ctx, desc)
 	if err != nil {
 		return ""
@@ -213,7 +644,8 @@ func (l *Layout) Identify(ctx context.Context, desc ocispec.Descriptor) string {
 	defer rc.Close()
 
 	m := struct {
-		Config struct {
+		ArtifactType string `json:"artifactType"`
+		Config       struct {
 			MediaType string `json:"mediaType"`
 		} `json:"config"`
 	}{}
@@ -221,42 +653,75 @@ func (l *Layout) Identify(ctx context.Context, desc ocispec.Descriptor) string {
 		return ""
 	}
 
+	if m.ArtifactType != "" {
+		return m.ArtifactType
+	}
 	return m.Config.MediaType
 }
 
 func (l *Layout) writeBlobData(data []byte) error {
 	blob := static.NewLayer(data, "") // NOTE: MediaType isn't actually used in the writing
-	return l.writeLayer(blob)
+	return l.writeLayer(context.Background(), blob, "", nil)
 }
 
-func (l *Layout) writeLayer(layer v1.Layer) error {
-	d, err := layer.Digest()
-	if err != nil {
-		return err
+// imageDigests maps the reference name of every image in the store to its digest
+func (l *Layout) imageDigests() (map[string]digest.Digest, error) {
+	images := make(map[string]digest.Digest)
+	if err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		if strings.HasPrefix(desc.Annotations[consts.KindAnnotationName], consts.KindAnnotation) {
+			images[desc.Annotations[ocispec.AnnotationRefName]] = desc.Digest
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// mapRef returns the reference desc should be copied to according to toMapper, or "" to keep its own reference
+//
+//	images is used to re-tag cosign content after the image it belongs to, as returned by imageDigests
+func mapRef(toMapper func(string) (string, error), desc ocispec.Descriptor, images map[string]digest.Digest) (string, error) {
+	if toMapper == nil {
+		return "", nil
 	}
 
-	r, err := layer.Compressed()
+	name := desc.Annotations[ocispec.AnnotationRefName]
+	toRef, err := toMapper(name)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	dir := filepath.Join(l.Root, "blobs", d.Algorithm)
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil && !os.IsExist(err) {
-		return err
+	if suffix, ok := cosignTagSuffixes[desc.Annotations[consts.KindAnnotationName]]; ok {
+		return cosignTag(toRef, images[name], suffix)
+	}
+	// referrers are found by the subject in their manifest, so they're pushed by digest and leave the tag to the image
+	if desc.Annotations[consts.KindAnnotationName] == consts.KindAnnotationReferrers {
+		r, err := gname.ParseReference(toRef)
+		if err != nil {
+			return "", err
+		}
+		return r.Context().Digest(desc.Digest.String()).Name(), nil
 	}
+	return toRef, nil
+}
 
-	blobPath := filepath.Join(dir, d.Hex)
-	// Skip entirely if something exists, assume layer is present already
-	if _, err := os.Stat(blobPath); err == nil {
-		return nil
+// cosignTagSuffixes maps the kinds of content cosign stores alongside an image to the suffix of the tag it expects them under
+var cosignTagSuffixes = map[string]string{
+	consts.KindAnnotationSigs:  ".sig",
+	consts.KindAnnotationAtts:  ".att",
+	consts.KindAnnotationSboms: ".sbom",
+}
+
+// cosignTag returns ref re-tagged as sha256-<hex><suffix>, where d is the digest of the image the content belongs to
+func cosignTag(ref string, d digest.Digest, suffix string) (string, error) {
+	if d == "" {
+		return "", fmt.Errorf("no image found in the store for [%s]", ref)
 	}
 
-	w, err := os.Create(blobPath)
+	r, err := gname.ParseReference(ref)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer w.Close()
-
-	_, err = io.Copy(w, r)
-	return err
+	return fmt.Sprintf("%s:%s-%s%s", r.Context().Name(), d.Algorithm(), d.Encoded(), suffix), nil
 }
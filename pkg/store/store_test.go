@@ -1,14 +1,53 @@
 package store_test
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"filippo.io/age"
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/remotes"
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/gofrs/flock"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/target"
 
 	"github.com/rancherfederal/hauler/pkg/artifacts"
+	"github.com/rancherfederal/hauler/pkg/artifacts/image"
+	"github.com/rancherfederal/hauler/pkg/artifacts/memory"
+	"github.com/rancherfederal/hauler/pkg/consts"
+	"github.com/rancherfederal/hauler/pkg/content"
+	"github.com/rancherfederal/hauler/pkg/layer"
+	"github.com/rancherfederal/hauler/pkg/report"
 	"github.com/rancherfederal/hauler/pkg/store"
 )
 
@@ -62,6 +101,4386 @@ func TestLayout_AddOCI(t *testing.T) {
 	}
 }
 
+func TestLayout_Copy_Verbose(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moci := genArtifact(t, "hello/world:v1")
+	desc, err := s.AddOCI(ctx, moci, "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every blob of a fresh artifact is written to an empty destination, so the count must equal their sum
+	want := desc.Size
+	cdata, err := moci.RawConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want += int64(len(cdata))
+	layers, err := moci.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, lyr := range layers {
+		size, err := lyr.Size()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want += size
+	}
+
+	var ref string
+	if err := s.Walk(func(reference string, _ ocispec.Descriptor) error {
+		ref = reference
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	dest, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := store.NewProgressTarget(dest.OCI)
+
+	if _, err := s.Copy(ctx, ref, pt, "", store.WithVerbose(), store.WithProgressInterval(time.Millisecond)); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+
+	if got := pt.Transferred(); got != want {
+		t.Errorf("Transferred() = %d, want %d", got, want)
+	}
+}
+
+func TestByteCount(t *testing.T) {
+	tests := []struct {
+		b    int64
+		want string
+	}{
+		{b: 0, want: "0 B"},
+		{b: 999, want: "999 B"},
+		{b: 1000, want: "1.0 kB"},
+		{b: 1500, want: "1.5 kB"},
+		{b: 999999, want: "1000.0 kB"},
+		{b: 1000000, want: "1.0 MB"},
+		{b: 2500000000, want: "2.5 GB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := store.ByteCount(tt.b); got != tt.want {
+				t.Errorf("byteCount(%d) = %s, want %s", tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int64
+		elapsed time.Duration
+		want    string
+	}{
+		{name: "zero elapsed", n: 1000000, elapsed: 0, want: "0.00 MB/s"},
+		{name: "negative elapsed", n: 1000000, elapsed: -time.Second, want: "0.00 MB/s"},
+		{name: "nothing transferred", n: 0, elapsed: time.Second, want: "0.00 MB/s"},
+		{name: "one megabyte per second", n: 1000000, elapsed: time.Second, want: "1.00 MB/s"},
+		{name: "partial second", n: 5000000, elapsed: 2 * time.Second, want: "2.50 MB/s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := store.Throughput(tt.n, tt.elapsed); got != tt.want {
+				t.Errorf("throughput(%d, %s) = %s, want %s", tt.n, tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayout_UserAgent(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	var mu sync.Mutex
+	var agents []string
+	srv := httptest.NewServer(func() http.Handler {
+		reg := registry.New()
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Path, "/manifests/") || strings.Contains(r.URL.Path, "/blobs/") {
+				mu.Lock()
+				agents = append(agents, r.UserAgent())
+				mu.Unlock()
+			}
+			reg.ServeHTTP(w, r)
+		})
+	}())
+	defer srv.Close()
+
+	ref, err := name.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/hauler/agent:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts []store.Options
+		want string
+	}{
+		{
+			name: "should default to hauler and its version",
+			want: content.DefaultUserAgent(),
+		},
+		{
+			name: "should use the configured user agent",
+			opts: []store.Options{store.WithUserAgent("airgap-mirror/1.0")},
+			want: "airgap-mirror/1.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := store.NewLayout(root, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.UserAgent(); got != tt.want {
+				t.Fatalf("UserAgent() = %s, want %s", got, tt.want)
+			}
+
+			mu.Lock()
+			agents = nil
+			mu.Unlock()
+
+			// fetch the manifest and then a blob through the store's remote options
+			rimg, err := remote.Image(ref, s.RemoteOptions()...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			layers, err := rimg.Layers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rc, err := layers[0].Compressed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rc.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(agents) < 2 {
+				t.Fatalf("expected manifest and blob requests, got %d", len(agents))
+			}
+			for _, got := range agents {
+				// go-containerregistry appends its own product token after ours
+				if !strings.HasPrefix(got, tt.want) {
+					t.Errorf("request User-Agent = %s, want prefix %s", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLayout_CopyAll_DigestFilters(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed, err := s.AddOCI(ctx, genArtifact(t, "hello/allowed:v1"), "hello/allowed:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	denied, err := s.AddOCI(ctx, genArtifact(t, "hello/denied:v1"), "hello/denied:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.AddOCI(ctx, genArtifact(t, "hello/other:v1"), "hello/other:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []store.CopyOption
+		want    []digest.Digest
+		wantErr error
+	}{
+		{
+			name: "should copy everything without filters",
+			want: []digest.Digest{allowed.Digest, denied.Digest, other.Digest},
+		},
+		{
+			name: "should skip denied digests",
+			opts: []store.CopyOption{store.WithDenyDigests(denied.Digest)},
+			want: []digest.Digest{allowed.Digest, other.Digest},
+		},
+		{
+			name: "should only copy allowed digests",
+			opts: []store.CopyOption{store.WithAllowDigests(allowed.Digest)},
+			want: []digest.Digest{allowed.Digest},
+		},
+		{
+			name: "should let deny win over allow",
+			opts: []store.CopyOption{store.WithAllowDigests(allowed.Digest, denied.Digest), store.WithDenyDigests(denied.Digest)},
+			want: []digest.Digest{allowed.Digest},
+		},
+		{
+			name:    "should fail on denied digests when strict",
+			opts:    []store.CopyOption{store.WithDenyDigests(denied.Digest), store.WithStrictDigests()},
+			wantErr: store.ErrDigestNotAllowed,
+		},
+		{
+			name:    "should fail on digests missing from the allow list when strict",
+			opts:    []store.CopyOption{store.WithAllowDigests(allowed.Digest), store.WithStrictDigests()},
+			wantErr: store.ErrDigestNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, err := store.NewLayout(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.CopyAll(ctx, dest.OCI, nil, tt.opts...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("CopyAll() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CopyAll() error = %v", err)
+			}
+
+			want := make(map[digest.Digest]bool)
+			for _, d := range tt.want {
+				want[d] = true
+			}
+			copied := make(map[digest.Digest]bool)
+			for _, d := range got {
+				copied[d.Digest] = true
+			}
+			if !reflect.DeepEqual(copied, want) {
+				t.Errorf("CopyAll() copied %v, want %v", copied, want)
+			}
+
+			// the destination must hold exactly what was copied, and nothing that was filtered
+			for _, d := range []digest.Digest{allowed.Digest, denied.Digest, other.Digest} {
+				if exists := blobExists(dest, d); exists != want[d] {
+					t.Errorf("destination has [%s] = %v, want %v", d, exists, want[d])
+				}
+			}
+		})
+	}
+}
+
+func TestLayout_CopyAll_Report(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed, err := s.AddOCI(ctx, genArtifact(t, "hello/allowed:v1"), "hello/allowed:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	denied, err := s.AddOCI(ctx, genArtifact(t, "hello/denied:v1"), "hello/denied:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := report.New("copy", root)
+	if _, err := s.CopyAll(report.WithContext(ctx, r), dest.OCI, nil, store.WithDenyDigests(denied.Digest)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]report.Entry)
+	for _, e := range r.Artifacts {
+		got[e.Reference] = e
+	}
+	if len(got) != 2 {
+		t.Fatalf("report records %v, want an entry for each reference", r.Artifacts)
+	}
+
+	if e := got["hello/allowed:v1"]; e.Status != report.StatusSucceeded || e.Digest != allowed.Digest.String() || e.Size <= allowed.Size || e.Kind != consts.KindAnnotation {
+		t.Errorf("copied entry = %+v, want it succeeded with the digest [%s] and size of every blob", e, allowed.Digest)
+	}
+	if e := got["hello/denied:v1"]; e.Status != report.StatusSkipped || e.Digest != denied.Digest.String() || !strings.Contains(e.Error, "not allowed") {
+		t.Errorf("denied entry = %+v, want it skipped with the reason", e)
+	}
+	if r.Summary.Succeeded != 1 || r.Summary.Skipped != 1 || r.Summary.Bytes != got["hello/allowed:v1"].Size {
+		t.Errorf("report summary = %+v, want one succeeded and one skipped", r.Summary)
+	}
+}
+
+func TestRefFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		ref     string
+		want    bool
+	}{
+		{name: "no patterns", ref: "index.docker.io/rancher/rancher:v2.8.0", want: true},
+		{name: "include by repository", include: []string{"rancher/*"}, ref: "index.docker.io/rancher/rancher:v2.8.0", want: true},
+		{name: "include by full name", include: []string{"index.docker.io/rancher/*:v2.*"}, ref: "rancher/rancher:v2.8.0", want: true},
+		{name: "include by other registry", include: []string{"ghcr.io/*/*"}, ref: "index.docker.io/rancher/rancher:v2.8.0", want: false},
+		{name: "not included", include: []string{"rancher/*"}, ref: "hauler/file.txt:latest", want: false},
+		{name: "excluded", exclude: []string{"rancher/rancher-*"}, ref: "rancher/rancher-agent:v2.8.0", want: false},
+		{name: "exclude wins over include", include: []string{"rancher/*"}, exclude: []string{"rancher/*:*-rc*"}, ref: "rancher/rancher:v2.8.0-rc1", want: false},
+		{name: "digest reference", include: []string{"rancher/rancher@sha256:*"}, ref: "rancher/rancher@sha256:" + strings.Repeat("a", 64), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := store.NewRefFilter(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Matches(tt.ref); got != tt.want {
+				t.Errorf("Matches(%q) = %v, want %v", tt.ref, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := store.NewRefFilter([]string{"rancher/["}, nil); err == nil {
+		t.Errorf("NewRefFilter() should fail on a malformed pattern")
+	}
+}
+
+func TestLayout_CopyAll_RefFilter(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	included, err := s.AddOCI(ctx, genArtifact(t, "rancher/included:v1"), "rancher/included:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	excluded, err := s.AddOCI(ctx, genArtifact(t, "rancher/excluded:v1"), "rancher/excluded:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.AddOCI(ctx, genArtifact(t, "hello/other:v1"), "hello/other:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := store.NewRefFilter([]string{"rancher/*"}, []string{"*/excluded"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.CopyAll(ctx, dest.OCI, nil, store.WithRefFilter(f))
+	if err != nil {
+		t.Fatalf("CopyAll() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Digest != included.Digest {
+		t.Errorf("CopyAll() = %v, want only [%s]", got, included.Digest)
+	}
+	for _, d := range []digest.Digest{excluded.Digest, other.Digest} {
+		if blobExists(dest, d) {
+			t.Errorf("destination should not have [%s]", d)
+		}
+	}
+}
+
+func TestLayout_Copy_DigestFilters(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	denied, err := s.AddOCI(ctx, genArtifact(t, "hello/denied:v1"), "hello/denied:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ref string
+	if err := s.Walk(func(reference string, _ ocispec.Descriptor) error {
+		ref = reference
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	dest, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Copy(ctx, ref, dest.OCI, "", store.WithDenyDigests(denied.Digest))
+	if !errors.Is(err, store.ErrDigestNotAllowed) {
+		t.Fatalf("Copy() error = %v, want %v", err, store.ErrDigestNotAllowed)
+	}
+}
+
+// rewritingTarget resolves every reference to another digest than was pushed, as a registry rewriting manifests does
+type rewritingTarget struct {
+	target.Target
+}
+
+func (r *rewritingTarget) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	name, desc, err := r.Target.Resolve(ctx, ref)
+	desc.Digest = digest.FromString("rewritten")
+	return name, desc, err
+}
+
+func TestLayout_Copy_RequireDigestMatch(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v1"), "hello/world:v1"); err != nil {
+		t.Fatal(err)
+	}
+	var ref string
+	if err := s.Walk(func(reference string, _ ocispec.Descriptor) error {
+		ref = reference
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		rewrite bool
+		opts    []store.CopyOption
+		wantErr error
+	}{
+		{
+			name: "should copy when the destination holds the digest of the store",
+			opts: []store.CopyOption{store.WithRequireDigestMatch()},
+		},
+		{
+			name:    "should fail when the destination rewrote the manifest",
+			rewrite: true,
+			opts:    []store.CopyOption{store.WithRequireDigestMatch()},
+			wantErr: store.ErrDigestMismatch,
+		},
+		{
+			name:    "should leave a rewritten manifest be unless required to match",
+			rewrite: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, err := store.NewLayout(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var to target.Target = dest.OCI
+			if tt.rewrite {
+				to = &rewritingTarget{dest.OCI}
+			}
+
+			_, err = s.Copy(ctx, ref, to, "", tt.opts...)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Copy() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Copy() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLayout_Copy_SkipExisting(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moci := genArtifact(t, "hello/world:v1")
+	desc, err := s.AddOCI(ctx, moci, "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layers, err := moci.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := make(map[digest.Digest]bool)
+	for _, lyr := range layers {
+		d, err := lyr.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		existing[digest.Digest(d.String())] = true
+	}
+
+	var ref string
+	if err := s.Walk(func(reference string, _ ocispec.Descriptor) error {
+		ref = reference
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		opts       []store.CopyOption
+		probeErr   error
+		wantLayers bool
+		wantProbes bool
+	}{
+		{
+			name:       "should skip blobs the target already has",
+			wantLayers: false,
+			wantProbes: true,
+		},
+		{
+			name:       "should fall back to a full copy when probing fails",
+			probeErr:   errors.New("method not allowed"),
+			wantLayers: true,
+			wantProbes: true,
+		},
+		{
+			name:       "should not probe when disabled",
+			opts:       []store.CopyOption{store.WithoutSkipExisting()},
+			wantLayers: true,
+			wantProbes: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, err := store.NewLayout(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			to := &checkerTarget{OCI: dest.OCI, existing: existing, err: tt.probeErr}
+
+			if _, err := s.Copy(ctx, ref, to, "", tt.opts...); err != nil {
+				t.Fatalf("Copy() error = %v", err)
+			}
+
+			if got := to.probes > 0; got != tt.wantProbes {
+				t.Errorf("probed = %v, want %v", got, tt.wantProbes)
+			}
+			if !blobExists(dest, desc.Digest) {
+				t.Errorf("manifest [%s] was not copied", desc.Digest)
+			}
+			for d := range existing {
+				if got := blobExists(dest, d); got != tt.wantLayers {
+					t.Errorf("layer [%s] copied = %v, want %v", d, got, tt.wantLayers)
+				}
+			}
+		})
+	}
+}
+
+// checkerTarget is a local layout that claims to already hold a set of blobs
+type checkerTarget struct {
+	*content.OCI
+
+	existing map[digest.Digest]bool
+	err      error
+
+	mu     sync.Mutex
+	probes int
+}
+
+func (c *checkerTarget) Exists(_ context.Context, _ string, desc ocispec.Descriptor) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.probes++
+	if c.err != nil {
+		return false, c.err
+	}
+	return c.existing[desc.Digest], nil
+}
+
+func blobExists(l *store.Layout, d digest.Digest) bool {
+	_, err := os.Stat(filepath.Join(l.Root, "blobs", d.Algorithm().String(), d.Encoded()))
+	return err == nil
+}
+
+func TestLayout_CopyAllTo(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []digest.Digest
+	for _, ref := range []string{"hello/world:v1", "hello/there:v1"} {
+		desc, err := s.AddOCI(ctx, genArtifact(t, ref), ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, desc.Digest)
+	}
+
+	errPush := errors.New("destination unavailable")
+
+	tests := []struct {
+		name       string
+		opts       []store.CopyOption
+		broken     bool
+		wantCopied int
+		wantDescs  int
+		wantErr    bool
+	}{
+		{
+			name:       "should copy everything to every destination",
+			wantCopied: 2,
+			wantDescs:  2,
+		},
+		{
+			name:       "should carry on past a failing destination",
+			broken:     true,
+			wantCopied: 2,
+			wantDescs:  2,
+			wantErr:    true,
+		},
+		{
+			// the reference in flight still reaches the healthy destinations, nothing after it does
+			name:       "should abort on a failing destination when strict",
+			opts:       []store.CopyOption{store.WithStrictDestinations()},
+			broken:     true,
+			wantCopied: 1,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dests []store.Destination
+			var layouts []*store.Layout
+			for _, name := range []string{"prod", "dr"} {
+				l, err := store.NewLayout(t.TempDir())
+				if err != nil {
+					t.Fatal(err)
+				}
+				layouts = append(layouts, l)
+				dests = append(dests, store.Destination{Name: name, Target: l.OCI})
+			}
+			if tt.broken {
+				dests = append([]store.Destination{{Name: "mirror", Target: &brokenTarget{err: errPush}}}, dests...)
+			}
+
+			got, err := s.CopyAllTo(ctx, dests, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CopyAllTo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				var derr *store.DestinationError
+				if !errors.As(err, &derr) || derr.Name != "mirror" || !errors.Is(err, errPush) {
+					t.Fatalf("CopyAllTo() error = %v, want a DestinationError for [mirror]", err)
+				}
+			}
+
+			if len(got) != tt.wantDescs {
+				t.Errorf("CopyAllTo() returned %d descriptors, want %d", len(got), tt.wantDescs)
+			}
+			for _, l := range layouts {
+				copied := 0
+				for _, d := range want {
+					if blobExists(l, d) {
+						copied++
+					}
+				}
+				if copied != tt.wantCopied {
+					t.Errorf("destination [%s] holds %d references, want %d", l.Root, copied, tt.wantCopied)
+				}
+			}
+		})
+	}
+}
+
+// brokenTarget is a target that refuses every push
+type brokenTarget struct {
+	target.Target
+
+	err error
+}
+
+func (b *brokenTarget) Pusher(_ context.Context, _ string) (remotes.Pusher, error) {
+	return nil, b.err
+}
+
+// concurrencyTarget records the most manifests pushed to it at once
+type concurrencyTarget struct {
+	target.Target
+
+	mu     sync.Mutex
+	active int
+	max    int
+}
+
+func (c *concurrencyTarget) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	p, err := c.Target.Pusher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &concurrencyPusher{Pusher: p, target: c}, nil
+}
+
+type concurrencyPusher struct {
+	remotes.Pusher
+
+	target *concurrencyTarget
+}
+
+func (p *concurrencyPusher) Push(ctx context.Context, desc ocispec.Descriptor) (ccontent.Writer, error) {
+	if desc.MediaType == ocispec.MediaTypeImageManifest || desc.MediaType == consts.DockerManifestSchema2 {
+		p.target.mu.Lock()
+		p.target.active++
+		if p.target.active > p.target.max {
+			p.target.max = p.target.active
+		}
+		p.target.mu.Unlock()
+
+		// hold the manifest long enough for other copies in flight to overlap with it
+		time.Sleep(50 * time.Millisecond)
+
+		p.target.mu.Lock()
+		p.target.active--
+		p.target.mu.Unlock()
+	}
+	return p.Pusher.Push(ctx, desc)
+}
+
+func TestLayout_CopyAll_Concurrency(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []digest.Digest
+	for i := 0; i < 6; i++ {
+		ref := fmt.Sprintf("hello/world:v%d", i)
+		desc, err := s.AddOCI(ctx, genArtifact(t, ref), ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, desc.Digest)
+	}
+
+	tests := []struct {
+		name        string
+		concurrency int
+	}{
+		{
+			name:        "should copy one reference at a time",
+			concurrency: 1,
+		},
+		{
+			name:        "should copy references in parallel",
+			concurrency: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, err := store.NewLayout(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			ct := &concurrencyTarget{Target: dest.OCI}
+
+			got, err := s.CopyAll(ctx, ct, nil, store.WithConcurrency(tt.concurrency))
+			if err != nil {
+				t.Fatalf("CopyAll() error = %v", err)
+			}
+			if len(got) != len(want) {
+				t.Errorf("CopyAll() returned %d descriptors, want %d", len(got), len(want))
+			}
+			for _, d := range want {
+				if !blobExists(dest, d) {
+					t.Errorf("destination is missing [%s]", d)
+				}
+			}
+
+			if ct.max > tt.concurrency {
+				t.Errorf("copied %d references at once, want at most %d", ct.max, tt.concurrency)
+			}
+			if tt.concurrency > 1 && ct.max < 2 {
+				t.Errorf("copied %d references at once, want them copied in parallel", ct.max)
+			}
+		})
+	}
+}
+
+// flakyTarget fails pushing the manifest of each reference listed in failures with status, until that many attempts
+type flakyTarget struct {
+	target.Target
+
+	status int
+
+	// failures and attempts are keyed by manifest digest, since the references pushers are created with depend on the
+	// target
+	mu       sync.Mutex
+	failures map[digest.Digest]int
+	attempts map[digest.Digest]int
+}
+
+func (f *flakyTarget) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	p, err := f.Target.Pusher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &flakyPusher{Pusher: p, target: f}, nil
+}
+
+type flakyPusher struct {
+	remotes.Pusher
+
+	target *flakyTarget
+}
+
+func (p *flakyPusher) Push(ctx context.Context, desc ocispec.Descriptor) (ccontent.Writer, error) {
+	if desc.MediaType == ocispec.MediaTypeImageManifest || desc.MediaType == consts.DockerManifestSchema2 {
+		p.target.mu.Lock()
+		p.target.attempts[desc.Digest]++
+		fail := p.target.attempts[desc.Digest] <= p.target.failures[desc.Digest]
+		p.target.mu.Unlock()
+
+		if fail {
+			return nil, remoteserrors.ErrUnexpectedStatus{Status: http.StatusText(p.target.status), StatusCode: p.target.status}
+		}
+	}
+	return p.Pusher.Push(ctx, desc)
+}
+
+func TestLayout_CopyAll_Retry(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flaky, err := s.AddOCI(ctx, genArtifact(t, "hello/flaky:v1"), "hello/flaky:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stable, err := s.AddOCI(ctx, genArtifact(t, "hello/stable:v1"), "hello/stable:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flakyRef := flaky.Annotations[ocispec.AnnotationRefName]
+
+	tests := []struct {
+		name         string
+		status       int
+		failures     int
+		retries      int
+		wantAttempts int
+		wantFailed   bool
+	}{
+		{
+			name:         "should retry transient failures",
+			status:       http.StatusBadGateway,
+			failures:     2,
+			retries:      3,
+			wantAttempts: 3,
+		},
+		{
+			name:         "should report references still failing once retries are exhausted",
+			status:       http.StatusServiceUnavailable,
+			failures:     5,
+			retries:      2,
+			wantAttempts: 3,
+			wantFailed:   true,
+		},
+		{
+			name:         "should not retry permanent failures",
+			status:       http.StatusBadRequest,
+			failures:     1,
+			retries:      3,
+			wantAttempts: 1,
+			wantFailed:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, err := store.NewLayout(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			ft := &flakyTarget{
+				Target:   dest.OCI,
+				status:   tt.status,
+				failures: map[digest.Digest]int{flaky.Digest: tt.failures},
+				attempts: make(map[digest.Digest]int),
+			}
+
+			got, err := s.CopyAll(ctx, ft, nil, store.WithRetries(tt.retries), store.WithRetryDelay(time.Millisecond, time.Millisecond))
+			if tt.wantFailed {
+				var cerr *store.CopyAllError
+				if !errors.As(err, &cerr) {
+					t.Fatalf("CopyAll() error = %v, want a CopyAllError", err)
+				}
+				if len(cerr.Failures) != 1 || cerr.Failures[0].Reference != flakyRef {
+					t.Errorf("CopyAll() failures = %v, want only [%s]", cerr.Failures, flakyRef)
+				}
+			} else if err != nil {
+				t.Fatalf("CopyAll() error = %v", err)
+			}
+
+			if ft.attempts[flaky.Digest] != tt.wantAttempts {
+				t.Errorf("pushed [%s] %d times, want %d", flakyRef, ft.attempts[flaky.Digest], tt.wantAttempts)
+			}
+
+			// a failing reference never stops the others from being copied
+			if !blobExists(dest, stable.Digest) {
+				t.Errorf("destination is missing [%s]", stable.Digest)
+			}
+			if got := blobExists(dest, flaky.Digest); got == tt.wantFailed {
+				t.Errorf("destination has [%s] = %v, want %v", flaky.Digest, got, !tt.wantFailed)
+			}
+
+			wantDescs := 2
+			if tt.wantFailed {
+				wantDescs = 1
+			}
+			if len(got) != wantDescs {
+				t.Errorf("CopyAll() returned %d descriptors, want %d", len(got), wantDescs)
+			}
+		})
+	}
+}
+
+func TestLayout_AddOCI_ResumesLayers(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	img, err := random.Image(64*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lyr := layers[0]
+	ld, err := lyr.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := lyr.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	half := len(data) / 2
+
+	tests := []struct {
+		name        string
+		maxRetries  int
+		honorRange  bool
+		wantFirst   bool
+		wantRange   string
+		wantPartial int
+	}{
+		{
+			name:       "should resume a failed download straight away with a range",
+			maxRetries: 1,
+			honorRange: true,
+			wantFirst:  true,
+			wantRange:  fmt.Sprintf("bytes=%d-", half),
+		},
+		{
+			name:        "should keep a failed download and resume it on the next run",
+			honorRange:  true,
+			wantRange:   fmt.Sprintf("bytes=%d-", half),
+			wantPartial: half,
+		},
+		{
+			name:        "should start over when the registry ignores the range",
+			honorRange:  false,
+			wantRange:   fmt.Sprintf("bytes=%d-", half),
+			wantPartial: half,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer os.RemoveAll(root)
+
+			var mu sync.Mutex
+			var ranges []string
+			failed := false
+			reg := registry.New()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/blobs/"+ld.String()) {
+					reg.ServeHTTP(w, r)
+					return
+				}
+
+				mu.Lock()
+				first := !failed
+				failed = true
+				if rg := r.Header.Get("Range"); rg != "" {
+					ranges = append(ranges, rg)
+				}
+				mu.Unlock()
+
+				if first {
+					// cut the connection halfway through the layer
+					w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+					w.WriteHeader(http.StatusOK)
+					w.Write(data[:half])
+					w.(http.Flusher).Flush()
+					panic(http.ErrAbortHandler)
+				}
+				if start := r.Header.Get("Range"); start != "" && tt.honorRange {
+					w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", half, len(data)-1, len(data)))
+					w.WriteHeader(http.StatusPartialContent)
+					w.Write(data[half:])
+					return
+				}
+				w.Write(data)
+			}))
+			defer srv.Close()
+
+			ref := strings.TrimPrefix(srv.URL, "http://") + "/hauler/resume:v1"
+			tag, err := name.NewTag(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := remote.Write(tag, img); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := store.NewLayout(root, store.WithTransportOptions(content.TransportOptions{MaxRetries: tt.maxRetries}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			partial := filepath.Join(root, "blobs", ld.Algorithm, ld.Hex+".partial")
+
+			add := func() error {
+				oci, err := image.NewImage(ref)
+				if err != nil {
+					return err
+				}
+				_, err = s.AddOCI(ctx, oci, ref)
+				return err
+			}
+
+			if err := add(); (err == nil) != tt.wantFirst {
+				t.Fatalf("AddOCI() error = %v, want success %v", err, tt.wantFirst)
+			}
+			if !tt.wantFirst {
+				fi, err := os.Stat(partial)
+				if err != nil {
+					t.Fatalf("partial download not kept: %v", err)
+				}
+				if fi.Size() != int64(tt.wantPartial) {
+					t.Errorf("partial download holds [%d] bytes, want [%d]", fi.Size(), tt.wantPartial)
+				}
+				if blobExists(s, digest.Digest(ld.String())) {
+					t.Fatalf("truncated layer stored as a complete blob")
+				}
+				if err := add(); err != nil {
+					t.Fatalf("AddOCI() resuming error = %v", err)
+				}
+			}
+
+			got, err := os.ReadFile(filepath.Join(root, "blobs", ld.Algorithm, ld.Hex))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("stored layer differs from the one pushed")
+			}
+			if _, err := os.Stat(partial); !os.IsNotExist(err) {
+				t.Errorf("partial download left behind: %v", err)
+			}
+			if !reflect.DeepEqual(ranges, []string{tt.wantRange}) {
+				t.Errorf("ranges requested = %v, want %v", ranges, []string{tt.wantRange})
+			}
+		})
+	}
+}
+
+func TestLayout_AddOCI_LayerConcurrency(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	img, err := random.Image(1024, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+	}{
+		{name: "should download a single layer at a time", limit: 1},
+		{name: "should download several layers at once", limit: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer os.RemoveAll(root)
+
+			var mu sync.Mutex
+			inFlight, most := 0, 0
+			reg := registry.New()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || !strings.Contains(r.URL.Path, "/blobs/") {
+					reg.ServeHTTP(w, r)
+					return
+				}
+				mu.Lock()
+				inFlight++
+				if inFlight > most {
+					most = inFlight
+				}
+				mu.Unlock()
+
+				// hold each layer long enough for the others to pile up
+				time.Sleep(50 * time.Millisecond)
+				reg.ServeHTTP(w, r)
+
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+			}))
+			defer srv.Close()
+
+			ref := strings.TrimPrefix(srv.URL, "http://") + "/hauler/layers:v1"
+			tag, err := name.NewTag(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := remote.Write(tag, img); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := store.NewLayout(root, store.WithLayerConcurrency(tt.limit))
+			if err != nil {
+				t.Fatal(err)
+			}
+			oci, err := image.NewImage(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			most = 0
+			mu.Unlock()
+			if _, err := s.AddOCI(ctx, oci, ref); err != nil {
+				t.Fatalf("AddOCI() error = %v", err)
+			}
+
+			if most != tt.limit {
+				t.Errorf("AddOCI() downloaded at most [%d] layers at once, want [%d]", most, tt.limit)
+			}
+			layers, err := img.Layers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, lyr := range layers {
+				d, err := lyr.Digest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !blobExists(s, digest.Digest(d.String())) {
+					t.Errorf("layer [%s] not stored", d)
+				}
+			}
+		})
+	}
+}
+
+func TestLayout_CopyAll_PreservesIndex(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	rg, err := content.NewRegistry(content.RegistryOptions{PlainHTTP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	platforms := []v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		{OS: "linux", Architecture: "s390x"},
+	}
+
+	tests := []struct {
+		name      string
+		mediaType types.MediaType
+	}{
+		{
+			name:      "should push an oci index back intact",
+			mediaType: types.OCIImageIndex,
+		},
+		{
+			name:      "should push a docker manifest list back intact",
+			mediaType: types.DockerManifestList,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			var idx v1.ImageIndex = mutate.IndexMediaType(empty.Index, tt.mediaType)
+			var members []v1.Hash
+			for _, p := range platforms {
+				p := p
+				img, err := random.Image(1024, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				d, err := img.Digest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				members = append(members, d)
+				idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+					Add:        img,
+					Descriptor: v1.Descriptor{Platform: &p},
+				})
+			}
+			want, err := idx.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// stage the index the same way cosign save does
+			lp, err := layout.Write(dir, empty.Index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := lp.AppendIndex(idx, layout.WithAnnotations(map[string]string{
+				ocispec.AnnotationRefName: "hauler/multiarch:v1",
+				consts.KindAnnotationName: consts.KindAnnotationIndex,
+			})); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := store.NewLayout(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dest := host + "/" + strings.ToLower(strings.ReplaceAll(tt.name, " ", "-")) + ":v1"
+			if _, err := s.CopyAll(ctx, rg, func(string) (string, error) { return dest, nil }); err != nil {
+				t.Fatalf("CopyAll() error = %v", err)
+			}
+
+			ref, err := name.ParseReference(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pushed, err := remote.Index(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := pushed.Digest(); err != nil || got != want {
+				t.Errorf("pushed index = %s, want %s (%v)", got, want, err)
+			}
+			if got, err := pushed.MediaType(); err != nil || got != tt.mediaType {
+				t.Errorf("pushed index media type = %s, want %s (%v)", got, tt.mediaType, err)
+			}
+
+			// the relocated reference must still resolve to each platform's own image
+			for i, p := range platforms {
+				img, err := remote.Image(ref, remote.WithPlatform(p))
+				if err != nil {
+					t.Fatalf("resolving [%s]: %v", p, err)
+				}
+				if got, err := img.Digest(); err != nil || got != members[i] {
+					t.Errorf("[%s] resolved to %s, want %s (%v)", p, got, members[i], err)
+				}
+			}
+		})
+	}
+}
+
+func TestLayout_StatByDigest(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moci := genArtifact(t, "hello/world:v1")
+	manifest, err := s.AddOCI(ctx, moci, "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, moci, "hello/world:latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	layers, err := moci.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld, err := layers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lsize, err := layers[0].Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := digest.Digest(ld.String())
+
+	tests := []struct {
+		name     string
+		dgst     digest.Digest
+		wantSize int64
+		wantTags []string
+		wantErr  error
+	}{
+		{
+			name:     "should return every tag of a manifest",
+			dgst:     manifest.Digest,
+			wantSize: manifest.Size,
+			wantTags: []string{"hello/world:latest", "hello/world:v1"},
+		},
+		{
+			name:     "should report untagged blobs",
+			dgst:     layer,
+			wantSize: lsize,
+		},
+		{
+			name:    "should fail on digests not in the store",
+			dgst:    digest.FromString("missing"),
+			wantErr: store.ErrDigestNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc, tags, err := s.StatByDigest(ctx, tt.dgst)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("StatByDigest() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("StatByDigest() error = %v", err)
+			}
+
+			if desc.Digest != tt.dgst || desc.Size != tt.wantSize {
+				t.Errorf("StatByDigest() = [%s] of [%d] bytes, want [%s] of [%d] bytes", desc.Digest, desc.Size, tt.dgst, tt.wantSize)
+			}
+			if len(tags) != len(tt.wantTags) {
+				t.Fatalf("StatByDigest() tags = %v, want %v", tags, tt.wantTags)
+			}
+			for i := range tags {
+				if !strings.HasSuffix(tags[i], tt.wantTags[i]) {
+					t.Errorf("StatByDigest() tags = %v, want %v", tags, tt.wantTags)
+				}
+			}
+		})
+	}
+}
+
+func TestLayout_ExportRefs(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported := genArtifact(t, "hello/world:v1")
+	desc, err := s.AddOCI(ctx, exported, "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, genArtifact(t, "hello/there:v1"), "hello/there:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{
+		"oci-layout":    true,
+		"index.json":    true,
+		"blobs/":        true,
+		"blobs/sha256/": true,
+		path.Join("blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded()): true,
+	}
+	cdata, err := exported.RawConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want[path.Join("blobs", "sha256", digest.FromBytes(cdata).Encoded())] = true
+	layers, err := exported.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, lyr := range layers {
+		d, err := lyr.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[path.Join("blobs", d.Algorithm, d.Hex)] = true
+	}
+
+	tests := []struct {
+		name    string
+		refs    []string
+		wantErr bool
+	}{
+		{
+			name: "should export only the selected reference",
+			refs: []string{"hello/world:v1"},
+		},
+		{
+			name:    "should fail on references not in the store",
+			refs:    []string{"hello/world:v1", "hello/missing:v1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := s.ExportRefs(ctx, &buf, tt.refs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExportRefs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if buf.Len() != 0 {
+					t.Errorf("ExportRefs() wrote [%d] bytes before failing", buf.Len())
+				}
+				return
+			}
+
+			got := make(map[string]bool)
+			var idx ocispec.Index
+			tr := tar.NewReader(&buf)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[hdr.Name] = true
+
+				if hdr.Name == "index.json" {
+					if err := json.NewDecoder(tr).Decode(&idx); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ExportRefs() wrote %v, want %v", got, want)
+			}
+			if len(idx.Manifests) != 1 || idx.Manifests[0].Digest != desc.Digest {
+				t.Errorf("ExportRefs() index = %v, want only [%s]", idx.Manifests, desc.Digest)
+			}
+		})
+	}
+}
+
+func TestLayout_ExportLayout(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v1"), "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, genArtifact(t, "hello/there:v1"), "hello/there:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	notEmpty := t.TempDir()
+	if err := os.WriteFile(filepath.Join(notEmpty, "index.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		refs    []string
+		wantErr bool
+	}{
+		{
+			name: "should write only the selected reference",
+			dir:  filepath.Join(t.TempDir(), "out"),
+			refs: []string{"hello/world:v1"},
+		},
+		{
+			name:    "should fail on references not in the store",
+			dir:     filepath.Join(t.TempDir(), "out"),
+			refs:    []string{"hello/world:v1", "hello/missing:v1"},
+			wantErr: true,
+		},
+		{
+			name:    "should never write into an existing layout",
+			dir:     notEmpty,
+			refs:    []string{"hello/world:v1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ExportLayout(ctx, tt.dir, tt.refs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExportLayout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// the layout has to be readable by tools other than hauler
+			lp, err := layout.FromPath(tt.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx, err := lp.ImageIndex()
+			if err != nil {
+				t.Fatal(err)
+			}
+			im, err := idx.IndexManifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(im.Manifests) != 1 || im.Manifests[0].Digest.String() != desc.Digest.String() {
+				t.Fatalf("ExportLayout() index = %v, want only [%s]", im.Manifests, desc.Digest)
+			}
+			img, err := lp.Image(im.Manifests[0].Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validate.Image(img); err != nil {
+				t.Errorf("ExportLayout() wrote an invalid image: %v", err)
+			}
+		})
+	}
+}
+
+func TestLayout_ExportDockerArchive(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	// stage a multi-platform index the same way cosign save does
+	var idx v1.ImageIndex = empty.Index
+	members := make(map[string]v1.Image)
+	for _, p := range []v1.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64", Variant: "v8"}} {
+		p := p
+		img, err := random.Image(1024, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		members[p.Architecture] = img
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &p}})
+	}
+	lp, err := layout.Write(root, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lp.AppendIndex(idx, layout.WithAnnotations(map[string]string{
+		ocispec.AnnotationRefName: "hauler/multiarch:v1",
+		consts.KindAnnotationName: consts.KindAnnotationIndex,
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v1"), "hello/world:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("notes"), "text/plain"), "hauler/notes.txt:latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		refs     []string
+		platform ocispec.Platform
+		want     map[string]v1.Image
+		wantErr  bool
+	}{
+		{
+			name:     "should write the image of the platform of an index",
+			refs:     []string{"hauler/multiarch:v1", "hello/world:v1"},
+			platform: ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			want:     map[string]v1.Image{"docker.io/hauler/multiarch:v1": members["arm64"]},
+		},
+		{
+			name:     "should fail on a platform the index doesn't hold",
+			refs:     []string{"hauler/multiarch:v1"},
+			platform: ocispec.Platform{OS: "linux", Architecture: "s390x"},
+			wantErr:  true,
+		},
+		{
+			name:     "should fail on artifacts that aren't images",
+			refs:     []string{"hauler/notes.txt:latest"},
+			platform: ocispec.Platform{OS: "linux", Architecture: "amd64"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "image.tar")
+			f, err := os.Create(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.ExportDockerArchive(ctx, f, tt.refs, tt.platform)
+			f.Close()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExportDockerArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			for ref, want := range tt.want {
+				tag, err := name.NewTag(ref)
+				if err != nil {
+					t.Fatal(err)
+				}
+				img, err := tarball.ImageFromPath(p, &tag)
+				if err != nil {
+					t.Fatalf("reading [%s] from the archive: %v", ref, err)
+				}
+				if err := validate.Image(img); err != nil {
+					t.Errorf("ExportDockerArchive() wrote an invalid image: %v", err)
+				}
+				got, err := img.ConfigName()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if wantConfig, err := want.ConfigName(); err != nil || got != wantConfig {
+					t.Errorf("[%s] config = %s, want %s (%v)", ref, got, wantConfig, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLayout_Rootfs(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	layer := func(hdrs ...*tar.Header) v1.Layer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range hdrs {
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Size > 0 {
+				if _, err := tw.Write(bytes.Repeat([]byte("x"), int(hdr.Size))); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(buf.Bytes())), nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+
+	img, err := mutate.AppendLayers(empty.Image,
+		layer(
+			&tar.Header{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0755},
+			&tar.Header{Typeflag: tar.TypeReg, Name: "etc/kept", Mode: 0644, Size: 4},
+			&tar.Header{Typeflag: tar.TypeReg, Name: "etc/removed", Mode: 0644, Size: 4},
+			&tar.Header{Typeflag: tar.TypeChar, Name: "dev/null", Mode: 0666, Devmajor: 1, Devminor: 3},
+		),
+		layer(
+			&tar.Header{Typeflag: tar.TypeReg, Name: "etc/.wh.removed", Mode: 0644},
+			&tar.Header{Typeflag: tar.TypeSymlink, Name: "bin/sh", Linkname: "/bin/busybox", Mode: 0777},
+			&tar.Header{Typeflag: tar.TypeSymlink, Name: "etc/link", Linkname: "/etc/kept", Mode: 0777},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lp, err := layout.Write(root, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lp.AppendImage(img, layout.WithAnnotations(map[string]string{
+		ocispec.AnnotationRefName: "hauler/rootfs:v1",
+		consts.KindAnnotationName: consts.KindAnnotation,
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("notes"), "text/plain"), "hauler/notes.txt:latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ref     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "should apply whiteouts, drop devices, and make absolute symlinks relative",
+			ref:  "hauler/rootfs:v1",
+			want: map[string]string{
+				"etc":      "",
+				"etc/kept": "",
+				"bin/sh":   "busybox",
+				"etc/link": "kept",
+			},
+		},
+		{
+			name:    "should fail on artifacts that aren't images",
+			ref:     "hauler/notes.txt:latest",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := s.Rootfs(ctx, tt.ref, ocispec.Platform{OS: "linux", Architecture: "amd64"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Rootfs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer rc.Close()
+
+			got := make(map[string]string)
+			tr := tar.NewReader(rc)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[hdr.Name] = hdr.Linkname
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rootfs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayout_WalkReferences(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{}
+	for _, ref := range []string{"hello/a:v1", "hello/b:v1", "hello/c:v1"} {
+		if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+			t.Fatal(err)
+		}
+		want[ref] = true
+	}
+
+	got := map[string]bool{}
+	if err := s.WalkReferences(ctx, func(ref string, _ ocispec.Descriptor) error {
+		got[ref] = true
+		return nil
+	}); err != nil {
+		t.Fatalf("WalkReferences() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WalkReferences() visited %v, want %v", got, want)
+	}
+
+	visited := 0
+	if err := s.WalkReferences(ctx, func(string, ocispec.Descriptor) error {
+		visited++
+		return store.ErrStopWalk
+	}); err != nil || visited != 1 {
+		t.Errorf("WalkReferences() stopped after %d with error %v, want 1 and no error", visited, err)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := s.WalkReferences(cctx, func(string, ocispec.Descriptor) error {
+		return nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Errorf("WalkReferences() error = %v, want %v", err, context.Canceled)
+	}
+
+	tests := []struct {
+		name   string
+		offset int
+		limit  int
+		want   int
+	}{
+		{name: "should return every reference without a limit", want: 3},
+		{name: "should return a page", offset: 1, limit: 1, want: 1},
+		{name: "should return a short last page", offset: 2, limit: 2, want: 1},
+		{name: "should return nothing past the end", offset: 3, limit: 2, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.References(ctx, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatalf("References() error = %v", err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("References() returned %d, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestLayout_Stat(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v1"), "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chart, err := s.AddOCI(ctx, genArtifact(t, "hauler/chart:latest"), "hauler/chart:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		reference string
+		want      digest.Digest
+		wantErr   error
+	}{
+		{
+			name:      "should resolve a tag",
+			reference: "hello/world:v1",
+			want:      image.Digest,
+		},
+		{
+			name:      "should resolve a fully qualified tag",
+			reference: "index.docker.io/hello/world:v1",
+			want:      image.Digest,
+		},
+		{
+			name:      "should resolve a digest reference",
+			reference: "hello/world@" + image.Digest.String(),
+			want:      image.Digest,
+		},
+		{
+			name:      "should resolve a bare digest",
+			reference: chart.Digest.String(),
+			want:      chart.Digest,
+		},
+		{
+			name:      "should apply the hauler namespace and default tag",
+			reference: "chart",
+			want:      chart.Digest,
+		},
+		{
+			name:      "should not match a digest under another repository",
+			reference: "hello/other@" + image.Digest.String(),
+			wantErr:   store.ErrReferenceNotFound,
+		},
+		{
+			name:      "should fail on references not in the store",
+			reference: "hello/world:v2",
+			wantErr:   store.ErrReferenceNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Stat(ctx, tt.reference)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Stat() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Stat() error = %v", err)
+			}
+			if got.Digest != tt.want {
+				t.Errorf("Stat() = [%s], want [%s]", got.Digest, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayout_Annotate(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v1"), "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Annotate(ctx, "hello/world:v1", map[string]string{"hauler.dev/verified": "true"}); err != nil {
+		t.Fatalf("Annotate() error = %v", err)
+	}
+	if _, err := s.Annotate(ctx, "hello/world:v2", map[string]string{"hauler.dev/verified": "true"}); !errors.Is(err, store.ErrReferenceNotFound) {
+		t.Fatalf("Annotate() error = %v, want %v", err, store.ErrReferenceNotFound)
+	}
+
+	// reopen the store, so the annotations are read back from its index
+	s, err = store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []ocispec.Descriptor
+	if err := s.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		got = append(got, desc)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("index holds %d entries, want 1", len(got))
+	}
+	if got[0].Digest != image.Digest {
+		t.Errorf("annotated [%s], want [%s]", got[0].Digest, image.Digest)
+	}
+	if got[0].Annotations["hauler.dev/verified"] != "true" {
+		t.Errorf("annotations = %v, want them to hold the new annotation", got[0].Annotations)
+	}
+	if got[0].Annotations[ocispec.AnnotationRefName] != image.Annotations[ocispec.AnnotationRefName] {
+		t.Errorf("annotations = %v, want the existing ones kept", got[0].Annotations)
+	}
+}
+
+func TestLayout_Rename(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image, err := s.AddOCI(ctx, genArtifact(t, "mirror.example.com/hello/world:v1"), "mirror.example.com/hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cosign stores the signatures of an image under its name, told apart by their kind
+	sig := image
+	sig.Annotations = map[string]string{
+		ocispec.AnnotationRefName: image.Annotations[ocispec.AnnotationRefName],
+		consts.KindAnnotationName: consts.KindAnnotationSigs,
+	}
+	if err := s.OCI.AddIndex(sig); err != nil {
+		t.Fatal(err)
+	}
+
+	renamed, err := s.Rename(ctx, "mirror.example.com/hello/world:v1", "docker.io/hello/world:v1")
+	if err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if len(renamed) != 2 {
+		t.Fatalf("Rename() renamed %d entries, want 2", len(renamed))
+	}
+
+	var got []string
+	if err := s.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		got = append(got, desc.Annotations[ocispec.AnnotationRefName]+" "+desc.Annotations[consts.KindAnnotationName])
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := []string{
+		"index.docker.io/hello/world:v1 " + image.Annotations[consts.KindAnnotationName],
+		"index.docker.io/hello/world:v1 " + consts.KindAnnotationSigs,
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("index holds %v, want %v", got, want)
+	}
+
+	if _, err := s.Rename(ctx, "mirror.example.com/hello/world:v1", "docker.io/hello/world:v1"); !errors.Is(err, store.ErrReferenceNotFound) {
+		t.Errorf("Rename() error = %v, want %v", err, store.ErrReferenceNotFound)
+	}
+}
+
+func TestLayout_Inspect(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	// stage a multi-platform index the same way cosign save does
+	var idx v1.ImageIndex = empty.Index
+	for _, p := range []v1.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64"}} {
+		p := p
+		img, err := random.Image(1024, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err = mutate.ConfigFile(img, &v1.ConfigFile{OS: p.OS, Architecture: p.Architecture})
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &p}})
+	}
+	lp, err := layout.Write(root, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lp.AppendIndex(idx, layout.WithAnnotations(map[string]string{
+		ocispec.AnnotationRefName: "hauler/multiarch:v1",
+		consts.KindAnnotationName: consts.KindAnnotationIndex,
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v1"), "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cosign stores the signatures of an image under its name, told apart by their kind
+	sig := image
+	sig.Annotations = map[string]string{
+		ocispec.AnnotationRefName: image.Annotations[ocispec.AnnotationRefName],
+		consts.KindAnnotationName: consts.KindAnnotationSigs,
+	}
+	if err := s.OCI.AddIndex(sig); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		ref           string
+		wantIndex     bool
+		wantPlatforms []string
+		wantLayers    int
+		wantAttached  int
+		wantErr       error
+	}{
+		{
+			name:          "should inspect every manifest of an index",
+			ref:           "hauler/multiarch:v1",
+			wantIndex:     true,
+			wantPlatforms: []string{"linux/amd64", "linux/arm64"},
+			wantLayers:    2,
+		},
+		{
+			name:         "should inspect an image along with its signatures",
+			ref:          "hello/world:v1",
+			wantLayers:   3,
+			wantAttached: 1,
+		},
+		{
+			name:    "should fail on references not in the store",
+			ref:     "hello/missing:v1",
+			wantErr: store.ErrReferenceNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := s.Inspect(ctx, tt.ref)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Inspect() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Inspect() error = %v", err)
+			}
+
+			if (in.Index != nil) != tt.wantIndex {
+				t.Errorf("Inspect() index = %v, want an index %v", in.Index, tt.wantIndex)
+			}
+			var platforms []string
+			for _, m := range in.Manifests {
+				if m.Config == nil {
+					t.Fatalf("Inspect() of [%s] has no image config", m.Descriptor.Digest)
+				}
+				if len(m.Manifest.Layers) != tt.wantLayers {
+					t.Errorf("Inspect() of [%s] has %d layers, want %d", m.Descriptor.Digest, len(m.Manifest.Layers), tt.wantLayers)
+				}
+				if m.Descriptor.Platform != nil {
+					platforms = append(platforms, m.Descriptor.Platform.OS+"/"+m.Descriptor.Platform.Architecture)
+				}
+			}
+			if !reflect.DeepEqual(platforms, tt.wantPlatforms) {
+				t.Errorf("Inspect() platforms = %v, want %v", platforms, tt.wantPlatforms)
+			}
+			if len(in.Attached) != tt.wantAttached {
+				t.Errorf("Inspect() attached = %v, want %d", in.Attached, tt.wantAttached)
+			}
+		})
+	}
+}
+
+func TestLayout_AddReferrers(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	src := httptest.NewServer(registry.New(registry.WithReferrersSupport(true)))
+	defer src.Close()
+	dst := httptest.NewServer(registry.New(registry.WithReferrersSupport(true)))
+	defer dst.Close()
+
+	ref, err := name.ParseReference(strings.TrimPrefix(src.URL, "http://") + "/hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	// attach an sbom to the image and a signature to the sbom, the way referrers api tools do
+	refer := func(subject partial.Describable, artifactType types.MediaType) v1.Image {
+		r, err := random.Image(256, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		desc, err := partial.Descriptor(subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = mutate.ConfigMediaType(mutate.MediaType(r, types.OCIManifestSchema1), artifactType)
+		r = mutate.Subject(r, *desc).(v1.Image)
+		d, err := r.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(ref.Context().Digest(d.String()), r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	sbomImg := refer(img, "application/spdx+json")
+	sbom, err := sbomImg.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := refer(sbomImg, "application/vnd.dev.sigstore.bundle.v0.3+json").Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := s.AddOCI(ctx, &mockArtifact{img}, ref.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := s.AddReferrers(ctx, ref.Name())
+	if err != nil {
+		t.Fatalf("AddReferrers() error = %v", err)
+	}
+	if len(added) != 2 {
+		t.Fatalf("AddReferrers() added %d referrers, want 2", len(added))
+	}
+
+	got, err := s.Referrers(ctx, desc.Digest)
+	if err != nil {
+		t.Fatalf("Referrers() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Digest.String() != sbom.String() || got[0].ArtifactType != "application/spdx+json" {
+		t.Errorf("Referrers() = %v, want the sbom [%s]", got, sbom)
+	}
+	if got, err := s.Stat(ctx, ref.Name()); err != nil || got.Digest != desc.Digest {
+		t.Errorf("Stat() = [%s], want the image [%s] (%v)", got.Digest, desc.Digest, err)
+	}
+
+	rg, err := content.NewRegistry(content.RegistryOptions{PlainHTTP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := name.ParseReference(strings.TrimPrefix(dst.URL, "http://") + "/mirror/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CopyAll(ctx, rg, func(string) (string, error) { return dest.Name(), nil }); err != nil {
+		t.Fatalf("CopyAll() error = %v", err)
+	}
+
+	// the tag must still be the image's, with both referrers discoverable from it at the destination
+	pushed, err := remote.Head(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushed.Digest.String() != desc.Digest.String() {
+		t.Errorf("pushed tag = [%s], want the image [%s]", pushed.Digest, desc.Digest)
+	}
+	for subject, want := range map[string]v1.Hash{desc.Digest.String(): sbom, sbom.String(): sig} {
+		idx, err := remote.Referrers(dest.Context().Digest(subject))
+		if err != nil {
+			t.Fatal(err)
+		}
+		im, err := idx.IndexManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(im.Manifests) != 1 || im.Manifests[0].Digest != want {
+			t.Errorf("referrers of [%s] at the destination = %v, want [%s]", subject, im.Manifests, want)
+		}
+	}
+}
+
+func TestLayout_Copy_TokenExpiry(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := s.AddOCI(ctx, genArtifact(t, "hauler/expiry:v1"), "hauler/expiry:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ref string
+	if err := s.Walk(func(reference string, _ ocispec.Descriptor) error {
+		ref = reference
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// every token expires after a handful of requests, far fewer than a copy needs
+	const tokenUses = 3
+
+	var (
+		mu     sync.Mutex
+		issued int
+		uses   = make(map[string]int)
+	)
+	reg := registry.New()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			mu.Lock()
+			issued++
+			tok := fmt.Sprintf("token-%d", issued)
+			uses[tok] = 0
+			mu.Unlock()
+
+			json.NewEncoder(w).Encode(map[string]interface{}{"token": tok, "expires_in": 300})
+			return
+		}
+
+		tok := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		n, known := uses[tok]
+		valid := known && n < tokenUses
+		if valid {
+			uses[tok]++
+		}
+		mu.Unlock()
+
+		if !valid {
+			challenge := fmt.Sprintf(`Bearer realm="%s/token",service="hauler",scope="repository:hauler/expiry:pull,push"`, srv.URL)
+			if known {
+				challenge += `,error="invalid_token"`
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	to, err := content.NewRegistry(content.RegistryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	toRef := strings.TrimPrefix(srv.URL, "http://") + "/hauler/expiry:v1"
+
+	got, err := s.Copy(ctx, ref, to, toRef)
+	if err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if got.Digest != desc.Digest {
+		t.Errorf("Copy() = [%s], want [%s]", got.Digest, desc.Digest)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if issued < 2 {
+		t.Errorf("issued [%d] tokens, want the expired token to have been refreshed", issued)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	annotations := map[string]string{"env": "staging", "team": "edge"}
+
+	tests := []struct {
+		name     string
+		selector string
+		want     bool
+		wantErr  bool
+	}{
+		{name: "should match everything when empty", selector: "", want: true},
+		{name: "should match an exact value", selector: "env=staging", want: true},
+		{name: "should not match a different value", selector: "env=prod", want: false},
+		{name: "should match a present key", selector: "team", want: true},
+		{name: "should not match a missing key", selector: "owner", want: false},
+		{name: "should require every requirement", selector: "env=staging, owner", want: false},
+		{name: "should match an explicitly empty value only when empty", selector: "team=", want: false},
+		{name: "should fail on a missing key", selector: "=staging", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel, err := store.ParseSelector(tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSelector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := sel.Matches(annotations); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayout_WalkSelected(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := map[string]string{
+		"hello/staging:v1": "staging",
+		"hello/prod:v1":    "prod",
+		"hello/none:v1":    "",
+	}
+	for ref, env := range labels {
+		desc, err := s.AddOCI(ctx, genArtifact(t, ref), ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env == "" {
+			continue
+		}
+		desc.Annotations["env"] = env
+		if err := s.OCI.AddIndex(desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		selector string
+		want     []string
+	}{
+		{name: "should walk an exact match", selector: "env=staging", want: []string{"hello/staging:v1"}},
+		{name: "should walk everything labeled", selector: "env", want: []string{"hello/prod:v1", "hello/staging:v1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel, err := store.ParseSelector(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]bool)
+			if err := s.WalkSelected(sel, func(_ string, desc ocispec.Descriptor) error {
+				got[desc.Annotations[ocispec.AnnotationRefName]] = true
+				return nil
+			}); err != nil {
+				t.Fatalf("WalkSelected() error = %v", err)
+			}
+
+			want := make(map[string]bool)
+			for _, ref := range tt.want {
+				want[ref] = true
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("WalkSelected() visited %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLayout_AddOCI_ArtifactType(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ref  string
+		opts []memory.Option
+		want string
+	}{
+		{
+			name: "should record and identify the artifact type",
+			ref:  "hello/typed:v1",
+			opts: []memory.Option{memory.WithArtifactType("application/vnd.example.toolchain")},
+			want: "application/vnd.example.toolchain",
+		},
+		{
+			name: "should fall back to the config media type",
+			ref:  "hello/untyped:v1",
+			want: consts.MemoryConfigMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := memory.NewMemory([]byte(tt.ref), "application/octet-stream", tt.opts...)
+			desc, err := s.AddOCI(ctx, m, tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(root, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var manifest ocispec.Manifest
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				t.Fatal(err)
+			}
+
+			wantType := ""
+			if len(tt.opts) > 0 {
+				wantType = tt.want
+			}
+			if manifest.ArtifactType != wantType || desc.ArtifactType != wantType {
+				t.Errorf("artifactType = [%s] in the manifest and [%s] in the index, want [%s]", manifest.ArtifactType, desc.ArtifactType, wantType)
+			}
+			if got := s.Identify(ctx, desc); got != tt.want {
+				t.Errorf("Identify() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayout_AddOCI_ManifestLast(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oci := brokenArtifact{genArtifact(t, "hello/broken:v1")}
+	if _, err := s.AddOCI(ctx, oci, "hello/broken:v1"); !errors.Is(err, errBrokenArtifact) {
+		t.Fatalf("AddOCI() error = %v, want %v", err, errBrokenArtifact)
+	}
+
+	m, err := oci.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdata, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blobExists(s, digest.FromBytes(mdata)) {
+		t.Errorf("AddOCI() wrote the manifest of an artifact whose layers failed")
+	}
+	if _, err := s.Stat(ctx, "hello/broken:v1"); !errors.Is(err, store.ErrReferenceNotFound) {
+		t.Errorf("Stat() error = %v, want %v", err, store.ErrReferenceNotFound)
+	}
+}
+
+func TestLayout_AddOCI_ConcurrentCache(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	cacheDir := filepath.Join(root, "cache")
+	c := layer.NewFilesystemCache(cacheDir)
+	moci := genArtifact(t, "hello/cached:v1")
+
+	const workers = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		// separate stores share the one cache, so only the cache sees concurrent writes of the same blobs
+		s, err := store.NewLayout(filepath.Join(root, fmt.Sprintf("store-%d", i)), store.WithCache(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.AddOCI(ctx, moci, "hello/cached:v1"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("AddOCI() error = %v", err)
+	}
+
+	layers, err := moci.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range layers {
+		d, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(cacheDir, d.Algorithm, d.Hex))
+		if err != nil {
+			t.Fatalf("layer [%s] was not cached: %v", d, err)
+		}
+		if got := digest.FromBytes(data); got.String() != d.String() {
+			t.Errorf("cached layer [%s] is corrupt, digest = %s", d, got)
+		}
+	}
+
+	if err := filepath.WalkDir(cacheDir, func(p string, _ os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(p, ".tmp") {
+			t.Errorf("temporary cache file [%s] was left behind", p)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLayout_RemoveArtifact(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a and b differ only by their manifest annotations, so they share a layer, and all three share a config
+	a := memory.NewMemory([]byte("shared"), "application/octet-stream")
+	b := memory.NewMemory([]byte("shared"), "application/octet-stream", memory.WithAnnotations(map[string]string{"variant": "b"}))
+	c := memory.NewMemory([]byte("unique"), "application/octet-stream")
+
+	descs := make(map[string]ocispec.Descriptor)
+	for ref, oci := range map[string]artifacts.OCI{"hello/a:v1": a, "hello/b:v1": b, "hello/c:v1": c} {
+		desc, err := s.AddOCI(ctx, oci, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		descs[ref] = desc
+	}
+
+	manifestOf := func(oci artifacts.OCI) *v1.Manifest {
+		m, err := oci.Manifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	shared := digest.Digest(manifestOf(a).Layers[0].Digest.String())
+	config := digest.Digest(manifestOf(a).Config.Digest.String())
+
+	tests := []struct {
+		name       string
+		ref        string
+		wantErr    error
+		wantGone   []digest.Digest
+		wantKept   []digest.Digest
+		wantLookup map[string]bool
+	}{
+		{
+			name:       "should keep blobs shared with other references",
+			ref:        "hello/a:v1",
+			wantGone:   []digest.Digest{descs["hello/a:v1"].Digest},
+			wantKept:   []digest.Digest{shared, config, descs["hello/b:v1"].Digest},
+			wantLookup: map[string]bool{"hello/a:v1": false, "hello/b:v1": true, "hello/c:v1": true},
+		},
+		{
+			name:       "should delete blobs once nothing references them",
+			ref:        "hello/b:v1",
+			wantGone:   []digest.Digest{descs["hello/b:v1"].Digest, shared},
+			wantKept:   []digest.Digest{config, descs["hello/c:v1"].Digest},
+			wantLookup: map[string]bool{"hello/b:v1": false, "hello/c:v1": true},
+		},
+		{
+			name:    "should error on a missing reference",
+			ref:     "hello/missing:v1",
+			wantErr: store.ErrReferenceNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed, err := s.RemoveArtifact(ctx, tt.ref)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RemoveArtifact() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if len(removed) != 1 {
+				t.Errorf("RemoveArtifact() removed %d entries, want 1", len(removed))
+			}
+
+			for _, d := range tt.wantGone {
+				if blobExists(s, d) {
+					t.Errorf("blob [%s] should have been deleted", d)
+				}
+			}
+			for _, d := range tt.wantKept {
+				if !blobExists(s, d) {
+					t.Errorf("blob [%s] should have been kept", d)
+				}
+			}
+			for ref, want := range tt.wantLookup {
+				_, err := s.Stat(ctx, ref)
+				if got := err == nil; got != want {
+					t.Errorf("Stat(%s) found = %v, want %v", ref, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLayout_History(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := s.History()
+	if err != nil || len(history) != 0 {
+		t.Fatalf("History() of a new store = %v, %v, want no entries", history, err)
+	}
+
+	added, err := s.AddOCI(ctx, genArtifact(t, "hello/a:v1"), "hello/a:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, genArtifact(t, "hello/b:v1"), "hello/b:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RemoveArtifact(ctx, "hello/a:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the log outlives the flush, and is appended to by every layout of the store
+	reopened, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err = reopened.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		action    store.AuditAction
+		reference string
+	}{
+		{store.AuditAdd, "hello/a:v1"},
+		{store.AuditAdd, "hello/b:v1"},
+		{store.AuditRemove, "hello/a:v1"},
+		{store.AuditFlush, ""},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("History() = %+v, want %d entries", history, len(want))
+	}
+	for i, w := range want {
+		e := history[i]
+		if e.Action != w.action || e.Reference != w.reference {
+			t.Errorf("History()[%d] = %s [%s], want %s [%s]", i, e.Action, e.Reference, w.action, w.reference)
+		}
+		if e.User == "" || e.Time.IsZero() {
+			t.Errorf("History()[%d] = %+v, want who made it and when", i, e)
+		}
+	}
+	if history[0].Digest != added.Digest || history[2].Digest != added.Digest {
+		t.Errorf("History() digests = [%s], [%s], want [%s]", history[0].Digest, history[2].Digest, added.Digest)
+	}
+}
+
+func TestLayout_GC(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amd64, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v1-amd64"), "hello/world:v1-amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateIndex(ctx, "hello/world:v1", []ocispec.Descriptor{amd64}, []ocispec.Platform{{OS: "linux", Architecture: "amd64"}}); err != nil {
+		t.Fatal(err)
+	}
+	// only the index now references the manifest, which must still be kept
+	if err := s.OCI.RemoveIndex(amd64); err != nil {
+		t.Fatal(err)
+	}
+
+	orphan := []byte("orphaned blob")
+	orphanDigest := digest.FromBytes(orphan)
+	blobs := filepath.Join(root, "blobs", "sha256")
+	if err := os.WriteFile(filepath.Join(blobs, orphanDigest.Encoded()), orphan, 0644); err != nil {
+		t.Fatal(err)
+	}
+	notes := filepath.Join(blobs, "notes.txt")
+	if err := os.WriteFile(notes, []byte("not a blob"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		opts       []store.GCOption
+		wantOrphan bool
+	}{
+		{
+			name:       "should only report on a dry run",
+			opts:       []store.GCOption{store.WithDryRun()},
+			wantOrphan: true,
+		},
+		{
+			name:       "should delete unreferenced blobs",
+			wantOrphan: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := s.GC(ctx, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(res.Blobs, []digest.Digest{orphanDigest}) || res.Bytes != int64(len(orphan)) {
+				t.Errorf("GC() = %v (%d bytes), want [%s] (%d bytes)", res.Blobs, res.Bytes, orphanDigest, len(orphan))
+			}
+			if got := blobExists(s, orphanDigest); got != tt.wantOrphan {
+				t.Errorf("orphan exists = %v, want %v", got, tt.wantOrphan)
+			}
+			if _, err := os.Stat(notes); err != nil {
+				t.Errorf("non-blob file should be left alone: %v", err)
+			}
+
+			corrupt, err := s.Verify(ctx)
+			if err != nil || len(corrupt) > 0 {
+				t.Errorf("reachable content should be intact, Verify() = %v, %v", corrupt, err)
+			}
+			if !blobExists(s, amd64.Digest) {
+				t.Errorf("manifest [%s] referenced by the index was deleted", amd64.Digest)
+			}
+		})
+	}
+}
+
+func TestLayout_Save(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"hello/world:v1", "hello/world:v2", "hello/other:v1"} {
+		if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []store.Compression{store.CompressionZstd, store.CompressionGzip, store.CompressionNone} {
+		t.Run(string(c), func(t *testing.T) {
+			var first, second bytes.Buffer
+			if err := s.Save(ctx, &first, store.WithCompression(c)); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Save(ctx, &second, store.WithCompression(c)); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(first.Bytes(), second.Bytes()) {
+				t.Errorf("saving the same store twice produced different archives")
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := s.Save(ctx, &buf, store.WithCompression(store.CompressionNone)); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(&buf)
+	var names []string
+	var header store.ArchiveHeader
+	blobs := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		if hdr.Name == store.ArchiveHeaderFile {
+			if err := json.NewDecoder(tr).Decode(&header); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if hdr.Typeflag == tar.TypeReg && strings.HasPrefix(hdr.Name, "blobs/") {
+			blobs++
+		}
+	}
+
+	if len(names) < 3 || names[0] != store.ArchiveHeaderFile || names[1] != ocispec.ImageLayoutFile || names[2] != "index.json" {
+		t.Errorf("archive should start with the header, layout, and index, got %v", names)
+	}
+	want := store.ArchiveHeader{Version: store.ArchiveVersion, References: 3, Blobs: blobs}
+	if header != want {
+		t.Errorf("header = %+v, want %+v", header, want)
+	}
+}
+
+func TestHaulManifest_VerifyArchive(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v1"), "hello/world:v1"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := s.Save(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	m, err := s.Manifest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Archive = &store.ArchiveFile{Name: "haul.tar.zst", Size: int64(len(archive)), Digest: digest.FromBytes(archive)}
+
+	// the manifest has to survive being written and read back, as it is beside an archive
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = store.ReadHaulManifest(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := append([]byte{}, archive...)
+	tampered[len(tampered)/2] ^= 0xff
+
+	tests := []struct {
+		name     string
+		manifest store.HaulManifest
+		archive  []byte
+		wantErr  bool
+	}{
+		{name: "should verify the archive it records", manifest: m, archive: archive},
+		{name: "should fail on a tampered archive", manifest: m, archive: tampered, wantErr: true},
+		{name: "should fail on a truncated archive", manifest: m, archive: archive[:len(archive)-1], wantErr: true},
+		{name: "should fail on a manifest without its archive", manifest: store.HaulManifest{Version: store.HaulManifestVersion}, archive: archive, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.manifest.VerifyArchive(bytes.NewReader(tt.archive))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLayout_Save_Delta(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	src, err := store.NewLayout(filepath.Join(root, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"hello/world:v1", "hello/other:v1"} {
+		if _, err := src.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var full bytes.Buffer
+	if err := src.Save(ctx, &full); err != nil {
+		t.Fatal(err)
+	}
+	base, err := src.Manifest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the manifest round trips through its json form
+	data, err := json.Marshal(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base, err = store.ReadHaulManifest(bytes.NewReader(data)); err != nil {
+		t.Fatalf("ReadHaulManifest() error = %v", err)
+	}
+
+	added, err := src.AddOCI(ctx, genArtifact(t, "hello/added:v1"), "hello/added:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var delta bytes.Buffer
+	if err := src.Save(ctx, &delta, store.WithDeltaFrom(base)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if delta.Len() >= full.Len() {
+		t.Errorf("delta archive is %d bytes, want less than the %d bytes of the full archive", delta.Len(), full.Len())
+	}
+
+	bare, err := store.NewLayout(filepath.Join(root, "bare"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bare.Load(ctx, bytes.NewReader(delta.Bytes())); !errors.Is(err, store.ErrIncompleteDelta) {
+		t.Fatalf("Load() of a delta into an empty store error = %v, want %v", err, store.ErrIncompleteDelta)
+	}
+
+	dst, err := store.NewLayout(filepath.Join(root, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.Load(ctx, bytes.NewReader(full.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := dst.Load(ctx, bytes.NewReader(delta.Bytes()))
+	if err != nil {
+		t.Fatalf("Load() of a delta error = %v", err)
+	}
+	if len(loaded) != 3 {
+		t.Errorf("Load() of a delta returned %d references, want 3", len(loaded))
+	}
+
+	if d, err := dst.Diff(ctx, src); err != nil || !d.IsEmpty() {
+		t.Errorf("store after applying the delta differs from its source: %v, %v", d, err)
+	}
+	if !blobExists(dst, added.Digest) {
+		t.Errorf("store after applying the delta is missing [%s]", added.Digest)
+	}
+	if corrupt, err := dst.Verify(ctx); err != nil || len(corrupt) > 0 {
+		t.Errorf("Verify() after applying the delta = %v, %v", corrupt, err)
+	}
+}
+
+func TestLayout_SaveSize(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(filepath.Join(root, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"hello/world:v1", "hello/other:v1"} {
+		if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	full, err := s.SaveSize(ctx)
+	if err != nil {
+		t.Fatalf("SaveSize() error = %v", err)
+	}
+	var archive bytes.Buffer
+	if err := s.Save(ctx, &archive, store.WithCompression(store.CompressionNone)); err != nil {
+		t.Fatal(err)
+	}
+	if full <= 0 || full > int64(archive.Len()) {
+		t.Errorf("SaveSize() = %d, want the blobs of the %d bytes uncompressed archive", full, archive.Len())
+	}
+
+	base, err := s.Manifest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.SaveSize(ctx, store.WithDeltaFrom(base)); err != nil || got != 0 {
+		t.Errorf("SaveSize() of a delta from the store itself = %d, %v, want 0", got, err)
+	}
+
+	if _, err := s.AddOCI(ctx, genArtifact(t, "hello/added:v1"), "hello/added:v1"); err != nil {
+		t.Fatal(err)
+	}
+	delta, err := s.SaveSize(ctx, store.WithDeltaFrom(base))
+	if err != nil {
+		t.Fatalf("SaveSize() error = %v", err)
+	}
+	if delta <= 0 || delta >= full {
+		t.Errorf("SaveSize() of a delta = %d, want less than the %d of the full archive", delta, full)
+	}
+}
+
+func TestLayout_Load(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	src, err := store.NewLayout(filepath.Join(root, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := []string{"hello/world:v1", "hello/other:v1"}
+	var layer digest.Digest
+	for _, ref := range refs {
+		desc, err := src.AddOCI(ctx, genArtifact(t, ref), ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if layer == "" {
+			var m ocispec.Manifest
+			data, err := os.ReadFile(filepath.Join(src.Root, "blobs", "sha256", desc.Digest.Encoded()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &m); err != nil {
+				t.Fatal(err)
+			}
+			layer = m.Layers[0].Digest
+		}
+	}
+
+	var valid bytes.Buffer
+	if err := src.Save(ctx, &valid); err != nil {
+		t.Fatal(err)
+	}
+
+	rawTar := func(entries map[string]string, order ...string) []byte {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, name := range order {
+			if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(entries[name]))}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(entries[name])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	// flip a byte of a stored layer, keeping its size, so the saved archive carries content not matching its digest
+	layerPath := filepath.Join(src.Root, "blobs", "sha256", layer.Encoded())
+	original, err := os.ReadFile(layerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := append([]byte{}, original...)
+	corrupted[len(corrupted)/2] ^= 0xff
+	if err := os.WriteFile(layerPath, corrupted, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var corrupt bytes.Buffer
+	if err := src.Save(ctx, &corrupt); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(layerPath, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		archive  []byte
+		wantErr  error
+		wantRefs int
+	}{
+		{
+			name:     "should load a saved archive",
+			archive:  valid.Bytes(),
+			wantRefs: 2,
+		},
+		{
+			name:     "should deduplicate content already in the store",
+			archive:  valid.Bytes(),
+			wantRefs: 2,
+		},
+		{
+			name:    "should reject a truncated archive",
+			archive: valid.Bytes()[:valid.Len()/2],
+			wantErr: store.ErrInvalidArchive,
+		},
+		{
+			name:    "should reject corrupted blobs",
+			archive: corrupt.Bytes(),
+			wantErr: store.ErrInvalidArchive,
+		},
+		{
+			name: "should reject unsupported versions",
+			archive: rawTar(map[string]string{
+				store.ArchiveHeaderFile: `{"version":99}`,
+			}, store.ArchiveHeaderFile),
+			wantErr: store.ErrInvalidArchive,
+		},
+		{
+			name: "should reject archives missing blobs",
+			archive: rawTar(map[string]string{
+				store.ArchiveHeaderFile: `{"version":1,"references":0,"blobs":1}`,
+				"oci-layout":            `{"imageLayoutVersion":"1.0.0"}`,
+				"index.json":            `{"schemaVersion":2,"manifests":[]}`,
+			}, store.ArchiveHeaderFile, "oci-layout", "index.json"),
+			wantErr: store.ErrInvalidArchive,
+		},
+		{
+			name: "should identify archives without a header",
+			archive: rawTar(map[string]string{
+				"oci-layout": `{"imageLayoutVersion":"1.0.0"}`,
+			}, "oci-layout"),
+			wantErr: store.ErrUnversionedArchive,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, err := store.NewLayout(filepath.Join(root, "dst"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := dst.Load(ctx, bytes.NewReader(tt.archive))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if len(loaded) != tt.wantRefs {
+				t.Errorf("Load() loaded %d references, want %d", len(loaded), tt.wantRefs)
+			}
+
+			for _, ref := range refs {
+				if _, err := dst.Stat(ctx, ref); err != nil {
+					t.Errorf("Stat(%s) error = %v", ref, err)
+				}
+			}
+			if corrupt, err := dst.Verify(ctx); err != nil || len(corrupt) > 0 {
+				t.Errorf("Verify() = %v, %v", corrupt, err)
+			}
+		})
+	}
+}
+
+func TestLayout_Load_Encrypted(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	src, err := store.NewLayout(filepath.Join(root, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := "hello/world:v1"
+	if _, err := src.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipientsFile := filepath.Join(root, "recipients.txt")
+	if err := os.WriteFile(recipientsFile, []byte("# haul recipients\n"+identity.Recipient().String()+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	recipients, err := store.ParseRecipients(recipientsFile, other.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase, err := age.NewScryptRecipient("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase.SetWorkFactor(10)
+	passphraseIdentity, err := age.NewScryptIdentity("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	save := func(recipients ...age.Recipient) []byte {
+		var buf bytes.Buffer
+		w := io.Writer(&buf)
+		var ew io.WriteCloser
+		if len(recipients) > 0 {
+			if ew, err = store.Encrypt(&buf, recipients...); err != nil {
+				t.Fatal(err)
+			}
+			w = ew
+		}
+		if err := src.Save(ctx, w); err != nil {
+			t.Fatal(err)
+		}
+		if ew != nil {
+			if err := ew.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buf.Bytes()
+	}
+	wrong, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		archive    []byte
+		identities []age.Identity
+		wantErr    bool
+		wantErrIs  error
+	}{
+		{
+			name:       "should decrypt with a recipient's identity",
+			archive:    save(recipients...),
+			identities: []age.Identity{identity},
+		},
+		{
+			name:       "should decrypt with another recipient's identity",
+			archive:    save(recipients...),
+			identities: []age.Identity{wrong, other},
+		},
+		{
+			name:       "should decrypt with the passphrase",
+			archive:    save(passphrase),
+			identities: []age.Identity{passphraseIdentity},
+		},
+		{
+			name:       "should read archives that aren't encrypted unchanged",
+			archive:    save(),
+			identities: []age.Identity{identity},
+		},
+		{
+			name:      "should refuse encrypted archives without identities",
+			archive:   save(recipients...),
+			wantErr:   true,
+			wantErrIs: store.ErrEncryptedArchive,
+		},
+		{
+			name:       "should refuse identities the archive isn't encrypted for",
+			archive:    save(recipients...),
+			identities: []age.Identity{wrong},
+			wantErr:    true,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, err := store.NewLayout(filepath.Join(root, fmt.Sprintf("dst-%d", i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := store.Decrypt(bytes.NewReader(tt.archive), tt.identities...)
+			if err == nil {
+				_, err = dst.Load(ctx, r)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decrypt() and Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Fatalf("Decrypt() error = %v, want %v", err, tt.wantErrIs)
+			}
+			if err != nil {
+				return
+			}
+			if _, err := dst.Stat(ctx, ref); err != nil {
+				t.Errorf("Stat() of loaded [%s] = %v", ref, err)
+			}
+		})
+	}
+}
+
+func TestSegments(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	src, err := store.NewLayout(filepath.Join(root, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.AddOCI(ctx, genArtifact(t, "hello/world:v1"), "hello/world:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	const segmentSize = 1000
+	out := filepath.Join(root, "out")
+	if err := os.MkdirAll(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	sw, err := store.NewSegmentWriter(out, "haul.tar", segmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Save(ctx, sw, store.WithCompression(store.CompressionNone)); err != nil {
+		t.Fatal(err)
+	}
+	m, err := sw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Segments) < 2 {
+		t.Fatalf("expected the archive to be split, got %d segments", len(m.Segments))
+	}
+	for i, seg := range m.Segments {
+		if want := fmt.Sprintf("haul.tar.%03d", i); seg.Name != want {
+			t.Errorf("segment %d is named [%s], want [%s]", i, seg.Name, want)
+		}
+		if seg.Size > segmentSize {
+			t.Errorf("segment [%s] is %d bytes, larger than %d", seg.Name, seg.Size, segmentSize)
+		}
+	}
+
+	manifest := filepath.Join(out, "haul.tar"+store.SegmentManifestSuffix)
+	load := func() error {
+		rc, err := store.OpenSegments(manifest)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		dst, err := store.NewLayout(t.TempDir())
+		if err != nil {
+			return err
+		}
+		_, err = dst.Load(ctx, rc)
+		return err
+	}
+
+	if err := load(); err != nil {
+		t.Fatalf("loading reassembled segments: %v", err)
+	}
+
+	second := filepath.Join(out, m.Segments[1].Name)
+	data, err := os.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] ^= 0xff
+	if err := os.WriteFile(second, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := load(); !errors.Is(err, store.ErrInvalidSegment) {
+		t.Errorf("loading a corrupted segment: error = %v, want %v", err, store.ErrInvalidSegment)
+	}
+
+	if err := os.Remove(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := load(); !errors.Is(err, store.ErrInvalidSegment) {
+		t.Errorf("loading a missing segment: error = %v, want %v", err, store.ErrInvalidSegment)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "4GB", want: 4e9},
+		{in: "4.7GB", want: 4.7e9},
+		{in: "700MiB", want: 700 << 20},
+		{in: "1024", want: 1024},
+		{in: "512 kb", want: 512e3},
+		{in: "", wantErr: true},
+		{in: "-1GB", wantErr: true},
+		{in: "lots", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := store.ParseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSpace(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		path     string
+		required int64
+		wantErr  error
+	}{
+		{name: "empty", path: dir, required: 0},
+		{name: "missing directory", path: filepath.Join(dir, "not", "yet", "created"), required: 1 << 10},
+		{name: "too large", path: dir, required: 1 << 62, wantErr: store.ErrInsufficientSpace},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := store.CheckSpace(tt.path, tt.required)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("CheckSpace() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CheckSpace() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want string
+	}{
+		{in: 512, want: "512 B"},
+		{in: 4.7e9, want: "4.7 GB"},
+		{in: 700e6, want: "700.0 MB"},
+	}
+	for _, tt := range tests {
+		if got := store.FormatSize(tt.in); got != tt.want {
+			t.Errorf("FormatSize(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+		if n, err := store.ParseSize(tt.want); err != nil || n != tt.in {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.want, n, err, tt.in)
+		}
+	}
+}
+
+func TestLayout_Verify(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moci := genArtifact(t, "hello/world:v1")
+	if _, err := s.AddOCI(ctx, moci, "hello/world:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, genArtifact(t, "hello/other:v1"), "hello/other:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Verify(ctx)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("Verify() on an intact store = %v, want none", got)
+	}
+
+	layers, err := moci.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []digest.Digest
+	for i, lyr := range layers {
+		h, err := lyr.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := digest.Digest(h.String())
+		path := filepath.Join(root, "blobs", d.Algorithm().String(), d.Encoded())
+		switch i {
+		case 0:
+			err = os.WriteFile(path, []byte("bit rot"), 0644)
+		case 1:
+			err = os.Remove(path)
+		default:
+			// a copy cut short
+			var fi os.FileInfo
+			if fi, err = os.Stat(path); err == nil {
+				err = os.Truncate(path, fi.Size()/2)
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, d)
+	}
+
+	got, err = s.Verify(ctx, store.WithVerifyConcurrency(1))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	gotSet := make(map[digest.Digest]bool)
+	for _, d := range got {
+		gotSet[d] = true
+	}
+	wantSet := make(map[digest.Digest]bool)
+	for _, d := range want {
+		wantSet[d] = true
+	}
+	if !reflect.DeepEqual(gotSet, wantSet) {
+		t.Errorf("Verify() = %v, want %v", got, want)
+	}
+}
+
+func TestLayout_Repair(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broken := genArtifact(t, "hello/broken:v1")
+	if _, err := s.AddOCI(ctx, broken, "hello/broken:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, genArtifact(t, "hello/intact:v1"), "hello/intact:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a layer that never landed, as if the add was killed after indexing
+	layers, err := broken.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := layers[1].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "blobs", h.Algorithm, h.Hex)); err != nil {
+		t.Fatal(err)
+	}
+
+	dangling, err := s.Dangling(ctx)
+	if err != nil {
+		t.Fatalf("Dangling() error = %v", err)
+	}
+	if len(dangling) != 1 || dangling[0].Descriptor.Annotations[ocispec.AnnotationRefName] != "hello/broken:v1" || dangling[0].Err == nil {
+		t.Fatalf("Dangling() = %+v, want only [hello/broken:v1] with its missing blob", dangling)
+	}
+
+	repaired, err := s.Repair(ctx)
+	if err != nil {
+		t.Fatalf("Repair() error = %v", err)
+	}
+	if len(repaired) != 1 {
+		t.Fatalf("Repair() = %+v, want [hello/broken:v1] dropped", repaired)
+	}
+
+	var refs []string
+	if err := s.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		refs = append(refs, desc.Annotations[ocispec.AnnotationRefName])
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(refs, []string{"hello/intact:v1"}) {
+		t.Errorf("index after Repair() = %v, want [hello/intact:v1]", refs)
+	}
+
+	// the index is replaced whole, never leaving its temporary files behind
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("temporary file [%s] left in the store", e.Name())
+		}
+	}
+
+	if dangling, err := s.Dangling(ctx); err != nil || len(dangling) != 0 {
+		t.Errorf("Dangling() after Repair() = %+v, %v, want none", dangling, err)
+	}
+	history, err := s.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := history[len(history)-1]; last.Action != store.AuditRemove || last.Reference != "hello/broken:v1" {
+		t.Errorf("last audit entry = %s [%s], want remove [hello/broken:v1]", last.Action, last.Reference)
+	}
+}
+
+func TestLayout_Lock(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		// releaseAfter is when the other process lets go of the lock, never when 0
+		releaseAfter time.Duration
+		wantErr      error
+	}{
+		{
+			name:    "held, no wait",
+			wantErr: store.ErrLocked,
+		},
+		{
+			name:         "held, released while waiting",
+			timeout:      5 * time.Second,
+			releaseAfter: 100 * time.Millisecond,
+		},
+		{
+			name:    "held past the wait",
+			timeout: 300 * time.Millisecond,
+			wantErr: store.ErrLocked,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			teardown := setup(t)
+			defer teardown()
+
+			s, err := store.NewLayout(root, store.WithLockTimeout(tt.timeout))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// another process, holding the lock while adding to the store
+			other := flock.New(filepath.Join(root, store.LockFile))
+			if ok, err := other.TryLock(); !ok || err != nil {
+				t.Fatalf("TryLock() = %v, %v", ok, err)
+			}
+			defer other.Unlock()
+			otherStore, err := store.NewLayout(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := otherStore.AddOCI(ctx, genArtifact(t, "hello/other:v1"), "hello/other:v1"); err != nil {
+				t.Fatal(err)
+			}
+			if tt.releaseAfter > 0 {
+				time.AfterFunc(tt.releaseAfter, func() { other.Unlock() })
+			}
+
+			unlock, err := s.Lock(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Lock() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer unlock()
+
+			// the lock is reentrant within the process, and what the other process added is seen
+			again, err := s.Lock(ctx)
+			if err != nil {
+				t.Fatalf("Lock() while held by the process = %v", err)
+			}
+			again()
+			if _, err := s.Stat(ctx, "hello/other:v1"); err != nil {
+				t.Errorf("Stat() of what the other process added = %v", err)
+			}
+		})
+	}
+}
+
+func TestLayout_CreateIndex(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amd64, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v1-amd64"), "hello/world:v1-amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	arm64, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v1-arm64"), "hello/world:v1-arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	platforms := []ocispec.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64"},
+	}
+	missing := ocispec.Descriptor{MediaType: amd64.MediaType, Digest: digest.FromString("missing"), Size: 7}
+
+	tests := []struct {
+		name      string
+		members   []ocispec.Descriptor
+		platforms []ocispec.Platform
+		wantErr   bool
+	}{
+		{
+			name:      "should index stored manifests",
+			members:   []ocispec.Descriptor{amd64, arm64},
+			platforms: platforms,
+		},
+		{
+			name:      "should reject members missing from the store",
+			members:   []ocispec.Descriptor{amd64, missing},
+			platforms: platforms,
+			wantErr:   true,
+		},
+		{
+			name:      "should reject mismatched platforms",
+			members:   []ocispec.Descriptor{amd64, arm64},
+			platforms: platforms[:1],
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateIndex(ctx, "hello/world:v1", tt.members, tt.platforms)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateIndex() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got.Annotations[ocispec.AnnotationRefName] != "hello/world:v1" {
+				t.Errorf("CreateIndex() tagged as [%s]", got.Annotations[ocispec.AnnotationRefName])
+			}
+
+			rc, err := s.Fetch(ctx, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+
+			var idx ocispec.Index
+			if err := json.NewDecoder(rc).Decode(&idx); err != nil {
+				t.Fatal(err)
+			}
+			if len(idx.Manifests) != len(tt.members) {
+				t.Fatalf("index has %d manifests, want %d", len(idx.Manifests), len(tt.members))
+			}
+			for i, m := range idx.Manifests {
+				if m.Digest != tt.members[i].Digest {
+					t.Errorf("manifest %d = [%s], want [%s]", i, m.Digest, tt.members[i].Digest)
+				}
+				if m.Platform == nil || m.Platform.Architecture != tt.platforms[i].Architecture {
+					t.Errorf("manifest %d platform = %v, want %v", i, m.Platform, tt.platforms[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLayout_List(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// totalSize sums the manifest, config, and layers of an artifact
+	totalSize := func(oci artifacts.OCI, desc ocispec.Descriptor) int64 {
+		m, err := oci.Manifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := desc.Size + m.Config.Size
+		for _, l := range m.Layers {
+			size += l.Size
+		}
+		return size
+	}
+
+	amd64Artifact := genArtifact(t, "hello/world:v1-amd64")
+	amd64, err := s.AddOCI(ctx, amd64Artifact, "hello/world:v1-amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	arm64Artifact := genArtifact(t, "hello/world:v1-arm64")
+	arm64, err := s.AddOCI(ctx, arm64Artifact, "hello/world:v1-arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := s.CreateIndex(ctx, "hello/world:v1", []ocispec.Descriptor{amd64, arm64}, []ocispec.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]store.Artifact)
+	for _, a := range listed {
+		got[a.Reference] = a
+	}
+
+	tests := []struct {
+		name          string
+		desc          ocispec.Descriptor
+		wantSize      int64
+		wantPlatforms []string
+	}{
+		{
+			name:     "should sum every blob of an image",
+			desc:     amd64,
+			wantSize: totalSize(amd64Artifact, amd64),
+		},
+		{
+			name:          "should sum every member of an index and list their platforms",
+			desc:          idx,
+			wantSize:      idx.Size + totalSize(amd64Artifact, amd64) + totalSize(arm64Artifact, arm64),
+			wantPlatforms: []string{"linux/amd64", "linux/arm64/v8"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := tt.desc.Annotations[ocispec.AnnotationRefName]
+			a, ok := got[ref]
+			if !ok {
+				t.Fatalf("List() is missing [%s]", ref)
+			}
+			if a.Digest != tt.desc.Digest || a.MediaType != tt.desc.MediaType {
+				t.Errorf("List() [%s] = %s (%s), want %s (%s)", ref, a.Digest, a.MediaType, tt.desc.Digest, tt.desc.MediaType)
+			}
+			if a.Size != tt.wantSize {
+				t.Errorf("List() [%s] size = %d, want %d", ref, a.Size, tt.wantSize)
+			}
+			if tt.wantPlatforms != nil && !reflect.DeepEqual(a.Platforms, tt.wantPlatforms) {
+				t.Errorf("List() [%s] platforms = %v, want %v", ref, a.Platforms, tt.wantPlatforms)
+			}
+		})
+	}
+
+	if len(listed) != 3 {
+		t.Errorf("List() returned %d artifacts, want 3", len(listed))
+	}
+	for i := 1; i < len(listed); i++ {
+		if listed[i-1].Reference > listed[i].Reference {
+			t.Errorf("List() isn't sorted, [%s] before [%s]", listed[i-1].Reference, listed[i].Reference)
+		}
+	}
+}
+
+func TestLayout_FilterPlatforms(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := store.ParsePlatforms("linux/amd64,linux/arm64,linux/s390x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var members []ocispec.Descriptor
+	var layers [][]digest.Digest
+	for _, p := range ps {
+		ref := "hello/world:v1-" + p.Architecture
+		oci := genArtifact(t, ref)
+		desc, err := s.AddOCI(ctx, oci, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// only the index references its members
+		if err := s.OCI.RemoveIndex(desc); err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, desc)
+
+		m, err := oci.Manifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ds []digest.Digest
+		for _, l := range m.Layers {
+			ds = append(ds, digest.Digest(l.Digest.String()))
+		}
+		layers = append(layers, ds)
+	}
+	idx, err := s.CreateIndex(ctx, "hello/world:v1", members, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := idx.Annotations[ocispec.AnnotationRefName]
+
+	if _, err := s.FilterPlatforms(ctx, ref, ocispec.Platform{OS: "windows", Architecture: "amd64"}); !errors.Is(err, store.ErrNoMatchingPlatform) {
+		t.Fatalf("FilterPlatforms() error = %v, want %v", err, store.ErrNoMatchingPlatform)
+	}
+
+	want, err := store.ParsePlatforms("linux/amd64, linux/arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered, err := s.FilterPlatforms(ctx, ref, want...)
+	if err != nil {
+		t.Fatalf("FilterPlatforms() error = %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].Digest == idx.Digest {
+		t.Fatalf("FilterPlatforms() = %v, want a single rewritten index", filtered)
+	}
+
+	listed, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || !reflect.DeepEqual(listed[0].Platforms, []string{"linux/amd64", "linux/arm64"}) {
+		t.Errorf("List() = %v, want only the index of linux/amd64 and linux/arm64", listed)
+	}
+
+	if blobExists(s, idx.Digest) {
+		t.Errorf("the original index [%s] should be deleted", idx.Digest)
+	}
+	for i, m := range members {
+		keep := i < 2
+		if got := blobExists(s, m.Digest); got != keep {
+			t.Errorf("manifest [%s] exists = %v, want %v", ps[i].Architecture, got, keep)
+		}
+		for _, d := range layers[i] {
+			if got := blobExists(s, d); got != keep {
+				t.Errorf("layer [%s] of [%s] exists = %v, want %v", d, ps[i].Architecture, got, keep)
+			}
+		}
+	}
+
+	// filtering again has nothing left to drop
+	if again, err := s.FilterPlatforms(ctx, ref, want...); err != nil || len(again) != 0 {
+		t.Errorf("FilterPlatforms() again = %v, %v, want nothing rewritten", again, err)
+	}
+}
+
+func TestParsePlatforms(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []ocispec.Platform
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "linux/amd64", want: []ocispec.Platform{{OS: "linux", Architecture: "amd64"}}},
+		{in: "linux/amd64, linux/arm/v7", want: []ocispec.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm", Variant: "v7"}}},
+		{in: "linux/amd64/v1/extra", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := store.ParsePlatforms(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePlatforms(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePlatforms(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLayout_Diff(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	base, err := store.NewLayout(filepath.Join(root, "base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.NewLayout(filepath.Join(root, "current"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(l *store.Layout, ref string, data string) ocispec.Descriptor {
+		desc, err := l.AddOCI(ctx, memory.NewMemory([]byte(data), "application/octet-stream"), ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return desc
+	}
+	add(base, "hello/same:v1", "same")
+	add(s, "hello/same:v1", "same")
+	before := add(base, "hello/changed:v1", "before")
+	after := add(s, "hello/changed:v1", "after")
+	removed := add(base, "hello/removed:v1", "removed")
+	added := add(s, "hello/added:v1", "added")
+
+	d, err := s.Diff(ctx, base)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	if len(d.Added) != 1 || d.Added[0].Digest != added.Digest {
+		t.Errorf("Diff() added = %v, want only [%s]", d.Added, added.Annotations[ocispec.AnnotationRefName])
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Digest != removed.Digest {
+		t.Errorf("Diff() removed = %v, want only [%s]", d.Removed, removed.Annotations[ocispec.AnnotationRefName])
+	}
+	if len(d.Changed) != 1 || d.Changed[0].From.Digest != before.Digest || d.Changed[0].To.Digest != after.Digest {
+		t.Errorf("Diff() changed = %v, want [%s] from [%s] to [%s]", d.Changed, after.Annotations[ocispec.AnnotationRefName], before.Digest, after.Digest)
+	}
+
+	if d, err := s.Diff(ctx, s); err != nil || !d.IsEmpty() {
+		t.Errorf("Diff() against itself = %v, %v, want no changes", d, err)
+	}
+}
+
+func TestLayout_Current(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := store.ParsePlatforms("linux/amd64,linux/arm64,linux/s390x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var members, manifests []ocispec.Descriptor
+	for i, p := range ps {
+		ref := "hello/world:v1-" + p.Architecture
+		desc, err := s.AddOCI(ctx, genArtifact(t, ref), ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.OCI.RemoveIndex(desc); err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, desc)
+
+		m := desc
+		m.Annotations = nil
+		m.Platform = &ps[i]
+		manifests = append(manifests, m)
+	}
+	idx, err := s.CreateIndex(ctx, "hello/world:v1", members, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	single, err := s.AddOCI(ctx, genArtifact(t, "hello/single:v1"), "hello/single:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the remote index serves the stored manifest as one of its platforms
+	singleRemote := ocispec.Descriptor{MediaType: consts.OCIImageIndexSchema, Digest: digest.FromString("single")}
+	singleManifests := []ocispec.Descriptor{manifests[1], manifests[2]}
+	singleManifests[0].Digest = single.Digest
+
+	ref := idx.Annotations[ocispec.AnnotationRefName]
+
+	type test struct {
+		name      string
+		ref       string
+		remote    ocispec.Descriptor
+		manifests []ocispec.Descriptor
+		platforms string
+		want      bool
+	}
+	run := func(tests []test) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				ps, err := store.ParsePlatforms(tt.platforms)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := s.Current(ctx, tt.ref, tt.remote, tt.manifests, ps...)
+				if err != nil {
+					t.Fatalf("Current() error = %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("Current() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+
+	run([]test{
+		{name: "same digest", ref: ref, remote: idx, want: true},
+		{name: "changed digest", ref: ref, remote: ocispec.Descriptor{Digest: digest.FromString("changed")}, want: false},
+		{name: "not stored", ref: "hello/missing:v1", remote: idx, want: false},
+		{name: "single platform", ref: "hello/single:v1", remote: singleRemote, manifests: singleManifests, platforms: "linux/arm64", want: true},
+		{name: "single platform changed", ref: "hello/single:v1", remote: singleRemote, manifests: manifests, platforms: "linux/arm64", want: false},
+	})
+
+	// narrowed down, the index no longer matches the remote index as a whole
+	want, err := store.ParsePlatforms("linux/amd64,linux/arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FilterPlatforms(ctx, ref, want...); err != nil {
+		t.Fatal(err)
+	}
+	run([]test{
+		{name: "filtered", ref: ref, remote: idx, manifests: manifests, platforms: "linux/amd64,linux/arm64", want: true},
+		{name: "filtered to other platforms", ref: ref, remote: idx, manifests: manifests, platforms: "linux/amd64", want: false},
+		{name: "filtered without platforms", ref: ref, remote: idx, manifests: manifests, want: false},
+	})
+}
+
+func TestLayout_Missing(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.AddOCI(ctx, memory.NewMemory([]byte("stored"), "application/octet-stream"), "hello/stored:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	absent := ocispec.Descriptor{Digest: digest.FromString("absent"), Size: 6}
+
+	missing, err := s.Missing([]ocispec.Descriptor{stored, absent, absent})
+	if err != nil {
+		t.Fatalf("Missing() error = %v", err)
+	}
+	if len(missing) != 1 || missing[0].Digest != absent.Digest {
+		t.Errorf("Missing() = %v, want only [%s] once", missing, absent.Digest)
+	}
+}
+
+func TestLayout_AddOCICollection_ContinueOnError(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := mockCollection{
+		"hello/good:v1":   genArtifact(t, "hello/good:v1"),
+		"hello/broken:v1": brokenArtifact{genArtifact(t, "hello/broken:v1")},
+	}
+
+	if _, err := s.AddOCICollection(ctx, c); !errors.Is(err, errBrokenArtifact) {
+		t.Fatalf("AddOCICollection() error = %v, want %v", err, errBrokenArtifact)
+	}
+
+	descs, err := s.AddOCICollection(ctx, c, store.WithContinueOnError())
+	var aerr *store.AddCollectionError
+	if !errors.As(err, &aerr) {
+		t.Fatalf("AddOCICollection() error = %v, want an AddCollectionError", err)
+	}
+	if aerr.Total != 2 || len(aerr.Failures) != 1 || aerr.Failures[0].Reference != "hello/broken:v1" {
+		t.Errorf("AddOCICollection() failures = %v of [%d], want only [hello/broken:v1] of [2]", aerr.Failures, aerr.Total)
+	}
+	if !errors.Is(err, errBrokenArtifact) {
+		t.Errorf("AddOCICollection() error = %v, want it to wrap %v", err, errBrokenArtifact)
+	}
+	if len(descs) != 1 || descs[0].Annotations[ocispec.AnnotationRefName] != "hello/good:v1" {
+		t.Errorf("AddOCICollection() = %v, want only [hello/good:v1] added", descs)
+	}
+}
+
+var errBrokenArtifact = errors.New("broken artifact")
+
+// brokenArtifact fails to return its layers
+type brokenArtifact struct {
+	artifacts.OCI
+}
+
+func (brokenArtifact) Layers() ([]v1.Layer, error) {
+	return nil, errBrokenArtifact
+}
+
+type mockCollection map[string]artifacts.OCI
+
+func (c mockCollection) Contents() (map[string]artifacts.OCI, error) {
+	return c, nil
+}
+
+func TestLayout_AddLayout(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	// a layout as skopeo writes it, annotated with tags alone, holding an image and a multi-arch index
+	src := t.TempDir()
+	lp, err := layout.Write(src, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := random.Index(512, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lp.AppendImage(img, layout.WithAnnotations(map[string]string{ocispec.AnnotationRefName: "v1", "org.example/built-by": "ci"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := lp.AppendIndex(idx, layout.WithAnnotations(map[string]string{ocispec.AnnotationRefName: "v2"})); err != nil {
+		t.Fatal(err)
+	}
+	imgDigest, _ := img.Digest()
+	idxDigest, _ := idx.Digest()
+
+	tests := []struct {
+		name       string
+		ref        string
+		wantRef    string
+		wantDigest v1.Hash
+		wantErr    error
+	}{
+		{
+			name:       "should copy the image tagged the tag of ref",
+			ref:        "registry.example.com/app:v1",
+			wantRef:    "registry.example.com/app:v1",
+			wantDigest: imgDigest,
+		},
+		{
+			name:       "should copy an index with every manifest it holds",
+			ref:        "registry.example.com/app:v2",
+			wantRef:    "registry.example.com/app:v2",
+			wantDigest: idxDigest,
+		},
+		{
+			name:    "should fail when no manifest is tagged ref",
+			ref:     "registry.example.com/app:v3",
+			wantErr: store.ErrNotInLayout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := store.NewLayout(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			added, err := s.AddLayout(ctx, src, tt.ref)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AddLayout() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(added) != 1 {
+				t.Fatalf("AddLayout() added %d manifests, want 1", len(added))
+			}
+
+			desc, err := s.Stat(ctx, tt.wantRef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if desc.Digest.String() != tt.wantDigest.String() {
+				t.Errorf("AddLayout() stored [%s] as %s, want %s", tt.wantRef, desc.Digest, tt.wantDigest)
+			}
+			if missing, err := s.Verify(ctx); err != nil || len(missing) > 0 {
+				t.Errorf("Verify() = %v, %v after AddLayout()", missing, err)
+			}
+		})
+	}
+
+	// annotations other than the reference are preserved
+	s, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := s.AddLayout(ctx, src, "registry.example.com/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := added[0].Annotations["org.example/built-by"]; got != "ci" {
+		t.Errorf("AddLayout() annotation = %q, want %q", got, "ci")
+	}
+}
+
 func setup(t *testing.T) func() error {
 	tmpdir, err := os.MkdirTemp("", "hauler")
 	if err != nil {
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rancherfederal/hauler/pkg/log"
+)
+
+// Verify reads every blob reachable from the store's index, recomputes its digest, and returns the digests of any blobs
+// that are missing or whose size or content no longer matches their descriptor
+//
+//	Verification continues past corrupt blobs so a single run reports everything.  A manifest that can't be parsed is
+//	reported, but the blobs it references can't be discovered and are skipped.
+func (l *Layout) Verify(ctx context.Context, opts ...VerifyOption) ([]digest.Digest, error) {
+	logger := log.FromContext(ctx)
+	o := makeVerifyOpts(opts...)
+
+	blobs, err := l.reachable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var corrupt []digest.Digest
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(o.concurrency)
+	for _, desc := range blobs {
+		desc := desc
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			if err := l.verifyBlob(desc); err != nil {
+				logger.Warnf("blob [%s] failed verification: %v", desc.Digest, err)
+				mu.Lock()
+				corrupt = append(corrupt, desc.Digest)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(corrupt, func(i, j int) bool { return corrupt[i] < corrupt[j] })
+	return corrupt, nil
+}
+
+// reachable returns every unique descriptor reachable from the store's index
+func (l *Layout) reachable(ctx context.Context) ([]ocispec.Descriptor, error) {
+	var queue []ocispec.Descriptor
+	if err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		queue = append(queue, desc)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[digest.Digest]bool)
+	var descs []ocispec.Descriptor
+	for len(queue) > 0 {
+		desc := queue[0]
+		queue = queue[1:]
+		if seen[desc.Digest] {
+			continue
+		}
+		seen[desc.Digest] = true
+		descs = append(descs, desc)
+
+		children, err := l.children(ctx, desc)
+		if err != nil {
+			// the blob itself is verified, an unreadable manifest simply has no discoverable children
+			continue
+		}
+		queue = append(queue, children...)
+	}
+	return descs, nil
+}
+
+func (l *Layout) verifyBlob(desc ocispec.Descriptor) error {
+	d := desc.Digest
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(filepath.Join(l.Root, "blobs", d.Algorithm().String(), d.Encoded()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// a size mismatch is the telltale of a truncated copy, and is far cheaper to spot than a digest mismatch
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() != desc.Size {
+		return fmt.Errorf("blob is [%d] bytes, expected [%d]", fi.Size(), desc.Size)
+	}
+
+	actual, err := d.Algorithm().FromReader(f)
+	if err != nil {
+		return err
+	}
+	if actual != d {
+		return fmt.Errorf("content digest is [%s]", actual)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rancherfederal/hauler/internal/version"
+)
+
+// TracerName is the instrumentation scope of every span hauler starts
+const TracerName = "github.com/rancherfederal/hauler"
+
+const (
+	AttrReference = attribute.Key("hauler.reference")
+	AttrDigest    = attribute.Key("hauler.digest")
+	AttrBytes     = attribute.Key("hauler.bytes")
+	AttrFile      = attribute.Key("hauler.file")
+)
+
+// shutdownTimeout bounds how long the spans still buffered are given to reach the collector once the command is done
+const shutdownTimeout = 10 * time.Second
+
+var (
+	mu       sync.Mutex
+	provider *sdktrace.TracerProvider
+	root     trace.Span
+)
+
+// Setup exports the spans of the command to the OTLP/HTTP collector at endpoint, returning a copy of ctx holding the
+// root span of the command, named name
+//
+//	The endpoint is a url such as http://collector:4318, traces being posted to /v1/traces unless it has a path of its
+//	own, or a bare host and port sent to over https.  The trace context is propagated on every request to a registry,
+//	so the spans of the command are correlated with the traces of the registries it talks to.  Without an endpoint no
+//	spans are exported and ctx is returned as is.
+func Setup(ctx context.Context, endpoint string, name string) (context.Context, error) {
+	if endpoint == "" {
+		return ctx, nil
+	}
+
+	opts, err := exporterOptions(endpoint)
+	if err != nil {
+		return ctx, err
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return ctx, fmt.Errorf("creating otlp exporter for [%s]: %w", endpoint, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("hauler"),
+		semconv.ServiceVersion(version.GetVersionInfo().GitVersion),
+	))
+	if err != nil {
+		return ctx, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	mu.Lock()
+	defer mu.Unlock()
+	provider = tp
+	ctx, root = tp.Tracer(TracerName).Start(ctx, name)
+	return ctx, nil
+}
+
+// exporterOptions returns the options of an exporter posting spans to endpoint
+func exporterOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing otlp endpoint [%s]: %w", endpoint, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("parsing otlp endpoint [%s]: missing host", endpoint)
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	switch u.Scheme {
+	case "http":
+		opts = append(opts, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("unsupported otlp endpoint scheme [%s], must be one of http or https", u.Scheme)
+	}
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+	return opts, nil
+}
+
+// Shutdown ends the root span of the command, failed with err if any, and flushes every span still buffered to the
+// collector, doing nothing when Setup exported none
+func Shutdown(ctx context.Context, err error) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if provider == nil {
+		return nil
+	}
+
+	End(root, err)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+	if err := provider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("flushing spans: %w", err)
+	}
+	provider, root = nil, nil
+	return nil
+}
+
+// Start starts the span name as a child of the span of ctx, returning a copy of ctx holding it
+//
+//	Spans are recorded only once Setup is given an endpoint, until then Start is next to free.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends span, recording err as its failure if any
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Reference returns the attribute of the reference of an artifact
+func Reference(ref string) attribute.KeyValue {
+	return AttrReference.String(ref)
+}
+
+// Digest returns the attribute of the digest of an artifact
+func Digest(d digest.Digest) attribute.KeyValue {
+	return AttrDigest.String(d.String())
+}
+
+// Bytes returns the attribute of the size of an artifact, or of the bytes transferred
+func Bytes(n int64) attribute.KeyValue {
+	return AttrBytes.Int64(n)
+}
+
+// File returns the attribute of a file read or written
+func File(name string) attribute.KeyValue {
+	return AttrFile.String(name)
+}
@@ -0,0 +1,101 @@
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rancherfederal/hauler/pkg/telemetry"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		wantPath string
+	}{
+		{
+			name:     "default path",
+			wantPath: "/v1/traces",
+		},
+		{
+			name:     "custom path",
+			path:     "/otlp/v1/traces",
+			wantPath: "/otlp/v1/traces",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu     sync.Mutex
+				paths  []string
+				bodies []string
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				data, _ := io.ReadAll(req.Body)
+				mu.Lock()
+				paths = append(paths, req.URL.Path)
+				bodies = append(bodies, string(data))
+				mu.Unlock()
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			ctx, err := telemetry.Setup(context.Background(), srv.URL+tt.path, "hauler store sync")
+			if err != nil {
+				t.Fatalf("Setup() error = %v", err)
+			}
+			_, span := telemetry.Start(ctx, "store.AddOCI", telemetry.Reference("hauler/f.txt:latest"))
+			telemetry.End(span, errors.New("boom"))
+
+			if err := telemetry.Shutdown(ctx, nil); err != nil {
+				t.Fatalf("Shutdown() error = %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(paths) == 0 {
+				t.Fatalf("no spans were exported")
+			}
+			for _, p := range paths {
+				if p != tt.wantPath {
+					t.Errorf("spans exported to [%s], want [%s]", p, tt.wantPath)
+				}
+			}
+			all := strings.Join(bodies, "")
+			for _, want := range []string{"hauler store sync", "store.AddOCI", "hauler/f.txt:latest", "boom"} {
+				if !strings.Contains(all, want) {
+					t.Errorf("exported spans are missing [%s]", want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetup_Endpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		wantErr  bool
+	}{
+		{name: "none", endpoint: ""},
+		{name: "bare host", endpoint: "localhost:4318"},
+		{name: "unsupported scheme", endpoint: "grpc://localhost:4317", wantErr: true},
+		{name: "missing host", endpoint: "http://", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, err := telemetry.Setup(context.Background(), tt.endpoint, "hauler")
+			// nothing listens on the endpoints, so the root span failing to flush is of no interest
+			defer telemetry.Shutdown(ctx, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Setup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}